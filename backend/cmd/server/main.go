@@ -1,17 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"sleek-chat-backend/internal/adapters/handlers"
 	"sleek-chat-backend/internal/adapters/middleware"
+	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/repository"
 	"sleek-chat-backend/internal/domain/usecase"
 	"sleek-chat-backend/internal/infrastructure/database"
+	"sleek-chat-backend/internal/infrastructure/jobs"
 	"sleek-chat-backend/internal/infrastructure/websocket"
 	"sleek-chat-backend/pkg/config"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/metrics"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -32,6 +36,7 @@ func main() {
 	cfg := config.Load()
 
 	appLogger := logger.New()
+	appMetrics := metrics.New()
 	appLogger.Info("Starting Sleek Chat Backend Server...")
 
 	db, err := database.New(&cfg.Database)
@@ -50,25 +55,63 @@ func main() {
 		Message:     database.NewMessageRepository(db.DB),
 		Session:     database.NewSessionRepository(db.DB),
 		KeyExchange: database.NewKeyExchangeRepository(db.DB),
+		Attachment:  database.NewAttachmentRepository(db.DB),
+		Reaction:    database.NewReactionRepository(db.DB),
+		Report:      database.NewReportRepository(db.DB),
+		AuditLog:    database.NewAuditLogRepository(db.DB),
+
+		FailedNotification: database.NewFailedNotificationRepository(db.DB),
 	}
-	authUseCase := usecase.NewAuthUseCase(repos.User, repos.Session, cfg.JWT.Secret)
+
+	go jobs.RunKeyExchangeCleanup(context.Background(), repos.KeyExchange, &cfg.Jobs, appLogger)
+	go jobs.RunDeletedMessagePurge(context.Background(), repos.Message, &cfg.Jobs, cfg.Chat.RestoreWindow, appLogger)
+	auditLogger := usecase.NewAuditLogger(repos.AuditLog, appLogger)
+	authUseCase := usecase.NewAuthUseCase(repos.User, repos.Session, &cfg.JWT, &cfg.Keys, &cfg.Admin, auditLogger)
 	userUseCase := usecase.NewUserUseCase(repos.User)
-	keyExchangeUseCase := usecase.NewKeyExchangeUseCase(repos.Session, repos.User, appLogger)
+	keyExchangeUseCase := usecase.NewKeyExchangeUseCase(repos.Session, repos.User, repos.KeyExchange, &cfg.Keys, appLogger, auditLogger)
 
-	wsHub := websocket.NewHub(appLogger, nil)
+	if err := cfg.WebSocket.Validate(); err != nil {
+		appLogger.Fatalf("Invalid WebSocket config: %v", err)
+	}
+	wsHub := websocket.NewHub(appLogger, nil, &cfg.WebSocket)
+	wsHub.SetNotificationQueue(usecase.NewNotificationQueue(repos.FailedNotification, appLogger))
 	go wsHub.Run()
 
-	chatUseCase := usecase.NewChatUseCase(repos.Chat, repos.Message, repos.User, repos.KeyExchange, wsHub)
+	if !crypto.IsSupportedMessageAlgorithm(cfg.Chat.MessageAlgorithm) {
+		appLogger.Fatalf("Unsupported MESSAGE_ENCRYPTION_ALGORITHM: %s", cfg.Chat.MessageAlgorithm)
+	}
+	chatUseCase := usecase.NewChatUseCase(repos.Chat, repos.Message, repos.User, repos.KeyExchange, wsHub, wsHub, &cfg.Chat, appLogger, appMetrics, auditLogger)
 
 	wsHub.SetChatUseCase(chatUseCase)
+	userUseCase.SetPresenceTracker(wsHub)
+	keyExchangeUseCase.SetNotificationSender(wsHub)
+
+	contentFilter, err := usecase.NewContentFilter(cfg.Chat.ContentFilterWordlist, cfg.Chat.ContentFilterAction)
+	if err != nil {
+		appLogger.Fatalf("Failed to load content filter: %v", err)
+	}
+	chatUseCase.SetContentFilter(contentFilter)
+
+	attachmentUseCase := usecase.NewAttachmentUseCase(repos.Attachment, repos.Chat, &cfg.Chat)
+	reactionUseCase := usecase.NewReactionUseCase(repos.Reaction, repos.Message, repos.Chat, &cfg.Chat)
+	reportUseCase := usecase.NewReportUseCase(repos.Report, repos.Message, repos.Chat)
 
-	authHandler := handlers.NewAuthHandler(authUseCase, appLogger)
+	authHandler := handlers.NewAuthHandler(authUseCase, chatUseCase, appLogger)
 	chatHandler := handlers.NewChatHandler(chatUseCase, wsHub, appLogger)
 	userHandler := handlers.NewUserHandler(userUseCase, appLogger)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentUseCase, appLogger)
+	reactionHandler := handlers.NewReactionHandler(reactionUseCase, appLogger)
+	reportHandler := handlers.NewReportHandler(reportUseCase, appLogger)
 	wsHandler := handlers.NewWebSocketHandler(wsHub, appLogger)
+	guestHandler := handlers.NewGuestHandler(authUseCase, chatUseCase, wsHub, appLogger)
 
 	authMiddleware := middleware.NewAuthMiddleware(authUseCase, appLogger)
 	encryptionMiddleware := middleware.NewEncryptionMiddleware(repos.Session, appLogger)
+	encryptionMiddleware.SetSessionValidator(func(ctx context.Context, sessionID string) error {
+		_, err := keyExchangeUseCase.ValidateSession(ctx, sessionID)
+		return err
+	})
+	encryptionMiddleware.SetPlaintextPaths(cfg.Server.PlaintextPaths...)
 	keyExchangeHandler := handlers.NewKeyExchangeHandler(keyExchangeUseCase, encryptionMiddleware, appLogger)
 
 	gin.SetMode(gin.ReleaseMode)
@@ -76,9 +119,14 @@ func main() {
 	router.Use(gin.Recovery())
 	router.Use(middleware.CORSMiddleware())
 	router.Use(middleware.LoggerMiddleware(appLogger))
-	// Добавляем middleware для шифрования (применяется ко всем маршрутам)
+	router.Use(middleware.ClientIPMiddleware())
+	// Потоковые ответы не буферизуются: шифрование ответа и ограничение времени к ним не применяются
+	streamingRoutes := []string{"/api/v1/chats/:id/export", "/api/v1/auth/export-data"}
+
+	// Добавляем middleware для шифрования (применяется ко всем маршрутам, кроме cfg.Server.PlaintextPaths)
 	router.Use(encryptionMiddleware.DecryptRequest())
-	router.Use(encryptionMiddleware.EncryptResponse())
+	router.Use(encryptionMiddleware.EncryptResponse(streamingRoutes...))
+	router.Use(middleware.TimeoutMiddleware(cfg.Server.RequestTimeout, streamingRoutes...))
 
 	// Swagger UI
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -90,6 +138,13 @@ func main() {
 		})
 	})
 
+	// Счетчики раскрывают внутреннее состояние сервиса (сбои расшифровки, нагрузку), поэтому доступны только администраторам
+	router.GET("/metrics", authMiddleware.RequireAuth(), authMiddleware.RequireAdmin(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"counters": appMetrics.Snapshot(),
+		})
+	})
+
 	api := router.Group("/api/v1")
 	{
 		auth := api.Group("/auth")
@@ -98,7 +153,10 @@ func main() {
 			auth.POST("/login", authHandler.Login)
 			auth.POST("/logout", authMiddleware.RequireAuth(), authHandler.Logout)
 			auth.GET("/profile", authMiddleware.RequireAuth(), authHandler.GetProfile)
+			auth.PATCH("/profile", authMiddleware.RequireAuth(), authHandler.ChangeProfile)
 			auth.POST("/change-password", authMiddleware.RequireAuth(), authHandler.ChangePassword)
+			auth.GET("/audit", authMiddleware.RequireAuth(), authHandler.GetAuditLog)
+			auth.GET("/export-data", authMiddleware.RequireAuth(), authHandler.ExportData)
 		}
 
 		chats := api.Group("/chats")
@@ -106,24 +164,79 @@ func main() {
 		{
 			chats.POST("", chatHandler.CreateChat)
 			chats.POST("/private", chatHandler.CreateOrGetPrivateChat)
+			chats.POST("/private/by-username", chatHandler.CreateOrGetPrivateChatByUsername)
 			chats.GET("", chatHandler.GetUserChats)
+			chats.GET("/:id", chatHandler.GetChat)
+			chats.GET("/:id/stats", chatHandler.GetChatStats)
+			chats.GET("/:id/keys/:version", chatHandler.GetChatKey)
+			chats.POST("/:id/archive", chatHandler.ArchiveChat)
+			chats.DELETE("/:id/archive", chatHandler.UnarchiveChat)
 			chats.GET("/:id/messages", chatHandler.GetChatMessages)
+			chats.GET("/:id/export", chatHandler.ExportChat)
 			chats.POST("/:id/messages", chatHandler.SendMessage)
+			chats.POST("/:id/messages/encrypted", chatHandler.SendEncryptedMessage)
+			chats.GET("/:id/messages/:messageId", chatHandler.GetMessage)
+			chats.PUT("/:id/messages/:messageId", chatHandler.EditMessage)
+			chats.DELETE("/:id/messages/:messageId", chatHandler.DeleteMessage)
+			chats.POST("/:id/messages/:messageId/restore", chatHandler.RestoreMessage)
+			chats.POST("/:id/messages/:messageId/read", chatHandler.MarkMessageRead)
+			chats.GET("/:id/messages/:messageId/read-by", chatHandler.GetMessageReaders)
+			chats.GET("/:id/messages/:messageId/verify", chatHandler.VerifyMessage)
+			chats.GET("/:id/messages/:messageId/reactions", reactionHandler.GetReactions)
+			chats.POST("/:id/messages/:messageId/reactions", reactionHandler.AddReaction)
+			chats.DELETE("/:id/messages/:messageId/reactions/:reactionId", reactionHandler.RemoveReaction)
+			chats.POST("/:id/messages/:messageId/report", reportHandler.ReportMessage)
+			chats.POST("/:id/attachments", attachmentHandler.UploadAttachment)
+			chats.GET("/:id/attachments/:attachmentId", attachmentHandler.GetAttachment)
+			chats.GET("/:id/attachments/:attachmentId/thumbnail", attachmentHandler.GetThumbnail)
 			chats.GET("/:id/members", chatHandler.GetChatMembers)
 			chats.POST("/:id/members", chatHandler.AddMember)
+			chats.POST("/:id/members/bulk", chatHandler.AddMembers)
 			chats.DELETE("/:id/members/:userId", chatHandler.RemoveMember)
 			chats.PUT("/:id/members/:userId/admin", chatHandler.SetAdmin)
 			chats.DELETE("/:id/members/:userId/admin", chatHandler.RemoveAdmin)
+			chats.PUT("/:id/roles", chatHandler.UpdateMemberRoles)
+			chats.PUT("/:id/slow-mode", chatHandler.SetSlowMode)
 			chats.POST("/:id/leave", chatHandler.LeaveChat)
+			chats.POST("/:id/guest-link", guestHandler.CreateGuestLink)
 			chats.DELETE("/:id", chatHandler.DeleteChat)
 			chats.DELETE("/:id/delete", chatHandler.DeleteGroupChat)
 		}
+		messages := api.Group("/messages")
+		messages.Use(authMiddleware.RequireAuth())
+		{
+			messages.POST("/forward-bulk", chatHandler.ForwardMessageBulk)
+		}
+		search := api.Group("/search")
+		search.Use(authMiddleware.RequireAuth())
+		{
+			search.GET("/messages", chatHandler.SearchMessages)
+		}
 		users := api.Group("/users")
 		users.Use(authMiddleware.RequireAuth())
 		{
+			users.GET("", userHandler.GetUsers)
 			users.GET("/search", userHandler.SearchUsers)
 			users.GET("/online", userHandler.GetOnlineUsers)
+			users.GET("/me/contacts", userHandler.GetContacts)
 			users.GET("/:id", userHandler.GetUser)
+			users.POST("/:id/block", userHandler.BlockUser)
+			users.DELETE("/:id/block", userHandler.UnblockUser)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(authMiddleware.RequireAuth(), authMiddleware.RequireAdmin())
+		{
+			admin.GET("/reports", reportHandler.ListReports)
+			admin.PATCH("/reports/:id", reportHandler.UpdateReportStatus)
+			admin.GET("/ws/stats", wsHandler.GetStats)
+		}
+
+		guest := api.Group("/guest")
+		guest.Use(authMiddleware.GuestAuth())
+		{
+			guest.GET("/messages", guestHandler.GetMessages)
+			guest.GET("/ws", guestHandler.HandleWebSocket)
 		}
 
 		// Регистрируем маршруты для обмена ключами
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AttachmentHandler struct {
+	attachmentUseCase *usecase.AttachmentUseCase
+	logger            *logger.Logger
+}
+
+// NewAttachmentHandler - создает новый экземпляр обработчика вложений
+func NewAttachmentHandler(attachmentUseCase *usecase.AttachmentUseCase, logger *logger.Logger) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentUseCase: attachmentUseCase,
+		logger:            logger,
+	}
+}
+
+// UploadAttachment - загружает зашифрованное на клиенте вложение в чат
+// UploadAttachment godoc
+// @Summary      Upload attachment
+// @Description  Stores a client-encrypted attachment with an optional client-encrypted thumbnail for images
+// @Tags         attachments
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int                               true  "Chat ID"
+// @Param        data  body  usecase.UploadAttachmentRequest  true  "Attachment data"
+// @Success      201   {object}  gin.H
+// @Failure      400   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      413   {object}  gin.H
+// @Router       /chats/:id/attachments [post]
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req usecase.UploadAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	attachment, err := h.attachmentUseCase.UploadAttachment(c.Request.Context(), uint(chatID), user.(*entities.User).ID, &req)
+	if err != nil {
+		h.logger.Errorf("Failed to upload attachment: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondCreated(c, attachment)
+}
+
+// GetAttachment - возвращает зашифрованное содержимое вложения
+// GetAttachment godoc
+// @Summary      Get attachment
+// @Description  Returns the client-encrypted attachment data (base64)
+// @Tags         attachments
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id            path  int  true  "Chat ID"
+// @Param        attachmentId  path  int  true  "Attachment ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/attachments/:attachmentId [get]
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	chatID, attachmentID, userID, ok := h.parseAttachmentParams(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.attachmentUseCase.GetAttachment(c.Request.Context(), chatID, attachmentID, userID)
+	if err != nil {
+		h.logger.Errorf("Failed to get attachment: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondOK(c, gin.H{
+		"attachment": attachment,
+		"content":    attachment.Data,
+	})
+}
+
+// GetThumbnail - возвращает зашифрованную миниатюру изображения
+// GetThumbnail godoc
+// @Summary      Get attachment thumbnail
+// @Description  Returns the client-encrypted thumbnail (base64) without the full attachment
+// @Tags         attachments
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id            path  int  true  "Chat ID"
+// @Param        attachmentId  path  int  true  "Attachment ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/attachments/:attachmentId/thumbnail [get]
+func (h *AttachmentHandler) GetThumbnail(c *gin.Context) {
+	chatID, attachmentID, userID, ok := h.parseAttachmentParams(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.attachmentUseCase.GetThumbnail(c.Request.Context(), chatID, attachmentID, userID)
+	if err != nil {
+		h.logger.Errorf("Failed to get attachment thumbnail: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondOK(c, gin.H{
+		"attachment_id": attachment.ID,
+		"mime_type":     attachment.MimeType,
+		"thumbnail":     attachment.Thumbnail,
+	})
+}
+
+// parseAttachmentParams - извлекает пользователя, ID чата и ID вложения из запроса
+func (h *AttachmentHandler) parseAttachmentParams(c *gin.Context) (uint, uint, uint, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return 0, 0, 0, false
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return 0, 0, 0, false
+	}
+
+	attachmentID, err := strconv.ParseUint(c.Param("attachmentId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid attachment ID")
+		return 0, 0, 0, false
+	}
+
+	return uint(chatID), uint(attachmentID), user.(*entities.User).ID, true
+}
+
+// respondUseCaseError - преобразует ошибки сервиса вложений в HTTP-ответы
+func (h *AttachmentHandler) respondUseCaseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrNotChatMember):
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	case errors.Is(err, usecase.ErrAttachmentNotFound), errors.Is(err, usecase.ErrThumbnailNotFound):
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrAttachmentTooLarge), errors.Is(err, usecase.ErrThumbnailTooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, response.CodePayloadTooLarge, err.Error())
+	case errors.Is(err, usecase.ErrThumbnailNotAllowed), errors.Is(err, usecase.ErrEmptyAttachment):
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+	}
+}
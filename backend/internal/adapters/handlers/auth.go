@@ -4,7 +4,12 @@ import (
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -12,13 +17,15 @@ import (
 
 type AuthHandler struct {
 	authUseCase *usecase.AuthUseCase
+	chatUseCase *usecase.ChatUseCase
 	logger      *logger.Logger
 }
 
 // NewAuthHandler - создает новый экземпляр обработчика аутентификации
-func NewAuthHandler(authUseCase *usecase.AuthUseCase, logger *logger.Logger) *AuthHandler {
+func NewAuthHandler(authUseCase *usecase.AuthUseCase, chatUseCase *usecase.ChatUseCase, logger *logger.Logger) *AuthHandler {
 	return &AuthHandler{
 		authUseCase: authUseCase,
+		chatUseCase: chatUseCase,
 		logger:      logger,
 	}
 }
@@ -42,38 +49,38 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			for _, fieldError := range validationErrors {
 				switch fieldError.Tag() {
 				case "required":
-					c.JSON(http.StatusBadRequest, gin.H{"error": "MISSING_REQUIRED_FIELD"})
+					respondError(c, http.StatusBadRequest, "MISSING_REQUIRED_FIELD", "Missing required field")
 					return
 				case "min":
 					if fieldError.Field() == "Username" {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "USERNAME_TOO_SHORT"})
+						respondError(c, http.StatusBadRequest, "USERNAME_TOO_SHORT", "Username too short")
 						return
 					}
 					if fieldError.Field() == "Password" {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "PASSWORD_TOO_SHORT"})
+						respondError(c, http.StatusBadRequest, "PASSWORD_TOO_SHORT", "Password too short")
 						return
 					}
 				case "max":
 					if fieldError.Field() == "Username" {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "USERNAME_TOO_LONG"})
+						respondError(c, http.StatusBadRequest, "USERNAME_TOO_LONG", "Username too long")
 						return
 					}
 				case "email":
-					c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_EMAIL"})
+					respondError(c, http.StatusBadRequest, "INVALID_EMAIL", "Invalid email")
 					return
 				case "alphanum":
 					if fieldError.Field() == "Username" {
-						c.JSON(http.StatusBadRequest, gin.H{"error": "USERNAME_INVALID_CHARS"})
+						respondError(c, http.StatusBadRequest, "USERNAME_INVALID_CHARS", "Username may contain only letters and digits")
 						return
 					}
 				}
 			}
 		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_REQUEST_DATA"})
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST_DATA", "Invalid request data")
 		return
 	}
 
-	response, err := h.authUseCase.Register(&req)
+	result, err := h.authUseCase.Register(c.Request.Context(), &req)
 	if err != nil {
 		h.logger.Errorf("Registration failed: %v", err)
 
@@ -85,14 +92,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 			statusCode = http.StatusConflict
 		}
 
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		respondError(c, statusCode, response.CodeForStatus(statusCode), err.Error())
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "User registered successfully",
-		"data":    response,
-	})
+	respondCreated(c, result)
 }
 
 // Login - обрабатывает запрос на авторизацию пользователя
@@ -110,22 +114,19 @@ func (h *AuthHandler) Register(c *gin.Context) {
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req usecase.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_REQUEST_DATA"})
+		respondError(c, http.StatusBadRequest, "INVALID_REQUEST_DATA", "Invalid request data")
 		return
 	}
 
-	response, err := h.authUseCase.Login(&req)
+	result, err := h.authUseCase.Login(c.Request.Context(), &req)
 	if err != nil {
 		h.logger.Errorf("Login failed: %v", err)
 
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"data":    response,
-	})
+	respondOK(c, result)
 }
 
 // Logout - обрабатывает запрос на выход пользователя из системы
@@ -139,18 +140,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) Logout(c *gin.Context) {
 	token, exists := c.Get("token")
 	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No token found"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "No token found")
 		return
 	}
 
-	err := h.authUseCase.Logout(token.(string))
+	err := h.authUseCase.Logout(c.Request.Context(), token.(string))
 	if err != nil {
 		h.logger.Errorf("Logout failed: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to logout")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
+	respondMessage(c, "Logout successful")
 }
 
 // GetProfile - возвращает профиль текущего аутентифицированного пользователя
@@ -165,19 +166,65 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": user.(*entities.User),
-	})
+	respondOK(c, user.(*entities.User))
+}
+
+// ChangeProfile - обрабатывает запрос на изменение имени пользователя и email
+// ChangeProfile godoc
+// @Summary      Change user profile
+// @Description  Updates the authenticated user's username and/or email; both must be unique (case-insensitive)
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        profile  body  usecase.ChangeProfileRequest  true  "New username and/or email"
+// @Success      200      {object}  gin.H
+// @Failure      400      {object}  gin.H
+// @Failure      409      {object}  gin.H
+// @Router       /auth/profile [patch]
+func (h *AuthHandler) ChangeProfile(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	var req usecase.ChangeProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.logger.Errorf("Change profile validation failed: %v", err)
+		respondError(c, http.StatusBadRequest, "INVALID_PROFILE_DATA", "Invalid profile data")
+		return
+	}
+
+	updatedUser, err := h.authUseCase.ChangeProfile(c.Request.Context(), user.(*entities.User).ID, &req)
+	if err != nil {
+		h.logger.Errorf("Change profile failed: %v", err)
+
+		statusCode := http.StatusInternalServerError
+		switch err.Error() {
+		case "USERNAME_ALREADY_EXISTS", "EMAIL_ALREADY_EXISTS":
+			statusCode = http.StatusConflict
+		case "NO_PROFILE_CHANGES", "INVALID_EMAIL":
+			statusCode = http.StatusBadRequest
+		case "USER_NOT_FOUND":
+			statusCode = http.StatusNotFound
+		}
+
+		respondError(c, statusCode, response.CodeForStatus(statusCode), err.Error())
+		return
+	}
+
+	respondOK(c, updatedUser)
 }
 
 // ChangePassword - обрабатывает запрос на изменение пароля пользователя
 // ChangePassword godoc
 // @Summary      Change user password
-// @Description  Allows the authenticated user to change their password
+// @Description  Allows the authenticated user to change their password; other sessions are revoked unless revokeOtherSessions is false
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -191,32 +238,172 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	var req usecase.ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Errorf("Change password validation failed: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid request data")
 		return
 	}
 
 	userEntity := user.(*entities.User)
-	err := h.authUseCase.ChangePassword(userEntity.ID, &req)
+	token, _ := c.Get("token")
+	currentToken, _ := token.(string)
+	err := h.authUseCase.ChangePassword(c.Request.Context(), userEntity.ID, currentToken, &req)
 	if err != nil {
 		h.logger.Errorf("Change password failed: %v", err)
 
 		switch err.Error() {
 		case "invalid current password":
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid current password"})
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid current password")
 		case "new password must be different from current password":
-			c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from current password"})
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, "New password must be different from current password")
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to change password")
+		}
+		return
+	}
+
+	respondMessage(c, "Password changed successfully")
+}
+
+// GetAuditLog - возвращает журнал событий безопасности текущего пользователя
+// GetAuditLog godoc
+// @Summary      Get security audit log
+// @Description  Returns the authenticated user's security events (logins, logouts, password changes, key rotations, session revocations, chat deletions), newest first
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Param        limit   query  int  false  "Page size (default 50, max 100)"
+// @Param        offset  query  int  false  "Offset"
+// @Success      200     {object}  gin.H
+// @Failure      401     {object}  gin.H
+// @Failure      500     {object}  gin.H
+// @Router       /auth/audit [get]
+func (h *AuthHandler) GetAuditLog(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	events, err := h.authUseCase.GetAuditLog(c.Request.Context(), user.(*entities.User).ID, limit, offset)
+	if err != nil {
+		h.logger.Errorf("Failed to get audit log: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get audit log")
+		return
+	}
+
+	respondOK(c, events)
+}
+
+// dataExportHeader - разделы выгрузки данных пользователя, которые формируются целиком до отправки
+type dataExportHeader struct {
+	ExportedAt time.Time                 `json:"exported_at"`
+	Profile    *entities.User            `json:"profile"`
+	Chats      []usecase.ExportedChat    `json:"chats"`
+	Sessions   []usecase.ExportedSession `json:"sessions"`
+}
+
+// ExportData - выгружает данные текущего пользователя одним JSON-файлом: профиль, метаданные чатов,
+// сессии и отправленные им сообщения в расшифрованном виде
+// ExportData godoc
+// @Summary      Download my data
+// @Description  Streams a JSON bundle with the user's profile, chats metadata, sessions and their own sent messages (decrypted); other users' messages are not included
+// @Tags         auth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  gin.H
+// @Failure      401  {object}  gin.H
+// @Failure      500  {object}  gin.H
+// @Router       /auth/export-data [get]
+func (h *AuthHandler) ExportData(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+	currentUser := user.(*entities.User)
+	ctx := c.Request.Context()
+
+	chats, err := h.chatUseCase.ExportUserChats(ctx, currentUser.ID)
+	if err != nil {
+		h.logger.Errorf("Failed to export user chats: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to export data")
+		return
+	}
+
+	sessions, err := h.authUseCase.ExportSessions(ctx, currentUser.ID)
+	if err != nil {
+		h.logger.Errorf("Failed to export user sessions: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to export data")
+		return
+	}
+
+	head, err := json.Marshal(dataExportHeader{
+		ExportedAt: time.Now().UTC(),
+		Profile:    currentUser,
+		Chats:      chats,
+		Sessions:   sessions,
+	})
+	if err != nil {
+		h.logger.Errorf("Failed to marshal data export: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to export data")
+		return
+	}
+
+	// Выгрузка всех сообщений может занять больше WriteTimeout сервера
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Debugf("Failed to clear write deadline for data export: %v", err)
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-data.json"`, currentUser.ID))
+	c.Status(http.StatusOK)
+
+	// Сообщения дописываются в тот же объект по одному, поэтому закрывающая скобка заголовка отбрасывается
+	c.Writer.Write(head[:len(head)-1])
+	c.Writer.WriteString(`,"messages":[`)
+
+	written := 0
+	emit := func(message usecase.ExportedUserMessage) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
 		}
+		if written > 0 {
+			c.Writer.WriteString(",")
+		}
+		if _, err := c.Writer.Write(data); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	}
+
+	if err := h.chatUseCase.ExportUserMessages(ctx, currentUser.ID, emit); err != nil {
+		// Заголовки уже отправлены, статус изменить нельзя - обрываем поток, оставляя JSON незавершенным
+		h.logger.Errorf("Data export interrupted after %d messages: %v", written, err)
+		c.Abort()
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+	c.Writer.WriteString("]}")
+	c.Writer.Flush()
 }
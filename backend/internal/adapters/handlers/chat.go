@@ -6,10 +6,17 @@ import (
 	"sleek-chat-backend/internal/domain/usecase"
 	"sleek-chat-backend/internal/infrastructure/websocket"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,7 +39,7 @@ func NewChatHandler(chatUseCase *usecase.ChatUseCase, wsHub *websocket.Hub, logg
 // CreateChat - создает новый чат
 // CreateChat godoc
 // @Summary      Create new group chat
-// @Description  Creates a new chat with the given name and members
+// @Description  Creates a new chat with the given name and members; the response lists all members with their roles (creator, member)
 // @Tags         chat
 // @Accept       json
 // @Produce      json
@@ -44,212 +51,1138 @@ func NewChatHandler(chatUseCase *usecase.ChatUseCase, wsHub *websocket.Hub, logg
 func (h *ChatHandler) CreateChat(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	var req usecase.CreateChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
 		return
 	}
-	chat, err := h.chatUseCase.CreateChat(user.(*entities.User).ID, &req)
+	chat, err := h.chatUseCase.CreateChat(c.Request.Context(), user.(*entities.User).ID, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, usecase.ErrPrivateChatExists) {
+			respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+			return
+		}
+		if errors.Is(err, usecase.ErrMemberNotFound) {
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		return
+	}
+
+	respondCreated(c, chat)
+}
+
+// GetUserChats - получает список чатов пользователя
+// GetUserChats godoc
+// @Summary      Get user chats
+// @Description  Returns chats the authenticated user is a member of; archived chats are included only with include_archived=true
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        include_archived  query  bool  false  "Include archived chats"
+// @Success      200  {array}   models.Chat
+// @Router       /chats [get]
+func (h *ChatHandler) GetUserChats(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	includeArchived, _ := strconv.ParseBool(c.DefaultQuery("include_archived", "false"))
+
+	chats, err := h.chatUseCase.GetUserChats(c.Request.Context(), user.(*entities.User).ID, includeArchived)
+	if err != nil {
+		h.logger.Errorf("Failed to get user chats: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get chats")
+		return
+	}
+
+	respondOK(c, chats)
+}
+
+// ArchiveChat - архивирует чат для текущего пользователя
+// ArchiveChat godoc
+// @Summary      Archive chat
+// @Description  Hides the chat from the user's chat list without leaving it; a new message unarchives it
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Chat ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Router       /chats/:id/archive [post]
+func (h *ChatHandler) ArchiveChat(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// UnarchiveChat - возвращает чат из архива текущего пользователя
+// UnarchiveChat godoc
+// @Summary      Unarchive chat
+// @Description  Returns the chat to the user's chat list
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Chat ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Router       /chats/:id/archive [delete]
+func (h *ChatHandler) UnarchiveChat(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// setArchived - общий обработчик архивации и разархивации чата
+func (h *ChatHandler) setArchived(c *gin.Context, archived bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	if err := h.chatUseCase.SetArchived(c.Request.Context(), uint(chatID), user.(*entities.User).ID, archived); err != nil {
+		h.logger.Errorf("Failed to update chat archive state: %v", err)
+		if errors.Is(err, usecase.ErrNotChatMember) {
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		return
+	}
+
+	respondOK(c, gin.H{"archived": archived})
+}
+
+// GetChat - получает данные одного чата
+// GetChat godoc
+// @Summary      Get chat
+// @Description  Returns chat details with the requesting user's role and member count
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Chat ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id [get]
+func (h *ChatHandler) GetChat(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	chat, err := h.chatUseCase.GetChat(c.Request.Context(), uint(chatID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to get chat: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrChatNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+
+	respondOK(c, chat)
+}
+
+// GetChatStats - возвращает статистику чата
+// GetChatStats godoc
+// @Summary      Get chat statistics
+// @Description  Returns message count, member count, most active member and messages per day over the last week
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Chat ID"
+// @Success      200   {object}  usecase.ChatStats
+// @Failure      403   {object}  gin.H
+// @Router       /chats/:id/stats [get]
+func (h *ChatHandler) GetChatStats(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	stats, err := h.chatUseCase.GetChatStats(c.Request.Context(), uint(chatID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to get chat stats: %v", err)
+		if errors.Is(err, usecase.ErrNotChatMember) {
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get chat stats")
+		return
+	}
+
+	respondOK(c, stats)
+}
+
+// GetChatKey - возвращает ключ чата, обернутый публичным ключом RSA текущего пользователя
+// GetChatKey godoc
+// @Summary      Get wrapped chat key
+// @Description  Returns the chat key of the given version encrypted with the caller's RSA public key (RSA-OAEP, SHA-256, label "sleek-chat-key-wrap"). Version 0 returns the current key. Clients that hold their own keys use it to decrypt server-encrypted messages after a key_rotated event
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id       path  int  true  "Chat ID"
+// @Param        version  path  int  true  "Key version, 0 for the current key"
+// @Success      200   {object}  usecase.WrappedChatKey
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/keys/:version [get]
+func (h *ChatHandler) GetChatKey(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 0 {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid key version")
+		return
+	}
+
+	key, err := h.chatUseCase.GetWrappedChatKey(c.Request.Context(), uint(chatID), user.(*entities.User).ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrChatNotFound), errors.Is(err, usecase.ErrChatKeyNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			h.logger.Errorf("Failed to get chat key: %v", err)
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get chat key")
+		}
+		return
+	}
+
+	respondOK(c, key)
+}
+
+// GetChatMessages - получает сообщения чата с постраничной навигацией
+// GetChatMessages godoc
+// @Summary      Get chat messages
+// @Description  Returns messages from a specific chat; history_limit_reached is true when the page is cut by MESSAGE_HISTORY_LIMIT. meta.key_version is the chat's current key version, so a client that missed a key_rotated event learns the new key on its next fetch
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        chat_id  path   string  true   "Chat ID"
+// @Param        type     query  string  false  "Comma-separated message types to include (e.g. text,system)"
+// @Success      200      {array}  models.Message
+// @Router       /chats/{chat_id}/messages [get]
+func (h *ChatHandler) GetChatMessages(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	limitStr := c.DefaultQuery("limit", "50")
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+
+	offsetStr := c.DefaultQuery("offset", "0")
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+	var messageTypes []string
+	for _, messageType := range strings.Split(c.Query("type"), ",") {
+		if messageType = strings.TrimSpace(messageType); messageType != "" {
+			messageTypes = append(messageTypes, messageType)
+		}
+	}
+
+	page, err := h.chatUseCase.GetChatMessages(c.Request.Context(), uint(chatID), user.(*entities.User).ID, limit, offset, messageTypes)
+	if err != nil {
+		h.logger.Errorf("Failed to get chat messages: %v", err)
+		if errors.Is(err, usecase.ErrNotChatMember) {
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		return
+	}
+
+	responseMessages := make([]map[string]interface{}, len(page.Messages))
+	for i, msg := range page.Messages {
+		responseMessages[i] = messageResponseMap(msg)
+	}
+
+	respondPage(c, responseMessages, pageMeta{
+		Total:               page.Total,
+		Limit:               limit,
+		Offset:              offset,
+		HasMore:             page.HasMore,
+		HistoryLimitReached: page.HistoryLimitReached,
+		KeyVersion:          page.KeyVersion,
+	})
+}
+
+// maxSearchLimit - наибольший размер страницы результатов поиска сообщений
+const maxSearchLimit = 100
+
+// SearchMessages - ищет сообщения по всем чатам пользователя
+// SearchMessages godoc
+// @Summary      Search messages across chats
+// @Description  Searches decrypted messages in every chat the user belongs to and returns snippets grouped by chat; only recent messages of each chat are scanned
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        q       query  string  true   "Search query (2-100 characters)"
+// @Param        limit   query  int     false  "Page size (default 20, max 100)"
+// @Param        offset  query  int     false  "Page offset"
+// @Success      200     {object}  gin.H
+// @Failure      400     {object}  gin.H
+// @Failure      409     {object}  gin.H
+// @Router       /search/messages [get]
+func (h *ChatHandler) SearchMessages(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	query := c.Query("q")
+	if strings.TrimSpace(query) == "" {
+		respondError(c, http.StatusBadRequest, "MISSING_QUERY_PARAMETER", "Missing query parameter")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, maxSearchLimit)
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	page, err := h.chatUseCase.SearchMessages(c.Request.Context(), user.(*entities.User).ID, query, limit, offset)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidSearchQuery):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrServerKeysDisabled):
+			respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+		default:
+			h.logger.Errorf("Failed to search messages: %v", err)
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to search messages")
+		}
+		return
+	}
+
+	respondPage(c, page.Results, pageMeta{
+		Total:   int64(page.Total),
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: page.HasMore,
+	})
+}
+
+// exportFlushEvery - через сколько строк экспорта данные сбрасываются клиенту
+const exportFlushEvery = 50
+
+// ExportChat - выгружает всю историю чата, расшифрованную для участника, в формате NDJSON
+// ExportChat godoc
+// @Summary      Export chat history
+// @Description  Streams all chat messages in chronological order as NDJSON, one message per line
+// @Tags         chat
+// @Produce      application/x-ndjson
+// @Security     BearerAuth
+// @Param        id   path  int  true  "Chat ID"
+// @Success      200  {string}  string
+// @Failure      403  {object}  gin.H
+// @Router       /chats/:id/export [get]
+func (h *ChatHandler) ExportChat(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	// Экспорт большого чата может занять больше WriteTimeout сервера
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.Debugf("Failed to clear write deadline for export: %v", err)
+	}
+
+	// Заголовки отправляются с первой строкой, чтобы ошибка доступа еще могла вернуться как JSON
+	startStream := func() {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="chat-%d-export.ndjson"`, chatID))
+		c.Status(http.StatusOK)
+	}
+
+	encoder := json.NewEncoder(c.Writer)
+	lines := 0
+	emit := func(message usecase.ExportedMessage) error {
+		if lines == 0 {
+			startStream()
+		}
+		if err := encoder.Encode(message); err != nil {
+			return err
+		}
+		lines++
+		if lines%exportFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	}
+
+	err = h.chatUseCase.ExportChat(c.Request.Context(), uint(chatID), user.(*entities.User).ID, emit)
+	if err != nil {
+		if lines > 0 {
+			// Часть истории уже отправлена, статус изменить нельзя - обрываем поток
+			h.logger.Errorf("Chat export interrupted after %d messages: %v", lines, err)
+			c.Abort()
+			return
+		}
+		if errors.Is(err, usecase.ErrNotChatMember) {
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+			return
+		}
+		h.logger.Errorf("Failed to export chat: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to export chat")
+		return
+	}
+
+	if lines == 0 {
+		startStream()
+	}
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+}
+
+// GetMessage - получает одно расшифрованное сообщение чата
+// GetMessage godoc
+// @Summary      Get chat message
+// @Description  Returns a single decrypted message from a specific chat
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId [get]
+func (h *ChatHandler) GetMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	messageIDStr := c.Param("messageId")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	message, err := h.chatUseCase.GetMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to get message: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrMessageNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+
+	respondOK(c, messageResponseMap(*message))
+}
+
+// VerifyMessage - повторно проверяет подписи и целостность сообщения
+// VerifyMessage godoc
+// @Summary      Verify message signatures
+// @Description  Re-runs ECDSA, RSA and HMAC checks of a stored message against the sender's public keys
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {object}  usecase.MessageVerification
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/verify [get]
+func (h *ChatHandler) VerifyMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	result, err := h.chatUseCase.VerifyMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to verify message: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrMessageNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+
+	respondOK(c, result)
+}
+
+// messageResponseMap - формирует представление расшифрованного сообщения для ответа API
+func messageResponseMap(msg usecase.MessageResponse) map[string]interface{} {
+	content := msg.DecryptedContent
+	if msg.Encrypted {
+		content = msg.Message.Content
+	}
+
+	return map[string]interface{}{
+		"id":                msg.Message.ID,
+		"chat_id":           msg.Message.ChatID,
+		"seq":               msg.Message.Seq,
+		"sender_id":         msg.Message.SenderID,
+		"content":           content,
+		"decrypted_content": msg.DecryptedContent,
+		"encrypted":         msg.Encrypted,
+		"message_type":      msg.Message.MessageType,
+		"created_at":        msg.Message.CreatedAt,
+		"updated_at":        msg.Message.UpdatedAt,
+		"sender":            msg.Message.Sender,
+		"nonce":             msg.Message.Nonce,
+		"iv":                msg.Message.IV,
+		"hmac":              msg.Message.HMAC,
+		"ecdsa_signature":   msg.Message.ECDSASignature,
+		"rsa_signature":     msg.Message.RSASignature,
+		"algorithm":         crypto.MessageAlgorithmOrDefault(msg.Message.Algorithm),
+		"client_encrypted":  msg.Message.ClientEncrypted,
+	}
+}
+
+// SendMessage - отправляет сообщение в чат с криптографической защитой
+// SendMessage godoc
+// @Summary      Send message
+// @Description  Sends a message to a specific chat
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        message  body  models.Message  true  "Message content"
+// @Success      201      {object}  models.Message
+// @Failure      400      {object}  gin.H
+// @Router       /chats/{chat_id}/messages [get]
+func (h *ChatHandler) SendMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req usecase.SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+	ecdsaPrivateKey, rsaPrivateKey := h.senderPrivateKeys(user.(*entities.User))
+
+	message, err := h.chatUseCase.SendMessage(c.Request.Context(), uint(chatID), user.(*entities.User).ID, &req, ecdsaPrivateKey, rsaPrivateKey)
+	if err != nil {
+		h.logger.Errorf("Failed to send message: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrSlowMode):
+			respondSlowMode(c, err)
+		case errors.Is(err, usecase.ErrRateLimited):
+			respondError(c, http.StatusTooManyRequests, response.CodeTooManyRequests, err.Error())
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrServerKeysDisabled), errors.Is(err, usecase.ErrRatchetChat):
+			respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+		case errors.Is(err, usecase.ErrInvalidContent), errors.Is(err, usecase.ErrContentRejected), errors.Is(err, usecase.ErrInvalidMessageType):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrNoRecipients):
+			respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+		case errors.Is(err, usecase.ErrAttachmentNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+	wsMessage := websocket.WSMessage{
+		Type:   websocket.MessageTypeChat,
+		ChatID: uint(chatID),
+		From:   user.(*entities.User).ID,
+		Data: websocket.ChatMessage{
+			ID:             message.ID,
+			ChatID:         message.ChatID,
+			Seq:            message.Seq,
+			SenderID:       message.SenderID,
+			Content:        req.Content,
+			MessageType:    message.MessageType,
+			Status:         message.Status,
+			Nonce:          message.Nonce,
+			IV:             message.IV,
+			HMAC:           message.HMAC,
+			ECDSASignature: message.ECDSASignature,
+			RSASignature:   message.RSASignature,
+			Timestamp:      message.CreatedAt.Unix(),
+			AttachmentID:   message.AttachmentID,
+		},
+	}
+	h.wsHub.SendToChat(uint(chatID), wsMessage, user.(*entities.User).ID)
+
+	responseMessage := map[string]interface{}{
+		"id":                message.ID,
+		"chat_id":           message.ChatID,
+		"seq":               message.Seq,
+		"sender_id":         message.SenderID,
+		"content":           req.Content,
+		"decrypted_content": req.Content,
+		"message_type":      message.MessageType,
+		"status":            message.Status,
+		"attachment_id":     message.AttachmentID,
+		"created_at":        message.CreatedAt,
+		"updated_at":        message.UpdatedAt,
+		"sender":            message.Sender,
+	}
+
+	respondCreated(c, responseMessage)
+}
+
+// senderPrivateKeys - восстанавливает хранящиеся на сервере ключи подписи пользователя;
+// ключ, который не удалось разобрать, возвращается как nil
+func (h *ChatHandler) senderPrivateKeys(user *entities.User) (*ecdsa.PrivateKey, *rsa.PrivateKey) {
+	var ecdsaPrivateKey *ecdsa.PrivateKey
+	var rsaPrivateKey *rsa.PrivateKey
+
+	if user.ECDSAPrivateKey != "" {
+		var err error
+		ecdsaPrivateKey, err = crypto.DeserializeECDSAPrivateKey([]byte(user.ECDSAPrivateKey))
+		if err != nil {
+			h.logger.Errorf("Failed to deserialize ECDSA private key: %v", err)
+		}
+	}
+
+	if user.RSAPrivateKey != "" {
+		var err error
+		rsaPrivateKey, err = crypto.DeserializeRSAPrivateKey([]byte(user.RSAPrivateKey))
+		if err != nil {
+			h.logger.Errorf("Failed to deserialize RSA private key: %v", err)
+		}
+	}
+
+	return ecdsaPrivateKey, rsaPrivateKey
+}
+
+// ForwardMessageBulk - пересылает сообщение в несколько чатов
+// ForwardMessageBulk godoc
+// @Summary      Forward a message to multiple chats
+// @Description  Forwards one message to every listed chat; membership is checked per chat and each target gets its own success/error result
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        request  body  usecase.ForwardBulkRequest  true  "Source message and target chats"
+// @Success      200      {object}  gin.H
+// @Failure      400      {object}  gin.H
+// @Failure      404      {object}  gin.H
+// @Router       /messages/forward-bulk [post]
+func (h *ChatHandler) ForwardMessageBulk(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	var req usecase.ForwardBulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	currentUser := user.(*entities.User)
+	ecdsaPrivateKey, rsaPrivateKey := h.senderPrivateKeys(currentUser)
+
+	results, content, err := h.chatUseCase.ForwardMessageBulk(c.Request.Context(), currentUser.ID, &req, ecdsaPrivateKey, rsaPrivateKey)
+	if err != nil {
+		h.logger.Errorf("Failed to forward message: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrMessageNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		case errors.Is(err, usecase.ErrNotForwardable):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+
+	for _, result := range results {
+		if !result.Success {
+			continue
+		}
+		message := result.Message
+		h.wsHub.SendToChat(message.ChatID, websocket.WSMessage{
+			Type:   websocket.MessageTypeChat,
+			ChatID: message.ChatID,
+			From:   currentUser.ID,
+			Data: websocket.ChatMessage{
+				ID:              message.ID,
+				ChatID:          message.ChatID,
+				Seq:             message.Seq,
+				SenderID:        message.SenderID,
+				Content:         content,
+				MessageType:     message.MessageType,
+				Status:          message.Status,
+				Nonce:           message.Nonce,
+				IV:              message.IV,
+				HMAC:            message.HMAC,
+				ECDSASignature:  message.ECDSASignature,
+				RSASignature:    message.RSASignature,
+				Timestamp:       message.CreatedAt.Unix(),
+				ForwardedFromID: message.ForwardedFromID,
+			},
+		}, currentUser.ID)
+	}
+
+	respondOK(c, results)
+}
+
+// EditMessage - изменяет текст сообщения
+// EditMessage godoc
+// @Summary      Edit message
+// @Description  Replaces the text of the user's own message and notifies chat members with a message_edited event
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int                         true  "Chat ID"
+// @Param        messageId  path  int                         true  "Message ID"
+// @Param        data       body  usecase.EditMessageRequest  true  "New content"
+// @Success      200   {object}  gin.H
+// @Failure      400   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId [put]
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	messageIDStr := c.Param("messageId")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req usecase.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	message, err := h.chatUseCase.EditMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID, &req)
+	if err != nil {
+		h.logger.Errorf("Failed to edit message: %v", err)
+		h.respondMessageError(c, err)
+		return
+	}
+
+	respondOK(c, map[string]interface{}{
+		"id":                message.ID,
+		"chat_id":           message.ChatID,
+		"seq":               message.Seq,
+		"sender_id":         message.SenderID,
+		"content":           req.Content,
+		"decrypted_content": req.Content,
+		"message_type":      message.MessageType,
+		"status":            message.Status,
+		"is_edited":         message.IsEdited,
+		"edited_at":         message.EditedAt,
+		"created_at":        message.CreatedAt,
+		"updated_at":        message.UpdatedAt,
+	})
+}
+
+// DeleteMessage - удаляет сообщение из чата
+// DeleteMessage godoc
+// @Summary      Delete message
+// @Description  Deletes a message (author, or group admin) and notifies chat members with a message_deleted event
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId [delete]
+func (h *ChatHandler) DeleteMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Chat created successfully",
-		"data":    chat})
+	messageIDStr := c.Param("messageId")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	if err := h.chatUseCase.DeleteMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID); err != nil {
+		h.logger.Errorf("Failed to delete message: %v", err)
+		h.respondMessageError(c, err)
+		return
+	}
+
+	respondMessage(c, "Message deleted successfully")
 }
 
-// GetUserChats - получает список чатов пользователя
-// GetUserChats godoc
-// @Summary      Get user chats
-// @Description  Returns all chats the authenticated user is a member of
+// RestoreMessage - отменяет недавнее удаление сообщения
+// RestoreMessage godoc
+// @Summary      Restore deleted message
+// @Description  Undoes a message deletion within the restore window (whoever deleted it, or group admin) and notifies chat members with a message_restored event
 // @Tags         chat
 // @Produce      json
 // @Security     BearerAuth
-// @Success      200  {array}   models.Chat
-// @Router       /chats [get]
-func (h *ChatHandler) GetUserChats(c *gin.Context) {
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Failure      410   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/restore [post]
+func (h *ChatHandler) RestoreMessage(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
-	chats, err := h.chatUseCase.GetUserChats(user.(*entities.User).ID)
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		h.logger.Errorf("Failed to get user chats: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get chats"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	message, err := h.chatUseCase.RestoreMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to restore message: %v", err)
+		h.respondMessageError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": chats})
+	respondOK(c, messageResponseMap(*message))
 }
 
-// GetChatMessages - получает сообщения чата с постраничной навигацией
-// GetChatMessages godoc
-// @Summary      Get chat messages
-// @Description  Returns all messages from a specific chat
+// respondMessageError - сопоставляет ошибки операций над сообщениями с HTTP статусами
+func (h *ChatHandler) respondMessageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrNotChatMember), errors.Is(err, usecase.ErrMessageForbidden), errors.Is(err, usecase.ErrEditWindowExpired):
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	case errors.Is(err, usecase.ErrMessageNotFound):
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrInvalidContent), errors.Is(err, usecase.ErrContentRejected), errors.Is(err, usecase.ErrMessageNotEditable):
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrServerKeysDisabled):
+		respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+	case errors.Is(err, usecase.ErrRestoreWindowExpired):
+		respondError(c, http.StatusGone, response.CodeGone, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+	}
+}
+
+// SendEncryptedMessage - сохраняет сообщение, зашифрованное и подписанное на клиенте
+// SendEncryptedMessage godoc
+// @Summary      Send client-encrypted message
+// @Description  Stores a message encrypted on the client after verifying its signatures against the sender's registered public keys
 // @Tags         chat
+// @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        chat_id  path  string  true  "Chat ID"
-// @Success      200      {array}  models.Message
-// @Router       /chats/{chat_id}/messages [get]
-func (h *ChatHandler) GetChatMessages(c *gin.Context) {
+// @Param        id    path  int                                    true  "Chat ID"
+// @Param        data  body  usecase.SendEncryptedMessageRequest  true  "Encrypted message"
+// @Success      201   {object}  gin.H
+// @Failure      400   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      409   {object}  gin.H
+// @Failure      429   {object}  gin.H
+// @Router       /chats/:id/messages/encrypted [post]
+func (h *ChatHandler) SendEncryptedMessage(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	limitStr := c.DefaultQuery("limit", "50")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 50
+	var req usecase.SendEncryptedMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
 	}
 
-	offsetStr := c.DefaultQuery("offset", "0")
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
-		offset = 0
-	}
-	messages, err := h.chatUseCase.GetChatMessages(uint(chatID), user.(*entities.User).ID, limit, offset)
+	message, err := h.chatUseCase.SendClientEncryptedMessage(c.Request.Context(), uint(chatID), user.(*entities.User).ID, &req)
 	if err != nil {
-		h.logger.Errorf("Failed to get chat messages: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	responseMessages := make([]map[string]interface{}, len(messages))
-	for i, msg := range messages {
-		responseMessages[i] = map[string]interface{}{
-			"id":                msg.Message.ID,
-			"chat_id":           msg.Message.ChatID,
-			"sender_id":         msg.Message.SenderID,
-			"content":           msg.DecryptedContent,
-			"decrypted_content": msg.DecryptedContent,
-			"message_type":      msg.Message.MessageType,
-			"created_at":        msg.Message.CreatedAt,
-			"updated_at":        msg.Message.UpdatedAt,
-			"sender":            msg.Message.Sender,
-			"nonce":             msg.Message.Nonce,
-			"iv":                msg.Message.IV,
-			"hmac":              msg.Message.HMAC,
-			"ecdsa_signature":   msg.Message.ECDSASignature,
-			"rsa_signature":     msg.Message.RSASignature,
+		h.logger.Errorf("Failed to send encrypted message: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrInvalidMessage), errors.Is(err, usecase.ErrInvalidMessageType):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrStaleKeyVersion), errors.Is(err, usecase.ErrNoRecipients):
+			respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+		case errors.Is(err, usecase.ErrSlowMode):
+			respondSlowMode(c, err)
+		case errors.Is(err, usecase.ErrRateLimited):
+			respondError(c, http.StatusTooManyRequests, response.CodeTooManyRequests, err.Error())
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
 		}
+		return
+	}
+
+	wsMessage := websocket.WSMessage{
+		Type:   websocket.MessageTypeChat,
+		ChatID: uint(chatID),
+		From:   message.SenderID,
+		Data: websocket.ChatMessage{
+			ID:              message.ID,
+			ChatID:          message.ChatID,
+			Seq:             message.Seq,
+			SenderID:        message.SenderID,
+			Content:         message.Content,
+			MessageType:     message.MessageType,
+			Status:          message.Status,
+			Nonce:           message.Nonce,
+			IV:              message.IV,
+			HMAC:            message.HMAC,
+			ECDSASignature:  message.ECDSASignature,
+			RSASignature:    message.RSASignature,
+			Timestamp:       *message.Timestamp,
+			ClientEncrypted: true,
+			KeyVersion:      message.KeyVersion,
+			RatchetHeader:   req.RatchetHeader,
+		},
 	}
+	h.wsHub.SendToChat(uint(chatID), wsMessage, message.SenderID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": responseMessages})
+	respondCreated(c, message)
 }
 
-// SendMessage - отправляет сообщение в чат с криптографической защитой
-// SendMessage godoc
-// @Summary      Send message
-// @Description  Sends a message to a specific chat
+// MarkMessageRead - отмечает сообщение прочитанным текущим пользователем
+// MarkMessageRead godoc
+// @Summary      Mark message as read
+// @Description  Stores a read receipt and moves the message to the read status
 // @Tags         chat
-// @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        message  body  models.Message  true  "Message content"
-// @Success      201      {object}  models.Message
-// @Failure      400      {object}  gin.H
-// @Router       /chats/{chat_id}/messages [get]
-func (h *ChatHandler) SendMessage(c *gin.Context) {
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/read [post]
+func (h *ChatHandler) MarkMessageRead(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	var req usecase.SendMessageRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	messageIDStr := c.Param("messageId")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
 		return
 	}
-	currentUser := user.(*entities.User)
-
-	var ecdsaPrivateKey *ecdsa.PrivateKey
-	var rsaPrivateKey *rsa.PrivateKey
 
-	if currentUser.ECDSAPrivateKey != "" {
-		var err error
-		ecdsaPrivateKey, err = crypto.DeserializeECDSAPrivateKey([]byte(currentUser.ECDSAPrivateKey))
-		if err != nil {
-			h.logger.Errorf("Failed to deserialize ECDSA private key: %v", err)
+	err = h.chatUseCase.MarkMessageRead(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to mark message as read: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrMessageNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
 		}
+		return
 	}
 
-	if currentUser.RSAPrivateKey != "" {
-		var err error
-		rsaPrivateKey, err = crypto.DeserializeRSAPrivateKey([]byte(currentUser.RSAPrivateKey))
-		if err != nil {
-			h.logger.Errorf("Failed to deserialize RSA private key: %v", err)
-		}
+	respondMessage(c, "Message marked as read")
+}
+
+// GetMessageReaders - возвращает участников чата, прочитавших сообщение
+// GetMessageReaders godoc
+// @Summary      Get message read-by list
+// @Description  Returns chat members who have read the message with read timestamps, in reading order
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200   {array}   entities.MessageReader
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/read-by [get]
+func (h *ChatHandler) GetMessageReaders(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
 	}
 
-	message, err := h.chatUseCase.SendMessage(uint(chatID), user.(*entities.User).ID, &req, ecdsaPrivateKey, rsaPrivateKey)
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		h.logger.Errorf("Failed to send message: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
-	wsMessage := websocket.WSMessage{
-		Type:   websocket.MessageTypeChat,
-		ChatID: uint(chatID),
-		From:   user.(*entities.User).ID,
-		Data: websocket.ChatMessage{
-			ID:             message.ID,
-			ChatID:         message.ChatID,
-			SenderID:       message.SenderID,
-			Content:        req.Content,
-			MessageType:    message.MessageType,
-			Nonce:          message.Nonce,
-			IV:             message.IV,
-			HMAC:           message.HMAC,
-			ECDSASignature: message.ECDSASignature,
-			RSASignature:   message.RSASignature,
-			Timestamp:      message.CreatedAt.Unix(),
-		},
+
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
 	}
-	h.wsHub.SendToChat(uint(chatID), wsMessage, user.(*entities.User).ID)
 
-	responseMessage := map[string]interface{}{
-		"id":                message.ID,
-		"chat_id":           message.ChatID,
-		"sender_id":         message.SenderID,
-		"content":           req.Content,
-		"decrypted_content": req.Content,
-		"message_type":      message.MessageType,
-		"created_at":        message.CreatedAt,
-		"updated_at":        message.UpdatedAt,
-		"sender":            message.Sender,
+	readers, err := h.chatUseCase.GetMessageReaders(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Errorf("Failed to get message readers: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrMessageNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Message sent successfully",
-		"data":    responseMessage})
+	respondOK(c, readers)
 }
 
 // AddMember - добавляет участника в групповой чат
@@ -267,14 +1200,14 @@ func (h *ChatHandler) SendMessage(c *gin.Context) {
 func (h *ChatHandler) AddMember(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
@@ -282,29 +1215,80 @@ func (h *ChatHandler) AddMember(c *gin.Context) {
 		UserID uint `json:"user_id" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
 		return
 	}
-	addedUser, err := h.chatUseCase.AddMemberWithUserData(uint(chatID), user.(*entities.User).ID, req.UserID)
+	addedUser, err := h.chatUseCase.AddMemberWithUserData(c.Request.Context(), uint(chatID), user.(*entities.User).ID, req.UserID)
 	if err != nil {
 		h.logger.Errorf("Failed to add member: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondMemberError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Member added successfully", "data": gin.H{
-			"user": gin.H{
-				"id":        addedUser.ID,
-				"username":  addedUser.Username,
-				"email":     addedUser.Email,
-				"is_online": false, // TODO: Get actual online status
-				"role":      "member",
-			},
+	respondOK(c, gin.H{
+		"user": gin.H{
+			"id":        addedUser.ID,
+			"username":  addedUser.Username,
+			"email":     addedUser.Email,
+			"is_online": addedUser.IsOnline,
+			"role":      "member",
 		},
 	})
 }
 
+// AddMembers - добавляет в групповой чат сразу нескольких участников
+// AddMembers godoc
+// @Summary      Add several members to chat
+// @Description  Adds users to a group chat in one transaction; users who are already members are reported per user
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int                        true  "Chat ID"
+// @Param        data  body  usecase.AddMembersRequest  true  "User IDs"
+// @Success      200   {object}  gin.H
+// @Failure      400   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Router       /chats/:id/members/bulk [post]
+func (h *ChatHandler) AddMembers(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatIDStr := c.Param("id")
+	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req usecase.AddMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.chatUseCase.AddMembers(c.Request.Context(), uint(chatID), user.(*entities.User).ID, req.UserIDs)
+	if err != nil {
+		h.logger.Errorf("Failed to add members: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrChatNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		case errors.Is(err, usecase.ErrMemberNotFound), errors.Is(err, usecase.ErrNotGroupChat):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
+		return
+	}
+
+	respondOK(c, results)
+}
+
 // RemoveMember - удаляет участника из группового чата
 // RemoveMember godoc
 // @Summary      Remove member from chat
@@ -316,34 +1300,35 @@ func (h *ChatHandler) AddMember(c *gin.Context) {
 // @Param        data  body  map[string]string  true  "Chat ID and username"
 // @Success      200   {object}  gin.H
 // @Failure      400   {object}  gin.H
+// @Failure      409   {object}  gin.H
 // @Router       /chats/:id/members/:userId [delete]
 func (h *ChatHandler) RemoveMember(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
 	userIDStr := c.Param("userId")
 	userIDToRemove, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid user ID")
 		return
 	}
-	err = h.chatUseCase.RemoveMember(uint(chatID), user.(*entities.User).ID, uint(userIDToRemove))
+	err = h.chatUseCase.RemoveMember(c.Request.Context(), uint(chatID), user.(*entities.User).ID, uint(userIDToRemove))
 	if err != nil {
 		h.logger.Errorf("Failed to remove member: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondMemberError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+	respondMessage(c, "Member removed successfully")
 }
 
 // CreateOrGetPrivateChat - создает новый приватный чат или возвращает существующий
@@ -361,16 +1346,17 @@ func (h *ChatHandler) RemoveMember(c *gin.Context) {
 func (h *ChatHandler) CreateOrGetPrivateChat(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	var req struct {
-		UserID   uint   `json:"user_id" binding:"required"`
-		Username string `json:"username" binding:"required"`
+		UserID            uint     `json:"user_id" binding:"required"`
+		Username          string   `json:"username" binding:"required"`
+		EncryptionSchemes []string `json:"encryption_schemes"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
 		return
 	}
 
@@ -378,54 +1364,200 @@ func (h *ChatHandler) CreateOrGetPrivateChat(c *gin.Context) {
 
 	// Проверяем, что пользователь не пытается создать чат с самим собой
 	if currentUserID == req.UserID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot create chat with yourself"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Cannot create chat with yourself")
 		return
 	}
-	chat, err := h.chatUseCase.CreateOrGetPrivateChat(currentUserID, req.UserID, req.Username)
+	chat, err := h.chatUseCase.CreateOrGetPrivateChat(c.Request.Context(), currentUserID, req.UserID, req.Username, req.EncryptionSchemes)
 	if err != nil {
 		h.logger.Errorf("Failed to create or get private chat: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		return
+	}
+
+	respondOK(c, chat)
+}
+
+// CreateOrGetPrivateChatByUsername - создает или возвращает приватный чат по имени пользователя
+// CreateOrGetPrivateChatByUsername godoc
+// @Summary      Create or get private chat by username
+// @Description  Resolves the username on the server and returns existing private chat or creates a new one
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        user  body  map[string]string  true  "Username of the other user"
+// @Success      200   {object}  models.Chat
+// @Failure      400   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/private/by-username [post]
+func (h *ChatHandler) CreateOrGetPrivateChatByUsername(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	var req struct {
+		Username          string   `json:"username" binding:"required"`
+		EncryptionSchemes []string `json:"encryption_schemes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	chat, err := h.chatUseCase.CreateOrGetPrivateChatByUsername(c.Request.Context(), user.(*entities.User).ID, req.Username, req.EncryptionSchemes)
+	if err != nil {
+		h.logger.Errorf("Failed to create or get private chat by username: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrUserNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, "User not found")
+		case errors.Is(err, usecase.ErrCannotChatWithSelf):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Cannot create chat with yourself")
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Private chat ready",
-		"data":    chat})
+	respondOK(c, chat)
 }
 
-// GetChatMembers - получает список участников чата
+// maxMembersLimit - наибольший размер страницы списка участников чата
+const maxMembersLimit = 500
+
+// GetChatMembers - получает список участников чата с постраничной навигацией
 // GetChatMembers godoc
 // @Summary      Get chat members
-// @Description  Returns a list of members in the chat
+// @Description  Returns a page of chat members with their roles in join order, plus the total member count
 // @Tags         chat
 // @Produce      json
 // @Security     BearerAuth
-// @Param        chat_id  query  string  true  "Chat ID"
+// @Param        chat_id  query  string  true   "Chat ID"
+// @Param        limit    query  int     false  "Page size (default 100, max 500)"
+// @Param        offset   query  int     false  "Page offset"
 // @Success      200      {array}  string
 // @Router       /chats/:id/members [get]
 func (h *ChatHandler) GetChatMembers(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	members, err := h.chatUseCase.GetChatMembers(uint(chatID), user.(*entities.User).ID)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	limit = min(limit, maxMembersLimit)
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	page, err := h.chatUseCase.GetChatMembersPage(c.Request.Context(), uint(chatID), user.(*entities.User).ID, limit, offset)
 	if err != nil {
 		h.logger.Errorf("Failed to get chat members: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		if errors.Is(err, usecase.ErrNotChatMember) {
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get chat members")
+		return
+	}
+
+	respondPage(c, page.Members, pageMeta{
+		Total:   page.Total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: page.HasMore,
+	})
+}
+
+// SetSlowMode - задает минимальный интервал между сообщениями участника группового чата
+// SetSlowMode godoc
+// @Summary      Set chat slow mode
+// @Description  Sets the minimum interval in seconds between a member's messages; 0 disables slow mode. Admins are exempt
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path  int                         true  "Chat ID"
+// @Param        data  body  usecase.SetSlowModeRequest  true  "Slow mode interval"
+// @Success      200   {object}  gin.H
+// @Failure      400   {object}  gin.H
+// @Failure      403   {object}  gin.H
+// @Failure      404   {object}  gin.H
+// @Router       /chats/:id/slow-mode [put]
+func (h *ChatHandler) SetSlowMode(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var req usecase.SetSlowModeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.chatUseCase.SetSlowMode(c.Request.Context(), uint(chatID), user.(*entities.User).ID, req.Seconds); err != nil {
+		h.logger.Errorf("Failed to set slow mode: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrChatNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		case errors.Is(err, usecase.ErrNotGroupChat):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrNotChatMember), errors.Is(err, usecase.ErrNotChatAdmin):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data": members})
+	respondOK(c, gin.H{"slow_mode_seconds": req.Seconds})
+}
+
+// respondMemberError - отвечает на ошибки изменения состава и ролей участников группы
+func respondMemberError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrLastAdmin):
+		respondError(c, http.StatusConflict, "LAST_ADMIN", err.Error())
+	case errors.Is(err, usecase.ErrCannotRemoveCreator):
+		respondError(c, http.StatusForbidden, "CANNOT_REMOVE_CREATOR", err.Error())
+	case errors.Is(err, usecase.ErrCannotAddSelf):
+		respondError(c, http.StatusBadRequest, "CANNOT_ADD_SELF", err.Error())
+	default:
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	}
+}
+
+// respondSlowMode - отвечает 429 с оставшимся временем ожидания медленного режима
+func respondSlowMode(c *gin.Context, err error) {
+	retryAfter := 1
+	var slowModeErr *usecase.SlowModeError
+	if errors.As(err, &slowModeErr) {
+		retryAfter = max(1, int(math.Ceil(slowModeErr.Remaining.Seconds())))
+	}
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	response.ErrorWithDetails(c, http.StatusTooManyRequests, response.CodeTooManyRequests, err.Error(), gin.H{"retry_after": retryAfter})
 }
 
 // SetAdmin - назначает пользователя администратором чата
@@ -443,31 +1575,31 @@ func (h *ChatHandler) GetChatMembers(c *gin.Context) {
 func (h *ChatHandler) SetAdmin(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
 	userIDStr := c.Param("userId")
 	userIDToUpdate, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid user ID")
 		return
 	}
 
-	err = h.chatUseCase.SetAdmin(uint(chatID), user.(*entities.User).ID, uint(userIDToUpdate))
+	err = h.chatUseCase.SetAdmin(c.Request.Context(), uint(chatID), user.(*entities.User).ID, uint(userIDToUpdate))
 	if err != nil {
 		h.logger.Errorf("Failed to set admin: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "User is now an admin"})
+	respondMessage(c, "User is now an admin")
 }
 
 // RemoveAdmin - снимает административные права с пользователя
@@ -481,35 +1613,92 @@ func (h *ChatHandler) SetAdmin(c *gin.Context) {
 // @Param        data  body  map[string]string  true  "Chat ID and username"
 // @Success      200   {object}  gin.H
 // @Failure      400   {object}  gin.H
+// @Failure      409   {object}  gin.H
 // @Router       /chats/:id/members/:userId/admin [delete]
 func (h *ChatHandler) RemoveAdmin(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
 	userIDStr := c.Param("userId")
 	userIDToUpdate, err := strconv.ParseUint(userIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid user ID")
 		return
 	}
 
-	err = h.chatUseCase.RemoveAdmin(uint(chatID), user.(*entities.User).ID, uint(userIDToUpdate))
+	err = h.chatUseCase.RemoveAdmin(c.Request.Context(), uint(chatID), user.(*entities.User).ID, uint(userIDToUpdate))
 	if err != nil {
 		h.logger.Errorf("Failed to remove admin: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondMemberError(c, err)
+		return
+	}
+	respondMessage(c, "Admin rights removed")
+}
+
+// UpdateMemberRoles - массово меняет роли участников группы
+// UpdateMemberRoles godoc
+// @Summary      Update member roles in bulk
+// @Description  Creator-only: sets roles ("admin" or "member") for up to 100 members at once from a {user_id: role} map. All changes are applied in one transaction; the request fails as a whole if any user is not a member or no admin would remain. Returns the roles that actually changed
+// @Tags         chat
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path  int                true  "Chat ID"
+// @Param        roles  body  map[string]string  true  "User ID to new role"
+// @Success      200    {array}   usecase.RoleChange
+// @Failure      400    {object}  gin.H
+// @Failure      403    {object}  gin.H
+// @Failure      404    {object}  gin.H
+// @Failure      409    {object}  gin.H
+// @Router       /chats/:id/roles [put]
+func (h *ChatHandler) UpdateMemberRoles(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	var roles map[uint]string
+	if err := c.ShouldBindJSON(&roles); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	changes, err := h.chatUseCase.UpdateMemberRoles(c.Request.Context(), uint(chatID), user.(*entities.User).ID, roles)
+	if err != nil {
+		h.logger.Errorf("Failed to update member roles: %v", err)
+		switch {
+		case errors.Is(err, usecase.ErrChatNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		case errors.Is(err, usecase.ErrNotChatCreator), errors.Is(err, usecase.ErrCreatorRoleFixed):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		case errors.Is(err, usecase.ErrNotGroupChat), errors.Is(err, usecase.ErrInvalidRoleChanges),
+			errors.Is(err, usecase.ErrNotChatMember):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrLastAdmin):
+			respondError(c, http.StatusConflict, "LAST_ADMIN", err.Error())
+		default:
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+		}
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Admin rights removed"})
+	respondOK(c, changes)
 }
 
 // LeaveChat - позволяет пользователю покинуть чат
@@ -523,28 +1712,29 @@ func (h *ChatHandler) RemoveAdmin(c *gin.Context) {
 // @Param        data  body  map[string]string  true  "Chat ID"
 // @Success      200   {object}  gin.H
 // @Failure      400   {object}  gin.H
+// @Failure      409   {object}  gin.H
 // @Router       /chats/:id/leave [post]
 func (h *ChatHandler) LeaveChat(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	err = h.chatUseCase.LeaveChat(uint(chatID), user.(*entities.User).ID)
+	err = h.chatUseCase.LeaveChat(c.Request.Context(), uint(chatID), user.(*entities.User).ID)
 	if err != nil {
 		h.logger.Errorf("Failed to leave chat: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondMemberError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully left the chat"})
+	respondMessage(c, "Successfully left the chat")
 }
 
 // DeleteChat - удаляет приватный чат
@@ -562,24 +1752,24 @@ func (h *ChatHandler) LeaveChat(c *gin.Context) {
 func (h *ChatHandler) DeleteChat(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	err = h.chatUseCase.DeletePrivateChat(uint(chatID), user.(*entities.User).ID)
+	err = h.chatUseCase.DeletePrivateChat(c.Request.Context(), uint(chatID), user.(*entities.User).ID)
 	if err != nil {
 		h.logger.Errorf("Failed to delete chat: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Chat deleted successfully"})
+	respondMessage(c, "Chat deleted successfully")
 }
 
 // DeleteGroupChat - удаляет групповой чат
@@ -597,23 +1787,23 @@ func (h *ChatHandler) DeleteChat(c *gin.Context) {
 func (h *ChatHandler) DeleteGroupChat(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	chatIDStr := c.Param("id")
 	chatID, err := strconv.ParseUint(chatIDStr, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
 		return
 	}
 
-	err = h.chatUseCase.DeleteGroupChat(uint(chatID), user.(*entities.User).ID)
+	err = h.chatUseCase.DeleteGroupChat(c.Request.Context(), uint(chatID), user.(*entities.User).ID)
 	if err != nil {
 		h.logger.Errorf("Failed to delete group chat: %v", err)
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Group chat deleted successfully"})
+	respondMessage(c, "Group chat deleted successfully")
 }
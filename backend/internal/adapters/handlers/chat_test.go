@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memberOnlyChats - репозиторий чатов, знающий только состав участников
+type memberOnlyChats struct {
+	repository.ChatRepository
+	members map[uint][]uint
+}
+
+func (r *memberOnlyChats) IsMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	for _, id := range r.members[chatID] {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newTestChatRouter - маршрутизатор с обработчиком чатов, от имени пользователя userID
+func newTestChatRouter(chats repository.ChatRepository, userID uint) *gin.Engine {
+	chatUseCase := usecase.NewChatUseCase(chats, nil, nil, nil, nil, nil, &config.ChatConfig{}, logger.New(), nil, nil)
+	handler := NewChatHandler(chatUseCase, nil, logger.New())
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &entities.User{ID: userID})
+	})
+	router.GET("/chats/:id", handler.GetChat)
+	return router
+}
+
+func TestGetChatNonMemberForbidden(t *testing.T) {
+	router := newTestChatRouter(&memberOnlyChats{members: map[uint][]uint{10: {1, 2}}}, 3)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/chats/10", nil))
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+	body := decodeEnvelope(t, recorder)
+	if _, ok := body["data"]; ok {
+		t.Fatalf("chat details leaked to a non-member: %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/internal/infrastructure/websocket"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GuestHandler struct {
+	authUseCase *usecase.AuthUseCase
+	chatUseCase *usecase.ChatUseCase
+	hub         *websocket.Hub
+	logger      *logger.Logger
+}
+
+// NewGuestHandler - создает новый экземпляр обработчика гостевого доступа к чатам
+func NewGuestHandler(authUseCase *usecase.AuthUseCase, chatUseCase *usecase.ChatUseCase, hub *websocket.Hub, logger *logger.Logger) *GuestHandler {
+	return &GuestHandler{
+		authUseCase: authUseCase,
+		chatUseCase: chatUseCase,
+		hub:         hub,
+		logger:      logger,
+	}
+}
+
+// CreateGuestLink - выдает гостевой токен для доступа к групповому чату только на чтение
+// CreateGuestLink godoc
+// @Summary      Create guest link
+// @Description  Issues a read-only guest token for a group chat; only the creator or admins may issue it
+// @Tags         chat
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path  int  true  "Chat ID"
+// @Success      201  {object}  gin.H
+// @Failure      400  {object}  gin.H
+// @Failure      403  {object}  gin.H
+// @Failure      404  {object}  gin.H
+// @Router       /chats/:id/guest-link [post]
+func (h *GuestHandler) CreateGuestLink(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	if err := h.chatUseCase.AuthorizeGuestLink(c.Request.Context(), uint(chatID), user.(*entities.User).ID); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrChatNotFound):
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+		case errors.Is(err, usecase.ErrNotGroupChat):
+			respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		case errors.Is(err, usecase.ErrNotChatMember), errors.Is(err, usecase.ErrNotChatAdmin):
+			respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+		default:
+			h.logger.Errorf("Failed to authorize guest link: %v", err)
+			respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create guest link")
+		}
+		return
+	}
+
+	token, expiresAt, err := h.authUseCase.IssueGuestToken(uint(chatID))
+	if err != nil {
+		h.logger.Errorf("Failed to issue guest token: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create guest link")
+		return
+	}
+
+	respondCreated(c, gin.H{
+		"token":      token,
+		"chat_id":    chatID,
+		"expires_at": expiresAt,
+	})
+}
+
+// GetMessages - получает историю чата по гостевому токену
+// GetMessages godoc
+// @Summary      Get guest chat messages
+// @Description  Returns a page of chat history for a read-only guest token
+// @Tags         guest
+// @Produce      json
+// @Param        token   query  string  false  "Guest token (alternative to Authorization header)"
+// @Param        limit   query  int     false  "Page size"
+// @Param        offset  query  int     false  "Page offset"
+// @Success      200  {object}  gin.H
+// @Failure      401  {object}  gin.H
+// @Failure      404  {object}  gin.H
+// @Router       /guest/messages [get]
+func (h *GuestHandler) GetMessages(c *gin.Context) {
+	chatID := c.GetUint("guest_chat_id")
+	if chatID == 0 {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "Guest token required")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil {
+		limit = 50
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	page, err := h.chatUseCase.GetGuestMessages(c.Request.Context(), chatID, limit, offset)
+	if err != nil {
+		if errors.Is(err, usecase.ErrChatNotFound) {
+			respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+			return
+		}
+		h.logger.Errorf("Failed to get guest messages: %v", err)
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to get messages")
+		return
+	}
+
+	responseMessages := make([]map[string]interface{}, len(page.Messages))
+	for i, msg := range page.Messages {
+		responseMessages[i] = messageResponseMap(msg)
+	}
+
+	respondPage(c, responseMessages, pageMeta{
+		Total:               page.Total,
+		Limit:               limit,
+		Offset:              offset,
+		HasMore:             page.HasMore,
+		HistoryLimitReached: page.HistoryLimitReached,
+	})
+}
+
+// HandleWebSocket - обрабатывает гостевое подключение к WebSocket: гость получает события
+// своего чата и не может отправлять кадры
+func (h *GuestHandler) HandleWebSocket(c *gin.Context) {
+	chatID := c.GetUint("guest_chat_id")
+	if chatID == 0 {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "Guest token required")
+		return
+	}
+
+	h.hub.ServeGuestWS(c.Writer, c.Request, chatID)
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"sleek-chat-backend/internal/adapters/middleware"
+	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -44,17 +48,17 @@ func (h *KeyExchangeHandler) InitiateKeyExchange(c *gin.Context) {
 	var req usecase.KeyExchangeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid key exchange request", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid request format")
 		return
 	}
 
 	h.logger.Info("Processing key exchange request", "userID", req.UserID)
 
 	// Выполняем обмен ключами
-	response, sessionInfo, err := h.keyExchangeUseCase.InitiateKeyExchange(&req)
+	result, sessionInfo, err := h.keyExchangeUseCase.InitiateKeyExchange(c.Request.Context(), &req)
 	if err != nil {
 		h.logger.Error("Key exchange failed", "error", err, "userID", req.UserID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Key exchange failed"})
+		h.respondKeyExchangeError(c, err, "Key exchange failed")
 		return
 	}
 
@@ -66,7 +70,7 @@ func (h *KeyExchangeHandler) InitiateKeyExchange(c *gin.Context) {
 		"sessionID", sessionInfo.SessionID,
 	)
 
-	c.JSON(http.StatusOK, response)
+	respondOK(c, result)
 }
 
 // RefreshSession godoc
@@ -80,29 +84,30 @@ func (h *KeyExchangeHandler) InitiateKeyExchange(c *gin.Context) {
 // @Success 200 {object} usecase.KeyExchangeResponse
 // @Failure 400 {object} map[string]interface{}
 // @Failure 404 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
 // @Router /api/key-exchange/refresh/{sessionId} [post]
 func (h *KeyExchangeHandler) RefreshSession(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID is required"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Session ID is required")
 		return
 	}
 
 	var req usecase.KeyExchangeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.logger.Error("Invalid refresh session request", "error", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid request format")
 		return
 	}
 
 	h.logger.Info("Processing session refresh request", "sessionID", sessionID, "userID", req.UserID)
 
 	// Обновляем ключи сессии
-	response, sessionInfo, err := h.keyExchangeUseCase.RefreshSession(sessionID, &req)
+	result, sessionInfo, err := h.keyExchangeUseCase.RefreshSession(c.Request.Context(), sessionID, &req)
 	if err != nil {
 		h.logger.Error("Session refresh failed", "error", err, "sessionID", sessionID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Session refresh failed"})
+		h.respondKeyExchangeError(c, err, "Session refresh failed")
 		return
 	}
 
@@ -114,7 +119,7 @@ func (h *KeyExchangeHandler) RefreshSession(c *gin.Context) {
 		"newSessionID", sessionInfo.SessionID,
 	)
 
-	c.JSON(http.StatusOK, response)
+	respondOK(c, result)
 }
 
 // ValidateSession godoc
@@ -132,18 +137,18 @@ func (h *KeyExchangeHandler) RefreshSession(c *gin.Context) {
 func (h *KeyExchangeHandler) ValidateSession(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID is required"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Session ID is required")
 		return
 	}
 
-	session, err := h.keyExchangeUseCase.ValidateSession(sessionID)
+	session, err := h.keyExchangeUseCase.ValidateSession(c.Request.Context(), sessionID)
 	if err != nil {
 		h.logger.Error("Session validation failed", "error", err, "sessionID", sessionID)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session validation failed"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "Session validation failed")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	respondOK(c, gin.H{
 		"valid":     true,
 		"sessionId": session.Token,
 		"userId":    session.UserID,
@@ -166,14 +171,14 @@ func (h *KeyExchangeHandler) ValidateSession(c *gin.Context) {
 func (h *KeyExchangeHandler) RevokeSession(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID is required"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Session ID is required")
 		return
 	}
 
-	err := h.keyExchangeUseCase.RevokeSession(sessionID)
+	err := h.keyExchangeUseCase.RevokeSession(c.Request.Context(), sessionID)
 	if err != nil {
 		h.logger.Error("Session revocation failed", "error", err, "sessionID", sessionID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Session revocation failed"})
+		h.respondKeyExchangeError(c, err, "Session revocation failed")
 		return
 	}
 	// Удаляем ключи из middleware
@@ -182,10 +187,7 @@ func (h *KeyExchangeHandler) RevokeSession(c *gin.Context) {
 
 	h.logger.Info("Session revoked successfully", "sessionID", sessionID)
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Session revoked successfully",
-	})
+	respondMessage(c, "Session revoked successfully")
 }
 
 // GetSessionStatus godoc
@@ -202,24 +204,20 @@ func (h *KeyExchangeHandler) RevokeSession(c *gin.Context) {
 func (h *KeyExchangeHandler) GetSessionStatus(c *gin.Context) {
 	sessionID := c.Param("sessionId")
 	if sessionID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Session ID is required"})
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Session ID is required")
 		return
 	}
 
-	session, err := h.keyExchangeUseCase.ValidateSession(sessionID)
+	session, err := h.keyExchangeUseCase.ValidateSession(c.Request.Context(), sessionID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"valid":   false,
-			"error":   err.Error(),
-			"session": nil,
-		})
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
 		return
 	}
 
 	// Проверяем наличие ключей в middleware
 	_, hasKeys := h.encryptionMiddleware.GetSessionKeys(sessionID)
 
-	c.JSON(http.StatusOK, gin.H{
+	respondOK(c, gin.H{
 		"valid":             true,
 		"sessionId":         session.Token,
 		"userId":            session.UserID,
@@ -231,6 +229,62 @@ func (h *KeyExchangeHandler) GetSessionStatus(c *gin.Context) {
 	})
 }
 
+// CancelExchange godoc
+// @Summary Cancel key exchange
+// @Description Cancels a pending key exchange between two users; the other participant is notified over WebSocket
+// @Tags key-exchange
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Key exchange ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /api/key-exchange/cancel/{id} [post]
+func (h *KeyExchangeHandler) CancelExchange(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	exchangeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid key exchange ID")
+		return
+	}
+
+	exchange, err := h.keyExchangeUseCase.CancelExchange(c.Request.Context(), uint(exchangeID), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Error("Key exchange cancellation failed", "error", err, "exchangeID", exchangeID)
+		h.respondKeyExchangeError(c, err, "Key exchange cancellation failed")
+		return
+	}
+
+	respondOK(c, gin.H{
+		"id":     exchange.ID,
+		"status": exchange.Status,
+	})
+}
+
+// respondKeyExchangeError сопоставляет ошибки обмена ключами с HTTP статусами;
+// неизвестные ошибки возвращаются как 500 с общим сообщением
+func (h *KeyExchangeHandler) respondKeyExchangeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, usecase.ErrInvalidClientPublicKey):
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrUserNotFound), errors.Is(err, usecase.ErrSessionNotFound), errors.Is(err, usecase.ErrKeyExchangeNotFound):
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrSessionOwnerMismatch), errors.Is(err, usecase.ErrNotKeyExchangeParticipant):
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	case errors.Is(err, usecase.ErrKeyExchangeNotPending):
+		respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, fallback)
+	}
+}
+
 // RegisterRoutes регистрирует маршруты для обмена ключами
 func (h *KeyExchangeHandler) RegisterRoutes(router *gin.RouterGroup) {
 	keyExchange := router.Group("/key-exchange")
@@ -258,6 +312,7 @@ func (h *KeyExchangeHandler) RegisterRoutesWithMiddleware(router *gin.RouterGrou
 		{
 			protected.POST("/refresh/:sessionId", h.RefreshSession)
 			protected.POST("/revoke/:sessionId", h.RevokeSession)
+			protected.POST("/cancel/:id", h.CancelExchange)
 		}
 	}
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/domain/usecase"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondKeyExchangeErrorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"invalid client key", fmt.Errorf("%w: bad point", usecase.ErrInvalidClientPublicKey), http.StatusBadRequest},
+		{"unknown user", usecase.ErrUserNotFound, http.StatusNotFound},
+		{"unknown session", usecase.ErrSessionNotFound, http.StatusNotFound},
+		{"unknown exchange", usecase.ErrKeyExchangeNotFound, http.StatusNotFound},
+		{"foreign session", usecase.ErrSessionOwnerMismatch, http.StatusForbidden},
+		{"not a participant", usecase.ErrNotKeyExchangeParticipant, http.StatusForbidden},
+		{"already completed", usecase.ErrKeyExchangeNotPending, http.StatusConflict},
+		{"storage failure", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	h := &KeyExchangeHandler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+
+			h.respondKeyExchangeError(c, tt.err, "Key exchange failed")
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			body := decodeEnvelope(t, recorder)
+			// Внутренние ошибки не раскрываются клиенту
+			if tt.wantStatus == http.StatusInternalServerError && strings.Contains(string(body["error"]), "connection refused") {
+				t.Fatalf("internal error leaked: %s", body["error"])
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReactionHandler struct {
+	reactionUseCase *usecase.ReactionUseCase
+	logger          *logger.Logger
+}
+
+// NewReactionHandler - создает новый экземпляр обработчика реакций на сообщения
+func NewReactionHandler(reactionUseCase *usecase.ReactionUseCase, logger *logger.Logger) *ReactionHandler {
+	return &ReactionHandler{
+		reactionUseCase: reactionUseCase,
+		logger:          logger,
+	}
+}
+
+// AddReaction - ставит реакцию на сообщение
+// AddReaction godoc
+// @Summary      Add reaction
+// @Description  Adds a clear-text emoji reaction, or a client-encrypted reaction when ENCRYPTED_REACTIONS is enabled
+// @Tags         reactions
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int                         true  "Chat ID"
+// @Param        messageId  path  int                         true  "Message ID"
+// @Param        reaction   body  usecase.AddReactionRequest  true  "Emoji or encrypted payload"
+// @Success      201        {object}  gin.H
+// @Failure      400        {object}  gin.H
+// @Failure      403        {object}  gin.H
+// @Failure      404        {object}  gin.H
+// @Failure      409        {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/reactions [post]
+func (h *ReactionHandler) AddReaction(c *gin.Context) {
+	chatID, messageID, userID, ok := h.parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	var req usecase.AddReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	reaction, err := h.reactionUseCase.AddReaction(c.Request.Context(), chatID, messageID, userID, &req)
+	if err != nil {
+		h.logger.Errorf("Failed to add reaction: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondCreated(c, reaction)
+}
+
+// RemoveReaction - удаляет свою реакцию на сообщение
+// RemoveReaction godoc
+// @Summary      Remove reaction
+// @Description  Removes one of the user's own reactions (clear-text or encrypted) by its ID
+// @Tags         reactions
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id          path  int  true  "Chat ID"
+// @Param        messageId   path  int  true  "Message ID"
+// @Param        reactionId  path  int  true  "Reaction ID"
+// @Success      200         {object}  gin.H
+// @Failure      403         {object}  gin.H
+// @Failure      404         {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/reactions/:reactionId [delete]
+func (h *ReactionHandler) RemoveReaction(c *gin.Context) {
+	chatID, messageID, userID, ok := h.parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	reactionID, err := strconv.ParseUint(c.Param("reactionId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid reaction ID")
+		return
+	}
+
+	if err := h.reactionUseCase.RemoveReaction(c.Request.Context(), chatID, messageID, uint(reactionID), userID); err != nil {
+		h.logger.Errorf("Failed to remove reaction: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondMessage(c, "Reaction removed successfully")
+}
+
+// GetReactions - возвращает реакции на сообщение
+// GetReactions godoc
+// @Summary      Get reactions
+// @Description  Returns clear-text reaction counts per emoji, the number of encrypted reactions with their ciphertexts, and the caller's own reactions
+// @Tags         reactions
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int  true  "Chat ID"
+// @Param        messageId  path  int  true  "Message ID"
+// @Success      200        {object}  usecase.ReactionSummary
+// @Failure      403        {object}  gin.H
+// @Failure      404        {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/reactions [get]
+func (h *ReactionHandler) GetReactions(c *gin.Context) {
+	chatID, messageID, userID, ok := h.parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.reactionUseCase.GetReactions(c.Request.Context(), chatID, messageID, userID)
+	if err != nil {
+		h.logger.Errorf("Failed to get reactions: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondOK(c, summary)
+}
+
+// parseMessageParams - извлекает пользователя, ID чата и ID сообщения из запроса
+func (h *ReactionHandler) parseMessageParams(c *gin.Context) (uint, uint, uint, bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return 0, 0, 0, false
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return 0, 0, 0, false
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return 0, 0, 0, false
+	}
+
+	return uint(chatID), uint(messageID), user.(*entities.User).ID, true
+}
+
+// respondUseCaseError - преобразует ошибки сервиса реакций в HTTP-ответы
+func (h *ReactionHandler) respondUseCaseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrNotChatMember):
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	case errors.Is(err, usecase.ErrMessageNotFound), errors.Is(err, usecase.ErrReactionNotFound):
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrInvalidReaction):
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrReactionExists), errors.Is(err, usecase.ErrEncryptedReactionsDisabled):
+		respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportsLimit - наибольший размер страницы списка жалоб
+const maxReportsLimit = 100
+
+type ReportHandler struct {
+	reportUseCase *usecase.ReportUseCase
+	logger        *logger.Logger
+}
+
+// NewReportHandler - создает новый экземпляр обработчика жалоб на сообщения
+func NewReportHandler(reportUseCase *usecase.ReportUseCase, logger *logger.Logger) *ReportHandler {
+	return &ReportHandler{
+		reportUseCase: reportUseCase,
+		logger:        logger,
+	}
+}
+
+// ReportMessage - отправляет жалобу на сообщение
+// ReportMessage godoc
+// @Summary      Report message
+// @Description  Files a report about another member's message for admin review; the message text is not copied into the report
+// @Tags         reports
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id         path  int                           true  "Chat ID"
+// @Param        messageId  path  int                           true  "Message ID"
+// @Param        report     body  usecase.ReportMessageRequest  true  "Report reason"
+// @Success      201        {object}  gin.H
+// @Failure      400        {object}  gin.H
+// @Failure      403        {object}  gin.H
+// @Failure      404        {object}  gin.H
+// @Failure      409        {object}  gin.H
+// @Router       /chats/:id/messages/:messageId/report [post]
+func (h *ReportHandler) ReportMessage(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+		return
+	}
+
+	chatID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid chat ID")
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("messageId"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid message ID")
+		return
+	}
+
+	var req usecase.ReportMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.reportUseCase.ReportMessage(c.Request.Context(), uint(chatID), uint(messageID), user.(*entities.User).ID, &req)
+	if err != nil {
+		h.logger.Errorf("Failed to report message: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondCreated(c, report)
+}
+
+// ListReports - возвращает жалобы на сообщения для администратора
+// ListReports godoc
+// @Summary      List message reports
+// @Description  Returns message reports newest first for admins listed in ADMIN_USER_IDS
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status  query  string  false  "Filter by status (open, resolved, dismissed)"
+// @Param        limit   query  int     false  "Page size (default 50, max 100)"
+// @Param        offset  query  int     false  "Page offset"
+// @Success      200     {object}  gin.H
+// @Failure      400     {object}  gin.H
+// @Failure      403     {object}  gin.H
+// @Router       /admin/reports [get]
+func (h *ReportHandler) ListReports(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, maxReportsLimit)
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	page, err := h.reportUseCase.ListReports(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		h.logger.Errorf("Failed to list reports: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondPage(c, page.Reports, pageMeta{
+		Total:   page.Total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: page.HasMore,
+	})
+}
+
+// UpdateReportStatus - меняет статус жалобы после проверки
+// UpdateReportStatus godoc
+// @Summary      Update report status
+// @Description  Marks a message report as open, resolved or dismissed
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id      path  int                                true  "Report ID"
+// @Param        status  body  usecase.UpdateReportStatusRequest  true  "New status"
+// @Success      200     {object}  gin.H
+// @Failure      400     {object}  gin.H
+// @Failure      403     {object}  gin.H
+// @Failure      404     {object}  gin.H
+// @Router       /admin/reports/:id [patch]
+func (h *ReportHandler) UpdateReportStatus(c *gin.Context) {
+	reportID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid report ID")
+		return
+	}
+
+	var req usecase.UpdateReportStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+		return
+	}
+
+	if err := h.reportUseCase.UpdateReportStatus(c.Request.Context(), uint(reportID), req.Status); err != nil {
+		h.logger.Errorf("Failed to update report status: %v", err)
+		h.respondUseCaseError(c, err)
+		return
+	}
+
+	respondMessage(c, "Report status updated successfully")
+}
+
+// respondUseCaseError - преобразует ошибки сервиса жалоб в HTTP-ответы
+func (h *ReportHandler) respondUseCaseError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, usecase.ErrNotChatMember):
+		respondError(c, http.StatusForbidden, response.CodeForbidden, err.Error())
+	case errors.Is(err, usecase.ErrMessageNotFound), errors.Is(err, usecase.ErrReportNotFound):
+		respondError(c, http.StatusNotFound, response.CodeNotFound, err.Error())
+	case errors.Is(err, usecase.ErrInvalidReportReason), errors.Is(err, usecase.ErrInvalidReportStatus),
+		errors.Is(err, usecase.ErrCannotReportOwn), errors.Is(err, usecase.ErrSystemMessageReports):
+		respondError(c, http.StatusBadRequest, response.CodeBadRequest, err.Error())
+	case errors.Is(err, usecase.ErrAlreadyReported):
+		respondError(c, http.StatusConflict, response.CodeConflict, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, response.CodeInternal, err.Error())
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"sleek-chat-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageMeta - сведения о пагинации в поле meta постраничных ответов
+type pageMeta struct {
+	Total               int64 `json:"total"`
+	Limit               int   `json:"limit"`
+	Offset              int   `json:"offset"`
+	HasMore             bool  `json:"has_more"`
+	HistoryLimitReached bool  `json:"history_limit_reached,omitempty"`
+	// KeyVersion - текущая версия ключа чата в ответах со страницей сообщений; 0 - ключ еще не версионирован
+	KeyVersion int `json:"key_version,omitempty"`
+}
+
+// respondOK - отвечает 200 в едином формате {success, data}
+func respondOK(c *gin.Context, data interface{}) {
+	response.Success(c, http.StatusOK, data)
+}
+
+// respondCreated - отвечает 201 в едином формате {success, data}
+func respondCreated(c *gin.Context, data interface{}) {
+	response.Success(c, http.StatusCreated, data)
+}
+
+// respondMessage - отвечает 200 с текстовым подтверждением в data.message для операций без данных
+func respondMessage(c *gin.Context, message string) {
+	response.Success(c, http.StatusOK, gin.H{"message": message})
+}
+
+// respondPage - отвечает 200 со страницей данных и сведениями о пагинации в meta
+func respondPage(c *gin.Context, data interface{}, meta pageMeta) {
+	response.SuccessWithMeta(c, http.StatusOK, data, meta)
+}
+
+// respondError - отвечает ошибкой в едином формате {success: false, error: {code, message}}
+func respondError(c *gin.Context, status int, code, message string) {
+	response.Error(c, status, code, message)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// decodeEnvelope - разбирает ответ обработчика в единый формат {success, data, meta, error}
+func decodeEnvelope(t *testing.T, recorder *httptest.ResponseRecorder) map[string]json.RawMessage {
+	t.Helper()
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON %q: %v", recorder.Body.String(), err)
+	}
+	if _, ok := body["success"]; !ok {
+		t.Fatalf("response %s has no success field", recorder.Body.String())
+	}
+	return body
+}
+
+func TestRespondMessageEnvelope(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	respondMessage(c, "Chat deleted successfully")
+
+	body := decodeEnvelope(t, recorder)
+	if string(body["success"]) != "true" {
+		t.Fatalf("success = %s, want true", body["success"])
+	}
+	if got := string(body["data"]); got != `{"message":"Chat deleted successfully"}` {
+		t.Fatalf("data = %s", got)
+	}
+}
+
+func TestRespondPageEnvelope(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	respondPage(c, []int{1, 2}, pageMeta{Total: 5, Limit: 2, Offset: 0, HasMore: true})
+
+	body := decodeEnvelope(t, recorder)
+	if got := string(body["data"]); got != "[1,2]" {
+		t.Fatalf("data = %s", got)
+	}
+	// Необязательные поля meta не выводятся, если не заданы
+	if got, want := string(body["meta"]), `{"total":5,"limit":2,"offset":0,"has_more":true}`; got != want {
+		t.Fatalf("meta = %s, want %s", got, want)
+	}
+}
+
+func TestRespondErrorEnvelope(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	respondError(c, http.StatusForbidden, "", "not allowed")
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+	body := decodeEnvelope(t, recorder)
+	if string(body["success"]) != "false" {
+		t.Fatalf("success = %s, want false", body["success"])
+	}
+	if _, ok := body["data"]; ok {
+		t.Fatalf("error response has data: %s", recorder.Body.String())
+	}
+	if got, want := string(body["error"]), `{"code":"FORBIDDEN","message":"not allowed"}`; got != want {
+		t.Fatalf("error = %s, want %s", got, want)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,6 +35,8 @@ func NewUserHandler(userUseCase *usecase.UserUseCase, logger *logger.Logger) *Us
 // @Produce      json
 // @Security     BearerAuth
 // @Param        query  query  string  true  "Search query"
+// @Param        limit  query  int     false  "Page size"
+// @Param        offset query  int     false  "Page offset"
 // @Success      200    {array}  string
 // @Failure      400    {object}  gin.H
 // @Router       /users/search [get]
@@ -39,7 +44,7 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
 		h.logger.Error("User not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "UNAUTHORIZED"})
+		respondError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
 		return
 	}
 
@@ -48,7 +53,7 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
 	currentUser, ok := user.(*entities.User)
 	if !ok {
 		h.logger.Error("Invalid user type in context", "userType", fmt.Sprintf("%T", user))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "INVALID_USER_CONTEXT"})
+		respondError(c, http.StatusUnauthorized, "INVALID_USER_CONTEXT", "Invalid user context")
 		return
 	}
 
@@ -57,7 +62,7 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
 
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "MISSING_QUERY_PARAMETER"})
+		respondError(c, http.StatusBadRequest, "MISSING_QUERY_PARAMETER", "Missing query parameter")
 		return
 	}
 
@@ -67,19 +72,26 @@ func (h *UserHandler) SearchUsers(c *gin.Context) {
 			limit = parsedLimit
 		}
 	}
+	offset := 0
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		if parsedOffset, err := strconv.Atoi(offsetParam); err == nil && parsedOffset > 0 {
+			offset = parsedOffset
+		}
+	}
 	req := usecase.SearchUsersRequest{
 		Query:  query,
 		Limit:  limit,
+		Offset: offset,
 		UserID: userID,
 	}
 
-	result, err := h.userUseCase.SearchUsers(req)
+	result, err := h.userUseCase.SearchUsers(c.Request.Context(), req)
 	if err != nil {
 		h.logger.Error("Failed to search users", "error", err.Error(), "userID", userID, "query", query)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "SEARCH_FAILED"})
+		respondError(c, http.StatusInternalServerError, "SEARCH_FAILED", "Search failed")
 		return
 	}
-	c.JSON(http.StatusOK, result)
+	respondOK(c, result)
 }
 
 // GetUser - получает информацию о пользователе по ID
@@ -97,28 +109,178 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 	userIDParam := c.Param("id")
 	userID, err := strconv.ParseUint(userIDParam, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "INVALID_USER_ID"})
+		respondError(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
 		return
 	}
 
-	user, err := h.userUseCase.GetUserByID(uint(userID))
+	user, err := h.userUseCase.GetUserByID(c.Request.Context(), uint(userID))
 	if err != nil {
 		h.logger.Error("Failed to get user", "error", err.Error(), "userID", userID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "USER_NOT_FOUND"})
+		respondError(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
 		return
 	}
 
-	response := gin.H{
-		"id":               user.ID,
-		"username":         user.Username,
-		"email":            user.Email,
-		"is_online":        user.IsOnline,
-		"last_seen":        user.LastSeen,
-		"ecdsa_public_key": user.ECDSAPublicKey,
-		"rsa_public_key":   user.RSAPublicKey,
-		"created_at":       user.CreatedAt,
+	respondOK(c, publicProfile(user))
+}
+
+// GetUsers - получает публичные профили нескольких пользователей по списку ID
+// GetUsers godoc
+// @Summary      Get users by IDs
+// @Description  Returns public profiles for a comma-separated list of user IDs (at most 100); unknown IDs are omitted
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        ids  query  string  true  "Comma-separated user IDs"
+// @Success      200  {object}  gin.H
+// @Failure      400  {object}  gin.H
+// @Router       /users [get]
+func (h *UserHandler) GetUsers(c *gin.Context) {
+	idsParam := strings.TrimSpace(c.Query("ids"))
+	if idsParam == "" {
+		respondError(c, http.StatusBadRequest, "MISSING_QUERY_PARAMETER", "Missing query parameter")
+		return
 	}
-	c.JSON(http.StatusOK, response)
+
+	var userIDs []uint
+	for _, part := range strings.Split(idsParam, ",") {
+		userID, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+			return
+		}
+		userIDs = append(userIDs, uint(userID))
+	}
+
+	users, err := h.userUseCase.GetUsersByIDs(c.Request.Context(), userIDs)
+	if err != nil {
+		if errors.Is(err, usecase.ErrTooManyUserIDs) {
+			response.ErrorWithDetails(c, http.StatusBadRequest, "TOO_MANY_USER_IDS", err.Error(), gin.H{"max": usecase.MaxUserLookupBatch})
+			return
+		}
+		h.logger.Error("Failed to get users", "error", err.Error())
+		respondError(c, http.StatusInternalServerError, "FAILED_TO_GET_USERS", "Failed to get users")
+		return
+	}
+
+	profiles := make([]gin.H, 0, len(users))
+	for i := range users {
+		profiles = append(profiles, publicProfile(&users[i]))
+	}
+
+	respondOK(c, profiles)
+}
+
+// publicProfile - публичные данные пользователя, доступные другим пользователям
+func publicProfile(user *entities.User) gin.H {
+	return gin.H{
+		"id":                user.ID,
+		"username":          user.Username,
+		"email":             user.Email,
+		"is_online":         user.IsOnline,
+		"last_seen":         user.LastSeen,
+		"ecdsa_public_key":  user.ECDSAPublicKey,
+		"rsa_public_key":    user.RSAPublicKey,
+		"x25519_public_key": user.X25519PublicKey,
+		"created_at":        user.CreatedAt,
+	}
+}
+
+// GetContacts - получает список контактов текущего пользователя
+// GetContacts godoc
+// @Summary      Get contacts
+// @Description  Returns distinct users sharing at least one chat with the caller, with online status and last interaction time
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  gin.H
+// @Failure      401  {object}  gin.H
+// @Router       /users/me/contacts [get]
+func (h *UserHandler) GetContacts(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	contacts, err := h.userUseCase.GetContacts(c.Request.Context(), user.(*entities.User).ID)
+	if err != nil {
+		h.logger.Error("Failed to get contacts", "error", err.Error())
+		respondError(c, http.StatusInternalServerError, "FAILED_TO_GET_CONTACTS", "Failed to get contacts")
+		return
+	}
+
+	if contacts == nil {
+		contacts = []entities.Contact{}
+	}
+
+	respondOK(c, contacts)
+}
+
+// BlockUser - блокирует пользователя для текущего пользователя
+// BlockUser godoc
+// @Summary      Block user
+// @Description  Blocks the user; blocked users and their blockers no longer see each other in contacts
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path  int  true  "User ID"
+// @Success      200  {object}  gin.H
+// @Failure      400  {object}  gin.H
+// @Failure      404  {object}  gin.H
+// @Router       /users/:id/block [post]
+func (h *UserHandler) BlockUser(c *gin.Context) {
+	h.setBlocked(c, true)
+}
+
+// UnblockUser - снимает блокировку пользователя
+// UnblockUser godoc
+// @Summary      Unblock user
+// @Description  Removes a block set by the current user
+// @Tags         users
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path  int  true  "User ID"
+// @Success      200  {object}  gin.H
+// @Failure      400  {object}  gin.H
+// @Router       /users/:id/block [delete]
+func (h *UserHandler) UnblockUser(c *gin.Context) {
+	h.setBlocked(c, false)
+}
+
+// setBlocked - общая часть BlockUser и UnblockUser
+func (h *UserHandler) setBlocked(c *gin.Context, blocked bool) {
+	user, exists := c.Get("user")
+	if !exists {
+		respondError(c, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	targetID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+		return
+	}
+
+	currentUserID := user.(*entities.User).ID
+	if blocked {
+		err = h.userUseCase.BlockUser(c.Request.Context(), currentUserID, uint(targetID))
+	} else {
+		err = h.userUseCase.UnblockUser(c.Request.Context(), currentUserID, uint(targetID))
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrCannotBlockSelf):
+			respondError(c, http.StatusBadRequest, "CANNOT_BLOCK_SELF", err.Error())
+		case errors.Is(err, usecase.ErrUserNotFound):
+			respondError(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		default:
+			h.logger.Error("Failed to update block", "error", err.Error(), "userID", targetID)
+			respondError(c, http.StatusInternalServerError, "FAILED_TO_UPDATE_BLOCK", "Failed to update block")
+		}
+		return
+	}
+
+	respondOK(c, gin.H{"user_id": targetID, "blocked": blocked})
 }
 
 // GetOnlineUsers - получает список пользователей онлайн
@@ -131,16 +293,16 @@ func (h *UserHandler) GetUser(c *gin.Context) {
 // @Success      200  {array}  string
 // @Router       /users/online [get]
 func (h *UserHandler) GetOnlineUsers(c *gin.Context) {
-	users, err := h.userUseCase.GetOnlineUsers()
+	users, err := h.userUseCase.GetOnlineUsers(c.Request.Context())
 	if err != nil {
 		h.logger.Error("Failed to get online users", "error", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "FAILED_TO_GET_ONLINE_USERS"})
+		respondError(c, http.StatusInternalServerError, "FAILED_TO_GET_ONLINE_USERS", "Failed to get online users")
 		return
 	}
 
-	response := make([]gin.H, 0, len(users))
+	online := make([]gin.H, 0, len(users))
 	for _, user := range users {
-		response = append(response, gin.H{
+		online = append(online, gin.H{
 			"id":        user.ID,
 			"username":  user.Username,
 			"email":     user.Email,
@@ -148,8 +310,5 @@ func (h *UserHandler) GetOnlineUsers(c *gin.Context) {
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"users": response,
-		"total": len(response),
-	})
+	respondOK(c, online)
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/logger"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// knownUsers - репозиторий пользователей с фиксированным набором записей
+type knownUsers struct {
+	repository.UserRepository
+	users map[uint]*entities.User
+}
+
+func (r *knownUsers) GetByIDs(ctx context.Context, ids []uint) ([]entities.User, error) {
+	var result []entities.User
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok {
+			result = append(result, *user)
+		}
+	}
+	return result, nil
+}
+
+func TestGetUsersOmitsMissingIDs(t *testing.T) {
+	handler := NewUserHandler(usecase.NewUserUseCase(&knownUsers{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+		3: {ID: 3, Username: "carol"},
+	}}), logger.New())
+	router := gin.New()
+	router.GET("/users", handler.GetUsers)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users?ids=1,3,99", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+	}
+	var profiles []struct {
+		ID       uint   `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(decodeEnvelope(t, recorder)["data"], &profiles); err != nil {
+		t.Fatal(err)
+	}
+	// Несуществующий ID 99 просто отсутствует в ответе
+	if len(profiles) != 2 || profiles[0].Username != "alice" || profiles[1].Username != "carol" {
+		t.Fatalf("profiles = %+v, want alice and carol", profiles)
+	}
+}
+
+func TestGetUsersRejectsBadIDs(t *testing.T) {
+	handler := NewUserHandler(usecase.NewUserUseCase(&knownUsers{}), logger.New())
+	router := gin.New()
+	router.GET("/users", handler.GetUsers)
+
+	for _, query := range []string{"", "?ids=", "?ids=1,abc", "?ids=1,-2"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("GET /users%s: status = %d, want %d", query, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
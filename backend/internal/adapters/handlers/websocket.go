@@ -4,6 +4,7 @@ import (
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/infrastructure/websocket"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -26,9 +27,23 @@ func NewWebSocketHandler(hub *websocket.Hub, logger *logger.Logger) *WebSocketHa
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		respondError(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
 		return
 	}
 
 	h.hub.ServeWS(c.Writer, c.Request, user.(*entities.User))
 }
+
+// GetStats - возвращает счетчики WebSocket хаба для диагностики доставки
+// GetStats godoc
+// @Summary      WebSocket hub stats
+// @Description  Returns connected clients, unique online users, guest connections, per-chat subscriber counts and frames relayed since start; for admins listed in ADMIN_USER_IDS
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object}  websocket.HubStats
+// @Failure      403  {object}  gin.H
+// @Router       /admin/ws/stats [get]
+func (h *WebSocketHandler) GetStats(c *gin.Context) {
+	respondOK(c, h.hub.Stats())
+}
@@ -1,24 +1,42 @@
 package middleware
 
 import (
+	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/internal/infrastructure/websocket"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/ratelimit"
+	"sleek-chat-backend/pkg/response"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// wsAuthFailureLimit - сколько неудачных попыток аутентификации WebSocket допускается с одного IP за окно
+	wsAuthFailureLimit = 5
+	// wsAuthFailureWindow - окно подсчета неудачных попыток
+	wsAuthFailureWindow = time.Minute
+)
+
 type AuthMiddleware struct {
 	authUseCase *usecase.AuthUseCase
 	logger      *logger.Logger
+	// wsAuthFailures - каждая неудачная попытка аутентификации WebSocket списывает токен IP;
+	// уборщик ограничителя удаляет счетчики IP, которые давно не ошибались
+	wsAuthFailures *ratelimit.RateLimiter
 }
 
 // NewAuthMiddleware - создает новый экземпляр middleware для аутентификации
 func NewAuthMiddleware(authUseCase *usecase.AuthUseCase, logger *logger.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
-		authUseCase: authUseCase,
-		logger:      logger,
+		authUseCase:    authUseCase,
+		logger:         logger,
+		wsAuthFailures: ratelimit.New(wsAuthFailureLimit, wsAuthFailureWindow, wsAuthFailureWindow),
 	}
 }
 
@@ -27,23 +45,20 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		bearerToken := strings.Split(authHeader, " ")
 		if len(bearerToken) != 2 || bearerToken[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid authorization header format")
 			return
 		}
 
 		token := bearerToken[1]
-		user, err := m.authUseCase.ValidateToken(token)
+		user, err := m.authUseCase.ValidateToken(c.Request.Context(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "Invalid or expired token")
 			return
 		}
 
@@ -53,6 +68,25 @@ func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	}
 }
 
+// RequireAdmin - middleware, пропускающий только администраторов из ADMIN_USER_IDS; подключается после RequireAuth
+func (m *AuthMiddleware) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "User not found")
+			return
+		}
+
+		currentUser, ok := user.(*entities.User)
+		if !ok || !m.authUseCase.IsAdmin(currentUser.ID) {
+			response.Abort(c, http.StatusForbidden, response.CodeForbidden, "Admin access required")
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // OptionalAuth - middleware для опциональной аутентификации пользователя
 func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -69,7 +103,7 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 		}
 
 		token := bearerToken[1]
-		user, err := m.authUseCase.ValidateToken(token)
+		user, err := m.authUseCase.ValidateToken(c.Request.Context(), token)
 		if err == nil {
 			c.Set("user", user)
 			c.Set("token", token)
@@ -79,9 +113,17 @@ func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
 	}
 }
 
-// WebSocketAuth - middleware для аутентификации WebSocket соединений
+// WebSocketAuth - middleware для аутентификации WebSocket соединений. Ошибки рукопожатия
+// закрывают соединение кодом 4401 (нет доступа) или 4429 (слишком много неудачных попыток
+// с подсказкой задержки), обычные HTTP запросы получают JSON ответ
 func (m *AuthMiddleware) WebSocketAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if wait := m.wsAuthFailures.RetryAfter(ip); wait > 0 {
+			m.rejectWebSocket(c, http.StatusTooManyRequests, websocket.CloseCodeRateLimited, "Too many failed authentication attempts", wait)
+			return
+		}
+
 		var token string
 		authHeader := c.GetHeader("Authorization")
 		if authHeader != "" {
@@ -90,21 +132,26 @@ func (m *AuthMiddleware) WebSocketAuth() gin.HandlerFunc {
 				token = bearerToken[1]
 			}
 		}
+		if token == "" {
+			token = websocket.TokenFromSubprotocol(c.Request)
+		}
+		// Параметр token оставлен для совместимости со старыми клиентами: URL попадает в журналы
 		if token == "" {
 			token = c.Query("token")
 		}
 
 		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required in Authorization header or query parameter"})
-			c.Abort()
+			m.wsAuthFailures.Allow(ip)
+			m.rejectWebSocket(c, http.StatusUnauthorized, websocket.CloseCodeUnauthorized, "Token required in Authorization header, Sec-WebSocket-Protocol or query parameter", 0)
 			return
 		}
-		user, err := m.authUseCase.ValidateToken(token)
+		user, err := m.authUseCase.ValidateToken(c.Request.Context(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			m.wsAuthFailures.Allow(ip)
+			m.rejectWebSocket(c, http.StatusUnauthorized, websocket.CloseCodeUnauthorized, "Invalid or expired token", 0)
 			return
 		}
+		m.wsAuthFailures.Reset(ip)
 
 		c.Set("user", user)
 		c.Set("token", token)
@@ -112,13 +159,63 @@ func (m *AuthMiddleware) WebSocketAuth() gin.HandlerFunc {
 	}
 }
 
+// GuestAuth - middleware для гостевого доступа только на чтение: принимает гостевой токен из
+// заголовка Authorization, Sec-WebSocket-Protocol или параметра token и сохраняет в контексте
+// ID чата, к которому он дает доступ
+func (m *AuthMiddleware) GuestAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var token string
+		authHeader := c.GetHeader("Authorization")
+		if authHeader != "" {
+			bearerToken := strings.Split(authHeader, " ")
+			if len(bearerToken) == 2 && bearerToken[0] == "Bearer" {
+				token = bearerToken[1]
+			}
+		}
+		if token == "" {
+			token = websocket.TokenFromSubprotocol(c.Request)
+		}
+		if token == "" {
+			token = c.Query("token")
+		}
+
+		if token == "" {
+			m.rejectWebSocket(c, http.StatusUnauthorized, websocket.CloseCodeUnauthorized, "Guest token required in Authorization header, Sec-WebSocket-Protocol or query parameter", 0)
+			return
+		}
+		chatID, err := m.authUseCase.ValidateGuestToken(token)
+		if err != nil {
+			m.rejectWebSocket(c, http.StatusUnauthorized, websocket.CloseCodeUnauthorized, "Invalid or expired guest token", 0)
+			return
+		}
+
+		c.Set("guest_chat_id", chatID)
+		c.Next()
+	}
+}
+
+// rejectWebSocket - отклоняет подключение кодом закрытия WebSocket или, если запрос не является
+// рукопожатием, HTTP статусом с JSON ошибкой
+func (m *AuthMiddleware) rejectWebSocket(c *gin.Context, status, closeCode int, message string, retryAfter time.Duration) {
+	defer c.Abort()
+
+	if websocket.RejectUpgrade(c.Writer, c.Request, closeCode, message, retryAfter) {
+		return
+	}
+
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	response.Error(c, status, response.CodeForStatus(status), message)
+}
+
 // CORSMiddleware - middleware для настройки CORS заголовков
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Encrypted, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -129,6 +226,14 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// ClientIPMiddleware - сохраняет IP клиента в контексте запроса, чтобы сервисы могли записать его в журнал аудита
+func ClientIPMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(usecase.WithClientIP(c.Request.Context(), c.ClientIP()))
+		c.Next()
+	}
+}
+
 // LoggerMiddleware - middleware для логирования HTTP запросов
 func LoggerMiddleware(logger *logger.Logger) gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
@@ -0,0 +1,263 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/internal/infrastructure/websocket"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	gorilla "github.com/gorilla/websocket"
+)
+
+func newWebSocketAuthRouter(m *AuthMiddleware) *gin.Engine {
+	router := gin.New()
+	router.GET("/ws", m.WebSocketAuth(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestWebSocketAuthLimitsFailuresPerIP(t *testing.T) {
+	m := NewAuthMiddleware(nil, logger.New())
+	defer m.wsAuthFailures.Stop()
+	router := newWebSocketAuthRouter(m)
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		req.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	for i := 0; i < wsAuthFailureLimit; i++ {
+		if code := request("10.0.0.1:1000").Code; code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", i, code, http.StatusUnauthorized)
+		}
+	}
+
+	limited := request("10.0.0.1:1000")
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("status after %d failures = %d, want %d", wsAuthFailureLimit, limited.Code, http.StatusTooManyRequests)
+	}
+	if limited.Header().Get("Retry-After") == "" {
+		t.Fatal("rate-limited response has no Retry-After")
+	}
+
+	if code := request("10.0.0.2:1000").Code; code != http.StatusUnauthorized {
+		t.Fatalf("other IP: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+// dialRejected - подключается к /ws без токена и возвращает ошибку закрытия, которой сервер завершил соединение
+func dialRejected(t *testing.T, serverURL string) (*gorilla.CloseError, *http.Response) {
+	t.Helper()
+
+	conn, resp, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	defer conn.Close()
+
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*gorilla.CloseError)
+	if !ok {
+		t.Fatalf("ReadMessage error = %v, want close frame", err)
+	}
+	return closeErr, resp
+}
+
+func TestWebSocketAuthRejectsUpgradeWithCloseCode(t *testing.T) {
+	m := NewAuthMiddleware(nil, logger.New())
+	defer m.wsAuthFailures.Stop()
+	server := httptest.NewServer(newWebSocketAuthRouter(m))
+	defer server.Close()
+
+	for i := 0; i < wsAuthFailureLimit; i++ {
+		closeErr, _ := dialRejected(t, server.URL)
+		if closeErr.Code != websocket.CloseCodeUnauthorized {
+			t.Fatalf("attempt %d: close code = %d, want %d", i+1, closeErr.Code, websocket.CloseCodeUnauthorized)
+		}
+		if strings.Contains(closeErr.Text, "retry_after=") {
+			t.Fatalf("attempt %d: unexpected retry hint %q", i+1, closeErr.Text)
+		}
+	}
+
+	// После исчерпания лимита клиент получает код 4429 и подсказку, когда повторить попытку
+	closeErr, resp := dialRejected(t, server.URL)
+	if closeErr.Code != websocket.CloseCodeRateLimited {
+		t.Fatalf("close code = %d, want %d", closeErr.Code, websocket.CloseCodeRateLimited)
+	}
+	if !strings.Contains(closeErr.Text, "retry_after=") {
+		t.Fatalf("close reason %q has no retry hint", closeErr.Text)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatal("handshake response has no Retry-After")
+	}
+}
+
+func TestWebSocketAuthConcurrentFailures(t *testing.T) {
+	m := NewAuthMiddleware(nil, logger.New())
+	defer m.wsAuthFailures.Stop()
+	router := newWebSocketAuthRouter(m)
+
+	var mu sync.Mutex
+	unauthorized := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			req.RemoteAddr = "10.0.0.3:1000"
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code == http.StatusUnauthorized {
+				mu.Lock()
+				unauthorized++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Проверка и списание не атомарны вместе, поэтому параллельные запросы могут проскочить
+	// проверку, но после исчерпания бюджета IP остается заблокирован
+	if unauthorized < wsAuthFailureLimit {
+		t.Fatalf("only %d requests reached token validation", unauthorized)
+	}
+	if m.wsAuthFailures.RetryAfter("10.0.0.3") == 0 {
+		t.Fatal("IP is not blocked after concurrent failures")
+	}
+}
+
+func TestClientIPMiddlewareStoresIPInContext(t *testing.T) {
+	router := gin.New()
+	router.Use(ClientIPMiddleware())
+	var got string
+	router.GET("/login", func(c *gin.Context) {
+		got = usecase.ClientIPFromContext(c.Request.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/login", nil)
+	req.RemoteAddr = "198.51.100.4:5555"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "198.51.100.4" {
+		t.Fatalf("client IP in context = %q, want 198.51.100.4", got)
+	}
+}
+
+func TestRequireAdminAllowsOnlyConfiguredAdmins(t *testing.T) {
+	authUseCase := usecase.NewAuthUseCase(nil, nil, &config.JWTConfig{}, &config.KeysConfig{}, &config.AdminConfig{UserIDs: []uint{1}}, nil)
+	m := NewAuthMiddleware(authUseCase, logger.New())
+	defer m.wsAuthFailures.Stop()
+
+	tests := []struct {
+		name string
+		user interface{}
+		want int
+	}{
+		{"admin", &entities.User{ID: 1}, http.StatusOK},
+		{"regular user", &entities.User{ID: 2}, http.StatusForbidden},
+		{"unauthenticated", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		router := gin.New()
+		// Пользователя в контекст кладет RequireAuth, здесь он подставляется напрямую
+		router.Use(func(c *gin.Context) {
+			if tt.user != nil {
+				c.Set("user", tt.user)
+			}
+		})
+		router.GET("/admin/reports", m.RequireAdmin(), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/admin/reports", nil))
+		if recorder.Code != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, recorder.Code, tt.want)
+		}
+	}
+}
+
+// tokenSessions - единственная действующая сессия пользователя 1 для проверки токенов
+type tokenSessions struct {
+	repository.SessionRepository
+	token string
+}
+
+func (r *tokenSessions) GetByToken(ctx context.Context, token string) (*entities.Session, error) {
+	if token != r.token {
+		return nil, errors.New("record not found")
+	}
+	return &entities.Session{UserID: 1, Token: token, ExpiresAt: time.Now().Add(time.Hour), LastActivity: time.Now()}, nil
+}
+
+func (r *tokenSessions) UpdateActivity(ctx context.Context, token string, lastActivity time.Time) error {
+	return nil
+}
+
+type tokenUsers struct {
+	repository.UserRepository
+}
+
+func (r *tokenUsers) GetByID(ctx context.Context, id uint) (*entities.User, error) {
+	return &entities.User{ID: id, Username: "alice"}, nil
+}
+
+func TestWebSocketAuthAcceptsSubprotocolToken(t *testing.T) {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authUseCase := usecase.NewAuthUseCase(&tokenUsers{}, &tokenSessions{token: token}, &config.JWTConfig{Secret: "test-secret"}, &config.KeysConfig{}, &config.AdminConfig{}, nil)
+	m := NewAuthMiddleware(authUseCase, logger.New())
+	defer m.wsAuthFailures.Stop()
+
+	router := gin.New()
+	router.GET("/ws", m.WebSocketAuth(), func(c *gin.Context) {
+		if user, _ := c.Get("user"); user.(*entities.User).ID != 1 {
+			t.Errorf("user in context = %v, want 1", user)
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		subprotocol string
+		query       string
+		want        int
+	}{
+		{"subprotocol only", "bearer, " + token, "", http.StatusOK},
+		// Подпротокол предпочтительнее параметра token
+		{"subprotocol over query", "bearer, " + token, "?token=bogus", http.StatusOK},
+		{"invalid subprotocol token", "bearer, bogus", "?token=" + token, http.StatusUnauthorized},
+		{"query fallback", "", "?token=" + token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/ws"+tt.query, nil)
+		if tt.subprotocol != "" {
+			req.Header.Set("Sec-WebSocket-Protocol", tt.subprotocol)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.name, recorder.Code, tt.want)
+		}
+	}
+}
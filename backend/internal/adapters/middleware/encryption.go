@@ -2,7 +2,7 @@ package middleware
 
 import (
 	"bytes"
-	"crypto/rand"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"io"
@@ -10,24 +10,30 @@ import (
 	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/repository"
 	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/response"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// EncryptedHeader - заголовок, которым клиент помечает зашифрованное тело запроса; без него тело
+// передается обработчику как есть, даже если содержит поля data, iv и sessionId
+const EncryptedHeader = "X-Encrypted"
+
 // EncryptedRequest представляет зашифрованный запрос
 type EncryptedRequest struct {
-	Data      string `json:"data"`      
-	IV        string `json:"iv"`        
-	HMAC      string `json:"hmac"`      
-	SessionID string `json:"sessionId"` 
+	Data      string `json:"data"`
+	IV        string `json:"iv"`
+	HMAC      string `json:"hmac"`
+	SessionID string `json:"sessionId"`
 }
 
 // EncryptedResponse представляет зашифрованный ответ
 type EncryptedResponse struct {
-	Data string `json:"data"` 
-	IV   string `json:"iv"`  
-	HMAC string `json:"hmac"` 
+	Data string `json:"data"`
+	IV   string `json:"iv"`
+	HMAC string `json:"hmac"`
 }
 
 // SessionKeys хранит ключи шифрования для сессии
@@ -40,6 +46,10 @@ type EncryptionMiddleware struct {
 	sessionRepo repository.SessionRepository
 	logger      *logger.Logger
 	sessionKeys map[string]*SessionKeys
+	// validateSession проверяет срок действия и простой сессии перед расшифровкой запроса
+	validateSession func(ctx context.Context, sessionID string) error
+	// plaintextPaths - префиксы путей, которые обходят шифрование запросов и ответов
+	plaintextPaths []string
 }
 
 // NewEncryptionMiddleware создает новый middleware для шифрования
@@ -59,15 +69,54 @@ func (m *EncryptionMiddleware) SetSessionKeys(sessionID string, aesKey, hmacKey
 	}
 }
 
+// SetSessionValidator устанавливает проверку сессии, выполняемую для каждого зашифрованного запроса
+func (m *EncryptionMiddleware) SetSessionValidator(validate func(ctx context.Context, sessionID string) error) {
+	m.validateSession = validate
+}
+
+// SetPlaintextPaths устанавливает префиксы путей, которые обслуживаются без шифрования: служебные
+// маршруты вроде /health и /swagger не должны зависеть от сессии. Префикс совпадает с путем
+// целиком или с его начальными сегментами, поэтому "/health" не затрагивает "/healthcheck"
+func (m *EncryptionMiddleware) SetPlaintextPaths(paths ...string) {
+	m.plaintextPaths = nil
+	for _, path := range paths {
+		if path = strings.TrimSuffix(strings.TrimSpace(path), "/"); path != "" {
+			m.plaintextPaths = append(m.plaintextPaths, path)
+		}
+	}
+}
+
+// isPlaintextPath проверяет, обслуживается ли путь без шифрования
+func (m *EncryptionMiddleware) isPlaintextPath(path string) bool {
+	for _, prefix := range m.plaintextPaths {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // GetSessionKeys получает ключи шифрования для сессии
 func (m *EncryptionMiddleware) GetSessionKeys(sessionID string) (*SessionKeys, bool) {
 	keys, exists := m.sessionKeys[sessionID]
 	return keys, exists
 }
 
-// DecryptRequest middleware для расшифровки входящих запросов
+// isEncryptedRequest проверяет, пометил ли клиент тело запроса как зашифрованное заголовком EncryptedHeader
+func isEncryptedRequest(c *gin.Context) bool {
+	encrypted, _ := strconv.ParseBool(c.GetHeader(EncryptedHeader))
+	return encrypted
+}
+
+// DecryptRequest middleware для расшифровки входящих запросов. Расшифровываются только запросы
+// с заголовком X-Encrypted: true; тело такого запроса обязано быть EncryptedRequest
 func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if m.isPlaintextPath(c.Request.URL.Path) || !isEncryptedRequest(c) {
+			c.Next()
+			return
+		}
+
 		contentType := c.GetHeader("Content-Type")
 		if !strings.Contains(contentType, "application/json") {
 			c.Next()
@@ -77,8 +126,7 @@ func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			m.logger.Error("Failed to read request body", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
-			c.Abort()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Failed to read request body")
 			return
 		}
 
@@ -87,40 +135,44 @@ func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 			return
 		}
 
+		// Клиент явно заявил о шифровании, поэтому некорректное тело - ошибка, а не открытый текст
 		var encryptedReq EncryptedRequest
 		if err := json.Unmarshal(body, &encryptedReq); err != nil {
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-			c.Next()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid encrypted request")
 			return
 		}
 
 		if encryptedReq.Data == "" || encryptedReq.IV == "" || encryptedReq.SessionID == "" {
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-			c.Next()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Encrypted request requires data, iv and sessionId")
 			return
 		}
 
 		sessionKeys, exists := m.GetSessionKeys(encryptedReq.SessionID)
 		if !exists {
 			m.logger.Error("Session keys not found", "sessionID", encryptedReq.SessionID)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session keys not found"})
-			c.Abort()
+			response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "Session keys not found")
 			return
 		}
 
+		if m.validateSession != nil {
+			if err := m.validateSession(c.Request.Context(), encryptedReq.SessionID); err != nil {
+				m.logger.Error("Session rejected", "sessionID", encryptedReq.SessionID, "error", err)
+				response.Abort(c, http.StatusUnauthorized, response.CodeUnauthorized, "Session expired or inactive")
+				return
+			}
+		}
+
 		encryptedData, err := base64.StdEncoding.DecodeString(encryptedReq.Data)
 		if err != nil {
 			m.logger.Error("Failed to decode encrypted data", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid encrypted data"})
-			c.Abort()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid encrypted data")
 			return
 		}
 
 		iv, err := base64.StdEncoding.DecodeString(encryptedReq.IV)
 		if err != nil {
 			m.logger.Error("Failed to decode IV", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IV"})
-			c.Abort()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid IV")
 			return
 		}
 
@@ -128,16 +180,14 @@ func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 			providedHMAC, err := base64.StdEncoding.DecodeString(encryptedReq.HMAC)
 			if err != nil {
 				m.logger.Error("Failed to decode HMAC", "error", err)
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid HMAC"})
-				c.Abort()
+				response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Invalid HMAC")
 				return
 			}
 
 			calculatedHMAC := crypto.GenerateHMAC(sessionKeys.HMACKey, encryptedData)
 			if !crypto.VerifyHMAC(sessionKeys.HMACKey, encryptedData, providedHMAC) {
 				m.logger.Error("HMAC verification failed")
-				c.JSON(http.StatusBadRequest, gin.H{"error": "HMAC verification failed"})
-				c.Abort()
+				response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "HMAC verification failed")
 				return
 			}
 
@@ -147,8 +197,7 @@ func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 		decryptedData, err := crypto.AESDecrypt(sessionKeys.AESKey, iv, encryptedData)
 		if err != nil {
 			m.logger.Error("Failed to decrypt request data", "error", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to decrypt request data"})
-			c.Abort()
+			response.Abort(c, http.StatusBadRequest, response.CodeBadRequest, "Failed to decrypt request data")
 			return
 		}
 
@@ -162,9 +211,18 @@ func (m *EncryptionMiddleware) DecryptRequest() gin.HandlerFunc {
 	}
 }
 
-// EncryptResponse middleware для шифрования исходящих ответов
-func (m *EncryptionMiddleware) EncryptResponse() gin.HandlerFunc {
+// EncryptResponse middleware для шифрования исходящих ответов. Ответы маршрутов из streamingRoutes
+// отдаются потоком и не шифруются: шифрование требует буферизации всего тела. Ответы путей,
+// заданных SetPlaintextPaths, также отдаются открытым текстом
+func (m *EncryptionMiddleware) EncryptResponse(streamingRoutes ...string) gin.HandlerFunc {
+	streaming := routeSet(streamingRoutes)
+
 	return func(c *gin.Context) {
+		if streaming[c.FullPath()] || m.isPlaintextPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
 		responseWriter := &responseWriterWrapper{
 			ResponseWriter: c.Writer,
 			body:           bytes.NewBuffer(nil),
@@ -210,14 +268,7 @@ func (w *responseWriterWrapper) encryptAndWrite() {
 		return
 	}
 
-	iv := make([]byte, 16)
-	if _, err := rand.Read(iv); err != nil {
-		w.middleware.logger.Error("Failed to generate IV", "error", err)
-		w.ResponseWriter.Write(w.body.Bytes())
-		return
-	}
-
-	encryptedData, err := crypto.AESEncrypt(sessionKeys.AESKey, iv, w.body.Bytes())
+	iv, encryptedData, err := crypto.AESEncryptWithFreshIV(sessionKeys.AESKey, w.body.Bytes())
 	if err != nil {
 		w.middleware.logger.Error("Failed to encrypt response", "error", err)
 		w.ResponseWriter.Write(w.body.Bytes())
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/pkg/logger"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEncryptResponseSkipsPlaintextPaths(t *testing.T) {
+	aesKey := bytes.Repeat([]byte{1}, 32)
+	hmacKey := bytes.Repeat([]byte{2}, 32)
+
+	m := NewEncryptionMiddleware(nil, logger.New())
+	m.SetSessionKeys("s1", aesKey, hmacKey)
+	m.SetPlaintextPaths("/health", "/swagger/")
+
+	router := gin.New()
+	// активная сессия: ответы на остальные пути должны шифроваться ее ключами
+	router.Use(func(c *gin.Context) { c.Set("sessionID", "s1") })
+	router.Use(m.DecryptRequest(), m.EncryptResponse())
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) }
+	router.GET("/health", ok)
+	router.GET("/swagger/index.html", ok)
+	router.GET("/healthcheck", ok)
+	router.GET("/api/v1/ping", ok)
+
+	tests := []struct {
+		path      string
+		encrypted bool
+	}{
+		{"/health", false},
+		{"/swagger/index.html", false},
+		{"/healthcheck", true},
+		{"/api/v1/ping", true},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d", tt.path, w.Code, http.StatusOK)
+		}
+
+		body := w.Body.Bytes()
+		if !tt.encrypted {
+			if string(body) != `{"status":"ok"}` {
+				t.Fatalf("%s: body = %s, want plaintext JSON", tt.path, body)
+			}
+			continue
+		}
+
+		var resp EncryptedResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("%s: decode encrypted response: %v", tt.path, err)
+		}
+		data, _ := base64.StdEncoding.DecodeString(resp.Data)
+		iv, _ := base64.StdEncoding.DecodeString(resp.IV)
+		mac, _ := base64.StdEncoding.DecodeString(resp.HMAC)
+		if !crypto.VerifyHMAC(hmacKey, data, mac) {
+			t.Fatalf("%s: HMAC verification failed", tt.path)
+		}
+		plain, err := crypto.AESDecrypt(aesKey, iv, data)
+		if err != nil {
+			t.Fatalf("%s: decrypt response: %v", tt.path, err)
+		}
+		if string(plain) != `{"status":"ok"}` {
+			t.Fatalf("%s: decrypted body = %s, want %s", tt.path, plain, `{"status":"ok"}`)
+		}
+	}
+}
+
+func TestDecryptRequestOnlyWhenMarked(t *testing.T) {
+	aesKey := bytes.Repeat([]byte{1}, 32)
+	hmacKey := bytes.Repeat([]byte{2}, 32)
+
+	m := NewEncryptionMiddleware(nil, logger.New())
+	m.SetSessionKeys("s1", aesKey, hmacKey)
+
+	var gotBody string
+	var gotSession bool
+	router := gin.New()
+	router.Use(m.DecryptRequest())
+	router.POST("/api/v1/profile", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		gotBody = string(body)
+		_, gotSession = c.Get("sessionID")
+		c.Status(http.StatusOK)
+	})
+
+	post := func(body string, encrypted bool) int {
+		gotBody, gotSession = "", false
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/profile", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if encrypted {
+			req.Header.Set(EncryptedHeader, "true")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Открытое тело с полями data, iv и sessionId без заголовка передается обработчику как есть
+	plain := `{"data":"not base64","iv":"also not","sessionId":"s1","hmac":"x"}`
+	if code := post(plain, false); code != http.StatusOK {
+		t.Fatalf("plaintext: status = %d, want %d", code, http.StatusOK)
+	}
+	if gotBody != plain || gotSession {
+		t.Fatalf("plaintext body = %q (session %v), want it untouched", gotBody, gotSession)
+	}
+
+	// С заголовком то же тело считается зашифрованным и отклоняется
+	if code := post(plain, true); code != http.StatusBadRequest {
+		t.Fatalf("marked invalid body: status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	iv, ciphertext, err := crypto.AESEncryptWithFreshIV(aesKey, []byte(`{"name":"alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, _ := json.Marshal(EncryptedRequest{
+		Data:      base64.StdEncoding.EncodeToString(ciphertext),
+		IV:        base64.StdEncoding.EncodeToString(iv),
+		HMAC:      base64.StdEncoding.EncodeToString(crypto.GenerateHMAC(hmacKey, ciphertext)),
+		SessionID: "s1",
+	})
+	if code := post(string(encrypted), true); code != http.StatusOK {
+		t.Fatalf("marked encrypted body: status = %d, want %d", code, http.StatusOK)
+	}
+	if gotBody != `{"name":"alice"}` || !gotSession {
+		t.Fatalf("decrypted body = %q (session %v), want {\"name\":\"alice\"}", gotBody, gotSession)
+	}
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sleek-chat-backend/pkg/response"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutMiddleware - ограничивает время обработки запроса: контекст запроса получает дедлайн,
+// поэтому запросы к БД прерываются, а при его истечении клиент сразу получает 503, даже если
+// обработчик не проверяет контекст. Обработчик выполняется в отдельной горутине и пишет в буфер;
+// после ответа 503 его запись отклоняется. WebSocket рукопожатия и потоковые маршруты из
+// streamingRoutes не ограничиваются; timeout <= 0 отключает проверку
+func TimeoutMiddleware(timeout time.Duration, streamingRoutes ...string) gin.HandlerFunc {
+	streaming := routeSet(streamingRoutes)
+
+	return func(c *gin.Context) {
+		if timeout <= 0 || strings.EqualFold(c.GetHeader("Upgrade"), "websocket") || streaming[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		original := c.Writer
+		buffered := newTimeoutWriter(original)
+		c.Writer = buffered
+
+		done := make(chan struct{})
+		var panicValue interface{}
+		go func() {
+			defer close(done)
+			defer buffered.finish()
+			defer func() { panicValue = recover() }()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			// Ответ 503 пишется напрямую в исходный writer, а не через контекст gin, которым
+			// еще пользуется горутина обработчика
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && buffered.timeOut() {
+				writeTimeoutResponse(original)
+			}
+			// Контекст gin возвращается в пул после выхода из middleware, поэтому
+			// горутина обработчика должна завершиться раньше; клиент ответ уже получил
+			<-done
+		}
+
+		c.Writer = original
+		if panicValue != nil {
+			panic(panicValue)
+		}
+		if buffered.hasTimedOut() {
+			return
+		}
+
+		// Ответ, собранный после истечения дедлайна, отбрасывается: обработчик мог вернуть
+		// ошибку отмененного запроса к БД вместо настоящего результата
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			writeTimeoutResponse(original)
+			return
+		}
+
+		buffered.flushTo(original)
+	}
+}
+
+// writeTimeoutResponse - отправляет клиенту 503 в едином формате ответа API
+func writeTimeoutResponse(w gin.ResponseWriter) {
+	body, _ := json.Marshal(response.Envelope{
+		Success: false,
+		Error:   &response.ErrorBody{Code: response.CodeUnavailable, Message: "Request timed out"},
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(body)
+	w.Flush()
+}
+
+// routeSet - строит множество шаблонов маршрутов для сравнения с gin.Context.FullPath
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		set[route] = true
+	}
+	return set
+}
+
+// timeoutWriter - буферизует статус, заголовки и тело ответа обработчика до его завершения.
+// Исходный writer из горутины обработчика не используется, поэтому после ответа 503 поздний
+// обработчик не может ничего в него записать
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	written  bool
+	finished bool
+	timedOut bool
+}
+
+func newTimeoutWriter(original gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{
+		ResponseWriter: original,
+		header:         original.Header().Clone(),
+		status:         http.StatusOK,
+	}
+}
+
+// finish - отмечает, что обработчик завершился и его ответ можно отправить
+func (w *timeoutWriter) finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.finished = true
+}
+
+// timeOut - закрывает буфер для записи, если обработчик еще не завершился; возвращает false,
+// если обработчик успел закончить и его ответ должен быть отправлен как обычно
+func (w *timeoutWriter) timeOut() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.finished {
+		return false
+	}
+	w.timedOut = true
+	return true
+}
+
+func (w *timeoutWriter) hasTimedOut() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.timedOut
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut || w.written {
+		return
+	}
+	w.status = code
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.written = true
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.written
+}
+
+// Flush - буферизованный ответ отправляется целиком после завершения обработчика
+func (w *timeoutWriter) Flush() {}
+
+func (w *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("timeout writer does not support hijacking")
+}
+
+// flushTo - передает исходному writer буферизованные статус, заголовки и тело
+func (w *timeoutWriter) flushTo(original gin.ResponseWriter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	target := original.Header()
+	for key := range target {
+		if _, ok := w.header[key]; !ok {
+			target.Del(key)
+		}
+	}
+	for key, values := range w.header {
+		target[key] = values
+	}
+	if !w.written {
+		if w.status != http.StatusOK {
+			original.WriteHeader(w.status)
+		}
+		return
+	}
+	original.WriteHeader(w.status)
+	original.Write(w.body.Bytes())
+}
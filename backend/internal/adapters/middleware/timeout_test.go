@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// signalingRecorder - записывает ответ под мьютексом и сообщает о первой записи тела,
+// чтобы тест мог проверить, что 503 ушел клиенту раньше, чем завершился обработчик
+type signalingRecorder struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	once    sync.Once
+	written chan struct{}
+}
+
+func newSignalingRecorder() *signalingRecorder {
+	return &signalingRecorder{ResponseRecorder: httptest.NewRecorder(), written: make(chan struct{})}
+}
+
+func (r *signalingRecorder) WriteHeader(code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+func (r *signalingRecorder) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.once.Do(func() { close(r.written) })
+	return r.ResponseRecorder.Write(data)
+}
+
+func (r *signalingRecorder) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ResponseRecorder.Flush()
+}
+
+func newTimeoutRouter(timeout time.Duration, streamingRoutes ...string) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(TimeoutMiddleware(timeout, streamingRoutes...))
+	return router
+}
+
+func assertTimeoutResponse(t *testing.T, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+	var body struct {
+		Success bool `json:"success"`
+		Error   struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON %q: %v", recorder.Body.String(), err)
+	}
+	if body.Success || body.Error.Code != "SERVICE_UNAVAILABLE" {
+		t.Fatalf("body = %s", recorder.Body.String())
+	}
+}
+
+func TestTimeoutMiddlewarePassesFastResponse(t *testing.T) {
+	router := newTimeoutRouter(time.Second)
+	router.GET("/fast", func(c *gin.Context) {
+		c.Header("X-Handler", "yes")
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/fast", nil))
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusCreated)
+	}
+	if recorder.Header().Get("X-Handler") != "yes" {
+		t.Fatal("handler header was lost")
+	}
+	if got := recorder.Body.String(); got != `{"ok":true}` {
+		t.Fatalf("body = %s", got)
+	}
+}
+
+func TestTimeoutMiddlewareRespondsBeforeSlowHandlerReturns(t *testing.T) {
+	recorder := newSignalingRecorder()
+	lateWrite := make(chan error, 1)
+
+	router := newTimeoutRouter(20 * time.Millisecond)
+	router.GET("/slow", func(c *gin.Context) {
+		// Обработчик не проверяет контекст; ответ 503 должен уйти, пока он еще работает
+		select {
+		case <-recorder.written:
+		case <-time.After(time.Second):
+			lateWrite <- errors.New("503 was not sent while the handler was running")
+			return
+		}
+		_, err := c.Writer.Write([]byte("late"))
+		lateWrite <- err
+	})
+
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	if err := <-lateWrite; !errors.Is(err, http.ErrHandlerTimeout) {
+		t.Fatalf("late write error = %v, want %v", err, http.ErrHandlerTimeout)
+	}
+	assertTimeoutResponse(t, recorder.ResponseRecorder)
+	if strings.Contains(recorder.Body.String(), "late") {
+		t.Fatalf("late handler output reached the client: %s", recorder.Body.String())
+	}
+}
+
+func TestTimeoutMiddlewareDiscardsCanceledHandlerError(t *testing.T) {
+	router := newTimeoutRouter(20 * time.Millisecond)
+	router.GET("/db", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": c.Request.Context().Err().Error()})
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/db", nil))
+
+	assertTimeoutResponse(t, recorder)
+}
+
+func TestTimeoutMiddlewarePropagatesPanic(t *testing.T) {
+	router := newTimeoutRouter(time.Second)
+	router.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestTimeoutMiddlewareSkipsStreamingRoutes(t *testing.T) {
+	router := newTimeoutRouter(10*time.Millisecond, "/stream")
+	router.GET("/stream", func(c *gin.Context) {
+		time.Sleep(30 * time.Millisecond)
+		c.String(http.StatusOK, "streamed")
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "streamed" {
+		t.Fatalf("streaming route = %d %q", recorder.Code, recorder.Body.String())
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"time"
 )
 
-// AESEncrypt - шифрует данные с использованием алгоритма AES-256-CBC
-func AESEncrypt(key, iv, plaintext []byte) ([]byte, error) {
+// aesEncryptCBC - шифрует данные с использованием алгоритма AES-256-CBC с заданным вектором
+// инициализации. Не экспортируется: IV от вызывающего кода допустим только внутри пакета, где он
+// либо генерируется заново (AESEncryptWithFreshIV), либо выводится из одноразового ключа храповика
+func aesEncryptCBC(key, iv, plaintext []byte) ([]byte, error) {
 	start := time.Now()
 	defer func() {
 		encryptionTime := time.Since(start)
@@ -21,6 +23,10 @@ func AESEncrypt(key, iv, plaintext []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("IV length must equal the block size")
+	}
+
 	plaintext = pkcs7Pad(plaintext, aes.BlockSize)
 
 	ciphertext := make([]byte, len(plaintext))
@@ -87,3 +93,60 @@ func GenerateIV() ([]byte, error) {
 	}
 	return iv, nil
 }
+
+// AESGCMEncrypt - шифрует данные AES-256-GCM со случайным nonce и возвращает его вместе
+// с шифротекстом, к которому GCM добавляет тег аутентификации
+func AESGCMEncrypt(key, plaintext []byte) (nonce, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// AESGCMDecrypt - расшифровывает данные AES-256-GCM и проверяет тег аутентификации
+func AESGCMDecrypt(key, nonce, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("nonce length must equal the GCM nonce size")
+	}
+
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// AESEncryptWithFreshIV - шифрует данные AES-256-CBC со случайным вектором инициализации,
+// сгенерированным внутри функции, и возвращает его вместе с шифротекстом. Повтор IV с тем же
+// ключом в режиме CBC раскрывает совпадающие префиксы открытых текстов, поэтому IV от вызывающего
+// кода здесь не принимается
+func AESEncryptWithFreshIV(key, plaintext []byte) (iv, ciphertext []byte, err error) {
+	iv, err = GenerateIV()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ciphertext, err = aesEncryptCBC(key, iv, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return iv, ciphertext, nil
+}
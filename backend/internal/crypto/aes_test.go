@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Вектор NIST SP 800-38A, F.2.5 (CBC-AES256.Encrypt), первый блок; aesEncryptCBC дописывает
+// блок дополнения PKCS#7, поэтому сравнивается только начало шифротекста
+func TestAESEncryptCBCVector(t *testing.T) {
+	key := mustHex(t, "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4")
+	iv := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	plaintext := mustHex(t, "6bc1bee22e409f96e93d7e117393172a")
+
+	ciphertext, err := aesEncryptCBC(key, iv, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != 32 {
+		t.Fatalf("ciphertext length = %d, want 32", len(ciphertext))
+	}
+	if want := mustHex(t, "f58c4c04d6e5f1ba779eabfb5f7bfbd6"); !bytes.Equal(ciphertext[:16], want) {
+		t.Fatalf("first block = %x, want %x", ciphertext[:16], want)
+	}
+
+	decrypted, err := AESDecrypt(key, iv, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("decrypted = %x, want %x", decrypted, plaintext)
+	}
+}
+
+func TestAESEncryptCBCRejectsBadIV(t *testing.T) {
+	if _, err := aesEncryptCBC(make([]byte, AESKeySize), make([]byte, 8), []byte("data")); err == nil {
+		t.Fatal("short IV accepted")
+	}
+}
+
+func TestAESEncryptWithFreshIVNeverRepeatsIV(t *testing.T) {
+	key := bytes.Repeat([]byte{0x11}, AESKeySize)
+	plaintext := []byte("same plaintext every time")
+
+	seenIVs := make(map[string]bool)
+	seenCiphertexts := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		iv, ciphertext, err := AESEncryptWithFreshIV(key, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(iv) != 16 {
+			t.Fatalf("IV length = %d, want 16", len(iv))
+		}
+		if seenIVs[string(iv)] {
+			t.Fatalf("IV %x repeated at call %d", iv, i)
+		}
+		if seenCiphertexts[string(ciphertext)] {
+			t.Fatalf("ciphertext repeated at call %d", i)
+		}
+		seenIVs[string(iv)] = true
+		seenCiphertexts[string(ciphertext)] = true
+
+		decrypted, err := AESDecrypt(key, iv, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("decrypted = %q, want %q", decrypted, plaintext)
+		}
+	}
+}
+
+func TestAESGCMRoundTripAndTamper(t *testing.T) {
+	key := bytes.Repeat([]byte{0x22}, AESKeySize)
+
+	nonce, ciphertext, err := AESGCMEncrypt(key, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := AESGCMDecrypt(key, nonce, ciphertext)
+	if err != nil || string(plaintext) != "hello" {
+		t.Fatalf("AESGCMDecrypt = %q, %v", plaintext, err)
+	}
+
+	ciphertext[0] ^= 0xff
+	if _, err := AESGCMDecrypt(key, nonce, ciphertext); err == nil {
+		t.Fatal("tampered GCM ciphertext accepted")
+	}
+}
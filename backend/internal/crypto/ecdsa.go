@@ -9,11 +9,8 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io"
 	"math/big"
 	"time"
-
-	"golang.org/x/crypto/hkdf"
 )
 
 // GenerateECDSAKeys - генерирует пару ключей ECDSA (приватный и публичный)
@@ -69,6 +66,9 @@ func DeserializeECDSAPrivateKey(privateKeyPEM []byte) (*ecdsa.PrivateKey, error)
 	return privateKey, nil
 }
 
+// p256ScalarSize - длина r и s подписи P-256 в байтах; подпись хранится как r || s
+const p256ScalarSize = 32
+
 // SignECDSA - создает цифровую подпись данных с использованием ECDSA
 func SignECDSA(privateKey *ecdsa.PrivateKey, data []byte) ([]byte, error) {
 	if privateKey == nil {
@@ -87,8 +87,11 @@ func SignECDSA(privateKey *ecdsa.PrivateKey, data []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	// Сериализуем r и s в байты
-	signature := append(r.Bytes(), s.Bytes()...)
+	// Сериализуем r и s в байты фиксированной длины: big.Int.Bytes() отбрасывает ведущие нули,
+	// и подпись с коротким r или s не проходила бы проверку длины в VerifyECDSA
+	signature := make([]byte, 2*p256ScalarSize)
+	r.FillBytes(signature[:p256ScalarSize])
+	s.FillBytes(signature[p256ScalarSize:])
 	return signature, nil
 }
 
@@ -110,17 +113,53 @@ func VerifyECDSA(publicKeyBytes, data, signature []byte) (bool, error) {
 		return false, errors.New("invalid public key type")
 	}
 
-	if len(signature) != 64 {
+	if len(signature) != 2*p256ScalarSize {
 		return false, errors.New("invalid signature length")
 	}
 
-	r := new(big.Int).SetBytes(signature[:32])
-	s := new(big.Int).SetBytes(signature[32:])
+	r := new(big.Int).SetBytes(signature[:p256ScalarSize])
+	s := new(big.Int).SetBytes(signature[p256ScalarSize:])
 
 	hash := sha256.Sum256(data)
 	return ecdsa.Verify(publicKey, hash[:], r, s), nil
 }
 
+// ErrInvalidPublicKey - публичный ключ не является корректной точкой кривой P-256
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// ParseP256PublicKey - разбирает публичный ключ в формате PKIX и проверяет, что он задает допустимую точку P-256
+func ParseP256PublicKey(publicKeyBytes []byte) (*ecdsa.PublicKey, error) {
+	if len(publicKeyBytes) == 0 {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidPublicKey)
+	}
+
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	publicKey, ok := publicKeyInterface.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an EC key", ErrInvalidPublicKey)
+	}
+
+	if publicKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: unsupported curve %s", ErrInvalidPublicKey, publicKey.Curve.Params().Name)
+	}
+
+	if publicKey.X == nil || publicKey.Y == nil || (publicKey.X.Sign() == 0 && publicKey.Y.Sign() == 0) {
+		return nil, fmt.Errorf("%w: point at infinity", ErrInvalidPublicKey)
+	}
+
+	// Кофактор P-256 равен 1, поэтому точек малого порядка, кроме бесконечности, нет;
+	// crypto/ecdh дополнительно проверяет, что точка лежит на кривой
+	if _, err := publicKey.ECDH(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	return publicKey, nil
+}
+
 // ComputeECDHSharedSecret - вычисляет общий секретный ключ с использованием ECDH
 func ComputeECDHSharedSecret(privateKey *ecdsa.PrivateKey, peerPublicKeyBytes []byte) ([]byte, error) {
 	if privateKey == nil {
@@ -131,16 +170,11 @@ func ComputeECDHSharedSecret(privateKey *ecdsa.PrivateKey, peerPublicKeyBytes []
 		return nil, errors.New("peer public key cannot be empty")
 	}
 
-	publicKeyInterface, err := x509.ParsePKIXPublicKey(peerPublicKeyBytes)
+	publicKey, err := ParseP256PublicKey(peerPublicKeyBytes)
 	if err != nil {
 		return nil, err
 	}
 
-	publicKey, ok := publicKeyInterface.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, errors.New("invalid public key type")
-	}
-
 	if privateKey.D == nil {
 		return nil, errors.New("private key D component is nil")
 	}
@@ -151,12 +185,5 @@ func ComputeECDHSharedSecret(privateKey *ecdsa.PrivateKey, peerPublicKeyBytes []
 	}
 
 	hash := sha256.Sum256(x.Bytes())
-	hkdf := hkdf.New(sha256.New, hash[:], nil, []byte("crypto-chat-shared-secret"))
-
-	expandedKey := make([]byte, 64)
-	if _, err := io.ReadFull(hkdf, expandedKey); err != nil {
-		return nil, fmt.Errorf("failed to expand shared secret: %v", err)
-	}
-
-	return expandedKey, nil
+	return DeriveKeys(hash[:], PurposeMessageKeys)
 }
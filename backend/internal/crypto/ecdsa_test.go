@@ -0,0 +1,50 @@
+package crypto
+
+import "testing"
+
+func TestECDSASignatureWithShortScalarVerifies(t *testing.T) {
+	privateKey, publicKey, err := GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("message with a short scalar")
+
+	// Примерно каждая 128-я подпись имеет r или s с нулевым старшим байтом; ищем такую
+	for i := 0; i < 20000; i++ {
+		signature, err := SignECDSA(privateKey, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signature) != 2*p256ScalarSize {
+			t.Fatalf("signature length = %d, want %d", len(signature), 2*p256ScalarSize)
+		}
+		if signature[0] != 0 && signature[p256ScalarSize] != 0 {
+			continue
+		}
+
+		valid, err := VerifyECDSA(publicKey, data, signature)
+		if err != nil || !valid {
+			t.Fatalf("signature with short r/s after %d attempts: valid = %v, err = %v", i+1, valid, err)
+		}
+		return
+	}
+	t.Fatal("no signature with a short r or s produced")
+}
+
+func TestVerifyECDSARejectsTamperedData(t *testing.T) {
+	privateKey, publicKey, err := GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignECDSA(privateKey, []byte("original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if valid, err := VerifyECDSA(publicKey, []byte("tampered"), signature); err != nil || valid {
+		t.Fatalf("tampered data: valid = %v, err = %v", valid, err)
+	}
+	if _, err := VerifyECDSA(publicKey, []byte("original"), signature[1:]); err == nil {
+		t.Fatal("truncated signature accepted")
+	}
+}
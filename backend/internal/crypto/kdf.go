@@ -0,0 +1,50 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyPurpose - метка назначения ключей, передаваемая в HKDF как info; разные назначения дают
+// независимые ключи даже из одного и того же секрета
+type KeyPurpose string
+
+const (
+	// PurposeMessageKeys - ключи шифрования сообщений из общего секрета ECDH P-256
+	PurposeMessageKeys KeyPurpose = "crypto-chat-shared-secret"
+	// PurposeX25519MessageKeys - ключи из общего секрета X25519
+	PurposeX25519MessageKeys KeyPurpose = "crypto-chat-x25519-shared-secret"
+	// PurposeSessionKeys - ключи транспортного шифрования сессии после обмена ключами
+	PurposeSessionKeys KeyPurpose = "sleek-chat-session-keys"
+)
+
+// DerivedKeySize - длина выводимого материала: 32 байта ключа AES-256 и 32 байта ключа HMAC-SHA256
+const DerivedKeySize = 64
+
+// DeriveKeys - выводит материал ключей AES+HMAC из секрета для указанного назначения
+func DeriveKeys(secret []byte, purpose KeyPurpose) ([]byte, error) {
+	return DeriveSaltedKeys(secret, nil, purpose)
+}
+
+// DeriveSaltedKeys - выводит материал ключей AES+HMAC из секрета и соли для указанного назначения
+func DeriveSaltedKeys(secret, salt []byte, purpose KeyPurpose) ([]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("secret cannot be empty")
+	}
+	if purpose == "" {
+		return nil, errors.New("key purpose cannot be empty")
+	}
+
+	reader := hkdf.New(sha256.New, secret, salt, []byte(purpose))
+
+	keys := make([]byte, DerivedKeySize)
+	if _, err := io.ReadFull(reader, keys); err != nil {
+		return nil, fmt.Errorf("failed to derive keys: %v", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+func TestDeriveKeysSeparatesPurposes(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x5a}, 32)
+	salt := []byte("session-salt")
+	purposes := []KeyPurpose{PurposeMessageKeys, PurposeX25519MessageKeys, PurposeSessionKeys}
+
+	seen := make(map[string]KeyPurpose)
+	for _, purpose := range purposes {
+		for _, derive := range []func() ([]byte, error){
+			func() ([]byte, error) { return DeriveKeys(secret, purpose) },
+			func() ([]byte, error) { return DeriveSaltedKeys(secret, salt, purpose) },
+		} {
+			keys, err := derive()
+			if err != nil {
+				t.Fatalf("%s: %v", purpose, err)
+			}
+			if len(keys) != DerivedKeySize {
+				t.Fatalf("%s: %d bytes, want %d", purpose, len(keys), DerivedKeySize)
+			}
+			// Ни ключ AES, ни ключ HMAC не совпадают между назначениями
+			for _, half := range [][]byte{keys[:32], keys[32:]} {
+				if other, ok := seen[string(half)]; ok {
+					t.Fatalf("%s and %s produced the same key", purpose, other)
+				}
+				seen[string(half)] = purpose
+			}
+		}
+	}
+}
+
+func TestDeriveKeysIsDeterministic(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x11}, 32)
+
+	first, err := DeriveKeys(secret, PurposeSessionKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := DeriveKeys(secret, PurposeSessionKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("same secret and purpose produced different keys")
+	}
+
+	// Метки назначения совпадают с прежними значениями info, поэтому сохраненные сообщения расшифровываются
+	want := make([]byte, DerivedKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("sleek-chat-session-keys")), want); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, want) {
+		t.Fatalf("keys = %x, want %x", first, want)
+	}
+}
+
+func TestDeriveKeysRejectsEmptyInput(t *testing.T) {
+	if _, err := DeriveKeys(nil, PurposeMessageKeys); err == nil {
+		t.Fatal("empty secret accepted")
+	}
+	if _, err := DeriveKeys([]byte("secret"), ""); err == nil {
+		t.Fatal("empty purpose accepted")
+	}
+}
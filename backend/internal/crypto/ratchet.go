@@ -0,0 +1,409 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	EncryptionSchemeStatic        = "static"
+	EncryptionSchemeDoubleRatchet = "double_ratchet"
+
+	// MaxSkippedMessageKeys - максимальное число ключей, сохраняемых для сообщений, пришедших не по порядку
+	MaxSkippedMessageKeys = 1000
+)
+
+var (
+	ErrRatchetNotInitialized = errors.New("ratchet sending chain is not initialized")
+	ErrTooManySkippedKeys    = errors.New("too many skipped ratchet messages")
+	ErrRatchetAuthFailed     = errors.New("ratchet message authentication failed")
+)
+
+// supportedEncryptionSchemes - схемы шифрования, которые сервер поддерживает при отправке и приеме,
+// в порядке предпочтения. В чате с Double Ratchet храповик ведут клиенты, сервер принимает только
+// зашифрованные на клиенте сообщения и хранит их заголовки для получателя
+var supportedEncryptionSchemes = []string{EncryptionSchemeDoubleRatchet, EncryptionSchemeStatic}
+
+// NegotiateEncryptionScheme - выбирает схему шифрования из предложенных клиентом,
+// при отсутствии общих схем возвращает статическую схему
+func NegotiateEncryptionScheme(offered []string) string {
+	for _, scheme := range supportedEncryptionSchemes {
+		for _, candidate := range offered {
+			if candidate == scheme {
+				return scheme
+			}
+		}
+	}
+	return EncryptionSchemeStatic
+}
+
+// RatchetHeader - открытый заголовок сообщения Double Ratchet: публичный ключ храповика
+// отправителя в hex, длина предыдущей цепочки отправки и номер сообщения в текущей
+type RatchetHeader struct {
+	PublicKey    string `json:"public_key"`
+	PrevChainLen uint32 `json:"pn"`
+	MessageNum   uint32 `json:"n"`
+}
+
+// RatchetMessage - сообщение Double Ratchet; бинарные поля передаются в hex
+type RatchetMessage struct {
+	Header     RatchetHeader `json:"header"`
+	IV         string        `json:"iv"`
+	Ciphertext string        `json:"ciphertext"`
+	HMAC       string        `json:"hmac"`
+}
+
+// ValidateRatchetHeader - проверяет заголовок, который сервер сохраняет вместе с сообщением:
+// ключ храповика должен быть точкой P-256, иначе получатель не сможет выполнить DH-шаг
+func ValidateRatchetHeader(h RatchetHeader) error {
+	publicKey, err := hex.DecodeString(h.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid ratchet public key encoding: %v", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(publicKey); err != nil {
+		return fmt.Errorf("invalid ratchet public key: %v", err)
+	}
+	return nil
+}
+
+type skippedKey struct {
+	publicKey  string
+	messageNum uint32
+}
+
+// Ratchet - реализация Double Ratchet: DH-храповик на P-256 и симметричные цепочки отправки и приема
+type Ratchet struct {
+	mu sync.Mutex
+
+	dhSelf   *ecdh.PrivateKey
+	dhRemote *ecdh.PublicKey
+
+	rootKey   []byte
+	sendChain []byte
+	recvChain []byte
+
+	sendN     uint32
+	recvN     uint32
+	prevSendN uint32
+
+	skipped map[skippedKey][]byte
+}
+
+// GenerateRatchetKeyPair - генерирует пару ключей P-256 для DH-храповика
+func GenerateRatchetKeyPair() (*ecdh.PrivateKey, error) {
+	return ecdh.P256().GenerateKey(rand.Reader)
+}
+
+// NewRatchetInitiator - создает храповик для стороны, начинающей переписку и знающей ключ собеседника
+func NewRatchetInitiator(sharedSecret, remotePublicKey []byte) (*Ratchet, error) {
+	remote, err := ecdh.P256().NewPublicKey(remotePublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote ratchet public key: %v", err)
+	}
+
+	dhSelf, err := GenerateRatchetKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	dhOut, err := dhSelf.ECDH(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	rootKey, sendChain, err := kdfRootKey(sharedSecret, dhOut)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ratchet{
+		dhSelf:    dhSelf,
+		dhRemote:  remote,
+		rootKey:   rootKey,
+		sendChain: sendChain,
+		skipped:   make(map[skippedKey][]byte),
+	}, nil
+}
+
+// NewRatchetResponder - создает храповик для стороны, опубликовавшей свою пару ключей
+func NewRatchetResponder(sharedSecret []byte, keyPair *ecdh.PrivateKey) *Ratchet {
+	return &Ratchet{
+		dhSelf:  keyPair,
+		rootKey: append([]byte(nil), sharedSecret...),
+		skipped: make(map[skippedKey][]byte),
+	}
+}
+
+// Encrypt - шифрует сообщение очередным ключом цепочки отправки
+func (r *Ratchet) Encrypt(plaintext []byte) (*RatchetMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sendChain == nil {
+		return nil, ErrRatchetNotInitialized
+	}
+
+	var messageKey []byte
+	r.sendChain, messageKey = kdfChainKey(r.sendChain)
+
+	header := RatchetHeader{
+		PublicKey:    hex.EncodeToString(r.dhSelf.PublicKey().Bytes()),
+		PrevChainLen: r.prevSendN,
+		MessageNum:   r.sendN,
+	}
+	r.sendN++
+
+	return sealRatchetMessage(messageKey, header, plaintext)
+}
+
+// Decrypt - расшифровывает сообщение, при необходимости продвигая DH-храповик
+// и сохраняя ключи пропущенных сообщений для доставки не по порядку
+func (r *Ratchet) Decrypt(msg *RatchetMessage) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := skippedKey{publicKey: msg.Header.PublicKey, messageNum: msg.Header.MessageNum}
+	if messageKey, ok := r.skipped[key]; ok {
+		plaintext, err := openRatchetMessage(messageKey, msg)
+		if err != nil {
+			return nil, err
+		}
+		delete(r.skipped, key)
+		return plaintext, nil
+	}
+
+	snapshot := r.snapshot()
+
+	plaintext, err := r.decryptInOrder(msg)
+	if err != nil {
+		r.restore(snapshot)
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// decryptInOrder - выполняет шаги храповика для сообщения, которого нет среди пропущенных
+func (r *Ratchet) decryptInOrder(msg *RatchetMessage) ([]byte, error) {
+	remoteBytes, err := hex.DecodeString(msg.Header.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ratchet header public key: %v", err)
+	}
+
+	if r.dhRemote == nil || !bytes.Equal(remoteBytes, r.dhRemote.Bytes()) {
+		if err := r.skipMessageKeys(msg.Header.PrevChainLen); err != nil {
+			return nil, err
+		}
+		if err := r.dhRatchet(remoteBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := r.skipMessageKeys(msg.Header.MessageNum); err != nil {
+		return nil, err
+	}
+
+	var messageKey []byte
+	r.recvChain, messageKey = kdfChainKey(r.recvChain)
+	r.recvN++
+
+	return openRatchetMessage(messageKey, msg)
+}
+
+// skipMessageKeys - вычисляет и сохраняет ключи сообщений цепочки приема до номера until
+func (r *Ratchet) skipMessageKeys(until uint32) error {
+	if r.recvChain == nil {
+		return nil
+	}
+
+	if until > r.recvN+MaxSkippedMessageKeys || len(r.skipped)+int(until-min(until, r.recvN)) > MaxSkippedMessageKeys {
+		return ErrTooManySkippedKeys
+	}
+
+	remote := hex.EncodeToString(r.dhRemote.Bytes())
+	for r.recvN < until {
+		var messageKey []byte
+		r.recvChain, messageKey = kdfChainKey(r.recvChain)
+		r.skipped[skippedKey{publicKey: remote, messageNum: r.recvN}] = messageKey
+		r.recvN++
+	}
+
+	return nil
+}
+
+// dhRatchet - выполняет шаг DH-храповика при получении нового публичного ключа собеседника
+func (r *Ratchet) dhRatchet(remotePublicKey []byte) error {
+	remote, err := ecdh.P256().NewPublicKey(remotePublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid ratchet header public key: %v", err)
+	}
+
+	r.prevSendN = r.sendN
+	r.sendN = 0
+	r.recvN = 0
+	r.dhRemote = remote
+
+	dhOut, err := r.dhSelf.ECDH(remote)
+	if err != nil {
+		return err
+	}
+	r.rootKey, r.recvChain, err = kdfRootKey(r.rootKey, dhOut)
+	if err != nil {
+		return err
+	}
+
+	r.dhSelf, err = GenerateRatchetKeyPair()
+	if err != nil {
+		return err
+	}
+
+	dhOut, err = r.dhSelf.ECDH(remote)
+	if err != nil {
+		return err
+	}
+	r.rootKey, r.sendChain, err = kdfRootKey(r.rootKey, dhOut)
+	return err
+}
+
+type ratchetState struct {
+	dhSelf    *ecdh.PrivateKey
+	dhRemote  *ecdh.PublicKey
+	rootKey   []byte
+	sendChain []byte
+	recvChain []byte
+	sendN     uint32
+	recvN     uint32
+	prevSendN uint32
+	skipped   map[skippedKey][]byte
+}
+
+// snapshot - сохраняет состояние храповика, чтобы откатить его при ошибке расшифровки
+func (r *Ratchet) snapshot() ratchetState {
+	skipped := make(map[skippedKey][]byte, len(r.skipped))
+	for k, v := range r.skipped {
+		skipped[k] = v
+	}
+
+	return ratchetState{
+		dhSelf:    r.dhSelf,
+		dhRemote:  r.dhRemote,
+		rootKey:   r.rootKey,
+		sendChain: r.sendChain,
+		recvChain: r.recvChain,
+		sendN:     r.sendN,
+		recvN:     r.recvN,
+		prevSendN: r.prevSendN,
+		skipped:   skipped,
+	}
+}
+
+// restore - восстанавливает ранее сохраненное состояние храповика
+func (r *Ratchet) restore(state ratchetState) {
+	r.dhSelf = state.dhSelf
+	r.dhRemote = state.dhRemote
+	r.rootKey = state.rootKey
+	r.sendChain = state.sendChain
+	r.recvChain = state.recvChain
+	r.sendN = state.sendN
+	r.recvN = state.recvN
+	r.prevSendN = state.prevSendN
+	r.skipped = state.skipped
+}
+
+// kdfRootKey - выводит новый корневой ключ и ключ цепочки из результата DH
+func kdfRootKey(rootKey, dhOut []byte) ([]byte, []byte, error) {
+	reader := hkdf.New(sha256.New, dhOut, rootKey, []byte("sleek-chat-ratchet-root"))
+
+	keys := make([]byte, 64)
+	if _, err := io.ReadFull(reader, keys); err != nil {
+		return nil, nil, err
+	}
+
+	return keys[:32], keys[32:], nil
+}
+
+// kdfChainKey - продвигает симметричную цепочку и возвращает ключ сообщения
+func kdfChainKey(chainKey []byte) ([]byte, []byte) {
+	messageKey := GenerateHMAC(chainKey, []byte{0x01})
+	nextChainKey := GenerateHMAC(chainKey, []byte{0x02})
+	return nextChainKey, messageKey
+}
+
+// deriveMessageKeys - разворачивает ключ сообщения в ключ AES, ключ HMAC и IV
+func deriveMessageKeys(messageKey []byte) ([]byte, []byte, []byte, error) {
+	reader := hkdf.New(sha256.New, messageKey, nil, []byte("sleek-chat-ratchet-message"))
+
+	keys := make([]byte, AESKeySize+HMACKeySize+16)
+	if _, err := io.ReadFull(reader, keys); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return keys[:AESKeySize], keys[AESKeySize : AESKeySize+HMACKeySize], keys[AESKeySize+HMACKeySize:], nil
+}
+
+// encode - сериализует заголовок для использования в качестве связанных данных HMAC
+func (h RatchetHeader) encode() []byte {
+	buf := make([]byte, 0, len(h.PublicKey)+8)
+	buf = append(buf, h.PublicKey...)
+	buf = binary.BigEndian.AppendUint32(buf, h.PrevChainLen)
+	buf = binary.BigEndian.AppendUint32(buf, h.MessageNum)
+	return buf
+}
+
+// sealRatchetMessage - шифрует сообщение ключом сообщения и подписывает заголовок и шифртекст
+func sealRatchetMessage(messageKey []byte, header RatchetHeader, plaintext []byte) (*RatchetMessage, error) {
+	aesKey, hmacKey, iv, err := deriveMessageKeys(messageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// IV выводится из ключа сообщения, который используется ровно один раз, поэтому не повторяется
+	ciphertext, err := aesEncryptCBC(aesKey, iv, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt ratchet message: %v", err)
+	}
+
+	mac := GenerateHMAC(hmacKey, append(header.encode(), ciphertext...))
+
+	return &RatchetMessage{
+		Header:     header,
+		IV:         hex.EncodeToString(iv),
+		Ciphertext: hex.EncodeToString(ciphertext),
+		HMAC:       hex.EncodeToString(mac),
+	}, nil
+}
+
+// openRatchetMessage - проверяет HMAC и расшифровывает сообщение ключом сообщения
+func openRatchetMessage(messageKey []byte, msg *RatchetMessage) ([]byte, error) {
+	aesKey, hmacKey, iv, err := deriveMessageKeys(messageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := hex.DecodeString(msg.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ciphertext: %v", err)
+	}
+
+	mac, err := hex.DecodeString(msg.HMAC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode HMAC: %v", err)
+	}
+
+	if !hmac.Equal(mac, GenerateHMAC(hmacKey, append(msg.Header.encode(), ciphertext...))) {
+		return nil, ErrRatchetAuthFailed
+	}
+
+	return AESDecrypt(aesKey, iv, ciphertext)
+}
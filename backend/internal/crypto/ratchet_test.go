@@ -0,0 +1,177 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// newRatchetPair - создает связанные храповики инициатора и ответчика с общим секретом
+func newRatchetPair(t *testing.T) (*Ratchet, *Ratchet) {
+	t.Helper()
+
+	sharedSecret := bytes.Repeat([]byte{0x07}, 32)
+	responderKeys, err := GenerateRatchetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator, err := NewRatchetInitiator(sharedSecret, responderKeys.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return initiator, NewRatchetResponder(sharedSecret, responderKeys)
+}
+
+func mustEncrypt(t *testing.T, r *Ratchet, plaintext string) *RatchetMessage {
+	t.Helper()
+
+	msg, err := r.Encrypt([]byte(plaintext))
+	if err != nil {
+		t.Fatalf("Encrypt(%q): %v", plaintext, err)
+	}
+	return msg
+}
+
+func mustDecrypt(t *testing.T, r *Ratchet, msg *RatchetMessage, want string) {
+	t.Helper()
+
+	plaintext, err := r.Decrypt(msg)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if string(plaintext) != want {
+		t.Fatalf("plaintext = %q, want %q", plaintext, want)
+	}
+}
+
+func TestNegotiateEncryptionScheme(t *testing.T) {
+	tests := []struct {
+		offered []string
+		want    string
+	}{
+		{nil, EncryptionSchemeStatic},
+		{[]string{"unknown"}, EncryptionSchemeStatic},
+		{[]string{EncryptionSchemeStatic}, EncryptionSchemeStatic},
+		{[]string{EncryptionSchemeDoubleRatchet}, EncryptionSchemeDoubleRatchet},
+		// Порядок предпочтения задает сервер, а не клиент
+		{[]string{EncryptionSchemeStatic, EncryptionSchemeDoubleRatchet}, EncryptionSchemeDoubleRatchet},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiateEncryptionScheme(tt.offered); got != tt.want {
+			t.Errorf("NegotiateEncryptionScheme(%v) = %q, want %q", tt.offered, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRatchetHeader(t *testing.T) {
+	keyPair, err := GenerateRatchetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ValidateRatchetHeader(RatchetHeader{PublicKey: hex.EncodeToString(keyPair.PublicKey().Bytes()), MessageNum: 3}); err != nil {
+		t.Fatalf("valid header: %v", err)
+	}
+	for _, publicKey := range []string{"", "zz", hex.EncodeToString(bytes.Repeat([]byte{0x04}, 65))} {
+		if err := ValidateRatchetHeader(RatchetHeader{PublicKey: publicKey}); err == nil {
+			t.Errorf("ValidateRatchetHeader(%q) = nil, want error", publicKey)
+		}
+	}
+}
+
+func TestKDFChainKeyVector(t *testing.T) {
+	chainKey := bytes.Repeat([]byte{0x01}, 32)
+
+	next, messageKey := kdfChainKey(chainKey)
+
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x01})
+	if want := mac.Sum(nil); !bytes.Equal(messageKey, want) {
+		t.Fatalf("message key = %x, want %x", messageKey, want)
+	}
+	mac = hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{0x02})
+	if want := mac.Sum(nil); !bytes.Equal(next, want) {
+		t.Fatalf("next chain key = %x, want %x", next, want)
+	}
+}
+
+func TestRatchetRoundTripBothDirections(t *testing.T) {
+	alice, bob := newRatchetPair(t)
+
+	if _, err := bob.Encrypt([]byte("too early")); !errors.Is(err, ErrRatchetNotInitialized) {
+		t.Fatalf("responder Encrypt before first message = %v, want %v", err, ErrRatchetNotInitialized)
+	}
+
+	mustDecrypt(t, bob, mustEncrypt(t, alice, "hello bob"), "hello bob")
+	mustDecrypt(t, alice, mustEncrypt(t, bob, "hello alice"), "hello alice")
+
+	// Каждая смена направления продвигает DH-храповик и меняет ключ заголовка
+	first := mustEncrypt(t, alice, "second round")
+	mustDecrypt(t, bob, first, "second round")
+	reply := mustEncrypt(t, bob, "reply")
+	if reply.Header.PublicKey == first.Header.PublicKey {
+		t.Fatal("ratchet public keys of both sides are equal")
+	}
+	mustDecrypt(t, alice, reply, "reply")
+}
+
+func TestRatchetOutOfOrderDelivery(t *testing.T) {
+	alice, bob := newRatchetPair(t)
+
+	m0 := mustEncrypt(t, alice, "m0")
+	m1 := mustEncrypt(t, alice, "m1")
+	m2 := mustEncrypt(t, alice, "m2")
+
+	mustDecrypt(t, bob, m2, "m2")
+	mustDecrypt(t, bob, m0, "m0")
+	mustDecrypt(t, bob, m1, "m1")
+
+	// Ключ пропущенного сообщения используется один раз
+	if _, err := bob.Decrypt(m1); err == nil {
+		t.Fatal("replayed message decrypted twice")
+	}
+}
+
+func TestRatchetRejectsTamperingAndKeepsState(t *testing.T) {
+	alice, bob := newRatchetPair(t)
+
+	msg := mustEncrypt(t, alice, "secret")
+	tampered := *msg
+	tampered.Header.MessageNum++
+
+	if _, err := bob.Decrypt(&tampered); err == nil {
+		t.Fatal("tampered header accepted")
+	}
+	// Неудачная расшифровка не должна продвигать состояние храповика
+	mustDecrypt(t, bob, msg, "secret")
+}
+
+func TestRatchetMessagesUseDistinctIVs(t *testing.T) {
+	alice, _ := newRatchetPair(t)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		msg := mustEncrypt(t, alice, "same plaintext")
+		if seen[msg.IV] {
+			t.Fatalf("IV %s repeated at message %d", msg.IV, i)
+		}
+		seen[msg.IV] = true
+	}
+}
+
+func TestRatchetTooManySkippedKeys(t *testing.T) {
+	alice, bob := newRatchetPair(t)
+
+	mustDecrypt(t, bob, mustEncrypt(t, alice, "first"), "first")
+
+	msg := mustEncrypt(t, alice, "far ahead")
+	msg.Header.MessageNum = MaxSkippedMessageKeys + 10
+	if _, err := bob.Decrypt(msg); !errors.Is(err, ErrTooManySkippedKeys) {
+		t.Fatalf("Decrypt = %v, want %v", err, ErrTooManySkippedKeys)
+	}
+}
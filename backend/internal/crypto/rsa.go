@@ -8,9 +8,13 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"time"
 )
 
+// MinRSAKeyBits - минимальная длина принимаемого публичного ключа RSA
+const MinRSAKeyBits = 2048
+
 // GenerateRSAKeys - генерирует пару ключей RSA (приватный и публичный)
 func GenerateRSAKeys() (*rsa.PrivateKey, []byte, error) {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -82,6 +86,29 @@ func SignRSA(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
 	return signature, nil
 }
 
+// ParseRSAPublicKey - разбирает публичный ключ RSA в формате PKIX и проверяет его длину
+func ParseRSAPublicKey(publicKeyBytes []byte) (*rsa.PublicKey, error) {
+	if len(publicKeyBytes) == 0 {
+		return nil, fmt.Errorf("%w: empty key", ErrInvalidPublicKey)
+	}
+
+	publicKeyInterface, err := x509.ParsePKIXPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	publicKey, ok := publicKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an RSA key", ErrInvalidPublicKey)
+	}
+
+	if publicKey.N.BitLen() < MinRSAKeyBits {
+		return nil, fmt.Errorf("%w: RSA key must be at least %d bits, got %d", ErrInvalidPublicKey, MinRSAKeyBits, publicKey.N.BitLen())
+	}
+
+	return publicKey, nil
+}
+
 // VerifyRSA - проверяет цифровую подпись RSA
 func VerifyRSA(publicKeyBytes, data, signature []byte) (bool, error) {
 	start := time.Now()
@@ -104,3 +131,17 @@ func VerifyRSA(publicKeyBytes, data, signature []byte) (bool, error) {
 	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
 	return err == nil, err
 }
+
+// ChatKeyWrapLabel - метка RSA-OAEP, привязывающая обернутый ключ к назначению "ключ чата"
+var ChatKeyWrapLabel = []byte("sleek-chat-key-wrap")
+
+// WrapKeyRSA - шифрует симметричный ключ публичным ключом RSA получателя (OAEP, SHA-256),
+// чтобы ключ мог расшифровать только владелец приватного ключа
+func WrapKeyRSA(publicKeyBytes, key []byte) ([]byte, error) {
+	publicKey, err := ParseRSAPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, ChatKeyWrapLabel)
+}
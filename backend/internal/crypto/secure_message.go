@@ -16,6 +16,58 @@ const (
 	MaxTimeDifference = 86400 // 24 часа вместо 5 минут
 )
 
+// Алгоритмы симметричного шифрования сообщений. Сообщения без указанного алгоритма считаются
+// зашифрованными MessageAlgorithmAESCBC: так шифровались все сообщения до появления поля,
+// поэтому во время перехода на другой алгоритм старые сообщения читаются без миграции
+const (
+	MessageAlgorithmAESCBC = "aes-256-cbc"
+	MessageAlgorithmAESGCM = "aes-256-gcm"
+)
+
+// ErrUnsupportedAlgorithm - алгоритм шифрования сообщения не поддерживается сервером
+var ErrUnsupportedAlgorithm = errors.New("unsupported message encryption algorithm")
+
+// IsSupportedMessageAlgorithm - проверяет, что сервер умеет шифровать и расшифровывать сообщения
+// указанным алгоритмом; пустая строка означает алгоритм по умолчанию
+func IsSupportedMessageAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case "", MessageAlgorithmAESCBC, MessageAlgorithmAESGCM:
+		return true
+	default:
+		return false
+	}
+}
+
+// MessageAlgorithmOrDefault - возвращает алгоритм сообщения, подставляя MessageAlgorithmAESCBC
+// для сообщений без отметки
+func MessageAlgorithmOrDefault(algorithm string) string {
+	if algorithm == "" {
+		return MessageAlgorithmAESCBC
+	}
+	return algorithm
+}
+
+// Этапы проверки и расшифровки сообщения, на которых может произойти сбой
+const (
+	DecryptStageDecode = "decode_failed"
+	DecryptStageHMAC   = "hmac_failed"
+	DecryptStageECDSA  = "ecdsa_failed"
+	DecryptStageRSA    = "rsa_failed"
+	DecryptStageAES    = "aes_failed"
+	// DecryptStageAlgorithm - сообщение помечено неизвестным алгоритмом шифрования
+	DecryptStageAlgorithm = "unsupported_algorithm"
+)
+
+// DecryptError - ошибка проверки или расшифровки с указанием этапа, на котором она произошла
+type DecryptError struct {
+	Stage string
+	Err   error
+}
+
+func (e *DecryptError) Error() string { return e.Err.Error() }
+
+func (e *DecryptError) Unwrap() error { return e.Err }
+
 type SecureMessage struct {
 	ID             string `json:"id"`
 	Timestamp      int64  `json:"timestamp"`
@@ -27,19 +79,26 @@ type SecureMessage struct {
 	RSASignature   string `json:"rsa_signature"`
 	SenderID       string `json:"sender_id"`
 	RecipientID    string `json:"recipient_id"`
+	// Algorithm - алгоритм симметричного шифрования; пусто - MessageAlgorithmAESCBC
+	Algorithm string `json:"algorithm,omitempty"`
 }
 
-// CreateSecureMessage - создает зашифрованное сообщение с подписями и целостностью
-func CreateSecureMessage(senderID, recipientID string, plaintext []byte, sharedSecret []byte, ecdsaPriv *ecdsa.PrivateKey, rsaPriv *rsa.PrivateKey) (*SecureMessage, error) {
-
-	iv, err := GenerateIV()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate IV: %v", err)
-	}
-
+// CreateSecureMessage - создает зашифрованное указанным алгоритмом сообщение с подписями и
+// целостностью; пустой algorithm означает MessageAlgorithmAESCBC
+func CreateSecureMessage(algorithm, senderID, recipientID string, plaintext []byte, sharedSecret []byte, ecdsaPriv *ecdsa.PrivateKey, rsaPriv *rsa.PrivateKey) (*SecureMessage, error) {
+	algorithm = MessageAlgorithmOrDefault(algorithm)
 	aesKey := sharedSecret[:AESKeySize]
 
-	ciphertext, err := AESEncrypt(aesKey, iv, plaintext)
+	var iv, ciphertext []byte
+	var err error
+	switch algorithm {
+	case MessageAlgorithmAESCBC:
+		iv, ciphertext, err = AESEncryptWithFreshIV(aesKey, plaintext)
+	case MessageAlgorithmAESGCM:
+		iv, ciphertext, err = AESGCMEncrypt(aesKey, plaintext)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to encrypt message: %v", err)
 	}
@@ -76,61 +135,151 @@ func CreateSecureMessage(senderID, recipientID string, plaintext []byte, sharedS
 		RSASignature:   hex.EncodeToString(rsaSignature),
 		SenderID:       senderID,
 		RecipientID:    recipientID,
+		Algorithm:      algorithm,
 	}, nil
 }
 
 // VerifyAndDecryptMessage - проверяет целостность и подписи, затем расшифровывает сообщение
 func VerifyAndDecryptMessage(msg *SecureMessage, sharedSecret []byte, senderECDSAPublicKey, senderRSAPublicKey []byte) ([]byte, error) {
+	algorithm := MessageAlgorithmOrDefault(msg.Algorithm)
+	if !IsSupportedMessageAlgorithm(algorithm) {
+		return nil, &DecryptError{Stage: DecryptStageAlgorithm, Err: fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)}
+	}
 
 	ciphertext, err := hex.DecodeString(msg.Ciphertext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode ciphertext: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageDecode, Err: fmt.Errorf("failed to decode ciphertext: %v", err)}
 	}
 
 	hmacValue, err := hex.DecodeString(msg.HMAC)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode HMAC: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageDecode, Err: fmt.Errorf("failed to decode HMAC: %v", err)}
 	}
 
 	ecdsaSignature, err := hex.DecodeString(msg.ECDSASignature)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode ECDSA signature: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageDecode, Err: fmt.Errorf("failed to decode ECDSA signature: %v", err)}
 	}
 
 	rsaSignature, err := hex.DecodeString(msg.RSASignature)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode RSA signature: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageDecode, Err: fmt.Errorf("failed to decode RSA signature: %v", err)}
 	}
 
 	iv, err := hex.DecodeString(msg.IV)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode IV: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageDecode, Err: fmt.Errorf("failed to decode IV: %v", err)}
 	}
 
 	hmacKey := sharedSecret[AESKeySize : AESKeySize+HMACKeySize]
 
 	if !VerifyHMAC(hmacKey, ciphertext, hmacValue) {
-		return nil, errors.New("HMAC verification failed")
+		return nil, &DecryptError{Stage: DecryptStageHMAC, Err: errors.New("HMAC verification failed")}
 	}
 
 	valid, err := VerifyECDSA(senderECDSAPublicKey, ciphertext, ecdsaSignature)
 	if err != nil || !valid {
-		return nil, fmt.Errorf("ECDSA signature verification failed: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageECDSA, Err: fmt.Errorf("ECDSA signature verification failed: %v", err)}
 	}
 
 	valid, err = VerifyRSA(senderRSAPublicKey, ciphertext, rsaSignature)
 	if err != nil || !valid {
-		return nil, fmt.Errorf("RSA signature verification failed: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageRSA, Err: fmt.Errorf("RSA signature verification failed: %v", err)}
 	}
 
-	plaintext, err := AESDecrypt(sharedSecret[:AESKeySize], iv, ciphertext)
+	var plaintext []byte
+	if algorithm == MessageAlgorithmAESGCM {
+		plaintext, err = AESGCMDecrypt(sharedSecret[:AESKeySize], iv, ciphertext)
+	} else {
+		plaintext, err = AESDecrypt(sharedSecret[:AESKeySize], iv, ciphertext)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt message: %v", err)
+		return nil, &DecryptError{Stage: DecryptStageAES, Err: fmt.Errorf("failed to decrypt message: %v", err)}
 	}
 
 	return plaintext, nil
 }
 
+// ErrInvalidSignature - подпись зашифрованного клиентом сообщения не прошла проверку
+var ErrInvalidSignature = errors.New("message signature verification failed")
+
+// VerifySecureMessageSignatures - проверяет формат полей и подписи отправителя над шифротекстом,
+// не требуя общего секрета; используется для сообщений, зашифрованных на клиенте
+func VerifySecureMessageSignatures(msg *SecureMessage, senderECDSAPublicKey, senderRSAPublicKey []byte) error {
+	ciphertext, err := hex.DecodeString(msg.Ciphertext)
+	if err != nil || len(ciphertext) == 0 {
+		return fmt.Errorf("invalid ciphertext encoding")
+	}
+
+	for name, value := range map[string]string{"IV": msg.IV, "HMAC": msg.HMAC, "nonce": msg.Nonce} {
+		if decoded, err := hex.DecodeString(value); err != nil || len(decoded) == 0 {
+			return fmt.Errorf("invalid %s encoding", name)
+		}
+	}
+
+	ecdsaSignature, err := hex.DecodeString(msg.ECDSASignature)
+	if err != nil {
+		return fmt.Errorf("invalid ECDSA signature encoding")
+	}
+
+	rsaSignature, err := hex.DecodeString(msg.RSASignature)
+	if err != nil {
+		return fmt.Errorf("invalid RSA signature encoding")
+	}
+
+	valid, err := VerifyECDSA(senderECDSAPublicKey, ciphertext, ecdsaSignature)
+	if err != nil || !valid {
+		return fmt.Errorf("%w: ECDSA", ErrInvalidSignature)
+	}
+
+	valid, err = VerifyRSA(senderRSAPublicKey, ciphertext, rsaSignature)
+	if err != nil || !valid {
+		return fmt.Errorf("%w: RSA", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// IntegrityReport - результат независимых проверок сообщения. HMACValid равен nil,
+// если общий секрет недоступен и целостность проверить нельзя
+type IntegrityReport struct {
+	ECDSAValid bool
+	RSAValid   bool
+	HMACValid  *bool
+}
+
+// CheckSecureMessage - выполняет все проверки подписей и HMAC, не останавливаясь на первой ошибке,
+// и не расшифровывает сообщение; sharedSecret может быть nil
+func CheckSecureMessage(msg *SecureMessage, sharedSecret []byte, senderECDSAPublicKey, senderRSAPublicKey []byte) IntegrityReport {
+	var report IntegrityReport
+
+	ciphertext, err := hex.DecodeString(msg.Ciphertext)
+	if err != nil || len(ciphertext) == 0 {
+		if sharedSecret != nil {
+			report.HMACValid = new(bool)
+		}
+		return report
+	}
+
+	if ecdsaSignature, err := hex.DecodeString(msg.ECDSASignature); err == nil {
+		report.ECDSAValid, _ = VerifyECDSA(senderECDSAPublicKey, ciphertext, ecdsaSignature)
+	}
+
+	if rsaSignature, err := hex.DecodeString(msg.RSASignature); err == nil {
+		report.RSAValid, _ = VerifyRSA(senderRSAPublicKey, ciphertext, rsaSignature)
+	}
+
+	if len(sharedSecret) >= AESKeySize+HMACKeySize {
+		hmacValid := false
+		if hmacValue, err := hex.DecodeString(msg.HMAC); err == nil {
+			hmacValid = VerifyHMAC(sharedSecret[AESKeySize:AESKeySize+HMACKeySize], ciphertext, hmacValue)
+		}
+		report.HMACValid = &hmacValid
+	}
+
+	return report
+}
+
 // generateMessageID - генерирует уникальный идентификатор сообщения
 func generateMessageID() string {
 	nonce, _ := GenerateNonce(16)
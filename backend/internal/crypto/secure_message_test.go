@@ -0,0 +1,82 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSecureMessageRoundTripPerAlgorithm(t *testing.T) {
+	ecdsaPriv, ecdsaPub, err := GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, rsaPub, err := GenerateRSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedSecret := make([]byte, AESKeySize+HMACKeySize)
+	if _, err := rand.Read(sharedSecret); err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("hello across algorithms")
+
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		{"", MessageAlgorithmAESCBC},
+		{MessageAlgorithmAESCBC, MessageAlgorithmAESCBC},
+		{MessageAlgorithmAESGCM, MessageAlgorithmAESGCM},
+	}
+	for _, tt := range tests {
+		msg, err := CreateSecureMessage(tt.algorithm, "1", "2", plaintext, sharedSecret, ecdsaPriv, rsaPriv)
+		if err != nil {
+			t.Fatalf("CreateSecureMessage(%q): %v", tt.algorithm, err)
+		}
+		if msg.Algorithm != tt.want {
+			t.Fatalf("CreateSecureMessage(%q) algorithm = %q, want %q", tt.algorithm, msg.Algorithm, tt.want)
+		}
+
+		decrypted, err := VerifyAndDecryptMessage(msg, sharedSecret, ecdsaPub, rsaPub)
+		if err != nil {
+			t.Fatalf("%s: VerifyAndDecryptMessage: %v", tt.want, err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("%s: decrypted = %q, want %q", tt.want, decrypted, plaintext)
+		}
+	}
+
+	// Сообщения, сохраненные до появления поля, расшифровываются как AES-CBC
+	legacy, err := CreateSecureMessage(MessageAlgorithmAESCBC, "1", "2", plaintext, sharedSecret, ecdsaPriv, rsaPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.Algorithm = ""
+	if decrypted, err := VerifyAndDecryptMessage(legacy, sharedSecret, ecdsaPub, rsaPub); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("unmarked message = %q, %v; want %q", decrypted, err, plaintext)
+	}
+
+	// Шифротекст GCM не расшифровывается как CBC: алгоритм определяет ветку расшифровки
+	gcm, err := CreateSecureMessage(MessageAlgorithmAESGCM, "1", "2", plaintext, sharedSecret, ecdsaPriv, rsaPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm.Algorithm = MessageAlgorithmAESCBC
+	if decrypted, err := VerifyAndDecryptMessage(gcm, sharedSecret, ecdsaPub, rsaPub); err == nil && bytes.Equal(decrypted, plaintext) {
+		t.Fatal("GCM ciphertext decrypted under the CBC tag")
+	}
+}
+
+func TestSecureMessageRejectsUnknownAlgorithm(t *testing.T) {
+	if _, err := CreateSecureMessage("chacha20-poly1305", "1", "2", []byte("x"), make([]byte, AESKeySize+HMACKeySize), nil, nil); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("CreateSecureMessage err = %v, want %v", err, ErrUnsupportedAlgorithm)
+	}
+
+	_, err := VerifyAndDecryptMessage(&SecureMessage{Algorithm: "chacha20-poly1305"}, make([]byte, AESKeySize+HMACKeySize), nil, nil)
+	var decryptErr *DecryptError
+	if !errors.As(err, &decryptErr) || decryptErr.Stage != DecryptStageAlgorithm || !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Fatalf("VerifyAndDecryptMessage err = %v, want %s stage", err, DecryptStageAlgorithm)
+	}
+}
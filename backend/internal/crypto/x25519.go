@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// X25519PublicKeySize - длина публичного ключа X25519 в байтах
+const X25519PublicKeySize = 32
+
+// GenerateX25519KeyPair - генерирует пару ключей X25519 для ECDH; публичный ключ возвращается в сыром виде (32 байта)
+func GenerateX25519KeyPair() (*ecdh.PrivateKey, []byte, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privateKey, privateKey.PublicKey().Bytes(), nil
+}
+
+// SerializeX25519PrivateKey - сериализует приватный ключ X25519 в PEM формат (PKCS#8)
+func SerializeX25519PrivateKey(privateKey *ecdh.PrivateKey) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("private key cannot be nil")
+	}
+
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	})
+
+	return privateKeyPEM, nil
+}
+
+// DeserializeX25519PrivateKey - десериализует приватный ключ X25519 из PEM формата
+func DeserializeX25519PrivateKey(privateKeyPEM []byte) (*ecdh.PrivateKey, error) {
+	if len(privateKeyPEM) == 0 {
+		return nil, errors.New("private key PEM cannot be empty")
+	}
+
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, ok := key.(*ecdh.PrivateKey)
+	if !ok || privateKey.Curve() != ecdh.X25519() {
+		return nil, errors.New("private key is not an X25519 key")
+	}
+
+	return privateKey, nil
+}
+
+// ParseX25519PublicKey - разбирает сырой публичный ключ X25519
+func ParseX25519PublicKey(publicKeyBytes []byte) (*ecdh.PublicKey, error) {
+	if len(publicKeyBytes) != X25519PublicKeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrInvalidPublicKey, X25519PublicKeySize, len(publicKeyBytes))
+	}
+
+	publicKey, err := ecdh.X25519().NewPublicKey(publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublicKey, err)
+	}
+
+	return publicKey, nil
+}
+
+// X25519SharedSecret - вычисляет общий секретный ключ X25519 и разворачивает его через HKDF
+// до той же длины, что и ComputeECDHSharedSecret, чтобы результат был взаимозаменяем
+func X25519SharedSecret(privateKey *ecdh.PrivateKey, peerPublicKeyBytes []byte) ([]byte, error) {
+	if privateKey == nil {
+		return nil, errors.New("private key cannot be nil")
+	}
+
+	if len(peerPublicKeyBytes) == 0 {
+		return nil, errors.New("peer public key cannot be empty")
+	}
+
+	publicKey, err := ParseX25519PublicKey(peerPublicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	// ECDH отклоняет точки малого порядка, дающие нулевой секрет
+	shared, err := privateKey.ECDH(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 computation failed: %v", err)
+	}
+
+	return DeriveKeys(shared, PurposeX25519MessageKeys)
+}
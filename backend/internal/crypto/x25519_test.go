@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Вектор из RFC 7748, раздел 6.1
+func TestX25519SharedSecretRFC7748Vector(t *testing.T) {
+	alicePrivate, err := ecdh.X25519().NewPrivateKey(mustHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPrivate, err := ecdh.X25519().NewPrivateKey(mustHex(t, "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alicePublic := mustHex(t, "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	bobPublic := mustHex(t, "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")
+
+	if !bytes.Equal(alicePrivate.PublicKey().Bytes(), alicePublic) || !bytes.Equal(bobPrivate.PublicKey().Bytes(), bobPublic) {
+		t.Fatal("public keys do not match RFC 7748")
+	}
+
+	want, err := DeriveKeys(mustHex(t, "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742"), PurposeX25519MessageKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliceSecret, err := X25519SharedSecret(alicePrivate, bobPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobSecret, err := X25519SharedSecret(bobPrivate, alicePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aliceSecret, want) || !bytes.Equal(bobSecret, want) {
+		t.Fatalf("shared secrets %x / %x, want %x", aliceSecret, bobSecret, want)
+	}
+}
+
+func TestX25519SharedSecretAgreement(t *testing.T) {
+	alicePrivate, alicePublic, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPrivate, bobPublic, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alicePublic) != X25519PublicKeySize {
+		t.Fatalf("public key size = %d, want %d", len(alicePublic), X25519PublicKeySize)
+	}
+
+	aliceSecret, err := X25519SharedSecret(alicePrivate, bobPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobSecret, err := X25519SharedSecret(bobPrivate, alicePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aliceSecret, bobSecret) {
+		t.Fatal("both sides derived different secrets")
+	}
+
+	// Длина совпадает с секретом P-256, чтобы пути были взаимозаменяемы
+	p256Private, _, err := GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p256Public, err := GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Secret, err := ComputeECDHSharedSecret(p256Private, p256Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliceSecret) != len(p256Secret) {
+		t.Fatalf("X25519 secret length = %d, P-256 secret length = %d", len(aliceSecret), len(p256Secret))
+	}
+}
+
+func TestX25519SharedSecretRejectsInvalidPeerKeys(t *testing.T) {
+	privateKey, _, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := X25519SharedSecret(privateKey, make([]byte, 31)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("short key: err = %v, want %v", err, ErrInvalidPublicKey)
+	}
+	// Точка малого порядка дает нулевой секрет
+	if _, err := X25519SharedSecret(privateKey, make([]byte, X25519PublicKeySize)); err == nil {
+		t.Fatal("low-order point accepted")
+	}
+	if _, err := X25519SharedSecret(nil, make([]byte, X25519PublicKeySize)); err == nil {
+		t.Fatal("nil private key accepted")
+	}
+}
+
+func TestX25519PrivateKeySerializationRoundTrip(t *testing.T) {
+	privateKey, publicKey, err := GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemBytes, err := SerializeX25519PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("SerializeX25519PrivateKey: %v", err)
+	}
+	restored, err := DeserializeX25519PrivateKey(pemBytes)
+	if err != nil {
+		t.Fatalf("DeserializeX25519PrivateKey: %v", err)
+	}
+	if !bytes.Equal(restored.PublicKey().Bytes(), publicKey) {
+		t.Fatal("restored key has a different public key")
+	}
+
+	// Ключ другой кривой в том же формате PKCS#8 не принимается за X25519
+	p256Key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256PEM, err := SerializeX25519PrivateKey(p256Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeserializeX25519PrivateKey(p256PEM); err == nil {
+		t.Fatal("P-256 key accepted as X25519")
+	}
+	if _, err := DeserializeX25519PrivateKey([]byte("not pem")); err == nil {
+		t.Fatal("garbage accepted as X25519 key")
+	}
+}
@@ -0,0 +1,41 @@
+package entities
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// Ограничения длины адреса по RFC 5321
+const (
+	maxEmailLength    = 254
+	maxEmailLocalPart = 64
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// NormalizeEmail - приводит email к каноническому виду (без пробелов по краям, в нижнем регистре)
+// и строго проверяет его: только сам адрес без отображаемого имени, домен с точкой и длины частей
+// в пределах RFC 5321. Один и тот же адрес в разном регистре дает одинаковый результат
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" || len(email) > maxEmailLength {
+		return "", ErrInvalidEmail
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+
+	at := strings.LastIndex(email, "@")
+	local, domain := email[:at], email[at+1:]
+	if len(local) > maxEmailLocalPart {
+		return "", ErrInvalidEmail
+	}
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.Contains(domain, "..") {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
@@ -0,0 +1,40 @@
+package entities
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		want    string
+		wantErr bool
+	}{
+		{"user@example.com", "user@example.com", false},
+		{"User@Example.COM", "user@example.com", false},
+		{"  user@example.com\t", "user@example.com", false},
+		{" USER@EXAMPLE.COM ", "user@example.com", false},
+		{"", "", true},
+		{"   ", "", true},
+		{"user", "", true},
+		{"user@localhost", "", true},
+		{"user@example.", "", true},
+		{"user@.example.com", "", true},
+		{"user@example..com", "", true},
+		{"Alice <alice@example.com>", "", true},
+		{"user @example.com", "", true},
+		{strings.Repeat("a", 65) + "@example.com", "", true},
+		{"user@" + strings.Repeat("a", 250) + ".com", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.email)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("NormalizeEmail(%q): err = %v, wantErr %v", tt.email, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("NormalizeEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
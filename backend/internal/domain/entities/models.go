@@ -7,33 +7,47 @@ import (
 )
 
 type User struct {
-	ID              uint           `gorm:"primaryKey" json:"id"`
-	Username        string         `gorm:"unique;not null" json:"username"`
-	Email           string         `gorm:"unique;not null" json:"email"`
-	PasswordHash    string         `gorm:"not null" json:"-"`
-	ECDSAPublicKey  string         `gorm:"type:text" json:"ecdsa_public_key"`
-	RSAPublicKey    string         `gorm:"type:text" json:"rsa_public_key"`
-	ECDSAPrivateKey string         `gorm:"type:text" json:"-"`
-	RSAPrivateKey   string         `gorm:"type:text" json:"-"`
-	IsOnline        bool           `gorm:"default:false" json:"is_online"`
-	Role            string         `gorm:"-" json:"role,omitempty"`
-	LastSeen        *time.Time     `json:"last_seen"`
-	CreatedAt       time.Time      `json:"created_at"`
-	UpdatedAt       time.Time      `json:"updated_at"`
-	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	Username         string         `gorm:"unique;not null" json:"username"`
+	Email            string         `gorm:"unique;not null" json:"email"`
+	PasswordHash     string         `gorm:"not null" json:"-"`
+	ECDSAPublicKey   string         `gorm:"type:text" json:"ecdsa_public_key"`
+	RSAPublicKey     string         `gorm:"type:text" json:"rsa_public_key"`
+	ECDSAPrivateKey  string         `gorm:"type:text" json:"-"`
+	RSAPrivateKey    string         `gorm:"type:text" json:"-"`
+	X25519PublicKey  string         `gorm:"type:text" json:"x25519_public_key,omitempty"`
+	X25519PrivateKey string         `gorm:"type:text" json:"-"`
+	ServerHoldsKeys  *bool          `gorm:"default:true" json:"server_holds_keys"`
+	IsOnline         bool           `gorm:"default:false" json:"is_online"`
+	Role             string         `gorm:"-" json:"role,omitempty"`
+	LastSeen         *time.Time     `json:"last_seen"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
 type Chat struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Name      string         `gorm:"not null" json:"name"`
-	IsGroup   bool           `gorm:"default:false" json:"is_group"`
-	CreatedBy uint           `gorm:"not null" json:"created_by"`
-	Creator   User           `gorm:"foreignKey:CreatedBy" json:"creator"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Members   []User         `gorm:"many2many:chat_members;" json:"members"`
-	Messages  []Message      `gorm:"foreignKey:ChatID" json:"messages"`
+	ID               uint           `gorm:"primaryKey" json:"id"`
+	Name             string         `gorm:"not null" json:"name"`
+	IsGroup          bool           `gorm:"default:false" json:"is_group"`
+	CreatedBy        uint           `gorm:"not null" json:"created_by"`
+	EncryptionScheme string         `gorm:"size:32;default:'static'" json:"encryption_scheme"`
+	KeyVersion       int            `gorm:"default:0" json:"key_version"`
+	SlowModeSeconds  int            `gorm:"default:0" json:"slow_mode_seconds"`
+	LastSeq          int64          `gorm:"not null;default:0" json:"last_seq"`
+	PairKey          *string        `gorm:"size:64;uniqueIndex" json:"-"`
+	Creator          User           `gorm:"foreignKey:CreatedBy" json:"creator"`
+	UnreadMentions   int64          `gorm:"-" json:"unread_mentions"`
+	Role             string         `gorm:"-" json:"role,omitempty"`
+	MemberCount      int            `gorm:"-" json:"member_count,omitempty"`
+	MessageCount     int64          `gorm:"-" json:"message_count"`
+	LastActivityAt   *time.Time     `gorm:"-" json:"last_activity_at"`
+	Archived         bool           `gorm:"-" json:"archived"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	Members          []User         `gorm:"many2many:chat_members;" json:"members"`
+	Messages         []Message      `gorm:"foreignKey:ChatID" json:"messages"`
 }
 
 type Message struct {
@@ -44,12 +58,35 @@ type Message struct {
 	Sender         User   `gorm:"foreignKey:SenderID" json:"sender"`
 	Content        string `gorm:"type:text" json:"content"`
 	MessageType    string `gorm:"default:'text'" json:"message_type"`
+	Status         string `gorm:"size:16;default:'sent';index" json:"status"`
+	KeyVersion     int    `gorm:"default:0" json:"key_version"`
 	Timestamp      *int64 `gorm:"default:null" json:"timestamp"`
 	Nonce          string `gorm:"type:text" json:"nonce"`
 	IV             string `gorm:"type:text" json:"iv"`
 	HMAC           string `gorm:"type:text" json:"hmac"`
 	ECDSASignature string `gorm:"type:text" json:"ecdsa_signature"`
 	RSASignature   string `gorm:"type:text" json:"rsa_signature"`
+	// ClientEncrypted - сообщение зашифровано на клиенте, сервер хранит его без расшифровки
+	ClientEncrypted bool `gorm:"default:false" json:"client_encrypted"`
+	// Algorithm - алгоритм симметричного шифрования; пусто у сообщений, сохраненных до появления
+	// поля, они зашифрованы AES-256-CBC
+	Algorithm string `gorm:"size:32" json:"algorithm,omitempty"`
+	// RatchetPublicKey, RatchetPrevChainLen, RatchetMessageNum - заголовок Double Ratchet сообщения
+	// в чате со схемой double_ratchet; по ним получатель восстанавливает crypto.RatchetMessage
+	RatchetPublicKey    string `gorm:"type:text" json:"ratchet_public_key,omitempty"`
+	RatchetPrevChainLen uint32 `gorm:"default:0" json:"ratchet_pn,omitempty"`
+	RatchetMessageNum   uint32 `gorm:"default:0" json:"ratchet_n,omitempty"`
+	// ForwardedFromID - ID исходного сообщения, если сообщение переслано
+	ForwardedFromID *uint `gorm:"index" json:"forwarded_from_id,omitempty"`
+	// AttachmentID - вложение, привязанное к сообщению при отправке
+	AttachmentID *uint `gorm:"index" json:"attachment_id,omitempty"`
+	// Seq - порядковый номер сообщения в чате без пропусков; клиенты упорядочивают сообщения
+	// по нему, а не по времени отправки
+	Seq int64 `gorm:"not null;default:0" json:"seq"`
+	// Flagged - фильтр содержимого пометил сообщение для проверки модератором
+	Flagged bool `gorm:"default:false;index" json:"-"`
+	// DeletedBy - кто удалил сообщение; нужен, чтобы отменить удаление мог только он или администратор
+	DeletedBy *uint `json:"-"`
 
 	IsEdited  bool           `gorm:"default:false" json:"is_edited"`
 	EditedAt  *time.Time     `json:"edited_at"`
@@ -58,16 +95,149 @@ type Message struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
 type ChatMember struct {
 	ID       uint      `gorm:"primaryKey" json:"id"`
 	ChatID   uint      `gorm:"not null" json:"chat_id"`
 	UserID   uint      `gorm:"not null" json:"user_id"`
 	Role     string    `gorm:"default:'member'" json:"role"`
+	Archived bool      `gorm:"default:false" json:"archived"`
 	JoinedAt time.Time `json:"joined_at"`
 	Chat     User      `gorm:"foreignKey:ChatID" json:"-"`
 	User     User      `gorm:"foreignKey:UserID" json:"-"`
 }
 
+type ChatKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ChatID    uint      `gorm:"not null;uniqueIndex:idx_chat_keys_version" json:"chat_id"`
+	Version   int       `gorm:"not null;uniqueIndex:idx_chat_keys_version" json:"version"`
+	Key       string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MessageMention struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	MessageID uint       `gorm:"not null;index" json:"message_id"`
+	ChatID    uint       `gorm:"not null;index:idx_mentions_chat_user" json:"chat_id"`
+	UserID    uint       `gorm:"not null;index:idx_mentions_chat_user" json:"user_id"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type MessageReceipt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"not null;uniqueIndex:idx_receipts_message_user" json:"message_id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_receipts_message_user" json:"user_id"`
+	ReadAt    time.Time `json:"read_at"`
+}
+
+// MessageReaction - реакция участника на сообщение. В открытом режиме эмодзи хранится в Emoji;
+// зашифрованная реакция хранит только шифротекст клиента, и сервер не знает, какой это эмодзи
+type MessageReaction struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MessageID  uint      `gorm:"not null;index" json:"message_id"`
+	UserID     uint      `gorm:"not null" json:"user_id"`
+	Emoji      string    `gorm:"size:64" json:"emoji,omitempty"`
+	Encrypted  bool      `gorm:"default:false" json:"encrypted"`
+	Ciphertext string    `gorm:"type:text" json:"ciphertext,omitempty"`
+	IV         string    `gorm:"size:64" json:"iv,omitempty"`
+	HMAC       string    `gorm:"size:128" json:"hmac,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Статусы жалобы на сообщение
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+// MessageReport - жалоба участника чата на сообщение для проверки администратором; текст
+// сообщения в жалобе не сохраняется
+type MessageReport struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MessageID  uint      `gorm:"not null;uniqueIndex:idx_reports_message_reporter" json:"message_id"`
+	ReporterID uint      `gorm:"not null;uniqueIndex:idx_reports_message_reporter" json:"reporter_id"`
+	ChatID     uint      `gorm:"not null;index" json:"chat_id"`
+	Reason     string    `gorm:"size:500;not null" json:"reason"`
+	Status     string    `gorm:"size:16;not null;default:'open';index" json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// UserBlock - пользователь BlockerID заблокировал BlockedID; заблокированные не видят друг друга в контактах
+type UserBlock struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	BlockerID uint      `gorm:"not null;uniqueIndex:idx_user_blocks_pair" json:"blocker_id"`
+	BlockedID uint      `gorm:"not null;uniqueIndex:idx_user_blocks_pair;index" json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Contact - пользователь, с которым у владельца есть хотя бы один общий чат.
+// LastInteractionAt - время последнего сообщения любого из двоих в общих чатах;
+// IsOnline заполняется по подключениям хаба, а не из БД
+type Contact struct {
+	UserID            uint       `json:"user_id"`
+	Username          string     `json:"username"`
+	IsOnline          bool       `gorm:"-" json:"is_online"`
+	LastSeen          *time.Time `json:"last_seen"`
+	SharedChats       int64      `json:"shared_chats"`
+	LastInteractionAt *time.Time `json:"last_interaction_at"`
+}
+
+// SenderMessageCount - количество сообщений, отправленных участником чата
+type SenderMessageCount struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Count    int64  `json:"message_count"`
+}
+
+// MessageReader - участник чата, прочитавший сообщение, и время прочтения
+type MessageReader struct {
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	ReadAt   time.Time `json:"read_at"`
+}
+
+// ChatMessageCount - количество сообщений чата и время последнего из них
+type ChatMessageCount struct {
+	ChatID        uint       `json:"chat_id"`
+	Count         int64      `json:"count"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+}
+
+// DailyMessageCount - количество сообщений чата за календарный день
+type DailyMessageCount struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
+type Attachment struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ChatID       uint      `gorm:"not null;index" json:"chat_id"`
+	MessageID    *uint     `gorm:"index" json:"message_id"`
+	UploaderID   uint      `gorm:"not null" json:"uploader_id"`
+	FileName     string    `gorm:"not null" json:"file_name"`
+	MimeType     string    `gorm:"not null" json:"mime_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	Data         []byte    `gorm:"type:bytea" json:"-"`
+	Thumbnail    []byte    `gorm:"type:bytea" json:"-"`
+	HasThumbnail bool      `gorm:"default:false" json:"has_thumbnail"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Статусы обмена ключами между пользователями
+const (
+	KeyExchangeStatusPending   = "pending"
+	KeyExchangeStatusActive    = "active"
+	KeyExchangeStatusCancelled = "cancelled"
+)
+
 type KeyExchange struct {
 	ID               uint      `gorm:"primaryKey" json:"id"`
 	UserAID          uint      `gorm:"not null" json:"user_a_id"`
@@ -81,10 +251,13 @@ type KeyExchange struct {
 }
 
 type Session struct {
-	ID           uint      `gorm:"primaryKey" json:"id"`
-	UserID       uint      `gorm:"not null" json:"user_id"`
-	User         User      `gorm:"foreignKey:UserID" json:"user"`
-	Token        string    `gorm:"unique;not null" json:"token"`
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	UserID uint   `gorm:"not null" json:"user_id"`
+	User   User   `gorm:"foreignKey:UserID" json:"user"`
+	Token  string `gorm:"unique;not null" json:"token"`
+	// KeySalt - hex-соль HKDF ключей сессии; пустая у сессий клиентов без SaltAware, ключи которых
+	// выведены с общей солью "sleek-chat-salt"
+	KeySalt      string    `gorm:"size:64" json:"-"`
 	IsActive     bool      `gorm:"default:true" json:"is_active"`
 	ExpiresAt    time.Time `gorm:"not null" json:"expires_at"`
 	CreatedAt    time.Time `json:"created_at"`
@@ -92,8 +265,44 @@ type Session struct {
 	LastActivity time.Time `json:"last_activity"`
 }
 
+// AuditAction - тип события безопасности в журнале аудита
+type AuditAction string
+
+const (
+	AuditActionLogin           AuditAction = "login"
+	AuditActionLoginFailed     AuditAction = "login_failed"
+	AuditActionLogout          AuditAction = "logout"
+	AuditActionPasswordChanged AuditAction = "password_changed"
+	AuditActionKeyRotated      AuditAction = "key_rotated"
+	AuditActionSessionRevoked  AuditAction = "session_revoked"
+	AuditActionChatDeleted     AuditAction = "chat_deleted"
+	AuditActionDataExported    AuditAction = "data_exported"
+)
+
+// AuditLog - запись журнала аудита; Metadata хранит JSON с подробностями события
+type AuditLog struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	UserID    uint        `gorm:"not null;index" json:"user_id"`
+	Action    AuditAction `gorm:"size:32;not null;index" json:"action"`
+	IP        string      `gorm:"size:64" json:"ip"`
+	Metadata  string      `gorm:"type:text" json:"metadata,omitempty"`
+	CreatedAt time.Time   `gorm:"index" json:"created_at"`
+}
+
+// FailedNotification - уведомление, которое не удалось доставить пользователю; Payload хранит
+// JSON уведомления, запись удаляется после повторной доставки при следующем подключении
+type FailedNotification struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	UserID    uint             `gorm:"not null;index" json:"user_id"`
+	ChatID    uint             `json:"chat_id"`
+	Type      NotificationType `gorm:"size:32;not null" json:"type"`
+	Payload   string           `gorm:"type:text;not null" json:"payload"`
+	Reason    string           `gorm:"size:64" json:"reason"`
+	CreatedAt time.Time        `gorm:"index" json:"created_at"`
+}
+
 type Notification struct {
-	Type    string                 `json:"type"`
+	Type    NotificationType       `json:"type"`
 	ChatID  uint                   `json:"chat_id"`
 	Message string                 `json:"message"`
 	Data    map[string]interface{} `json:"data,omitempty"`
@@ -101,11 +310,18 @@ type Notification struct {
 
 type WebSocketMessage struct {
 	Type         string        `json:"type"`
+	Seq          uint64        `json:"seq,omitempty"`
 	ChatID       uint          `json:"chat_id,omitempty"`
 	Message      *Message      `json:"message,omitempty"`
 	Notification *Notification `json:"notification,omitempty"`
 }
 
+// HoldsServerKeys - сообщает, хранит ли сервер приватные ключи пользователя;
+// записи, созданные до появления флага, считаются серверными
+func (u *User) HoldsServerKeys() bool {
+	return u.ServerHoldsKeys == nil || *u.ServerHoldsKeys
+}
+
 // TableName - возвращает имя таблицы для пользователей
 func (User) TableName() string { return "users" }
 
@@ -118,6 +334,18 @@ func (Message) TableName() string { return "messages" }
 // TableName - возвращает имя таблицы для участников чата
 func (ChatMember) TableName() string { return "chat_members" }
 
+// TableName - возвращает имя таблицы для ключей чатов
+func (ChatKey) TableName() string { return "chat_keys" }
+
+// TableName - возвращает имя таблицы для упоминаний
+func (MessageMention) TableName() string { return "message_mentions" }
+
+// TableName - возвращает имя таблицы для отметок о прочтении
+func (MessageReceipt) TableName() string { return "message_receipts" }
+
+// TableName - возвращает имя таблицы для вложений
+func (Attachment) TableName() string { return "attachments" }
+
 // TableName - возвращает имя таблицы для обмена ключами
 func (KeyExchange) TableName() string { return "key_exchanges" }
 
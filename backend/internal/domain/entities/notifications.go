@@ -0,0 +1,189 @@
+package entities
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NotificationType - тип уведомления, передаваемого клиентам через WebSocket
+type NotificationType string
+
+const (
+	NotificationGroupCreated NotificationType = "group_created"
+	NotificationGroupDeleted NotificationType = "group_deleted"
+	NotificationUserJoined   NotificationType = "user_joined"
+	NotificationUserRemoved  NotificationType = "user_removed"
+	NotificationUserLeft     NotificationType = "user_left"
+	NotificationMention      NotificationType = "mention"
+	NotificationChatInvited  NotificationType = "chat_invited"
+	NotificationMembersAdded NotificationType = "members_added"
+	// NotificationKeyExchangeCancelled - собеседник отменил ожидающий обмен ключами
+	NotificationKeyExchangeCancelled NotificationType = "key_exchange_cancelled"
+)
+
+// requiredNotificationData - обязательные ключи Data для каждого типа уведомления
+var requiredNotificationData = map[NotificationType][]string{
+	NotificationGroupCreated: {"creator_id", "creator_name", "chat_name"},
+	NotificationGroupDeleted: {"creator_id", "creator_name", "chat_name"},
+	NotificationUserJoined:   {"user_id", "username", "chat_id"},
+	NotificationUserRemoved:  {"removed_user_id", "removed_username", "actor_id", "actor_username", "chat_name"},
+	NotificationUserLeft:     {"user_id", "username", "chat_name"},
+	NotificationMention:      {"message_id", "sender_id", "sender_username", "chat_id"},
+	NotificationChatInvited:  {"chat_id", "chat_name", "is_group", "inviter_id", "inviter_username"},
+	NotificationMembersAdded: {"chat_id", "user_ids", "usernames", "actor_id", "actor_username"},
+
+	NotificationKeyExchangeCancelled: {"exchange_id", "cancelled_by", "cancelled_by_username"},
+}
+
+// Validate - проверяет, что тип уведомления известен и Data содержит все обязательные ключи
+func (n *Notification) Validate() error {
+	required, ok := requiredNotificationData[n.Type]
+	if !ok {
+		return fmt.Errorf("unknown notification type %q", n.Type)
+	}
+
+	var missing []string
+	for _, key := range required {
+		if _, ok := n.Data[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("notification %q is missing data keys %v", n.Type, missing)
+	}
+
+	return nil
+}
+
+// NewGroupCreatedNotification - уведомление о создании группы
+func NewGroupCreatedNotification(chatID uint, message string, creatorID uint, creatorName, chatName string) *Notification {
+	return &Notification{
+		Type:    NotificationGroupCreated,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"creator_id":   creatorID,
+			"creator_name": creatorName,
+			"chat_name":    chatName,
+		},
+	}
+}
+
+// NewGroupDeletedNotification - уведомление об удалении группы создателем
+func NewGroupDeletedNotification(chatID uint, message string, creatorID uint, creatorName, chatName string) *Notification {
+	return &Notification{
+		Type:    NotificationGroupDeleted,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"creator_id":   creatorID,
+			"creator_name": creatorName,
+			"chat_name":    chatName,
+		},
+	}
+}
+
+// NewUserJoinedNotification - уведомление о добавлении участника в группу
+func NewUserJoinedNotification(chatID uint, message string, userID uint, username string) *Notification {
+	return &Notification{
+		Type:    NotificationUserJoined,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"user_id":  userID,
+			"username": username,
+			"chat_id":  chatID,
+		},
+	}
+}
+
+// NewUserRemovedNotification - уведомление об удалении участника из группы
+func NewUserRemovedNotification(chatID uint, message string, removedUserID uint, removedUsername string, actorID uint, actorUsername, chatName string) *Notification {
+	return &Notification{
+		Type:    NotificationUserRemoved,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"removed_user_id":  removedUserID,
+			"removed_username": removedUsername,
+			"actor_id":         actorID,
+			"actor_username":   actorUsername,
+			"chat_name":        chatName,
+		},
+	}
+}
+
+// NewUserLeftNotification - уведомление о выходе участника из группы
+func NewUserLeftNotification(chatID uint, message string, userID uint, username, chatName string) *Notification {
+	return &Notification{
+		Type:    NotificationUserLeft,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"user_id":   userID,
+			"username":  username,
+			"chat_name": chatName,
+		},
+	}
+}
+
+// NewMentionNotification - персональное уведомление об упоминании в сообщении
+func NewMentionNotification(chatID uint, message string, messageID, senderID uint, senderUsername string) *Notification {
+	return &Notification{
+		Type:    NotificationMention,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"message_id":      messageID,
+			"sender_id":       senderID,
+			"sender_username": senderUsername,
+			"chat_id":         chatID,
+		},
+	}
+}
+
+// NewChatInvitedNotification - персональное уведомление пользователю о добавлении в чат
+func NewChatInvitedNotification(chatID uint, message, chatName string, isGroup bool, inviterID uint, inviterUsername string) *Notification {
+	return &Notification{
+		Type:    NotificationChatInvited,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"chat_id":          chatID,
+			"chat_name":        chatName,
+			"is_group":         isGroup,
+			"inviter_id":       inviterID,
+			"inviter_username": inviterUsername,
+		},
+	}
+}
+
+// NewMembersAddedNotification - одно уведомление о добавлении в группу сразу нескольких участников
+func NewMembersAddedNotification(chatID uint, message string, userIDs []uint, usernames []string, actorID uint, actorUsername string) *Notification {
+	return &Notification{
+		Type:    NotificationMembersAdded,
+		ChatID:  chatID,
+		Message: message,
+		Data: map[string]interface{}{
+			"chat_id":        chatID,
+			"user_ids":       userIDs,
+			"usernames":      usernames,
+			"actor_id":       actorID,
+			"actor_username": actorUsername,
+		},
+	}
+}
+
+// NewKeyExchangeCancelledNotification - персональное уведомление второму участнику об отмене обмена ключами
+func NewKeyExchangeCancelledNotification(message string, exchangeID, cancelledBy uint, cancelledByUsername string) *Notification {
+	return &Notification{
+		Type:    NotificationKeyExchangeCancelled,
+		Message: message,
+		Data: map[string]interface{}{
+			"exchange_id":           exchangeID,
+			"cancelled_by":          cancelledBy,
+			"cancelled_by_username": cancelledByUsername,
+		},
+	}
+}
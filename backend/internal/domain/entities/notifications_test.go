@@ -0,0 +1,60 @@
+package entities
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotificationConstructorsIncludeRequiredData(t *testing.T) {
+	notifications := []*Notification{
+		NewGroupCreatedNotification(10, "created", 1, "alice", "team"),
+		NewGroupDeletedNotification(10, "deleted", 1, "alice", "team"),
+		NewUserJoinedNotification(10, "joined", 2, "bob"),
+		NewUserRemovedNotification(10, "removed", 2, "bob", 1, "alice", "team"),
+		NewUserLeftNotification(10, "left", 2, "bob", "team"),
+		NewMentionNotification(10, "mentioned", 5, 1, "alice"),
+		NewChatInvitedNotification(10, "invited", "team", true, 1, "alice"),
+		NewMembersAddedNotification(10, "added", []uint{2, 3}, []string{"bob", "carol"}, 1, "alice"),
+		NewKeyExchangeCancelledNotification("cancelled", 7, 1, "alice"),
+	}
+
+	covered := make(map[NotificationType]bool)
+	for _, notification := range notifications {
+		if err := notification.Validate(); err != nil {
+			t.Errorf("%s: %v", notification.Type, err)
+		}
+		for _, key := range requiredNotificationData[notification.Type] {
+			if notification.Data[key] == nil {
+				t.Errorf("%s: %q is nil", notification.Type, key)
+			}
+		}
+		covered[notification.Type] = true
+	}
+	for notificationType := range requiredNotificationData {
+		if !covered[notificationType] {
+			t.Errorf("no constructor tested for %q", notificationType)
+		}
+	}
+
+	// Уведомление об исключении всегда сообщает, кого исключили
+	removed := NewUserRemovedNotification(10, "removed", 2, "bob", 1, "alice", "team")
+	if removed.Data["removed_user_id"] != uint(2) {
+		t.Fatalf("removed_user_id = %v, want 2", removed.Data["removed_user_id"])
+	}
+}
+
+func TestNotificationValidateRejectsIncompletePayload(t *testing.T) {
+	notification := NewUserRemovedNotification(10, "removed", 2, "bob", 1, "alice", "team")
+	delete(notification.Data, "removed_user_id")
+	delete(notification.Data, "actor_id")
+
+	err := notification.Validate()
+	if err == nil || !strings.Contains(err.Error(), "[actor_id removed_user_id]") {
+		t.Fatalf("err = %v, want missing actor_id and removed_user_id", err)
+	}
+
+	unknown := &Notification{Type: "user_joind", Data: map[string]interface{}{}}
+	if err := unknown.Validate(); err == nil {
+		t.Fatal("unknown notification type accepted")
+	}
+}
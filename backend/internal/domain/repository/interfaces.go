@@ -1,68 +1,158 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"sleek-chat-backend/internal/domain/entities"
 	"time"
 )
 
+// ErrPrivateChatExists - приватный чат для этой пары пользователей уже существует
+var ErrPrivateChatExists = errors.New("private chat already exists")
+
+// ErrReactionExists - пользователь уже поставил эту открытую реакцию на сообщение
+var ErrReactionExists = errors.New("reaction already exists")
+
+// ErrReportExists - пользователь уже пожаловался на это сообщение
+var ErrReportExists = errors.New("message already reported")
+
+// ErrNotMember - пользователь, роль которого меняется, не состоит в чате
+var ErrNotMember = errors.New("user is not a member of this chat")
+
+// ErrLastAdmin - изменение оставило бы группу без администраторов и создателя
+var ErrLastAdmin = errors.New("group must keep at least one admin")
+
+// ErrAttachmentUnavailable - вложение не найдено, загружено в другой чат или другим пользователем,
+// либо уже привязано к сообщению
+var ErrAttachmentUnavailable = errors.New("attachment not found or already linked")
+
 type UserRepository interface {
-	Create(user *entities.User) error
-	GetByID(id uint) (*entities.User, error)
-	GetByUsername(username string) (*entities.User, error)
-	GetByEmail(email string) (*entities.User, error)
-	Update(user *entities.User) error
-	Delete(id uint) error
-	UpdateOnlineStatus(userID uint, isOnline bool) error
-	UpdatePassword(userID uint, passwordHash string) error
-	GetOnlineUsers() ([]entities.User, error)
-	SearchUsers(query string, excludeUserID uint, limit int) ([]entities.User, error)
+	Create(ctx context.Context, user *entities.User) error
+	GetByID(ctx context.Context, id uint) (*entities.User, error)
+	GetByIDs(ctx context.Context, ids []uint) ([]entities.User, error)
+	GetByUsername(ctx context.Context, username string) (*entities.User, error)
+	GetByEmail(ctx context.Context, email string) (*entities.User, error)
+	IsUsernameTaken(ctx context.Context, username string, excludeUserID uint) (bool, error)
+	IsEmailTaken(ctx context.Context, email string, excludeUserID uint) (bool, error)
+	Update(ctx context.Context, user *entities.User) error
+	Delete(ctx context.Context, id uint) error
+	UpdateOnlineStatus(ctx context.Context, userID uint, isOnline bool) error
+	UpdatePassword(ctx context.Context, userID uint, passwordHash string) error
+	GetOnlineUsers(ctx context.Context) ([]entities.User, error)
+	SearchUsers(ctx context.Context, query string, excludeUserID uint, limit, offset int) ([]entities.User, error)
+	CountSearchUsers(ctx context.Context, query string, excludeUserID uint) (int64, error)
+	GetContacts(ctx context.Context, userID uint) ([]entities.Contact, error)
+	BlockUser(ctx context.Context, blockerID, blockedID uint) error
+	UnblockUser(ctx context.Context, blockerID, blockedID uint) error
 }
 
 type ChatRepository interface {
-	Create(chat *entities.Chat) error
-	GetByID(id uint) (*entities.Chat, error)
-	GetUserChats(userID uint) ([]entities.Chat, error)
-	Update(chat *entities.Chat) error
-	Delete(id uint) error
-	AddMember(chatID, userID uint, role string) error
-	RemoveMember(chatID, userID uint) error
-	GetMembers(chatID uint) ([]entities.User, error)
-	GetMembersWithRoles(chatID uint) ([]*entities.User, error)
-	IsMember(chatID, userID uint) (bool, error)
-	FindPrivateChat(userID1, userID2 uint) (*entities.Chat, error)
-	UpdateMemberRole(chatID, userID uint, role string) error
-	GetMemberRole(chatID, userID uint) (string, error)
+	Create(ctx context.Context, chat *entities.Chat) error
+	CreateWithMembers(ctx context.Context, chat *entities.Chat, members []entities.ChatMember) error
+	GetByID(ctx context.Context, id uint) (*entities.Chat, error)
+	GetUserChats(ctx context.Context, userID uint, includeArchived bool) ([]entities.Chat, error)
+	GetArchivedChatIDs(ctx context.Context, userID uint) ([]uint, error)
+	SetArchived(ctx context.Context, chatID, userID uint, archived bool) error
+	UnarchiveForAll(ctx context.Context, chatID uint) error
+	Update(ctx context.Context, chat *entities.Chat) error
+	Delete(ctx context.Context, id uint) error
+	AddMember(ctx context.Context, chatID, userID uint, role string) error
+	AddMembers(ctx context.Context, chatID uint, userIDs []uint, role string) error
+	RemoveMember(ctx context.Context, chatID, userID uint) error
+	GetMembers(ctx context.Context, chatID uint) ([]entities.User, error)
+	GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error)
+	IsMember(ctx context.Context, chatID, userID uint) (bool, error)
+	FindPrivateChat(ctx context.Context, userID1, userID2 uint) (*entities.Chat, error)
+	GetByPairKey(ctx context.Context, pairKey string) (*entities.Chat, error)
+	SetSlowMode(ctx context.Context, chatID uint, seconds int) error
+	UpdateMemberRole(ctx context.Context, chatID, userID uint, role string) error
+	GetMemberRole(ctx context.Context, chatID, userID uint) (string, error)
+	CountMembers(ctx context.Context, chatID uint) (int64, error)
+	ModifyMemberRole(ctx context.Context, chatID, userID uint, modify func(current string) (string, error)) error
+	SetMemberRoles(ctx context.Context, chatID uint, roles map[uint]string) (map[uint]string, error)
+	RotateKey(ctx context.Context, chatID uint, key string) (int, error)
+	GetKey(ctx context.Context, chatID uint, version int) (*entities.ChatKey, error)
+	GetKeyVersion(ctx context.Context, chatID uint) (int, error)
 }
 
 type MessageRepository interface {
-	Create(message *entities.Message) error
-	GetByID(id uint) (*entities.Message, error)
-	GetChatMessages(chatID uint, limit, offset int) ([]entities.Message, error)
-	Update(message *entities.Message) error
-	Delete(id uint) error
-	GetUserMessages(userID uint, limit, offset int) ([]entities.Message, error)
+	Create(ctx context.Context, message *entities.Message) error
+	CreateWithAttachment(ctx context.Context, message *entities.Message, attachmentID uint) error
+	GetByID(ctx context.Context, id uint) (*entities.Message, error)
+	GetChatMessages(ctx context.Context, chatID uint, limit, offset int) ([]entities.Message, error)
+	GetChatMessagesByType(ctx context.Context, chatID uint, messageTypes []string, limit, offset int) ([]entities.Message, error)
+	GetChatMessagesAfter(ctx context.Context, chatID uint, afterSeq int64, limit int) ([]entities.Message, error)
+	Update(ctx context.Context, message *entities.Message) error
+	Delete(ctx context.Context, id, deletedBy uint) error
+	GetDeletedByID(ctx context.Context, id uint) (*entities.Message, error)
+	Restore(ctx context.Context, id uint) (bool, error)
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
+	GetUserMessages(ctx context.Context, userID uint, limit, offset int) ([]entities.Message, error)
+	GetUserMessagesAfter(ctx context.Context, userID, afterID uint, limit int) ([]entities.Message, error)
+	CreateMentions(ctx context.Context, mentions []entities.MessageMention) error
+	CountUnreadMentionsByChats(ctx context.Context, chatIDs []uint, userID uint) (map[uint]int64, error)
+	MarkMentionsRead(ctx context.Context, chatID, userID uint) error
+	AdvanceStatus(ctx context.Context, messageID uint, status string) (bool, error)
+	CreateReceipt(ctx context.Context, receipt *entities.MessageReceipt) error
+	GetReaders(ctx context.Context, messageID uint) ([]entities.MessageReader, error)
+	CountByChat(ctx context.Context, chatID uint) (int64, error)
+	CountByChats(ctx context.Context, chatIDs []uint) (map[uint]entities.ChatMessageCount, error)
+	CountByChatAndType(ctx context.Context, chatID uint, messageTypes []string) (int64, error)
+	GetTopSender(ctx context.Context, chatID uint) (*entities.SenderMessageCount, error)
+	GetLastSentAt(ctx context.Context, chatID, senderID uint) (*time.Time, error)
+	CountPerDay(ctx context.Context, chatID uint, since time.Time) ([]entities.DailyMessageCount, error)
+}
+
+type AttachmentRepository interface {
+	Create(ctx context.Context, attachment *entities.Attachment) error
+	GetByID(ctx context.Context, id uint) (*entities.Attachment, error)
+	GetThumbnail(ctx context.Context, id uint) (*entities.Attachment, error)
+}
+
+type ReactionRepository interface {
+	Create(ctx context.Context, reaction *entities.MessageReaction) error
+	Delete(ctx context.Context, id, messageID, userID uint) (bool, error)
+	GetByMessage(ctx context.Context, messageID uint) ([]entities.MessageReaction, error)
+}
+
+type ReportRepository interface {
+	Create(ctx context.Context, report *entities.MessageReport) error
+	List(ctx context.Context, status string, limit, offset int) ([]entities.MessageReport, int64, error)
+	UpdateStatus(ctx context.Context, id uint, status string) (bool, error)
 }
 
 type KeyExchangeRepository interface {
-	Create(keyExchange *entities.KeyExchange) error
-	GetByID(id uint) (*entities.KeyExchange, error)
-	GetByUsers(userAID, userBID uint) (*entities.KeyExchange, error)
-	Update(keyExchange *entities.KeyExchange) error
-	Delete(id uint) error
-	DeleteByUsers(userAID, userBID uint) error
-	GetActiveExchanges(userID uint) ([]entities.KeyExchange, error)
-	GetPendingExchanges(userID uint) ([]entities.KeyExchange, error)
-	UpdateStatus(id uint, status string) error
+	Create(ctx context.Context, keyExchange *entities.KeyExchange) error
+	GetByID(ctx context.Context, id uint) (*entities.KeyExchange, error)
+	GetByUsers(ctx context.Context, userAID, userBID uint) (*entities.KeyExchange, error)
+	Update(ctx context.Context, keyExchange *entities.KeyExchange) error
+	Delete(ctx context.Context, id uint) error
+	DeleteByUsers(ctx context.Context, userAID, userBID uint) error
+	GetActiveExchanges(ctx context.Context, userID uint) ([]entities.KeyExchange, error)
+	GetPendingExchanges(ctx context.Context, userID uint) ([]entities.KeyExchange, error)
+	DeleteStale(ctx context.Context, olderThan time.Time, statuses ...string) (int64, error)
+	UpdateStatus(ctx context.Context, id uint, status string) error
 }
 
 type SessionRepository interface {
-	Create(session *entities.Session) error
-	GetByToken(token string) (*entities.Session, error)
-	GetUserSessions(userID uint) ([]entities.Session, error)
-	Update(session *entities.Session) error
-	Delete(token string) error
-	DeleteExpired() error
-	UpdateActivity(token string, lastActivity time.Time) error
+	Create(ctx context.Context, session *entities.Session) error
+	GetByToken(ctx context.Context, token string) (*entities.Session, error)
+	GetUserSessions(ctx context.Context, userID uint, limit, offset int) ([]entities.Session, error)
+	DeleteOldest(ctx context.Context, userID uint, keep int) (int64, error)
+	Update(ctx context.Context, session *entities.Session) error
+	Delete(ctx context.Context, token string) error
+	DeleteExpired(ctx context.Context) error
+	UpdateActivity(ctx context.Context, token string, lastActivity time.Time) error
+}
+
+type AuditLogRepository interface {
+	Create(ctx context.Context, entry *entities.AuditLog) error
+	GetByUser(ctx context.Context, userID uint, limit, offset int) ([]entities.AuditLog, error)
+}
+
+type FailedNotificationRepository interface {
+	Create(ctx context.Context, notification *entities.FailedNotification) error
+	TakeByUser(ctx context.Context, userID uint) ([]entities.FailedNotification, error)
 }
 
 type Repository struct {
@@ -71,4 +161,10 @@ type Repository struct {
 	Message     MessageRepository
 	KeyExchange KeyExchangeRepository
 	Session     SessionRepository
+	Attachment  AttachmentRepository
+	Reaction    ReactionRepository
+	Report      ReportRepository
+	AuditLog    AuditLogRepository
+
+	FailedNotification FailedNotificationRepository
 }
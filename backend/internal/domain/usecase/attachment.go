@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentTooLarge  = errors.New("attachment exceeds maximum size")
+	ErrThumbnailTooLarge   = errors.New("thumbnail exceeds maximum size")
+	ErrThumbnailNotAllowed = errors.New("thumbnails are only supported for image attachments")
+	ErrThumbnailNotFound   = errors.New("attachment has no thumbnail")
+	ErrEmptyAttachment     = errors.New("attachment data is empty")
+)
+
+type AttachmentUseCase struct {
+	attachmentRepo   repository.AttachmentRepository
+	chatRepo         repository.ChatRepository
+	maxSize          int
+	maxThumbnailSize int
+}
+
+// NewAttachmentUseCase - создает новый экземпляр сервиса для работы с вложениями
+func NewAttachmentUseCase(attachmentRepo repository.AttachmentRepository, chatRepo repository.ChatRepository, cfg *config.ChatConfig) *AttachmentUseCase {
+	return &AttachmentUseCase{
+		attachmentRepo:   attachmentRepo,
+		chatRepo:         chatRepo,
+		maxSize:          cfg.MaxAttachmentSize,
+		maxThumbnailSize: cfg.MaxThumbnailSize,
+	}
+}
+
+// UploadAttachmentRequest - вложение, зашифрованное на клиенте; миниатюра также
+// шифруется клиентом, поскольку сервер не может построить ее из зашифрованного файла
+type UploadAttachmentRequest struct {
+	FileName  string `json:"file_name" binding:"required"`
+	MimeType  string `json:"mime_type" binding:"required"`
+	Data      []byte `json:"data" binding:"required"`
+	Thumbnail []byte `json:"thumbnail"`
+}
+
+// UploadAttachment - сохраняет вложение в чате, проверяя членство и ограничения размера
+func (uc *AttachmentUseCase) UploadAttachment(ctx context.Context, chatID, userID uint, req *UploadAttachmentRequest) (*entities.Attachment, error) {
+	if err := uc.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	if len(req.Data) == 0 {
+		return nil, ErrEmptyAttachment
+	}
+	if uc.maxSize > 0 && len(req.Data) > uc.maxSize {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrAttachmentTooLarge, uc.maxSize)
+	}
+
+	if len(req.Thumbnail) > 0 {
+		if !strings.HasPrefix(req.MimeType, "image/") {
+			return nil, ErrThumbnailNotAllowed
+		}
+		if uc.maxThumbnailSize > 0 && len(req.Thumbnail) > uc.maxThumbnailSize {
+			return nil, fmt.Errorf("%w (%d bytes)", ErrThumbnailTooLarge, uc.maxThumbnailSize)
+		}
+	}
+
+	attachment := &entities.Attachment{
+		ChatID:       chatID,
+		UploaderID:   userID,
+		FileName:     req.FileName,
+		MimeType:     req.MimeType,
+		Size:         int64(len(req.Data)),
+		Data:         req.Data,
+		Thumbnail:    req.Thumbnail,
+		HasThumbnail: len(req.Thumbnail) > 0,
+	}
+
+	if err := uc.attachmentRepo.Create(ctx, attachment); err != nil {
+		return nil, fmt.Errorf("failed to save attachment: %v", err)
+	}
+
+	return attachment, nil
+}
+
+// GetAttachment - возвращает вложение участнику чата
+func (uc *AttachmentUseCase) GetAttachment(ctx context.Context, chatID, attachmentID, userID uint) (*entities.Attachment, error) {
+	if err := uc.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	attachment, err := uc.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil || attachment.ChatID != chatID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return attachment, nil
+}
+
+// GetThumbnail - возвращает миниатюру вложения участнику чата без загрузки самого файла
+func (uc *AttachmentUseCase) GetThumbnail(ctx context.Context, chatID, attachmentID, userID uint) (*entities.Attachment, error) {
+	if err := uc.ensureMember(ctx, chatID, userID); err != nil {
+		return nil, err
+	}
+
+	attachment, err := uc.attachmentRepo.GetThumbnail(ctx, attachmentID)
+	if err != nil || attachment.ChatID != chatID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	if !attachment.HasThumbnail {
+		return nil, ErrThumbnailNotFound
+	}
+
+	return attachment, nil
+}
+
+// ensureMember - проверяет, что пользователь состоит в чате
+func (uc *AttachmentUseCase) ensureMember(ctx context.Context, chatID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+	return nil
+}
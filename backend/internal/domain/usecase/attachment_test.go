@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"testing"
+)
+
+// memAttachmentRepo - хранилище вложений в памяти
+type memAttachmentRepo struct {
+	repository.AttachmentRepository
+	attachments map[uint]*entities.Attachment
+}
+
+func (r *memAttachmentRepo) Create(ctx context.Context, attachment *entities.Attachment) error {
+	attachment.ID = uint(len(r.attachments) + 1)
+	copied := *attachment
+	r.attachments[attachment.ID] = &copied
+	return nil
+}
+
+func (r *memAttachmentRepo) GetByID(ctx context.Context, id uint) (*entities.Attachment, error) {
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *attachment
+	return &copied, nil
+}
+
+// GetThumbnail - как и репозиторий, не загружает содержимое самого файла
+func (r *memAttachmentRepo) GetThumbnail(ctx context.Context, id uint) (*entities.Attachment, error) {
+	attachment, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	attachment.Data = nil
+	return attachment, nil
+}
+
+func TestAttachmentThumbnails(t *testing.T) {
+	chats := newMemChatRepo(&memUserRepo{})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 3}, map[uint]string{1: "member", 3: "admin"})
+	uc := NewAttachmentUseCase(&memAttachmentRepo{attachments: make(map[uint]*entities.Attachment)}, chats, &config.ChatConfig{
+		MaxAttachmentSize: 1024,
+		MaxThumbnailSize:  64,
+	})
+	ctx := context.Background()
+
+	image, err := uc.UploadAttachment(ctx, 10, 1, &UploadAttachmentRequest{
+		FileName:  "cat.png",
+		MimeType:  "image/png",
+		Data:      []byte("encrypted image"),
+		Thumbnail: []byte("encrypted thumbnail"),
+	})
+	if err != nil {
+		t.Fatalf("UploadAttachment: %v", err)
+	}
+	if !image.HasThumbnail {
+		t.Fatal("uploaded image has no thumbnail")
+	}
+
+	thumbnail, err := uc.GetThumbnail(ctx, 10, image.ID, 2)
+	if err != nil {
+		t.Fatalf("member GetThumbnail: %v", err)
+	}
+	if !bytes.Equal(thumbnail.Thumbnail, []byte("encrypted thumbnail")) || thumbnail.Data != nil {
+		t.Fatalf("thumbnail = %q, data loaded = %v", thumbnail.Thumbnail, thumbnail.Data != nil)
+	}
+
+	// Не участник чата не получает ни миниатюру, ни файл; запрос через другой чат не находит вложение
+	if _, err := uc.GetThumbnail(ctx, 10, image.ID, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member GetThumbnail: err = %v, want %v", err, ErrNotChatMember)
+	}
+	if _, err := uc.GetAttachment(ctx, 10, image.ID, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member GetAttachment: err = %v, want %v", err, ErrNotChatMember)
+	}
+	if _, err := uc.GetThumbnail(ctx, 11, image.ID, 1); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Fatalf("thumbnail via another chat: err = %v, want %v", err, ErrAttachmentNotFound)
+	}
+
+	document, err := uc.UploadAttachment(ctx, 10, 1, &UploadAttachmentRequest{FileName: "a.pdf", MimeType: "application/pdf", Data: []byte("pdf")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.GetThumbnail(ctx, 10, document.ID, 1); !errors.Is(err, ErrThumbnailNotFound) {
+		t.Fatalf("attachment without thumbnail: err = %v, want %v", err, ErrThumbnailNotFound)
+	}
+
+	tests := []struct {
+		name string
+		req  *UploadAttachmentRequest
+		want error
+	}{
+		{"thumbnail for non-image", &UploadAttachmentRequest{FileName: "a.pdf", MimeType: "application/pdf", Data: []byte("pdf"), Thumbnail: []byte("t")}, ErrThumbnailNotAllowed},
+		{"thumbnail too large", &UploadAttachmentRequest{FileName: "b.png", MimeType: "image/png", Data: []byte("png"), Thumbnail: make([]byte, 65)}, ErrThumbnailTooLarge},
+		{"file too large", &UploadAttachmentRequest{FileName: "c.png", MimeType: "image/png", Data: make([]byte, 1025)}, ErrAttachmentTooLarge},
+	}
+	for _, tt := range tests {
+		if _, err := uc.UploadAttachment(ctx, 10, 1, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
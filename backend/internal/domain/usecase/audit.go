@@ -0,0 +1,74 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/logger"
+)
+
+type clientIPKey struct{}
+
+// WithClientIP - сохраняет IP клиента в контексте запроса для журнала аудита
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext - возвращает IP клиента, сохраненный в контексте, или пустую строку
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// AuditLogger - записывает события безопасности в журнал аудита
+type AuditLogger struct {
+	repo   repository.AuditLogRepository
+	logger *logger.Logger
+}
+
+// NewAuditLogger - создает новый экземпляр журнала аудита
+func NewAuditLogger(repo repository.AuditLogRepository, logger *logger.Logger) *AuditLogger {
+	return &AuditLogger{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record - записывает событие пользователя; IP берется из контекста. Ошибка записи только
+// логируется, чтобы сбой журнала не прерывал само действие
+func (a *AuditLogger) Record(ctx context.Context, userID uint, action entities.AuditAction, metadata map[string]interface{}) {
+	if a == nil {
+		return
+	}
+
+	entry := &entities.AuditLog{
+		UserID: userID,
+		Action: action,
+		IP:     ClientIPFromContext(ctx),
+	}
+
+	if len(metadata) > 0 {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			a.logger.Errorf("Failed to marshal audit metadata for %s: %v", action, err)
+		} else {
+			entry.Metadata = string(data)
+		}
+	}
+
+	if err := a.repo.Create(ctx, entry); err != nil {
+		a.logger.Errorf("Failed to write audit log %s for user %d: %v", action, userID, err)
+	}
+}
+
+// GetUserEvents - возвращает события безопасности пользователя, начиная с самых новых
+func (a *AuditLogger) GetUserEvents(ctx context.Context, userID uint, limit, offset int) ([]entities.AuditLog, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return a.repo.GetByUser(ctx, userID, limit, offset)
+}
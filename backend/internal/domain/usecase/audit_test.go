@@ -0,0 +1,71 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"sync"
+	"testing"
+)
+
+// memAuditRepo - журнал аудита в памяти
+type memAuditRepo struct {
+	repository.AuditLogRepository
+	mu      sync.Mutex
+	entries []entities.AuditLog
+}
+
+func (r *memAuditRepo) Create(ctx context.Context, entry *entities.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+func TestLoginWritesAuditEntryWithClientIP(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: newPasswordUser(t, 1, "alice")}}
+	audit := &memAuditRepo{}
+	jwtCfg := config.JWTConfig{Secret: "test-secret"}
+	uc := NewAuthUseCase(users, newMemSessionRepo(), &jwtCfg, &config.KeysConfig{}, &config.AdminConfig{}, NewAuditLogger(audit, logger.New()))
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+
+	if _, err := uc.Login(ctx, &LoginRequest{Username: "alice", Password: "secret"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := uc.Login(ctx, &LoginRequest{Username: "alice", Password: "wrong"}); err == nil {
+		t.Fatal("login with a wrong password succeeded")
+	}
+
+	if len(audit.entries) != 2 {
+		t.Fatalf("%d audit entries, want 2", len(audit.entries))
+	}
+	for i, want := range []entities.AuditAction{entities.AuditActionLogin, entities.AuditActionLoginFailed} {
+		entry := audit.entries[i]
+		if entry.Action != want || entry.UserID != 1 || entry.IP != "203.0.113.7" {
+			t.Errorf("entry %d = %s for user %d from %q, want %s for user 1 from 203.0.113.7", i, entry.Action, entry.UserID, entry.IP, want)
+		}
+	}
+}
+
+func TestAuditLoggerRecordsMetadata(t *testing.T) {
+	audit := &memAuditRepo{}
+	auditLogger := NewAuditLogger(audit, logger.New())
+
+	auditLogger.Record(context.Background(), 1, entities.AuditActionSessionRevoked, map[string]interface{}{"session_id": "abc"})
+
+	var metadata map[string]string
+	if err := json.Unmarshal([]byte(audit.entries[0].Metadata), &metadata); err != nil {
+		t.Fatalf("metadata %q: %v", audit.entries[0].Metadata, err)
+	}
+	if metadata["session_id"] != "abc" {
+		t.Fatalf("metadata = %v", metadata)
+	}
+
+	// Сервисы без журнала аудита вызывают Record у nil
+	var disabled *AuditLogger
+	disabled.Record(context.Background(), 1, entities.AuditActionLogin, nil)
+}
@@ -1,12 +1,15 @@
 package usecase
 
 import (
+	"context"
 	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,34 +18,68 @@ import (
 )
 
 type AuthUseCase struct {
-	userRepo    repository.UserRepository
-	sessionRepo repository.SessionRepository
-	jwtSecret   string
+	userRepo      repository.UserRepository
+	sessionRepo   repository.SessionRepository
+	jwtSecret     string
+	guestTokenTTL time.Duration
+	maxSessions   int
+	idleTimeout   time.Duration
+	keysCfg       *config.KeysConfig
+	admins        map[uint]bool
+	audit         *AuditLogger
 }
 
+// guestTokenType - значение claim "typ" гостевого токена; такие токены не принимаются как пользовательские
+const guestTokenType = "guest"
+
+// ErrInvalidGuestToken - гостевой токен поврежден, просрочен или выдан не для гостевого доступа
+var ErrInvalidGuestToken = errors.New("invalid or expired guest token")
+
+// ErrSessionIdle - сессией не пользовались дольше SESSION_IDLE_TIMEOUT, пользователь должен войти заново
+var ErrSessionIdle = errors.New("session expired due to inactivity")
+
 // NewAuthUseCase - создает новый экземпляр сервиса аутентификации
-func NewAuthUseCase(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, jwtSecret string) *AuthUseCase {
+func NewAuthUseCase(userRepo repository.UserRepository, sessionRepo repository.SessionRepository, jwtCfg *config.JWTConfig, keysCfg *config.KeysConfig, adminCfg *config.AdminConfig, audit *AuditLogger) *AuthUseCase {
+	admins := make(map[uint]bool, len(adminCfg.UserIDs))
+	for _, id := range adminCfg.UserIDs {
+		admins[id] = true
+	}
+
 	return &AuthUseCase{
-		userRepo:    userRepo,
-		sessionRepo: sessionRepo,
-		jwtSecret:   jwtSecret,
+		userRepo:      userRepo,
+		sessionRepo:   sessionRepo,
+		jwtSecret:     jwtCfg.Secret,
+		guestTokenTTL: jwtCfg.GuestTokenTTL,
+		maxSessions:   jwtCfg.MaxSessionsPerUser,
+		idleTimeout:   jwtCfg.SessionIdleTimeout,
+		keysCfg:       keysCfg,
+		admins:        admins,
+		audit:         audit,
 	}
 }
 
 type RegisterRequest struct {
-	Username       string `json:"username" binding:"required,min=3,max=50,alphanum"`
-	Email          string `json:"email" binding:"required,email"`
+	Username string `json:"username" binding:"required,min=3,max=50,alphanum"`
+	// Email проверяется и нормализуется в Register, чтобы адрес с пробелами по краям не отклонялся
+	Email          string `json:"email" binding:"required"`
 	Password       string `json:"password" binding:"required,min=6"`
 	ECDSAPublicKey string `json:"ecdsaPublicKey" binding:"required"`
 	RSAPublicKey   string `json:"rsaPublicKey" binding:"required"`
+	// X25519PublicKey - необязательный hex публичного ключа X25519 для клиентских ключей
+	X25519PublicKey string `json:"x25519PublicKey"`
 }
 
+// LoginRequest - данные для входа. ECDHPublicKey - эфемерный ключ сессии и не сверяется.
+// ECDSAPublicKey и RSAPublicKey обязательны для пользователей, хранящих ключи на клиенте, и
+// необязательны для остальных; переданные ключи обязаны совпадать с ключами, зарегистрированными
+// за пользователем. Вход по паролю никогда не заменяет ключи идентичности: иначе злоумышленник,
+// узнавший пароль, мог бы незаметно подменить их
 type LoginRequest struct {
 	Username       string `json:"username" binding:"required"`
 	Password       string `json:"password" binding:"required"`
-	ECDHPublicKey  string `json:"ecdhPublicKey" binding:"required"`
-	ECDSAPublicKey string `json:"ecdsaPublicKey" binding:"required"`
-	RSAPublicKey   string `json:"rsaPublicKey" binding:"required"`
+	ECDHPublicKey  string `json:"ecdhPublicKey"`
+	ECDSAPublicKey string `json:"ecdsaPublicKey"`
+	RSAPublicKey   string `json:"rsaPublicKey"`
 }
 
 type AuthResponse struct {
@@ -55,18 +92,26 @@ type AuthResponse struct {
 type ChangePasswordRequest struct {
 	OldPassword string `json:"oldPassword" binding:"required"`
 	NewPassword string `json:"newPassword" binding:"required,min=6"`
+	// RevokeOtherSessions - завершить все сессии, кроме текущей (по умолчанию true)
+	RevokeOtherSessions *bool `json:"revokeOtherSessions"`
+}
+
+// ChangeProfileRequest - новые имя пользователя и/или email; незаданные поля не меняются
+type ChangeProfileRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=3,max=50,alphanum"`
+	Email    *string `json:"email"`
 }
 
 // Register - регистрирует нового пользователя в системе
-func (uc *AuthUseCase) Register(req *RegisterRequest) (*AuthResponse, error) {
-	existingUser, _ := uc.userRepo.GetByUsername(req.Username)
-	if existingUser != nil {
-		return nil, errors.New("USERNAME_ALREADY_EXISTS")
+func (uc *AuthUseCase) Register(ctx context.Context, req *RegisterRequest) (*AuthResponse, error) {
+	email, err := entities.NormalizeEmail(req.Email)
+	if err != nil {
+		return nil, errors.New("INVALID_EMAIL")
 	}
+	req.Email = email
 
-	existingUser, _ = uc.userRepo.GetByEmail(req.Email)
-	if existingUser != nil {
-		return nil, errors.New("EMAIL_ALREADY_EXISTS")
+	if err := uc.ensureIdentityAvailable(ctx, req.Username, req.Email, 0); err != nil {
+		return nil, err
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -74,39 +119,33 @@ func (uc *AuthUseCase) Register(req *RegisterRequest) (*AuthResponse, error) {
 		return nil, fmt.Errorf("failed to hash password: %v", err)
 	}
 
-	ecdsaPriv, ecdsaPub, err := crypto.GenerateECDSAKeys()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate ECDSA keys: %v", err)
-	}
-	rsaPriv, rsaPub, err := crypto.GenerateRSAKeys()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate RSA keys: %v", err)
+	user := &entities.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: string(hashedPassword),
+		IsOnline:     false,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	ecdsaPrivateKeyPEM, err := crypto.SerializeECDSAPrivateKey(ecdsaPriv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize ECDSA private key: %v", err)
-	}
+	if uc.keysCfg.ServerHoldsKeys {
+		if err := assignServerKeys(user); err != nil {
+			return nil, err
+		}
+	} else {
+		// Клиентские ключи: сервер хранит только публичную часть и не может подписывать или расшифровывать
+		if err := validateClientPublicKeys(req); err != nil {
+			return nil, err
+		}
 
-	rsaPrivateKeyPEM, err := crypto.SerializeRSAPrivateKey(rsaPriv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize RSA private key: %v", err)
+		serverHoldsKeys := false
+		user.ECDSAPublicKey = req.ECDSAPublicKey
+		user.RSAPublicKey = req.RSAPublicKey
+		user.X25519PublicKey = req.X25519PublicKey
+		user.ServerHoldsKeys = &serverHoldsKeys
 	}
 
-	user := &entities.User{
-		Username:        req.Username,
-		Email:           req.Email,
-		PasswordHash:    string(hashedPassword),
-		ECDSAPublicKey:  hex.EncodeToString(ecdsaPub),
-		RSAPublicKey:    hex.EncodeToString(rsaPub),
-		ECDSAPrivateKey: string(ecdsaPrivateKeyPEM),
-		RSAPrivateKey:   string(rsaPrivateKeyPEM),
-		IsOnline:        false,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}
-
-	if err := uc.userRepo.Create(user); err != nil {
+	if err := uc.userRepo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
@@ -123,12 +162,10 @@ func (uc *AuthUseCase) Register(req *RegisterRequest) (*AuthResponse, error) {
 		LastActivity: time.Now(),
 	}
 
-	if err := uc.sessionRepo.Create(session); err != nil {
+	if err := uc.sessionRepo.Create(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %v", err)
 	}
-
-	_ = ecdsaPriv
-	_ = rsaPriv
+	uc.pruneSessions(ctx, user.ID)
 
 	return &AuthResponse{
 		User:      user,
@@ -137,17 +174,162 @@ func (uc *AuthUseCase) Register(req *RegisterRequest) (*AuthResponse, error) {
 	}, nil
 }
 
+// validateClientPublicKeys - проверяет, что переданные при регистрации ключи декодируются из hex
+// и разбираются как ключи нужного типа; иначе ошибка расшифровки проявилась бы только позже
+func validateClientPublicKeys(req *RegisterRequest) error {
+	ecdsaPublicKeyBytes, err := hex.DecodeString(req.ECDSAPublicKey)
+	if err != nil {
+		return errors.New("INVALID_ECDSA_PUBLIC_KEY")
+	}
+	if _, err := crypto.ParseP256PublicKey(ecdsaPublicKeyBytes); err != nil {
+		return errors.New("INVALID_ECDSA_PUBLIC_KEY")
+	}
+
+	rsaPublicKeyBytes, err := hex.DecodeString(req.RSAPublicKey)
+	if err != nil {
+		return errors.New("INVALID_RSA_PUBLIC_KEY")
+	}
+	if _, err := crypto.ParseRSAPublicKey(rsaPublicKeyBytes); err != nil {
+		return errors.New("INVALID_RSA_PUBLIC_KEY")
+	}
+
+	if req.X25519PublicKey != "" {
+		x25519PublicKeyBytes, err := hex.DecodeString(req.X25519PublicKey)
+		if err != nil {
+			return errors.New("INVALID_X25519_PUBLIC_KEY")
+		}
+		if _, err := crypto.ParseX25519PublicKey(x25519PublicKeyBytes); err != nil {
+			return errors.New("INVALID_X25519_PUBLIC_KEY")
+		}
+	}
+
+	return nil
+}
+
+// assignServerKeys - генерирует пары ключей ECDSA, RSA и X25519 и сохраняет их на стороне сервера
+func assignServerKeys(user *entities.User) error {
+	ecdsaPriv, ecdsaPub, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		return fmt.Errorf("failed to generate ECDSA keys: %v", err)
+	}
+	rsaPriv, rsaPub, err := crypto.GenerateRSAKeys()
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA keys: %v", err)
+	}
+	x25519Priv, x25519Pub, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		return fmt.Errorf("failed to generate X25519 keys: %v", err)
+	}
+
+	ecdsaPrivateKeyPEM, err := crypto.SerializeECDSAPrivateKey(ecdsaPriv)
+	if err != nil {
+		return fmt.Errorf("failed to serialize ECDSA private key: %v", err)
+	}
+
+	rsaPrivateKeyPEM, err := crypto.SerializeRSAPrivateKey(rsaPriv)
+	if err != nil {
+		return fmt.Errorf("failed to serialize RSA private key: %v", err)
+	}
+
+	x25519PrivateKeyPEM, err := crypto.SerializeX25519PrivateKey(x25519Priv)
+	if err != nil {
+		return fmt.Errorf("failed to serialize X25519 private key: %v", err)
+	}
+
+	user.ECDSAPublicKey = hex.EncodeToString(ecdsaPub)
+	user.RSAPublicKey = hex.EncodeToString(rsaPub)
+	user.ECDSAPrivateKey = string(ecdsaPrivateKeyPEM)
+	user.RSAPrivateKey = string(rsaPrivateKeyPEM)
+	user.X25519PublicKey = hex.EncodeToString(x25519Pub)
+	user.X25519PrivateKey = string(x25519PrivateKeyPEM)
+	return nil
+}
+
+// ensureIdentityAvailable - проверяет без учета регистра, что имя пользователя и email свободны;
+// пустые значения не проверяются, excludeUserID исключает собственную запись пользователя
+func (uc *AuthUseCase) ensureIdentityAvailable(ctx context.Context, username, email string, excludeUserID uint) error {
+	if username != "" {
+		taken, err := uc.userRepo.IsUsernameTaken(ctx, username, excludeUserID)
+		if err != nil {
+			return fmt.Errorf("failed to check username: %v", err)
+		}
+		if taken {
+			return errors.New("USERNAME_ALREADY_EXISTS")
+		}
+	}
+
+	if email != "" {
+		taken, err := uc.userRepo.IsEmailTaken(ctx, email, excludeUserID)
+		if err != nil {
+			return fmt.Errorf("failed to check email: %v", err)
+		}
+		if taken {
+			return errors.New("EMAIL_ALREADY_EXISTS")
+		}
+	}
+
+	return nil
+}
+
+// ChangeProfile - изменяет имя пользователя и/или email с теми же проверками уникальности, что и при регистрации
+func (uc *AuthUseCase) ChangeProfile(ctx context.Context, userID uint, req *ChangeProfileRequest) (*entities.User, error) {
+	if req.Username == nil && req.Email == nil {
+		return nil, errors.New("NO_PROFILE_CHANGES")
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("USER_NOT_FOUND")
+	}
+
+	var username, email string
+	if req.Username != nil {
+		username = *req.Username
+	}
+	if req.Email != nil {
+		email, err = entities.NormalizeEmail(*req.Email)
+		if err != nil {
+			return nil, errors.New("INVALID_EMAIL")
+		}
+	}
+
+	if err := uc.ensureIdentityAvailable(ctx, username, email, userID); err != nil {
+		return nil, err
+	}
+
+	if username != "" {
+		user.Username = username
+	}
+	if email != "" {
+		user.Email = email
+	}
+
+	if err := uc.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %v", err)
+	}
+
+	return user, nil
+}
+
 // Login - выполняет аутентификацию пользователя в системе
-func (uc *AuthUseCase) Login(req *LoginRequest) (*AuthResponse, error) {
-	user, err := uc.userRepo.GetByUsername(req.Username)
+func (uc *AuthUseCase) Login(ctx context.Context, req *LoginRequest) (*AuthResponse, error) {
+	user, err := uc.userRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
 		return nil, errors.New("INVALID_CREDENTIALS")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		uc.audit.Record(ctx, user.ID, entities.AuditActionLoginFailed, nil)
 		return nil, errors.New("INVALID_CREDENTIALS")
 	}
 
+	if err := verifyIdentityKeys(req, user); err != nil {
+		uc.audit.Record(ctx, user.ID, entities.AuditActionLoginFailed, map[string]interface{}{
+			"reason": err.Error(),
+		})
+		return nil, err
+	}
+
 	token, expiresAt, err := uc.generateJWT(user.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %v", err)
@@ -161,14 +343,17 @@ func (uc *AuthUseCase) Login(req *LoginRequest) (*AuthResponse, error) {
 		LastActivity: time.Now(),
 	}
 
-	if err := uc.sessionRepo.Create(session); err != nil {
+	if err := uc.sessionRepo.Create(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %v", err)
 	}
+	uc.pruneSessions(ctx, user.ID)
 
-	if err := uc.userRepo.UpdateOnlineStatus(user.ID, true); err != nil {
+	if err := uc.userRepo.UpdateOnlineStatus(ctx, user.ID, true); err != nil {
 		fmt.Printf("Failed to update online status: %v\n", err)
 	}
 
+	uc.audit.Record(ctx, user.ID, entities.AuditActionLogin, nil)
+
 	return &AuthResponse{
 		User:      user,
 		Token:     token,
@@ -176,22 +361,89 @@ func (uc *AuthUseCase) Login(req *LoginRequest) (*AuthResponse, error) {
 	}, nil
 }
 
+// pruneSessions - удаляет самые старые сессии пользователя сверх MAX_SESSIONS_PER_USER;
+// ошибка очистки не мешает входу, лишние сессии будут удалены при следующем входе
+func (uc *AuthUseCase) pruneSessions(ctx context.Context, userID uint) {
+	if uc.maxSessions <= 0 {
+		return
+	}
+
+	evicted, err := uc.sessionRepo.DeleteOldest(ctx, userID, uc.maxSessions)
+	if err != nil {
+		fmt.Printf("Failed to prune sessions: %v\n", err)
+		return
+	}
+	if evicted > 0 {
+		uc.audit.Record(ctx, userID, entities.AuditActionSessionRevoked, map[string]interface{}{
+			"reason": "session_limit",
+			"count":  evicted,
+		})
+	}
+}
+
+// expireIdleSession - завершает простаивавшую сессию: удаляет ее и снимает отметку "в сети";
+// ошибки только логируются, токен в любом случае отклоняется
+func (uc *AuthUseCase) expireIdleSession(ctx context.Context, session *entities.Session) {
+	if err := uc.sessionRepo.Delete(ctx, session.Token); err != nil {
+		fmt.Printf("Failed to delete idle session: %v\n", err)
+		return
+	}
+
+	if err := uc.userRepo.UpdateOnlineStatus(ctx, session.UserID, false); err != nil {
+		fmt.Printf("Failed to update online status: %v\n", err)
+	}
+
+	uc.audit.Record(ctx, session.UserID, entities.AuditActionSessionRevoked, map[string]interface{}{
+		"reason": "idle_timeout",
+	})
+}
+
+// verifyIdentityKeys - сверяет переданные при входе ключи идентичности с зарегистрированными.
+// Пользователь, который хранит ключи на клиенте, обязан передать оба ключа: только так вход
+// подтверждает, что клиент владеет ключами, которыми подписаны его сообщения. Для пользователей
+// с ключами на сервере ключи необязательны, но переданные все равно должны совпадать
+func verifyIdentityKeys(req *LoginRequest, user *entities.User) error {
+	ecdsaKey := strings.TrimSpace(req.ECDSAPublicKey)
+	rsaKey := strings.TrimSpace(req.RSAPublicKey)
+
+	if !user.HoldsServerKeys() && (ecdsaKey == "" || rsaKey == "") {
+		return errors.New("PUBLIC_KEYS_REQUIRED")
+	}
+	if !publicKeyMatches(ecdsaKey, user.ECDSAPublicKey) || !publicKeyMatches(rsaKey, user.RSAPublicKey) {
+		return errors.New("PUBLIC_KEY_MISMATCH")
+	}
+	return nil
+}
+
+// publicKeyMatches - сравнивает переданный клиентом ключ с зарегистрированным; пустой ключ не проверяется
+func publicKeyMatches(provided, registered string) bool {
+	if provided == "" {
+		return true
+	}
+	return strings.EqualFold(provided, registered)
+}
+
 // Logout - выполняет выход пользователя из системы
-func (uc *AuthUseCase) Logout(token string) error {
-	session, err := uc.sessionRepo.GetByToken(token)
+func (uc *AuthUseCase) Logout(ctx context.Context, token string) error {
+	session, err := uc.sessionRepo.GetByToken(ctx, token)
 	if err != nil {
 		return err
 	}
 
-	if err := uc.userRepo.UpdateOnlineStatus(session.UserID, false); err != nil {
+	if err := uc.userRepo.UpdateOnlineStatus(ctx, session.UserID, false); err != nil {
 		fmt.Printf("Failed to update online status: %v\n", err)
 	}
 
-	return uc.sessionRepo.Delete(token)
+	if err := uc.sessionRepo.Delete(ctx, token); err != nil {
+		return err
+	}
+
+	uc.audit.Record(ctx, session.UserID, entities.AuditActionLogout, nil)
+	return nil
 }
 
 // ValidateToken - проверяет валидность JWT токена и возвращает данные пользователя
-func (uc *AuthUseCase) ValidateToken(tokenString string) (*entities.User, error) {
+func (uc *AuthUseCase) ValidateToken(ctx context.Context, tokenString string) (*entities.User, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -204,20 +456,35 @@ func (uc *AuthUseCase) ValidateToken(tokenString string) (*entities.User, error)
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := uint(claims["user_id"].(float64))
+		// Гостевой токен подписан тем же ключом, но не дает прав пользователя
+		rawUserID, ok := claims["user_id"].(float64)
+		if !ok || claims["typ"] == guestTokenType {
+			return nil, errors.New("invalid token")
+		}
+		userID := uint(rawUserID)
 
-		session, err := uc.sessionRepo.GetByToken(tokenString)
+		session, err := uc.sessionRepo.GetByToken(ctx, tokenString)
 		if err != nil {
 			return nil, errors.New("session not found")
 		}
 
-		if session.ExpiresAt.Before(time.Now()) {
+		now := time.Now()
+		if session.ExpiresAt.Before(now) {
 			return nil, errors.New("token expired")
 		}
 
-		uc.sessionRepo.UpdateActivity(tokenString, time.Now())
+		lastActivity := session.LastActivity
+		if lastActivity.IsZero() {
+			lastActivity = session.CreatedAt
+		}
+		if uc.idleTimeout > 0 && now.Sub(lastActivity) > uc.idleTimeout {
+			uc.expireIdleSession(ctx, session)
+			return nil, ErrSessionIdle
+		}
+
+		uc.sessionRepo.UpdateActivity(ctx, tokenString, now)
 
-		return uc.userRepo.GetByID(userID)
+		return uc.userRepo.GetByID(ctx, userID)
 	}
 
 	return nil, errors.New("invalid token")
@@ -243,8 +510,55 @@ func (uc *AuthUseCase) generateJWT(userID uint) (string, time.Time, error) {
 	return tokenString, expiresAt, nil
 }
 
-func (uc *AuthUseCase) ChangePassword(userID uint, req *ChangePasswordRequest) error {
-	user, err := uc.userRepo.GetByID(userID)
+// IssueGuestToken - выпускает подписанный гостевой токен, дающий доступ только на чтение к одному чату.
+// Токен не хранится в сессиях и действует до истечения срока
+func (uc *AuthUseCase) IssueGuestToken(chatID uint) (string, time.Time, error) {
+	expiresAt := time.Now().Add(uc.guestTokenTTL)
+
+	claims := jwt.MapClaims{
+		"typ":     guestTokenType,
+		"chat_id": chatID,
+		"exp":     expiresAt.Unix(),
+		"iat":     time.Now().Unix(),
+		"jti":     uuid.New().String(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(uc.jwtSecret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return tokenString, expiresAt, nil
+}
+
+// ValidateGuestToken - проверяет гостевой токен и возвращает ID чата, к которому он дает доступ
+func (uc *AuthUseCase) ValidateGuestToken(tokenString string) (uint, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(uc.jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidGuestToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != guestTokenType {
+		return 0, ErrInvalidGuestToken
+	}
+
+	chatID, ok := claims["chat_id"].(float64)
+	if !ok || chatID <= 0 {
+		return 0, ErrInvalidGuestToken
+	}
+
+	return uint(chatID), nil
+}
+
+func (uc *AuthUseCase) ChangePassword(ctx context.Context, userID uint, currentToken string, req *ChangePasswordRequest) error {
+	user, err := uc.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return errors.New("user not found")
 	}
@@ -262,9 +576,92 @@ func (uc *AuthUseCase) ChangePassword(userID uint, req *ChangePasswordRequest) e
 		return fmt.Errorf("failed to hash password: %v", err)
 	}
 
-	if err := uc.userRepo.UpdatePassword(userID, string(hashedPassword)); err != nil {
+	if err := uc.userRepo.UpdatePassword(ctx, userID, string(hashedPassword)); err != nil {
 		return fmt.Errorf("failed to update password: %v", err)
 	}
 
+	revokeOthers := req.RevokeOtherSessions == nil || *req.RevokeOtherSessions
+	uc.audit.Record(ctx, userID, entities.AuditActionPasswordChanged, map[string]interface{}{
+		"revoke_other_sessions": revokeOthers,
+	})
+
+	if revokeOthers {
+		revoked, err := uc.revokeOtherSessions(ctx, userID, currentToken)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %v", err)
+		}
+		if revoked > 0 {
+			uc.audit.Record(ctx, userID, entities.AuditActionSessionRevoked, map[string]interface{}{
+				"reason": "password_changed",
+				"count":  revoked,
+			})
+		}
+	}
+
 	return nil
 }
+
+// IsAdmin - проверяет, есть ли у пользователя доступ к административным маршрутам
+func (uc *AuthUseCase) IsAdmin(userID uint) bool {
+	return uc.admins[userID]
+}
+
+// GetAuditLog - возвращает события безопасности пользователя
+func (uc *AuthUseCase) GetAuditLog(ctx context.Context, userID uint, limit, offset int) ([]entities.AuditLog, error) {
+	return uc.audit.GetUserEvents(ctx, userID, limit, offset)
+}
+
+// ExportedSession - сессия в выгрузке данных пользователя; токен сессии не включается
+type ExportedSession struct {
+	ID           uint      `json:"id"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// ExportSessions - возвращает сессии пользователя для выгрузки его данных и фиксирует выгрузку
+// в журнале аудита
+func (uc *AuthUseCase) ExportSessions(ctx context.Context, userID uint) ([]ExportedSession, error) {
+	sessions, err := uc.sessionRepo.GetUserSessions(ctx, userID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]ExportedSession, len(sessions))
+	for i, session := range sessions {
+		exported[i] = ExportedSession{
+			ID:           session.ID,
+			IsActive:     session.IsActive,
+			CreatedAt:    session.CreatedAt,
+			LastActivity: session.LastActivity,
+			ExpiresAt:    session.ExpiresAt,
+		}
+	}
+
+	uc.audit.Record(ctx, userID, entities.AuditActionDataExported, nil)
+
+	return exported, nil
+}
+
+// revokeOtherSessions - удаляет все сессии пользователя, кроме сессии с указанным токеном,
+// и возвращает количество удаленных сессий
+func (uc *AuthUseCase) revokeOtherSessions(ctx context.Context, userID uint, keepToken string) (int, error) {
+	sessions, err := uc.sessionRepo.GetUserSessions(ctx, userID, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.Token == keepToken {
+			continue
+		}
+		if err := uc.sessionRepo.Delete(ctx, session.Token); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+
+	return revoked, nil
+}
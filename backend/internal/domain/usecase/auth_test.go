@@ -0,0 +1,510 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memSessionRepo - хранилище сессий в памяти
+type memSessionRepo struct {
+	repository.SessionRepository
+	mu       sync.Mutex
+	sessions map[string]*entities.Session
+}
+
+func newMemSessionRepo() *memSessionRepo {
+	return &memSessionRepo{sessions: make(map[string]*entities.Session)}
+}
+
+func (r *memSessionRepo) Create(ctx context.Context, session *entities.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session.ID = uint(len(r.sessions) + 1)
+	copied := *session
+	r.sessions[session.Token] = &copied
+	return nil
+}
+
+func (r *memSessionRepo) GetByToken(ctx context.Context, token string) (*entities.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[token]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+// GetUserSessions - сессии пользователя от новых к старым, как в репозитории
+func (r *memSessionRepo) GetUserSessions(ctx context.Context, userID uint, limit, offset int) ([]entities.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []entities.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID > sessions[j].ID })
+	return sessions, nil
+}
+
+func (r *memSessionRepo) DeleteOldest(ctx context.Context, userID uint, keep int) (int64, error) {
+	sessions, _ := r.GetUserSessions(ctx, userID, 0, 0)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var evicted int64
+	for i := keep; i < len(sessions); i++ {
+		delete(r.sessions, sessions[i].Token)
+		evicted++
+	}
+	return evicted, nil
+}
+
+func (r *memSessionRepo) Delete(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, token)
+	return nil
+}
+
+func (r *memSessionRepo) Update(ctx context.Context, session *entities.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *session
+	r.sessions[session.Token] = &copied
+	return nil
+}
+
+func (r *memSessionRepo) UpdateActivity(ctx context.Context, token string, lastActivity time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[token]; ok {
+		session.LastActivity = lastActivity
+	}
+	return nil
+}
+
+// newPasswordUser - пользователь с паролем "secret", хешированным с минимальной стоимостью
+func newPasswordUser(t *testing.T, id uint, username string) *entities.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &entities.User{ID: id, Username: username, PasswordHash: string(hash)}
+}
+
+func newTestAuthUseCase(users *memUserRepo, sessions repository.SessionRepository, jwtCfg config.JWTConfig) *AuthUseCase {
+	jwtCfg.Secret = "test-secret"
+	return NewAuthUseCase(users, sessions, &jwtCfg, &config.KeysConfig{}, &config.AdminConfig{}, nil)
+}
+
+func login(t *testing.T, uc *AuthUseCase, username string) string {
+	t.Helper()
+
+	result, err := uc.Login(context.Background(), &LoginRequest{Username: username, Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login(%s): %v", username, err)
+	}
+	return result.Token
+}
+
+func TestLoginVerifiesIdentityKeys(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "server", PasswordHash: string(hash), ECDSAPublicKey: "aa01", RSAPublicKey: "bb01"},
+		2: {ID: 2, Username: "client", PasswordHash: string(hash), ECDSAPublicKey: "aa02", RSAPublicKey: "bb02", ServerHoldsKeys: serverHoldsKeys(false)},
+	}}
+	uc := NewAuthUseCase(users, &fakeSessions{}, &config.JWTConfig{Secret: "test-secret", ExpiresIn: time.Hour}, &config.KeysConfig{}, &config.AdminConfig{}, nil)
+
+	tests := []struct {
+		name     string
+		username string
+		ecdsa    string
+		rsa      string
+		wantErr  string
+	}{
+		{"server keys, none sent", "server", "", "", ""},
+		{"server keys, matching", "server", "AA01", "bb01", ""},
+		{"server keys, mismatch", "server", "aa01", "ff", "PUBLIC_KEY_MISMATCH"},
+		{"client keys, none sent", "client", "", "", "PUBLIC_KEYS_REQUIRED"},
+		{"client keys, one sent", "client", "aa02", "", "PUBLIC_KEYS_REQUIRED"},
+		{"client keys, mismatch", "client", "aa02", "bb01", "PUBLIC_KEY_MISMATCH"},
+		{"client keys, matching", "client", " aa02 ", "BB02", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := uc.Login(context.Background(), &LoginRequest{
+				Username:       tt.username,
+				Password:       "secret",
+				ECDSAPublicKey: tt.ecdsa,
+				RSAPublicKey:   tt.rsa,
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if result.Token == "" {
+				t.Fatal("no token issued")
+			}
+		})
+	}
+}
+
+func TestRegisterStoresX25519KeyPair(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{}}
+	uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{ExpiresIn: time.Hour})
+	uc.keysCfg.ServerHoldsKeys = true
+	ctx := context.Background()
+
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := uc.Register(ctx, &RegisterRequest{Username: username, Email: username + "@example.com", Password: "secret"}); err != nil {
+			t.Fatalf("Register(%s): %v", username, err)
+		}
+	}
+	alice, bob := users.users[1], users.users[2]
+	if alice.ECDSAPrivateKey == "" || alice.RSAPrivateKey == "" {
+		t.Fatal("server-held ECDSA/RSA keys were not assigned")
+	}
+
+	// Пара X25519 создается при регистрации рядом с ключами ECDSA и RSA
+	privateKeys := make([]*ecdh.PrivateKey, 0, 2)
+	for _, user := range []*entities.User{alice, bob} {
+		privateKey, err := crypto.DeserializeX25519PrivateKey([]byte(user.X25519PrivateKey))
+		if err != nil {
+			t.Fatalf("%s: stored X25519 private key: %v", user.Username, err)
+		}
+		if hex.EncodeToString(privateKey.PublicKey().Bytes()) != user.X25519PublicKey {
+			t.Fatalf("%s: stored public key does not match the private key", user.Username)
+		}
+		privateKeys = append(privateKeys, privateKey)
+	}
+
+	// Сохраненные ключи дают одинаковый общий секрет с обеих сторон
+	alicePublic, _ := hex.DecodeString(alice.X25519PublicKey)
+	bobPublic, _ := hex.DecodeString(bob.X25519PublicKey)
+	aliceSecret, err := crypto.X25519SharedSecret(privateKeys[0], bobPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobSecret, err := crypto.X25519SharedSecret(privateKeys[1], alicePublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aliceSecret, bobSecret) {
+		t.Fatal("stored X25519 keys derived different secrets")
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	for _, revoke := range []bool{true, false} {
+		users := &memUserRepo{users: map[uint]*entities.User{1: newPasswordUser(t, 1, "alice")}}
+		uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{})
+		ctx := context.Background()
+
+		current := login(t, uc, "alice")
+		other := login(t, uc, "alice")
+
+		if err := uc.ChangePassword(ctx, 1, current, &ChangePasswordRequest{OldPassword: "secret", NewPassword: "secret2", RevokeOtherSessions: &revoke}); err != nil {
+			t.Fatalf("ChangePassword: %v", err)
+		}
+
+		if _, err := uc.ValidateToken(ctx, current); err != nil {
+			t.Fatalf("revoke=%v: current session rejected: %v", revoke, err)
+		}
+		_, err := uc.ValidateToken(ctx, other)
+		if revoke && err == nil {
+			t.Fatal("token issued before the password change is still valid")
+		}
+		if !revoke && err != nil {
+			t.Fatalf("revoke=false: other session rejected: %v", err)
+		}
+	}
+}
+
+func TestLoginEvictsOldestSessionBeyondLimit(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: newPasswordUser(t, 1, "alice")}}
+	sessions := newMemSessionRepo()
+	uc := newTestAuthUseCase(users, sessions, config.JWTConfig{MaxSessionsPerUser: 3})
+	ctx := context.Background()
+
+	tokens := make([]string, 4)
+	for i := range tokens {
+		tokens[i] = login(t, uc, "alice")
+	}
+
+	// Четвертый вход вытесняет самую старую сессию, остальные продолжают действовать
+	if _, err := uc.ValidateToken(ctx, tokens[0]); err == nil {
+		t.Fatal("oldest session is still valid after the limit was exceeded")
+	}
+	for i, token := range tokens[1:] {
+		if _, err := uc.ValidateToken(ctx, token); err != nil {
+			t.Fatalf("session %d rejected: %v", i+2, err)
+		}
+	}
+	if remaining, _ := sessions.GetUserSessions(ctx, 1, 0, 0); len(remaining) != 3 {
+		t.Fatalf("%d sessions kept, want 3", len(remaining))
+	}
+}
+
+func TestValidateTokenExpiresIdleSession(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: newPasswordUser(t, 1, "alice")}}
+	sessions := newMemSessionRepo()
+	uc := newTestAuthUseCase(users, sessions, config.JWTConfig{SessionIdleTimeout: 30 * time.Minute})
+	ctx := context.Background()
+
+	active := login(t, uc, "alice")
+	idle := login(t, uc, "alice")
+	users.users[1].IsOnline = true
+	sessions.sessions[idle].LastActivity = time.Now().Add(-31 * time.Minute)
+
+	if _, err := uc.ValidateToken(ctx, active); err != nil {
+		t.Fatalf("active session rejected: %v", err)
+	}
+
+	if _, err := uc.ValidateToken(ctx, idle); !errors.Is(err, ErrSessionIdle) {
+		t.Fatalf("idle session err = %v, want %v", err, ErrSessionIdle)
+	}
+	if _, ok := sessions.sessions[idle]; ok {
+		t.Fatal("idle session was not deleted")
+	}
+	if users.users[1].IsOnline {
+		t.Fatal("user is still marked online after idle logout")
+	}
+	// Повторная проверка не воскрешает удаленную сессию
+	if _, err := uc.ValidateToken(ctx, idle); err == nil {
+		t.Fatal("idle session accepted after expiry")
+	}
+}
+
+func TestChangeProfile(t *testing.T) {
+	stringPtr := func(value string) *string { return &value }
+	newUsers := func() *memUserRepo {
+		return &memUserRepo{users: map[uint]*entities.User{
+			1: {ID: 1, Username: "alice", Email: "alice@example.com"},
+			2: {ID: 2, Username: "Bob", Email: "bob@example.com"},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		req     ChangeProfileRequest
+		wantErr string
+	}{
+		{"taken username, other case", ChangeProfileRequest{Username: stringPtr("bob")}, "USERNAME_ALREADY_EXISTS"},
+		{"taken email, other case", ChangeProfileRequest{Email: stringPtr("BOB@example.com")}, "EMAIL_ALREADY_EXISTS"},
+		{"invalid email", ChangeProfileRequest{Email: stringPtr("not-an-email")}, "INVALID_EMAIL"},
+		{"nothing to change", ChangeProfileRequest{}, "NO_PROFILE_CHANGES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := newUsers()
+			uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{})
+
+			_, err := uc.ChangeProfile(context.Background(), 1, &tt.req)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %s", err, tt.wantErr)
+			}
+			if got := users.users[1]; got.Username != "alice" || got.Email != "alice@example.com" {
+				t.Fatalf("rejected change was stored: %s <%s>", got.Username, got.Email)
+			}
+		})
+	}
+
+	t.Run("successful update", func(t *testing.T) {
+		users := newUsers()
+		uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{})
+
+		// Собственные имя и email не считаются занятыми, даже если меняется только регистр
+		user, err := uc.ChangeProfile(context.Background(), 1, &ChangeProfileRequest{Username: stringPtr("Alice"), Email: stringPtr(" Alice@Example.org ")})
+		if err != nil {
+			t.Fatalf("ChangeProfile: %v", err)
+		}
+		if user.Username != "Alice" || user.Email != "alice@example.org" {
+			t.Fatalf("profile = %s <%s>, want Alice <alice@example.org>", user.Username, user.Email)
+		}
+		if stored := users.users[1]; stored.Username != "Alice" || stored.Email != "alice@example.org" {
+			t.Fatalf("stored profile = %s <%s>", stored.Username, stored.Email)
+		}
+	})
+}
+
+func TestRegisterUsernameCaseInsensitive(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{}}
+	uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{ExpiresIn: time.Hour})
+	uc.keysCfg.ServerHoldsKeys = true
+	ctx := context.Background()
+
+	if _, err := uc.Register(ctx, &RegisterRequest{Username: "Alice", Email: "alice@example.com", Password: "secret"}); err != nil {
+		t.Fatalf("Register(Alice): %v", err)
+	}
+	_, err := uc.Register(ctx, &RegisterRequest{Username: "alice", Email: "other@example.com", Password: "secret"})
+	if err == nil || err.Error() != "USERNAME_ALREADY_EXISTS" {
+		t.Fatalf("Register(alice): err = %v, want USERNAME_ALREADY_EXISTS", err)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("%d users stored, want 1", len(users.users))
+	}
+
+	// Вход не зависит от регистра, а отображаемое имя сохраняет исходный регистр
+	result, err := uc.Login(ctx, &LoginRequest{Username: "ALICE", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Login(ALICE): %v", err)
+	}
+	if result.User.Username != "Alice" {
+		t.Fatalf("username = %q, want %q", result.User.Username, "Alice")
+	}
+}
+
+func TestRegisterEmailVariantsCollide(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{}}
+	uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{ExpiresIn: time.Hour})
+	uc.keysCfg.ServerHoldsKeys = true
+	ctx := context.Background()
+
+	if _, err := uc.Register(ctx, &RegisterRequest{Username: "alice", Email: " User@Example.COM ", Password: "secret"}); err != nil {
+		t.Fatalf("Register(alice): %v", err)
+	}
+	// Адрес сохраняется в нормализованном виде
+	if email := users.users[1].Email; email != "user@example.com" {
+		t.Fatalf("stored email = %q, want %q", email, "user@example.com")
+	}
+
+	for i, email := range []string{"user@example.com", "USER@EXAMPLE.COM", "user@example.com  ", "\tUser@example.com"} {
+		_, err := uc.Register(ctx, &RegisterRequest{Username: fmt.Sprintf("bob%d", i), Email: email, Password: "secret"})
+		if err == nil || err.Error() != "EMAIL_ALREADY_EXISTS" {
+			t.Fatalf("Register(%q): err = %v, want EMAIL_ALREADY_EXISTS", email, err)
+		}
+	}
+
+	_, err := uc.Register(ctx, &RegisterRequest{Username: "carol", Email: "carol@localhost", Password: "secret"})
+	if err == nil || err.Error() != "INVALID_EMAIL" {
+		t.Fatalf("Register(carol@localhost): err = %v, want INVALID_EMAIL", err)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("%d users stored, want 1", len(users.users))
+	}
+}
+
+func TestRegisterValidatesClientPublicKeys(t *testing.T) {
+	_, ecdsaPublicKey, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rsaPublicKey, err := crypto.GenerateRSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validECDSA, validRSA := hex.EncodeToString(ecdsaPublicKey), hex.EncodeToString(rsaPublicKey)
+	// Точка с правильной длиной, но не лежащая на кривой P-256
+	offCurve := hex.EncodeToString(append([]byte{0x04}, bytes.Repeat([]byte{0x01}, 64)...))
+
+	tests := []struct {
+		name       string
+		ecdsa, rsa string
+		x25519     string
+		wantErr    string
+	}{
+		{"valid keys", validECDSA, validRSA, "", ""},
+		{"ECDSA not hex", "zz-not-hex", validRSA, "", "INVALID_ECDSA_PUBLIC_KEY"},
+		{"ECDSA off the curve", offCurve, validRSA, "", "INVALID_ECDSA_PUBLIC_KEY"},
+		{"RSA key in ECDSA field", validRSA, validRSA, "", "INVALID_ECDSA_PUBLIC_KEY"},
+		{"malformed RSA", validECDSA, "deadbeef", "", "INVALID_RSA_PUBLIC_KEY"},
+		{"malformed X25519", validECDSA, validRSA, "0102", "INVALID_X25519_PUBLIC_KEY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &memUserRepo{users: map[uint]*entities.User{}}
+			uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{ExpiresIn: time.Hour})
+
+			_, err := uc.Register(context.Background(), &RegisterRequest{
+				Username:        "alice",
+				Email:           "alice@example.com",
+				Password:        "secret",
+				ECDSAPublicKey:  tt.ecdsa,
+				RSAPublicKey:    tt.rsa,
+				X25519PublicKey: tt.x25519,
+			})
+			if tt.wantErr == "" {
+				if err != nil || len(users.users) != 1 {
+					t.Fatalf("Register: err = %v, users stored = %d", err, len(users.users))
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("Register: err = %v, want %s", err, tt.wantErr)
+			}
+			if len(users.users) != 0 {
+				t.Fatal("user stored with an invalid key")
+			}
+		})
+	}
+}
+
+func TestGuestTokenGrantsOnlyItsChat(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: newPasswordUser(t, 1, "alice")}}
+	uc := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{ExpiresIn: time.Hour, GuestTokenTTL: time.Hour})
+	ctx := context.Background()
+
+	guestToken, _, err := uc.IssueGuestToken(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chatID, err := uc.ValidateGuestToken(guestToken); err != nil || chatID != 10 {
+		t.Fatalf("ValidateGuestToken = %d, %v; want chat 10", chatID, err)
+	}
+
+	// Гостевой токен не заменяет пользовательский, и наоборот
+	if _, err := uc.ValidateToken(ctx, guestToken); err == nil {
+		t.Fatal("guest token accepted as a user token")
+	}
+	if _, err := uc.ValidateGuestToken(login(t, uc, "alice")); !errors.Is(err, ErrInvalidGuestToken) {
+		t.Fatalf("user token as guest token: err = %v, want %v", err, ErrInvalidGuestToken)
+	}
+
+	expired := newTestAuthUseCase(users, newMemSessionRepo(), config.JWTConfig{GuestTokenTTL: -time.Minute})
+	expiredToken, _, err := expired.IssueGuestToken(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.ValidateGuestToken(expiredToken); !errors.Is(err, ErrInvalidGuestToken) {
+		t.Fatalf("expired guest token: err = %v, want %v", err, ErrInvalidGuestToken)
+	}
+}
@@ -1,18 +1,110 @@
 package usecase
 
 import (
+	"cmp"
+	"context"
 	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/metrics"
+	"sleek-chat-backend/pkg/ratelimit"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
 )
 
+var (
+	ErrMemberNotFound       = errors.New("member not found")
+	ErrUserNotFound         = errors.New("user not found")
+	ErrCannotChatWithSelf   = errors.New("cannot create chat with yourself")
+	ErrRateLimited          = errors.New("message rate limit exceeded, please slow down")
+	ErrNotChatMember        = errors.New("user is not a member of this chat")
+	ErrMessageNotFound      = errors.New("message not found")
+	ErrChatNotFound         = errors.New("chat not found")
+	ErrCreatorRoleFixed     = errors.New("chat creator role cannot be changed")
+	ErrMessageForbidden     = errors.New("not allowed to modify this message")
+	ErrMessageNotEditable   = errors.New("message cannot be edited")
+	ErrNoRecipients         = errors.New("chat has no other members to receive the message")
+	ErrInvalidMessage       = errors.New("invalid encrypted message")
+	ErrServerKeysDisabled   = errors.New("server does not hold keys for this user, send client-encrypted messages instead")
+	ErrRatchetChat          = errors.New("chat uses double ratchet encryption, send client-encrypted messages instead")
+	ErrStaleKeyVersion      = errors.New("message key version does not match the chat's current key version")
+	ErrPrivateChatExists    = repository.ErrPrivateChatExists
+	ErrNotForwardable       = errors.New("message cannot be forwarded")
+	ErrEditWindowExpired    = errors.New("message is too old to be edited")
+	ErrNotGroupChat         = errors.New("operation is only allowed in group chats")
+	ErrRestoreWindowExpired = errors.New("message can no longer be restored")
+	ErrNotChatAdmin         = errors.New("only chat admins can perform this action")
+	ErrSlowMode             = errors.New("slow mode is enabled in this chat, wait before sending another message")
+	ErrInvalidSearchQuery   = errors.New("search query must be between 2 and 100 characters")
+	ErrInvalidMessageType   = errors.New("message type is not allowed")
+	ErrCannotRemoveCreator  = errors.New("chat creator cannot be removed from the chat")
+	ErrLastAdmin            = repository.ErrLastAdmin
+	ErrCannotAddSelf        = errors.New("cannot add yourself to the chat")
+	ErrNotChatCreator       = errors.New("only the chat creator can perform this action")
+	ErrInvalidRoleChanges   = errors.New("role changes must map between 1 and 100 members to \"admin\" or \"member\"")
+	ErrChatKeyNotFound      = errors.New("chat key version not found")
+)
+
+// SlowModeError - отправка отклонена медленным режимом чата; Remaining - сколько осталось ждать
+type SlowModeError struct {
+	Remaining time.Duration
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("%v (%ds remaining)", ErrSlowMode, int(math.Ceil(e.Remaining.Seconds())))
+}
+
+func (e *SlowModeError) Unwrap() error { return ErrSlowMode }
+
+// MaxSlowModeSeconds - наибольший интервал медленного режима (6 часов)
+const MaxSlowModeSeconds = 6 * 60 * 60
+
+const (
+	// EventMessageStatus - тип события об изменении статуса сообщения
+	EventMessageStatus = "message_status"
+	// EventKeyRotated - тип события о смене активного ключа чата
+	EventKeyRotated = "key_rotated"
+	// EventMessageEdited - тип события об изменении сообщения. Данные:
+	// {chat_id, message_id, content, key_version, edited_at, nonce, iv, hmac, ecdsa_signature, rsa_signature},
+	// где content - новый открытый текст, как и в событиях типа chat
+	EventMessageEdited = "message_edited"
+	// EventMessageDeleted - тип события об удалении сообщения. Данные: {chat_id, message_id, deleted_by}
+	EventMessageDeleted = "message_deleted"
+	// EventMessageRestored - тип события об отмене удаления сообщения. Данные: {chat_id, message_id, restored_by}
+	EventMessageRestored = "message_restored"
+	// EventRoleChanged - тип события о смене роли участника. Данные: {chat_id, user_id, new_role, changed_by}
+	EventRoleChanged = "role_changed"
+	// EventSlowModeChanged - тип события об изменении медленного режима. Данные: {chat_id, slow_mode_seconds, changed_by}
+	EventSlowModeChanged = "slow_mode_changed"
+)
+
+// messageLimiterIdleTTL - через сколько бездействия отправителя его корзина лимита удаляется из памяти
+const messageLimiterIdleTTL = 10 * time.Minute
+
+// mentionPattern - @username; класс символов совпадает с правилом alphanum, по которому проверяются
+// имена при регистрации и изменении профиля
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9]+)`)
+
 type NotificationSender interface {
 	SendNotificationToChat(chatID uint, notification *entities.Notification)
+	SendNotificationToUser(userID uint, notification *entities.Notification)
+	SendEventToChat(chatID uint, eventType string, data interface{})
+}
+
+// PresenceTracker - источник сведений о том, подключен ли пользователь в данный момент
+type PresenceTracker interface {
+	IsUserOnline(userID uint) bool
 }
 
 type ChatUseCase struct {
@@ -21,6 +113,19 @@ type ChatUseCase struct {
 	userRepo           repository.UserRepository
 	keyExchangeRepo    repository.KeyExchangeRepository
 	notificationSender NotificationSender
+	presence           PresenceTracker
+	messageLimiter     *ratelimit.RateLimiter
+	logger             *logger.Logger
+	metrics            *metrics.Registry
+	controlCharsPolicy string
+	historyLimit       int
+	editWindow         time.Duration
+	editAdminExempt    bool
+	restoreWindow      time.Duration
+	audit              *AuditLogger
+	contentFilter      ContentFilter
+	messageTypes       map[string]bool
+	messageAlgorithm   string
 }
 
 // NewChatUseCase - создает новый экземпляр сервиса для работы с чатами
@@ -30,6 +135,11 @@ func NewChatUseCase(
 	userRepo repository.UserRepository,
 	keyExchangeRepo repository.KeyExchangeRepository,
 	notificationSender NotificationSender,
+	presence PresenceTracker,
+	cfg *config.ChatConfig,
+	logger *logger.Logger,
+	metricsRegistry *metrics.Registry,
+	audit *AuditLogger,
 ) *ChatUseCase {
 	return &ChatUseCase{
 		chatRepo:           chatRepo,
@@ -37,23 +147,253 @@ func NewChatUseCase(
 		userRepo:           userRepo,
 		keyExchangeRepo:    keyExchangeRepo,
 		notificationSender: notificationSender,
+		presence:           presence,
+		messageLimiter:     ratelimit.New(cfg.MaxMessagesPerMinute, time.Minute, messageLimiterIdleTTL),
+		logger:             logger,
+		metrics:            metricsRegistry,
+		controlCharsPolicy: cfg.ControlCharsPolicy,
+		historyLimit:       cfg.HistoryLimit,
+		editWindow:         cfg.EditWindow,
+		editAdminExempt:    cfg.EditWindowAdminExempt,
+		restoreWindow:      cfg.RestoreWindow,
+		audit:              audit,
+		contentFilter:      NoopContentFilter{},
+		messageTypes:       allowedMessageTypes(cfg.AllowedMessageTypes),
+		messageAlgorithm:   cfg.MessageAlgorithm,
+	}
+}
+
+// allowedMessageTypes - строит множество типов сообщений, которые могут отправлять клиенты;
+// системные сообщения создает только сервер, поэтому тип "system" в множество не попадает
+func allowedMessageTypes(types []string) map[string]bool {
+	allowed := make(map[string]bool, len(types))
+	for _, messageType := range types {
+		if messageType = strings.TrimSpace(messageType); messageType != "" && messageType != "system" {
+			allowed[messageType] = true
+		}
 	}
+	return allowed
+}
+
+// checkMessageType - подставляет тип "text" по умолчанию и проверяет тип сообщения по списку разрешенных
+func (uc *ChatUseCase) checkMessageType(messageType string) (string, error) {
+	if messageType == "" {
+		messageType = "text"
+	}
+	if !uc.messageTypes[messageType] {
+		return "", ErrInvalidMessageType
+	}
+	return messageType, nil
+}
+
+// SetContentFilter - подключает фильтр содержимого, проверяющий текст сообщений перед шифрованием
+func (uc *ChatUseCase) SetContentFilter(filter ContentFilter) {
+	uc.contentFilter = filter
 }
 
 type CreateChatRequest struct {
-	Name      string `json:"name" binding:"required"`
-	IsGroup   bool   `json:"is_group"`
-	MemberIDs []uint `json:"member_ids" binding:"required"`
+	Name              string   `json:"name" binding:"required"`
+	IsGroup           bool     `json:"is_group"`
+	MemberIDs         []uint   `json:"member_ids" binding:"required"`
+	EncryptionSchemes []string `json:"encryption_schemes"`
 }
 
 type SendMessageRequest struct {
 	Content     string `json:"content" binding:"required"`
 	MessageType string `json:"message_type"`
+	// ForwardedFromID - заполняется сервером при пересылке, клиент задать его не может
+	ForwardedFromID *uint `json:"-"`
+	// AttachmentID - необязательное вложение, заранее загруженное отправителем в этот чат
+	AttachmentID *uint `json:"attachment_id"`
+}
+
+// ForwardBulkRequest - пересылка одного сообщения сразу в несколько чатов
+type ForwardBulkRequest struct {
+	MessageID uint   `json:"message_id" binding:"required"`
+	ChatIDs   []uint `json:"chat_ids" binding:"required,min=1,max=20,dive,required"`
+}
+
+// ForwardResult - результат пересылки в один чат; Message заполнен только при успехе
+type ForwardResult struct {
+	ChatID    uint              `json:"chat_id"`
+	Success   bool              `json:"success"`
+	MessageID uint              `json:"message_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Message   *entities.Message `json:"-"`
+}
+
+// SendEncryptedMessageRequest - сообщение, зашифрованное и подписанное на клиенте;
+// все бинарные поля передаются в hex, как в crypto.SecureMessage
+type SendEncryptedMessageRequest struct {
+	Ciphertext     string `json:"ciphertext" binding:"required"`
+	IV             string `json:"iv" binding:"required"`
+	HMAC           string `json:"hmac" binding:"required"`
+	Nonce          string `json:"nonce" binding:"required"`
+	ECDSASignature string `json:"ecdsa_signature" binding:"required"`
+	RSASignature   string `json:"rsa_signature" binding:"required"`
+	Timestamp      int64  `json:"timestamp"`
+	MessageType    string `json:"message_type"`
+	// Algorithm - алгоритм, которым клиент зашифровал сообщение; пусто - aes-256-cbc
+	Algorithm string `json:"algorithm"`
+	// KeyVersion - версия ключа чата, которым зашифровано сообщение; должна совпадать с текущей.
+	// В чате с Double Ratchet ключ чата не используется, и версия не передается
+	KeyVersion int `json:"key_version"`
+	// RatchetHeader - заголовок crypto.RatchetMessage; обязателен в чате со схемой double_ratchet
+	// и запрещен в остальных
+	RatchetHeader *crypto.RatchetHeader `json:"ratchet_header"`
+}
+
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// SetSlowModeRequest - интервал медленного режима в секундах; 0 отключает режим
+type SetSlowModeRequest struct {
+	Seconds int `json:"seconds" binding:"min=0,max=21600"`
 }
 
 type MessageResponse struct {
 	*entities.Message
 	DecryptedContent string `json:"decrypted_content,omitempty"`
+	// Encrypted - сервер не расшифровывал сообщение, клиент получает исходный шифротекст
+	Encrypted bool `json:"encrypted"`
+}
+
+// MessagePage - страница истории чата. HistoryLimitReached означает, что страница обрезана
+// ограничением глубины истории и более старые сообщения не выдаются. Total - число всех
+// подходящих сообщений чата, HasMore - есть ли следующая доступная страница
+type MessagePage struct {
+	Messages            []MessageResponse
+	HistoryLimitReached bool
+	Total               int64
+	HasMore             bool
+	// KeyVersion - текущая версия ключа чата, чтобы переподключившийся клиент узнал о пропущенной ротации
+	KeyVersion int
+}
+
+// MemberPage - страница участников чата; Total - число всех участников, HasMore - есть ли следующая страница
+type MemberPage struct {
+	Members []*entities.User
+	Total   int64
+	HasMore bool
+}
+
+// ChatStats - сводная статистика чата
+type ChatStats struct {
+	ChatID           uint                         `json:"chat_id"`
+	MessageCount     int64                        `json:"message_count"`
+	MemberCount      int64                        `json:"member_count"`
+	MostActiveMember *entities.SenderMessageCount `json:"most_active_member"`
+	MessagesPerDay   []DayMessageCount            `json:"messages_per_day"`
+}
+
+// WrappedChatKey - ключ чата, зашифрованный публичным ключом RSA участника; по нему участник,
+// который хранит ключи сам, расшифровывает сообщения, зашифрованные сервером ключом чата
+type WrappedChatKey struct {
+	ChatID     uint   `json:"chat_id"`
+	KeyVersion int    `json:"key_version"`
+	Algorithm  string `json:"algorithm"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// ChatKeyWrapAlgorithm - алгоритм, которым оборачивается ключ чата для участника
+const ChatKeyWrapAlgorithm = "RSA-OAEP-SHA256"
+
+// DayMessageCount - количество сообщений за день в формате YYYY-MM-DD
+type DayMessageCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// statsDays - за сколько последних дней, включая текущий, считается активность чата
+const statsDays = 7
+
+// exportBatchSize - сколько сообщений загружается из БД за один шаг экспорта истории
+const exportBatchSize = 200
+
+// ExportedMessage - сообщение в экспорте истории чата
+type ExportedMessage struct {
+	ID             uint      `json:"id"`
+	Seq            int64     `json:"seq"`
+	SenderID       uint      `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	MessageType    string    `json:"message_type"`
+	Content        string    `json:"content"`
+	Encrypted      bool      `json:"encrypted"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Ограничения поиска сообщений по всем чатам пользователя. Сообщения хранятся зашифрованными,
+// поэтому совпадения ищутся в памяти по расшифрованному тексту последних сообщений каждого чата
+const (
+	searchScanPerChat    = 500
+	searchSnippetRadius  = 40
+	minSearchQueryLength = 2
+	maxSearchQueryLength = 100
+)
+
+// MessageSearchHit - найденное сообщение с фрагментом текста вокруг совпадения
+type MessageSearchHit struct {
+	MessageID      uint      `json:"message_id"`
+	Seq            int64     `json:"seq"`
+	SenderID       uint      `json:"sender_id"`
+	SenderUsername string    `json:"sender_username"`
+	Snippet        string    `json:"snippet"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// ChatSearchResult - найденные сообщения одного чата
+type ChatSearchResult struct {
+	ChatID   uint               `json:"chat_id"`
+	ChatName string             `json:"chat_name"`
+	Messages []MessageSearchHit `json:"messages"`
+}
+
+// SearchPage - страница результатов поиска, сгруппированная по чатам. Total - число найденных
+// сообщений в просмотренной части истории, HasMore - есть ли следующая страница
+type SearchPage struct {
+	Results []ChatSearchResult
+	Total   int
+	HasMore bool
+}
+
+// ExportedChat - метаданные чата в выгрузке данных пользователя; участники чата не включаются
+type ExportedChat struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	IsGroup   bool      `json:"is_group"`
+	Role      string    `json:"role"`
+	Archived  bool      `json:"archived"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportedUserMessage - отправленное пользователем сообщение в выгрузке его данных
+type ExportedUserMessage struct {
+	ChatID uint `json:"chat_id"`
+	ExportedMessage
+}
+
+type AddMembersRequest struct {
+	UserIDs []uint `json:"user_ids" binding:"required,min=1,max=100,dive,required"`
+}
+
+// maxRoleChanges - наибольшее число участников в одном запросе на изменение ролей
+const maxRoleChanges = 100
+
+// RoleChange - изменение роли одного участника при массовом изменении ролей
+type RoleChange struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	OldRole  string `json:"old_role"`
+	NewRole  string `json:"new_role"`
+}
+
+// AddMemberResult - результат добавления одного пользователя при массовом добавлении
+type AddMemberResult struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Added    bool   `json:"added"`
+	Error    string `json:"error,omitempty"`
 }
 
 type PrivateChatResponse struct {
@@ -62,67 +402,122 @@ type PrivateChatResponse struct {
 }
 
 // CreateChat - создает новый чат (групповой или приватный)
-func (uc *ChatUseCase) CreateChat(creatorID uint, req *CreateChatRequest) (*entities.Chat, error) {
-	creator, err := uc.userRepo.GetByID(creatorID)
+func (uc *ChatUseCase) CreateChat(ctx context.Context, creatorID uint, req *CreateChatRequest) (*entities.Chat, error) {
+	creator, err := uc.userRepo.GetByID(ctx, creatorID)
 	if err != nil {
 		return nil, errors.New("creator not found")
 	}
 
+	memberIDs := uniqueMemberIDs(req.MemberIDs, creatorID)
+	memberUsers := make([]entities.User, 0, len(memberIDs)+1)
+	for _, memberID := range memberIDs {
+		member, err := uc.userRepo.GetByID(ctx, memberID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrMemberNotFound, memberID)
+		}
+		memberUsers = append(memberUsers, *member)
+	}
+
 	chat := &entities.Chat{
-		Name:      req.Name,
-		IsGroup:   req.IsGroup,
-		CreatedBy: creatorID,
-		Creator:   *creator,
+		Name:             req.Name,
+		IsGroup:          req.IsGroup,
+		CreatedBy:        creatorID,
+		Creator:          *creator,
+		EncryptionScheme: crypto.EncryptionSchemeStatic,
+	}
+
+	// Схема согласуется только для приватных чатов, группы используют статический ключ
+	if !req.IsGroup {
+		chat.EncryptionScheme = crypto.NegotiateEncryptionScheme(req.EncryptionSchemes)
+		// Уникальный ключ пары не дает параллельным запросам создать два чата для одних пользователей
+		if len(memberIDs) == 1 {
+			pairKey := privatePairKey(creatorID, memberIDs[0])
+			chat.PairKey = &pairKey
+		}
 	}
 
-	if err := uc.chatRepo.Create(chat); err != nil {
-		return nil, fmt.Errorf("failed to create chat: %v", err)
+	members := make([]entities.ChatMember, 0, len(memberIDs)+1)
+	members = append(members, entities.ChatMember{UserID: creatorID, Role: "admin"})
+	for _, memberID := range memberIDs {
+		members = append(members, entities.ChatMember{UserID: memberID, Role: "member"})
 	}
 
-	if err := uc.chatRepo.AddMember(chat.ID, creatorID, "admin"); err != nil {
-		return nil, fmt.Errorf("failed to add creator to chat: %v", err)
+	if err := uc.chatRepo.CreateWithMembers(ctx, chat, members); err != nil {
+		return nil, fmt.Errorf("failed to create chat: %w", err)
 	}
 
-	for _, memberID := range req.MemberIDs {
-		if memberID != creatorID {
-			if err := uc.chatRepo.AddMember(chat.ID, memberID, "member"); err != nil {
-				return nil, fmt.Errorf("failed to add member %d to chat: %v", memberID, err)
-			}
-		}
+	keyVersion, err := uc.rotateChatKey(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	chat.KeyVersion = keyVersion
+
+	// Участники возвращаются сразу с ролями, как в GetChatMembers, чтобы клиенту не нужен был
+	// отдельный запрос: создатель - "creator", остальные - "member"
+	chat.Members = make([]entities.User, 0, len(memberUsers)+1)
+	chat.Members = append(chat.Members, *creator)
+	chat.Members[0].Role = "creator"
+	for _, member := range memberUsers {
+		member.Role = "member"
+		chat.Members = append(chat.Members, member)
+	}
+	for i := range chat.Members {
+		chat.Members[i].IsOnline = uc.isUserOnline(chat.Members[i].ID)
 	}
+	chat.Role = "admin"
+	chat.MemberCount = len(chat.Members)
 
 	if req.IsGroup && uc.notificationSender != nil {
-		notification := &entities.Notification{
-			Type:    "group_created",
-			ChatID:  chat.ID,
-			Message: fmt.Sprintf("Группа \"%s\" была создана пользователем %s", chat.Name, creator.Username),
-			Data: map[string]interface{}{
-				"creator_id":   creatorID,
-				"creator_name": creator.Username,
-				"chat_name":    chat.Name,
-			},
-		}
+		notification := entities.NewGroupCreatedNotification(
+			chat.ID,
+			fmt.Sprintf("Группа \"%s\" была создана пользователем %s", chat.Name, creator.Username),
+			creatorID, creator.Username, chat.Name,
+		)
 		uc.notificationSender.SendNotificationToChat(chat.ID, notification)
 	}
 
 	return chat, nil
 }
 
-// GetUserChats - получает список всех чатов пользователя
-func (uc *ChatUseCase) GetUserChats(userID uint) ([]entities.Chat, error) {
-	chats, err := uc.chatRepo.GetUserChats(userID)
+// GetUserChats - получает список чатов пользователя; архивированные включаются только при includeArchived
+func (uc *ChatUseCase) GetUserChats(ctx context.Context, userID uint, includeArchived bool) ([]entities.Chat, error) {
+	chats, err := uc.chatRepo.GetUserChats(ctx, userID, includeArchived)
 	if err != nil {
 		return nil, err
 	}
 
+	archived := make(map[uint]bool)
+	if includeArchived {
+		archivedIDs, err := uc.chatRepo.GetArchivedChatIDs(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range archivedIDs {
+			archived[id] = true
+		}
+	}
+
+	chatIDs := make([]uint, len(chats))
 	for i := range chats {
-		if !chats[i].IsGroup {
-			members, err := uc.chatRepo.GetMembers(chats[i].ID)
-			if err != nil {
-				continue
-			}
+		chatIDs[i] = chats[i].ID
+	}
+	// Счетчики сообщений и упоминаний только дополняют список чатов, поэтому ошибка
+	// подсчета не мешает его вернуть
+	messageCounts, _ := uc.messageRepo.CountByChats(ctx, chatIDs)
+	unreadMentions, _ := uc.messageRepo.CountUnreadMentionsByChats(ctx, chatIDs, userID)
 
-			for _, member := range members {
+	for i := range chats {
+		chats[i].Archived = archived[chats[i].ID]
+
+		if count, ok := messageCounts[chats[i].ID]; ok {
+			chats[i].MessageCount = count.Count
+			chats[i].LastActivityAt = count.LastMessageAt
+		}
+		chats[i].UnreadMentions = unreadMentions[chats[i].ID]
+
+		// Участники уже загружены вместе со списком чатов
+		if !chats[i].IsGroup {
+			for _, member := range chats[i].Members {
 				if member.ID != userID {
 					chats[i].Name = fmt.Sprintf("Chat with %s", member.Username)
 					break
@@ -134,11 +529,59 @@ func (uc *ChatUseCase) GetUserChats(userID uint) ([]entities.Chat, error) {
 	return chats, nil
 }
 
+// SetArchived - скрывает чат из списка пользователя без выхода из него или возвращает из архива
+func (uc *ChatUseCase) SetArchived(ctx context.Context, chatID, userID uint, archived bool) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+
+	return uc.chatRepo.SetArchived(ctx, chatID, userID, archived)
+}
+
+// GetChat - получает данные чата для участника вместе с его ролью и числом участников
+func (uc *ChatUseCase) GetChat(ctx context.Context, chatID, userID uint) (*entities.Chat, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return nil, ErrChatNotFound
+	}
+
+	role, err := uc.chatRepo.GetMemberRole(ctx, chatID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member role: %v", err)
+	}
+
+	chat.Role = role
+	chat.MemberCount = len(chat.Members)
+
+	if !chat.IsGroup {
+		for _, member := range chat.Members {
+			if member.ID != userID {
+				chat.Name = fmt.Sprintf("Chat with %s", member.Username)
+				break
+			}
+		}
+	}
+
+	return chat, nil
+}
+
 // CreateOrGetPrivateChat - создает новый приватный чат или возвращает существующий
-func (uc *ChatUseCase) CreateOrGetPrivateChat(userID1, userID2 uint, otherUserName string) (*PrivateChatResponse, error) {
-	existingChat, err := uc.chatRepo.FindPrivateChat(userID1, userID2)
+func (uc *ChatUseCase) CreateOrGetPrivateChat(ctx context.Context, userID1, userID2 uint, otherUserName string, encryptionSchemes []string) (*PrivateChatResponse, error) {
+	existingChat, err := uc.chatRepo.FindPrivateChat(ctx, userID1, userID2)
 	if err == nil {
-		members, err := uc.chatRepo.GetMembers(existingChat.ID)
+		members, err := uc.chatRepo.GetMembers(ctx, existingChat.ID)
 		if err == nil {
 			for _, member := range members {
 				if member.ID != userID1 {
@@ -156,12 +599,26 @@ func (uc *ChatUseCase) CreateOrGetPrivateChat(userID1, userID2 uint, otherUserNa
 
 	chatName := "Private Chat"
 	req := &CreateChatRequest{
-		Name:      chatName,
-		IsGroup:   false,
-		MemberIDs: []uint{userID2},
+		Name:              chatName,
+		IsGroup:           false,
+		MemberIDs:         []uint{userID2},
+		EncryptionSchemes: encryptionSchemes,
 	}
 
-	newChat, err := uc.CreateChat(userID1, req)
+	newChat, err := uc.CreateChat(ctx, userID1, req)
+	if errors.Is(err, ErrPrivateChatExists) {
+		// Параллельный запрос успел создать чат для этой пары первым
+		existingChat, err := uc.rejoinPrivateChat(ctx, userID1, userID2)
+		if err != nil {
+			return nil, err
+		}
+		existingChat.Name = fmt.Sprintf("Chat with %s", otherUserName)
+
+		return &PrivateChatResponse{
+			Chat:    existingChat,
+			Created: false,
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -174,56 +631,124 @@ func (uc *ChatUseCase) CreateOrGetPrivateChat(userID1, userID2 uint, otherUserNa
 	}, nil
 }
 
+// privatePairKey - нормализованный ключ пары пользователей приватного чата, не зависящий от порядка ID
+func privatePairKey(userID1, userID2 uint) string {
+	return fmt.Sprintf("%d:%d", min(userID1, userID2), max(userID1, userID2))
+}
+
+// rejoinPrivateChat - возвращает существующий приватный чат пары и возвращает в него участников,
+// которые ранее удалили его у себя
+func (uc *ChatUseCase) rejoinPrivateChat(ctx context.Context, userID1, userID2 uint) (*entities.Chat, error) {
+	chat, err := uc.chatRepo.GetByPairKey(ctx, privatePairKey(userID1, userID2))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private chat: %v", err)
+	}
+
+	for _, userID := range []uint{userID1, userID2} {
+		isMember, err := uc.chatRepo.IsMember(ctx, chat.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if isMember {
+			continue
+		}
+		if err := uc.chatRepo.AddMember(ctx, chat.ID, userID, "member"); err != nil {
+			return nil, fmt.Errorf("failed to restore private chat member: %v", err)
+		}
+	}
+
+	return uc.chatRepo.GetByID(ctx, chat.ID)
+}
+
+// CreateOrGetPrivateChatByUsername - создает или возвращает приватный чат с пользователем, найденным по имени
+func (uc *ChatUseCase) CreateOrGetPrivateChatByUsername(ctx context.Context, userID uint, username string, encryptionSchemes []string) (*PrivateChatResponse, error) {
+	otherUser, err := uc.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if otherUser.ID == userID {
+		return nil, ErrCannotChatWithSelf
+	}
+
+	return uc.CreateOrGetPrivateChat(ctx, userID, otherUser.ID, otherUser.Username, encryptionSchemes)
+}
+
 // SendMessage - отправляет зашифрованное сообщение в чат
-func (uc *ChatUseCase) SendMessage(chatID, senderID uint, req *SendMessageRequest, senderECDSAPrivateKey *ecdsa.PrivateKey, senderRSAPrivateKey *rsa.PrivateKey) (*entities.Message, error) {
-	isMember, err := uc.chatRepo.IsMember(chatID, senderID)
+//
+// Deprecated: сервер использует приватные ключи отправителя; клиентам со сквозным
+// шифрованием следует использовать SendClientEncryptedMessage.
+func (uc *ChatUseCase) SendMessage(ctx context.Context, chatID, senderID uint, req *SendMessageRequest, senderECDSAPrivateKey *ecdsa.PrivateKey, senderRSAPrivateKey *rsa.PrivateKey) (*entities.Message, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, senderID)
 	if err != nil {
 		return nil, err
 	}
 	if !isMember {
-		return nil, errors.New("sender is not a member of the chat")
+		return nil, ErrNotChatMember
 	}
 
-	members, err := uc.chatRepo.GetMembers(chatID)
+	messageType, err := uc.checkMessageType(req.MessageType)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get chat members: %v", err)
+		return nil, err
 	}
 
-	sender, err := uc.userRepo.GetByID(senderID)
+	content, err := sanitizeContent(req.Content, uc.controlCharsPolicy)
 	if err != nil {
-		return nil, errors.New("sender not found")
+		return nil, err
 	}
+	// Вызывающий код рассылает открытый текст из запроса, поэтому возвращаем в него очищенную версию
+	req.Content = content
 
-	var sharedSecret []byte
-	var recipientID uint = senderID
+	flagged, err := uc.applyContentFilter(ctx, content)
+	if err != nil {
+		return nil, err
+	}
 
-	if senderECDSAPrivateKey != nil && len(members) > 1 {
-		var recipientPublicKey []byte
-		for _, member := range members {
-			if member.ID != senderID {
-				recipientPublicKey, err = hex.DecodeString(member.ECDSAPublicKey)
-				if err != nil {
-					return nil, fmt.Errorf("failed to decode recipient public key: %v", err)
-				}
-				recipientID = member.ID
-				break
-			}
-		}
+	if !uc.messageLimiter.Allow(senderID) {
+		return nil, ErrRateLimited
+	}
 
-		if len(recipientPublicKey) > 0 {
-			sharedSecret, err = crypto.ComputeECDHSharedSecret(senderECDSAPrivateKey, recipientPublicKey)
-		}
+	members, err := uc.chatRepo.GetMembers(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat members: %w", err)
 	}
 
-	if len(sharedSecret) == 0 {
-		sharedSecret = make([]byte, 64)
-		copy(sharedSecret, "default-shared-secret-for-single-user-or-error")
+	sender, err := uc.userRepo.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, errors.New("sender not found")
+	}
+	if !sender.HoldsServerKeys() {
+		return nil, ErrServerKeysDisabled
+	}
+
+	// Упоминания разбираются до шифрования, пока сервер видит открытый текст
+	mentionedMembers := findMentionedMembers(content, members, senderID)
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+	// В чате с Double Ratchet ключи сообщений есть только у клиентов
+	if chat.EncryptionScheme == crypto.EncryptionSchemeDoubleRatchet {
+		return nil, ErrRatchetChat
+	}
+	if err := ensureRecipients(chat, senderID); err != nil {
+		return nil, err
+	}
+	if err := uc.checkSlowMode(ctx, chat, senderID); err != nil {
+		return nil, err
+	}
+
+	sharedSecret, keyVersion, err := uc.activeChatKey(ctx, chat)
+	if err != nil {
+		return nil, err
 	}
 
 	secureMsg, err := crypto.CreateSecureMessage(
+		uc.messageAlgorithm,
 		fmt.Sprintf("%d", senderID),
-		fmt.Sprintf("%d", recipientID),
-		[]byte(req.Content),
+		fmt.Sprintf("chat:%d", chatID),
+		[]byte(content),
 		sharedSecret,
 		senderECDSAPrivateKey,
 		senderRSAPrivateKey,
@@ -233,173 +758,1482 @@ func (uc *ChatUseCase) SendMessage(chatID, senderID uint, req *SendMessageReques
 	}
 
 	message := &entities.Message{
-		ChatID:         chatID,
-		SenderID:       senderID,
-		Content:        secureMsg.Ciphertext,
-		MessageType:    req.MessageType,
-		Timestamp:      &secureMsg.Timestamp,
-		Nonce:          secureMsg.Nonce,
-		IV:             secureMsg.IV,
-		HMAC:           secureMsg.HMAC,
-		ECDSASignature: secureMsg.ECDSASignature,
-		RSASignature:   secureMsg.RSASignature,
-	}
-
-	if message.MessageType == "" {
-		message.MessageType = "text"
+		ChatID:          chatID,
+		SenderID:        senderID,
+		Content:         secureMsg.Ciphertext,
+		MessageType:     messageType,
+		Timestamp:       &secureMsg.Timestamp,
+		Nonce:           secureMsg.Nonce,
+		IV:              secureMsg.IV,
+		HMAC:            secureMsg.HMAC,
+		ECDSASignature:  secureMsg.ECDSASignature,
+		RSASignature:    secureMsg.RSASignature,
+		Algorithm:       secureMsg.Algorithm,
+		Status:          entities.MessageStatusSent,
+		KeyVersion:      keyVersion,
+		ForwardedFromID: req.ForwardedFromID,
+		Flagged:         flagged,
+	}
+
+	if req.AttachmentID != nil {
+		if err := uc.messageRepo.CreateWithAttachment(ctx, message, *req.AttachmentID); err != nil {
+			if errors.Is(err, repository.ErrAttachmentUnavailable) {
+				return nil, ErrAttachmentNotFound
+			}
+			return nil, fmt.Errorf("failed to save message: %w", err)
+		}
+	} else if err := uc.messageRepo.Create(ctx, message); err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
 	}
 
-	if err := uc.messageRepo.Create(message); err != nil {
-		return nil, fmt.Errorf("failed to save message: %v", err)
-	}
+	// Новое сообщение возвращает чат из архива всех участников
+	_ = uc.chatRepo.UnarchiveForAll(ctx, chatID)
 
 	message.Sender = *sender
-	chat, _ := uc.chatRepo.GetByID(chatID)
-	if chat != nil {
-		message.Chat = *chat
-	}
+	message.Chat = *chat
+
+	uc.notifyMentions(ctx, message, sender, mentionedMembers)
 
 	return message, nil
 }
 
-// GetChatMessages - получает список сообщений чата с расшифровкой для пользователя
-func (uc *ChatUseCase) GetChatMessages(chatID, userID uint, limit, offset int) ([]MessageResponse, error) {
-	isMember, err := uc.chatRepo.IsMember(chatID, userID)
+// SendClientEncryptedMessage - сохраняет сообщение, зашифрованное на клиенте, проверив подписи
+// по зарегистрированным публичным ключам отправителя; приватные ключи сервером не используются
+func (uc *ChatUseCase) SendClientEncryptedMessage(ctx context.Context, chatID, senderID uint, req *SendEncryptedMessageRequest) (*entities.Message, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, senderID)
 	if err != nil {
 		return nil, err
 	}
 	if !isMember {
-		return nil, errors.New("user is not a member of the chat")
+		return nil, ErrNotChatMember
 	}
 
-	messages, err := uc.messageRepo.GetChatMessages(chatID, limit, offset)
+	messageType, err := uc.checkMessageType(req.MessageType)
 	if err != nil {
 		return nil, err
 	}
 
-	user, err := uc.userRepo.GetByID(userID)
-	if err != nil {
-		return nil, fmt.Errorf("user not found: %v", err)
+	if !uc.messageLimiter.Allow(senderID) {
+		return nil, ErrRateLimited
 	}
 
-	var responses []MessageResponse
-	for _, msg := range messages {
-		response := MessageResponse{
-			Message: &msg,
-		}
+	sender, err := uc.userRepo.GetByID(ctx, senderID)
+	if err != nil {
+		return nil, errors.New("sender not found")
+	}
 
-		decryptedContent, err := uc.decryptMessage(&msg, user)
-		if err != nil {
-			response.DecryptedContent = msg.Content
-		} else {
-			response.DecryptedContent = decryptedContent
-		}
+	senderECDSAPublicKeyBytes, err := hex.DecodeString(sender.ECDSAPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sender ECDSA public key: %v", err)
+	}
 
-		responses = append(responses, response)
+	senderRSAPublicKeyBytes, err := hex.DecodeString(sender.RSAPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode sender RSA public key: %v", err)
 	}
 
-	return responses, nil
-}
+	if !crypto.IsSupportedMessageAlgorithm(req.Algorithm) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, crypto.ErrUnsupportedAlgorithm)
+	}
 
-// decryptMessage - расшифровывает зашифрованное сообщение для конкретного пользователя
-func (uc *ChatUseCase) decryptMessage(msg *entities.Message, user *entities.User) (string, error) {
-	if msg.Content == "" || msg.IV == "" || msg.HMAC == "" {
-		return msg.Content, nil
+	secureMsg := &crypto.SecureMessage{
+		Ciphertext:     req.Ciphertext,
+		IV:             req.IV,
+		HMAC:           req.HMAC,
+		Nonce:          req.Nonce,
+		ECDSASignature: req.ECDSASignature,
+		RSASignature:   req.RSASignature,
+		Algorithm:      req.Algorithm,
+	}
+	if err := crypto.VerifySecureMessageSignatures(secureMsg, senderECDSAPublicKeyBytes, senderRSAPublicKeyBytes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
 	}
 
-	sender, err := uc.userRepo.GetByID(msg.SenderID)
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
-		return "", fmt.Errorf("sender not found: %v", err)
+		return nil, fmt.Errorf("failed to get chat: %v", err)
+	}
+	ratchet := chat.EncryptionScheme == crypto.EncryptionSchemeDoubleRatchet
+	if ratchet != (req.RatchetHeader != nil) {
+		return nil, fmt.Errorf("%w: ratchet header must be sent exactly in double_ratchet chats", ErrInvalidMessage)
+	}
+	var keyVersion int
+	if ratchet {
+		if err := crypto.ValidateRatchetHeader(*req.RatchetHeader); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+		// Сообщения храповика шифруются только AES-256-CBC с HMAC над заголовком
+		if crypto.MessageAlgorithmOrDefault(req.Algorithm) != crypto.MessageAlgorithmAESCBC {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, crypto.ErrUnsupportedAlgorithm)
+		}
+		if req.KeyVersion != 0 {
+			return nil, fmt.Errorf("%w: key version is not used in double_ratchet chats", ErrInvalidMessage)
+		}
+	} else {
+		// Сообщение, зашифрованное ключом до ротации, не расшифруют участники, добавленные после нее,
+		// а исключенный участник мог бы продолжать писать старым ключом
+		keyVersion, err = uc.chatRepo.GetKeyVersion(ctx, chatID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key version: %v", err)
+		}
+		if req.KeyVersion != keyVersion {
+			return nil, fmt.Errorf("%w: got %d, current %d", ErrStaleKeyVersion, req.KeyVersion, keyVersion)
+		}
+	}
+	if err := ensureRecipients(chat, senderID); err != nil {
+		return nil, err
+	}
+	if err := uc.checkSlowMode(ctx, chat, senderID); err != nil {
+		return nil, err
 	}
 
-	userECDSAPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(user.ECDSAPrivateKey))
-	if err != nil {
-		return "", fmt.Errorf("failed to parse user ECDSA private key: %v", err)
+	timestamp := req.Timestamp
+	if timestamp == 0 {
+		timestamp = time.Now().Unix()
 	}
 
-	senderECDSAPublicKeyBytes, err := hex.DecodeString(sender.ECDSAPublicKey)
+	message := &entities.Message{
+		ChatID:          chatID,
+		SenderID:        senderID,
+		Content:         req.Ciphertext,
+		MessageType:     messageType,
+		Timestamp:       &timestamp,
+		Nonce:           req.Nonce,
+		IV:              req.IV,
+		HMAC:            req.HMAC,
+		ECDSASignature:  req.ECDSASignature,
+		RSASignature:    req.RSASignature,
+		Algorithm:       crypto.MessageAlgorithmOrDefault(req.Algorithm),
+		KeyVersion:      keyVersion,
+		ClientEncrypted: true,
+		Status:          entities.MessageStatusSent,
+	}
+	if ratchet {
+		message.RatchetPublicKey = req.RatchetHeader.PublicKey
+		message.RatchetPrevChainLen = req.RatchetHeader.PrevChainLen
+		message.RatchetMessageNum = req.RatchetHeader.MessageNum
+	}
+
+	if err := uc.messageRepo.Create(ctx, message); err != nil {
+		return nil, fmt.Errorf("failed to save message: %v", err)
+	}
+
+	// Новое сообщение возвращает чат из архива всех участников
+	_ = uc.chatRepo.UnarchiveForAll(ctx, chatID)
+
+	message.Sender = *sender
+	message.Chat = *chat
+
+	return message, nil
+}
+
+// GetChatMessages - получает список сообщений чата с расшифровкой для пользователя;
+// непустой messageTypes оставляет только сообщения перечисленных типов
+func (uc *ChatUseCase) GetChatMessages(ctx context.Context, chatID, userID uint, limit, offset int, messageTypes []string) (*MessagePage, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode sender ECDSA public key: %v", err)
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
 	}
 
-	senderRSAPublicKeyBytes, err := hex.DecodeString(sender.RSAPublicKey)
+	page := &MessagePage{}
+
+	page.KeyVersion, err = uc.chatRepo.GetKeyVersion(ctx, chatID)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode sender RSA public key: %v", err)
+		return nil, fmt.Errorf("failed to get key version: %v", err)
 	}
 
-	members, err := uc.chatRepo.GetMembers(msg.ChatID)
+	if len(messageTypes) > 0 {
+		page.Total, err = uc.messageRepo.CountByChatAndType(ctx, chatID, messageTypes)
+	} else {
+		page.Total, err = uc.messageRepo.CountByChat(ctx, chatID)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to get chat members: %v", err)
+		return nil, fmt.Errorf("failed to count messages: %v", err)
 	}
 
-	var sharedSecret []byte
-	if user.ID == msg.SenderID {
+	// Глубина истории ограничена, чтобы большие смещения не приводили к дорогим сканированиям;
+	// маркер выставляется, только если за пределом действительно остались сообщения
+	available := page.Total
+	if uc.historyLimit > 0 && offset+limit > uc.historyLimit {
+		page.HistoryLimitReached = page.Total > int64(uc.historyLimit)
+		if offset >= uc.historyLimit {
+			return page, nil
+		}
+		limit = uc.historyLimit - offset
+	}
+	if uc.historyLimit > 0 {
+		available = min(available, int64(uc.historyLimit))
+	}
+
+	var messages []entities.Message
+	if len(messageTypes) > 0 {
+		messages, err = uc.messageRepo.GetChatMessagesByType(ctx, chatID, messageTypes, limit, offset)
+	} else {
+		messages, err = uc.messageRepo.GetChatMessages(ctx, chatID, limit, offset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	page.HasMore = int64(offset+len(messages)) < available
+
+	if offset == 0 {
+		_ = uc.messageRepo.MarkMentionsRead(ctx, chatID, userID)
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+
+	for _, msg := range messages {
+		page.Messages = append(page.Messages, uc.buildMessageResponse(ctx, &msg, user))
+	}
+
+	return page, nil
+}
+
+// ForwardMessageBulk - пересылает сообщение в несколько чатов. Членство и ограничения отправки
+// проверяются для каждого чата отдельно, ошибка одного чата не прерывает пересылку в остальные.
+// Возвращает результаты в порядке запроса и открытый текст пересланного сообщения
+func (uc *ChatUseCase) ForwardMessageBulk(ctx context.Context, userID uint, req *ForwardBulkRequest, senderECDSAPrivateKey *ecdsa.PrivateKey, senderRSAPrivateKey *rsa.PrivateKey) ([]ForwardResult, string, error) {
+	source, err := uc.messageRepo.GetByID(ctx, req.MessageID)
+	if err != nil {
+		return nil, "", ErrMessageNotFound
+	}
+
+	// Сообщение из чужого чата не раскрывается
+	isMember, err := uc.chatRepo.IsMember(ctx, source.ChatID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !isMember {
+		return nil, "", ErrMessageNotFound
+	}
+
+	// Шифротекст клиента нельзя перешифровать ключом другого чата
+	if source.MessageType == "system" || source.ClientEncrypted {
+		return nil, "", ErrNotForwardable
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, "", ErrUserNotFound
+	}
+
+	content, err := uc.decryptMessage(ctx, source, user)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt source message: %v", err)
+	}
+
+	results := make([]ForwardResult, 0, len(req.ChatIDs))
+	seen := make(map[uint]bool, len(req.ChatIDs))
+	for _, chatID := range req.ChatIDs {
+		if seen[chatID] {
+			continue
+		}
+		seen[chatID] = true
+
+		sendReq := &SendMessageRequest{
+			Content:         content,
+			MessageType:     source.MessageType,
+			ForwardedFromID: &source.ID,
+		}
+
+		result := ForwardResult{ChatID: chatID}
+		message, err := uc.SendMessage(ctx, chatID, userID, sendReq, senderECDSAPrivateKey, senderRSAPrivateKey)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			result.MessageID = message.ID
+			result.Message = message
+		}
+		results = append(results, result)
+	}
+
+	return results, content, nil
+}
+
+// GetMessage - получает одно сообщение чата с расшифровкой для участника
+func (uc *ChatUseCase) GetMessage(ctx context.Context, chatID, messageID, userID uint) (*MessageResponse, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	// Сообщение из другого чата не раскрывается даже при наличии доступа к нему
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+
+	response := uc.buildMessageResponse(ctx, message, user)
+	return &response, nil
+}
+
+// ExportChat - последовательно выгружает всю историю чата в порядке отправки, расшифрованную для
+// участника. Сообщения загружаются порциями и передаются в emit по одному, поэтому история
+// целиком в памяти не держится; ошибка emit прерывает экспорт
+func (uc *ChatUseCase) ExportChat(ctx context.Context, chatID, userID uint, emit func(ExportedMessage) error) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %v", err)
+	}
+
+	var afterSeq int64
+	for {
+		messages, err := uc.messageRepo.GetChatMessagesAfter(ctx, chatID, afterSeq, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to load messages: %v", err)
+		}
+
+		for i := range messages {
+			response := uc.buildMessageResponse(ctx, &messages[i], user)
+
+			exported := ExportedMessage{
+				ID:             response.ID,
+				Seq:            response.Seq,
+				SenderID:       response.SenderID,
+				SenderUsername: response.Sender.Username,
+				MessageType:    response.MessageType,
+				Content:        response.DecryptedContent,
+				Encrypted:      response.Encrypted,
+				CreatedAt:      response.CreatedAt,
+			}
+			if response.Encrypted {
+				exported.Content = response.Content
+			}
+
+			if err := emit(exported); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+		afterSeq = messages[len(messages)-1].Seq
+	}
+}
+
+// ExportUserChats - возвращает метаданные всех чатов пользователя, включая архивированные,
+// с его ролью в каждом чате
+func (uc *ChatUseCase) ExportUserChats(ctx context.Context, userID uint) ([]ExportedChat, error) {
+	chats, err := uc.chatRepo.GetUserChats(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	archivedIDs, err := uc.chatRepo.GetArchivedChatIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	archived := make(map[uint]bool, len(archivedIDs))
+	for _, id := range archivedIDs {
+		archived[id] = true
+	}
+
+	exported := make([]ExportedChat, 0, len(chats))
+	for _, chat := range chats {
+		role := "creator"
+		if chat.CreatedBy != userID {
+			if role, err = uc.chatRepo.GetMemberRole(ctx, chat.ID, userID); err != nil {
+				return nil, fmt.Errorf("failed to get member role: %v", err)
+			}
+		}
+
+		exported = append(exported, ExportedChat{
+			ID:        chat.ID,
+			Name:      chat.Name,
+			IsGroup:   chat.IsGroup,
+			Role:      role,
+			Archived:  archived[chat.ID],
+			CreatedAt: chat.CreatedAt,
+		})
+	}
+
+	return exported, nil
+}
+
+// ExportUserMessages - последовательно выгружает все сообщения, отправленные пользователем, в порядке
+// отправки и расшифрованные для него; сообщения других участников не выгружаются. Как и в ExportChat,
+// сообщения загружаются порциями и передаются в emit по одному
+func (uc *ChatUseCase) ExportUserMessages(ctx context.Context, userID uint, emit func(ExportedUserMessage) error) error {
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %v", err)
+	}
+
+	var afterID uint
+	for {
+		messages, err := uc.messageRepo.GetUserMessagesAfter(ctx, userID, afterID, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to load messages: %v", err)
+		}
+
+		for i := range messages {
+			response := uc.buildMessageResponse(ctx, &messages[i], user)
+
+			exported := ExportedUserMessage{
+				ChatID: response.ChatID,
+				ExportedMessage: ExportedMessage{
+					ID:             response.ID,
+					Seq:            response.Seq,
+					SenderID:       response.SenderID,
+					SenderUsername: response.Sender.Username,
+					MessageType:    response.MessageType,
+					Content:        response.DecryptedContent,
+					Encrypted:      response.Encrypted,
+					CreatedAt:      response.CreatedAt,
+				},
+			}
+			if response.Encrypted {
+				exported.Content = response.Content
+			}
+
+			if err := emit(exported); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < exportBatchSize {
+			return nil
+		}
+		afterID = messages[len(messages)-1].ID
+	}
+}
+
+// SearchMessages - ищет сообщения по всем чатам, в которых пользователь состоит сейчас, включая
+// архивированные. Просматриваются только последние searchScanPerChat сообщений каждого чата;
+// зашифрованные на клиенте и нерасшифрованные сообщения пропускаются. Совпадения упорядочены
+// от новых к старым, limit и offset применяются к ним до группировки по чатам
+func (uc *ChatUseCase) SearchMessages(ctx context.Context, userID uint, query string, limit, offset int) (*SearchPage, error) {
+	query = strings.TrimSpace(query)
+	if length := len([]rune(query)); length < minSearchQueryLength || length > maxSearchQueryLength {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+	if !user.HoldsServerKeys() {
+		return nil, ErrServerKeysDisabled
+	}
+
+	chats, err := uc.GetUserChats(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	scan := searchScanPerChat
+	if uc.historyLimit > 0 {
+		scan = min(scan, uc.historyLimit)
+	}
+
+	needle := []rune(query)
+	for i, r := range needle {
+		needle[i] = unicode.ToLower(r)
+	}
+	chatNames := make(map[uint]string, len(chats))
+	type chatHit struct {
+		chatID uint
+		hit    MessageSearchHit
+	}
+	var hits []chatHit
+
+	for _, chat := range chats {
+		chatNames[chat.ID] = chat.Name
+
+		messages, err := uc.messageRepo.GetChatMessages(ctx, chat.ID, scan, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load messages: %v", err)
+		}
+
+		for i := range messages {
+			msg := &messages[i]
+			if msg.ClientEncrypted {
+				continue
+			}
+
+			content, err := uc.decryptMessage(ctx, msg, user)
+			if err != nil {
+				uc.recordDecryptFailure(msg, err)
+				continue
+			}
+
+			snippet, ok := searchSnippet(content, needle)
+			if !ok {
+				continue
+			}
+			hits = append(hits, chatHit{chatID: chat.ID, hit: MessageSearchHit{
+				MessageID:      msg.ID,
+				Seq:            msg.Seq,
+				SenderID:       msg.SenderID,
+				SenderUsername: msg.Sender.Username,
+				Snippet:        snippet,
+				CreatedAt:      msg.CreatedAt,
+			}})
+		}
+	}
+
+	slices.SortStableFunc(hits, func(a, b chatHit) int {
+		return b.hit.CreatedAt.Compare(a.hit.CreatedAt)
+	})
+
+	page := &SearchPage{Results: []ChatSearchResult{}, Total: len(hits)}
+	if offset >= len(hits) {
+		return page, nil
+	}
+	end := min(offset+limit, len(hits))
+	page.HasMore = end < len(hits)
+
+	// Чаты следуют в порядке их самого свежего совпадения на странице
+	position := make(map[uint]int)
+	for _, h := range hits[offset:end] {
+		idx, ok := position[h.chatID]
+		if !ok {
+			idx = len(page.Results)
+			position[h.chatID] = idx
+			page.Results = append(page.Results, ChatSearchResult{ChatID: h.chatID, ChatName: chatNames[h.chatID]})
+		}
+		page.Results[idx].Messages = append(page.Results[idx].Messages, h.hit)
+	}
+
+	return page, nil
+}
+
+// searchSnippet - ищет needle в тексте без учета регистра и возвращает фрагмент вокруг первого
+// совпадения. Регистр понижается посимвольно, чтобы позиции совпадали с исходным текстом
+func searchSnippet(content string, needle []rune) (string, bool) {
+	runes := []rune(content)
+	lowered := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+	}
+
+	idx := -1
+	for i := 0; i+len(needle) <= len(lowered); i++ {
+		if slices.Equal(lowered[i:i+len(needle)], needle) {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return "", false
+	}
+
+	start := max(0, idx-searchSnippetRadius)
+	end := min(len(runes), idx+len(needle)+searchSnippetRadius)
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet, true
+}
+
+// AuthorizeGuestLink - проверяет, что пользователь может выдать гостевую ссылку на чат:
+// ссылки выдаются только для групповых чатов их администраторами
+func (uc *ChatUseCase) AuthorizeGuestLink(ctx context.Context, chatID, requesterID uint) error {
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return ErrChatNotFound
+	}
+	if !chat.IsGroup {
+		return ErrNotGroupChat
+	}
+
+	if chat.CreatedBy == requesterID {
+		return nil
+	}
+
+	role, err := uc.chatRepo.GetMemberRole(ctx, chatID, requesterID)
+	if err != nil {
+		return ErrNotChatMember
+	}
+	if role != "admin" {
+		return ErrNotChatAdmin
+	}
+
+	return nil
+}
+
+// GetGuestMessages - получает страницу истории чата для гостевого доступа только на чтение.
+// У гостя нет своих ключей, поэтому расшифровываются только сообщения, зашифрованные ключом чата;
+// остальные отдаются как шифротекст
+func (uc *ChatUseCase) GetGuestMessages(ctx context.Context, chatID uint, limit, offset int) (*MessagePage, error) {
+	if _, err := uc.chatRepo.GetByID(ctx, chatID); err != nil {
+		return nil, ErrChatNotFound
+	}
+
+	page := &MessagePage{}
+
+	total, err := uc.messageRepo.CountByChat(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %v", err)
+	}
+	page.Total = total
+
+	available := total
+	if uc.historyLimit > 0 {
+		if offset+limit > uc.historyLimit {
+			page.HistoryLimitReached = true
+			if offset >= uc.historyLimit {
+				return page, nil
+			}
+			limit = uc.historyLimit - offset
+		}
+		available = min(available, int64(uc.historyLimit))
+	}
+
+	messages, err := uc.messageRepo.GetChatMessages(ctx, chatID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	page.HasMore = int64(offset+len(messages)) < available
+
+	for i := range messages {
+		msg := &messages[i]
+		response := MessageResponse{Message: msg}
+		if msg.ClientEncrypted || msg.KeyVersion == 0 {
+			response.Encrypted = true
+		} else if content, err := uc.decryptMessage(ctx, msg, nil); err != nil {
+			uc.recordDecryptFailure(msg, err)
+			response.Encrypted = true
+		} else {
+			response.DecryptedContent = content
+		}
+		page.Messages = append(page.Messages, response)
+	}
+
+	return page, nil
+}
+
+// MessageVerification - результат повторной проверки подписей и HMAC сохраненного сообщения.
+// HMACValid равен nil, если у сервера нет общего секрета (например, сообщение зашифровано на клиенте)
+type MessageVerification struct {
+	MessageID  uint  `json:"message_id"`
+	ECDSAValid bool  `json:"ecdsa_valid"`
+	RSAValid   bool  `json:"rsa_valid"`
+	HMACValid  *bool `json:"hmac_valid"`
+	Valid      bool  `json:"valid"`
+}
+
+// VerifyMessage - заново проверяет подписи ECDSA и RSA и HMAC сообщения по сохраненным
+// публичным ключам отправителя; доступно только участникам чата
+func (uc *ChatUseCase) VerifyMessage(ctx context.Context, chatID, messageID, userID uint) (*MessageVerification, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %v", err)
+	}
+
+	sender, err := uc.userRepo.GetByID(ctx, message.SenderID)
+	if err != nil {
+		return nil, fmt.Errorf("sender not found: %v", err)
+	}
+
+	senderECDSAPublicKeyBytes, _ := hex.DecodeString(sender.ECDSAPublicKey)
+	senderRSAPublicKeyBytes, _ := hex.DecodeString(sender.RSAPublicKey)
+
+	secureMsg := &crypto.SecureMessage{
+		Ciphertext:     message.Content,
+		IV:             message.IV,
+		HMAC:           message.HMAC,
+		ECDSASignature: message.ECDSASignature,
+		RSASignature:   message.RSASignature,
+		Nonce:          message.Nonce,
+		Algorithm:      message.Algorithm,
+	}
+
+	var sharedSecret []byte
+	if !message.ClientEncrypted {
+		sharedSecret = uc.verificationSecret(ctx, message, user, senderECDSAPublicKeyBytes)
+	}
+
+	report := crypto.CheckSecureMessage(secureMsg, sharedSecret, senderECDSAPublicKeyBytes, senderRSAPublicKeyBytes)
+
+	return &MessageVerification{
+		MessageID:  message.ID,
+		ECDSAValid: report.ECDSAValid,
+		RSAValid:   report.RSAValid,
+		HMACValid:  report.HMACValid,
+		Valid:      report.ECDSAValid && report.RSAValid && (report.HMACValid == nil || *report.HMACValid),
+	}, nil
+}
+
+// verificationSecret - подбирает общий секрет для проверки HMAC так же, как при расшифровке;
+// возвращает nil, если секрет недоступен
+func (uc *ChatUseCase) verificationSecret(ctx context.Context, msg *entities.Message, user *entities.User, senderECDSAPublicKeyBytes []byte) []byte {
+	if msg.KeyVersion > 0 {
+		sharedSecret, err := uc.chatKey(ctx, msg.ChatID, msg.KeyVersion)
+		if err != nil {
+			return nil
+		}
+		return sharedSecret
+	}
+
+	if !user.HoldsServerKeys() {
+		return nil
+	}
+
+	userECDSAPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(user.ECDSAPrivateKey))
+	if err != nil {
+		return nil
+	}
+
+	sharedSecret, _, err := uc.legacySharedSecret(ctx, msg, user, userECDSAPrivateKey, senderECDSAPublicKeyBytes)
+	if err != nil {
+		return nil
+	}
+	return sharedSecret
+}
+
+// buildMessageResponse - формирует ответ с расшифрованным содержимым; если сообщение зашифровано
+// на клиенте или пользователь хранит ключи сам, сервер не расшифровывает и отдает шифротекст
+func (uc *ChatUseCase) buildMessageResponse(ctx context.Context, msg *entities.Message, user *entities.User) MessageResponse {
+	response := MessageResponse{Message: msg}
+	if msg.ClientEncrypted || !user.HoldsServerKeys() {
+		response.Encrypted = true
+		return response
+	}
+
+	decryptedContent, err := uc.decryptMessage(ctx, msg, user)
+	if err != nil {
+		uc.recordDecryptFailure(msg, err)
+		response.DecryptedContent = msg.Content
+	} else {
+		response.DecryptedContent = decryptedContent
+	}
+
+	return response
+}
+
+// decryptMessage - расшифровывает зашифрованное сообщение для конкретного пользователя
+func (uc *ChatUseCase) decryptMessage(ctx context.Context, msg *entities.Message, user *entities.User) (string, error) {
+	if msg.Content == "" || msg.IV == "" || msg.HMAC == "" {
+		return msg.Content, nil
+	}
+
+	sender, err := uc.userRepo.GetByID(ctx, msg.SenderID)
+	if err != nil {
+		return "", fmt.Errorf("sender not found: %v", err)
+	}
+
+	senderECDSAPublicKeyBytes, err := hex.DecodeString(sender.ECDSAPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode sender ECDSA public key: %v", err)
+	}
+
+	senderRSAPublicKeyBytes, err := hex.DecodeString(sender.RSAPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode sender RSA public key: %v", err)
+	}
+
+	var sharedSecret []byte
+	recipientID := fmt.Sprintf("chat:%d", msg.ChatID)
+
+	if msg.KeyVersion > 0 {
+		sharedSecret, err = uc.chatKey(ctx, msg.ChatID, msg.KeyVersion)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		userECDSAPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(user.ECDSAPrivateKey))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse user ECDSA private key: %v", err)
+		}
+
+		sharedSecret, recipientID, err = uc.legacySharedSecret(ctx, msg, user, userECDSAPrivateKey, senderECDSAPublicKeyBytes)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	timestamp := msg.CreatedAt.Unix()
+	if msg.Timestamp != nil {
+		timestamp = *msg.Timestamp
+	}
+
+	secureMsg := &crypto.SecureMessage{
+		Ciphertext:     msg.Content,
+		IV:             msg.IV,
+		HMAC:           msg.HMAC,
+		ECDSASignature: msg.ECDSASignature,
+		RSASignature:   msg.RSASignature,
+		Nonce:          msg.Nonce,
+		Timestamp:      timestamp,
+		SenderID:       fmt.Sprintf("%d", msg.SenderID),
+		RecipientID:    recipientID,
+		Algorithm:      msg.Algorithm,
+	}
+
+	plaintext, err := crypto.VerifyAndDecryptMessage(secureMsg, sharedSecret, senderECDSAPublicKeyBytes, senderRSAPublicKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt message: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// recordDecryptFailure - учитывает сбой расшифровки в метриках и логирует его этап,
+// не раскрывая содержимое сообщения и ключи
+func (uc *ChatUseCase) recordDecryptFailure(msg *entities.Message, err error) {
+	stage := "key_unavailable"
+	var decryptErr *crypto.DecryptError
+	if errors.As(err, &decryptErr) {
+		stage = decryptErr.Stage
+	}
+
+	uc.metrics.Inc("decrypt_failures_total")
+	uc.metrics.Inc("decrypt_failures." + stage)
+
+	if uc.logger != nil {
+		uc.logger.Errorf("Message decrypt failed: chat_id=%d message_id=%d key_version=%d stage=%s",
+			msg.ChatID, msg.ID, msg.KeyVersion, stage)
+	}
+}
+
+// ensureRecipients - проверяет, что в личном чате остался собеседник. Групповые сообщения шифруются
+// ключом чата, не зависящим от состава участников, и доступны тем, кто присоединится позже
+func ensureRecipients(chat *entities.Chat, senderID uint) error {
+	if chat.IsGroup {
+		return nil
+	}
+
+	for _, member := range chat.Members {
+		if member.ID != senderID {
+			return nil
+		}
+	}
+
+	return ErrNoRecipients
+}
+
+// legacySharedSecret - вычисляет попарный ECDH-секрет для сообщений, отправленных до
+// появления версионированных ключей чата (KeyVersion == 0)
+func (uc *ChatUseCase) legacySharedSecret(ctx context.Context, msg *entities.Message, user *entities.User, userECDSAPrivateKey *ecdsa.PrivateKey, senderECDSAPublicKeyBytes []byte) ([]byte, string, error) {
+	members, err := uc.chatRepo.GetMembers(ctx, msg.ChatID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get chat members: %v", err)
+	}
+
+	var sharedSecret []byte
+	if user.ID == msg.SenderID {
 		for _, member := range members {
 			if member.ID != msg.SenderID {
 				recipientPublicKeyBytes, err := hex.DecodeString(member.ECDSAPublicKey)
 				if err != nil {
-					return "", fmt.Errorf("failed to decode recipient public key: %v", err)
+					return nil, "", fmt.Errorf("failed to decode recipient public key: %v", err)
 				}
-				sharedSecret, err = crypto.ComputeECDHSharedSecret(userECDSAPrivateKey, recipientPublicKeyBytes)
+				sharedSecret, _ = crypto.ComputeECDHSharedSecret(userECDSAPrivateKey, recipientPublicKeyBytes)
 				break
 			}
 		}
 	} else {
-		sharedSecret, err = crypto.ComputeECDHSharedSecret(userECDSAPrivateKey, senderECDSAPublicKeyBytes)
+		sharedSecret, _ = crypto.ComputeECDHSharedSecret(userECDSAPrivateKey, senderECDSAPublicKeyBytes)
+	}
+
+	if len(sharedSecret) == 0 {
+		return nil, "", errors.New("no pairwise secret available for legacy message")
+	}
+
+	var recipientID uint = msg.SenderID
+
+	if len(members) > 1 {
+		for _, member := range members {
+			if member.ID != msg.SenderID {
+				recipientID = member.ID
+				break
+			}
+		}
+	}
+
+	return sharedSecret, fmt.Sprintf("%d", recipientID), nil
+}
+
+// rotateChatKey - генерирует новый ключ чата и делает его активным, возвращая новую версию
+func (uc *ChatUseCase) rotateChatKey(ctx context.Context, chatID uint) (int, error) {
+	key, err := crypto.GenerateNonce(crypto.AESKeySize + crypto.HMACKeySize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate chat key: %v", err)
+	}
+
+	version, err := uc.chatRepo.RotateKey(ctx, chatID, hex.EncodeToString(key))
+	if err != nil {
+		return 0, fmt.Errorf("failed to rotate chat key: %v", err)
+	}
+
+	return version, nil
+}
+
+// removeMemberAndRotateKey - удаляет участника и для групп сменяет ключ чата, чтобы
+// покинувший группу не мог расшифровать последующие сообщения
+func (uc *ChatUseCase) removeMemberAndRotateKey(ctx context.Context, chat *entities.Chat, userID uint) error {
+	if err := uc.chatRepo.RemoveMember(ctx, chat.ID, userID); err != nil {
+		return err
+	}
+
+	if !chat.IsGroup {
+		return nil
+	}
+
+	version, err := uc.rotateChatKey(ctx, chat.ID)
+	if err != nil {
+		return err
+	}
+
+	if uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chat.ID, EventKeyRotated, map[string]interface{}{
+			"chat_id":     chat.ID,
+			"key_version": version,
+		})
+	}
+
+	return nil
+}
+
+// activeChatKey - возвращает ключ и версию, которыми шифруются новые сообщения чата;
+// для чатов, созданных до версионирования ключей, ключ создается при первой отправке
+func (uc *ChatUseCase) activeChatKey(ctx context.Context, chat *entities.Chat) ([]byte, int, error) {
+	version := chat.KeyVersion
+	if version == 0 {
+		var err error
+		version, err = uc.rotateChatKey(ctx, chat.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		chat.KeyVersion = version
+	}
+
+	key, err := uc.chatKey(ctx, chat.ID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return key, version, nil
+}
+
+// chatKey - возвращает ключевой материал чата указанной версии
+func (uc *ChatUseCase) chatKey(ctx context.Context, chatID uint, version int) ([]byte, error) {
+	chatKey, err := uc.chatRepo.GetKey(ctx, chatID, version)
+	if err != nil {
+		return nil, fmt.Errorf("chat key version %d not found: %v", version, err)
+	}
+
+	key, err := hex.DecodeString(chatKey.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode chat key: %v", err)
+	}
+
+	return key, nil
+}
+
+// GetWrappedChatKey - возвращает ключ чата указанной версии, обернутый публичным ключом RSA участника;
+// версия 0 означает текущий ключ. Сервер не раскрывает ключ в открытом виде, поэтому его может
+// прочитать только владелец приватного ключа
+func (uc *ChatUseCase) GetWrappedChatKey(ctx context.Context, chatID, userID uint, version int) (*WrappedChatKey, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	if version == 0 {
+		chat, err := uc.chatRepo.GetByID(ctx, chatID)
+		if err != nil {
+			return nil, ErrChatNotFound
+		}
+		version = chat.KeyVersion
+	}
+	if version <= 0 {
+		return nil, ErrChatKeyNotFound
+	}
+
+	key, err := uc.chatKey(ctx, chatID, version)
+	if err != nil {
+		return nil, ErrChatKeyNotFound
+	}
+
+	user, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	publicKey, err := hex.DecodeString(user.RSAPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode user RSA public key: %v", err)
+	}
+
+	wrapped, err := crypto.WrapKeyRSA(publicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap chat key: %v", err)
+	}
+
+	return &WrappedChatKey{
+		ChatID:     chatID,
+		KeyVersion: version,
+		Algorithm:  ChatKeyWrapAlgorithm,
+		WrappedKey: hex.EncodeToString(wrapped),
+	}, nil
+}
+
+// MarkMessageDelivered - переводит сообщение в статус delivered после того,
+// как хаб подтвердил доставку хотя бы одному клиенту получателя
+func (uc *ChatUseCase) MarkMessageDelivered(ctx context.Context, chatID, messageID uint) {
+	changed, err := uc.messageRepo.AdvanceStatus(ctx, messageID, entities.MessageStatusDelivered)
+	if err != nil || !changed {
+		return
+	}
+
+	uc.broadcastMessageStatus(chatID, messageID, entities.MessageStatusDelivered, 0)
+}
+
+// MarkMessageRead - сохраняет отметку о прочтении и переводит сообщение в статус read
+func (uc *ChatUseCase) MarkMessageRead(ctx context.Context, chatID, messageID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return ErrMessageNotFound
+	}
+
+	// Собственные сообщения не меняют статус при чтении отправителем
+	if message.SenderID == userID {
+		return nil
+	}
+
+	if err := uc.messageRepo.CreateReceipt(ctx, &entities.MessageReceipt{
+		MessageID: messageID,
+		UserID:    userID,
+		ReadAt:    time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to save read receipt: %v", err)
+	}
+
+	changed, err := uc.messageRepo.AdvanceStatus(ctx, messageID, entities.MessageStatusRead)
+	if err != nil {
+		return fmt.Errorf("failed to update message status: %v", err)
+	}
+
+	if changed {
+		uc.broadcastMessageStatus(chatID, messageID, entities.MessageStatusRead, userID)
+	}
+
+	return nil
+}
+
+// GetMessageReaders - возвращает участнику чата список прочитавших сообщение
+func (uc *ChatUseCase) GetMessageReaders(ctx context.Context, chatID, messageID, userID uint) ([]entities.MessageReader, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+
+	readers, err := uc.messageRepo.GetReaders(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message readers: %v", err)
+	}
+
+	return readers, nil
+}
+
+// EditMessage - изменяет текст собственного сообщения и перешифровывает его активным ключом чата
+func (uc *ChatUseCase) EditMessage(ctx context.Context, chatID, messageID, userID uint, req *EditMessageRequest) (*entities.Message, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+	if message.SenderID != userID {
+		return nil, ErrMessageForbidden
+	}
+	// Системные и зашифрованные на клиенте сообщения сервер перешифровать не может
+	if message.MessageType == "system" || message.ClientEncrypted {
+		return nil, ErrMessageNotEditable
+	}
+	if err := uc.checkEditWindow(ctx, message, userID); err != nil {
+		return nil, err
+	}
+
+	content, err := sanitizeContent(req.Content, uc.controlCharsPolicy)
+	if err != nil {
+		return nil, err
+	}
+	req.Content = content
+
+	// Пометка не снимается при правке: проверить исходный текст должен модератор
+	flagged, err := uc.applyContentFilter(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	message.Flagged = message.Flagged || flagged
+
+	sender, err := uc.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("sender not found")
+	}
+	if !sender.HoldsServerKeys() {
+		return nil, ErrServerKeysDisabled
+	}
+
+	senderECDSAPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(sender.ECDSAPrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sender ECDSA private key: %v", err)
+	}
+	senderRSAPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(sender.RSAPrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sender RSA private key: %v", err)
+	}
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %v", err)
+	}
+
+	sharedSecret, keyVersion, err := uc.activeChatKey(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	secureMsg, err := crypto.CreateSecureMessage(
+		uc.messageAlgorithm,
+		fmt.Sprintf("%d", userID),
+		fmt.Sprintf("chat:%d", chatID),
+		[]byte(content),
+		sharedSecret,
+		senderECDSAPrivateKey,
+		senderRSAPrivateKey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secure message: %v", err)
+	}
+
+	editedAt := time.Now()
+	message.Content = secureMsg.Ciphertext
+	message.Timestamp = &secureMsg.Timestamp
+	message.Nonce = secureMsg.Nonce
+	message.IV = secureMsg.IV
+	message.HMAC = secureMsg.HMAC
+	message.ECDSASignature = secureMsg.ECDSASignature
+	message.RSASignature = secureMsg.RSASignature
+	message.Algorithm = secureMsg.Algorithm
+	message.KeyVersion = keyVersion
+	message.IsEdited = true
+	message.EditedAt = &editedAt
+
+	if err := uc.messageRepo.Update(ctx, message); err != nil {
+		return nil, fmt.Errorf("failed to update message: %v", err)
+	}
+
+	if uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chatID, EventMessageEdited, map[string]interface{}{
+			"chat_id":         chatID,
+			"message_id":      message.ID,
+			"content":         content,
+			"key_version":     message.KeyVersion,
+			"edited_at":       editedAt,
+			"nonce":           message.Nonce,
+			"iv":              message.IV,
+			"hmac":            message.HMAC,
+			"ecdsa_signature": message.ECDSASignature,
+			"rsa_signature":   message.RSASignature,
+			"algorithm":       crypto.MessageAlgorithmOrDefault(message.Algorithm),
+		})
+	}
+
+	return message, nil
+}
+
+// checkSlowMode - проверяет, что с последнего сообщения пользователя в чате прошел интервал
+// медленного режима; администраторы чата от проверки освобождены
+func (uc *ChatUseCase) checkSlowMode(ctx context.Context, chat *entities.Chat, senderID uint) error {
+	if chat.SlowModeSeconds <= 0 {
+		return nil
+	}
+
+	role, err := uc.chatRepo.GetMemberRole(ctx, chat.ID, senderID)
+	if err != nil {
+		return fmt.Errorf("failed to get member role: %v", err)
+	}
+	if role == "admin" || chat.CreatedBy == senderID {
+		return nil
+	}
+
+	lastSentAt, err := uc.messageRepo.GetLastSentAt(ctx, chat.ID, senderID)
+	if err != nil {
+		return fmt.Errorf("failed to get last message time: %v", err)
+	}
+	if lastSentAt == nil {
+		return nil
+	}
+
+	interval := time.Duration(chat.SlowModeSeconds) * time.Second
+	if remaining := interval - time.Since(*lastSentAt); remaining > 0 {
+		return &SlowModeError{Remaining: remaining}
+	}
+
+	return nil
+}
+
+// SetSlowMode - задает минимальный интервал между сообщениями участника группового чата;
+// изменять его могут создатель и администраторы
+func (uc *ChatUseCase) SetSlowMode(ctx context.Context, chatID, requesterID uint, seconds int) error {
+	if seconds < 0 || seconds > MaxSlowModeSeconds {
+		return fmt.Errorf("slow mode interval must be between 0 and %d seconds", MaxSlowModeSeconds)
+	}
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return ErrChatNotFound
+	}
+	if !chat.IsGroup {
+		return ErrNotGroupChat
+	}
+
+	role, err := uc.chatRepo.GetMemberRole(ctx, chatID, requesterID)
+	if err != nil {
+		return ErrNotChatMember
+	}
+	if role != "admin" && chat.CreatedBy != requesterID {
+		return ErrNotChatAdmin
+	}
+
+	if chat.SlowModeSeconds == seconds {
+		return nil
+	}
+
+	if err := uc.chatRepo.SetSlowMode(ctx, chatID, seconds); err != nil {
+		return fmt.Errorf("failed to update slow mode: %v", err)
+	}
+
+	if uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chatID, EventSlowModeChanged, map[string]interface{}{
+			"chat_id":           chatID,
+			"slow_mode_seconds": seconds,
+			"changed_by":        requesterID,
+		})
+	}
+
+	return nil
+}
+
+// checkEditWindow - проверяет, что сообщение отправлено не раньше окна редактирования;
+// администраторы освобождаются от проверки, если это разрешено настройками
+func (uc *ChatUseCase) checkEditWindow(ctx context.Context, message *entities.Message, userID uint) error {
+	if uc.editWindow <= 0 || time.Since(message.CreatedAt) <= uc.editWindow {
+		return nil
+	}
+
+	if uc.editAdminExempt {
+		role, err := uc.chatRepo.GetMemberRole(ctx, message.ChatID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get member role: %v", err)
+		}
+		if role == "admin" {
+			return nil
+		}
+	}
+
+	return ErrEditWindowExpired
+}
+
+// DeleteMessage - удаляет сообщение; разрешено автору, а в групповых чатах также администраторам
+func (uc *ChatUseCase) DeleteMessage(ctx context.Context, chatID, messageID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return ErrMessageNotFound
+	}
+
+	if message.SenderID != userID {
+		if !message.Chat.IsGroup {
+			return ErrMessageForbidden
+		}
+		role, err := uc.chatRepo.GetMemberRole(ctx, chatID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get member role: %v", err)
+		}
+		if role != "admin" {
+			return ErrMessageForbidden
+		}
+	}
+
+	if err := uc.messageRepo.Delete(ctx, messageID, userID); err != nil {
+		return fmt.Errorf("failed to delete message: %v", err)
+	}
+
+	if uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chatID, EventMessageDeleted, map[string]interface{}{
+			"chat_id":    chatID,
+			"message_id": messageID,
+			"deleted_by": userID,
+		})
+	}
+
+	return nil
+}
+
+// RestoreMessage - отменяет удаление сообщения в течение окна восстановления; разрешено
+// тому, кто удалил сообщение, а в групповых чатах также администраторам
+func (uc *ChatUseCase) RestoreMessage(ctx context.Context, chatID, messageID, userID uint) (*MessageResponse, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
 	}
 
-	if len(sharedSecret) == 0 {
-		sharedSecret = make([]byte, 64)
-		copy(sharedSecret, "default-shared-secret-for-single-user-or-error")
+	message, err := uc.messageRepo.GetDeletedByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
 	}
 
-	var recipientID uint = msg.SenderID
+	if uc.restoreWindow <= 0 || time.Since(message.DeletedAt.Time) > uc.restoreWindow {
+		return nil, ErrRestoreWindowExpired
+	}
 
-	if len(members) > 1 {
-		for _, member := range members {
-			if member.ID != msg.SenderID {
-				recipientID = member.ID
-				break
-			}
+	if message.DeletedBy == nil || *message.DeletedBy != userID {
+		if !message.Chat.IsGroup {
+			return nil, ErrMessageForbidden
+		}
+		role, err := uc.chatRepo.GetMemberRole(ctx, chatID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get member role: %v", err)
+		}
+		if role != "admin" {
+			return nil, ErrMessageForbidden
 		}
 	}
 
-	timestamp := msg.CreatedAt.Unix()
-	if msg.Timestamp != nil {
-		timestamp = *msg.Timestamp
+	// Сообщение могли стереть окончательно между проверкой окна и восстановлением
+	restoredNow, err := uc.messageRepo.Restore(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore message: %v", err)
+	}
+	if !restoredNow {
+		return nil, ErrMessageNotFound
 	}
 
-	secureMsg := &crypto.SecureMessage{
-		Ciphertext:     msg.Content,
-		IV:             msg.IV,
-		HMAC:           msg.HMAC,
-		ECDSASignature: msg.ECDSASignature,
-		RSASignature:   msg.RSASignature,
-		Nonce:          msg.Nonce,
-		Timestamp:      timestamp,
-		SenderID:       fmt.Sprintf("%d", msg.SenderID),
-		RecipientID:    fmt.Sprintf("%d", recipientID),
+	restored, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, ErrMessageNotFound
 	}
 
-	plaintext, err := crypto.VerifyAndDecryptMessage(secureMsg, sharedSecret, senderECDSAPublicKeyBytes, senderRSAPublicKeyBytes)
+	user, err := uc.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt message: %v", err)
+		return nil, fmt.Errorf("user not found: %v", err)
 	}
 
-	return string(plaintext), nil
+	if uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chatID, EventMessageRestored, map[string]interface{}{
+			"chat_id":     chatID,
+			"message_id":  messageID,
+			"restored_by": userID,
+		})
+	}
+
+	response := uc.buildMessageResponse(ctx, restored, user)
+	return &response, nil
+}
+
+// broadcastMessageStatus - рассылает участникам чата событие об изменении статуса сообщения
+func (uc *ChatUseCase) broadcastMessageStatus(chatID, messageID uint, status string, userID uint) {
+	if uc.notificationSender == nil {
+		return
+	}
+
+	data := map[string]interface{}{
+		"message_id": messageID,
+		"chat_id":    chatID,
+		"status":     status,
+	}
+	if userID != 0 {
+		data["user_id"] = userID
+	}
+
+	uc.notificationSender.SendEventToChat(chatID, EventMessageStatus, data)
 }
 
 // AddMember - добавляет нового участника в чат
-func (uc *ChatUseCase) AddMember(chatID, requesterID, newMemberID uint) error {
-	isMember, err := uc.chatRepo.IsMember(chatID, requesterID)
+func (uc *ChatUseCase) AddMember(ctx context.Context, chatID, requesterID, newMemberID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, requesterID)
 	if err != nil {
 		return err
 	}
 	if !isMember {
 		return errors.New("you are not a member of this chat")
 	}
+	if newMemberID == requesterID {
+		return ErrCannotAddSelf
+	}
 
-	isAlreadyMember, err := uc.chatRepo.IsMember(chatID, newMemberID)
+	isAlreadyMember, err := uc.chatRepo.IsMember(ctx, chatID, newMemberID)
 	if err != nil {
 		return err
 	}
@@ -407,50 +2241,154 @@ func (uc *ChatUseCase) AddMember(chatID, requesterID, newMemberID uint) error {
 		return errors.New("user is already a member of this chat")
 	}
 
-	err = uc.chatRepo.AddMember(chatID, newMemberID, "member")
+	err = uc.chatRepo.AddMember(ctx, chatID, newMemberID, "member")
 	if err != nil {
 		return err
 	}
 
-	newUser, err := uc.userRepo.GetByID(newMemberID)
+	newUser, err := uc.userRepo.GetByID(ctx, newMemberID)
 	if err != nil {
 		return nil
 	}
 
 	systemMessageText := fmt.Sprintf("%s присоединился к группе", newUser.Username)
 
-	err = uc.createSystemMessage(chatID, systemMessageText)
+	err = uc.createSystemMessage(ctx, chatID, systemMessageText)
 	if err != nil {
 	}
 
 	if uc.notificationSender != nil {
-		notification := &entities.Notification{
-			Type:    "user_joined",
-			Message: systemMessageText,
-			Data: map[string]interface{}{
-				"user_id":  newMemberID,
-				"username": newUser.Username,
-				"chat_id":  chatID,
-			},
-		}
+		notification := entities.NewUserJoinedNotification(chatID, systemMessageText, newMemberID, newUser.Username)
 
 		uc.notificationSender.SendNotificationToChat(chatID, notification)
+		uc.notifyChatInvited(ctx, chatID, requesterID, newMemberID)
 	}
 
 	return nil
 }
 
+// notifyChatInvited - лично уведомляет добавленного пользователя о новом чате; уведомление
+// доставляется по ID пользователя, так как на этот чат он еще не подписан
+func (uc *ChatUseCase) notifyChatInvited(ctx context.Context, chatID, inviterID, invitedID uint) {
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		uc.logger.Errorf("Failed to load chat %d for invite notification: %v", chatID, err)
+		return
+	}
+
+	inviter, err := uc.userRepo.GetByID(ctx, inviterID)
+	if err != nil {
+		uc.logger.Errorf("Failed to load inviter %d for invite notification: %v", inviterID, err)
+		return
+	}
+
+	message := fmt.Sprintf("%s добавил вас в чат \"%s\"", inviter.Username, chat.Name)
+	notification := entities.NewChatInvitedNotification(chatID, message, chat.Name, chat.IsGroup, inviterID, inviter.Username)
+	uc.notificationSender.SendNotificationToUser(invitedID, notification)
+}
+
+// AddMembers - добавляет в группу сразу несколько пользователей. Все пользователи должны существовать;
+// уже состоящие в чате пропускаются и отмечаются в результатах. Остальные добавляются в одной
+// транзакции, после чего создается одно системное сообщение и одно уведомление для чата
+func (uc *ChatUseCase) AddMembers(ctx context.Context, chatID, requesterID uint, userIDs []uint) ([]AddMemberResult, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
+	if err != nil {
+		return nil, ErrChatNotFound
+	}
+	if !chat.IsGroup {
+		return nil, ErrNotGroupChat
+	}
+
+	requester, err := uc.userRepo.GetByID(ctx, requesterID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	results := make([]AddMemberResult, 0, len(userIDs))
+	seen := make(map[uint]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+
+		user, err := uc.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrMemberNotFound, userID)
+		}
+		results = append(results, AddMemberResult{UserID: user.ID, Username: user.Username})
+	}
+
+	var addedIDs []uint
+	var addedNames []string
+	for i := range results {
+		if results[i].UserID == requesterID {
+			results[i].Error = ErrCannotAddSelf.Error()
+			continue
+		}
+		alreadyMember, err := uc.chatRepo.IsMember(ctx, chatID, results[i].UserID)
+		if err != nil {
+			return nil, err
+		}
+		if alreadyMember {
+			results[i].Error = "user is already a member of this chat"
+			continue
+		}
+		addedIDs = append(addedIDs, results[i].UserID)
+		addedNames = append(addedNames, results[i].Username)
+	}
+
+	if len(addedIDs) == 0 {
+		return results, nil
+	}
+
+	if err := uc.chatRepo.AddMembers(ctx, chatID, addedIDs, "member"); err != nil {
+		return nil, fmt.Errorf("failed to add members: %v", err)
+	}
+	for i := range results {
+		if results[i].Error == "" {
+			results[i].Added = true
+		}
+	}
+
+	systemMessageText := fmt.Sprintf("%s добавил в группу: %s", requester.Username, strings.Join(addedNames, ", "))
+	if err := uc.createSystemMessage(ctx, chatID, systemMessageText); err != nil {
+		uc.logger.Errorf("Failed to create system message for chat %d: %v", chatID, err)
+	}
+
+	if uc.notificationSender != nil {
+		notification := entities.NewMembersAddedNotification(chatID, systemMessageText, addedIDs, addedNames, requesterID, requester.Username)
+		uc.notificationSender.SendNotificationToChat(chatID, notification)
+		for _, userID := range addedIDs {
+			uc.notifyChatInvited(ctx, chatID, requesterID, userID)
+		}
+	}
+
+	return results, nil
+}
+
 // AddMemberWithUserData - добавляет нового участника в чат и возвращает данные пользователя
-func (uc *ChatUseCase) AddMemberWithUserData(chatID, requesterID, newMemberID uint) (*entities.User, error) {
-	isMember, err := uc.chatRepo.IsMember(chatID, requesterID)
+func (uc *ChatUseCase) AddMemberWithUserData(ctx context.Context, chatID, requesterID, newMemberID uint) (*entities.User, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, requesterID)
 	if err != nil {
 		return nil, err
 	}
 	if !isMember {
 		return nil, errors.New("you are not a member of this chat")
 	}
+	if newMemberID == requesterID {
+		return nil, ErrCannotAddSelf
+	}
 
-	isAlreadyMember, err := uc.chatRepo.IsMember(chatID, newMemberID)
+	isAlreadyMember, err := uc.chatRepo.IsMember(ctx, chatID, newMemberID)
 	if err != nil {
 		return nil, err
 	}
@@ -458,42 +2396,36 @@ func (uc *ChatUseCase) AddMemberWithUserData(chatID, requesterID, newMemberID ui
 		return nil, errors.New("user is already a member of this chat")
 	}
 
-	err = uc.chatRepo.AddMember(chatID, newMemberID, "member")
+	err = uc.chatRepo.AddMember(ctx, chatID, newMemberID, "member")
 	if err != nil {
 		return nil, err
 	}
 
-	newUser, err := uc.userRepo.GetByID(newMemberID)
+	newUser, err := uc.userRepo.GetByID(ctx, newMemberID)
 	if err != nil {
 		return nil, err
 	}
+	newUser.IsOnline = uc.isUserOnline(newUser.ID)
 
 	systemMessageText := fmt.Sprintf("%s присоединился к группе", newUser.Username)
 
-	err = uc.createSystemMessage(chatID, systemMessageText)
+	err = uc.createSystemMessage(ctx, chatID, systemMessageText)
 	if err != nil {
 	}
 
 	if uc.notificationSender != nil {
-		notification := &entities.Notification{
-			Type:    "user_joined",
-			Message: systemMessageText,
-			Data: map[string]interface{}{
-				"user_id":  newMemberID,
-				"username": newUser.Username,
-				"chat_id":  chatID,
-			},
-		}
+		notification := entities.NewUserJoinedNotification(chatID, systemMessageText, newMemberID, newUser.Username)
 
 		uc.notificationSender.SendNotificationToChat(chatID, notification)
+		uc.notifyChatInvited(ctx, chatID, requesterID, newMemberID)
 	}
 
 	return newUser, nil
 }
 
 // RemoveMember - удаляет участника из чата (только админы и создатель)
-func (uc *ChatUseCase) RemoveMember(chatID, actorID, memberID uint) error {
-	isMemberActor, err := uc.chatRepo.IsMember(chatID, actorID)
+func (uc *ChatUseCase) RemoveMember(ctx context.Context, chatID, actorID, memberID uint) error {
+	isMemberActor, err := uc.chatRepo.IsMember(ctx, chatID, actorID)
 	if err != nil {
 		return err
 	}
@@ -501,7 +2433,7 @@ func (uc *ChatUseCase) RemoveMember(chatID, actorID, memberID uint) error {
 		return errors.New("you are not a member of this chat")
 	}
 
-	isMemberTarget, err := uc.chatRepo.IsMember(chatID, memberID)
+	isMemberTarget, err := uc.chatRepo.IsMember(ctx, chatID, memberID)
 	if err != nil {
 		return err
 	}
@@ -509,89 +2441,63 @@ func (uc *ChatUseCase) RemoveMember(chatID, actorID, memberID uint) error {
 		return errors.New("target user is not a member of this chat")
 	}
 
-	chat, err := uc.chatRepo.GetByID(chatID)
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return err
 	}
 
-	actorRole, err := uc.chatRepo.GetMemberRole(chatID, actorID)
+	actorRole, err := uc.chatRepo.GetMemberRole(ctx, chatID, actorID)
 	if err != nil {
 		return err
 	}
 
-	targetRole, err := uc.chatRepo.GetMemberRole(chatID, memberID)
+	targetRole, err := uc.chatRepo.GetMemberRole(ctx, chatID, memberID)
 	if err != nil {
 		return err
 	}
 
+	// Создателя нельзя удалить из чата никому, в том числе ему самому. Последнего администратора
+	// не даст удалить репозиторий: проверка выполняется в транзакции удаления
+	if memberID == chat.CreatedBy {
+		return ErrCannotRemoveCreator
+	}
+
 	if chat.CreatedBy == actorID {
-		removedUser, err := uc.userRepo.GetByID(memberID)
+		removedUser, err := uc.userRepo.GetByID(ctx, memberID)
 		if err != nil {
 			return err
 		}
-		actorUser, err := uc.userRepo.GetByID(actorID)
+		actorUser, err := uc.userRepo.GetByID(ctx, actorID)
 		if err != nil {
 			return err
 		}
 
-		systemMessageText := fmt.Sprintf("%s был(а) удален(а) из группы создателем %s", removedUser.Username, actorUser.Username)
-
-		err = uc.createSystemMessage(chatID, systemMessageText)
-		if err != nil {
-		}
-
-		if uc.notificationSender != nil {
-			notification := &entities.Notification{
-				Type:    "user_removed",
-				ChatID:  chatID,
-				Message: systemMessageText,
-				Data: map[string]interface{}{
-					"removed_user_id":  memberID,
-					"removed_username": removedUser.Username,
-					"actor_id":         actorID,
-					"actor_username":   actorUser.Username,
-					"chat_name":        chat.Name,
-				},
-			}
-			uc.notificationSender.SendNotificationToChat(chatID, notification)
+		if err := uc.removeMemberAndRotateKey(ctx, chat, memberID); err != nil {
+			return err
 		}
 
-		return uc.chatRepo.RemoveMember(chatID, memberID)
+		systemMessageText := fmt.Sprintf("%s был(а) удален(а) из группы создателем %s", removedUser.Username, actorUser.Username)
+		uc.announceMemberRemoved(ctx, chat, systemMessageText, removedUser, actorUser)
+		return nil
 	}
 
 	if actorRole == "admin" && targetRole == "member" {
-		removedUser, err := uc.userRepo.GetByID(memberID)
+		removedUser, err := uc.userRepo.GetByID(ctx, memberID)
 		if err != nil {
 			return err
 		}
-		actorUser, err := uc.userRepo.GetByID(actorID)
+		actorUser, err := uc.userRepo.GetByID(ctx, actorID)
 		if err != nil {
 			return err
 		}
 
-		systemMessageText := fmt.Sprintf("%s был(а) удален(а) из группы администратором %s", removedUser.Username, actorUser.Username)
-
-		err = uc.createSystemMessage(chatID, systemMessageText)
-		if err != nil {
-		}
-
-		if uc.notificationSender != nil {
-			notification := &entities.Notification{
-				Type:    "user_removed",
-				ChatID:  chatID,
-				Message: systemMessageText,
-				Data: map[string]interface{}{
-					"removed_user_id":  memberID,
-					"removed_username": removedUser.Username,
-					"actor_id":         actorID,
-					"actor_username":   actorUser.Username,
-					"chat_name":        chat.Name,
-				},
-			}
-			uc.notificationSender.SendNotificationToChat(chatID, notification)
+		if err := uc.removeMemberAndRotateKey(ctx, chat, memberID); err != nil {
+			return err
 		}
 
-		return uc.chatRepo.RemoveMember(chatID, memberID)
+		systemMessageText := fmt.Sprintf("%s был(а) удален(а) из группы администратором %s", removedUser.Username, actorUser.Username)
+		uc.announceMemberRemoved(ctx, chat, systemMessageText, removedUser, actorUser)
+		return nil
 	}
 
 	if actorRole == "member" {
@@ -601,10 +2507,74 @@ func (uc *ChatUseCase) RemoveMember(chatID, actorID, memberID uint) error {
 	return errors.New("you don't have permission to remove this user")
 }
 
+// announceMemberRemoved - публикует системное сообщение и уведомление об уже выполненном удалении.
+// Удаленный пользователь больше не состоит в чате, поэтому уведомление отправляется ему отдельно
+func (uc *ChatUseCase) announceMemberRemoved(ctx context.Context, chat *entities.Chat, text string, removedUser, actorUser *entities.User) {
+	if err := uc.createSystemMessage(ctx, chat.ID, text); err != nil {
+		uc.logger.Errorf("Failed to create system message for chat %d: %v", chat.ID, err)
+	}
+
+	if uc.notificationSender != nil {
+		notification := entities.NewUserRemovedNotification(
+			chat.ID, text,
+			removedUser.ID, removedUser.Username,
+			actorUser.ID, actorUser.Username,
+			chat.Name,
+		)
+		uc.notificationSender.SendNotificationToChat(chat.ID, notification)
+		uc.notificationSender.SendNotificationToUser(removedUser.ID, notification)
+	}
+}
+
+// GetChatStats - собирает статистику чата агрегирующими запросами, не загружая сами сообщения
+func (uc *ChatUseCase) GetChatStats(ctx context.Context, chatID, userID uint) (*ChatStats, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	stats := &ChatStats{ChatID: chatID}
+
+	if stats.MessageCount, err = uc.messageRepo.CountByChat(ctx, chatID); err != nil {
+		return nil, fmt.Errorf("failed to count messages: %v", err)
+	}
+
+	if stats.MemberCount, err = uc.chatRepo.CountMembers(ctx, chatID); err != nil {
+		return nil, fmt.Errorf("failed to count members: %v", err)
+	}
+
+	if stats.MostActiveMember, err = uc.messageRepo.GetTopSender(ctx, chatID); err != nil {
+		return nil, fmt.Errorf("failed to get most active member: %v", err)
+	}
+
+	now := time.Now()
+	firstDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -(statsDays - 1))
+	daily, err := uc.messageRepo.CountPerDay(ctx, chatID, firstDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages per day: %v", err)
+	}
+
+	// Дни без сообщений заполняются нулями, чтобы клиент всегда получал полную неделю
+	byDate := make(map[string]int64, len(daily))
+	for _, day := range daily {
+		byDate[day.Day.Format("2006-01-02")] = day.Count
+	}
+	stats.MessagesPerDay = make([]DayMessageCount, 0, statsDays)
+	for i := 0; i < statsDays; i++ {
+		date := firstDay.AddDate(0, 0, i).Format("2006-01-02")
+		stats.MessagesPerDay = append(stats.MessagesPerDay, DayMessageCount{Date: date, Count: byDate[date]})
+	}
+
+	return stats, nil
+}
+
 // GetChatMembers - получает список всех участников чата с их ролями
-func (uc *ChatUseCase) GetChatMembers(chatID, userID uint) ([]*entities.User, error) {
+func (uc *ChatUseCase) GetChatMembers(ctx context.Context, chatID, userID uint) ([]*entities.User, error) {
 	if userID != 0 {
-		isMember, err := uc.chatRepo.IsMember(chatID, userID)
+		isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
 		if err != nil {
 			return nil, err
 		}
@@ -614,28 +2584,67 @@ func (uc *ChatUseCase) GetChatMembers(chatID, userID uint) ([]*entities.User, er
 		}
 	}
 
-	chat, err := uc.chatRepo.GetByID(chatID)
+	members, err := uc.chatRepo.GetMembersWithRoles(ctx, chatID, 0, 0)
 	if err != nil {
 		return nil, err
 	}
 
-	members, err := uc.chatRepo.GetMembersWithRoles(chatID)
+	for _, member := range members {
+		member.IsOnline = uc.isUserOnline(member.ID)
+	}
+
+	return members, nil
+}
+
+// GetChatMembersPage - получает страницу участников чата с их ролями в порядке вступления
+// и общее число участников
+func (uc *ChatUseCase) GetChatMembersPage(ctx context.Context, chatID, userID uint, limit, offset int) (*MemberPage, error) {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
 		return nil, err
 	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
 
-	for i := range members {
-		if members[i].ID == chat.CreatedBy {
-			members[i].Role = "creator"
-		}
+	total, err := uc.chatRepo.CountMembers(ctx, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members: %v", err)
 	}
 
-	return members, nil
+	members, err := uc.chatRepo.GetMembersWithRoles(ctx, chatID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		member.IsOnline = uc.isUserOnline(member.ID)
+	}
+
+	return &MemberPage{
+		Members: members,
+		Total:   total,
+		HasMore: int64(offset+len(members)) < total,
+	}, nil
+}
+
+// isUserOnline - возвращает фактический статус подключения пользователя; флаг в БД
+// не используется, так как он не обновляется при подключении и отключении WebSocket
+func (uc *ChatUseCase) isUserOnline(userID uint) bool {
+	if uc.presence == nil {
+		return false
+	}
+	return uc.presence.IsUserOnline(userID)
+}
+
+// IsChatMember - проверяет, является ли пользователь участником чата
+func (uc *ChatUseCase) IsChatMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	return uc.chatRepo.IsMember(ctx, chatID, userID)
 }
 
 // SetAdmin - назначает пользователя администратором чата (только создатель)
-func (uc *ChatUseCase) SetAdmin(chatID, requesterID, targetUserID uint) error {
-	chat, err := uc.chatRepo.GetByID(chatID)
+func (uc *ChatUseCase) SetAdmin(ctx context.Context, chatID, requesterID, targetUserID uint) error {
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return fmt.Errorf("failed to get chat: %v", err)
 	}
@@ -644,7 +2653,7 @@ func (uc *ChatUseCase) SetAdmin(chatID, requesterID, targetUserID uint) error {
 		return errors.New("only chat creator can assign admin rights")
 	}
 
-	isMember, err := uc.chatRepo.IsMember(chatID, targetUserID)
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, targetUserID)
 	if err != nil {
 		return err
 	}
@@ -652,21 +2661,19 @@ func (uc *ChatUseCase) SetAdmin(chatID, requesterID, targetUserID uint) error {
 		return errors.New("user is not a member of this chat")
 	}
 
-	currentRole, err := uc.chatRepo.GetMemberRole(chatID, targetUserID)
-	if err != nil {
-		return fmt.Errorf("failed to get user role: %v", err)
-	}
-
-	if currentRole == "admin" {
+	// Создатель и так обладает всеми правами администратора
+	if targetUserID == chat.CreatedBy {
 		return nil
 	}
 
-	return uc.chatRepo.UpdateMemberRole(chatID, targetUserID, "admin")
+	return uc.changeMemberRole(ctx, chatID, targetUserID, requesterID, func(string) (string, error) {
+		return "admin", nil
+	})
 }
 
 // RemoveAdmin - снимает права администратора с пользователя (только создатель)
-func (uc *ChatUseCase) RemoveAdmin(chatID, requesterID, targetUserID uint) error {
-	chat, err := uc.chatRepo.GetByID(chatID)
+func (uc *ChatUseCase) RemoveAdmin(ctx context.Context, chatID, requesterID, targetUserID uint) error {
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return fmt.Errorf("failed to get chat: %v", err)
 	}
@@ -675,7 +2682,7 @@ func (uc *ChatUseCase) RemoveAdmin(chatID, requesterID, targetUserID uint) error
 		return errors.New("only chat creator can remove admin rights")
 	}
 
-	isMember, err := uc.chatRepo.IsMember(chatID, targetUserID)
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, targetUserID)
 	if err != nil {
 		return err
 	}
@@ -683,21 +2690,141 @@ func (uc *ChatUseCase) RemoveAdmin(chatID, requesterID, targetUserID uint) error
 		return errors.New("user is not a member of this chat")
 	}
 
-	currentRole, err := uc.chatRepo.GetMemberRole(chatID, targetUserID)
+	if targetUserID == chat.CreatedBy {
+		return ErrCreatorRoleFixed
+	}
+
+	return uc.changeMemberRole(ctx, chatID, targetUserID, requesterID, func(current string) (string, error) {
+		if current != "admin" {
+			return current, nil
+		}
+		return "member", nil
+	})
+}
+
+// UpdateMemberRoles - меняет роли нескольких участников группы в одной транзакции (только создатель).
+// Все пользователи должны состоять в чате, а после изменений в группе должен остаться хотя бы один
+// администратор; иначе не меняется ни одна роль. Возвращает только действительно изменившиеся роли
+func (uc *ChatUseCase) UpdateMemberRoles(ctx context.Context, chatID, requesterID uint, roles map[uint]string) ([]RoleChange, error) {
+	if len(roles) == 0 || len(roles) > maxRoleChanges {
+		return nil, ErrInvalidRoleChanges
+	}
+
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
-		return fmt.Errorf("failed to get user role: %v", err)
+		return nil, ErrChatNotFound
+	}
+	if !chat.IsGroup {
+		return nil, ErrNotGroupChat
+	}
+	if chat.CreatedBy != requesterID {
+		return nil, ErrNotChatCreator
 	}
 
-	if currentRole != "admin" {
-		return nil
+	members, err := uc.chatRepo.GetMembersWithRoles(ctx, chatID, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*entities.User, len(members))
+	for _, member := range members {
+		byID[member.ID] = member
+	}
+
+	for userID, role := range roles {
+		if userID == chat.CreatedBy {
+			return nil, ErrCreatorRoleFixed
+		}
+		if role != "admin" && role != "member" {
+			return nil, ErrInvalidRoleChanges
+		}
+		if byID[userID] == nil {
+			return nil, fmt.Errorf("%w: %d", ErrNotChatMember, userID)
+		}
 	}
 
-	return uc.chatRepo.UpdateMemberRole(chatID, targetUserID, "member")
+	previous, err := uc.chatRepo.SetMemberRoles(ctx, chatID, roles)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotMember) {
+			return nil, ErrNotChatMember
+		}
+		if errors.Is(err, ErrLastAdmin) {
+			return nil, ErrLastAdmin
+		}
+		return nil, fmt.Errorf("failed to update roles: %v", err)
+	}
+
+	changes := make([]RoleChange, 0, len(roles))
+	for userID, role := range roles {
+		if previous[userID] == role {
+			continue
+		}
+		changes = append(changes, RoleChange{
+			UserID:   userID,
+			Username: byID[userID].Username,
+			OldRole:  previous[userID],
+			NewRole:  role,
+		})
+	}
+	if len(changes) == 0 {
+		return changes, nil
+	}
+	slices.SortFunc(changes, func(a, b RoleChange) int { return cmp.Compare(a.UserID, b.UserID) })
+
+	summary := make([]string, len(changes))
+	for i, change := range changes {
+		summary[i] = fmt.Sprintf("%s - %s", change.Username, change.NewRole)
+	}
+	requesterName := ""
+	if requester := byID[requesterID]; requester != nil {
+		requesterName = requester.Username
+	}
+	systemMessageText := fmt.Sprintf("%s изменил роли участников: %s", requesterName, strings.Join(summary, ", "))
+	if err := uc.createSystemMessage(ctx, chatID, systemMessageText); err != nil {
+		uc.logger.Errorf("Failed to create system message for chat %d: %v", chatID, err)
+	}
+
+	if uc.notificationSender != nil {
+		for _, change := range changes {
+			uc.notificationSender.SendEventToChat(chatID, EventRoleChanged, map[string]interface{}{
+				"chat_id":    chatID,
+				"user_id":    change.UserID,
+				"new_role":   change.NewRole,
+				"changed_by": requesterID,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// changeMemberRole - изменяет роль участника и, если она действительно изменилась,
+// рассылает участникам чата событие role_changed
+func (uc *ChatUseCase) changeMemberRole(ctx context.Context, chatID, targetUserID, changedBy uint, modify func(current string) (string, error)) error {
+	var oldRole, newRole string
+	err := uc.chatRepo.ModifyMemberRole(ctx, chatID, targetUserID, func(current string) (string, error) {
+		role, err := modify(current)
+		oldRole, newRole = current, role
+		return role, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if newRole != oldRole && uc.notificationSender != nil {
+		uc.notificationSender.SendEventToChat(chatID, EventRoleChanged, map[string]interface{}{
+			"chat_id":    chatID,
+			"user_id":    targetUserID,
+			"new_role":   newRole,
+			"changed_by": changedBy,
+		})
+	}
+
+	return nil
 }
 
 // LeaveChat - позволяет пользователю покинуть групповой чат
-func (uc *ChatUseCase) LeaveChat(chatID, userID uint) error {
-	isMember, err := uc.chatRepo.IsMember(chatID, userID)
+func (uc *ChatUseCase) LeaveChat(ctx context.Context, chatID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
 		return err
 	}
@@ -705,7 +2832,7 @@ func (uc *ChatUseCase) LeaveChat(chatID, userID uint) error {
 		return errors.New("you are not a member of this chat")
 	}
 
-	chat, err := uc.chatRepo.GetByID(chatID)
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return err
 	}
@@ -718,41 +2845,34 @@ func (uc *ChatUseCase) LeaveChat(chatID, userID uint) error {
 		return errors.New("chat creator cannot leave the chat, please delete it instead")
 	}
 
-	user, err := uc.userRepo.GetByID(userID)
+	user, err := uc.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
+	// Группа, из которой ушел создатель, не должна остаться без администратора: репозиторий
+	// проверяет это в транзакции удаления, поэтому сообщение об уходе публикуется только после нее
+	if err := uc.removeMemberAndRotateKey(ctx, chat, userID); err != nil {
+		return err
+	}
+
 	systemMessageText := fmt.Sprintf("%s покинул(а) группу", user.Username)
 
-	err = uc.createSystemMessage(chatID, systemMessageText)
+	err = uc.createSystemMessage(ctx, chatID, systemMessageText)
 	if err != nil {
 	}
 
 	if uc.notificationSender != nil {
-		notification := &entities.Notification{
-			Type:    "user_left",
-			ChatID:  chatID,
-			Message: systemMessageText,
-			Data: map[string]interface{}{
-				"user_id":   userID,
-				"username":  user.Username,
-				"chat_name": chat.Name,
-			},
-		}
+		notification := entities.NewUserLeftNotification(chatID, systemMessageText, userID, user.Username, chat.Name)
 		uc.notificationSender.SendNotificationToChat(chatID, notification)
 	}
 
-	err = uc.chatRepo.RemoveMember(chatID, userID)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
 // DeletePrivateChat - удаляет приватный чат для пользователя
-func (uc *ChatUseCase) DeletePrivateChat(chatID, userID uint) error {
-	isMember, err := uc.chatRepo.IsMember(chatID, userID)
+func (uc *ChatUseCase) DeletePrivateChat(ctx context.Context, chatID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
 	if err != nil {
 		return err
 	}
@@ -760,7 +2880,7 @@ func (uc *ChatUseCase) DeletePrivateChat(chatID, userID uint) error {
 		return errors.New("you are not a member of this chat")
 	}
 
-	chat, err := uc.chatRepo.GetByID(chatID)
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return err
 	}
@@ -769,12 +2889,20 @@ func (uc *ChatUseCase) DeletePrivateChat(chatID, userID uint) error {
 		return errors.New("you can only delete private chats, use leave for group chats")
 	}
 
-	return uc.chatRepo.RemoveMember(chatID, userID)
+	if err := uc.chatRepo.RemoveMember(ctx, chatID, userID); err != nil {
+		return err
+	}
+
+	uc.audit.Record(ctx, userID, entities.AuditActionChatDeleted, map[string]interface{}{
+		"chat_id":  chatID,
+		"is_group": false,
+	})
+	return nil
 }
 
 // DeleteGroupChat - полностью удаляет групповой чат (только создатель)
-func (uc *ChatUseCase) DeleteGroupChat(chatID, userID uint) error {
-	chat, err := uc.chatRepo.GetByID(chatID)
+func (uc *ChatUseCase) DeleteGroupChat(ctx context.Context, chatID, userID uint) error {
+	chat, err := uc.chatRepo.GetByID(ctx, chatID)
 	if err != nil {
 		return err
 	}
@@ -787,36 +2915,103 @@ func (uc *ChatUseCase) DeleteGroupChat(chatID, userID uint) error {
 		return errors.New("only chat creator can delete the group chat")
 	}
 
-	creator, err := uc.userRepo.GetByID(userID)
+	creator, err := uc.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	systemMessageText := fmt.Sprintf("Группа \"%s\" была удалена создателем %s", chat.Name, creator.Username)
 
-	err = uc.createSystemMessage(chatID, systemMessageText)
+	err = uc.createSystemMessage(ctx, chatID, systemMessageText)
 	if err != nil {
 	}
 
 	if uc.notificationSender != nil {
-		notification := &entities.Notification{
-			Type:    "group_deleted",
-			ChatID:  chatID,
-			Message: systemMessageText,
-			Data: map[string]interface{}{
-				"creator_id":   userID,
-				"creator_name": creator.Username,
-				"chat_name":    chat.Name,
-			},
-		}
+		notification := entities.NewGroupDeletedNotification(chatID, systemMessageText, userID, creator.Username, chat.Name)
 		uc.notificationSender.SendNotificationToChat(chatID, notification)
 	}
 
-	return uc.chatRepo.Delete(chatID)
+	if err := uc.chatRepo.Delete(ctx, chatID); err != nil {
+		return err
+	}
+
+	uc.audit.Record(ctx, userID, entities.AuditActionChatDeleted, map[string]interface{}{
+		"chat_id":   chatID,
+		"chat_name": chat.Name,
+		"is_group":  true,
+	})
+	return nil
+}
+
+// findMentionedMembers - находит участников чата, упомянутых в тексте через @username. Имена
+// уникальны без учета регистра, поэтому и упоминание сравнивается без учета регистра
+func findMentionedMembers(content string, members []entities.User, senderID uint) []entities.User {
+	matches := mentionPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	usernames := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		usernames[strings.ToLower(match[1])] = true
+	}
+
+	var mentioned []entities.User
+	for _, member := range members {
+		if member.ID != senderID && usernames[strings.ToLower(member.Username)] {
+			mentioned = append(mentioned, member)
+		}
+	}
+	return mentioned
+}
+
+// notifyMentions - сохраняет упоминания и отправляет упомянутым пользователям персональные уведомления
+func (uc *ChatUseCase) notifyMentions(ctx context.Context, message *entities.Message, sender *entities.User, mentioned []entities.User) {
+	if len(mentioned) == 0 {
+		return
+	}
+
+	mentions := make([]entities.MessageMention, 0, len(mentioned))
+	for _, member := range mentioned {
+		mentions = append(mentions, entities.MessageMention{
+			MessageID: message.ID,
+			ChatID:    message.ChatID,
+			UserID:    member.ID,
+		})
+	}
+	_ = uc.messageRepo.CreateMentions(ctx, mentions)
+
+	if uc.notificationSender == nil {
+		return
+	}
+
+	// Уведомление об упоминании отправляется адресно и не зависит от подписок клиента на чат
+	for _, member := range mentioned {
+		notification := entities.NewMentionNotification(
+			message.ChatID,
+			fmt.Sprintf("%s упомянул(а) вас в чате", sender.Username),
+			message.ID, sender.ID, sender.Username,
+		)
+		uc.notificationSender.SendNotificationToUser(member.ID, notification)
+	}
+}
+
+// uniqueMemberIDs - убирает дубликаты и создателя из списка участников, сохраняя порядок
+func uniqueMemberIDs(memberIDs []uint, creatorID uint) []uint {
+	seen := make(map[uint]bool, len(memberIDs))
+	result := make([]uint, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		if id == creatorID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
 }
 
 // createSystemMessage - создает системное сообщение в чате
-func (uc *ChatUseCase) createSystemMessage(chatID uint, content string) error {
+func (uc *ChatUseCase) createSystemMessage(ctx context.Context, chatID uint, content string) error {
 	systemMessage := &entities.Message{
 		ChatID:      chatID,
 		SenderID:    0,
@@ -824,5 +3019,5 @@ func (uc *ChatUseCase) createSystemMessage(chatID uint, content string) error {
 		MessageType: "system",
 	}
 
-	return uc.messageRepo.Create(systemMessage)
+	return uc.messageRepo.Create(ctx, systemMessage)
 }
@@ -0,0 +1,3161 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"sleek-chat-backend/pkg/metrics"
+	"sleek-chat-backend/pkg/ratelimit"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// memUserRepo - хранилище пользователей в памяти для тестов сценариев чата
+type memUserRepo struct {
+	repository.UserRepository
+	users map[uint]*entities.User
+}
+
+func (r *memUserRepo) Create(ctx context.Context, user *entities.User) error {
+	user.ID = uint(len(r.users) + 1)
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *memUserRepo) GetByID(ctx context.Context, id uint) (*entities.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *memUserRepo) GetByUsername(ctx context.Context, username string) (*entities.User, error) {
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memUserRepo) UpdateOnlineStatus(ctx context.Context, userID uint, isOnline bool) error {
+	if user, ok := r.users[userID]; ok {
+		user.IsOnline = isOnline
+	}
+	return nil
+}
+
+func (r *memUserRepo) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	r.users[userID].PasswordHash = passwordHash
+	return nil
+}
+
+func (r *memUserRepo) IsUsernameTaken(ctx context.Context, username string, excludeUserID uint) (bool, error) {
+	for id, user := range r.users {
+		if id != excludeUserID && strings.EqualFold(user.Username, username) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memUserRepo) IsEmailTaken(ctx context.Context, email string, excludeUserID uint) (bool, error) {
+	for id, user := range r.users {
+		if id != excludeUserID && strings.EqualFold(user.Email, email) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memUserRepo) Update(ctx context.Context, user *entities.User) error {
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *memUserRepo) GetByIDs(ctx context.Context, ids []uint) ([]entities.User, error) {
+	var result []entities.User
+	for _, id := range ids {
+		if user, ok := r.users[id]; ok {
+			result = append(result, *user)
+		}
+	}
+	return result, nil
+}
+
+// memChatRepo - хранилище чатов, участников и ключей чатов в памяти
+type memChatRepo struct {
+	repository.ChatRepository
+	mu      sync.Mutex
+	users   *memUserRepo
+	chats   map[uint]*entities.Chat
+	members map[uint]map[uint]string
+	keys    map[uint]map[int]string
+	// archived - чаты, скрытые участником из своего списка
+	archived map[uint]map[uint]bool
+}
+
+func newMemChatRepo(users *memUserRepo) *memChatRepo {
+	return &memChatRepo{
+		users:    users,
+		chats:    make(map[uint]*entities.Chat),
+		members:  make(map[uint]map[uint]string),
+		keys:     make(map[uint]map[int]string),
+		archived: make(map[uint]map[uint]bool),
+	}
+}
+
+// addChat - добавляет чат с участниками; roles сопоставляет участнику его роль
+func (r *memChatRepo) addChat(chat *entities.Chat, roles map[uint]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.chats[chat.ID] = chat
+	r.members[chat.ID] = make(map[uint]string)
+	for userID, role := range roles {
+		r.members[chat.ID][userID] = role
+	}
+}
+
+// CreateWithMembers - сохраняет чат и участников вместе; участник, которого нет среди пользователей,
+// нарушает внешний ключ, и ничего не сохраняется
+func (r *memChatRepo) CreateWithMembers(ctx context.Context, chat *entities.Chat, members []entities.ChatMember) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, member := range members {
+		if _, ok := r.users.users[member.UserID]; !ok {
+			return errors.New("violates foreign key constraint")
+		}
+	}
+	var nextID uint = 1
+	for id, existing := range r.chats {
+		if chat.PairKey != nil && existing.PairKey != nil && *existing.PairKey == *chat.PairKey {
+			return repository.ErrPrivateChatExists
+		}
+		nextID = max(nextID, id+1)
+	}
+
+	chat.ID = nextID
+	stored := *chat
+	r.chats[chat.ID] = &stored
+	r.members[chat.ID] = make(map[uint]string)
+	for i := range members {
+		members[i].ChatID = chat.ID
+		r.members[chat.ID][members[i].UserID] = members[i].Role
+	}
+	return nil
+}
+
+func (r *memChatRepo) GetByID(ctx context.Context, id uint) (*entities.Chat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	chat, ok := r.chats[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *chat
+	copied.Members, _ = r.users.GetByIDs(ctx, r.memberIDs(id))
+	return &copied, nil
+}
+
+func (r *memChatRepo) FindPrivateChat(ctx context.Context, userID1, userID2 uint) (*entities.Chat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, chatID := range slices.Sorted(maps.Keys(r.chats)) {
+		_, first := r.members[chatID][userID1]
+		_, second := r.members[chatID][userID2]
+		if !r.chats[chatID].IsGroup && first && second {
+			copied := *r.chats[chatID]
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memChatRepo) GetByPairKey(ctx context.Context, pairKey string) (*entities.Chat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, chat := range r.chats {
+		if chat.PairKey != nil && *chat.PairKey == pairKey {
+			copied := *chat
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memChatRepo) AddMember(ctx context.Context, chatID, userID uint, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.members[chatID][userID] = role
+	return nil
+}
+
+func (r *memChatRepo) AddMembers(ctx context.Context, chatID uint, userIDs []uint, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, userID := range userIDs {
+		r.members[chatID][userID] = role
+	}
+	return nil
+}
+
+func (r *memChatRepo) IsMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.members[chatID][userID]
+	return ok, nil
+}
+
+func (r *memChatRepo) memberIDs(chatID uint) []uint {
+	ids := make([]uint, 0, len(r.members[chatID]))
+	for userID := range r.members[chatID] {
+		ids = append(ids, userID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (r *memChatRepo) GetMembers(ctx context.Context, chatID uint) ([]entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.users.GetByIDs(ctx, r.memberIDs(chatID))
+}
+
+func (r *memChatRepo) CountMembers(ctx context.Context, chatID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.members[chatID])), nil
+}
+
+func (r *memChatRepo) RotateKey(ctx context.Context, chatID uint, key string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.keys[chatID] == nil {
+		r.keys[chatID] = make(map[int]string)
+	}
+	version := len(r.keys[chatID]) + 1
+	r.keys[chatID][version] = key
+	r.chats[chatID].KeyVersion = version
+	return version, nil
+}
+
+func (r *memChatRepo) GetKey(ctx context.Context, chatID uint, version int) (*entities.ChatKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[chatID][version]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	return &entities.ChatKey{ChatID: chatID, Version: version, Key: key}, nil
+}
+
+func (r *memChatRepo) GetMemberRole(ctx context.Context, chatID, userID uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	role, ok := r.members[chatID][userID]
+	if !ok {
+		return "", errors.New("record not found")
+	}
+	return role, nil
+}
+
+func (r *memChatRepo) GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Порядок вступления в памяти - порядок ID участников
+	ids := r.memberIDs(chatID)
+	if limit > 0 {
+		ids = ids[min(offset, len(ids)):min(offset+limit, len(ids))]
+	}
+	users, _ := r.users.GetByIDs(ctx, ids)
+	result := make([]*entities.User, len(users))
+	for i := range users {
+		users[i].Role = r.members[chatID][users[i].ID]
+		if users[i].ID == r.chats[chatID].CreatedBy {
+			users[i].Role = "creator"
+		}
+		result[i] = &users[i]
+	}
+	return result, nil
+}
+
+func (r *memChatRepo) GetUserChats(ctx context.Context, userID uint, includeArchived bool) ([]entities.Chat, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var chats []entities.Chat
+	for _, chatID := range slices.Sorted(maps.Keys(r.chats)) {
+		if _, ok := r.members[chatID][userID]; !ok {
+			continue
+		}
+		if !includeArchived && r.archived[userID][chatID] {
+			continue
+		}
+		chat := *r.chats[chatID]
+		chat.Members, _ = r.users.GetByIDs(ctx, r.memberIDs(chatID))
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+func (r *memChatRepo) GetArchivedChatIDs(ctx context.Context, userID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(r.archived[userID])), nil
+}
+
+func (r *memChatRepo) SetArchived(ctx context.Context, chatID, userID uint, archived bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !archived {
+		delete(r.archived[userID], chatID)
+		return nil
+	}
+	if r.archived[userID] == nil {
+		r.archived[userID] = make(map[uint]bool)
+	}
+	r.archived[userID][chatID] = true
+	return nil
+}
+
+func (r *memChatRepo) UnarchiveForAll(ctx context.Context, chatID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, chats := range r.archived {
+		delete(chats, chatID)
+	}
+	return nil
+}
+
+func (r *memChatRepo) GetKeyVersion(ctx context.Context, chatID uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.chats[chatID].KeyVersion, nil
+}
+
+// guardLastAdmin - повторяет правило репозитория: изменение, после которого в группе не осталось
+// ни администраторов, ни создателя, откатывается с repository.ErrLastAdmin
+func (r *memChatRepo) guardLastAdmin(chatID uint, change func() error) error {
+	before := maps.Clone(r.members[chatID])
+	admins := func(roles map[uint]string) int {
+		count := 0
+		for userID, role := range roles {
+			if role == "admin" || userID == r.chats[chatID].CreatedBy {
+				count++
+			}
+		}
+		return count
+	}
+
+	if err := change(); err != nil {
+		r.members[chatID] = before
+		return err
+	}
+	if r.chats[chatID].IsGroup && admins(before) > 0 && admins(r.members[chatID]) == 0 {
+		r.members[chatID] = before
+		return repository.ErrLastAdmin
+	}
+	return nil
+}
+
+func (r *memChatRepo) RemoveMember(ctx context.Context, chatID, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.guardLastAdmin(chatID, func() error {
+		delete(r.members[chatID], userID)
+		return nil
+	})
+}
+
+func (r *memChatRepo) ModifyMemberRole(ctx context.Context, chatID, userID uint, modify func(current string) (string, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.guardLastAdmin(chatID, func() error {
+		current, ok := r.members[chatID][userID]
+		if !ok {
+			return errors.New("record not found")
+		}
+		role, err := modify(current)
+		if err != nil {
+			return err
+		}
+		r.members[chatID][userID] = role
+		return nil
+	})
+}
+
+func (r *memChatRepo) SetMemberRoles(ctx context.Context, chatID uint, roles map[uint]string) (map[uint]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Роли записываются по возрастанию ID, как в репозитории, поэтому ошибка на последнем
+	// пользователе наступает после того, как роли предыдущих уже изменены
+	userIDs := slices.Sorted(maps.Keys(roles))
+	previous := make(map[uint]string, len(roles))
+	err := r.guardLastAdmin(chatID, func() error {
+		for _, userID := range userIDs {
+			current, ok := r.members[chatID][userID]
+			if !ok {
+				return repository.ErrNotMember
+			}
+			previous[userID] = current
+			r.members[chatID][userID] = roles[userID]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// role - возвращает роль участника или пустую строку, если он не состоит в чате
+func (r *memChatRepo) role(chatID, userID uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.members[chatID][userID]
+}
+
+// newTestChatUseCase - создает сервис чатов поверх хранилищ в памяти без уведомлений и метрик
+func newTestChatUseCase(chats *memChatRepo, messages repository.MessageRepository) *ChatUseCase {
+	return NewChatUseCase(chats, messages, chats.users, nil, nil, nil, &config.ChatConfig{
+		MaxMessagesPerMinute: 100,
+		ControlCharsPolicy:   "strip",
+		AllowedMessageTypes:  []string{"text"},
+	}, logger.New(), nil, nil)
+}
+
+// serverKeyUser - создает пользователя, ключи которого хранит сервер
+func serverKeyUser(t *testing.T, id uint, username string) *entities.User {
+	t.Helper()
+
+	user := &entities.User{ID: id, Username: username}
+	if err := assignServerKeys(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sendAs - отправляет сообщение от имени пользователя его серверными ключами
+func sendAs(t *testing.T, uc *ChatUseCase, sender *entities.User, chatID uint, req *SendMessageRequest) (*entities.Message, error) {
+	t.Helper()
+
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(sender.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(sender.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uc.SendMessage(context.Background(), chatID, sender.ID, req, ecdsaPrivateKey, rsaPrivateKey)
+}
+
+func serverHoldsKeys(value bool) *bool {
+	return &value
+}
+
+func TestGetWrappedChatKeyForClientCustodyMember(t *testing.T) {
+	privateKey, publicKey, err := crypto.GenerateRSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice", RSAPublicKey: hex.EncodeToString(publicKey), ServerHoldsKeys: serverHoldsKeys(false)},
+		2: {ID: 2, Username: "bob"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	uc := newTestChatUseCase(chats, nil)
+	ctx := context.Background()
+
+	if _, err := uc.GetWrappedChatKey(ctx, 10, 1, 0); !errors.Is(err, ErrChatKeyNotFound) {
+		t.Fatalf("chat without key: err = %v, want %v", err, ErrChatKeyNotFound)
+	}
+
+	first, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ requested, want int }{{0, current}, {first, first}} {
+		wrapped, err := uc.GetWrappedChatKey(ctx, 10, 1, tt.requested)
+		if err != nil {
+			t.Fatalf("GetWrappedChatKey(version %d): %v", tt.requested, err)
+		}
+		if wrapped.KeyVersion != tt.want || wrapped.Algorithm != ChatKeyWrapAlgorithm {
+			t.Fatalf("wrapped key = %+v, want version %d", wrapped, tt.want)
+		}
+
+		ciphertext, err := hex.DecodeString(wrapped.WrappedKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, ciphertext, crypto.ChatKeyWrapLabel)
+		if err != nil {
+			t.Fatalf("member cannot unwrap chat key: %v", err)
+		}
+		if hex.EncodeToString(key) != chats.keys[10][tt.want] {
+			t.Fatalf("unwrapped key does not match chat key version %d", tt.want)
+		}
+	}
+
+	if _, err := uc.GetWrappedChatKey(ctx, 10, 1, current+1); !errors.Is(err, ErrChatKeyNotFound) {
+		t.Fatalf("unknown version: err = %v, want %v", err, ErrChatKeyNotFound)
+	}
+	if _, err := uc.GetWrappedChatKey(ctx, 10, 2, 0); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestBuildMessageResponseKeyCustody(t *testing.T) {
+	uc := newTestChatUseCase(newMemChatRepo(&memUserRepo{}), nil)
+	ctx := context.Background()
+
+	serverUser := &entities.User{ID: 1}
+	clientUser := &entities.User{ID: 2, ServerHoldsKeys: serverHoldsKeys(false)}
+
+	tests := []struct {
+		name          string
+		message       *entities.Message
+		user          *entities.User
+		wantEncrypted bool
+	}{
+		{"server keys, plain message", &entities.Message{Content: "hello"}, serverUser, false},
+		{"server keys, client-encrypted message", &entities.Message{Content: "c1", IV: "iv", HMAC: "mac", ClientEncrypted: true}, serverUser, true},
+		{"client keys, server-encrypted message", &entities.Message{Content: "c2", IV: "iv", HMAC: "mac", KeyVersion: 1}, clientUser, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := uc.buildMessageResponse(ctx, tt.message, tt.user)
+			if response.Encrypted != tt.wantEncrypted {
+				t.Fatalf("Encrypted = %v, want %v", response.Encrypted, tt.wantEncrypted)
+			}
+			if tt.wantEncrypted && response.DecryptedContent != "" {
+				t.Fatalf("server decrypted content %q for a ciphertext response", response.DecryptedContent)
+			}
+			if !tt.wantEncrypted && response.DecryptedContent != tt.message.Content {
+				t.Fatalf("DecryptedContent = %q, want %q", response.DecryptedContent, tt.message.Content)
+			}
+		})
+	}
+}
+
+func TestSendMessageRejectsClientCustodySender(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice", ServerHoldsKeys: serverHoldsKeys(false)},
+		2: {ID: 2, Username: "bob"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1, CreatedAt: time.Now()}, map[uint]string{1: "member", 2: "member"})
+	uc := newTestChatUseCase(chats, nil)
+
+	_, err := uc.SendMessage(context.Background(), 10, 1, &SendMessageRequest{Content: "hi"}, nil, nil)
+	if !errors.Is(err, ErrServerKeysDisabled) {
+		t.Fatalf("err = %v, want %v", err, ErrServerKeysDisabled)
+	}
+}
+
+func TestBuildMessageResponseCountsHMACFailure(t *testing.T) {
+	sender := &entities.User{ID: 1, Username: "alice"}
+	if err := assignServerKeys(sender); err != nil {
+		t.Fatal(err)
+	}
+	reader := &entities.User{ID: 2, Username: "bob"}
+
+	users := &memUserRepo{users: map[uint]*entities.User{1: sender, 2: reader}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, nil)
+	registry := metrics.New()
+	uc.metrics = registry
+	ctx := context.Background()
+
+	version, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatKey, err := uc.chatKey(ctx, 10, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(sender.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(sender.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secureMsg, err := crypto.CreateSecureMessage("", "1", "chat:10", []byte("hello"), chatKey, ecdsaPrivateKey, rsaPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := &entities.Message{
+		ChatID:         10,
+		SenderID:       1,
+		Content:        secureMsg.Ciphertext,
+		IV:             secureMsg.IV,
+		HMAC:           secureMsg.HMAC,
+		ECDSASignature: secureMsg.ECDSASignature,
+		RSASignature:   secureMsg.RSASignature,
+		Nonce:          secureMsg.Nonce,
+		Timestamp:      &secureMsg.Timestamp,
+		Algorithm:      secureMsg.Algorithm,
+		KeyVersion:     version,
+	}
+	if response := uc.buildMessageResponse(ctx, message, reader); response.DecryptedContent != "hello" {
+		t.Fatalf("intact message decrypted to %q", response.DecryptedContent)
+	}
+	if got := registry.Get("decrypt_failures_total"); got != 0 {
+		t.Fatalf("decrypt_failures_total = %d after intact message", got)
+	}
+
+	tampered := *message
+	tampered.HMAC = strings.Repeat("00", len(message.HMAC)/2)
+	uc.buildMessageResponse(ctx, &tampered, reader)
+
+	if got := registry.Get("decrypt_failures." + crypto.DecryptStageHMAC); got != 1 {
+		t.Fatalf("hmac_failed counter = %d, want 1", got)
+	}
+	for _, stage := range []string{crypto.DecryptStageECDSA, crypto.DecryptStageRSA, crypto.DecryptStageAES} {
+		if got := registry.Get("decrypt_failures." + stage); got != 0 {
+			t.Fatalf("%s counter = %d, want 0", stage, got)
+		}
+	}
+	if got := registry.Get("decrypt_failures_total"); got != 1 {
+		t.Fatalf("decrypt_failures_total = %d, want 1", got)
+	}
+}
+
+// memMessageRepo - хранилище сообщений и упоминаний в памяти
+type memMessageRepo struct {
+	repository.MessageRepository
+	mu       sync.Mutex
+	created  []*entities.Message
+	mentions []entities.MessageMention
+	// attachments - загруженные вложения, которые CreateWithAttachment привязывает к сообщению
+	attachments map[uint]*entities.Attachment
+	receipts    []entities.MessageReceipt
+}
+
+func (r *memMessageRepo) Create(ctx context.Context, message *entities.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message.ID = uint(len(r.created) + 1)
+	// Номер в чате выдается подряд, как счетчиком chats.last_seq
+	if message.Seq == 0 {
+		for _, existing := range r.created {
+			if existing.ChatID == message.ChatID {
+				message.Seq = max(message.Seq, existing.Seq)
+			}
+		}
+		message.Seq++
+	}
+	if message.CreatedAt.IsZero() {
+		message.CreatedAt = time.Now()
+	}
+	r.created = append(r.created, message)
+	return nil
+}
+
+// CreateWithAttachment - как транзакция репозитория: сообщение сохраняется, только если вложение удалось привязать
+func (r *memMessageRepo) CreateWithAttachment(ctx context.Context, message *entities.Message, attachmentID uint) error {
+	r.mu.Lock()
+	attachment, ok := r.attachments[attachmentID]
+	if !ok || attachment.ChatID != message.ChatID || attachment.UploaderID != message.SenderID || attachment.MessageID != nil {
+		r.mu.Unlock()
+		return repository.ErrAttachmentUnavailable
+	}
+	r.mu.Unlock()
+
+	message.AttachmentID = &attachmentID
+	if err := r.Create(ctx, message); err != nil {
+		return err
+	}
+	attachment.MessageID = &message.ID
+	return nil
+}
+
+func (r *memMessageRepo) GetByID(ctx context.Context, id uint) (*entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.created {
+		if message.ID == id && !message.DeletedAt.Valid {
+			copied := *message
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memMessageRepo) Delete(ctx context.Context, id, deletedBy uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.created {
+		if message.ID == id {
+			message.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			message.DeletedBy = &deletedBy
+			return nil
+		}
+	}
+	return errors.New("record not found")
+}
+
+func (r *memMessageRepo) GetDeletedByID(ctx context.Context, id uint) (*entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.created {
+		if message.ID == id && message.DeletedAt.Valid {
+			copied := *message
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("record not found")
+}
+
+func (r *memMessageRepo) Restore(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, message := range r.created {
+		if message.ID == id && message.DeletedAt.Valid {
+			message.DeletedAt = gorm.DeletedAt{}
+			message.DeletedBy = nil
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memMessageRepo) Update(ctx context.Context, message *entities.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, stored := range r.created {
+		if stored.ID == message.ID {
+			copied := *message
+			r.created[i] = &copied
+			return nil
+		}
+	}
+	return errors.New("record not found")
+}
+
+func (r *memMessageRepo) CreateReceipt(ctx context.Context, receipt *entities.MessageReceipt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.receipts = append(r.receipts, *receipt)
+	return nil
+}
+
+func (r *memMessageRepo) AdvanceStatus(ctx context.Context, messageID uint, status string) (bool, error) {
+	return false, nil
+}
+
+// GetReaders - отметки о прочтении сообщения в порядке прочтения
+func (r *memMessageRepo) GetReaders(ctx context.Context, messageID uint) ([]entities.MessageReader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var readers []entities.MessageReader
+	for _, receipt := range r.receipts {
+		if receipt.MessageID == messageID {
+			readers = append(readers, entities.MessageReader{UserID: receipt.UserID, ReadAt: receipt.ReadAt})
+		}
+	}
+	return readers, nil
+}
+
+func (r *memMessageRepo) chatMessages(chatID uint) []entities.Message {
+	var result []entities.Message
+	for _, message := range r.created {
+		if message.ChatID == chatID {
+			result = append(result, *message)
+		}
+	}
+	return result
+}
+
+func (r *memMessageRepo) CountByChat(ctx context.Context, chatID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.chatMessages(chatID))), nil
+}
+
+func (r *memMessageRepo) GetChatMessages(ctx context.Context, chatID uint, limit, offset int) ([]entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := r.chatMessages(chatID)
+	if offset >= len(messages) {
+		return nil, nil
+	}
+	return messages[offset:min(offset+limit, len(messages))], nil
+}
+
+func (r *memMessageRepo) GetChatMessagesAfter(ctx context.Context, chatID uint, afterSeq int64, limit int) ([]entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := r.chatMessages(chatID)
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	var result []entities.Message
+	for _, message := range messages {
+		if message.Seq > afterSeq && len(result) < limit {
+			result = append(result, message)
+		}
+	}
+	return result, nil
+}
+
+func (r *memMessageRepo) GetUserMessagesAfter(ctx context.Context, userID, afterID uint, limit int) ([]entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var result []entities.Message
+	for _, message := range r.created {
+		if message.SenderID == userID && message.ID > afterID && len(result) < limit {
+			result = append(result, *message)
+		}
+	}
+	return result, nil
+}
+
+// GetLastSentAt - как в репозитории, учитывает и удаленные сообщения
+func (r *memMessageRepo) GetLastSentAt(ctx context.Context, chatID, senderID uint) (*time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var last *time.Time
+	for _, message := range r.created {
+		if message.ChatID == chatID && message.SenderID == senderID && (last == nil || message.CreatedAt.After(*last)) {
+			createdAt := message.CreatedAt
+			last = &createdAt
+		}
+	}
+	return last, nil
+}
+
+// typedMessages - сообщения чата указанных типов в порядке хранения
+func (r *memMessageRepo) typedMessages(chatID uint, messageTypes []string) []entities.Message {
+	var result []entities.Message
+	for _, message := range r.chatMessages(chatID) {
+		if slices.Contains(messageTypes, message.MessageType) {
+			result = append(result, message)
+		}
+	}
+	return result
+}
+
+func (r *memMessageRepo) CountByChatAndType(ctx context.Context, chatID uint, messageTypes []string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.typedMessages(chatID, messageTypes))), nil
+}
+
+func (r *memMessageRepo) GetChatMessagesByType(ctx context.Context, chatID uint, messageTypes []string, limit, offset int) ([]entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := r.typedMessages(chatID, messageTypes)
+	if offset >= len(messages) {
+		return nil, nil
+	}
+	return messages[offset:min(offset+limit, len(messages))], nil
+}
+
+// GetTopSender - как и запрос репозитория, не учитывает системные сообщения
+func (r *memMessageRepo) GetTopSender(ctx context.Context, chatID uint) (*entities.SenderMessageCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[uint]int64)
+	for _, message := range r.chatMessages(chatID) {
+		if message.MessageType != "system" {
+			counts[message.SenderID]++
+		}
+	}
+	var top *entities.SenderMessageCount
+	for _, senderID := range slices.Sorted(maps.Keys(counts)) {
+		if top == nil || counts[senderID] > top.Count {
+			top = &entities.SenderMessageCount{UserID: senderID, Count: counts[senderID]}
+		}
+	}
+	return top, nil
+}
+
+func (r *memMessageRepo) CountPerDay(ctx context.Context, chatID uint, since time.Time) ([]entities.DailyMessageCount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[time.Time]int64)
+	for _, message := range r.chatMessages(chatID) {
+		if message.CreatedAt.Before(since) {
+			continue
+		}
+		year, month, day := message.CreatedAt.Date()
+		counts[time.Date(year, month, day, 0, 0, 0, 0, message.CreatedAt.Location())]++
+	}
+	var result []entities.DailyMessageCount
+	for day, count := range counts {
+		result = append(result, entities.DailyMessageCount{Day: day, Count: count})
+	}
+	return result, nil
+}
+
+func (r *memMessageRepo) MarkMentionsRead(ctx context.Context, chatID, userID uint) error {
+	return nil
+}
+
+func (r *memMessageRepo) CreateMentions(ctx context.Context, mentions []entities.MessageMention) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mentions = append(r.mentions, mentions...)
+	return nil
+}
+
+// recordingNotifier - запоминает адресные уведомления
+type recordingNotifier struct {
+	mu     sync.Mutex
+	toUser map[uint][]*entities.Notification
+	toChat map[uint][]*entities.Notification
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{
+		toUser: make(map[uint][]*entities.Notification),
+		toChat: make(map[uint][]*entities.Notification),
+	}
+}
+
+func (n *recordingNotifier) SendNotificationToChat(chatID uint, notification *entities.Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.toChat[chatID] = append(n.toChat[chatID], notification)
+}
+
+func (n *recordingNotifier) SendNotificationToUser(userID uint, notification *entities.Notification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.toUser[userID] = append(n.toUser[userID], notification)
+}
+
+func (n *recordingNotifier) SendEventToChat(chatID uint, eventType string, data interface{}) {}
+
+func TestFindMentionedMembers(t *testing.T) {
+	const senderID = 4
+	members := []entities.User{
+		{ID: 1, Username: "Alice"},
+		{ID: 2, Username: "bob"},
+		{ID: 3, Username: "carol2"},
+		{ID: senderID, Username: "dave"},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []uint
+	}{
+		{"no mentions", "hello everyone", nil},
+		{"exact case", "hi @bob", []uint{2}},
+		{"different case", "hi @ALICE and @Bob", []uint{1, 2}},
+		{"digits", "@carol2, look", []uint{3}},
+		{"punctuation ends name", "thanks @bob!", []uint{2}},
+		{"repeated mention", "@bob @bob @BOB", []uint{2}},
+		{"sender excluded", "note to self @dave", nil},
+		{"unknown user", "@erin", nil},
+		{"prefix is not a match", "@bo", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint
+			for _, member := range findMentionedMembers(tt.content, members, senderID) {
+				got = append(got, member.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("mentioned = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("mentioned = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifyMentionsSendsPersonalNotifications(t *testing.T) {
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(newMemChatRepo(&memUserRepo{}), messages)
+	notifier := newRecordingNotifier()
+	uc.notificationSender = notifier
+
+	sender := &entities.User{ID: 1, Username: "alice"}
+	message := &entities.Message{ID: 100, ChatID: 10, SenderID: 1}
+	mentioned := findMentionedMembers("@Bob see this", []entities.User{{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}}, 1)
+
+	uc.notifyMentions(context.Background(), message, sender, mentioned)
+
+	if len(messages.mentions) != 1 || messages.mentions[0].UserID != 2 || messages.mentions[0].MessageID != 100 {
+		t.Fatalf("stored mentions = %+v", messages.mentions)
+	}
+	// Упоминание приходит адресно, независимо от подписки пользователя на события чата
+	notifications := notifier.toUser[2]
+	if len(notifications) != 1 || notifications[0].Type != entities.NotificationMention {
+		t.Fatalf("notifications to mentioned user = %+v", notifications)
+	}
+	if len(notifier.toUser[1]) != 0 {
+		t.Fatal("sender was notified about their own mention")
+	}
+}
+
+// newAdminTestChat - группа 10: создатель 1, администраторы 2 и 3, участник 4
+func newAdminTestChat() (*ChatUseCase, *memChatRepo, *memMessageRepo, *recordingNotifier) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "owner"},
+		2: {ID: 2, Username: "admin2"},
+		3: {ID: 3, Username: "admin3"},
+		4: {ID: 4, Username: "member4"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "admin", 3: "admin", 4: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	notifier := newRecordingNotifier()
+	uc.notificationSender = notifier
+	return uc, chats, messages, notifier
+}
+
+// newCreatorlessTestChat - группа 10, создатель 1 которой больше не состоит в ней:
+// администраторы 2 и 3, участник 4
+func newCreatorlessTestChat() (*ChatUseCase, *memChatRepo, *memMessageRepo) {
+	uc, chats, messages, _ := newAdminTestChat()
+	delete(chats.members[10], 1)
+	return uc, chats, messages
+}
+
+func TestRemoveAdminKeepsLastAdmin(t *testing.T) {
+	uc, chats, _, _ := newAdminTestChat()
+	ctx := context.Background()
+
+	// Создатель считается администратором, поэтому может снять права со всех остальных
+	for _, target := range []uint{2, 3} {
+		if err := uc.RemoveAdmin(ctx, 10, 1, target); err != nil {
+			t.Fatalf("RemoveAdmin(%d): %v", target, err)
+		}
+		if role := chats.role(10, target); role != "member" {
+			t.Fatalf("user %d role = %q, want member", target, role)
+		}
+	}
+	if err := uc.RemoveAdmin(ctx, 10, 1, 1); !errors.Is(err, ErrCreatorRoleFixed) {
+		t.Fatalf("RemoveAdmin(creator): err = %v, want %v", err, ErrCreatorRoleFixed)
+	}
+}
+
+func TestConcurrentLeaveChatLeavesOneAdmin(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		uc, chats, _ := newCreatorlessTestChat()
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, admin := range []uint{2, 3} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = uc.LeaveChat(context.Background(), 10, admin)
+			}()
+		}
+		wg.Wait()
+
+		failed := 0
+		for _, err := range errs {
+			if errors.Is(err, ErrLastAdmin) {
+				failed++
+			} else if err != nil {
+				t.Fatalf("LeaveChat: %v", err)
+			}
+		}
+		if failed != 1 {
+			t.Fatalf("concurrent leaves: %d failed with ErrLastAdmin, want 1", failed)
+		}
+		if chats.role(10, 2) != "admin" && chats.role(10, 3) != "admin" {
+			t.Fatal("both admins left the group")
+		}
+	}
+}
+
+// orderedRoleChats - записывает роли в порядке, в котором репозиторий применил изменения
+type orderedRoleChats struct {
+	*memChatRepo
+	applied []string
+}
+
+func (r *orderedRoleChats) ModifyMemberRole(ctx context.Context, chatID, userID uint, modify func(current string) (string, error)) error {
+	// modify вызывается под блокировкой хранилища, поэтому порядок записи совпадает с порядком изменений
+	return r.memChatRepo.ModifyMemberRole(ctx, chatID, userID, func(current string) (string, error) {
+		role, err := modify(current)
+		if err == nil {
+			r.applied = append(r.applied, role)
+		}
+		return role, err
+	})
+}
+
+func TestConcurrentPromoteDemoteConsistentRole(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		uc, chats, _, _ := newAdminTestChat()
+		ordered := &orderedRoleChats{memChatRepo: chats}
+		uc.chatRepo = ordered
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, change := range []func(context.Context, uint, uint, uint) error{uc.SetAdmin, uc.RemoveAdmin} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[j] = change(context.Background(), 10, 1, 4)
+			}()
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("role change: %v", err)
+			}
+		}
+		if len(ordered.applied) != 2 {
+			t.Fatalf("%d role changes applied, want 2", len(ordered.applied))
+		}
+		if got, want := chats.role(10, 4), ordered.applied[1]; got != want {
+			t.Fatalf("final role = %q, want %q from the last applied change", got, want)
+		}
+		if role := chats.role(10, 1); role != "admin" {
+			t.Fatalf("creator role = %q, want admin", role)
+		}
+	}
+}
+
+func TestLeaveChatLastAdminStaysWithoutAnnouncement(t *testing.T) {
+	// Пока создатель в группе, уйти может любой администратор
+	uc, chats, _, _ := newAdminTestChat()
+	ctx := context.Background()
+	for _, admin := range []uint{2, 3} {
+		if err := uc.LeaveChat(ctx, 10, admin); err != nil {
+			t.Fatalf("LeaveChat(%d) with the creator present: %v", admin, err)
+		}
+	}
+	if chats.role(10, 1) != "admin" {
+		t.Fatal("creator lost admin rights")
+	}
+
+	// Без создателя последний администратор остается, и об отказе не объявляется
+	uc, chats, messages := newCreatorlessTestChat()
+	if err := uc.LeaveChat(ctx, 10, 2); err != nil {
+		t.Fatalf("LeaveChat(2): %v", err)
+	}
+	announced := len(messages.created)
+
+	if err := uc.LeaveChat(ctx, 10, 3); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("LeaveChat(last admin): err = %v, want %v", err, ErrLastAdmin)
+	}
+	if chats.role(10, 3) != "admin" {
+		t.Fatal("last admin left the group")
+	}
+	if len(messages.created) != announced {
+		t.Fatal("system message posted for a refused leave")
+	}
+
+	if err := uc.LeaveChat(ctx, 10, 4); err != nil {
+		t.Fatalf("LeaveChat(member): %v", err)
+	}
+}
+
+func TestRemoveMemberGuardsCreatorAndLastAdmin(t *testing.T) {
+	uc, chats, messages, notifier := newAdminTestChat()
+	ctx := context.Background()
+
+	if err := uc.RemoveMember(ctx, 10, 2, 1); !errors.Is(err, ErrCannotRemoveCreator) {
+		t.Fatalf("remove creator: err = %v, want %v", err, ErrCannotRemoveCreator)
+	}
+	if err := uc.RemoveMember(ctx, 10, 1, 1); !errors.Is(err, ErrCannotRemoveCreator) {
+		t.Fatalf("creator removes self: err = %v, want %v", err, ErrCannotRemoveCreator)
+	}
+
+	if err := uc.RemoveMember(ctx, 10, 1, 2); err != nil {
+		t.Fatalf("remove admin 2: %v", err)
+	}
+	// Удаленный участник получает уведомление адресно, так как уже не состоит в чате
+	if len(notifier.toUser[2]) != 1 {
+		t.Fatalf("removed user got %d notifications, want 1", len(notifier.toUser[2]))
+	}
+
+	// Создатель остается администратором, поэтому можно удалить и последнего соадминистратора
+	if err := uc.RemoveMember(ctx, 10, 1, 3); err != nil {
+		t.Fatalf("remove admin 3: %v", err)
+	}
+	if chats.role(10, 3) != "" || len(notifier.toUser[3]) != 1 {
+		t.Fatal("admin 3 is still a member or was not notified")
+	}
+	if chats.role(10, 1) != "admin" || len(messages.created) == 0 {
+		t.Fatal("creator lost admin rights or removals were not announced")
+	}
+}
+
+func TestUpdateMemberRolesKeepsAdmin(t *testing.T) {
+	uc, chats, _, _ := newAdminTestChat()
+	ctx := context.Background()
+
+	// Создатель управляет группой сам, поэтому понизить всех остальных администраторов можно
+	changes, err := uc.UpdateMemberRoles(ctx, 10, 1, map[uint]string{2: "member", 3: "member"})
+	if err != nil {
+		t.Fatalf("demote all co-admins: %v", err)
+	}
+	if len(changes) != 2 || chats.role(10, 2) != "member" || chats.role(10, 3) != "member" {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if chats.role(10, 1) != "admin" {
+		t.Fatal("creator lost admin rights")
+	}
+
+	// Передача прав в одной операции допустима
+	changes, err = uc.UpdateMemberRoles(ctx, 10, 1, map[uint]string{2: "admin", 4: "admin"})
+	if err != nil {
+		t.Fatalf("promote: %v", err)
+	}
+	if len(changes) != 2 || chats.role(10, 4) != "admin" {
+		t.Fatalf("changes = %+v", changes)
+	}
+}
+
+// departedMemberChats - список участников еще содержит пользователя 5, который вышел из чата
+// до записи ролей, поэтому ошибку находит только транзакция репозитория
+type departedMemberChats struct {
+	*memChatRepo
+}
+
+func (r *departedMemberChats) GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error) {
+	members, err := r.memChatRepo.GetMembersWithRoles(ctx, chatID, limit, offset)
+	return append(members, &entities.User{ID: 5, Username: "departed", Role: "member"}), err
+}
+
+func TestUpdateMemberRolesAppliesAllOrNothing(t *testing.T) {
+	uc, chats, messages, _ := newAdminTestChat()
+	ctx := context.Background()
+	unchanged := func() bool {
+		return chats.role(10, 2) == "admin" && chats.role(10, 3) == "admin" && chats.role(10, 4) == "member"
+	}
+
+	tests := []struct {
+		name  string
+		roles map[uint]string
+		want  error
+	}{
+		{"unknown member", map[uint]string{2: "member", 4: "admin", 99: "admin"}, ErrNotChatMember},
+		{"unknown role", map[uint]string{2: "member", 4: "owner"}, ErrInvalidRoleChanges},
+		{"creator role", map[uint]string{1: "member", 4: "admin"}, ErrCreatorRoleFixed},
+	}
+	for _, tt := range tests {
+		if _, err := uc.UpdateMemberRoles(ctx, 10, 1, tt.roles); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+		if !unchanged() {
+			t.Fatalf("%s: roles changed despite the invalid entry", tt.name)
+		}
+	}
+
+	// Участник 5 вышел между проверкой и записью: роли 2 и 4 уже записаны, когда транзакция
+	// доходит до него, и откатываются вместе с ней
+	stale := newTestChatUseCase(chats, messages)
+	stale.chatRepo = &departedMemberChats{memChatRepo: chats}
+	if _, err := stale.UpdateMemberRoles(ctx, 10, 1, map[uint]string{2: "member", 4: "admin", 5: "admin"}); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("departed member: err = %v, want %v", err, ErrNotChatMember)
+	}
+	if !unchanged() {
+		t.Fatal("departed member: partial role changes were kept")
+	}
+	if len(messages.created) != 0 {
+		t.Fatalf("%d system messages for rejected changes, want 0", len(messages.created))
+	}
+
+	// Неизмененная роль в запросе не попадает в итог; о всех изменениях сообщает одно сообщение
+	changes, err := uc.UpdateMemberRoles(ctx, 10, 1, map[uint]string{2: "member", 3: "admin", 4: "admin"})
+	if err != nil {
+		t.Fatalf("valid changes: %v", err)
+	}
+	if len(changes) != 2 || changes[0].UserID != 2 || changes[1].UserID != 4 {
+		t.Fatalf("changes = %+v, want users 2 and 4", changes)
+	}
+	if len(messages.created) != 1 || messages.created[0].MessageType != "system" {
+		t.Fatalf("%d messages after bulk update, want one system message", len(messages.created))
+	}
+}
+
+func TestGetChatMessagesHistoryLimit(t *testing.T) {
+	newChat := func(count, historyLimit int) *ChatUseCase {
+		users := &memUserRepo{users: map[uint]*entities.User{1: {ID: 1, Username: "alice"}, 2: {ID: 2, Username: "bob"}}}
+		chats := newMemChatRepo(users)
+		chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+		messages := &memMessageRepo{}
+		for i := 0; i < count; i++ {
+			messages.created = append(messages.created, &entities.Message{ID: uint(i + 1), ChatID: 10, SenderID: 1, Content: fmt.Sprintf("m%d", i)})
+		}
+		uc := newTestChatUseCase(chats, messages)
+		uc.historyLimit = historyLimit
+		return uc
+	}
+
+	tests := []struct {
+		name          string
+		count         int
+		limit, offset int
+		wantMessages  int
+		wantHasMore   bool
+		wantTruncated bool
+	}{
+		{"within cap", 30, 10, 0, 10, true, false},
+		{"page crosses cap", 30, 10, 15, 5, false, true},
+		{"offset past cap", 30, 10, 25, 0, false, true},
+		{"short chat, page past cap", 8, 10, 15, 0, false, false},
+		{"short chat, page crosses cap", 8, 25, 0, 8, false, false},
+		{"exactly at cap", 20, 10, 15, 5, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := newChat(tt.count, 20).GetChatMessages(context.Background(), 10, 1, tt.limit, tt.offset, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Messages) != tt.wantMessages || page.HasMore != tt.wantHasMore || page.HistoryLimitReached != tt.wantTruncated {
+				t.Fatalf("messages = %d, has_more = %v, history_limit_reached = %v; want %d, %v, %v",
+					len(page.Messages), page.HasMore, page.HistoryLimitReached, tt.wantMessages, tt.wantHasMore, tt.wantTruncated)
+			}
+		})
+	}
+
+	if _, err := newChat(1, 20).GetChatMessages(context.Background(), 10, 2, 10, 0, nil); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+// countingChatRepo - считает запросы списка чатов и участников, чтобы отлавливать N+1
+type countingChatRepo struct {
+	*memChatRepo
+	getMembers       int
+	membersWithRoles int
+	getByID          int
+}
+
+func (r *countingChatRepo) GetMembers(ctx context.Context, chatID uint) ([]entities.User, error) {
+	r.getMembers++
+	return r.memChatRepo.GetMembers(ctx, chatID)
+}
+
+func (r *countingChatRepo) GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error) {
+	r.membersWithRoles++
+	return r.memChatRepo.GetMembersWithRoles(ctx, chatID, limit, offset)
+}
+
+func (r *countingChatRepo) GetByID(ctx context.Context, id uint) (*entities.Chat, error) {
+	r.getByID++
+	return r.memChatRepo.GetByID(ctx, id)
+}
+
+// countingMessageRepo - считает сгруппированные запросы счетчиков
+type countingMessageRepo struct {
+	memMessageRepo
+	countQueries int
+}
+
+func (r *countingMessageRepo) CountByChats(ctx context.Context, chatIDs []uint) (map[uint]entities.ChatMessageCount, error) {
+	r.countQueries++
+	result := make(map[uint]entities.ChatMessageCount)
+	for _, chatID := range chatIDs {
+		if messages := r.chatMessages(chatID); len(messages) > 0 {
+			result[chatID] = entities.ChatMessageCount{ChatID: chatID, Count: int64(len(messages))}
+		}
+	}
+	return result, nil
+}
+
+func (r *countingMessageRepo) CountUnreadMentionsByChats(ctx context.Context, chatIDs []uint, userID uint) (map[uint]int64, error) {
+	r.countQueries++
+	result := make(map[uint]int64)
+	for _, mention := range r.mentions {
+		if mention.UserID == userID && mention.ReadAt == nil && slices.Contains(chatIDs, mention.ChatID) {
+			result[mention.ChatID]++
+		}
+	}
+	return result, nil
+}
+
+func TestGetUserChatsUsesGroupedQueries(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+		3: {ID: 3, Username: "carol"},
+	}}
+	chats := &countingChatRepo{memChatRepo: newMemChatRepo(users)}
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	chats.addChat(&entities.Chat{ID: 11, CreatedBy: 1}, map[uint]string{1: "member", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 12, CreatedBy: 3}, map[uint]string{1: "member", 3: "member"})
+	chats.addChat(&entities.Chat{ID: 13, CreatedBy: 2}, map[uint]string{2: "member", 3: "member"})
+
+	messages := &countingMessageRepo{}
+	messages.created = []*entities.Message{{ChatID: 10}, {ChatID: 10}, {ChatID: 11}}
+	readAt := time.Now()
+	messages.mentions = []entities.MessageMention{
+		{ChatID: 10, UserID: 1},
+		{ChatID: 10, UserID: 1},
+		{ChatID: 10, UserID: 1, ReadAt: &readAt},
+		{ChatID: 11, UserID: 2},
+		{ChatID: 12, UserID: 1},
+	}
+
+	uc := NewChatUseCase(chats, messages, users, nil, nil, nil, &config.ChatConfig{MaxMessagesPerMinute: 100}, logger.New(), nil, nil)
+	result, err := uc.GetUserChats(context.Background(), 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages.countQueries != 2 || chats.getMembers != 0 {
+		t.Fatalf("count queries = %d, GetMembers calls = %d; want 2 and 0", messages.countQueries, chats.getMembers)
+	}
+
+	want := map[uint]struct {
+		name     string
+		messages int64
+		mentions int64
+	}{
+		10: {"team", 2, 2},
+		11: {"Chat with bob", 1, 0},
+		12: {"Chat with carol", 0, 1},
+	}
+	if len(result) != len(want) {
+		t.Fatalf("got %d chats, want %d", len(result), len(want))
+	}
+	for _, chat := range result {
+		w := want[chat.ID]
+		if chat.Name != w.name || chat.MessageCount != w.messages || chat.UnreadMentions != w.mentions {
+			t.Fatalf("chat %d = %q, %d messages, %d mentions; want %+v", chat.ID, chat.Name, chat.MessageCount, chat.UnreadMentions, w)
+		}
+	}
+}
+
+func TestCreateChatReturnsMembersWithRoles(t *testing.T) {
+	alice, bob, carol := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob"), serverKeyUser(t, 3, "carol")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: carol}})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+
+	// Создатель в списке участников запроса не дублируется
+	chat, err := uc.CreateChat(context.Background(), 1, &CreateChatRequest{Name: "team", IsGroup: true, MemberIDs: []uint{2, 3, 1}})
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	want := map[uint]string{1: "creator", 2: "member", 3: "member"}
+	if len(chat.Members) != len(want) || chat.MemberCount != len(want) {
+		t.Fatalf("members = %d, member count = %d; want %d", len(chat.Members), chat.MemberCount, len(want))
+	}
+	if chat.Members[0].ID != 1 {
+		t.Fatalf("first member = %d, want creator 1", chat.Members[0].ID)
+	}
+	for _, member := range chat.Members {
+		if member.Role != want[member.ID] {
+			t.Fatalf("user %d role = %q, want %q", member.ID, member.Role, want[member.ID])
+		}
+	}
+	if chat.Role != "admin" {
+		t.Fatalf("creator chat role = %q, want admin", chat.Role)
+	}
+}
+
+func TestCreateChatUnknownMemberCreatesNothing(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: {ID: 1, Username: "alice"}, 2: {ID: 2, Username: "bob"}}}
+	chats := newMemChatRepo(users)
+	uc := newTestChatUseCase(chats, nil)
+	ctx := context.Background()
+
+	_, err := uc.CreateChat(ctx, 1, &CreateChatRequest{Name: "team", IsGroup: true, MemberIDs: []uint{2, 99}})
+	if !errors.Is(err, ErrMemberNotFound) {
+		t.Fatalf("err = %v, want %v", err, ErrMemberNotFound)
+	}
+	if len(chats.chats) != 0 || len(chats.members) != 0 {
+		t.Fatalf("chat was created despite an unknown member: %d chats", len(chats.chats))
+	}
+
+	// Участник удален между проверкой и вставкой: репозиторий откатывает создание целиком
+	chats.users = &memUserRepo{users: map[uint]*entities.User{1: users.users[1]}}
+	if _, err := uc.CreateChat(ctx, 1, &CreateChatRequest{Name: "team", IsGroup: true, MemberIDs: []uint{2}}); err == nil {
+		t.Fatal("CreateChat succeeded although the member insert failed")
+	}
+	if len(chats.chats) != 0 || len(chats.members) != 0 {
+		t.Fatal("failed member insert left a chat behind")
+	}
+}
+
+func TestCreateOrGetPrivateChatByUsername(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: {ID: 1, Username: "alice"}, 2: {ID: 2, Username: "Bob"}}}
+	chats := newMemChatRepo(users)
+	uc := newTestChatUseCase(chats, nil)
+	ctx := context.Background()
+
+	created, err := uc.CreateOrGetPrivateChatByUsername(ctx, 1, "bob", nil)
+	if err != nil {
+		t.Fatalf("CreateOrGetPrivateChatByUsername: %v", err)
+	}
+	if !created.Created || created.Chat.Name != "Chat with Bob" || chats.role(created.Chat.ID, 2) != "member" {
+		t.Fatalf("response = %+v, want a new chat with Bob", created)
+	}
+
+	again, err := uc.CreateOrGetPrivateChatByUsername(ctx, 1, "Bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Created || again.Chat.ID != created.Chat.ID {
+		t.Fatalf("second call = chat %d (created %v), want existing chat %d", again.Chat.ID, again.Created, created.Chat.ID)
+	}
+
+	// Обработчик отвечает 404 на ErrUserNotFound
+	if _, err := uc.CreateOrGetPrivateChatByUsername(ctx, 1, "nobody", nil); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("unknown username: err = %v, want %v", err, ErrUserNotFound)
+	}
+	if _, err := uc.CreateOrGetPrivateChatByUsername(ctx, 1, "alice", nil); !errors.Is(err, ErrCannotChatWithSelf) {
+		t.Fatalf("own username: err = %v, want %v", err, ErrCannotChatWithSelf)
+	}
+	if len(chats.chats) != 1 {
+		t.Fatalf("%d chats created, want 1", len(chats.chats))
+	}
+}
+
+func TestSendMessageRateLimit(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	uc.messageLimiter = ratelimit.New(3, time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: fmt.Sprintf("m%d", i)}); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+	}
+	if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "one too many"}); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("message 4: err = %v, want %v", err, ErrRateLimited)
+	}
+	if len(messages.created) != 3 {
+		t.Fatalf("%d messages stored, want 3", len(messages.created))
+	}
+
+	// Лимит считается отдельно для каждого отправителя
+	if _, err := sendAs(t, uc, bob, 10, &SendMessageRequest{Content: "hi"}); err != nil {
+		t.Fatalf("other sender: %v", err)
+	}
+}
+
+func TestGetChatMembersLabelsCreatorInOneQuery(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "owner"},
+		2: {ID: 2, Username: "admin"},
+		3: {ID: 3, Username: "member"},
+	}}
+	chats := &countingChatRepo{memChatRepo: newMemChatRepo(users)}
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "admin", 3: "member"})
+	uc := NewChatUseCase(chats, nil, users, nil, nil, nil, &config.ChatConfig{}, logger.New(), nil, nil)
+
+	members, err := uc.GetChatMembers(context.Background(), 10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chats.membersWithRoles != 1 || chats.getMembers != 0 || chats.getByID != 0 {
+		t.Fatalf("member queries = %d, GetMembers = %d, GetByID = %d; want 1, 0, 0", chats.membersWithRoles, chats.getMembers, chats.getByID)
+	}
+
+	want := map[uint]string{1: "creator", 2: "admin", 3: "member"}
+	if len(members) != len(want) {
+		t.Fatalf("got %d members, want %d", len(members), len(want))
+	}
+	for _, member := range members {
+		if member.Role != want[member.ID] {
+			t.Fatalf("user %d role = %q, want %q", member.ID, member.Role, want[member.ID])
+		}
+	}
+}
+
+func TestGetChatMembersPagePagesThroughLargeGroup(t *testing.T) {
+	const total = 250
+	users := &memUserRepo{users: map[uint]*entities.User{}}
+	roles := map[uint]string{}
+	for id := uint(1); id <= total; id++ {
+		users.users[id] = &entities.User{ID: id, Username: fmt.Sprintf("user%d", id)}
+		roles[id] = "member"
+	}
+	roles[2] = "admin"
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, roles)
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+
+	seen := map[uint]bool{}
+	var pages int
+	for offset := 0; ; {
+		page, err := uc.GetChatMembersPage(context.Background(), 10, 5, 100, offset)
+		if err != nil {
+			t.Fatalf("page at %d: %v", offset, err)
+		}
+		if page.Total != total {
+			t.Fatalf("total = %d, want %d", page.Total, total)
+		}
+		pages++
+		for _, member := range page.Members {
+			if seen[member.ID] {
+				t.Fatalf("user %d returned twice", member.ID)
+			}
+			seen[member.ID] = true
+
+			want := roles[member.ID]
+			if member.ID == 1 {
+				want = "creator"
+			}
+			if member.Role != want {
+				t.Fatalf("user %d role = %q, want %q", member.ID, member.Role, want)
+			}
+		}
+		offset += len(page.Members)
+		if !page.HasMore {
+			break
+		}
+	}
+
+	if pages != 3 || len(seen) != total {
+		t.Fatalf("pages = %d, members = %d; want 3, %d", pages, len(seen), total)
+	}
+
+	if _, err := uc.GetChatMembersPage(context.Background(), 10, total+1, 100, 0); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestGetChatMessagesReportsCurrentKeyVersion(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+	ctx := context.Background()
+
+	version, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page, err := uc.GetChatMessages(ctx, 10, 2, 50, 0, nil); err != nil || page.KeyVersion != version {
+		t.Fatalf("key version = %v (%v), want %d", page, err, version)
+	}
+
+	// Ротация, пропущенная клиентом, видна при следующей загрузке сообщений
+	rotated, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := uc.GetChatMessages(ctx, 10, 2, 50, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated <= version || page.KeyVersion != rotated {
+		t.Fatalf("key version after rotation = %d, want %d", page.KeyVersion, rotated)
+	}
+}
+
+func TestMessagesDecryptAcrossKeyRotation(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+	ctx := context.Background()
+
+	before, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "before rotation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uc.rotateChatKey(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	after, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "after rotation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.KeyVersion == after.KeyVersion {
+		t.Fatalf("both messages use key version %d", before.KeyVersion)
+	}
+
+	for _, tt := range []struct {
+		message *entities.Message
+		want    string
+	}{{before, "before rotation"}, {after, "after rotation"}} {
+		if got := uc.buildMessageResponse(ctx, tt.message, bob).DecryptedContent; got != tt.want {
+			t.Fatalf("key version %d decrypted to %q, want %q", tt.message.KeyVersion, got, tt.want)
+		}
+	}
+}
+
+func TestRemovedMemberKeyCannotDecryptLaterMessages(t *testing.T) {
+	alice, bob, carol := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob"), serverKeyUser(t, 3, "carol")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: carol}})
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+	ctx := context.Background()
+
+	if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "before"}); err != nil {
+		t.Fatal(err)
+	}
+	carolKey, err := uc.GetWrappedChatKey(ctx, 10, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uc.RemoveMember(ctx, 10, 1, 3); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	after, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.KeyVersion <= carolKey.KeyVersion {
+		t.Fatalf("message after removal uses key version %d, removed member held %d", after.KeyVersion, carolKey.KeyVersion)
+	}
+
+	// Ключ, который успел получить удаленный участник, не подходит к новому сообщению
+	withOldKey := *after
+	withOldKey.KeyVersion = carolKey.KeyVersion
+	if _, err := uc.decryptMessage(ctx, &withOldKey, carol); err == nil {
+		t.Fatal("message after removal decrypted with the removed member's key")
+	}
+	if _, err := uc.GetWrappedChatKey(ctx, 10, 3, 0); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("removed member GetWrappedChatKey: err = %v, want %v", err, ErrNotChatMember)
+	}
+	if got := uc.buildMessageResponse(ctx, after, bob).DecryptedContent; got != "after" {
+		t.Fatalf("remaining member decrypted %q, want %q", got, "after")
+	}
+}
+
+func TestGetMessageDecryptsOnlyWithinChat(t *testing.T) {
+	alice, bob, carol := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob"), serverKeyUser(t, 3, "carol")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: carol}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 3: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+	ctx := context.Background()
+
+	inTeam, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "team secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inOther, err := sendAs(t, uc, alice, 11, &SendMessageRequest{Content: "other secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := uc.GetMessage(ctx, 10, inTeam.ID, 2)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	if response.ID != inTeam.ID || response.DecryptedContent != "team secret" {
+		t.Fatalf("response = message %d %q, want %d %q", response.ID, response.DecryptedContent, inTeam.ID, "team secret")
+	}
+
+	// Обработчик отвечает 404 на ErrMessageNotFound
+	for _, tt := range []struct {
+		name      string
+		messageID uint
+		userID    uint
+	}{
+		{"message of another chat", inOther.ID, 2},
+		{"member of both chats", inOther.ID, 1},
+		{"unknown message", 999, 2},
+	} {
+		if _, err := uc.GetMessage(ctx, 10, tt.messageID, tt.userID); !errors.Is(err, ErrMessageNotFound) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrMessageNotFound)
+		}
+	}
+	if _, err := uc.GetMessage(ctx, 10, inTeam.ID, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestSendClientEncryptedMessageStoredVerbatim(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	// Клиент шифрует и подписывает сообщение сам; сервер видит только результат
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(alice.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(alice.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSecret := sha256.Sum256([]byte("client-side chat key"))
+	secureMsg, err := crypto.CreateSecureMessage("", "1", "10", []byte("e2e hello"), append(clientSecret[:], clientSecret[:]...), ecdsaPrivateKey, rsaPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &SendEncryptedMessageRequest{
+		Ciphertext:     secureMsg.Ciphertext,
+		IV:             secureMsg.IV,
+		HMAC:           secureMsg.HMAC,
+		Nonce:          secureMsg.Nonce,
+		ECDSASignature: secureMsg.ECDSASignature,
+		RSASignature:   secureMsg.RSASignature,
+	}
+
+	message, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, req)
+	if err != nil {
+		t.Fatalf("SendClientEncryptedMessage: %v", err)
+	}
+
+	response, err := uc.GetMessage(ctx, 10, message.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("GetMessage: %v", err)
+	}
+	stored := response.Message
+	if !stored.ClientEncrypted {
+		t.Fatal("message is not marked as client-encrypted")
+	}
+	if stored.Content != req.Ciphertext || stored.IV != req.IV || stored.HMAC != req.HMAC || stored.Nonce != req.Nonce ||
+		stored.ECDSASignature != req.ECDSASignature || stored.RSASignature != req.RSASignature {
+		t.Fatalf("stored message differs from the submitted one: %+v", stored)
+	}
+	if !response.Encrypted || response.DecryptedContent != "" {
+		t.Fatalf("server tried to decrypt a client-encrypted message: %+v", response)
+	}
+
+	// Подпись чужим ключом не проходит проверку по зарегистрированным ключам отправителя
+	forged := *req
+	forged.ECDSASignature = secureMsg.RSASignature
+	if _, err := uc.SendClientEncryptedMessage(ctx, 10, bob.ID, &forged); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("forged signature: err = %v, want %v", err, ErrInvalidMessage)
+	}
+	if len(messages.created) != 1 {
+		t.Fatalf("%d messages stored, want 1", len(messages.created))
+	}
+}
+
+func TestSendClientEncryptedMessageAcrossKeyRotation(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(alice.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(alice.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// encryptedRequest - клиент шифрует сообщение ключом чата указанной версии
+	encryptedRequest := func(version int) *SendEncryptedMessageRequest {
+		chatKey, err := uc.chatKey(ctx, 10, version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secureMsg, err := crypto.CreateSecureMessage("", "1", "10", []byte("hello"), chatKey, ecdsaPrivateKey, rsaPrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &SendEncryptedMessageRequest{
+			Ciphertext:     secureMsg.Ciphertext,
+			IV:             secureMsg.IV,
+			HMAC:           secureMsg.HMAC,
+			Nonce:          secureMsg.Nonce,
+			ECDSASignature: secureMsg.ECDSASignature,
+			RSASignature:   secureMsg.RSASignature,
+			KeyVersion:     version,
+		}
+	}
+
+	first, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, encryptedRequest(first))
+	if err != nil {
+		t.Fatalf("send with version %d: %v", first, err)
+	}
+
+	second, err := uc.rotateChatKey(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Клиент, пропустивший ротацию, получает отказ и должен взять новый ключ
+	if _, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, encryptedRequest(first)); !errors.Is(err, ErrStaleKeyVersion) {
+		t.Fatalf("send with stale version: err = %v, want %v", err, ErrStaleKeyVersion)
+	}
+	stale := encryptedRequest(second)
+	stale.KeyVersion = second + 1
+	if _, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, stale); !errors.Is(err, ErrStaleKeyVersion) {
+		t.Fatalf("send with unknown version: err = %v, want %v", err, ErrStaleKeyVersion)
+	}
+	after, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, encryptedRequest(second))
+	if err != nil {
+		t.Fatalf("send with version %d: %v", second, err)
+	}
+
+	// Сохраненная версия указывает получателю, каким ключом расшифровать сообщение
+	for _, tt := range []struct {
+		message *entities.Message
+		version int
+	}{{before, first}, {after, second}} {
+		response, err := uc.GetMessage(ctx, 10, tt.message.ID, bob.ID)
+		if err != nil {
+			t.Fatalf("GetMessage: %v", err)
+		}
+		if response.KeyVersion != tt.version {
+			t.Fatalf("message %d key version = %d, want %d", tt.message.ID, response.KeyVersion, tt.version)
+		}
+		chatKey, err := uc.chatKey(ctx, 10, response.KeyVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		senderECDSAPublicKey, _ := hex.DecodeString(alice.ECDSAPublicKey)
+		senderRSAPublicKey, _ := hex.DecodeString(alice.RSAPublicKey)
+		plaintext, err := crypto.VerifyAndDecryptMessage(&crypto.SecureMessage{
+			Ciphertext:     response.Content,
+			IV:             response.IV,
+			HMAC:           response.HMAC,
+			Nonce:          response.Nonce,
+			ECDSASignature: response.ECDSASignature,
+			RSASignature:   response.RSASignature,
+			Algorithm:      response.Algorithm,
+		}, chatKey, senderECDSAPublicKey, senderRSAPublicKey)
+		if err != nil || string(plaintext) != "hello" {
+			t.Fatalf("message %d decrypted with version %d = %q, %v; want hello", tt.message.ID, tt.version, plaintext, err)
+		}
+	}
+	if len(messages.created) != 2 {
+		t.Fatalf("%d messages stored, want 2", len(messages.created))
+	}
+}
+
+// ratchetRequest - шифрует текст храповиком отправителя и подписывает шифротекст его ключами,
+// как это делает клиент в чате с Double Ratchet
+func ratchetRequest(t *testing.T, sender *entities.User, ratchet *crypto.Ratchet, text string) *SendEncryptedMessageRequest {
+	t.Helper()
+
+	ratchetMsg, err := ratchet.Encrypt([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, _ := hex.DecodeString(ratchetMsg.Ciphertext)
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(sender.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(sender.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaSignature, err := crypto.SignECDSA(ecdsaPrivateKey, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := crypto.SignRSA(rsaPrivateKey, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := crypto.GenerateNonce(crypto.NonceSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &SendEncryptedMessageRequest{
+		Ciphertext:     ratchetMsg.Ciphertext,
+		IV:             ratchetMsg.IV,
+		HMAC:           ratchetMsg.HMAC,
+		Nonce:          hex.EncodeToString(nonce),
+		ECDSASignature: hex.EncodeToString(ecdsaSignature),
+		RSASignature:   hex.EncodeToString(rsaSignature),
+		RatchetHeader:  &ratchetMsg.Header,
+	}
+}
+
+// storedRatchetMessage - восстанавливает сообщение храповика из сохраненного сервером
+func storedRatchetMessage(msg *entities.Message) *crypto.RatchetMessage {
+	return &crypto.RatchetMessage{
+		Header: crypto.RatchetHeader{
+			PublicKey:    msg.RatchetPublicKey,
+			PrevChainLen: msg.RatchetPrevChainLen,
+			MessageNum:   msg.RatchetMessageNum,
+		},
+		IV:         msg.IV,
+		Ciphertext: msg.Content,
+		HMAC:       msg.HMAC,
+	}
+}
+
+func TestDoubleRatchetPrivateChatEndToEnd(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	chat, err := uc.CreateChat(ctx, alice.ID, &CreateChatRequest{
+		Name: "alice & bob", MemberIDs: []uint{bob.ID}, EncryptionSchemes: []string{crypto.EncryptionSchemeDoubleRatchet},
+	})
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	if chat.EncryptionScheme != crypto.EncryptionSchemeDoubleRatchet {
+		t.Fatalf("encryption scheme = %q, want %q", chat.EncryptionScheme, crypto.EncryptionSchemeDoubleRatchet)
+	}
+
+	// Общий секрет и ключ ответчика клиенты согласуют между собой, сервер их не видит
+	sharedSecret := sha256.Sum256([]byte("alice-bob handshake"))
+	bobKeys, err := crypto.GenerateRatchetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceRatchet, err := crypto.NewRatchetInitiator(sharedSecret[:], bobKeys.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobRatchet := crypto.NewRatchetResponder(sharedSecret[:], bobKeys)
+
+	texts := []string{"first", "second", "third"}
+	for _, text := range texts {
+		if _, err := uc.SendClientEncryptedMessage(ctx, chat.ID, alice.ID, ratchetRequest(t, alice, aliceRatchet, text)); err != nil {
+			t.Fatalf("send %q: %v", text, err)
+		}
+	}
+
+	page, err := uc.GetChatMessages(ctx, chat.ID, bob.ID, 50, 0, nil)
+	if err != nil {
+		t.Fatalf("GetChatMessages: %v", err)
+	}
+	if len(page.Messages) != len(texts) {
+		t.Fatalf("%d messages, want %d", len(page.Messages), len(texts))
+	}
+	byID := make(map[uint]*entities.Message, len(page.Messages))
+	for _, response := range page.Messages {
+		if !response.Encrypted || response.DecryptedContent != "" {
+			t.Fatalf("server decrypted a ratchet message: %+v", response)
+		}
+		byID[response.ID] = response.Message
+	}
+
+	// Боб получает сообщения не по порядку: третье, затем первое и второе
+	for _, i := range []int{2, 0, 1} {
+		msg := byID[uint(i+1)]
+		if msg == nil {
+			t.Fatalf("message %d not returned", i+1)
+		}
+		plaintext, err := bobRatchet.Decrypt(storedRatchetMessage(msg))
+		if err != nil {
+			t.Fatalf("bob decrypt message %d: %v", msg.ID, err)
+		}
+		if string(plaintext) != texts[i] {
+			t.Fatalf("message %d = %q, want %q", msg.ID, plaintext, texts[i])
+		}
+	}
+
+	// Ответ Боба продвигает DH-храповик, Алиса расшифровывает его своим состоянием
+	reply, err := uc.SendClientEncryptedMessage(ctx, chat.ID, bob.ID, ratchetRequest(t, bob, bobRatchet, "reply"))
+	if err != nil {
+		t.Fatalf("bob reply: %v", err)
+	}
+	if plaintext, err := aliceRatchet.Decrypt(storedRatchetMessage(reply)); err != nil || string(plaintext) != "reply" {
+		t.Fatalf("alice decrypt reply = %q, %v; want %q", plaintext, err, "reply")
+	}
+
+	// Сервер не шифрует за клиента в чате с храповиком
+	if _, err := uc.SendMessage(ctx, chat.ID, alice.ID, &SendMessageRequest{Content: "server side"}, nil, nil); !errors.Is(err, ErrRatchetChat) {
+		t.Fatalf("server-encrypted send err = %v, want %v", err, ErrRatchetChat)
+	}
+	if len(messages.created) != len(texts)+1 {
+		t.Fatalf("%d messages stored, want %d", len(messages.created), len(texts)+1)
+	}
+}
+
+func TestRatchetHeaderMatchesChatScheme(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1, EncryptionScheme: crypto.EncryptionSchemeStatic}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 11, CreatedBy: 1, EncryptionScheme: crypto.EncryptionSchemeDoubleRatchet}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+
+	bobKeys, err := crypto.GenerateRatchetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ratchet, err := crypto.NewRatchetInitiator(make([]byte, 32), bobKeys.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Заголовок храповика в чате со статическим ключом не принимается
+	ctx := context.Background()
+	if _, err := uc.SendClientEncryptedMessage(ctx, 10, alice.ID, ratchetRequest(t, alice, ratchet, "hi")); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("header in static chat: err = %v, want %v", err, ErrInvalidMessage)
+	}
+
+	// В чате с храповиком корректно подписанное сообщение без заголовка или с чужим ключом отклоняется
+	for _, header := range []*crypto.RatchetHeader{nil, {PublicKey: "not a key"}} {
+		req := ratchetRequest(t, alice, ratchet, "hi")
+		req.RatchetHeader = header
+		if _, err := uc.SendClientEncryptedMessage(ctx, 11, alice.ID, req); !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("header %+v in ratchet chat: err = %v, want %v", header, err, ErrInvalidMessage)
+		}
+	}
+	// Версия ключа чата к сообщениям храповика не относится
+	versioned := ratchetRequest(t, alice, ratchet, "hi")
+	versioned.KeyVersion = 1
+	if _, err := uc.SendClientEncryptedMessage(ctx, 11, alice.ID, versioned); !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("key version in ratchet chat: err = %v, want %v", err, ErrInvalidMessage)
+	}
+	if _, err := uc.SendClientEncryptedMessage(ctx, 11, alice.ID, ratchetRequest(t, alice, ratchet, "hi")); err != nil {
+		t.Fatalf("valid ratchet message: %v", err)
+	}
+}
+
+func TestGetChatDetails(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+		3: {ID: 3, Username: "carol"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	chats.addChat(&entities.Chat{ID: 11, CreatedBy: 1}, map[uint]string{1: "member", 2: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+	ctx := context.Background()
+
+	group, err := uc.GetChat(ctx, 10, 2)
+	if err != nil {
+		t.Fatalf("GetChat: %v", err)
+	}
+	if group.Name != "team" || group.Role != "member" || group.MemberCount != 3 {
+		t.Fatalf("group = name %q role %q members %d, want team/member/3", group.Name, group.Role, group.MemberCount)
+	}
+
+	private, err := uc.GetChat(ctx, 11, 2)
+	if err != nil {
+		t.Fatalf("GetChat: %v", err)
+	}
+	if private.Name != "Chat with alice" || private.MemberCount != 2 {
+		t.Fatalf("private chat = name %q members %d, want %q/2", private.Name, private.MemberCount, "Chat with alice")
+	}
+
+	if _, err := uc.GetChat(ctx, 11, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestSendMessageValidatesContent(t *testing.T) {
+	alice := serverKeyUser(t, 1, "alice")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+
+	if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "broken \xff"}); !errors.Is(err, ErrInvalidContent) {
+		t.Fatalf("invalid UTF-8: err = %v, want %v", err, ErrInvalidContent)
+	}
+	if len(messages.created) != 0 {
+		t.Fatal("message with invalid UTF-8 was stored")
+	}
+
+	req := &SendMessageRequest{Content: "ding\x07 dong"}
+	if _, err := sendAs(t, uc, alice, 10, req); err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	// Рассылка берет текст из запроса, поэтому в нем должна остаться очищенная версия
+	if req.Content != "ding dong" {
+		t.Fatalf("request content = %q, want %q", req.Content, "ding dong")
+	}
+	response, err := uc.GetMessage(context.Background(), 10, messages.created[0].ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.DecryptedContent != "ding dong" {
+		t.Fatalf("stored content = %q, want %q", response.DecryptedContent, "ding dong")
+	}
+}
+
+func TestArchivedChatHiddenUntilNewMessage(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 11, Name: "other", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, &countingMessageRepo{})
+	ctx := context.Background()
+
+	listed := func(includeArchived bool) map[uint]bool {
+		t.Helper()
+		list, err := uc.GetUserChats(ctx, bob.ID, includeArchived)
+		if err != nil {
+			t.Fatalf("GetUserChats: %v", err)
+		}
+		result := make(map[uint]bool)
+		for _, chat := range list {
+			result[chat.ID] = chat.Archived
+		}
+		return result
+	}
+
+	if err := uc.SetArchived(ctx, 10, bob.ID, true); err != nil {
+		t.Fatalf("SetArchived: %v", err)
+	}
+	if got := listed(false); !maps.Equal(got, map[uint]bool{11: false}) {
+		t.Fatalf("default list = %v, want only chat 11", got)
+	}
+	if got := listed(true); len(got) != 2 || !got[10] || got[11] {
+		t.Fatalf("list with archived = %v, want chat 10 archived and chat 11 not", got)
+	}
+	// Архив личный: у другого участника чат остается в списке
+	if list, _ := uc.GetUserChats(ctx, alice.ID, false); len(list) != 2 {
+		t.Fatalf("alice sees %d chats, want 2", len(list))
+	}
+
+	if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "are you there?"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := listed(false); len(got) != 2 || got[10] {
+		t.Fatalf("list after new message = %v, want chat 10 back and not archived", got)
+	}
+
+	if err := uc.SetArchived(ctx, 10, 3, true); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestSendMessageInOneMemberChat(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	// Собеседник покинул личный чат, в группе тоже остался только создатель
+	chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1}, map[uint]string{1: "member"})
+	chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+
+	if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "anyone?"}); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("private chat: err = %v, want %v", err, ErrNoRecipients)
+	}
+	if len(messages.created) != 0 {
+		t.Fatal("message without recipients was stored")
+	}
+
+	// Групповое сообщение шифруется ключом чата и станет доступно тем, кто присоединится позже
+	message, err := sendAs(t, uc, alice, 11, &SendMessageRequest{Content: "note to self"})
+	if err != nil {
+		t.Fatalf("group chat: %v", err)
+	}
+	if err := chats.AddMember(context.Background(), 11, bob.ID, "member"); err != nil {
+		t.Fatal(err)
+	}
+	response, err := uc.GetMessage(context.Background(), 11, message.ID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.DecryptedContent != "note to self" {
+		t.Fatalf("later member decrypted %q, want %q", response.DecryptedContent, "note to self")
+	}
+}
+
+func TestGetChatMessagesFiltersByType(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: {ID: 1, Username: "alice"}}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	messages := &memMessageRepo{}
+	for i, messageType := range []string{"system", "text", "image", "text", "system", "text"} {
+		messages.created = append(messages.created, &entities.Message{
+			ID: uint(i + 1), ChatID: 10, SenderID: 1, MessageType: messageType, Content: fmt.Sprintf("%s-%d", messageType, i+1),
+		})
+	}
+	uc := newTestChatUseCase(chats, messages)
+
+	contents := func(page *MessagePage) []string {
+		var result []string
+		for _, message := range page.Messages {
+			result = append(result, message.DecryptedContent)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name          string
+		types         []string
+		limit, offset int
+		want          []string
+		wantTotal     int64
+		wantHasMore   bool
+	}{
+		{"system only", []string{"system"}, 10, 0, []string{"system-1", "system-5"}, 2, false},
+		{"text only", []string{"text"}, 10, 0, []string{"text-2", "text-4", "text-6"}, 3, false},
+		{"text page", []string{"text"}, 2, 0, []string{"text-2", "text-4"}, 3, true},
+		{"text next page", []string{"text"}, 2, 2, []string{"text-6"}, 3, false},
+		{"several types", []string{"image", "system"}, 10, 0, []string{"system-1", "image-3", "system-5"}, 3, false},
+		{"no filter", nil, 10, 0, []string{"system-1", "text-2", "image-3", "text-4", "system-5", "text-6"}, 6, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := uc.GetChatMessages(context.Background(), 10, 1, tt.limit, tt.offset, tt.types)
+			if err != nil {
+				t.Fatalf("GetChatMessages: %v", err)
+			}
+			if got := contents(page); !slices.Equal(got, tt.want) {
+				t.Fatalf("messages = %v, want %v", got, tt.want)
+			}
+			if page.Total != tt.wantTotal || page.HasMore != tt.wantHasMore {
+				t.Fatalf("total = %d, has_more = %v; want %d, %v", page.Total, page.HasMore, tt.wantTotal, tt.wantHasMore)
+			}
+		})
+	}
+}
+
+// racingChats - задерживает поиск приватного чата, пока оба запроса не убедятся, что чата нет,
+// чтобы оба гарантированно перешли к созданию
+type racingChats struct {
+	*memChatRepo
+	searched sync.WaitGroup
+}
+
+func (r *racingChats) FindPrivateChat(ctx context.Context, userID1, userID2 uint) (*entities.Chat, error) {
+	chat, err := r.memChatRepo.FindPrivateChat(ctx, userID1, userID2)
+	r.searched.Done()
+	r.searched.Wait()
+	return chat, err
+}
+
+func TestConcurrentPrivateChatCreationLeavesOneChat(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{1: {ID: 1, Username: "alice"}, 2: {ID: 2, Username: "bob"}}}
+	chats := &racingChats{memChatRepo: newMemChatRepo(users)}
+	chats.searched.Add(2)
+	uc := newTestChatUseCase(chats.memChatRepo, nil)
+	uc.chatRepo = chats
+
+	var wg sync.WaitGroup
+	responses := make([]*PrivateChatResponse, 2)
+	errs := make([]error, 2)
+	for i, pair := range [][2]uint{{1, 2}, {2, 1}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = uc.CreateOrGetPrivateChat(context.Background(), pair[0], pair[1], "other", nil)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("CreateOrGetPrivateChat: %v", err)
+		}
+	}
+	if len(chats.chats) != 1 {
+		t.Fatalf("%d private chats created, want 1", len(chats.chats))
+	}
+	if responses[0].Chat.ID != responses[1].Chat.ID {
+		t.Fatalf("requests got chats %d and %d, want the same chat", responses[0].Chat.ID, responses[1].Chat.ID)
+	}
+	if responses[0].Created == responses[1].Created {
+		t.Fatalf("created = %v/%v, want exactly one request to create the chat", responses[0].Created, responses[1].Created)
+	}
+}
+
+func TestGetChatStatsCountsSeededChat(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+		3: {ID: 3, Username: "carol"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+
+	now := time.Now()
+	messages := &memMessageRepo{}
+	seed := func(chatID, senderID uint, messageType string, createdAt time.Time) {
+		messages.created = append(messages.created, &entities.Message{
+			ID: uint(len(messages.created) + 1), ChatID: chatID, SenderID: senderID, MessageType: messageType, CreatedAt: createdAt,
+		})
+	}
+	seed(10, 1, "text", now.AddDate(0, 0, -10)) // вне недельного окна
+	seed(10, 1, "text", now.AddDate(0, 0, -2))
+	seed(10, 2, "text", now.AddDate(0, 0, -2))
+	seed(10, 2, "text", now)
+	seed(10, 2, "text", now)
+	for i := 0; i < 3; i++ {
+		seed(10, 0, "system", now) // системные сообщения не делают никого самым активным
+	}
+	seed(11, 1, "text", now)
+
+	uc := newTestChatUseCase(chats, messages)
+	stats, err := uc.GetChatStats(context.Background(), 10, 3)
+	if err != nil {
+		t.Fatalf("GetChatStats: %v", err)
+	}
+
+	if stats.MessageCount != 8 || stats.MemberCount != 3 {
+		t.Fatalf("messages = %d, members = %d; want 8, 3", stats.MessageCount, stats.MemberCount)
+	}
+	if stats.MostActiveMember == nil || stats.MostActiveMember.UserID != 2 || stats.MostActiveMember.Count != 3 {
+		t.Fatalf("most active member = %+v, want user 2 with 3 messages", stats.MostActiveMember)
+	}
+	if len(stats.MessagesPerDay) != statsDays {
+		t.Fatalf("%d days of stats, want %d", len(stats.MessagesPerDay), statsDays)
+	}
+	want := make([]int64, statsDays)
+	want[statsDays-3], want[statsDays-1] = 2, 5
+	for i, day := range stats.MessagesPerDay {
+		if day.Count != want[i] {
+			t.Errorf("%s: %d messages, want %d", day.Date, day.Count, want[i])
+		}
+	}
+	if last := stats.MessagesPerDay[statsDays-1].Date; last != now.Format("2006-01-02") {
+		t.Fatalf("last day = %s, want today", last)
+	}
+
+	if _, err := uc.GetChatStats(context.Background(), 11, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestForwardMessageBulkReportsEachTarget(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 12, IsGroup: true, CreatedBy: 2}, map[uint]string{1: "member", 2: "admin"})
+	chats.addChat(&entities.Chat{ID: 13, IsGroup: true, CreatedBy: 2}, map[uint]string{2: "admin"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+
+	source, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "pass it on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaPrivateKey, err := crypto.DeserializeECDSAPrivateKey([]byte(alice.ECDSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, err := crypto.DeserializeRSAPrivateKey([]byte(alice.RSAPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, content, err := uc.ForwardMessageBulk(context.Background(), alice.ID, &ForwardBulkRequest{
+		MessageID: source.ID,
+		ChatIDs:   []uint{11, 13, 12},
+	}, ecdsaPrivateKey, rsaPrivateKey)
+	if err != nil {
+		t.Fatalf("ForwardMessageBulk: %v", err)
+	}
+	if content != "pass it on" {
+		t.Fatalf("forwarded content = %q", content)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("%d results, want 3", len(results))
+	}
+	for i, want := range []struct {
+		chatID  uint
+		success bool
+	}{{11, true}, {13, false}, {12, true}} {
+		result := results[i]
+		if result.ChatID != want.chatID || result.Success != want.success {
+			t.Fatalf("result %d = chat %d success %v, want chat %d success %v", i, result.ChatID, result.Success, want.chatID, want.success)
+		}
+		if result.Success && (result.MessageID == 0 || result.Error != "") {
+			t.Errorf("chat %d: successful result = %+v", result.ChatID, result)
+		}
+		if !result.Success && (result.MessageID != 0 || result.Error != ErrNotChatMember.Error()) {
+			t.Errorf("chat %d: failed result = %+v, want error %q", result.ChatID, result, ErrNotChatMember)
+		}
+	}
+
+	forwarded, err := uc.GetMessage(context.Background(), 12, results[2].MessageID, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forwarded.DecryptedContent != "pass it on" || forwarded.ForwardedFromID == nil || *forwarded.ForwardedFromID != source.ID {
+		t.Fatalf("forwarded message = %q from %v, want %q from %d", forwarded.DecryptedContent, forwarded.ForwardedFromID, "pass it on", source.ID)
+	}
+	if len(messages.chatMessages(13)) != 0 {
+		t.Fatal("message forwarded into a chat the user is not in")
+	}
+}
+
+func TestEditMessageWindow(t *testing.T) {
+	tests := []struct {
+		name        string
+		senderID    uint
+		age         time.Duration
+		adminExempt bool
+		wantErr     error
+	}{
+		{"fresh message", 2, time.Minute, false, nil},
+		{"old message", 2, 48 * time.Hour, false, ErrEditWindowExpired},
+		{"old message by admin without exemption", 1, 48 * time.Hour, false, ErrEditWindowExpired},
+		{"old message by exempt admin", 1, 48 * time.Hour, true, nil},
+		{"old message by member with admin exemption", 2, 48 * time.Hour, true, ErrEditWindowExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+			chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+			chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+			messages := &memMessageRepo{}
+			uc := newTestChatUseCase(chats, messages)
+			uc.editWindow = 24 * time.Hour
+			uc.editAdminExempt = tt.adminExempt
+
+			sender := map[uint]*entities.User{1: alice, 2: bob}[tt.senderID]
+			message, err := sendAs(t, uc, sender, 10, &SendMessageRequest{Content: "original"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Состариваем сообщение в хранилище
+			messages.mu.Lock()
+			messages.created[message.ID-1].CreatedAt = time.Now().Add(-tt.age)
+			messages.mu.Unlock()
+
+			edited, err := uc.EditMessage(context.Background(), 10, message.ID, tt.senderID, &EditMessageRequest{Content: "edited"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("EditMessage err = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, err := messages.GetByID(context.Background(), message.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != nil {
+				if stored.IsEdited {
+					t.Fatal("rejected edit was stored")
+				}
+				return
+			}
+			if !edited.IsEdited || !stored.IsEdited {
+				t.Fatal("message is not marked as edited")
+			}
+			if got := uc.buildMessageResponse(context.Background(), stored, alice).DecryptedContent; got != "edited" {
+				t.Fatalf("edited content = %q, want %q", got, "edited")
+			}
+		})
+	}
+}
+
+func TestAddMembersBulk(t *testing.T) {
+	users := &memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+		3: {ID: 3, Username: "carol"},
+		4: {ID: 4, Username: "dave"},
+	}}
+	chats := newMemChatRepo(users)
+	chats.addChat(&entities.Chat{ID: 10, Name: "team", IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	notifier := newRecordingNotifier()
+	uc.notificationSender = notifier
+
+	results, err := uc.AddMembers(context.Background(), 10, 1, []uint{3, 2, 4, 3})
+	if err != nil {
+		t.Fatalf("AddMembers: %v", err)
+	}
+
+	want := []AddMemberResult{
+		{UserID: 3, Username: "carol", Added: true},
+		{UserID: 2, Username: "bob", Error: "user is already a member of this chat"},
+		{UserID: 4, Username: "dave", Added: true},
+	}
+	if !slices.Equal(results, want) {
+		t.Fatalf("results = %+v, want %+v", results, want)
+	}
+	for _, userID := range []uint{3, 4} {
+		if chats.role(10, userID) != "member" {
+			t.Fatalf("user %d was not added", userID)
+		}
+	}
+
+	// Одно системное сообщение и одно уведомление чата на всю пачку
+	system := messages.typedMessages(10, []string{"system"})
+	if len(system) != 1 || !strings.Contains(system[0].Content, "carol, dave") {
+		t.Fatalf("system messages = %+v, want one listing carol, dave", system)
+	}
+	notifications := notifier.toChat[10]
+	if len(notifications) != 1 || notifications[0].Type != entities.NotificationMembersAdded {
+		t.Fatalf("chat notifications = %+v, want one %s", notifications, entities.NotificationMembersAdded)
+	}
+	if len(notifier.toUser[3]) != 1 || len(notifier.toUser[4]) != 1 || len(notifier.toUser[2]) != 0 {
+		t.Fatalf("invite notifications = %v", notifier.toUser)
+	}
+
+	// Несуществующий пользователь отклоняет всю пачку
+	if _, err := uc.AddMembers(context.Background(), 10, 1, []uint{99}); !errors.Is(err, ErrMemberNotFound) {
+		t.Fatalf("unknown user: err = %v, want %v", err, ErrMemberNotFound)
+	}
+}
+
+func TestVerifyMessageReportsEachCheck(t *testing.T) {
+	// corrupt - заменяет символ в середине значения, сохраняя его декодируемым
+	corrupt := func(value string) string {
+		b := []byte(value)
+		i := len(b) / 2
+		if b[i] == 'a' {
+			b[i] = 'b'
+		} else {
+			b[i] = 'a'
+		}
+		return string(b)
+	}
+
+	tests := []struct {
+		name                string
+		mutate              func(*entities.Message)
+		wantECDSA, wantRSA  bool
+		wantHMAC, wantValid bool
+	}{
+		{"intact", func(*entities.Message) {}, true, true, true, true},
+		{"corrupted ECDSA signature", func(m *entities.Message) { m.ECDSASignature = corrupt(m.ECDSASignature) }, false, true, true, false},
+		{"corrupted RSA signature", func(m *entities.Message) { m.RSASignature = corrupt(m.RSASignature) }, true, false, true, false},
+		{"corrupted HMAC", func(m *entities.Message) { m.HMAC = corrupt(m.HMAC) }, true, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+			chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+			chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+			chats.addChat(&entities.Chat{ID: 11, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+			messages := &memMessageRepo{}
+			uc := newTestChatUseCase(chats, messages)
+
+			message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "verify me"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages.mu.Lock()
+			tt.mutate(messages.created[message.ID-1])
+			messages.mu.Unlock()
+
+			result, err := uc.VerifyMessage(context.Background(), 10, message.ID, bob.ID)
+			if err != nil {
+				t.Fatalf("VerifyMessage: %v", err)
+			}
+			if result.HMACValid == nil {
+				t.Fatal("HMAC was not checked")
+			}
+			if result.ECDSAValid != tt.wantECDSA || result.RSAValid != tt.wantRSA || *result.HMACValid != tt.wantHMAC || result.Valid != tt.wantValid {
+				t.Fatalf("ecdsa/rsa/hmac/valid = %v/%v/%v/%v, want %v/%v/%v/%v",
+					result.ECDSAValid, result.RSAValid, *result.HMACValid, result.Valid, tt.wantECDSA, tt.wantRSA, tt.wantHMAC, tt.wantValid)
+			}
+
+			// Проверять сообщения могут только участники чата
+			if _, err := uc.VerifyMessage(context.Background(), 11, message.ID, bob.ID); !errors.Is(err, ErrNotChatMember) {
+				t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+			}
+		})
+	}
+}
+
+func TestRestoreMessageWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		restorerID uint
+		deletedAgo time.Duration
+		wantErr    error
+	}{
+		{"within window", 1, 0, nil},
+		{"after window", 1, time.Minute, ErrRestoreWindowExpired},
+		{"someone else's deletion", 2, 0, ErrMessageForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+			chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+			chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1}, map[uint]string{1: "member", 2: "member"})
+			messages := &memMessageRepo{}
+			uc := newTestChatUseCase(chats, messages)
+			uc.restoreWindow = 10 * time.Second
+			ctx := context.Background()
+
+			message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "oops"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := uc.DeleteMessage(ctx, 10, message.ID, alice.ID); err != nil {
+				t.Fatalf("DeleteMessage: %v", err)
+			}
+			messages.mu.Lock()
+			messages.created[message.ID-1].DeletedAt.Time = time.Now().Add(-tt.deletedAgo)
+			messages.mu.Unlock()
+
+			restored, err := uc.RestoreMessage(ctx, 10, message.ID, tt.restorerID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RestoreMessage err = %v, want %v", err, tt.wantErr)
+			}
+
+			_, getErr := messages.GetByID(ctx, message.ID)
+			if tt.wantErr != nil {
+				if getErr == nil {
+					t.Fatal("message restored despite the error")
+				}
+				return
+			}
+			if getErr != nil {
+				t.Fatal("restored message is still deleted")
+			}
+			if restored.DecryptedContent != "oops" {
+				t.Fatalf("restored content = %q, want %q", restored.DecryptedContent, "oops")
+			}
+		})
+	}
+}
+
+func TestExportChatStreamsDecryptedHistoryInOrder(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: serverKeyUser(t, 3, "carol")}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	uc := newTestChatUseCase(chats, &memMessageRepo{})
+
+	conversation := []struct {
+		sender  *entities.User
+		content string
+	}{
+		{alice, "hi bob"},
+		{bob, "hi alice"},
+		{alice, "exporting this"},
+	}
+	for _, line := range conversation {
+		if _, err := sendAs(t, uc, line.sender, 10, &SendMessageRequest{Content: line.content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exported []ExportedMessage
+	err := uc.ExportChat(context.Background(), 10, bob.ID, func(message ExportedMessage) error {
+		exported = append(exported, message)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ExportChat: %v", err)
+	}
+
+	if len(exported) != len(conversation) {
+		t.Fatalf("exported %d messages, want %d", len(exported), len(conversation))
+	}
+	for i, want := range conversation {
+		got := exported[i]
+		if got.Content != want.content || got.SenderUsername != want.sender.Username || got.Encrypted {
+			t.Fatalf("message %d = %q from %q (encrypted %v), want %q from %q", i, got.Content, got.SenderUsername, got.Encrypted, want.content, want.sender.Username)
+		}
+		if i > 0 && (got.Seq <= exported[i-1].Seq || got.CreatedAt.Before(exported[i-1].CreatedAt)) {
+			t.Fatalf("message %d is out of chronological order", i)
+		}
+	}
+
+	// Не участник не может выгрузить историю
+	err = uc.ExportChat(context.Background(), 10, 3, func(ExportedMessage) error {
+		t.Fatal("message emitted to a non-member")
+		return nil
+	})
+	if !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+}
+
+func TestSendMessageSlowMode(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1, SlowModeSeconds: 30}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+
+	first, err := sendAs(t, uc, bob, 10, &SendMessageRequest{Content: "first"})
+	if err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+
+	_, err = sendAs(t, uc, bob, 10, &SendMessageRequest{Content: "too soon"})
+	var slowMode *SlowModeError
+	if !errors.As(err, &slowMode) || !errors.Is(err, ErrSlowMode) {
+		t.Fatalf("second message: err = %v, want %v", err, ErrSlowMode)
+	}
+	if slowMode.Remaining <= 0 || slowMode.Remaining > 30*time.Second {
+		t.Fatalf("remaining cooldown = %s, want within (0, 30s]", slowMode.Remaining)
+	}
+
+	// После окна сообщение принимается
+	messages.mu.Lock()
+	messages.created[first.ID-1].CreatedAt = time.Now().Add(-31 * time.Second)
+	messages.mu.Unlock()
+	if _, err := sendAs(t, uc, bob, 10, &SendMessageRequest{Content: "after the window"}); err != nil {
+		t.Fatalf("message after the window: %v", err)
+	}
+
+	// Администратор от медленного режима освобожден
+	for i := 0; i < 2; i++ {
+		if _, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "admin"}); err != nil {
+			t.Fatalf("admin message %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestSendMessageWithAttachment(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 20, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	messages := &memMessageRepo{attachments: map[uint]*entities.Attachment{
+		1: {ID: 1, ChatID: 10, UploaderID: 1},
+		2: {ID: 2, ChatID: 10, UploaderID: 2},
+		3: {ID: 3, ChatID: 20, UploaderID: 1},
+	}}
+	uc := newTestChatUseCase(chats, messages)
+	attachmentID := func(id uint) *uint { return &id }
+
+	message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "photo", AttachmentID: attachmentID(1)})
+	if err != nil {
+		t.Fatalf("own attachment: %v", err)
+	}
+	if message.AttachmentID == nil || *message.AttachmentID != 1 {
+		t.Fatalf("message attachment = %v, want 1", message.AttachmentID)
+	}
+	if linked := messages.attachments[1].MessageID; linked == nil || *linked != message.ID {
+		t.Fatalf("attachment linked to %v, want message %d", linked, message.ID)
+	}
+
+	// Отклоненная отправка не оставляет ни сообщения, ни изменений во вложениях
+	tests := []struct {
+		name         string
+		attachmentID uint
+	}{
+		{"nonexistent attachment", 99},
+		{"another user's upload", 2},
+		{"upload to another chat", 3},
+		{"already linked", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "photo", AttachmentID: attachmentID(tt.attachmentID)})
+			if !errors.Is(err, ErrAttachmentNotFound) {
+				t.Fatalf("err = %v, want %v", err, ErrAttachmentNotFound)
+			}
+			if n := len(messages.chatMessages(10)); n != 1 {
+				t.Fatalf("%d messages stored, want 1", n)
+			}
+			if messages.attachments[2].MessageID != nil || messages.attachments[3].MessageID != nil {
+				t.Fatal("a rejected send linked an attachment")
+			}
+		})
+	}
+}
+
+func TestGetMessageReadersListsOnlyReaders(t *testing.T) {
+	alice, bob, carol := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob"), serverKeyUser(t, 3, "carol")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: carol, 4: {ID: 4, Username: "dave"}}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Читает только bob; отправитель не попадает в список, перечитав свое сообщение
+	for _, userID := range []uint{2, 1} {
+		if err := uc.MarkMessageRead(ctx, 10, message.ID, userID); err != nil {
+			t.Fatalf("MarkMessageRead(%d): %v", userID, err)
+		}
+	}
+
+	readers, err := uc.GetMessageReaders(ctx, 10, message.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readers) != 1 || readers[0].UserID != 2 || readers[0].ReadAt.IsZero() {
+		t.Fatalf("readers = %+v, want only bob with a read time", readers)
+	}
+
+	if _, err := uc.GetMessageReaders(ctx, 10, message.ID, 4); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member: err = %v, want %v", err, ErrNotChatMember)
+	}
+	if _, err := uc.GetMessageReaders(ctx, 10, 99, 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("unknown message: err = %v, want %v", err, ErrMessageNotFound)
+	}
+}
+
+func TestSearchMessagesAcrossChats(t *testing.T) {
+	alice, bob, carol := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob"), serverKeyUser(t, 3, "carol")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob, 3: carol}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, Name: "team", CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	chats.addChat(&entities.Chat{ID: 20, IsGroup: true, Name: "friends", CreatedBy: 3}, map[uint]string{1: "member", 3: "admin"})
+	chats.addChat(&entities.Chat{ID: 30, IsGroup: true, Name: "old", CreatedBy: 2}, map[uint]string{1: "member", 2: "admin"})
+	messages := &countingMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	for _, send := range []struct {
+		sender  *entities.User
+		chatID  uint
+		content string
+	}{
+		{bob, 10, "The Alpha release is ready"},
+		{alice, 10, "nothing to see here"},
+		{carol, 20, "alpha testers wanted"},
+		{bob, 30, "alpha in a chat alice left"},
+	} {
+		if _, err := sendAs(t, uc, send.sender, send.chatID, &SendMessageRequest{Content: send.content}); err != nil {
+			t.Fatalf("send to %d: %v", send.chatID, err)
+		}
+	}
+	if err := chats.RemoveMember(ctx, 30, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := uc.SearchMessages(ctx, 1, "ALPHA", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Совпадения из двух текущих чатов, новые сначала; покинутый чат не просматривается
+	if page.Total != 2 || page.HasMore || len(page.Results) != 2 {
+		t.Fatalf("page = %+v, want 2 hits in 2 chats", page)
+	}
+	found := make(map[uint]string)
+	for _, result := range page.Results {
+		if len(result.Messages) != 1 {
+			t.Fatalf("chat %d: %d hits, want 1", result.ChatID, len(result.Messages))
+		}
+		found[result.ChatID] = result.Messages[0].Snippet
+	}
+	if found[10] != "The Alpha release is ready" || found[20] != "alpha testers wanted" {
+		t.Fatalf("snippets = %v", found)
+	}
+
+	// Постраничная выдача
+	page, err = uc.SearchMessages(ctx, 1, "alpha", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || page.HasMore || len(page.Results) != 1 {
+		t.Fatalf("second page = %+v, want the last hit", page)
+	}
+
+	if _, err := uc.SearchMessages(ctx, 1, " a ", 10, 0); !errors.Is(err, ErrInvalidSearchQuery) {
+		t.Fatalf("short query: err = %v, want %v", err, ErrInvalidSearchQuery)
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := strings.Repeat("x", 60) + " Needle " + strings.Repeat("y", 60)
+
+	snippet, ok := searchSnippet(long, []rune("needle"))
+	if !ok {
+		t.Fatal("needle not found")
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") || !strings.Contains(snippet, "Needle") {
+		t.Fatalf("snippet = %q, want the match with trimmed context", snippet)
+	}
+	if _, ok := searchSnippet("haystack", []rune("needle")); ok {
+		t.Fatal("found a needle that is not there")
+	}
+}
+
+func TestSendMessageTypeAllowlist(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	uc := NewChatUseCase(chats, messages, chats.users, nil, nil, nil, &config.ChatConfig{
+		MaxMessagesPerMinute: 100,
+		ControlCharsPolicy:   "strip",
+		AllowedMessageTypes:  []string{"text", " image ", "system"},
+	}, logger.New(), nil, nil)
+
+	tests := []struct {
+		messageType string
+		wantType    string
+		wantErr     error
+	}{
+		{"", "text", nil},
+		{"text", "text", nil},
+		{"image", "image", nil},
+		{"sticker", "", ErrInvalidMessageType},
+		// Системные сообщения создает только сервер, даже если тип указан в настройках
+		{"system", "", ErrInvalidMessageType},
+	}
+
+	for _, tt := range tests {
+		stored := len(messages.chatMessages(10))
+		message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: "hello", MessageType: tt.messageType})
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("type %q: err = %v, want %v", tt.messageType, err, tt.wantErr)
+		}
+		if tt.wantErr != nil {
+			if n := len(messages.chatMessages(10)); n != stored {
+				t.Fatalf("type %q: message stored despite rejection", tt.messageType)
+			}
+			continue
+		}
+		if message.MessageType != tt.wantType {
+			t.Fatalf("type %q: stored as %q, want %q", tt.messageType, message.MessageType, tt.wantType)
+		}
+	}
+}
+
+func TestExportChatFollowsSeqAcrossBatches(t *testing.T) {
+	alice := serverKeyUser(t, 1, "alice")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+
+	// После нумерации старой истории по created_at порядок номеров расходится с порядком ID:
+	// сообщения с большими ID получили меньшие номера
+	total := exportBatchSize + 50
+	for i := 0; i < total; i++ {
+		message := &entities.Message{ChatID: 10, SenderID: 1, Content: fmt.Sprintf("m%d", total-i), MessageType: "text", Seq: int64(total - i)}
+		if err := messages.Create(context.Background(), message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seqs []int64
+	if err := uc.ExportChat(context.Background(), 10, 1, func(message ExportedMessage) error {
+		seqs = append(seqs, message.Seq)
+		return nil
+	}); err != nil {
+		t.Fatalf("ExportChat: %v", err)
+	}
+
+	// Выгружается вся история по порядку номеров, без пропусков на границе порций
+	if len(seqs) != total {
+		t.Fatalf("exported %d messages, want %d", len(seqs), total)
+	}
+	for i, seq := range seqs {
+		if seq != int64(i+1) {
+			t.Fatalf("message %d has seq %d, want %d", i, seq, i+1)
+		}
+	}
+}
+
+func TestExportUserDataIncludesOnlyOwnMessages(t *testing.T) {
+	alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, Name: "team", CreatedBy: 2}, map[uint]string{1: "member", 2: "admin"})
+	chats.addChat(&entities.Chat{ID: 20, IsGroup: true, Name: "bob only", CreatedBy: 2}, map[uint]string{2: "admin"})
+	messages := &memMessageRepo{}
+	uc := newTestChatUseCase(chats, messages)
+	ctx := context.Background()
+
+	for _, send := range []struct {
+		sender  *entities.User
+		chatID  uint
+		content string
+	}{
+		{alice, 10, "alice one"},
+		{bob, 10, "bob's secret"},
+		{alice, 10, "alice two"},
+		{bob, 20, "bob elsewhere"},
+	} {
+		if _, err := sendAs(t, uc, send.sender, send.chatID, &SendMessageRequest{Content: send.content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exported []ExportedUserMessage
+	if err := uc.ExportUserMessages(ctx, 1, func(message ExportedUserMessage) error {
+		exported = append(exported, message)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != 2 {
+		t.Fatalf("exported %d messages, want alice's 2", len(exported))
+	}
+	for i, want := range []string{"alice one", "alice two"} {
+		if exported[i].Content != want || exported[i].SenderID != 1 || exported[i].ChatID != 10 || exported[i].Encrypted {
+			t.Fatalf("message %d = %+v, want decrypted %q", i, exported[i], want)
+		}
+	}
+
+	// Чужие чаты в выгрузку не попадают
+	chatList, err := uc.ExportUserChats(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chatList) != 1 || chatList[0].ID != 10 || chatList[0].Role != "member" {
+		t.Fatalf("chats = %+v, want only chat 10 as member", chatList)
+	}
+}
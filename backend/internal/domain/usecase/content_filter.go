@@ -0,0 +1,130 @@
+package usecase
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// FilterVerdict - решение фильтра содержимого по тексту сообщения
+type FilterVerdict int
+
+const (
+	// FilterAllow - сообщение отправляется без изменений
+	FilterAllow FilterVerdict = iota
+	// FilterFlag - сообщение отправляется, но сохраняется с пометкой для проверки модератором
+	FilterFlag
+	// FilterReject - сообщение отклоняется
+	FilterReject
+)
+
+// Действия словарного фильтра при совпадении
+const (
+	ContentFilterActionFlag   = "flag"
+	ContentFilterActionReject = "reject"
+)
+
+var ErrContentRejected = errors.New("message content rejected by content filter")
+
+// ContentFilter - проверка открытого текста сообщения перед шифрованием; позволяет развертыванию
+// подключить собственную модерацию
+type ContentFilter interface {
+	Check(ctx context.Context, content string) FilterVerdict
+}
+
+// NoopContentFilter - фильтр по умолчанию, пропускающий все сообщения
+type NoopContentFilter struct{}
+
+// Check - всегда разрешает сообщение
+func (NoopContentFilter) Check(context.Context, string) FilterVerdict {
+	return FilterAllow
+}
+
+// WordlistFilter - фильтр по списку запрещенных слов; слова сравниваются целиком без учета регистра
+type WordlistFilter struct {
+	words   map[string]bool
+	verdict FilterVerdict
+}
+
+// NewWordlistFilter - создает словарный фильтр, который при совпадении помечает или отклоняет сообщение
+func NewWordlistFilter(words []string, action string) (*WordlistFilter, error) {
+	var verdict FilterVerdict
+	switch action {
+	case ContentFilterActionFlag:
+		verdict = FilterFlag
+	case ContentFilterActionReject:
+		verdict = FilterReject
+	default:
+		return nil, fmt.Errorf("unknown content filter action %q", action)
+	}
+
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			set[word] = true
+		}
+	}
+
+	return &WordlistFilter{words: set, verdict: verdict}, nil
+}
+
+// LoadWordlistFilter - загружает словарный фильтр из файла: одно слово на строку, строки с # - комментарии
+func LoadWordlistFilter(path, action string) (*WordlistFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewWordlistFilter(words, action)
+}
+
+// Check - ищет в тексте слова из списка
+func (f *WordlistFilter) Check(_ context.Context, content string) FilterVerdict {
+	tokens := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, token := range tokens {
+		if f.words[token] {
+			return f.verdict
+		}
+	}
+	return FilterAllow
+}
+
+// NewContentFilter - создает фильтр по настройкам: без файла словаря возвращает NoopContentFilter
+func NewContentFilter(wordlistPath, action string) (ContentFilter, error) {
+	if wordlistPath == "" {
+		return NoopContentFilter{}, nil
+	}
+	return LoadWordlistFilter(wordlistPath, action)
+}
+
+// applyContentFilter - проверяет текст фильтром и сообщает, нужно ли пометить сообщение
+func (uc *ChatUseCase) applyContentFilter(ctx context.Context, content string) (flagged bool, err error) {
+	switch uc.contentFilter.Check(ctx, content) {
+	case FilterReject:
+		return false, ErrContentRejected
+	case FilterFlag:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sleek-chat-backend/internal/domain/entities"
+	"testing"
+)
+
+func TestWordlistFilterCheck(t *testing.T) {
+	filter, err := NewWordlistFilter([]string{" Spam ", "scam", ""}, ContentFilterActionReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		content string
+		want    FilterVerdict
+	}{
+		{"hello there", FilterAllow},
+		{"buy SPAM now", FilterReject},
+		{"total scam!", FilterReject},
+		// Совпадают только слова целиком
+		{"spammer and scampi", FilterAllow},
+		{"", FilterAllow},
+	}
+
+	for _, tt := range tests {
+		if got := filter.Check(context.Background(), tt.content); got != tt.want {
+			t.Fatalf("Check(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+
+	if _, err := NewWordlistFilter([]string{"spam"}, "delete"); err == nil {
+		t.Fatal("unknown action accepted")
+	}
+}
+
+func TestNewContentFilter(t *testing.T) {
+	filter, err := NewContentFilter("", ContentFilterActionFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := filter.(NoopContentFilter); !ok {
+		t.Fatalf("filter without a wordlist = %T, want NoopContentFilter", filter)
+	}
+
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# запрещенные слова\nspam\n\n  scam  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	filter, err = NewContentFilter(path, ContentFilterActionFlag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for content, want := range map[string]FilterVerdict{"a scam": FilterFlag, "spam": FilterFlag, "запрещенные слова": FilterAllow} {
+		if got := filter.Check(context.Background(), content); got != want {
+			t.Fatalf("Check(%q) = %v, want %v", content, got, want)
+		}
+	}
+
+	if _, err := NewContentFilter(filepath.Join(t.TempDir(), "missing.txt"), ContentFilterActionFlag); err == nil {
+		t.Fatal("missing wordlist file accepted")
+	}
+}
+
+func TestSendMessageContentFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		content     string
+		wantErr     error
+		wantFlagged bool
+	}{
+		{"allow", ContentFilterActionReject, "hello", nil, false},
+		{"reject", ContentFilterActionReject, "buy spam", ErrContentRejected, false},
+		{"flag", ContentFilterActionFlag, "buy spam", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alice, bob := serverKeyUser(t, 1, "alice"), serverKeyUser(t, 2, "bob")
+			chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{1: alice, 2: bob}})
+			chats.addChat(&entities.Chat{ID: 10, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+			messages := &memMessageRepo{}
+			uc := newTestChatUseCase(chats, messages)
+			filter, err := NewWordlistFilter([]string{"spam"}, tt.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			uc.SetContentFilter(filter)
+
+			message, err := sendAs(t, uc, alice, 10, &SendMessageRequest{Content: tt.content})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if n := len(messages.chatMessages(10)); n != 0 {
+					t.Fatalf("%d messages stored after rejection, want 0", n)
+				}
+				return
+			}
+			if message.Flagged != tt.wantFlagged {
+				t.Fatalf("flagged = %v, want %v", message.Flagged, tt.wantFlagged)
+			}
+		})
+	}
+}
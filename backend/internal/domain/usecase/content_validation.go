@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Политики обработки управляющих символов в тексте сообщения
+const (
+	ControlCharsStrip  = "strip"
+	ControlCharsReject = "reject"
+)
+
+var ErrInvalidContent = errors.New("message content contains invalid UTF-8 or control characters")
+
+// isDisallowedControl - сообщает, является ли символ запрещенным управляющим; переводы строк и табуляция допустимы
+func isDisallowedControl(r rune) bool {
+	if r == '\n' || r == '\r' || r == '\t' {
+		return false
+	}
+	return unicode.IsControl(r)
+}
+
+// sanitizeContent - проверяет, что текст является корректным UTF-8, и в зависимости от политики
+// удаляет управляющие символы или отклоняет сообщение с ними
+func sanitizeContent(content, policy string) (string, error) {
+	if !utf8.ValidString(content) {
+		return "", ErrInvalidContent
+	}
+
+	if strings.IndexFunc(content, isDisallowedControl) < 0 {
+		return content, nil
+	}
+
+	if policy == ControlCharsReject {
+		return "", ErrInvalidContent
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if isDisallowedControl(r) {
+			return -1
+		}
+		return r
+	}, content)
+
+	if strings.TrimSpace(sanitized) == "" {
+		return "", ErrInvalidContent
+	}
+
+	return sanitized, nil
+}
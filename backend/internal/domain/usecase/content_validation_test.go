@@ -0,0 +1,43 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSanitizeContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		policy  string
+		want    string
+		wantErr bool
+	}{
+		{"plain text", "hello", ControlCharsStrip, "hello", false},
+		{"newlines and tabs kept", "line 1\r\n\tline 2", ControlCharsReject, "line 1\r\n\tline 2", false},
+		{"invalid UTF-8 with strip", "bad \xff\xfe bytes", ControlCharsStrip, "", true},
+		{"invalid UTF-8 with reject", "bad \xc3\x28", ControlCharsReject, "", true},
+		{"control chars stripped", "he\x00ll\x1bo\u0085", ControlCharsStrip, "hello", false},
+		{"control chars rejected", "he\x00llo", ControlCharsReject, "", true},
+		{"only control chars", "\x00\x07 \x1b", ControlCharsStrip, "", true},
+		{"unicode text", "привет 👋", ControlCharsReject, "привет 👋", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sanitizeContent(tt.content, tt.policy)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidContent) {
+					t.Fatalf("err = %v, want %v", err, ErrInvalidContent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sanitizeContent: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,51 +1,102 @@
 package usecase
 
 import (
+	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
 	"sleek-chat-backend/pkg/logger"
 	"time"
+)
+
+var (
+	ErrInvalidClientPublicKey = errors.New("invalid client public key")
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrSessionOwnerMismatch   = errors.New("session does not belong to user")
 
-	"golang.org/x/crypto/hkdf"
+	ErrKeyExchangeNotFound       = errors.New("key exchange not found")
+	ErrNotKeyExchangeParticipant = errors.New("user is not a participant of the key exchange")
+	ErrKeyExchangeNotPending     = errors.New("key exchange is not pending")
 )
 
+// sessionActivityInterval - как часто записывать время активности сессии; обновление при каждом
+// запросе нагружало бы БД, а точность до минуты для тайм-аута простоя достаточна
+const sessionActivityInterval = time.Minute
+
 type KeyExchangeUseCase struct {
-	sessionRepo repository.SessionRepository
-	userRepo    repository.UserRepository
-	logger      *logger.Logger
+	sessionRepo     repository.SessionRepository
+	userRepo        repository.UserRepository
+	keyExchangeRepo repository.KeyExchangeRepository
+	notifier        NotificationSender
+	logger          *logger.Logger
+	audit           *AuditLogger
+	sessionTTL      time.Duration
+	idleTimeout     time.Duration
 }
 
 // NewKeyExchangeUseCase создает новый use case для обмена ключами
 func NewKeyExchangeUseCase(
 	sessionRepo repository.SessionRepository,
 	userRepo repository.UserRepository,
+	keyExchangeRepo repository.KeyExchangeRepository,
+	keysCfg *config.KeysConfig,
 	logger *logger.Logger,
+	audit *AuditLogger,
 ) *KeyExchangeUseCase {
 	return &KeyExchangeUseCase{
-		sessionRepo: sessionRepo,
-		userRepo:    userRepo,
-		logger:      logger,
+		sessionRepo:     sessionRepo,
+		userRepo:        userRepo,
+		keyExchangeRepo: keyExchangeRepo,
+		logger:          logger,
+		audit:           audit,
+		sessionTTL:      keysCfg.KeyExchangeTTL,
+		idleTimeout:     keysCfg.KeyExchangeIdleTimeout,
 	}
 }
 
-// KeyExchangeRequest представляет запрос на обмен ключами
+// SetNotificationSender устанавливает канал уведомлений участников обмена ключами
+func (uc *KeyExchangeUseCase) SetNotificationSender(notifier NotificationSender) {
+	uc.notifier = notifier
+}
+
+// Типы ключей обмена: P-256 (PKIX) используется по умолчанию, X25519 передается сырыми 32 байтами
+const (
+	KeyTypeP256   = "p256"
+	KeyTypeX25519 = "x25519"
+)
+
+// KeyExchangeRequest представляет запрос на обмен ключами. KeyType выбирает кривую ECDH,
+// пустое значение означает P-256
 type KeyExchangeRequest struct {
 	ClientPublicKey string `json:"clientPublicKey" binding:"required"`
 	UserID          uint   `json:"userId" binding:"required"`
+	KeyType         string `json:"keyType" binding:"omitempty,oneof=p256 x25519"`
+	// SaltAware - клиент деривирует ключи с солью из ответа; клиенты без этого флага
+	// получают ключи, выведенные с общей солью legacySessionSalt
+	SaltAware bool `json:"saltAware"`
 }
 
-// KeyExchangeResponse представляет ответ на обмен ключами
+// KeyExchangeResponse представляет ответ на обмен ключами. Salt - hex-соль HKDF,
+// с которой клиент должен деривировать ключи этой сессии; пустая для клиентов без SaltAware
 type KeyExchangeResponse struct {
 	ServerPublicKey string `json:"serverPublicKey"`
 	SessionID       string `json:"sessionId"`
 	ExpiresAt       int64  `json:"expiresAt"`
+	Salt            string `json:"salt,omitempty"`
+	KeyType         string `json:"keyType"`
 }
 
+// sessionSaltSize - длина случайной соли HKDF сессии в байтах
+const sessionSaltSize = 32
+
+// legacySessionSalt - общая соль HKDF, с которой деривируют ключи клиенты, не знающие о соли сессии
+const legacySessionSalt = "sleek-chat-salt"
+
 // SessionInfo содержит информацию о сессии и ключах
 type SessionInfo struct {
 	SessionID string
@@ -55,39 +106,57 @@ type SessionInfo struct {
 }
 
 // InitiateKeyExchange инициирует процесс обмена ключами с клиентом
-func (uc *KeyExchangeUseCase) InitiateKeyExchange(req *KeyExchangeRequest) (*KeyExchangeResponse, *SessionInfo, error) {
+func (uc *KeyExchangeUseCase) InitiateKeyExchange(ctx context.Context, req *KeyExchangeRequest) (*KeyExchangeResponse, *SessionInfo, error) {
 	uc.logger.Info("Initiating key exchange", "userID", req.UserID)
 
 	// Проверяем существование пользователя
-	user, err := uc.userRepo.GetByID(req.UserID)
+	user, err := uc.userRepo.GetByID(ctx, req.UserID)
 	if err != nil {
 		uc.logger.Error("User not found", "userID", req.UserID, "error", err)
-		return nil, nil, fmt.Errorf("user not found")
+		return nil, nil, ErrUserNotFound
 	}
 
-	// Генерируем серверную пару ключей ECDH
-	serverPrivateKey, serverPublicKeyBytes, err := crypto.GenerateECDSAKeys()
-	if err != nil {
-		uc.logger.Error("Failed to generate server ECDH keys", "error", err)
-		return nil, nil, fmt.Errorf("failed to generate server keys")
-	}
-
-	// Декодируем публичный ключ клиента
+	// Декодируем и проверяем публичный ключ клиента до генерации серверных ключей
 	clientPublicKeyBytes, err := hex.DecodeString(req.ClientPublicKey)
 	if err != nil {
 		uc.logger.Error("Failed to decode client public key", "error", err)
-		return nil, nil, fmt.Errorf("invalid client public key format")
+		return nil, nil, ErrInvalidClientPublicKey
 	}
 
-	// Вычисляем общий секрет ECDH
-	sharedSecret, err := crypto.ComputeECDHSharedSecret(serverPrivateKey, clientPublicKeyBytes)
+	keyType := req.KeyType
+	if keyType == "" {
+		keyType = KeyTypeP256
+	}
+
+	// Генерируем серверную пару ключей ECDH и вычисляем общий секрет
+	var serverPublicKeyBytes, sharedSecret []byte
+	switch keyType {
+	case KeyTypeX25519:
+		serverPublicKeyBytes, sharedSecret, err = uc.agreeX25519(clientPublicKeyBytes)
+	case KeyTypeP256:
+		serverPublicKeyBytes, sharedSecret, err = uc.agreeP256(clientPublicKeyBytes)
+	default:
+		err = ErrInvalidClientPublicKey
+	}
 	if err != nil {
-		uc.logger.Error("Failed to compute ECDH shared secret", "error", err)
-		return nil, nil, fmt.Errorf("failed to compute shared secret")
+		return nil, nil, err
+	}
+
+	// Случайная соль для каждой сессии разделяет ключи сессий даже при совпадении общего секрета;
+	// старые клиенты выводят ключи с общей солью, поэтому для них она сохраняется
+	salt := []byte(legacySessionSalt)
+	keySalt := ""
+	if req.SaltAware {
+		salt = make([]byte, sessionSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			uc.logger.Error("Failed to generate session salt", "error", err)
+			return nil, nil, fmt.Errorf("failed to generate session salt")
+		}
+		keySalt = hex.EncodeToString(salt)
 	}
 
 	// Деривируем AES и HMAC ключи из общего секрета
-	aesKey, hmacKey, err := uc.deriveSessionKeys(sharedSecret)
+	aesKey, hmacKey, err := uc.deriveSessionKeys(sharedSecret, salt)
 	if err != nil {
 		uc.logger.Error("Failed to derive session keys", "error", err)
 		return nil, nil, fmt.Errorf("failed to derive session keys")
@@ -101,15 +170,18 @@ func (uc *KeyExchangeUseCase) InitiateKeyExchange(req *KeyExchangeRequest) (*Key
 	}
 
 	// Создаем сессию в базе данных
-	expiresAt := time.Now().Add(24 * time.Hour) // Сессия действительна 24 часа
+	now := time.Now()
+	expiresAt := now.Add(uc.sessionTTL)
 	session := &entities.Session{
-		Token:     sessionID,
-		UserID:    user.ID,
-		ExpiresAt: expiresAt,
-		IsActive:  true,
+		Token:        sessionID,
+		UserID:       user.ID,
+		ExpiresAt:    expiresAt,
+		IsActive:     true,
+		KeySalt:      keySalt,
+		LastActivity: now,
 	}
 
-	if err := uc.sessionRepo.Create(session); err != nil {
+	if err := uc.sessionRepo.Create(ctx, session); err != nil {
 		uc.logger.Error("Failed to create session", "error", err)
 		return nil, nil, fmt.Errorf("failed to create session")
 	}
@@ -119,6 +191,8 @@ func (uc *KeyExchangeUseCase) InitiateKeyExchange(req *KeyExchangeRequest) (*Key
 		ServerPublicKey: hex.EncodeToString(serverPublicKeyBytes),
 		SessionID:       sessionID,
 		ExpiresAt:       expiresAt.Unix(),
+		Salt:            session.KeySalt,
+		KeyType:         keyType,
 	}
 
 	sessionInfo := &SessionInfo{
@@ -137,32 +211,86 @@ func (uc *KeyExchangeUseCase) InitiateKeyExchange(req *KeyExchangeRequest) (*Key
 	return response, sessionInfo, nil
 }
 
+// agreeP256 выполняет ECDH на P-256 с эфемерным серверным ключом
+func (uc *KeyExchangeUseCase) agreeP256(clientPublicKeyBytes []byte) ([]byte, []byte, error) {
+	if _, err := crypto.ParseP256PublicKey(clientPublicKeyBytes); err != nil {
+		uc.logger.Error("Client public key is not a valid P-256 point", "error", err)
+		return nil, nil, ErrInvalidClientPublicKey
+	}
+
+	serverPrivateKey, serverPublicKeyBytes, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		uc.logger.Error("Failed to generate server ECDH keys", "error", err)
+		return nil, nil, fmt.Errorf("failed to generate server keys")
+	}
+
+	sharedSecret, err := crypto.ComputeECDHSharedSecret(serverPrivateKey, clientPublicKeyBytes)
+	if err != nil {
+		uc.logger.Error("Failed to compute ECDH shared secret", "error", err)
+		return nil, nil, fmt.Errorf("failed to compute shared secret")
+	}
+
+	return serverPublicKeyBytes, sharedSecret, nil
+}
+
+// agreeX25519 выполняет ECDH на X25519 с эфемерным серверным ключом
+func (uc *KeyExchangeUseCase) agreeX25519(clientPublicKeyBytes []byte) ([]byte, []byte, error) {
+	if _, err := crypto.ParseX25519PublicKey(clientPublicKeyBytes); err != nil {
+		uc.logger.Error("Client public key is not a valid X25519 key", "error", err)
+		return nil, nil, ErrInvalidClientPublicKey
+	}
+
+	serverPrivateKey, serverPublicKeyBytes, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		uc.logger.Error("Failed to generate server X25519 keys", "error", err)
+		return nil, nil, fmt.Errorf("failed to generate server keys")
+	}
+
+	sharedSecret, err := crypto.X25519SharedSecret(serverPrivateKey, clientPublicKeyBytes)
+	if err != nil {
+		uc.logger.Error("Failed to compute X25519 shared secret", "error", err)
+		return nil, nil, ErrInvalidClientPublicKey
+	}
+
+	return serverPublicKeyBytes, sharedSecret, nil
+}
+
 // RefreshSession обновляет существующую сессию и перегенерирует ключи
-func (uc *KeyExchangeUseCase) RefreshSession(sessionID string, req *KeyExchangeRequest) (*KeyExchangeResponse, *SessionInfo, error) {
+func (uc *KeyExchangeUseCase) RefreshSession(ctx context.Context, sessionID string, req *KeyExchangeRequest) (*KeyExchangeResponse, *SessionInfo, error) {
 	uc.logger.Info("Refreshing session", "sessionID", sessionID, "userID", req.UserID)
 
 	// Получаем существующую сессию
-	session, err := uc.sessionRepo.GetByToken(sessionID)
+	session, err := uc.sessionRepo.GetByToken(ctx, sessionID)
 	if err != nil {
 		uc.logger.Error("Session not found", "sessionID", sessionID, "error", err)
-		return nil, nil, fmt.Errorf("session not found")
+		return nil, nil, ErrSessionNotFound
 	}
 
 	// Проверяем, что сессия принадлежит пользователю
 	if session.UserID != req.UserID {
 		uc.logger.Error("Session does not belong to user", "sessionID", sessionID, "userID", req.UserID)
-		return nil, nil, fmt.Errorf("unauthorized")
+		return nil, nil, ErrSessionOwnerMismatch
 	}
 
 	// Выполняем новый обмен ключами
-	return uc.InitiateKeyExchange(req)
+	response, sessionInfo, err := uc.InitiateKeyExchange(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uc.audit.Record(ctx, req.UserID, entities.AuditActionKeyRotated, map[string]interface{}{
+		"previous_session_id": sessionID,
+		"session_id":          response.SessionID,
+	})
+	return response, sessionInfo, nil
 }
 
-// ValidateSession проверяет действительность сессии
-func (uc *KeyExchangeUseCase) ValidateSession(sessionID string) (*entities.Session, error) {
-	session, err := uc.sessionRepo.GetByToken(sessionID)
+// ValidateSession проверяет действительность сессии: срок действия и простой. Действительная
+// сессия отмечается как активная, поэтому простой отсчитывается от последнего использования
+func (uc *KeyExchangeUseCase) ValidateSession(ctx context.Context, sessionID string) (*entities.Session, error) {
+	session, err := uc.sessionRepo.GetByToken(ctx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("session not found")
+		return nil, ErrSessionNotFound
 	}
 
 	if !session.IsActive {
@@ -172,41 +300,103 @@ func (uc *KeyExchangeUseCase) ValidateSession(sessionID string) (*entities.Sessi
 	if time.Now().After(session.ExpiresAt) {
 		// Деактивируем истекшую сессию
 		session.IsActive = false
-		uc.sessionRepo.Update(session)
+		uc.sessionRepo.Update(ctx, session)
 		return nil, fmt.Errorf("session expired")
 	}
 
+	now := time.Now()
+	lastActivity := session.LastActivity
+	if lastActivity.IsZero() {
+		lastActivity = session.CreatedAt
+	}
+
+	if uc.idleTimeout > 0 && now.Sub(lastActivity) > uc.idleTimeout {
+		// Деактивируем сессию, которой не пользовались дольше тайм-аута простоя
+		session.IsActive = false
+		uc.sessionRepo.Update(ctx, session)
+		return nil, fmt.Errorf("session idle timeout exceeded")
+	}
+
+	if now.Sub(lastActivity) >= sessionActivityInterval {
+		if err := uc.sessionRepo.UpdateActivity(ctx, sessionID, now); err != nil {
+			uc.logger.Error("Failed to update session activity", "sessionID", sessionID, "error", err)
+		} else {
+			session.LastActivity = now
+		}
+	}
+
 	return session, nil
 }
 
 // RevokeSession отзывает (деактивирует) сессию
-func (uc *KeyExchangeUseCase) RevokeSession(sessionID string) error {
-	session, err := uc.sessionRepo.GetByToken(sessionID)
+func (uc *KeyExchangeUseCase) RevokeSession(ctx context.Context, sessionID string) error {
+	session, err := uc.sessionRepo.GetByToken(ctx, sessionID)
 	if err != nil {
-		return fmt.Errorf("session not found")
+		return ErrSessionNotFound
 	}
 
 	session.IsActive = false
-	if err := uc.sessionRepo.Update(session); err != nil {
+	if err := uc.sessionRepo.Update(ctx, session); err != nil {
 		uc.logger.Error("Failed to revoke session", "sessionID", sessionID, "error", err)
 		return fmt.Errorf("failed to revoke session")
 	}
 
+	uc.audit.Record(ctx, session.UserID, entities.AuditActionSessionRevoked, map[string]interface{}{
+		"session_id": sessionID,
+	})
+
 	uc.logger.Info("Session revoked successfully", "sessionID", sessionID)
 	return nil
 }
 
-// deriveSessionKeys деривирует AES и HMAC ключи из общего секрета
-func (uc *KeyExchangeUseCase) deriveSessionKeys(sharedSecret []byte) ([]byte, []byte, error) {
-	// Используем HKDF для деривации ключей
-	salt := []byte("sleek-chat-salt")
-	info := []byte("sleek-chat-session-keys")
+// CancelExchange отменяет ожидающий обмен ключами по запросу одного из участников
+// и уведомляет второго участника
+func (uc *KeyExchangeUseCase) CancelExchange(ctx context.Context, exchangeID, userID uint) (*entities.KeyExchange, error) {
+	exchange, err := uc.keyExchangeRepo.GetByID(ctx, exchangeID)
+	if err != nil {
+		return nil, ErrKeyExchangeNotFound
+	}
 
-	hkdf := hkdf.New(sha256.New, sharedSecret, salt, info)
+	var counterpartID uint
+	switch userID {
+	case exchange.UserAID:
+		counterpartID = exchange.UserBID
+	case exchange.UserBID:
+		counterpartID = exchange.UserAID
+	default:
+		return nil, ErrNotKeyExchangeParticipant
+	}
+
+	if exchange.Status != entities.KeyExchangeStatusPending {
+		return nil, ErrKeyExchangeNotPending
+	}
 
-	// Деривируем 32 байта для AES-256 + 32 байта для HMAC-SHA256
-	keys := make([]byte, 64)
-	if _, err := hkdf.Read(keys); err != nil {
+	if err := uc.keyExchangeRepo.UpdateStatus(ctx, exchangeID, entities.KeyExchangeStatusCancelled); err != nil {
+		return nil, fmt.Errorf("failed to cancel key exchange: %v", err)
+	}
+	exchange.Status = entities.KeyExchangeStatusCancelled
+
+	if uc.notifier != nil {
+		username := exchange.UserA.Username
+		if userID == exchange.UserBID {
+			username = exchange.UserB.Username
+		}
+		uc.notifier.SendNotificationToUser(counterpartID, entities.NewKeyExchangeCancelledNotification(
+			fmt.Sprintf("%s cancelled the key exchange", username),
+			exchangeID, userID, username,
+		))
+	}
+
+	uc.logger.Info("Key exchange cancelled", "exchangeID", exchangeID, "userID", userID)
+	return exchange, nil
+}
+
+// deriveSessionKeys деривирует AES и HMAC ключи из общего секрета и соли сессии
+func (uc *KeyExchangeUseCase) deriveSessionKeys(sharedSecret, salt []byte) ([]byte, []byte, error) {
+	// Назначение сессионных ключей отличается от назначения ключей сообщений,
+	// поэтому транспортные ключи не совпадают с ключами сообщений даже из одного секрета
+	keys, err := crypto.DeriveSaltedKeys(sharedSecret, salt, crypto.PurposeSessionKeys)
+	if err != nil {
 		return nil, nil, err
 	}
 
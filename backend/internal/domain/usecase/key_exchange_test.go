@@ -0,0 +1,390 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"testing"
+	"time"
+)
+
+// fakeKeyExchangeUsers - репозиторий пользователей, знающий одного пользователя
+type fakeKeyExchangeUsers struct {
+	repository.UserRepository
+	user *entities.User
+}
+
+func (f *fakeKeyExchangeUsers) GetByID(ctx context.Context, id uint) (*entities.User, error) {
+	if f.user == nil || f.user.ID != id {
+		return nil, errors.New("not found")
+	}
+	return f.user, nil
+}
+
+// fakeSessions - репозиторий сессий, запоминающий созданную сессию
+type fakeSessions struct {
+	repository.SessionRepository
+	created *entities.Session
+}
+
+func (f *fakeSessions) Create(ctx context.Context, session *entities.Session) error {
+	f.created = session
+	return nil
+}
+
+func newTestKeyExchangeUseCase(sessions *fakeSessions) *KeyExchangeUseCase {
+	users := &fakeKeyExchangeUsers{user: &entities.User{ID: 1, Username: "alice"}}
+	return NewKeyExchangeUseCase(sessions, users, nil, &config.KeysConfig{KeyExchangeTTL: time.Hour}, logger.New(), nil)
+}
+
+func TestDeriveSessionKeysDependsOnSalt(t *testing.T) {
+	uc := &KeyExchangeUseCase{}
+	secret := bytes.Repeat([]byte{0x42}, 32)
+
+	aes1, hmac1, err := uc.deriveSessionKeys(secret, []byte("salt-one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aes2, hmac2, err := uc.deriveSessionKeys(secret, []byte("salt-two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(aes1, aes2) || bytes.Equal(hmac1, hmac2) {
+		t.Fatal("different salts produced the same session keys")
+	}
+
+	aes3, hmac3, err := uc.deriveSessionKeys(secret, []byte("salt-one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aes1, aes3) || !bytes.Equal(hmac1, hmac3) {
+		t.Fatal("same salt produced different session keys")
+	}
+	if len(aes1) != 32 || len(hmac1) != 32 {
+		t.Fatalf("key sizes = %d/%d, want 32/32", len(aes1), len(hmac1))
+	}
+}
+
+func TestInitiateKeyExchangeSalt(t *testing.T) {
+	tests := []struct {
+		name      string
+		saltAware bool
+	}{
+		{"legacy client", false},
+		{"salt-aware client", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessions{}
+			uc := newTestKeyExchangeUseCase(sessions)
+
+			clientPrivateKey, clientPublicKey, err := crypto.GenerateECDSAKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, info, err := uc.InitiateKeyExchange(context.Background(), &KeyExchangeRequest{
+				ClientPublicKey: hex.EncodeToString(clientPublicKey),
+				UserID:          1,
+				SaltAware:       tt.saltAware,
+			})
+			if err != nil {
+				t.Fatalf("InitiateKeyExchange: %v", err)
+			}
+			if sessions.created == nil || sessions.created.KeySalt != response.Salt {
+				t.Fatalf("stored salt does not match response salt %q", response.Salt)
+			}
+
+			// Клиент выводит тот же общий секрет и деривирует ключи с солью, которую ожидает
+			serverPublicKey, err := hex.DecodeString(response.ServerPublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sharedSecret, err := crypto.ComputeECDHSharedSecret(clientPrivateKey, serverPublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			salt := []byte(legacySessionSalt)
+			if tt.saltAware {
+				if len(response.Salt) != 2*sessionSaltSize {
+					t.Fatalf("salt = %q, want %d hex chars", response.Salt, 2*sessionSaltSize)
+				}
+				if salt, err = hex.DecodeString(response.Salt); err != nil {
+					t.Fatal(err)
+				}
+			} else if response.Salt != "" {
+				t.Fatalf("legacy client got salt %q", response.Salt)
+			}
+
+			aesKey, hmacKey, err := uc.deriveSessionKeys(sharedSecret, salt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(aesKey, info.AESKey) || !bytes.Equal(hmacKey, info.HMACKey) {
+				t.Fatal("client-derived keys differ from server session keys")
+			}
+		})
+	}
+}
+
+func TestInitiateKeyExchangeX25519(t *testing.T) {
+	sessions := &fakeSessions{}
+	uc := newTestKeyExchangeUseCase(sessions)
+
+	clientPrivateKey, clientPublicKey, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, info, err := uc.InitiateKeyExchange(context.Background(), &KeyExchangeRequest{
+		ClientPublicKey: hex.EncodeToString(clientPublicKey),
+		UserID:          1,
+		KeyType:         KeyTypeX25519,
+		SaltAware:       true,
+	})
+	if err != nil {
+		t.Fatalf("InitiateKeyExchange: %v", err)
+	}
+	if response.KeyType != KeyTypeX25519 {
+		t.Fatalf("key type = %q, want %q", response.KeyType, KeyTypeX25519)
+	}
+
+	serverPublicKey, err := hex.DecodeString(response.ServerPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedSecret, err := crypto.X25519SharedSecret(clientPrivateKey, serverPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt, err := hex.DecodeString(response.Salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aesKey, hmacKey, err := uc.deriveSessionKeys(sharedSecret, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aesKey, info.AESKey) || !bytes.Equal(hmacKey, info.HMACKey) {
+		t.Fatal("client-derived keys differ from server session keys")
+	}
+
+	// P-256 ключ не принимается как X25519
+	_, p256PublicKey, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = uc.InitiateKeyExchange(context.Background(), &KeyExchangeRequest{
+		ClientPublicKey: hex.EncodeToString(p256PublicKey),
+		UserID:          1,
+		KeyType:         KeyTypeX25519,
+	})
+	if !errors.Is(err, ErrInvalidClientPublicKey) {
+		t.Fatalf("P-256 key as X25519: err = %v, want %v", err, ErrInvalidClientPublicKey)
+	}
+}
+
+func TestInitiateKeyExchangeValidatesClientKey(t *testing.T) {
+	p384Key, err := ecdh.P384().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p256PublicKey, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offCurve := append([]byte{0x04}, bytes.Repeat([]byte{0x01}, 64)...)
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"garbage", "not a hex key", true},
+		{"empty", "", true},
+		{"point off the curve", hex.EncodeToString(offCurve), true},
+		{"wrong curve", hex.EncodeToString(p384Key.PublicKey().Bytes()), true},
+		{"valid P-256", hex.EncodeToString(p256PublicKey), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &fakeSessions{}
+			uc := newTestKeyExchangeUseCase(sessions)
+
+			_, _, err := uc.InitiateKeyExchange(context.Background(), &KeyExchangeRequest{ClientPublicKey: tt.key, UserID: 1})
+			if !tt.wantErr {
+				if err != nil || sessions.created == nil {
+					t.Fatalf("valid key: err = %v, session created = %v", err, sessions.created != nil)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidClientPublicKey) {
+				t.Fatalf("err = %v, want %v", err, ErrInvalidClientPublicKey)
+			}
+			if sessions.created != nil {
+				t.Fatal("session stored for a rejected key")
+			}
+		})
+	}
+}
+
+func TestInitiateKeyExchangeUsesConfiguredTTL(t *testing.T) {
+	sessions := &fakeSessions{}
+	uc := newTestKeyExchangeUseCase(sessions)
+
+	_, clientPublicKey, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if _, _, err := uc.InitiateKeyExchange(context.Background(), &KeyExchangeRequest{ClientPublicKey: hex.EncodeToString(clientPublicKey), UserID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	session := sessions.created
+	if session.ExpiresAt.Before(before.Add(time.Hour)) || session.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expires at %v, want about an hour from now", session.ExpiresAt)
+	}
+	if session.LastActivity.Before(before) {
+		t.Fatalf("last activity = %v, want the creation time", session.LastActivity)
+	}
+}
+
+func TestValidateSessionExpiry(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		expiresAt    time.Time
+		lastActivity time.Time
+		idleTimeout  time.Duration
+		wantErr      string
+	}{
+		{"active", now.Add(time.Hour), now.Add(-time.Minute), 30 * time.Minute, ""},
+		{"ttl expired", now.Add(-time.Second), now.Add(-time.Minute), 30 * time.Minute, "session expired"},
+		{"idle expired before ttl", now.Add(time.Hour), now.Add(-31 * time.Minute), 30 * time.Minute, "session idle timeout exceeded"},
+		{"idle timeout disabled", now.Add(time.Hour), now.Add(-31 * time.Minute), 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := newMemSessionRepo()
+			sessions.Create(context.Background(), &entities.Session{Token: "s1", UserID: 1, IsActive: true, ExpiresAt: tt.expiresAt, LastActivity: tt.lastActivity})
+			uc := NewKeyExchangeUseCase(sessions, &fakeKeyExchangeUsers{}, nil, &config.KeysConfig{KeyExchangeTTL: time.Hour, KeyExchangeIdleTimeout: tt.idleTimeout}, logger.New(), nil)
+
+			_, err := uc.ValidateSession(context.Background(), "s1")
+			stored, _ := sessions.GetByToken(context.Background(), "s1")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateSession: %v", err)
+				}
+				// Использование сессии сдвигает отсчет простоя
+				if !stored.LastActivity.After(tt.lastActivity) {
+					t.Fatalf("last activity = %v, want refreshed", stored.LastActivity)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("ValidateSession: err = %v, want %s", err, tt.wantErr)
+			}
+			if stored.IsActive {
+				t.Fatal("rejected session is still active")
+			}
+		})
+	}
+}
+
+// memKeyExchanges - хранилище обменов ключами между пользователями в памяти
+type memKeyExchanges struct {
+	repository.KeyExchangeRepository
+	exchanges map[uint]*entities.KeyExchange
+}
+
+func (r *memKeyExchanges) GetByID(ctx context.Context, id uint) (*entities.KeyExchange, error) {
+	exchange, ok := r.exchanges[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	copied := *exchange
+	return &copied, nil
+}
+
+func (r *memKeyExchanges) UpdateStatus(ctx context.Context, id uint, status string) error {
+	r.exchanges[id].Status = status
+	return nil
+}
+
+func TestCancelExchange(t *testing.T) {
+	newExchange := func() *entities.KeyExchange {
+		return &entities.KeyExchange{
+			ID: 7, UserAID: 1, UserBID: 2, Status: entities.KeyExchangeStatusPending,
+			UserA: entities.User{ID: 1, Username: "alice"}, UserB: entities.User{ID: 2, Username: "bob"},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		userID          uint
+		status          string
+		wantErr         error
+		wantCounterpart uint
+	}{
+		{"initiator cancels", 1, entities.KeyExchangeStatusPending, nil, 2},
+		{"recipient cancels", 2, entities.KeyExchangeStatusPending, nil, 1},
+		{"outsider", 3, entities.KeyExchangeStatusPending, ErrNotKeyExchangeParticipant, 0},
+		{"already active", 1, entities.KeyExchangeStatusActive, ErrKeyExchangeNotPending, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchange := newExchange()
+			exchange.Status = tt.status
+			exchanges := &memKeyExchanges{exchanges: map[uint]*entities.KeyExchange{7: exchange}}
+			uc := NewKeyExchangeUseCase(&fakeSessions{}, &fakeKeyExchangeUsers{}, exchanges, &config.KeysConfig{KeyExchangeTTL: time.Hour}, logger.New(), nil)
+			notifier := newRecordingNotifier()
+			uc.SetNotificationSender(notifier)
+
+			_, err := uc.CancelExchange(context.Background(), 7, tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if exchange.Status != tt.status {
+					t.Fatalf("status = %q after a rejected cancel, want %q", exchange.Status, tt.status)
+				}
+				if len(notifier.toUser) != 0 {
+					t.Fatalf("notifications sent after a rejected cancel: %v", notifier.toUser)
+				}
+				return
+			}
+
+			if exchange.Status != entities.KeyExchangeStatusCancelled {
+				t.Fatalf("status = %q, want %q", exchange.Status, entities.KeyExchangeStatusCancelled)
+			}
+			// Уведомление получает только второй участник
+			notifications := notifier.toUser[tt.wantCounterpart]
+			if len(notifications) != 1 || len(notifier.toUser) != 1 {
+				t.Fatalf("notifications = %v, want one for user %d", notifier.toUser, tt.wantCounterpart)
+			}
+			if n := notifications[0]; n.Type != entities.NotificationKeyExchangeCancelled || n.Data["cancelled_by"] != tt.userID {
+				t.Fatalf("notification = %+v", n)
+			}
+		})
+	}
+
+	uc := NewKeyExchangeUseCase(&fakeSessions{}, &fakeKeyExchangeUsers{}, &memKeyExchanges{}, &config.KeysConfig{}, logger.New(), nil)
+	if _, err := uc.CancelExchange(context.Background(), 99, 1); !errors.Is(err, ErrKeyExchangeNotFound) {
+		t.Fatalf("unknown exchange: err = %v, want %v", err, ErrKeyExchangeNotFound)
+	}
+}
@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/logger"
+)
+
+// Причины, по которым уведомление не было доставлено
+const (
+	NotificationFailureOffline    = "offline"
+	NotificationFailureSendFailed = "send_failed"
+)
+
+// NotificationQueue - хранит уведомления, которые не удалось доставить, до следующего подключения пользователя
+type NotificationQueue struct {
+	repo   repository.FailedNotificationRepository
+	logger *logger.Logger
+}
+
+// NewNotificationQueue - создает новый экземпляр очереди недоставленных уведомлений
+func NewNotificationQueue(repo repository.FailedNotificationRepository, logger *logger.Logger) *NotificationQueue {
+	return &NotificationQueue{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Store - сохраняет недоставленное уведомление пользователя. Ошибка записи только логируется:
+// потеря уведомления не должна прерывать действие, которое его вызвало
+func (q *NotificationQueue) Store(ctx context.Context, userID uint, notification *entities.Notification, reason string) bool {
+	if q == nil {
+		return false
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		q.logger.Errorf("Failed to marshal undeliverable %s notification for user %d: %v", notification.Type, userID, err)
+		return false
+	}
+
+	failed := &entities.FailedNotification{
+		UserID:  userID,
+		ChatID:  notification.ChatID,
+		Type:    notification.Type,
+		Payload: string(payload),
+		Reason:  reason,
+	}
+	if err := q.repo.Create(ctx, failed); err != nil {
+		q.logger.Errorf("Failed to store undeliverable %s notification for user %d: %v", notification.Type, userID, err)
+		return false
+	}
+
+	return true
+}
+
+// Take - забирает сохраненные уведомления пользователя в порядке записи; записи с поврежденным
+// содержимым пропускаются
+func (q *NotificationQueue) Take(ctx context.Context, userID uint) ([]*entities.Notification, error) {
+	if q == nil {
+		return nil, nil
+	}
+
+	failed, err := q.repo.TakeByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := make([]*entities.Notification, 0, len(failed))
+	for _, entry := range failed {
+		var notification entities.Notification
+		if err := json.Unmarshal([]byte(entry.Payload), &notification); err != nil {
+			q.logger.Errorf("Skipping corrupted stored notification %d for user %d: %v", entry.ID, userID, err)
+			continue
+		}
+		notifications = append(notifications, &notification)
+	}
+
+	return notifications, nil
+}
@@ -0,0 +1,170 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidReaction            = errors.New("reaction must contain either an emoji or an encrypted payload")
+	ErrEncryptedReactionsDisabled = errors.New("encrypted reactions are disabled on this server")
+	ErrReactionExists             = repository.ErrReactionExists
+	ErrReactionNotFound           = errors.New("reaction not found")
+)
+
+const (
+	// maxReactionEmojiLength - наибольшая длина открытой реакции в символах; эмодзи с модификаторами
+	// состоят из нескольких кодовых точек
+	maxReactionEmojiLength = 16
+	// maxReactionCiphertextLength - наибольший размер шифротекста зашифрованной реакции
+	maxReactionCiphertextLength = 1024
+)
+
+type ReactionUseCase struct {
+	reactionRepo       repository.ReactionRepository
+	messageRepo        repository.MessageRepository
+	chatRepo           repository.ChatRepository
+	encryptedReactions bool
+}
+
+// NewReactionUseCase - создает новый экземпляр сервиса реакций на сообщения
+func NewReactionUseCase(reactionRepo repository.ReactionRepository, messageRepo repository.MessageRepository, chatRepo repository.ChatRepository, cfg *config.ChatConfig) *ReactionUseCase {
+	return &ReactionUseCase{
+		reactionRepo:       reactionRepo,
+		messageRepo:        messageRepo,
+		chatRepo:           chatRepo,
+		encryptedReactions: cfg.EncryptedReactions,
+	}
+}
+
+// AddReactionRequest - реакция на сообщение: открытый Emoji либо зашифрованная на клиенте
+// реакция (Ciphertext, IV, HMAC). Зашифрованный режим доступен, только если он включен на сервере
+type AddReactionRequest struct {
+	Emoji      string `json:"emoji"`
+	Ciphertext string `json:"ciphertext"`
+	IV         string `json:"iv"`
+	HMAC       string `json:"hmac"`
+}
+
+// ReactionSummary - реакции на сообщение. Counts - число открытых реакций по эмодзи;
+// содержимое зашифрованных реакций сервер не знает, поэтому для них известно только общее
+// количество, а шифротексты передаются клиентам для расшифровки. Own - реакции текущего пользователя
+type ReactionSummary struct {
+	MessageID      uint                       `json:"message_id"`
+	Counts         map[string]int             `json:"counts"`
+	EncryptedCount int                        `json:"encrypted_count"`
+	Encrypted      []entities.MessageReaction `json:"encrypted"`
+	Own            []entities.MessageReaction `json:"own"`
+}
+
+// AddReaction - ставит реакцию участника чата на сообщение
+func (uc *ReactionUseCase) AddReaction(ctx context.Context, chatID, messageID, userID uint, req *AddReactionRequest) (*entities.MessageReaction, error) {
+	if err := uc.ensureMessage(ctx, chatID, messageID, userID); err != nil {
+		return nil, err
+	}
+
+	reaction := &entities.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+	}
+
+	switch {
+	case req.Ciphertext != "":
+		if !uc.encryptedReactions {
+			return nil, ErrEncryptedReactionsDisabled
+		}
+		if req.Emoji != "" || req.IV == "" || len(req.Ciphertext) > maxReactionCiphertextLength {
+			return nil, ErrInvalidReaction
+		}
+		reaction.Encrypted = true
+		reaction.Ciphertext = req.Ciphertext
+		reaction.IV = req.IV
+		reaction.HMAC = req.HMAC
+	case req.Emoji != "":
+		if !utf8.ValidString(req.Emoji) || utf8.RuneCountInString(req.Emoji) > maxReactionEmojiLength {
+			return nil, ErrInvalidReaction
+		}
+		reaction.Emoji = req.Emoji
+	default:
+		return nil, ErrInvalidReaction
+	}
+
+	if err := uc.reactionRepo.Create(ctx, reaction); err != nil {
+		if errors.Is(err, repository.ErrReactionExists) {
+			return nil, ErrReactionExists
+		}
+		return nil, fmt.Errorf("failed to save reaction: %v", err)
+	}
+
+	return reaction, nil
+}
+
+// RemoveReaction - удаляет реакцию пользователя; чужие реакции удалить нельзя
+func (uc *ReactionUseCase) RemoveReaction(ctx context.Context, chatID, messageID, reactionID, userID uint) error {
+	if err := uc.ensureMessage(ctx, chatID, messageID, userID); err != nil {
+		return err
+	}
+
+	deleted, err := uc.reactionRepo.Delete(ctx, reactionID, messageID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete reaction: %v", err)
+	}
+	if !deleted {
+		return ErrReactionNotFound
+	}
+	return nil
+}
+
+// GetReactions - возвращает сводку реакций на сообщение участнику чата
+func (uc *ReactionUseCase) GetReactions(ctx context.Context, chatID, messageID, userID uint) (*ReactionSummary, error) {
+	if err := uc.ensureMessage(ctx, chatID, messageID, userID); err != nil {
+		return nil, err
+	}
+
+	reactions, err := uc.reactionRepo.GetByMessage(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reactions: %v", err)
+	}
+
+	summary := &ReactionSummary{
+		MessageID: messageID,
+		Counts:    make(map[string]int),
+		Encrypted: []entities.MessageReaction{},
+		Own:       []entities.MessageReaction{},
+	}
+	for _, reaction := range reactions {
+		if reaction.Encrypted {
+			summary.EncryptedCount++
+			summary.Encrypted = append(summary.Encrypted, reaction)
+		} else {
+			summary.Counts[reaction.Emoji]++
+		}
+		if reaction.UserID == userID {
+			summary.Own = append(summary.Own, reaction)
+		}
+	}
+
+	return summary, nil
+}
+
+// ensureMessage - проверяет, что пользователь состоит в чате и сообщение принадлежит этому чату
+func (uc *ReactionUseCase) ensureMessage(ctx context.Context, chatID, messageID, userID uint) error {
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"testing"
+)
+
+// memReactionRepo - хранилище реакций в памяти; повтор открытой реакции отклоняется,
+// как уникальным индексом idx_message_reactions_plain
+type memReactionRepo struct {
+	reactions []entities.MessageReaction
+}
+
+func (r *memReactionRepo) Create(ctx context.Context, reaction *entities.MessageReaction) error {
+	for _, existing := range r.reactions {
+		if !reaction.Encrypted && !existing.Encrypted && existing.MessageID == reaction.MessageID &&
+			existing.UserID == reaction.UserID && existing.Emoji == reaction.Emoji {
+			return repository.ErrReactionExists
+		}
+	}
+	reaction.ID = uint(len(r.reactions) + 1)
+	r.reactions = append(r.reactions, *reaction)
+	return nil
+}
+
+func (r *memReactionRepo) Delete(ctx context.Context, id, messageID, userID uint) (bool, error) {
+	for i, existing := range r.reactions {
+		if existing.ID == id && existing.MessageID == messageID && existing.UserID == userID {
+			r.reactions = append(r.reactions[:i], r.reactions[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memReactionRepo) GetByMessage(ctx context.Context, messageID uint) ([]entities.MessageReaction, error) {
+	var reactions []entities.MessageReaction
+	for _, existing := range r.reactions {
+		if existing.MessageID == messageID {
+			reactions = append(reactions, existing)
+		}
+	}
+	return reactions, nil
+}
+
+// newTestReactionUseCase - чат 10 с участниками 1 и 2 и сообщением 1 в нем
+func newTestReactionUseCase(t *testing.T, encrypted bool) (*ReactionUseCase, *memReactionRepo) {
+	t.Helper()
+
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member"})
+	messages := &memMessageRepo{}
+	if err := messages.Create(context.Background(), &entities.Message{ChatID: 10, SenderID: 1, Content: "hi"}); err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	reactions := &memReactionRepo{}
+	return NewReactionUseCase(reactions, messages, chats, &config.ChatConfig{EncryptedReactions: encrypted}), reactions
+}
+
+func TestPlaintextReactions(t *testing.T) {
+	uc, repo := newTestReactionUseCase(t, false)
+	ctx := context.Background()
+
+	for _, userID := range []uint{1, 2} {
+		if _, err := uc.AddReaction(ctx, 10, 1, userID, &AddReactionRequest{Emoji: "👍"}); err != nil {
+			t.Fatalf("user %d reaction: %v", userID, err)
+		}
+	}
+	if _, err := uc.AddReaction(ctx, 10, 1, 2, &AddReactionRequest{Emoji: "🔥"}); err != nil {
+		t.Fatalf("second emoji: %v", err)
+	}
+
+	if _, err := uc.AddReaction(ctx, 10, 1, 1, &AddReactionRequest{Emoji: "👍"}); !errors.Is(err, ErrReactionExists) {
+		t.Fatalf("repeated reaction err = %v, want %v", err, ErrReactionExists)
+	}
+	// Зашифрованный режим выключен: шифротекст не принимается
+	if _, err := uc.AddReaction(ctx, 10, 1, 1, &AddReactionRequest{Ciphertext: "c", IV: "iv"}); !errors.Is(err, ErrEncryptedReactionsDisabled) {
+		t.Fatalf("encrypted reaction err = %v, want %v", err, ErrEncryptedReactionsDisabled)
+	}
+
+	stored := repo.reactions[0]
+	if stored.Encrypted || stored.Emoji != "👍" || stored.Ciphertext != "" {
+		t.Fatalf("stored reaction = %+v, want plaintext 👍", stored)
+	}
+
+	summary, err := uc.GetReactions(ctx, 10, 1, 2)
+	if err != nil {
+		t.Fatalf("GetReactions: %v", err)
+	}
+	if summary.Counts["👍"] != 2 || summary.Counts["🔥"] != 1 || len(summary.Counts) != 2 {
+		t.Fatalf("counts = %v, want 👍:2 🔥:1", summary.Counts)
+	}
+	if summary.EncryptedCount != 0 || len(summary.Encrypted) != 0 {
+		t.Fatalf("encrypted = %d %v, want none", summary.EncryptedCount, summary.Encrypted)
+	}
+	if len(summary.Own) != 2 {
+		t.Fatalf("own reactions = %d, want 2", len(summary.Own))
+	}
+}
+
+func TestEncryptedReactions(t *testing.T) {
+	uc, repo := newTestReactionUseCase(t, true)
+	ctx := context.Background()
+
+	// Одинаковые шифротексты сервер не сравнивает: обе реакции сохраняются
+	for i := 0; i < 2; i++ {
+		if _, err := uc.AddReaction(ctx, 10, 1, 1, &AddReactionRequest{Ciphertext: "c1", IV: "iv1", HMAC: "m1"}); err != nil {
+			t.Fatalf("encrypted reaction %d: %v", i, err)
+		}
+	}
+	if _, err := uc.AddReaction(ctx, 10, 1, 2, &AddReactionRequest{Emoji: "👍"}); err != nil {
+		t.Fatalf("plaintext reaction alongside encrypted: %v", err)
+	}
+
+	invalid := []*AddReactionRequest{
+		{Ciphertext: "c"},
+		{Ciphertext: "c", IV: "iv", Emoji: "👍"},
+		{},
+	}
+	for _, req := range invalid {
+		if _, err := uc.AddReaction(ctx, 10, 1, 1, req); !errors.Is(err, ErrInvalidReaction) {
+			t.Fatalf("AddReaction(%+v) err = %v, want %v", req, err, ErrInvalidReaction)
+		}
+	}
+
+	stored := repo.reactions[0]
+	if !stored.Encrypted || stored.Emoji != "" || stored.Ciphertext != "c1" || stored.IV != "iv1" || stored.HMAC != "m1" {
+		t.Fatalf("stored reaction = %+v, want ciphertext only", stored)
+	}
+
+	summary, err := uc.GetReactions(ctx, 10, 1, 2)
+	if err != nil {
+		t.Fatalf("GetReactions: %v", err)
+	}
+	if summary.EncryptedCount != 2 || len(summary.Encrypted) != 2 {
+		t.Fatalf("encrypted = %d %v, want 2", summary.EncryptedCount, summary.Encrypted)
+	}
+	if summary.Encrypted[0].Ciphertext != "c1" || summary.Encrypted[0].IV != "iv1" {
+		t.Fatalf("encrypted payload = %+v, want c1/iv1", summary.Encrypted[0])
+	}
+	// Зашифрованные реакции не попадают в счетчики по эмодзи
+	if summary.Counts["👍"] != 1 || len(summary.Counts) != 1 {
+		t.Fatalf("counts = %v, want 👍:1", summary.Counts)
+	}
+}
+
+func TestRemoveReactionOnlyOwn(t *testing.T) {
+	uc, repo := newTestReactionUseCase(t, false)
+	ctx := context.Background()
+
+	reaction, err := uc.AddReaction(ctx, 10, 1, 1, &AddReactionRequest{Emoji: "👍"})
+	if err != nil {
+		t.Fatalf("AddReaction: %v", err)
+	}
+
+	if err := uc.RemoveReaction(ctx, 10, 1, reaction.ID, 2); !errors.Is(err, ErrReactionNotFound) {
+		t.Fatalf("foreign remove err = %v, want %v", err, ErrReactionNotFound)
+	}
+	if err := uc.RemoveReaction(ctx, 10, 1, reaction.ID, 1); err != nil {
+		t.Fatalf("own remove: %v", err)
+	}
+	if len(repo.reactions) != 0 {
+		t.Fatalf("reactions left = %d, want 0", len(repo.reactions))
+	}
+
+	// Посторонний пользователь не видит реакций чата
+	if _, err := uc.GetReactions(ctx, 10, 1, 3); !errors.Is(err, ErrNotChatMember) {
+		t.Fatalf("non-member err = %v, want %v", err, ErrNotChatMember)
+	}
+}
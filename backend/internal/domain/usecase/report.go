@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidReportReason  = errors.New("report reason must be between 1 and 500 characters")
+	ErrCannotReportOwn      = errors.New("cannot report your own message")
+	ErrAlreadyReported      = repository.ErrReportExists
+	ErrReportNotFound       = errors.New("report not found")
+	ErrInvalidReportStatus  = errors.New("invalid report status")
+	ErrSystemMessageReports = errors.New("system messages cannot be reported")
+)
+
+// maxReportReasonLength - наибольшая длина причины жалобы в символах
+const maxReportReasonLength = 500
+
+type ReportUseCase struct {
+	reportRepo  repository.ReportRepository
+	messageRepo repository.MessageRepository
+	chatRepo    repository.ChatRepository
+}
+
+// NewReportUseCase - создает новый экземпляр сервиса жалоб на сообщения
+func NewReportUseCase(reportRepo repository.ReportRepository, messageRepo repository.MessageRepository, chatRepo repository.ChatRepository) *ReportUseCase {
+	return &ReportUseCase{
+		reportRepo:  reportRepo,
+		messageRepo: messageRepo,
+		chatRepo:    chatRepo,
+	}
+}
+
+type ReportMessageRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type UpdateReportStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// ReportPage - страница жалоб; Total - число всех жалоб с выбранным статусом
+type ReportPage struct {
+	Reports []entities.MessageReport
+	Total   int64
+	HasMore bool
+}
+
+// ReportMessage - сохраняет жалобу участника чата на сообщение другого пользователя
+func (uc *ReportUseCase) ReportMessage(ctx context.Context, chatID, messageID, reporterID uint, req *ReportMessageRequest) (*entities.MessageReport, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" || !utf8.ValidString(reason) || utf8.RuneCountInString(reason) > maxReportReasonLength {
+		return nil, ErrInvalidReportReason
+	}
+
+	isMember, err := uc.chatRepo.IsMember(ctx, chatID, reporterID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, ErrNotChatMember
+	}
+
+	message, err := uc.messageRepo.GetByID(ctx, messageID)
+	if err != nil || message.ChatID != chatID {
+		return nil, ErrMessageNotFound
+	}
+	if message.MessageType == "system" {
+		return nil, ErrSystemMessageReports
+	}
+	if message.SenderID == reporterID {
+		return nil, ErrCannotReportOwn
+	}
+
+	report := &entities.MessageReport{
+		MessageID:  messageID,
+		ReporterID: reporterID,
+		ChatID:     chatID,
+		Reason:     reason,
+		Status:     entities.ReportStatusOpen,
+	}
+	if err := uc.reportRepo.Create(ctx, report); err != nil {
+		if errors.Is(err, repository.ErrReportExists) {
+			return nil, ErrAlreadyReported
+		}
+		return nil, fmt.Errorf("failed to save report: %v", err)
+	}
+
+	return report, nil
+}
+
+// ListReports - возвращает жалобы для администратора, начиная с самых новых; пустой status - все жалобы
+func (uc *ReportUseCase) ListReports(ctx context.Context, status string, limit, offset int) (*ReportPage, error) {
+	if status != "" && !validReportStatus(status) {
+		return nil, ErrInvalidReportStatus
+	}
+
+	reports, total, err := uc.reportRepo.List(ctx, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %v", err)
+	}
+
+	return &ReportPage{
+		Reports: reports,
+		Total:   total,
+		HasMore: int64(offset+len(reports)) < total,
+	}, nil
+}
+
+// UpdateReportStatus - меняет статус жалобы по результатам проверки
+func (uc *ReportUseCase) UpdateReportStatus(ctx context.Context, reportID uint, status string) error {
+	if !validReportStatus(status) {
+		return ErrInvalidReportStatus
+	}
+
+	updated, err := uc.reportRepo.UpdateStatus(ctx, reportID, status)
+	if err != nil {
+		return fmt.Errorf("failed to update report: %v", err)
+	}
+	if !updated {
+		return ErrReportNotFound
+	}
+	return nil
+}
+
+// validReportStatus - проверяет, что статус жалобы известен
+func validReportStatus(status string) bool {
+	switch status {
+	case entities.ReportStatusOpen, entities.ReportStatusResolved, entities.ReportStatusDismissed:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"testing"
+)
+
+// memReportRepo - хранилище жалоб в памяти; повторная жалоба отклоняется, как уникальным
+// индексом idx_reports_message_reporter
+type memReportRepo struct {
+	reports []entities.MessageReport
+}
+
+func (r *memReportRepo) Create(ctx context.Context, report *entities.MessageReport) error {
+	for _, existing := range r.reports {
+		if existing.MessageID == report.MessageID && existing.ReporterID == report.ReporterID {
+			return repository.ErrReportExists
+		}
+	}
+	report.ID = uint(len(r.reports) + 1)
+	r.reports = append(r.reports, *report)
+	return nil
+}
+
+// List - жалобы от новых к старым, как в репозитории
+func (r *memReportRepo) List(ctx context.Context, status string, limit, offset int) ([]entities.MessageReport, int64, error) {
+	var reports []entities.MessageReport
+	for i := len(r.reports) - 1; i >= 0; i-- {
+		if status == "" || r.reports[i].Status == status {
+			reports = append(reports, r.reports[i])
+		}
+	}
+	total := int64(len(reports))
+	reports = reports[min(offset, len(reports)):min(offset+limit, len(reports))]
+	return reports, total, nil
+}
+
+func (r *memReportRepo) UpdateStatus(ctx context.Context, id uint, status string) (bool, error) {
+	for i := range r.reports {
+		if r.reports[i].ID == id {
+			r.reports[i].Status = status
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestReportMessageByAnyMember(t *testing.T) {
+	chats := newMemChatRepo(&memUserRepo{users: map[uint]*entities.User{}})
+	chats.addChat(&entities.Chat{ID: 10, IsGroup: true, CreatedBy: 1}, map[uint]string{1: "admin", 2: "member", 3: "member"})
+	messages := &memMessageRepo{}
+	ctx := context.Background()
+	if err := messages.Create(ctx, &entities.Message{ChatID: 10, SenderID: 1, Content: "spam", MessageType: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := messages.Create(ctx, &entities.Message{ChatID: 10, SenderID: 1, Content: "joined", MessageType: "system"}); err != nil {
+		t.Fatal(err)
+	}
+	reports := &memReportRepo{}
+	uc := NewReportUseCase(reports, messages, chats)
+
+	// Жаловаться может любой участник, а не только администратор чата
+	for _, reporterID := range []uint{2, 3} {
+		report, err := uc.ReportMessage(ctx, 10, 1, reporterID, &ReportMessageRequest{Reason: "  spam  "})
+		if err != nil {
+			t.Fatalf("member %d report: %v", reporterID, err)
+		}
+		if report.Status != entities.ReportStatusOpen || report.Reason != "spam" || report.ChatID != 10 {
+			t.Fatalf("report = %+v, want open report with reason spam in chat 10", report)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		messageID  uint
+		reporterID uint
+		reason     string
+		want       error
+	}{
+		{"repeated report", 1, 2, "spam", ErrAlreadyReported},
+		{"own message", 1, 1, "spam", ErrCannotReportOwn},
+		{"non-member", 1, 4, "spam", ErrNotChatMember},
+		{"system message", 2, 2, "spam", ErrSystemMessageReports},
+		{"missing message", 99, 2, "spam", ErrMessageNotFound},
+		{"blank reason", 1, 3, "   ", ErrInvalidReportReason},
+	}
+	for _, tt := range tests {
+		if _, err := uc.ReportMessage(ctx, 10, tt.messageID, tt.reporterID, &ReportMessageRequest{Reason: tt.reason}); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(reports.reports) != 2 {
+		t.Fatalf("%d reports stored, want 2", len(reports.reports))
+	}
+}
+
+func TestListReportsForAdmins(t *testing.T) {
+	reports := &memReportRepo{}
+	ctx := context.Background()
+	for reporterID := uint(1); reporterID <= 3; reporterID++ {
+		report := &entities.MessageReport{MessageID: 1, ReporterID: reporterID, ChatID: 10, Reason: "spam", Status: entities.ReportStatusOpen}
+		if err := reports.Create(ctx, report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uc := NewReportUseCase(reports, nil, nil)
+
+	if err := uc.UpdateReportStatus(ctx, 1, entities.ReportStatusResolved); err != nil {
+		t.Fatalf("UpdateReportStatus: %v", err)
+	}
+
+	page, err := uc.ListReports(ctx, "", 2, 0)
+	if err != nil {
+		t.Fatalf("ListReports: %v", err)
+	}
+	if page.Total != 3 || !page.HasMore || len(page.Reports) != 2 || page.Reports[0].ID != 3 {
+		t.Fatalf("first page = %d reports of %d (more %v), first %d; want 2 of 3 starting with 3", len(page.Reports), page.Total, page.HasMore, page.Reports[0].ID)
+	}
+
+	open, err := uc.ListReports(ctx, entities.ReportStatusOpen, 10, 0)
+	if err != nil {
+		t.Fatalf("ListReports(open): %v", err)
+	}
+	if open.Total != 2 || open.HasMore {
+		t.Fatalf("open reports = %d (more %v), want 2", open.Total, open.HasMore)
+	}
+
+	if _, err := uc.ListReports(ctx, "bogus", 10, 0); !errors.Is(err, ErrInvalidReportStatus) {
+		t.Fatalf("unknown status err = %v, want %v", err, ErrInvalidReportStatus)
+	}
+	if err := uc.UpdateReportStatus(ctx, 99, entities.ReportStatusDismissed); !errors.Is(err, ErrReportNotFound) {
+		t.Fatalf("missing report err = %v, want %v", err, ErrReportNotFound)
+	}
+}
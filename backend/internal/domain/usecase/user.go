@@ -1,14 +1,24 @@
 package usecase
 
 import (
+	"context"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
 	"errors"
 	"strings"
 )
 
+// MaxUserLookupBatch - сколько пользователей можно запросить по ID за один вызов
+const MaxUserLookupBatch = 100
+
+var (
+	ErrTooManyUserIDs  = errors.New("too many user IDs requested")
+	ErrCannotBlockSelf = errors.New("cannot block yourself")
+)
+
 type UserUseCase struct {
 	userRepo repository.UserRepository
+	presence PresenceTracker
 }
 
 // NewUserUseCase - создает новый экземпляр сервиса для работы с пользователями
@@ -21,12 +31,19 @@ func NewUserUseCase(userRepo repository.UserRepository) *UserUseCase {
 type SearchUsersRequest struct {
 	Query  string `json:"query" binding:"required,min=1"`
 	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
 	UserID uint   `json:"-"`
 }
 
+// SearchUsersResponse - страница результатов поиска. Users дублирует Data для старых клиентов,
+// Total - число всех найденных пользователей, а не только текущей страницы
 type SearchUsersResponse struct {
-	Users []UserSearchResult `json:"users"`
-	Total int                `json:"total"`
+	Data    []UserSearchResult `json:"data"`
+	Users   []UserSearchResult `json:"users"`
+	Total   int64              `json:"total"`
+	Limit   int                `json:"limit"`
+	Offset  int                `json:"offset"`
+	HasMore bool               `json:"has_more"`
 }
 
 type UserSearchResult struct {
@@ -37,7 +54,7 @@ type UserSearchResult struct {
 }
 
 // SearchUsers - осуществляет поиск пользователей по запросу
-func (uc *UserUseCase) SearchUsers(req SearchUsersRequest) (*SearchUsersResponse, error) {
+func (uc *UserUseCase) SearchUsers(ctx context.Context, req SearchUsersRequest) (*SearchUsersResponse, error) {
 	if strings.TrimSpace(req.Query) == "" {
 		return nil, errors.New("поисковый запрос не может быть пустым")
 	}
@@ -46,9 +63,18 @@ func (uc *UserUseCase) SearchUsers(req SearchUsersRequest) (*SearchUsersResponse
 		req.Limit = 10
 	}
 
+	if req.Offset < 0 {
+		req.Offset = 0
+	}
+
 	query := strings.TrimSpace(req.Query)
 
-	users, err := uc.userRepo.SearchUsers(query, req.UserID, req.Limit)
+	users, err := uc.userRepo.SearchUsers(ctx, query, req.UserID, req.Limit, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := uc.userRepo.CountSearchUsers(ctx, query, req.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -64,22 +90,80 @@ func (uc *UserUseCase) SearchUsers(req SearchUsersRequest) (*SearchUsersResponse
 	}
 
 	return &SearchUsersResponse{
-		Users: searchResults,
-		Total: len(searchResults),
+		Data:    searchResults,
+		Users:   searchResults,
+		Total:   total,
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+		HasMore: int64(req.Offset+len(searchResults)) < total,
 	}, nil
 }
 
 // GetUserByID - получает данные пользователя по его идентификатору
-func (uc *UserUseCase) GetUserByID(userID uint) (*entities.User, error) {
-	return uc.userRepo.GetByID(userID)
+func (uc *UserUseCase) GetUserByID(ctx context.Context, userID uint) (*entities.User, error) {
+	return uc.userRepo.GetByID(ctx, userID)
+}
+
+// GetUsersByIDs - получает пользователей по списку ID; повторы схлопываются, несуществующие ID
+// в результат не попадают
+func (uc *UserUseCase) GetUsersByIDs(ctx context.Context, userIDs []uint) ([]entities.User, error) {
+	seen := make(map[uint]bool, len(userIDs))
+	unique := make([]uint, 0, len(userIDs))
+	for _, id := range userIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	if len(unique) > MaxUserLookupBatch {
+		return nil, ErrTooManyUserIDs
+	}
+
+	return uc.userRepo.GetByIDs(ctx, unique)
 }
 
 // GetUserByUsername - получает данные пользователя по имени пользователя
-func (uc *UserUseCase) GetUserByUsername(username string) (*entities.User, error) {
-	return uc.userRepo.GetByUsername(username)
+func (uc *UserUseCase) GetUserByUsername(ctx context.Context, username string) (*entities.User, error) {
+	return uc.userRepo.GetByUsername(ctx, username)
+}
+
+// SetPresenceTracker - подключает источник фактического статуса подключения пользователей
+func (uc *UserUseCase) SetPresenceTracker(presence PresenceTracker) {
+	uc.presence = presence
+}
+
+// GetContacts - получает пользователей, с которыми у пользователя есть общие чаты. Статус в сети
+// берется из хаба, как в ChatUseCase: флаг в БД не обновляется при подключении и отключении WebSocket
+func (uc *UserUseCase) GetContacts(ctx context.Context, userID uint) ([]entities.Contact, error) {
+	contacts, err := uc.userRepo.GetContacts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range contacts {
+		contacts[i].IsOnline = uc.presence != nil && uc.presence.IsUserOnline(contacts[i].UserID)
+	}
+	return contacts, nil
+}
+
+// BlockUser - блокирует пользователя: после этого ни один из двоих не видит другого в контактах
+func (uc *UserUseCase) BlockUser(ctx context.Context, blockerID, blockedID uint) error {
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+	if _, err := uc.userRepo.GetByID(ctx, blockedID); err != nil {
+		return ErrUserNotFound
+	}
+	return uc.userRepo.BlockUser(ctx, blockerID, blockedID)
+}
+
+// UnblockUser - снимает блокировку, установленную blockerID
+func (uc *UserUseCase) UnblockUser(ctx context.Context, blockerID, blockedID uint) error {
+	return uc.userRepo.UnblockUser(ctx, blockerID, blockedID)
 }
 
 // GetOnlineUsers - получает список всех пользователей, находящихся в сети
-func (uc *UserUseCase) GetOnlineUsers() ([]entities.User, error) {
-	return uc.userRepo.GetOnlineUsers()
+func (uc *UserUseCase) GetOnlineUsers(ctx context.Context) ([]entities.User, error) {
+	return uc.userRepo.GetOnlineUsers(ctx)
 }
@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"strings"
+	"testing"
+)
+
+// searchableUsers - репозиторий пользователей, выполняющий поиск по подстроке имени
+type searchableUsers struct {
+	repository.UserRepository
+	users []entities.User
+}
+
+func (r *searchableUsers) matching(query string, excludeUserID uint) []entities.User {
+	var result []entities.User
+	for _, user := range r.users {
+		if user.ID != excludeUserID && strings.Contains(user.Username, query) {
+			result = append(result, user)
+		}
+	}
+	return result
+}
+
+func (r *searchableUsers) SearchUsers(ctx context.Context, query string, excludeUserID uint, limit, offset int) ([]entities.User, error) {
+	matched := r.matching(query, excludeUserID)
+	if offset >= len(matched) {
+		return nil, nil
+	}
+	return matched[offset:min(offset+limit, len(matched))], nil
+}
+
+func (r *searchableUsers) CountSearchUsers(ctx context.Context, query string, excludeUserID uint) (int64, error) {
+	return int64(len(r.matching(query, excludeUserID))), nil
+}
+
+func TestSearchUsersPagination(t *testing.T) {
+	repo := &searchableUsers{}
+	for i := 1; i <= 26; i++ {
+		repo.users = append(repo.users, entities.User{ID: uint(i), Username: fmt.Sprintf("user%02d", i)})
+	}
+	uc := NewUserUseCase(repo)
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		wantUsers     int
+		wantHasMore   bool
+	}{
+		{"first page", 10, 0, 10, true},
+		{"middle page", 10, 10, 10, true},
+		{"last page", 10, 20, 5, false},
+		{"page ends exactly at total", 5, 20, 5, false},
+		{"offset past total", 10, 40, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Сам пользователь исключается из поиска: найдено 25 из 26
+			resp, err := uc.SearchUsers(context.Background(), SearchUsersRequest{Query: "user", Limit: tt.limit, Offset: tt.offset, UserID: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Data) != tt.wantUsers || resp.HasMore != tt.wantHasMore {
+				t.Fatalf("users = %d, has_more = %v; want %d, %v", len(resp.Data), resp.HasMore, tt.wantUsers, tt.wantHasMore)
+			}
+			if resp.Total != 25 || resp.Limit != tt.limit || resp.Offset != tt.offset {
+				t.Fatalf("total/limit/offset = %d/%d/%d, want 25/%d/%d", resp.Total, resp.Limit, resp.Offset, tt.limit, tt.offset)
+			}
+			if len(resp.Users) != len(resp.Data) {
+				t.Fatalf("users = %d, data = %d; legacy field must mirror data", len(resp.Users), len(resp.Data))
+			}
+		})
+	}
+}
+
+func TestGetUsersByIDsBatch(t *testing.T) {
+	uc := NewUserUseCase(&memUserRepo{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		2: {ID: 2, Username: "bob"},
+	}})
+
+	users, err := uc.GetUsersByIDs(context.Background(), []uint{1, 2, 2, 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("got %d users, want 2 (duplicates collapsed, missing ID absent)", len(users))
+	}
+
+	ids := make([]uint, MaxUserLookupBatch+1)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	if _, err := uc.GetUsersByIDs(context.Background(), ids); !errors.Is(err, ErrTooManyUserIDs) {
+		t.Fatalf("oversized batch: err = %v, want %v", err, ErrTooManyUserIDs)
+	}
+}
+
+// contactUsers - репозиторий с готовым списком контактов и блокировками в памяти
+type contactUsers struct {
+	repository.UserRepository
+	users    map[uint]*entities.User
+	contacts []entities.Contact
+	blocks   map[[2]uint]bool
+}
+
+func (r *contactUsers) GetByID(ctx context.Context, id uint) (*entities.User, error) {
+	if user, ok := r.users[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("record not found")
+}
+
+// GetContacts - как запрос репозитория: контакт пропадает при блокировке в любую сторону
+func (r *contactUsers) GetContacts(ctx context.Context, userID uint) ([]entities.Contact, error) {
+	var contacts []entities.Contact
+	for _, contact := range r.contacts {
+		if !r.blocks[[2]uint{userID, contact.UserID}] && !r.blocks[[2]uint{contact.UserID, userID}] {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts, nil
+}
+
+func (r *contactUsers) BlockUser(ctx context.Context, blockerID, blockedID uint) error {
+	r.blocks[[2]uint{blockerID, blockedID}] = true
+	return nil
+}
+
+func (r *contactUsers) UnblockUser(ctx context.Context, blockerID, blockedID uint) error {
+	delete(r.blocks, [2]uint{blockerID, blockedID})
+	return nil
+}
+
+// onlineSet - хаб, в котором подключены перечисленные пользователи
+type onlineSet map[uint]bool
+
+func (s onlineSet) IsUserOnline(userID uint) bool { return s[userID] }
+
+func TestGetContactsUsesHubPresenceAndBlocks(t *testing.T) {
+	repo := &contactUsers{
+		users: map[uint]*entities.User{1: {ID: 1}, 2: {ID: 2}, 3: {ID: 3}},
+		// Флаг из БД устарел: пользователь 2 давно отключился, а 3 подключен
+		contacts: []entities.Contact{{UserID: 2, Username: "bob", IsOnline: true}, {UserID: 3, Username: "carol"}},
+		blocks:   map[[2]uint]bool{},
+	}
+	uc := NewUserUseCase(repo)
+	uc.SetPresenceTracker(onlineSet{3: true})
+	ctx := context.Background()
+
+	contacts, err := uc.GetContacts(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contacts) != 2 || contacts[0].IsOnline || !contacts[1].IsOnline {
+		t.Fatalf("contacts = %+v, want bob offline and carol online", contacts)
+	}
+
+	// Carol блокирует пользователя 1: он больше не видит ее в контактах
+	if err := uc.BlockUser(ctx, 3, 1); err != nil {
+		t.Fatalf("BlockUser: %v", err)
+	}
+	contacts, _ = uc.GetContacts(ctx, 1)
+	if len(contacts) != 1 || contacts[0].UserID != 2 {
+		t.Fatalf("contacts after block = %+v, want only bob", contacts)
+	}
+	if err := uc.UnblockUser(ctx, 3, 1); err != nil {
+		t.Fatalf("UnblockUser: %v", err)
+	}
+	if contacts, _ = uc.GetContacts(ctx, 1); len(contacts) != 2 {
+		t.Fatalf("contacts after unblock = %+v, want both", contacts)
+	}
+
+	if err := uc.BlockUser(ctx, 1, 1); !errors.Is(err, ErrCannotBlockSelf) {
+		t.Fatalf("block self: err = %v, want %v", err, ErrCannotBlockSelf)
+	}
+	if err := uc.BlockUser(ctx, 1, 99); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("block unknown user: err = %v, want %v", err, ErrUserNotFound)
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+
+	"gorm.io/gorm"
+)
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+// NewAttachmentRepository - создает новый экземпляр репозитория вложений
+func NewAttachmentRepository(db *gorm.DB) repository.AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+// Create - сохраняет вложение в базе данных
+func (r *attachmentRepository) Create(ctx context.Context, attachment *entities.Attachment) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(attachment).Error
+	})
+}
+
+// GetByID - получает вложение вместе с содержимым файла
+func (r *attachmentRepository) GetByID(ctx context.Context, id uint) (*entities.Attachment, error) {
+	var attachment entities.Attachment
+	err := r.db.WithContext(ctx).First(&attachment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetThumbnail - получает вложение без содержимого файла, только с миниатюрой
+func (r *attachmentRepository) GetThumbnail(ctx context.Context, id uint) (*entities.Attachment, error) {
+	var attachment entities.Attachment
+	err := r.db.WithContext(ctx).Omit("data").First(&attachment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+
+	"gorm.io/gorm"
+)
+
+type auditLogRepository struct {
+	db *gorm.DB
+}
+
+// NewAuditLogRepository - создает новый экземпляр репозитория журнала аудита
+func NewAuditLogRepository(db *gorm.DB) repository.AuditLogRepository {
+	return &auditLogRepository{db: db}
+}
+
+// Create - сохраняет запись журнала аудита
+func (r *auditLogRepository) Create(ctx context.Context, entry *entities.AuditLog) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(entry).Error
+	})
+}
+
+// GetByUser - получает события пользователя, начиная с самых новых
+func (r *auditLogRepository) GetByUser(ctx context.Context, userID uint, limit, offset int) ([]entities.AuditLog, error) {
+	var entries []entities.AuditLog
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&entries).Error
+	return entries, err
+}
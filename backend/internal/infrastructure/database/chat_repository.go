@@ -1,10 +1,13 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type chatRepository struct {
@@ -17,61 +20,194 @@ func NewChatRepository(db *gorm.DB) repository.ChatRepository {
 }
 
 // Create - создает новый чат в базе данных
-func (r *chatRepository) Create(chat *entities.Chat) error {
-	return r.db.Create(chat).Error
+func (r *chatRepository) Create(ctx context.Context, chat *entities.Chat) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(chat).Error
+	})
+}
+
+// CreateWithMembers - создает чат и добавляет участников в одной транзакции; для приватного
+// чата, пара участников которого уже занята, возвращает repository.ErrPrivateChatExists
+func (r *chatRepository) CreateWithMembers(ctx context.Context, chat *entities.Chat, members []entities.ChatMember) error {
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(chat).Error; err != nil {
+				return err
+			}
+
+			if len(members) == 0 {
+				return nil
+			}
+
+			for i := range members {
+				members[i].ChatID = chat.ID
+			}
+
+			return tx.Create(&members).Error
+		})
+	})
+	if chat.PairKey != nil && errors.Is(err, gorm.ErrDuplicatedKey) {
+		return repository.ErrPrivateChatExists
+	}
+	return err
 }
 
 // GetByID - получает чат по его ID с загрузкой создателя и участников
-func (r *chatRepository) GetByID(id uint) (*entities.Chat, error) {
+func (r *chatRepository) GetByID(ctx context.Context, id uint) (*entities.Chat, error) {
 	var chat entities.Chat
-	err := r.db.Preload("Creator").Preload("Members").First(&chat, id).Error
+	err := r.db.WithContext(ctx).Preload("Creator").Preload("Members").First(&chat, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &chat, nil
 }
 
-// GetUserChats - получает все чаты пользователя
-func (r *chatRepository) GetUserChats(userID uint) ([]entities.Chat, error) {
+// GetUserChats - получает чаты пользователя; архивированные включаются только по запросу
+func (r *chatRepository) GetUserChats(ctx context.Context, userID uint, includeArchived bool) ([]entities.Chat, error) {
 	var chats []entities.Chat
-	err := r.db.
+	query := r.db.WithContext(ctx).
 		Preload("Creator").
 		Preload("Members").
 		Joins("JOIN chat_members ON chats.id = chat_members.chat_id").
-		Where("chat_members.user_id = ?", userID).
-		Find(&chats).Error
+		Where("chat_members.user_id = ?", userID)
+	if !includeArchived {
+		query = query.Where("chat_members.archived = ?", false)
+	}
+	err := query.Find(&chats).Error
 	return chats, err
 }
 
+// GetArchivedChatIDs - получает ID чатов, архивированных пользователем
+func (r *chatRepository) GetArchivedChatIDs(ctx context.Context, userID uint) ([]uint, error) {
+	var chatIDs []uint
+	err := r.db.WithContext(ctx).Model(&entities.ChatMember{}).
+		Where("user_id = ? AND archived = ?", userID, true).
+		Pluck("chat_id", &chatIDs).Error
+	return chatIDs, err
+}
+
+// SetArchived - архивирует чат для участника или возвращает его из архива
+func (r *chatRepository) SetArchived(ctx context.Context, chatID, userID uint, archived bool) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.ChatMember{}).
+			Where("chat_id = ? AND user_id = ?", chatID, userID).
+			Update("archived", archived).
+			Error
+	})
+}
+
+// UnarchiveForAll - возвращает чат из архива всех участников
+func (r *chatRepository) UnarchiveForAll(ctx context.Context, chatID uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.ChatMember{}).
+			Where("chat_id = ? AND archived = ?", chatID, true).
+			Update("archived", false).
+			Error
+	})
+}
+
 // Update - обновляет данные чата в базе данных
-func (r *chatRepository) Update(chat *entities.Chat) error {
-	return r.db.Save(chat).Error
+func (r *chatRepository) Update(ctx context.Context, chat *entities.Chat) error {
+	return withRetry(ctx, func() error {
+		// Счетчик сообщений меняется только при отправке, иначе устаревшее значение сбросило бы нумерацию
+		return r.db.WithContext(ctx).Omit("last_seq").Save(chat).Error
+	})
 }
 
 // Delete - удаляет чат из базы данных по ID
-func (r *chatRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.Chat{}, id).Error
+func (r *chatRepository) Delete(ctx context.Context, id uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&entities.Chat{}, id).Error
+	})
 }
 
 // AddMember - добавляет участника в чат с указанной ролью
-func (r *chatRepository) AddMember(chatID, userID uint, role string) error {
+func (r *chatRepository) AddMember(ctx context.Context, chatID, userID uint, role string) error {
 	member := &entities.ChatMember{
 		ChatID: chatID,
 		UserID: userID,
 		Role:   role,
 	}
-	return r.db.Create(member).Error
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(member).Error
+	})
+}
+
+// AddMembers - добавляет в чат нескольких участников с одной ролью в одной транзакции
+func (r *chatRepository) AddMembers(ctx context.Context, chatID uint, userIDs []uint, role string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	members := make([]entities.ChatMember, len(userIDs))
+	for i, userID := range userIDs {
+		members[i] = entities.ChatMember{ChatID: chatID, UserID: userID, Role: role}
+	}
+
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&members).Error
+		})
+	})
 }
 
-// RemoveMember - удаляет участника из чата
-func (r *chatRepository) RemoveMember(chatID, userID uint) error {
-	return r.db.Where("chat_id = ? AND user_id = ?", chatID, userID).Delete(&entities.ChatMember{}).Error
+// RemoveMember - удаляет участника из чата. Удаление последнего администратора группы, в которой
+// нет создателя, отклоняется с repository.ErrLastAdmin
+func (r *chatRepository) RemoveMember(ctx context.Context, chatID, userID uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return guardLastAdmin(tx, chatID, func() error {
+				return tx.Where("chat_id = ? AND user_id = ?", chatID, userID).Delete(&entities.ChatMember{}).Error
+			})
+		})
+	})
+}
+
+// guardLastAdmin - выполняет change внутри транзакции tx и откатывает его с repository.ErrLastAdmin,
+// если до изменения в группе были администраторы или создатель, а после не осталось ни одного.
+// Создатель считается администратором: пока он состоит в группе, ею есть кому управлять.
+// Строки администраторов блокируются до изменения, поэтому параллельные понижения разных
+// администраторов выполняются по очереди и второе видит результат первого
+func guardLastAdmin(tx *gorm.DB, chatID uint, change func() error) error {
+	var chat entities.Chat
+	if err := tx.Select("id", "created_by", "is_group").First(&chat, chatID).Error; err != nil {
+		return err
+	}
+	if !chat.IsGroup {
+		return change()
+	}
+
+	var admins []entities.ChatMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("chat_id = ? AND (role = ? OR user_id = ?)", chatID, "admin", chat.CreatedBy).
+		Order("user_id").
+		Find(&admins).Error; err != nil {
+		return err
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+	if len(admins) == 0 {
+		return nil
+	}
+
+	var remaining int64
+	if err := tx.Model(&entities.ChatMember{}).
+		Where("chat_id = ? AND (role = ? OR user_id = ?)", chatID, "admin", chat.CreatedBy).
+		Count(&remaining).Error; err != nil {
+		return err
+	}
+	if remaining == 0 {
+		return repository.ErrLastAdmin
+	}
+	return nil
 }
 
 // GetMembers - получает список всех участников чата
-func (r *chatRepository) GetMembers(chatID uint) ([]entities.User, error) {
+func (r *chatRepository) GetMembers(ctx context.Context, chatID uint) ([]entities.User, error) {
 	var users []entities.User
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Joins("JOIN chat_members ON users.id = chat_members.user_id").
 		Where("chat_members.chat_id = ?", chatID).
 		Find(&users).Error
@@ -79,19 +215,19 @@ func (r *chatRepository) GetMembers(chatID uint) ([]entities.User, error) {
 }
 
 // IsMember - проверяет, является ли пользователь участником чата
-func (r *chatRepository) IsMember(chatID, userID uint) (bool, error) {
+func (r *chatRepository) IsMember(ctx context.Context, chatID, userID uint) (bool, error) {
 	var count int64
-	err := r.db.Model(&entities.ChatMember{}).
+	err := r.db.WithContext(ctx).Model(&entities.ChatMember{}).
 		Where("chat_id = ? AND user_id = ?", chatID, userID).
 		Count(&count).Error
 	return count > 0, err
 }
 
 // FindPrivateChat - находит приватный чат между двумя пользователями
-func (r *chatRepository) FindPrivateChat(userID1, userID2 uint) (*entities.Chat, error) {
+func (r *chatRepository) FindPrivateChat(ctx context.Context, userID1, userID2 uint) (*entities.Chat, error) {
 	var chat entities.Chat
 
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Preload("Creator").
 		Preload("Members").
 		Where("is_group = false").
@@ -106,8 +242,19 @@ func (r *chatRepository) FindPrivateChat(userID1, userID2 uint) (*entities.Chat,
 	return &chat, nil
 }
 
-// GetMembersWithRoles - получает список участников чата с их ролями
-func (r *chatRepository) GetMembersWithRoles(chatID uint) ([]*entities.User, error) {
+// GetByPairKey - получает приватный чат по нормализованному ключу пары пользователей
+func (r *chatRepository) GetByPairKey(ctx context.Context, pairKey string) (*entities.Chat, error) {
+	var chat entities.Chat
+	err := r.db.WithContext(ctx).Preload("Creator").Preload("Members").Where("pair_key = ?", pairKey).First(&chat).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// GetMembersWithRoles - получает участников чата с их ролями (создатель чата получает роль "creator")
+// в порядке вступления; limit <= 0 - все участники
+func (r *chatRepository) GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error) {
 	type userWithRole struct {
 		entities.User
 		Role string `gorm:"column:role"`
@@ -115,11 +262,16 @@ func (r *chatRepository) GetMembersWithRoles(chatID uint) ([]*entities.User, err
 
 	var usersWithRoles []userWithRole
 
-	err := r.db.Model(&entities.User{}).
-		Select("users.*, chat_members.role").
+	query := r.db.WithContext(ctx).Model(&entities.User{}).
+		Select("users.*, CASE WHEN chats.created_by = users.id THEN 'creator' ELSE chat_members.role END AS role").
 		Joins("JOIN chat_members ON users.id = chat_members.user_id").
+		Joins("JOIN chats ON chats.id = chat_members.chat_id AND chats.deleted_at IS NULL").
 		Where("chat_members.chat_id = ?", chatID).
-		Scan(&usersWithRoles).Error
+		Order("chat_members.id ASC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	err := query.Scan(&usersWithRoles).Error
 
 	if err != nil {
 		return nil, err
@@ -135,18 +287,30 @@ func (r *chatRepository) GetMembersWithRoles(chatID uint) ([]*entities.User, err
 	return result, nil
 }
 
+// SetSlowMode - задает интервал медленного режима чата
+func (r *chatRepository) SetSlowMode(ctx context.Context, chatID uint, seconds int) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.Chat{}).
+			Where("id = ?", chatID).
+			Update("slow_mode_seconds", seconds).
+			Error
+	})
+}
+
 // UpdateMemberRole - обновляет роль участника чата
-func (r *chatRepository) UpdateMemberRole(chatID, userID uint, role string) error {
-	return r.db.Model(&entities.ChatMember{}).
-		Where("chat_id = ? AND user_id = ?", chatID, userID).
-		Update("role", role).
-		Error
+func (r *chatRepository) UpdateMemberRole(ctx context.Context, chatID, userID uint, role string) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.ChatMember{}).
+			Where("chat_id = ? AND user_id = ?", chatID, userID).
+			Update("role", role).
+			Error
+	})
 }
 
 // GetMemberRole - получает роль участника в чате
-func (r *chatRepository) GetMemberRole(chatID, userID uint) (string, error) {
+func (r *chatRepository) GetMemberRole(ctx context.Context, chatID, userID uint) (string, error) {
 	var member entities.ChatMember
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Where("chat_id = ? AND user_id = ?", chatID, userID).
 		First(&member).Error
 
@@ -156,3 +320,135 @@ func (r *chatRepository) GetMemberRole(chatID, userID uint) (string, error) {
 
 	return member.Role, nil
 }
+
+// CountMembers - подсчитывает участников чата
+func (r *chatRepository) CountMembers(ctx context.Context, chatID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.ChatMember{}).
+		Where("chat_id = ?", chatID).
+		Count(&count).Error
+	return count, err
+}
+
+// ModifyMemberRole - читает и изменяет роль участника в одной транзакции; строка участника
+// блокируется, поэтому параллельные изменения роли выполняются последовательно. Понижение
+// последнего администратора группы, в которой нет создателя, отклоняется с repository.ErrLastAdmin
+func (r *chatRepository) ModifyMemberRole(ctx context.Context, chatID, userID uint, modify func(current string) (string, error)) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return guardLastAdmin(tx, chatID, func() error {
+				var member entities.ChatMember
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("chat_id = ? AND user_id = ?", chatID, userID).
+					First(&member).Error; err != nil {
+					return err
+				}
+
+				role, err := modify(member.Role)
+				if err != nil {
+					return err
+				}
+				if role == member.Role {
+					return nil
+				}
+
+				return tx.Model(&entities.ChatMember{}).
+					Where("id = ?", member.ID).
+					Update("role", role).
+					Error
+			})
+		})
+	})
+}
+
+// SetMemberRoles - меняет роли нескольких участников в одной транзакции и возвращает их прежние
+// роли. Если кто-то из пользователей не состоит в чате, не меняется ни одна роль и возвращается
+// repository.ErrNotMember; если после изменений в группе не останется ни администраторов,
+// ни создателя, изменения откатываются с repository.ErrLastAdmin
+func (r *chatRepository) SetMemberRoles(ctx context.Context, chatID uint, roles map[uint]string) (map[uint]string, error) {
+	userIDs := make([]uint, 0, len(roles))
+	for userID := range roles {
+		userIDs = append(userIDs, userID)
+	}
+
+	var previous map[uint]string
+	err := withRetry(ctx, func() error {
+		previous = make(map[uint]string, len(roles))
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return guardLastAdmin(tx, chatID, func() error {
+				var members []entities.ChatMember
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("chat_id = ? AND user_id IN ?", chatID, userIDs).
+					Order("user_id").
+					Find(&members).Error; err != nil {
+					return err
+				}
+				if len(members) != len(userIDs) {
+					return repository.ErrNotMember
+				}
+
+				for _, member := range members {
+					previous[member.UserID] = member.Role
+					if member.Role == roles[member.UserID] {
+						continue
+					}
+					if err := tx.Model(&entities.ChatMember{}).
+						Where("id = ?", member.ID).
+						Update("role", roles[member.UserID]).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// RotateKey - сохраняет новый ключ чата и делает его активным; строка чата блокируется,
+// чтобы параллельные ротации не получили одинаковую версию
+func (r *chatRepository) RotateKey(ctx context.Context, chatID uint, key string) (int, error) {
+	var version int
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var chat entities.Chat
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "key_version").
+				First(&chat, chatID).Error; err != nil {
+				return err
+			}
+
+			version = chat.KeyVersion + 1
+			chatKey := &entities.ChatKey{ChatID: chatID, Version: version, Key: key}
+			if err := tx.Create(chatKey).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&entities.Chat{}).Where("id = ?", chatID).Update("key_version", version).Error
+		})
+	})
+	return version, err
+}
+
+// GetKeyVersion - получает текущую версию ключа чата без загрузки участников
+func (r *chatRepository) GetKeyVersion(ctx context.Context, chatID uint) (int, error) {
+	var chat entities.Chat
+	err := r.db.WithContext(ctx).Select("id", "key_version").First(&chat, chatID).Error
+	if err != nil {
+		return 0, err
+	}
+	return chat.KeyVersion, nil
+}
+
+// GetKey - получает ключ чата указанной версии
+func (r *chatRepository) GetKey(ctx context.Context, chatID uint, version int) (*entities.ChatKey, error) {
+	var chatKey entities.ChatKey
+	err := r.db.WithContext(ctx).Where("chat_id = ? AND version = ?", chatID, version).First(&chatKey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &chatKey, nil
+}
@@ -3,7 +3,9 @@ package database
 import (
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/pkg/config"
+	"database/sql"
 	"fmt"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -14,29 +16,140 @@ type Database struct {
 	*gorm.DB
 }
 
-// New - создает новое подключение к базе данных PostgreSQL
+// maxConnectRetryDelay - верхняя граница задержки между попытками подключения
+const maxConnectRetryDelay = 30 * time.Second
+
+// New - создает новое подключение к базе данных PostgreSQL, повторяя попытки
+// с экспоненциальной задержкой, и применяет настройки пула соединений
 func New(cfg *config.DatabaseConfig) (*Database, error) {
-	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid database config: %v", err)
+	}
+
+	var (
+		db  *gorm.DB
+		err error
+	)
+
+	delay := cfg.ConnectRetryDelay
+	for attempt := 0; ; attempt++ {
+		// gorm.Open проверяет соединение ping-запросом, поэтому недоступная база вернет ошибку сразу
+		db, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
+			Logger:         logger.Default.LogMode(gormLogLevel(cfg.LogLevel)),
+			TranslateError: true,
+		})
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectRetries {
+			return nil, fmt.Errorf("failed to connect to database after %d attempts: %v", attempt+1, err)
+		}
+
+		time.Sleep(delay)
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
 
+	sqlDB, err := db.DB()
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %v", err)
+		return nil, fmt.Errorf("failed to get database handle: %v", err)
 	}
 
+	applyPoolSettings(sqlDB, cfg)
+
 	return &Database{db}, nil
 }
 
+// applyPoolSettings - применяет к пулу соединений настройки из конфигурации
+func applyPoolSettings(sqlDB *sql.DB, cfg *config.DatabaseConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+}
+
+// gormLogLevel - преобразует DB_LOG_LEVEL в уровень журнала GORM; неизвестное значение
+// (отсекается DatabaseConfig.Validate) соответствует warn
+func gormLogLevel(level string) logger.LogLevel {
+	switch level {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
+	}
+}
+
 // Migrate - выполняет автоматическую миграцию всех сущностей базы данных
 func (db *Database) Migrate() error {
-	return db.AutoMigrate(
+	if err := db.AutoMigrate(
 		&entities.User{},
 		&entities.Chat{},
 		&entities.Message{},
 		&entities.ChatMember{},
+		&entities.ChatKey{},
+		&entities.MessageMention{},
+		&entities.MessageReceipt{},
+		&entities.MessageReaction{},
+		&entities.MessageReport{},
+		&entities.UserBlock{},
+		&entities.Attachment{},
 		&entities.KeyExchange{},
 		&entities.Session{},
-	)
+		&entities.AuditLog{},
+		&entities.FailedNotification{},
+	); err != nil {
+		return err
+	}
+
+	// Имена пользователей уникальны без учета регистра, иначе "Alice" и "alice" могли бы выдавать себя друг за друга.
+	// Если в базе уже есть такие пары, индекс не создастся и их нужно переименовать вручную
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username))").Error; err != nil {
+		return fmt.Errorf("failed to create case-insensitive username index (resolve usernames differing only in case): %v", err)
+	}
+
+	if err := backfillMessageSeq(db.DB); err != nil {
+		return fmt.Errorf("failed to backfill message sequence numbers: %v", err)
+	}
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_chat_seq ON messages (chat_id, seq)").Error; err != nil {
+		return fmt.Errorf("failed to create message sequence index: %v", err)
+	}
+
+	// Открытую реакцию пользователь ставит на сообщение один раз; зашифрованные реакции сервер
+	// сравнить не может, поэтому они в индекс не входят
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_message_reactions_plain ON message_reactions (message_id, user_id, emoji) WHERE encrypted = false").Error; err != nil {
+		return fmt.Errorf("failed to create reaction index: %v", err)
+	}
+
+	// Email также уникален без учета регистра: адреса нормализуются при записи, индекс защищает
+	// от гонки параллельных регистраций и от записей, сохраненных до нормализации
+	if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error; err != nil {
+		return fmt.Errorf("failed to create case-insensitive email index (resolve emails differing only in case): %v", err)
+	}
+
+	return nil
+}
+
+// backfillMessageSeq - нумерует сообщения чатов, созданные до появления порядковых номеров,
+// в порядке отправки и переносит последний номер в счетчик чата. Затрагивает только чаты
+// с нулевым счетчиком, поэтому повторный запуск ничего не меняет
+func backfillMessageSeq(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE messages SET seq = numbered.rn
+			FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY created_at, id) AS rn
+				FROM messages
+				WHERE chat_id IN (SELECT id FROM chats WHERE last_seq = 0)
+			) AS numbered
+			WHERE messages.id = numbered.id`).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`UPDATE chats SET last_seq = counted.max_seq
+			FROM (SELECT chat_id, MAX(seq) AS max_seq FROM messages GROUP BY chat_id) AS counted
+			WHERE chats.id = counted.chat_id AND chats.last_seq = 0`).Error
+	})
 }
 
 // Close - закрывает подключение к базе данных
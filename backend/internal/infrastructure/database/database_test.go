@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sleek-chat-backend/pkg/config"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// unreachableDSN - адрес, на котором гарантированно нет PostgreSQL
+const unreachableDSN = "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"
+
+// newOfflineDB - открывает GORM без проверочного подключения; любой запрос, дошедший до драйвера,
+// завершится ошибкой соединения
+func newOfflineDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(postgres.Open(unreachableDSN), &gorm.Config{
+		DisableAutomaticPing: true,
+		TranslateError:       true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestApplyPoolSettings(t *testing.T) {
+	// sql.Open не подключается к серверу, поэтому пул можно настроить без базы
+	sqlDB, err := sql.Open("pgx", unreachableDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	applyPoolSettings(sqlDB, &config.DatabaseConfig{MaxOpenConns: 7, MaxIdleConns: 3, ConnMaxLifetime: time.Minute})
+
+	if got := sqlDB.Stats().MaxOpenConnections; got != 7 {
+		t.Fatalf("MaxOpenConnections = %d, want 7", got)
+	}
+}
+
+func TestCancelledContextAbortsQuery(t *testing.T) {
+	db := newOfflineDB(t)
+	users := NewUserRepository(db)
+	chats := NewChatRepository(db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Отмененный контекст прерывает запрос до подключения к базе
+	if _, err := users.GetByID(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetByID: err = %v, want %v", err, context.Canceled)
+	}
+	if _, err := chats.IsMember(ctx, 1, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("IsMember: err = %v, want %v", err, context.Canceled)
+	}
+
+	// С живым контекстом запрос доходит до драйвера и падает на подключении
+	if _, err := users.GetByID(context.Background(), 1); err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("GetByID with live context: err = %v, want a connection error", err)
+	}
+}
+
+func TestGormLogLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  logger.LogLevel
+	}{
+		{"silent", logger.Silent},
+		{"error", logger.Error},
+		{"warn", logger.Warn},
+		{"info", logger.Info},
+		{"", logger.Warn},
+	}
+
+	for _, tt := range tests {
+		if got := gormLogLevel(tt.level); got != tt.want {
+			t.Fatalf("gormLogLevel(%q) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type failedNotificationRepository struct {
+	db *gorm.DB
+}
+
+// NewFailedNotificationRepository - создает новый экземпляр репозитория недоставленных уведомлений
+func NewFailedNotificationRepository(db *gorm.DB) repository.FailedNotificationRepository {
+	return &failedNotificationRepository{db: db}
+}
+
+// Create - сохраняет недоставленное уведомление
+func (r *failedNotificationRepository) Create(ctx context.Context, notification *entities.FailedNotification) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(notification).Error
+	})
+}
+
+// TakeByUser - забирает недоставленные уведомления пользователя в порядке записи и удаляет их
+// в одной транзакции; строки блокируются, поэтому параллельные подключения не получат их дважды
+func (r *failedNotificationRepository) TakeByUser(ctx context.Context, userID uint) ([]entities.FailedNotification, error) {
+	var notifications []entities.FailedNotification
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("user_id = ?", userID).
+				Order("id ASC").
+				Find(&notifications).Error; err != nil {
+				return err
+			}
+
+			if len(notifications) == 0 {
+				return nil
+			}
+
+			ids := make([]uint, len(notifications))
+			for i, notification := range notifications {
+				ids[i] = notification.ID
+			}
+			return tx.Delete(&entities.FailedNotification{}, ids).Error
+		})
+	})
+	return notifications, err
+}
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"context"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -17,14 +19,16 @@ func NewKeyExchangeRepository(db *gorm.DB) repository.KeyExchangeRepository {
 }
 
 // Create создает новую запись обмена ключами в базе данных
-func (r *keyExchangeRepository) Create(keyExchange *entities.KeyExchange) error {
-	return r.db.Create(keyExchange).Error
+func (r *keyExchangeRepository) Create(ctx context.Context, keyExchange *entities.KeyExchange) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(keyExchange).Error
+	})
 }
 
 // GetByID получает запись обмена ключами по ID
-func (r *keyExchangeRepository) GetByID(id uint) (*entities.KeyExchange, error) {
+func (r *keyExchangeRepository) GetByID(ctx context.Context, id uint) (*entities.KeyExchange, error) {
 	var keyExchange entities.KeyExchange
-	err := r.db.Preload("UserA").Preload("UserB").First(&keyExchange, id).Error
+	err := r.db.WithContext(ctx).Preload("UserA").Preload("UserB").First(&keyExchange, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -32,10 +36,10 @@ func (r *keyExchangeRepository) GetByID(id uint) (*entities.KeyExchange, error)
 }
 
 // GetByUsers получает запись обмена ключами между двумя пользователями
-func (r *keyExchangeRepository) GetByUsers(userAID, userBID uint) (*entities.KeyExchange, error) {
+func (r *keyExchangeRepository) GetByUsers(ctx context.Context, userAID, userBID uint) (*entities.KeyExchange, error) {
 	var keyExchange entities.KeyExchange
 
-	err := r.db.Preload("UserA").Preload("UserB").
+	err := r.db.WithContext(ctx).Preload("UserA").Preload("UserB").
 		Where("(user_a_id = ? AND user_b_id = ?) OR (user_a_id = ? AND user_b_id = ?)",
 			userAID, userBID, userBID, userAID).
 		First(&keyExchange).Error
@@ -48,27 +52,33 @@ func (r *keyExchangeRepository) GetByUsers(userAID, userBID uint) (*entities.Key
 }
 
 // Update обновляет данные обмена ключами в базе данных
-func (r *keyExchangeRepository) Update(keyExchange *entities.KeyExchange) error {
-	return r.db.Save(keyExchange).Error
+func (r *keyExchangeRepository) Update(ctx context.Context, keyExchange *entities.KeyExchange) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Save(keyExchange).Error
+	})
 }
 
 // Delete удаляет запись обмена ключами по ID
-func (r *keyExchangeRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.KeyExchange{}, id).Error
+func (r *keyExchangeRepository) Delete(ctx context.Context, id uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&entities.KeyExchange{}, id).Error
+	})
 }
 
 // DeleteByUsers удаляет запись обмена ключами между пользователями
-func (r *keyExchangeRepository) DeleteByUsers(userAID, userBID uint) error {
-	return r.db.Where("(user_a_id = ? AND user_b_id = ?) OR (user_a_id = ? AND user_b_id = ?)",
-		userAID, userBID, userBID, userAID).
-		Delete(&entities.KeyExchange{}).Error
+func (r *keyExchangeRepository) DeleteByUsers(ctx context.Context, userAID, userBID uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Where("(user_a_id = ? AND user_b_id = ?) OR (user_a_id = ? AND user_b_id = ?)",
+			userAID, userBID, userBID, userAID).
+			Delete(&entities.KeyExchange{}).Error
+	})
 }
 
 // GetActiveExchanges получает все активные обмены ключами для пользователя
-func (r *keyExchangeRepository) GetActiveExchanges(userID uint) ([]entities.KeyExchange, error) {
+func (r *keyExchangeRepository) GetActiveExchanges(ctx context.Context, userID uint) ([]entities.KeyExchange, error) {
 	var exchanges []entities.KeyExchange
 
-	err := r.db.Preload("UserA").Preload("UserB").
+	err := r.db.WithContext(ctx).Preload("UserA").Preload("UserB").
 		Where("(user_a_id = ? OR user_b_id = ?) AND status = ?",
 			userID, userID, "active").
 		Find(&exchanges).Error
@@ -77,20 +87,33 @@ func (r *keyExchangeRepository) GetActiveExchanges(userID uint) ([]entities.KeyE
 }
 
 // UpdateStatus обновляет статус обмена ключами
-func (r *keyExchangeRepository) UpdateStatus(id uint, status string) error {
-	return r.db.Model(&entities.KeyExchange{}).
-		Where("id = ?", id).
-		Update("status", status).Error
+func (r *keyExchangeRepository) UpdateStatus(ctx context.Context, id uint, status string) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.KeyExchange{}).
+			Where("id = ?", id).
+			Update("status", status).Error
+	})
 }
 
 // GetPendingExchanges получает все ожидающие обмены ключами для пользователя
-func (r *keyExchangeRepository) GetPendingExchanges(userID uint) ([]entities.KeyExchange, error) {
+func (r *keyExchangeRepository) GetPendingExchanges(ctx context.Context, userID uint) ([]entities.KeyExchange, error) {
 	var exchanges []entities.KeyExchange
 
-	err := r.db.Preload("UserA").Preload("UserB").
+	err := r.db.WithContext(ctx).Preload("UserA").Preload("UserB").
 		Where("(user_a_id = ? OR user_b_id = ?) AND status = ?",
 			userID, userID, "pending").
 		Find(&exchanges).Error
 
 	return exchanges, err
 }
+
+// DeleteStale удаляет записи обмена ключами в указанных статусах, не обновлявшиеся с момента olderThan
+func (r *keyExchangeRepository) DeleteStale(ctx context.Context, olderThan time.Time, statuses ...string) (int64, error) {
+	query := r.db.WithContext(ctx).Where("updated_at < ?", olderThan)
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+
+	result := query.Delete(&entities.KeyExchange{})
+	return result.RowsAffected, result.Error
+}
@@ -1,10 +1,13 @@
 package database
 
 import (
+	"context"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type messageRepository struct {
@@ -16,28 +19,102 @@ func NewMessageRepository(db *gorm.DB) repository.MessageRepository {
 	return &messageRepository{db: db}
 }
 
-// Create - создает новое сообщение в базе данных
-func (r *messageRepository) Create(message *entities.Message) error {
-	return r.db.Create(message).Error
+// Create - создает новое сообщение в базе данных, присваивая ему следующий номер в чате
+func (r *messageRepository) Create(ctx context.Context, message *entities.Message) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return createWithSeq(tx, message)
+		})
+	})
+}
+
+// createWithSeq - увеличивает счетчик сообщений чата и сохраняет сообщение с полученным номером.
+// Строка чата остается заблокированной до конца транзакции, поэтому параллельные отправки в один
+// чат получают номера по очереди, а откат транзакции не оставляет пропусков
+func createWithSeq(tx *gorm.DB, message *entities.Message) error {
+	var seq int64
+	result := tx.Raw("UPDATE chats SET last_seq = last_seq + 1 WHERE id = ? AND deleted_at IS NULL RETURNING last_seq", message.ChatID).Scan(&seq)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	message.Seq = seq
+	return tx.Create(message).Error
+}
+
+// CreateWithAttachment - создает сообщение и привязывает к нему вложение в одной транзакции.
+// Вложение должно быть загружено отправителем в тот же чат и еще не привязано к сообщению,
+// иначе сообщение не сохраняется и возвращается repository.ErrAttachmentUnavailable
+func (r *messageRepository) CreateWithAttachment(ctx context.Context, message *entities.Message, attachmentID uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			message.AttachmentID = &attachmentID
+			if err := createWithSeq(tx, message); err != nil {
+				return err
+			}
+
+			// Условие в UPDATE проверяет владельца и захватывает вложение атомарно: параллельная
+			// отправка с тем же вложением не найдет строку с message_id IS NULL
+			result := tx.Model(&entities.Attachment{}).
+				Where("id = ? AND chat_id = ? AND uploader_id = ? AND message_id IS NULL", attachmentID, message.ChatID, message.SenderID).
+				Update("message_id", message.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return repository.ErrAttachmentUnavailable
+			}
+			return nil
+		})
+	})
 }
 
 // GetByID - получает сообщение по его ID с загрузкой отправителя и чата
-func (r *messageRepository) GetByID(id uint) (*entities.Message, error) {
+func (r *messageRepository) GetByID(ctx context.Context, id uint) (*entities.Message, error) {
 	var message entities.Message
-	err := r.db.Preload("Sender").Preload("Chat").First(&message, id).Error
+	err := r.db.WithContext(ctx).Preload("Sender").Preload("Chat").First(&message, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-// GetChatMessages - получает сообщения чата с пагинацией (отсортированные по дате)
-func (r *messageRepository) GetChatMessages(chatID uint, limit, offset int) ([]entities.Message, error) {
+// GetChatMessages - получает сообщения чата с пагинацией, начиная с последнего по порядковому номеру
+func (r *messageRepository) GetChatMessages(ctx context.Context, chatID uint, limit, offset int) ([]entities.Message, error) {
 	var messages []entities.Message
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Preload("Sender").
 		Where("chat_id = ?", chatID).
-		Order("created_at DESC").
+		Order("seq DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetChatMessagesAfter - получает следующую порцию сообщений чата с порядковым номером больше
+// afterSeq в порядке нумерации; используется для последовательного обхода всей истории без смещений
+func (r *messageRepository) GetChatMessagesAfter(ctx context.Context, chatID uint, afterSeq int64, limit int) ([]entities.Message, error) {
+	var messages []entities.Message
+	err := r.db.WithContext(ctx).
+		Preload("Sender").
+		Where("chat_id = ? AND seq > ?", chatID, afterSeq).
+		Order("seq ASC, id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// GetChatMessagesByType - получает сообщения чата указанных типов с пагинацией, начиная с последнего
+func (r *messageRepository) GetChatMessagesByType(ctx context.Context, chatID uint, messageTypes []string, limit, offset int) ([]entities.Message, error) {
+	var messages []entities.Message
+	err := r.db.WithContext(ctx).
+		Preload("Sender").
+		Where("chat_id = ? AND message_type IN ?", chatID, messageTypes).
+		Order("seq DESC, id DESC").
 		Limit(limit).
 		Offset(offset).
 		Find(&messages).Error
@@ -45,19 +122,80 @@ func (r *messageRepository) GetChatMessages(chatID uint, limit, offset int) ([]e
 }
 
 // Update - обновляет данные сообщения в базе данных
-func (r *messageRepository) Update(message *entities.Message) error {
-	return r.db.Save(message).Error
+func (r *messageRepository) Update(ctx context.Context, message *entities.Message) error {
+	// Загруженные отправитель и чат не должны перезаписываться вместе с сообщением
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Omit(clause.Associations).Save(message).Error
+	})
 }
 
-// Delete - удаляет сообщение из базы данных по ID
-func (r *messageRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.Message{}, id).Error
+// Delete - мягко удаляет сообщение по ID, запоминая, кто его удалил
+func (r *messageRepository) Delete(ctx context.Context, id, deletedBy uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.Message{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"deleted_at": time.Now(), "deleted_by": deletedBy}).
+			Error
+	})
+}
+
+// GetDeletedByID - получает мягко удаленное сообщение по ID
+func (r *messageRepository) GetDeletedByID(ctx context.Context, id uint) (*entities.Message, error) {
+	var message entities.Message
+	err := r.db.WithContext(ctx).Unscoped().
+		Preload("Chat").
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Restore - отменяет мягкое удаление сообщения; возвращает false, если сообщение
+// не удалено или уже окончательно стерто
+func (r *messageRepository) Restore(ctx context.Context, id uint) (bool, error) {
+	result := r.db.WithContext(ctx).Unscoped().Model(&entities.Message{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeDeleted - окончательно удаляет сообщения, мягко удаленные раньше deletedBefore,
+// вместе с их упоминаниями и отметками о прочтении
+func (r *messageRepository) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var ids []uint
+			if err := tx.Unscoped().Model(&entities.Message{}).
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).
+				Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+
+			if err := tx.Where("message_id IN ?", ids).Delete(&entities.MessageMention{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("message_id IN ?", ids).Delete(&entities.MessageReceipt{}).Error; err != nil {
+				return err
+			}
+
+			result := tx.Unscoped().Where("id IN ?", ids).Delete(&entities.Message{})
+			purged = result.RowsAffected
+			return result.Error
+		})
+	})
+	return purged, err
 }
 
 // GetUserMessages - получает все сообщения пользователя с пагинацией
-func (r *messageRepository) GetUserMessages(userID uint, limit, offset int) ([]entities.Message, error) {
+func (r *messageRepository) GetUserMessages(ctx context.Context, userID uint, limit, offset int) ([]entities.Message, error) {
 	var messages []entities.Message
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Preload("Sender").
 		Preload("Chat").
 		Where("sender_id = ?", userID).
@@ -67,3 +205,189 @@ func (r *messageRepository) GetUserMessages(userID uint, limit, offset int) ([]e
 		Find(&messages).Error
 	return messages, err
 }
+
+// GetUserMessagesAfter - получает следующую порцию сообщений, отправленных пользователем, с ID
+// больше afterID в порядке отправки; используется для выгрузки данных пользователя
+func (r *messageRepository) GetUserMessagesAfter(ctx context.Context, userID, afterID uint, limit int) ([]entities.Message, error) {
+	var messages []entities.Message
+	err := r.db.WithContext(ctx).
+		Preload("Sender").
+		Where("sender_id = ? AND id > ?", userID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// CreateMentions - сохраняет упоминания пользователей в сообщении
+func (r *messageRepository) CreateMentions(ctx context.Context, mentions []entities.MessageMention) error {
+	if len(mentions) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&mentions).Error
+}
+
+// CountUnreadMentionsByChats - подсчитывает непрочитанные упоминания пользователя в нескольких чатах
+// одним сгруппированным запросом; чаты без непрочитанных упоминаний в результат не попадают
+func (r *messageRepository) CountUnreadMentionsByChats(ctx context.Context, chatIDs []uint, userID uint) (map[uint]int64, error) {
+	result := make(map[uint]int64, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return result, nil
+	}
+
+	var counts []struct {
+		ChatID uint
+		Count  int64
+	}
+	err := r.db.WithContext(ctx).Model(&entities.MessageMention{}).
+		Select("chat_id, COUNT(*) AS count").
+		Where("chat_id IN ? AND user_id = ? AND read_at IS NULL", chatIDs, userID).
+		Group("chat_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, count := range counts {
+		result[count.ChatID] = count.Count
+	}
+	return result, nil
+}
+
+// MarkMentionsRead - отмечает все упоминания пользователя в чате как прочитанные
+func (r *messageRepository) MarkMentionsRead(ctx context.Context, chatID, userID uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.MessageMention{}).
+			Where("chat_id = ? AND user_id = ? AND read_at IS NULL", chatID, userID).
+			Update("read_at", time.Now()).Error
+	})
+}
+
+// AdvanceStatus - переводит сообщение в новый статус, только если он следует за текущим
+// (sent -> delivered -> read); возвращает true, если статус изменился
+func (r *messageRepository) AdvanceStatus(ctx context.Context, messageID uint, status string) (bool, error) {
+	var previous []string
+	switch status {
+	case entities.MessageStatusDelivered:
+		previous = []string{entities.MessageStatusSent}
+	case entities.MessageStatusRead:
+		previous = []string{entities.MessageStatusSent, entities.MessageStatusDelivered}
+	default:
+		return false, nil
+	}
+
+	result := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Where("id = ? AND status IN ?", messageID, previous).
+		Update("status", status)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateReceipt - сохраняет отметку о прочтении, повторная отметка игнорируется
+func (r *messageRepository) CreateReceipt(ctx context.Context, receipt *entities.MessageReceipt) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(receipt).Error
+	})
+}
+
+// GetReaders - получает участников чата, прочитавших сообщение, в порядке прочтения;
+// отметки покинувших чат пользователей не возвращаются
+func (r *messageRepository) GetReaders(ctx context.Context, messageID uint) ([]entities.MessageReader, error) {
+	var readers []entities.MessageReader
+	err := r.db.WithContext(ctx).Model(&entities.MessageReceipt{}).
+		Select("message_receipts.user_id AS user_id, users.username AS username, message_receipts.read_at AS read_at").
+		Joins("JOIN messages ON messages.id = message_receipts.message_id").
+		Joins("JOIN chat_members ON chat_members.chat_id = messages.chat_id AND chat_members.user_id = message_receipts.user_id").
+		Joins("JOIN users ON users.id = message_receipts.user_id").
+		Where("message_receipts.message_id = ?", messageID).
+		Order("message_receipts.read_at, message_receipts.user_id").
+		Scan(&readers).Error
+	return readers, err
+}
+
+// CountByChat - подсчитывает сообщения чата
+func (r *messageRepository) CountByChat(ctx context.Context, chatID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Where("chat_id = ?", chatID).
+		Count(&count).Error
+	return count, err
+}
+
+// CountByChats - подсчитывает сообщения нескольких чатов одним сгруппированным запросом и находит
+// время последнего сообщения каждого; чаты без сообщений в результат не попадают
+func (r *messageRepository) CountByChats(ctx context.Context, chatIDs []uint) (map[uint]entities.ChatMessageCount, error) {
+	result := make(map[uint]entities.ChatMessageCount, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return result, nil
+	}
+
+	var counts []entities.ChatMessageCount
+	err := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Select("chat_id, COUNT(*) AS count, MAX(created_at) AS last_message_at").
+		Where("chat_id IN ?", chatIDs).
+		Group("chat_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, count := range counts {
+		result[count.ChatID] = count
+	}
+	return result, nil
+}
+
+// CountByChatAndType - подсчитывает сообщения чата указанных типов
+func (r *messageRepository) CountByChatAndType(ctx context.Context, chatID uint, messageTypes []string) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Where("chat_id = ? AND message_type IN ?", chatID, messageTypes).
+		Count(&count).Error
+	return count, err
+}
+
+// GetTopSender - находит участника, отправившего больше всего сообщений в чат (без системных);
+// если сообщений нет, возвращает nil
+func (r *messageRepository) GetTopSender(ctx context.Context, chatID uint) (*entities.SenderMessageCount, error) {
+	var senders []entities.SenderMessageCount
+	err := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Select("messages.sender_id AS user_id, users.username AS username, COUNT(*) AS count").
+		Joins("JOIN users ON users.id = messages.sender_id").
+		Where("messages.chat_id = ? AND messages.message_type <> ?", chatID, "system").
+		Group("messages.sender_id, users.username").
+		Order("count DESC, messages.sender_id").
+		Limit(1).
+		Scan(&senders).Error
+	if err != nil || len(senders) == 0 {
+		return nil, err
+	}
+	return &senders[0], nil
+}
+
+// GetLastSentAt - возвращает время последнего сообщения пользователя в чате, включая удаленные;
+// если сообщений нет, возвращает nil
+func (r *messageRepository) GetLastSentAt(ctx context.Context, chatID, senderID uint) (*time.Time, error) {
+	var message entities.Message
+	result := r.db.WithContext(ctx).Unscoped().
+		Select("created_at").
+		Where("chat_id = ? AND sender_id = ?", chatID, senderID).
+		Order("created_at DESC").
+		Limit(1).
+		Find(&message)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return &message.CreatedAt, nil
+}
+
+// CountPerDay - подсчитывает сообщения чата по дням начиная с since; дни без сообщений не возвращаются
+func (r *messageRepository) CountPerDay(ctx context.Context, chatID uint, since time.Time) ([]entities.DailyMessageCount, error) {
+	var counts []entities.DailyMessageCount
+	err := r.db.WithContext(ctx).Model(&entities.Message{}).
+		Select("DATE(created_at) AS day, COUNT(*) AS count").
+		Where("chat_id = ? AND created_at >= ?", chatID, since).
+		Group("DATE(created_at)").
+		Order("day").
+		Scan(&counts).Error
+	return counts, err
+}
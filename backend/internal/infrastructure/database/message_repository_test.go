@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sleek-chat-backend/internal/domain/entities"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestGetReadersQueryKeepsCurrentMembers(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+
+	if _, err := NewMessageRepository(db).GetReaders(context.Background(), 42); !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+		t.Fatalf("GetReaders: err = %v, want %v", err, gorm.ErrDryRunModeUnsupported)
+	}
+
+	// Возвращаются только отметки этого сообщения от тех, кто все еще состоит в чате, по времени прочтения
+	for _, fragment := range []string{
+		"WHERE message_receipts.message_id = 42",
+		"JOIN chat_members ON chat_members.chat_id = messages.chat_id AND chat_members.user_id = message_receipts.user_id",
+		"ORDER BY message_receipts.read_at",
+	} {
+		if !strings.Contains(recorder.sql, fragment) {
+			t.Fatalf("query has no %q: %s", fragment, recorder.sql)
+		}
+	}
+}
+
+func TestGetChatMessagesAfterFollowsSeq(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+
+	if _, err := NewMessageRepository(db).GetChatMessagesAfter(context.Background(), 10, 200, 50); err != nil {
+		t.Fatalf("GetChatMessagesAfter: %v", err)
+	}
+
+	// Курсор и сортировка по номеру в чате: порядок ID после нумерации старой истории может отличаться
+	for _, fragment := range []string{
+		"WHERE (chat_id = 10 AND seq > 200)",
+		"ORDER BY seq ASC, id ASC",
+		"LIMIT 50",
+	} {
+		if !strings.Contains(recorder.sql, fragment) {
+			t.Fatalf("query has no %q: %s", fragment, recorder.sql)
+		}
+	}
+}
+
+// seqStore - состояние поддельной базы для проверки нумерации: счетчики чатов, блокировки их строк
+// до конца транзакции и номера сохраненных сообщений
+type seqStore struct {
+	mu       sync.Mutex
+	rowLocks map[int64]*sync.Mutex
+	lastSeq  map[int64]int64
+	stored   map[int64][]int64
+	nextID   int64
+}
+
+func (s *seqStore) Connect(ctx context.Context) (driver.Conn, error) { return &seqConn{store: s}, nil }
+func (s *seqStore) Driver() driver.Driver                            { return nil }
+
+func (s *seqStore) rowLock(chatID int64) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rowLocks[chatID] == nil {
+		s.rowLocks[chatID] = &sync.Mutex{}
+	}
+	return s.rowLocks[chatID]
+}
+
+// seqConn - соединение поддельной базы, понимающее только запросы createWithSeq
+type seqConn struct {
+	store   *seqStore
+	undo    map[int64]int64
+	pending map[int64][]int64
+}
+
+func (c *seqConn) Prepare(query string) (driver.Stmt, error) {
+	return &seqStmt{conn: c, query: query}, nil
+}
+func (c *seqConn) Close() error { return nil }
+
+func (c *seqConn) Begin() (driver.Tx, error) {
+	c.undo, c.pending = make(map[int64]int64), make(map[int64][]int64)
+	return c, nil
+}
+
+func (c *seqConn) Commit() error {
+	c.store.mu.Lock()
+	for chatID, seqs := range c.pending {
+		c.store.stored[chatID] = append(c.store.stored[chatID], seqs...)
+	}
+	c.store.mu.Unlock()
+	c.release()
+	return nil
+}
+
+func (c *seqConn) Rollback() error {
+	c.store.mu.Lock()
+	for chatID, seq := range c.undo {
+		c.store.lastSeq[chatID] = seq
+	}
+	c.store.mu.Unlock()
+	c.release()
+	return nil
+}
+
+func (c *seqConn) release() {
+	for chatID := range c.undo {
+		c.store.rowLock(chatID).Unlock()
+	}
+	c.undo, c.pending = nil, nil
+}
+
+type seqStmt struct {
+	conn  *seqConn
+	query string
+}
+
+func (s *seqStmt) Close() error  { return nil }
+func (s *seqStmt) NumInput() int { return -1 }
+
+func (s *seqStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, fmt.Errorf("unexpected exec: %s", s.query)
+}
+
+func (s *seqStmt) Query(args []driver.Value) (driver.Rows, error) {
+	c, store := s.conn, s.conn.store
+
+	switch {
+	case strings.HasPrefix(s.query, "UPDATE chats SET last_seq"):
+		chatID := args[0].(int64)
+		if _, locked := c.undo[chatID]; !locked {
+			store.rowLock(chatID).Lock()
+			store.mu.Lock()
+			c.undo[chatID] = store.lastSeq[chatID]
+			store.mu.Unlock()
+		}
+		store.mu.Lock()
+		store.lastSeq[chatID]++
+		seq := store.lastSeq[chatID]
+		store.mu.Unlock()
+		return &seqRows{columns: []string{"last_seq"}, values: [][]driver.Value{{seq}}}, nil
+
+	case strings.HasPrefix(s.query, `INSERT INTO "messages"`):
+		columns := strings.Split(s.query[strings.Index(s.query, "(")+1:strings.Index(s.query, ")")], ",")
+		values := make(map[string]driver.Value, len(columns))
+		for i, column := range columns {
+			values[strings.Trim(column, `" `)] = args[i]
+		}
+		if values["content"] == "fail" {
+			return nil, errors.New("insert rejected")
+		}
+		chatID := values["chat_id"].(int64)
+		c.pending[chatID] = append(c.pending[chatID], values["seq"].(int64))
+
+		returning := strings.Split(s.query[strings.Index(s.query, "RETURNING ")+len("RETURNING "):], ",")
+		row := make([]driver.Value, len(returning))
+		for i, column := range returning {
+			returning[i] = strings.Trim(column, `" `)
+			if returning[i] == "id" {
+				store.mu.Lock()
+				store.nextID++
+				row[i] = store.nextID
+				store.mu.Unlock()
+			}
+		}
+		return &seqRows{columns: returning, values: [][]driver.Value{row}}, nil
+	}
+	return nil, fmt.Errorf("unexpected query: %s", s.query)
+}
+
+type seqRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *seqRows) Columns() []string { return r.columns }
+func (r *seqRows) Close() error      { return nil }
+
+func (r *seqRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestCreateAssignsGaplessSeqUnderConcurrency(t *testing.T) {
+	store := &seqStore{rowLocks: map[int64]*sync.Mutex{}, lastSeq: map[int64]int64{}, stored: map[int64][]int64{}}
+	sqlDB := sql.OpenDB(store)
+	defer sqlDB.Close()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := NewMessageRepository(db)
+
+	const senders, perSender = 8, 30
+	var wg sync.WaitGroup
+	for sender := 1; sender <= senders; sender++ {
+		wg.Add(1)
+		go func(sender int) {
+			defer wg.Done()
+			last := make(map[uint]int64)
+			for i := 0; i < perSender; i++ {
+				// Каждое пятое сообщение не сохраняется: откат не должен оставлять пропусков
+				content := "hello"
+				if i%5 == 4 {
+					content = "fail"
+				}
+				message := &entities.Message{ChatID: uint(1 + i%2), SenderID: uint(sender), Content: content}
+				err := messages.Create(context.Background(), message)
+				if (err != nil) != (content == "fail") {
+					t.Errorf("sender %d message %d: err = %v", sender, i, err)
+				}
+				// Следующее сообщение отправителя в чат получает больший номер
+				if err == nil {
+					if message.Seq <= last[message.ChatID] {
+						t.Errorf("sender %d: seq %d after %d", sender, message.Seq, last[message.ChatID])
+					}
+					last[message.ChatID] = message.Seq
+				}
+			}
+		}(sender)
+	}
+	wg.Wait()
+
+	// Номера в каждом чате идут подряд с единицы без пропусков и повторов
+	for chatID, seqs := range store.stored {
+		sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+		for i, seq := range seqs {
+			if seq != int64(i+1) {
+				t.Fatalf("chat %d: seqs = %v, want 1..%d", chatID, seqs, len(seqs))
+			}
+		}
+		if store.lastSeq[chatID] != int64(len(seqs)) {
+			t.Fatalf("chat %d: counter = %d, want %d", chatID, store.lastSeq[chatID], len(seqs))
+		}
+	}
+	if n := len(store.stored[1]) + len(store.stored[2]); n != senders*perSender*4/5 {
+		t.Fatalf("%d messages stored, want %d", n, senders*perSender*4/5)
+	}
+}
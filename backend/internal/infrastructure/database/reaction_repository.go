@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+
+	"gorm.io/gorm"
+)
+
+type reactionRepository struct {
+	db *gorm.DB
+}
+
+// NewReactionRepository - создает новый экземпляр репозитория реакций
+func NewReactionRepository(db *gorm.DB) repository.ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+// Create - сохраняет реакцию; повторная открытая реакция того же пользователя возвращает
+// repository.ErrReactionExists
+func (r *reactionRepository) Create(ctx context.Context, reaction *entities.MessageReaction) error {
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(reaction).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return repository.ErrReactionExists
+	}
+	return err
+}
+
+// Delete - удаляет реакцию пользователя на сообщение; возвращает false, если такой реакции нет
+func (r *reactionRepository) Delete(ctx context.Context, id, messageID, userID uint) (bool, error) {
+	var deleted int64
+	err := withRetry(ctx, func() error {
+		result := r.db.WithContext(ctx).
+			Where("id = ? AND message_id = ? AND user_id = ?", id, messageID, userID).
+			Delete(&entities.MessageReaction{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted > 0, err
+}
+
+// GetByMessage - получает все реакции на сообщение в порядке добавления
+func (r *reactionRepository) GetByMessage(ctx context.Context, messageID uint) ([]entities.MessageReaction, error) {
+	var reactions []entities.MessageReaction
+	err := r.db.WithContext(ctx).
+		Where("message_id = ?", messageID).
+		Order("id ASC").
+		Find(&reactions).Error
+	return reactions, err
+}
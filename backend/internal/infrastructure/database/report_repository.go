@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+
+	"gorm.io/gorm"
+)
+
+type reportRepository struct {
+	db *gorm.DB
+}
+
+// NewReportRepository - создает новый экземпляр репозитория жалоб на сообщения
+func NewReportRepository(db *gorm.DB) repository.ReportRepository {
+	return &reportRepository{db: db}
+}
+
+// Create - сохраняет жалобу; повторная жалоба того же пользователя на сообщение возвращает
+// repository.ErrReportExists
+func (r *reportRepository) Create(ctx context.Context, report *entities.MessageReport) error {
+	err := withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(report).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return repository.ErrReportExists
+	}
+	return err
+}
+
+// List - получает жалобы, начиная с самых новых, и их общее число; пустой status - все жалобы
+func (r *reportRepository) List(ctx context.Context, status string, limit, offset int) ([]entities.MessageReport, int64, error) {
+	query := r.db.WithContext(ctx).Model(&entities.MessageReport{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reports []entities.MessageReport
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&reports).Error
+	return reports, total, err
+}
+
+// UpdateStatus - меняет статус жалобы; возвращает false, если жалоба не найдена
+func (r *reportRepository) UpdateStatus(ctx context.Context, id uint, status string) (bool, error) {
+	var updated int64
+	err := withRetry(ctx, func() error {
+		result := r.db.WithContext(ctx).Model(&entities.MessageReport{}).
+			Where("id = ?", id).
+			Update("status", status)
+		updated = result.RowsAffected
+		return result.Error
+	})
+	return updated > 0, err
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	// writeRetryAttempts - сколько раз всего выполняется операция записи при временных ошибках
+	writeRetryAttempts = 3
+	// writeRetryBaseDelay - задержка перед первым повтором; дальше она удваивается
+	writeRetryBaseDelay = 20 * time.Millisecond
+)
+
+// withRetry - выполняет операцию записи и повторяет ее с экспоненциальной задержкой и джиттером,
+// если PostgreSQL вернул временную ошибку. Остальные ошибки, в том числе нарушение уникальности,
+// возвращаются сразу. Операция должна быть идемпотентной или выполняться в транзакции
+func withRetry(ctx context.Context, op func() error) error {
+	delay := writeRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= writeRetryAttempts || !isRetryableError(err) {
+			return err
+		}
+
+		// Джиттер разводит во времени повторы транзакций, столкнувшихся во взаимной блокировке
+		wait := delay/2 + rand.N(delay)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// IsTransientError - сообщает, вызван ли сбой временной причиной, после которой тот же запрос
+// может пройти: временной ошибкой PostgreSQL или истекшим тайм-аутом запроса. Ошибка должна
+// оборачиваться через %w, иначе причина теряется
+func IsTransientError(err error) bool {
+	return isRetryableError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// isRetryableError - сообщает, можно ли безопасно повторить операцию после ошибки: взаимная
+// блокировка и конфликт сериализации откатывают транзакцию целиком, а ошибка соединения
+// учитывается, только если запрос гарантированно не дошел до сервера
+func isRetryableError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01": // serialization_failure, deadlock_detected
+			return true
+		}
+		// Класс 08 - ошибки соединения, о которых сообщил сервер
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	return pgconn.SafeToRetry(err)
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sleek-chat-backend/internal/domain/entities"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+func TestWithRetry(t *testing.T) {
+	deadlock := &pgconn.PgError{Code: "40P01"}
+	uniqueViolation := &pgconn.PgError{Code: "23505"}
+
+	tests := []struct {
+		name         string
+		failures     []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{"succeeds first time", nil, nil, 1},
+		{"fails twice then succeeds", []error{deadlock, &pgconn.PgError{Code: "08006"}}, nil, 3},
+		{"gives up after max attempts", []error{deadlock, deadlock, deadlock, deadlock}, deadlock, writeRetryAttempts},
+		{"unique violation fails fast", []error{uniqueViolation}, uniqueViolation, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := withRetry(context.Background(), func() error {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return tt.failures[attempts-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestWithRetryStopsOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	err := withRetry(ctx, func() error {
+		attempts++
+		return &pgconn.PgError{Code: "40001"}
+	})
+	if err == nil || attempts != 1 {
+		t.Fatalf("err = %v after %d attempts, want the first error without retrying", err, attempts)
+	}
+}
+
+func TestRepositoryWriteRetriesTransientFailures(t *testing.T) {
+	db, _ := newDryRunDB(t)
+
+	// Запрос на вставку дважды завершается взаимной блокировкой, на третий раз проходит
+	inserts := 0
+	err := db.Callback().Create().Before("gorm:create").Register("test:flaky", func(tx *gorm.DB) {
+		inserts++
+		if inserts <= 2 {
+			tx.AddError(&pgconn.PgError{Code: "40P01"})
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Без неявной транзакции вставка не открывает соединение с базой
+	users := NewUserRepository(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+	if err := users.Create(context.Background(), &entities.User{Username: "alice"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if inserts != 3 {
+		t.Fatalf("insert attempted %d times, want 3", inserts)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
 	"time"
@@ -18,45 +19,81 @@ func NewSessionRepository(db *gorm.DB) repository.SessionRepository {
 }
 
 // Create - создает новую сессию в базе данных
-func (r *sessionRepository) Create(session *entities.Session) error {
-	return r.db.Create(session).Error
+func (r *sessionRepository) Create(ctx context.Context, session *entities.Session) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(session).Error
+	})
 }
 
 // GetByToken - получает сессию по токену с загрузкой пользователя
-func (r *sessionRepository) GetByToken(token string) (*entities.Session, error) {
+func (r *sessionRepository) GetByToken(ctx context.Context, token string) (*entities.Session, error) {
 	var session entities.Session
-	err := r.db.Preload("User").Where("token = ?", token).First(&session).Error
+	err := r.db.WithContext(ctx).Preload("User").Where("token = ?", token).First(&session).Error
 	if err != nil {
 		return nil, err
 	}
 	return &session, nil
 }
 
-// GetUserSessions - получает все сессии пользователя
-func (r *sessionRepository) GetUserSessions(userID uint) ([]entities.Session, error) {
+// GetUserSessions - получает сессии пользователя, начиная с самых новых; limit <= 0 - все сессии
+func (r *sessionRepository) GetUserSessions(ctx context.Context, userID uint, limit, offset int) ([]entities.Session, error) {
 	var sessions []entities.Session
-	err := r.db.Where("user_id = ?", userID).Find(&sessions).Error
+
+	query := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&sessions).Error
 	return sessions, err
 }
 
+// DeleteOldest - оставляет keep самых новых сессий пользователя, удаляя остальные,
+// и возвращает число удаленных сессий
+func (r *sessionRepository) DeleteOldest(ctx context.Context, userID uint, keep int) (int64, error) {
+	newest := r.db.Model(&entities.Session{}).
+		Select("id").
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(keep)
+
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND id NOT IN (?)", userID, newest).
+		Delete(&entities.Session{})
+	return result.RowsAffected, result.Error
+}
+
 // Update - обновляет данные сессии в базе данных
-func (r *sessionRepository) Update(session *entities.Session) error {
-	return r.db.Save(session).Error
+func (r *sessionRepository) Update(ctx context.Context, session *entities.Session) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Save(session).Error
+	})
 }
 
 // Delete - удаляет сессию по токену
-func (r *sessionRepository) Delete(token string) error {
-	return r.db.Where("token = ?", token).Delete(&entities.Session{}).Error
+func (r *sessionRepository) Delete(ctx context.Context, token string) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Where("token = ?", token).Delete(&entities.Session{}).Error
+	})
 }
 
 // DeleteExpired - удаляет все истекшие сессии
-func (r *sessionRepository) DeleteExpired() error {
-	return r.db.Where("expires_at < ?", time.Now()).Delete(&entities.Session{}).Error
+func (r *sessionRepository) DeleteExpired(ctx context.Context) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&entities.Session{}).Error
+	})
 }
 
 // UpdateActivity - обновляет время последней активности сессии
-func (r *sessionRepository) UpdateActivity(token string, lastActivity time.Time) error {
-	return r.db.Model(&entities.Session{}).
-		Where("token = ?", token).
-		Update("last_activity", lastActivity).Error
+func (r *sessionRepository) UpdateActivity(ctx context.Context, token string, lastActivity time.Time) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.Session{}).
+			Where("token = ?", token).
+			Update("last_activity", lastActivity).Error
+	})
 }
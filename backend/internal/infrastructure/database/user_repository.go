@@ -1,11 +1,14 @@
 package database
 
 import (
+	"context"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/repository"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type userRepository struct {
@@ -18,52 +21,91 @@ func NewUserRepository(db *gorm.DB) repository.UserRepository {
 }
 
 // Create - создает нового пользователя в базе данных
-func (r *userRepository) Create(user *entities.User) error {
-	return r.db.Create(user).Error
+func (r *userRepository) Create(ctx context.Context, user *entities.User) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Create(user).Error
+	})
 }
 
 // GetByID - получает пользователя по его ID
-func (r *userRepository) GetByID(id uint) (*entities.User, error) {
+func (r *userRepository) GetByID(ctx context.Context, id uint) (*entities.User, error) {
 	var user entities.User
-	err := r.db.First(&user, id).Error
+	err := r.db.WithContext(ctx).First(&user, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-// GetByUsername - получает пользователя по имени пользователя
-func (r *userRepository) GetByUsername(username string) (*entities.User, error) {
+// GetByIDs - получает пользователей с указанными ID одним запросом; отсутствующие ID пропускаются
+func (r *userRepository) GetByIDs(ctx context.Context, ids []uint) ([]entities.User, error) {
+	var users []entities.User
+	if len(ids) == 0 {
+		return users, nil
+	}
+	err := r.db.WithContext(ctx).Where("id IN ?", ids).Order("id").Find(&users).Error
+	return users, err
+}
+
+// GetByUsername - получает пользователя по имени пользователя без учета регистра
+func (r *userRepository) GetByUsername(ctx context.Context, username string) (*entities.User, error) {
 	var user entities.User
-	err := r.db.Where("username = ?", username).First(&user).Error
+	err := r.db.WithContext(ctx).Where("LOWER(username) = LOWER(?)", username).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-// GetByEmail - получает пользователя по email адресу
-func (r *userRepository) GetByEmail(email string) (*entities.User, error) {
+// GetByEmail - получает пользователя по email адресу без учета регистра и пробелов по краям
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*entities.User, error) {
+	normalized, err := entities.NormalizeEmail(email)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
 	var user entities.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err = r.db.WithContext(ctx).Where("LOWER(email) = ?", normalized).First(&user).Error
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// IsUsernameTaken - проверяет без учета регистра, занято ли имя пользователя кем-то, кроме excludeUserID
+func (r *userRepository) IsUsernameTaken(ctx context.Context, username string, excludeUserID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.User{}).
+		Where("LOWER(username) = LOWER(?) AND id <> ?", username, excludeUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsEmailTaken - проверяет без учета регистра и пробелов по краям, занят ли email кем-то, кроме excludeUserID
+func (r *userRepository) IsEmailTaken(ctx context.Context, email string, excludeUserID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&entities.User{}).
+		Where("LOWER(email) = LOWER(?) AND id <> ?", strings.TrimSpace(email), excludeUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // Update - обновляет данные пользователя в базе данных
-func (r *userRepository) Update(user *entities.User) error {
-	return r.db.Save(user).Error
+func (r *userRepository) Update(ctx context.Context, user *entities.User) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Save(user).Error
+	})
 }
 
 // Delete - удаляет пользователя из базы данных по ID
-func (r *userRepository) Delete(id uint) error {
-	return r.db.Delete(&entities.User{}, id).Error
+func (r *userRepository) Delete(ctx context.Context, id uint) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Delete(&entities.User{}, id).Error
+	})
 }
 
 // UpdateOnlineStatus - обновляет статус пользователя (онлайн/оффлайн)
-func (r *userRepository) UpdateOnlineStatus(userID uint, isOnline bool) error {
+func (r *userRepository) UpdateOnlineStatus(ctx context.Context, userID uint, isOnline bool) error {
 	updates := map[string]interface{}{
 		"is_online": isOnline,
 	}
@@ -72,38 +114,95 @@ func (r *userRepository) UpdateOnlineStatus(userID uint, isOnline bool) error {
 		updates["last_seen"] = time.Now()
 	}
 
-	return r.db.Model(&entities.User{}).Where("id = ?", userID).Updates(updates).Error
+	return r.db.WithContext(ctx).Model(&entities.User{}).Where("id = ?", userID).Updates(updates).Error
 }
 
 // GetOnlineUsers - получает список всех пользователей в онлайне
-func (r *userRepository) GetOnlineUsers() ([]entities.User, error) {
+func (r *userRepository) GetOnlineUsers(ctx context.Context) ([]entities.User, error) {
 	var users []entities.User
-	err := r.db.Where("is_online = ?", true).Find(&users).Error
+	err := r.db.WithContext(ctx).Where("is_online = ?", true).Find(&users).Error
 	return users, err
 }
 
+// GetContacts - получает одним запросом всех пользователей, состоящих хотя бы в одном общем чате
+// с userID, без повторов и без заблокированных в любую сторону; сначала идут те, с кем переписка была позже
+func (r *userRepository) GetContacts(ctx context.Context, userID uint) ([]entities.Contact, error) {
+	var contacts []entities.Contact
+	err := r.db.WithContext(ctx).
+		Table("chat_members AS mine").
+		Select(`users.id AS user_id, users.username, users.last_seen,
+			COUNT(DISTINCT mine.chat_id) AS shared_chats, MAX(messages.created_at) AS last_interaction_at`).
+		Joins("JOIN chats ON chats.id = mine.chat_id AND chats.deleted_at IS NULL").
+		Joins("JOIN chat_members AS other ON other.chat_id = mine.chat_id AND other.user_id <> mine.user_id").
+		Joins("JOIN users ON users.id = other.user_id AND users.deleted_at IS NULL").
+		Joins(`LEFT JOIN messages ON messages.chat_id = mine.chat_id AND messages.deleted_at IS NULL
+			AND messages.sender_id IN (mine.user_id, other.user_id)`).
+		Where("mine.user_id = ?", userID).
+		Where(`NOT EXISTS (SELECT 1 FROM user_blocks WHERE (user_blocks.blocker_id = mine.user_id AND user_blocks.blocked_id = other.user_id)
+			OR (user_blocks.blocker_id = other.user_id AND user_blocks.blocked_id = mine.user_id))`).
+		Group("users.id, users.username, users.last_seen").
+		Order("last_interaction_at DESC NULLS LAST, users.username").
+		Scan(&contacts).Error
+	return contacts, err
+}
+
+// BlockUser - блокирует пользователя; повторная блокировка ничего не меняет
+func (r *userRepository) BlockUser(ctx context.Context, blockerID, blockedID uint) error {
+	block := &entities.UserBlock{BlockerID: blockerID, BlockedID: blockedID}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(block).Error
+}
+
+// UnblockUser - снимает блокировку; снятие отсутствующей блокировки не считается ошибкой
+func (r *userRepository) UnblockUser(ctx context.Context, blockerID, blockedID uint) error {
+	return r.db.WithContext(ctx).
+		Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).
+		Delete(&entities.UserBlock{}).Error
+}
+
 // SearchUsers - ищет пользователей по имени или email с исключением указанного пользователя
-func (r *userRepository) SearchUsers(query string, excludeUserID uint, limit int) ([]entities.User, error) {
+func (r *userRepository) SearchUsers(ctx context.Context, query string, excludeUserID uint, limit, offset int) ([]entities.User, error) {
 	var users []entities.User
 
-	searchQuery := r.db.Where("(username ILIKE ? OR email ILIKE ?)", "%"+query+"%", "%"+query+"%")
-
-	if excludeUserID != 0 {
-		searchQuery = searchQuery.Where("id != ?", excludeUserID)
-	}
+	searchQuery := r.searchUsersQuery(ctx, query, excludeUserID)
 
 	if limit > 0 {
 		searchQuery = searchQuery.Limit(limit)
 	}
+	if offset > 0 {
+		searchQuery = searchQuery.Offset(offset)
+	}
 
-	orderClause := "CASE WHEN username ILIKE '" + query + "%' THEN 1 WHEN email ILIKE '" + query + "%' THEN 2 ELSE 3 END"
-	searchQuery = searchQuery.Order(orderClause)
+	// Совпадения по началу имени, затем по началу email; id делает порядок страниц стабильным
+	searchQuery = searchQuery.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:  "CASE WHEN username ILIKE ? THEN 1 WHEN email ILIKE ? THEN 2 ELSE 3 END, id",
+		Vars: []interface{}{query + "%", query + "%"},
+	}})
 
 	err := searchQuery.Find(&users).Error
 	return users, err
 }
 
+// CountSearchUsers - подсчитывает всех пользователей, подходящих под поисковый запрос
+func (r *userRepository) CountSearchUsers(ctx context.Context, query string, excludeUserID uint) (int64, error) {
+	var count int64
+	err := r.searchUsersQuery(ctx, query, excludeUserID).Model(&entities.User{}).Count(&count).Error
+	return count, err
+}
+
+// searchUsersQuery - условия поиска пользователей по имени или email
+func (r *userRepository) searchUsersQuery(ctx context.Context, query string, excludeUserID uint) *gorm.DB {
+	searchQuery := r.db.WithContext(ctx).Where("(username ILIKE ? OR email ILIKE ?)", "%"+query+"%", "%"+query+"%")
+
+	if excludeUserID != 0 {
+		searchQuery = searchQuery.Where("id != ?", excludeUserID)
+	}
+
+	return searchQuery
+}
+
 // UpdatePassword - обновляет хеш пароля пользователя
-func (r *userRepository) UpdatePassword(userID uint, passwordHash string) error {
-	return r.db.Model(&entities.User{}).Where("id = ?", userID).Update("password_hash", passwordHash).Error
+func (r *userRepository) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	return withRetry(ctx, func() error {
+		return r.db.WithContext(ctx).Model(&entities.User{}).Where("id = ?", userID).Update("password_hash", passwordHash).Error
+	})
 }
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqlRecorder - логгер GORM, запоминающий последний сформированный запрос
+type sqlRecorder struct {
+	logger.Interface
+	sql string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	r.sql, _ = fc()
+}
+
+// newDryRunDB - открывает GORM в режиме DryRun: запросы формируются, но не отправляются в базу
+func newDryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	t.Helper()
+
+	recorder := &sqlRecorder{Interface: logger.Default.LogMode(logger.Silent)}
+	db, err := gorm.Open(postgres.Open(unreachableDSN), &gorm.Config{
+		DisableAutomaticPing: true,
+		DryRun:               true,
+		Logger:               recorder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, recorder
+}
+
+func TestUsernameLookupsIgnoreCase(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	users := NewUserRepository(db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func()
+	}{
+		{"GetByUsername", func() { users.GetByUsername(ctx, "Alice") }},
+		{"IsUsernameTaken", func() { users.IsUsernameTaken(ctx, "Alice", 0) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.sql = ""
+			tt.run()
+
+			// Совпадение "Alice" и "alice" обеспечивает сравнение в нижнем регистре на стороне базы
+			if !strings.Contains(recorder.sql, "LOWER(username) = LOWER('Alice')") {
+				t.Fatalf("query does not compare usernames case-insensitively: %s", recorder.sql)
+			}
+		})
+	}
+}
+
+func TestGetContactsQueryGroupsByUser(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+
+	// Scan в режиме DryRun формирует запрос, но сообщает, что строк прочитать нельзя
+	if _, err := NewUserRepository(db).GetContacts(context.Background(), 7); !errors.Is(err, gorm.ErrDryRunModeUnsupported) {
+		t.Fatalf("GetContacts: err = %v, want %v", err, gorm.ErrDryRunModeUnsupported)
+	}
+
+	// Пользователь из двух общих чатов попадает в одну строку с числом общих чатов
+	for _, fragment := range []string{
+		"WHERE mine.user_id = 7",
+		"other.user_id <> mine.user_id",
+		"COUNT(DISTINCT mine.chat_id) AS shared_chats",
+		"GROUP BY users.id",
+	} {
+		if !strings.Contains(recorder.sql, fragment) {
+			t.Fatalf("query has no %q: %s", fragment, recorder.sql)
+		}
+	}
+}
+
+func TestGetContactsExcludesBlockedUsers(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	NewUserRepository(db).GetContacts(context.Background(), 7)
+
+	// Контакт исключается, кто бы из двоих ни заблокировал другого
+	for _, fragment := range []string{
+		"NOT EXISTS (SELECT 1 FROM user_blocks",
+		"user_blocks.blocker_id = mine.user_id AND user_blocks.blocked_id = other.user_id",
+		"user_blocks.blocker_id = other.user_id AND user_blocks.blocked_id = mine.user_id",
+	} {
+		if !strings.Contains(recorder.sql, fragment) {
+			t.Fatalf("query has no %q: %s", fragment, recorder.sql)
+		}
+	}
+	// Статус в сети берется из хаба, а не из устаревшего флага в БД
+	if strings.Contains(recorder.sql, "is_online") {
+		t.Fatalf("query reads users.is_online: %s", recorder.sql)
+	}
+}
+
+func TestGetByEmailNormalizesAddress(t *testing.T) {
+	db, recorder := newDryRunDB(t)
+	users := NewUserRepository(db)
+
+	users.GetByEmail(context.Background(), " User@Example.COM ")
+	if !strings.Contains(recorder.sql, "LOWER(email) = 'user@example.com'") {
+		t.Fatalf("query does not look up the normalized address: %s", recorder.sql)
+	}
+
+	// Некорректный адрес не доходит до базы
+	recorder.sql = ""
+	if _, err := users.GetByEmail(context.Background(), "not-an-email"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("GetByEmail(invalid): err = %v, want %v", err, gorm.ErrRecordNotFound)
+	}
+	if recorder.sql != "" {
+		t.Fatalf("invalid address was queried: %s", recorder.sql)
+	}
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"time"
+)
+
+// RunDeletedMessagePurge - периодически окончательно стирает сообщения, окно восстановления которых истекло;
+// блокируется до отмены контекста, поэтому запускается в отдельной горутине
+func RunDeletedMessagePurge(ctx context.Context, repo repository.MessageRepository, cfg *config.JobsConfig, restoreWindow time.Duration, logger *logger.Logger) {
+	if cfg.DeletedMessagePurgeInterval <= 0 || restoreWindow <= 0 {
+		logger.Info("Deleted message purge job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(cfg.DeletedMessagePurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := repo.PurgeDeleted(ctx, time.Now().Add(-restoreWindow))
+			if err != nil {
+				logger.Errorf("Failed to purge deleted messages: %v", err)
+				continue
+			}
+			if purged > 0 {
+				logger.Infof("Purged %d deleted messages", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"time"
+)
+
+// RunKeyExchangeCleanup - периодически удаляет зависшие pending-обмены ключами старше заданного возраста;
+// блокируется до отмены контекста, поэтому запускается в отдельной горутине
+func RunKeyExchangeCleanup(ctx context.Context, repo repository.KeyExchangeRepository, cfg *config.JobsConfig, logger *logger.Logger) {
+	if cfg.KeyExchangeCleanupInterval <= 0 || cfg.PendingKeyExchangeMaxAge <= 0 {
+		logger.Info("Key exchange cleanup job is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(cfg.KeyExchangeCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			olderThan := time.Now().Add(-cfg.PendingKeyExchangeMaxAge)
+			deleted, err := repo.DeleteStale(ctx, olderThan, "pending")
+			if err != nil {
+				logger.Errorf("Failed to delete stale key exchanges: %v", err)
+				continue
+			}
+			if deleted > 0 {
+				logger.Infof("Deleted %d stale pending key exchanges", deleted)
+			}
+		}
+	}
+}
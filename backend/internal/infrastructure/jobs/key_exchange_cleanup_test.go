@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memKeyExchanges - хранилище обменов ключами в памяти; сообщает о каждой очистке в cleaned
+type memKeyExchanges struct {
+	repository.KeyExchangeRepository
+	mu        sync.Mutex
+	exchanges []entities.KeyExchange
+	cleaned   chan struct{}
+}
+
+func (r *memKeyExchanges) DeleteStale(ctx context.Context, olderThan time.Time, statuses ...string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.exchanges[:0]
+	for _, exchange := range r.exchanges {
+		if exchange.UpdatedAt.Before(olderThan) && (len(statuses) == 0 || slices.Contains(statuses, exchange.Status)) {
+			continue
+		}
+		kept = append(kept, exchange)
+	}
+	deleted := int64(len(r.exchanges) - len(kept))
+	r.exchanges = kept
+
+	select {
+	case r.cleaned <- struct{}{}:
+	default:
+	}
+	return deleted, nil
+}
+
+func (r *memKeyExchanges) ids() []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]uint, len(r.exchanges))
+	for i, exchange := range r.exchanges {
+		ids[i] = exchange.ID
+	}
+	return ids
+}
+
+func TestKeyExchangeCleanupRemovesOnlyStalePending(t *testing.T) {
+	now := time.Now()
+	repo := &memKeyExchanges{
+		exchanges: []entities.KeyExchange{
+			{ID: 1, Status: "pending", UpdatedAt: now.Add(-2 * time.Hour)},
+			{ID: 2, Status: "pending", UpdatedAt: now.Add(-time.Minute)},
+			{ID: 3, Status: "active", UpdatedAt: now.Add(-2 * time.Hour)},
+		},
+		cleaned: make(chan struct{}, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunKeyExchangeCleanup(ctx, repo, &config.JobsConfig{
+			KeyExchangeCleanupInterval: 5 * time.Millisecond,
+			PendingKeyExchangeMaxAge:   time.Hour,
+		}, logger.New())
+	}()
+
+	select {
+	case <-repo.cleaned:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup did not run")
+	}
+	cancel()
+	<-done
+
+	if ids := repo.ids(); !slices.Equal(ids, []uint{2, 3}) {
+		t.Fatalf("remaining exchanges = %v, want [2 3]", ids)
+	}
+}
@@ -1,39 +1,114 @@
 package websocket
 
 import (
+	"context"
 	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/internal/infrastructure/database"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
-)
+// connTiming - таймауты и ограничение размера входящего кадра одного подключения
+type connTiming struct {
+	writeWait      time.Duration
+	pongWait       time.Duration
+	pingPeriod     time.Duration
+	maxMessageSize int64
+}
+
+// connTiming - возвращает настройки подключения из конфигурации хаба
+func (h *Hub) connTiming() connTiming {
+	return connTiming{
+		writeWait:      h.cfg.WriteWait,
+		pongWait:       h.cfg.PongWait,
+		pingPeriod:     h.cfg.PingPeriod,
+		maxMessageSize: h.cfg.MaxMessageSize,
+	}
+}
+
+// ConnectionModeNotifications - значение параметра ?mode= для подключения в режиме только уведомлений
+const ConnectionModeNotifications = "notifications"
 
 // ServeWS - обрабатывает WebSocket подключения и создает нового клиента
 func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request, user *entities.User) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		h.logger.Errorf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
+	// Сжатие применяется только если клиент согласовал расширение при рукопожатии
+	if h.cfg.EnableCompression {
+		conn.EnableWriteCompression(true)
+		if err := conn.SetCompressionLevel(h.cfg.CompressionLevel); err != nil {
+			h.logger.Errorf("Invalid WebSocket compression level %d: %v", h.cfg.CompressionLevel, err)
+		}
+	}
+
+	// Контекст клиента отменяется при отключении, прерывая незавершенные запросы к БД
+	ctx, cancel := context.WithCancel(context.Background())
+
 	client := &Client{
 		hub:    h,
 		conn:   conn,
-		send:   make(chan []byte, 256),
+		send:   make(chan []byte, h.cfg.SendBufferSize),
 		userID: user.ID,
 		user:   user,
+		ctx:    ctx,
+		cancel: cancel,
+		timing: h.connTiming(),
+
+		recentMessages: newRecentClientMessages(h.cfg.DedupSize),
+
+		notificationsOnly: r.URL.Query().Get("mode") == ConnectionModeNotifications,
+	}
+
+	// Снимок начального состояния запрашивается параметром ?snapshot=true
+	if wantSnapshot, _ := strconv.ParseBool(r.URL.Query().Get("snapshot")); wantSnapshot {
+		h.sendSnapshot(client)
+	}
+
+	client.hub.register <- client
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// ServeGuestWS - обрабатывает гостевое подключение только для чтения: клиент получает события
+// одного чата и не может ничего отправлять
+func (h *Hub) ServeGuestWS(w http.ResponseWriter, r *http.Request, chatID uint) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		h.logger.Errorf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	if h.cfg.EnableCompression {
+		conn.EnableWriteCompression(true)
+		if err := conn.SetCompressionLevel(h.cfg.CompressionLevel); err != nil {
+			h.logger.Errorf("Invalid WebSocket compression level %d: %v", h.cfg.CompressionLevel, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := &Client{
+		hub:         h,
+		conn:        conn,
+		send:        make(chan []byte, h.cfg.SendBufferSize),
+		ctx:         ctx,
+		cancel:      cancel,
+		timing:      h.connTiming(),
+		guestChatID: chatID,
 	}
 
 	client.hub.register <- client
@@ -45,14 +120,15 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request, user *entities.Use
 // readPump - читает сообщения от WebSocket клиента
 func (c *Client) readPump() {
 	defer func() {
+		c.cancel()
 		c.hub.unregister <- c
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(maxMessageSize)
-	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetReadLimit(c.timing.maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(c.timing.pongWait))
 	c.conn.SetPongHandler(func(string) error {
-		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.conn.SetReadDeadline(time.Now().Add(c.timing.pongWait))
 		return nil
 	})
 
@@ -71,7 +147,7 @@ func (c *Client) readPump() {
 
 // writePump - отправляет сообщения WebSocket клиенту
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.timing.pingPeriod)
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
@@ -80,7 +156,7 @@ func (c *Client) writePump() {
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.timing.writeWait))
 			if !ok {
 				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
@@ -103,7 +179,7 @@ func (c *Client) writePump() {
 			}
 
 		case <-ticker.C:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.SetWriteDeadline(time.Now().Add(c.timing.writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -116,7 +192,12 @@ func (c *Client) handleMessage(data []byte) {
 	var message WSMessage
 	if err := json.Unmarshal(data, &message); err != nil {
 		c.hub.logger.Errorf("Failed to unmarshal message: %v", err)
-		c.sendError("Invalid message format")
+		c.sendError(ErrorCodeBadPayload, "Invalid message format")
+		return
+	}
+
+	if c.guestChatID != 0 {
+		c.sendError(ErrorCodeReadOnly, "Guest connections are read-only")
 		return
 	}
 
@@ -128,33 +209,41 @@ func (c *Client) handleMessage(data []byte) {
 		c.handleChatMessage(message)
 	case MessageTypeKeyExchange:
 		c.handleKeyExchange(message)
+	case MessageTypeSubscribe:
+		c.handleSubscribe(message)
+	case MessageTypeUnsubscribe:
+		c.handleUnsubscribe(message)
+	case MessageTypeResume:
+		c.handleResume(message)
 	default:
-		c.sendError("Unknown message type")
+		c.sendError(ErrorCodeUnknownType, "Unknown message type")
 	}
 }
 
 // handleChatMessage - обрабатывает сообщения чата и отправляет их через usecase
 func (c *Client) handleChatMessage(message WSMessage) {
 	if message.ChatID == 0 {
-		c.sendError("Chat ID is required")
+		c.sendError(ErrorCodeInvalidChat, "Chat ID is required")
 		return
 	}
 
 	var chatData map[string]interface{}
 	dataBytes, err := json.Marshal(message.Data)
 	if err != nil {
-		c.sendError("Invalid message data format")
+		c.sendError(ErrorCodeBadPayload, "Invalid message data format")
 		return
 	}
 
 	if err := json.Unmarshal(dataBytes, &chatData); err != nil {
-		c.sendError("Invalid message data format")
+		c.sendError(ErrorCodeBadPayload, "Invalid message data format")
 		return
 	}
 
+	clientMsgID, _ := chatData["client_msg_id"].(string)
+
 	content, ok := chatData["content"].(string)
 	if !ok {
-		c.sendError("Message content is required")
+		c.sendSendFailed(message.ChatID, clientMsgID, ErrorCodeBadPayload, "Message content is required", false)
 		return
 	}
 
@@ -163,10 +252,21 @@ func (c *Client) handleChatMessage(message WSMessage) {
 		messageType = "text"
 	}
 
+	// Клиент повторяет кадр, если не дождался подтверждения; сообщение уже сохранено,
+	// поэтому только повторяем подтверждение
+	if messageID, seen := c.recentMessages.lookup(clientMsgID); seen {
+		c.sendChatAck(message.ChatID, clientMsgID, messageID, true)
+		return
+	}
+
 	req := &usecase.SendMessageRequest{
 		Content:     content,
 		MessageType: messageType,
 	}
+	if attachmentID, ok := chatData["attachment_id"].(float64); ok && attachmentID > 0 {
+		id := uint(attachmentID)
+		req.AttachmentID = &id
+	}
 
 	var ecdsaPrivateKey *ecdsa.PrivateKey
 	var rsaPrivateKey *rsa.PrivateKey
@@ -175,7 +275,7 @@ func (c *Client) handleChatMessage(message WSMessage) {
 		ecdsaPrivateKey, err = crypto.DeserializeECDSAPrivateKey([]byte(c.user.ECDSAPrivateKey))
 		if err != nil {
 			c.hub.logger.Errorf("Failed to deserialize ECDSA private key for user %d: %v", c.userID, err)
-			c.sendError("Failed to process cryptographic keys")
+			c.sendSendFailed(message.ChatID, clientMsgID, ErrorCodeInternal, "Failed to process cryptographic keys", false)
 			return
 		}
 	}
@@ -184,14 +284,15 @@ func (c *Client) handleChatMessage(message WSMessage) {
 		rsaPrivateKey, err = crypto.DeserializeRSAPrivateKey([]byte(c.user.RSAPrivateKey))
 		if err != nil {
 			c.hub.logger.Errorf("Failed to deserialize RSA private key for user %d: %v", c.userID, err)
-			c.sendError("Failed to process cryptographic keys")
+			c.sendSendFailed(message.ChatID, clientMsgID, ErrorCodeInternal, "Failed to process cryptographic keys", false)
 			return
 		}
 	}
-	sentMessage, err := c.hub.chatUseCase.SendMessage(message.ChatID, c.userID, req, ecdsaPrivateKey, rsaPrivateKey)
+	sentMessage, err := c.hub.chatUseCase.SendMessage(c.ctx, message.ChatID, c.userID, req, ecdsaPrivateKey, rsaPrivateKey)
 	if err != nil {
 		c.hub.logger.Errorf("Failed to send message via usecase: %v", err)
-		c.sendError("Failed to send message: " + err.Error())
+		code, errMsg, retryable := sendFailureFor(err)
+		c.sendSendFailed(message.ChatID, clientMsgID, code, errMsg, retryable)
 		return
 	}
 
@@ -202,8 +303,9 @@ func (c *Client) handleChatMessage(message WSMessage) {
 		Data: ChatMessage{
 			ID:             sentMessage.ID,
 			ChatID:         sentMessage.ChatID,
+			Seq:            sentMessage.Seq,
 			SenderID:       sentMessage.SenderID,
-			Content:        content,
+			Content:        req.Content,
 			MessageType:    sentMessage.MessageType,
 			Nonce:          sentMessage.Nonce,
 			IV:             sentMessage.IV,
@@ -211,28 +313,212 @@ func (c *Client) handleChatMessage(message WSMessage) {
 			ECDSASignature: sentMessage.ECDSASignature,
 			RSASignature:   sentMessage.RSASignature,
 			Timestamp:      sentMessage.CreatedAt.Unix(),
+			AttachmentID:   sentMessage.AttachmentID,
 		},
 		Timestamp: time.Now().Unix(),
 	}
 
+	c.recentMessages.remember(clientMsgID, sentMessage.ID)
+	if clientMsgID != "" {
+		c.sendChatAck(message.ChatID, clientMsgID, sentMessage.ID, false)
+	}
+
 	c.hub.SendToChat(message.ChatID, wsMessage, c.userID)
 }
 
 // handleKeyExchange - обрабатывает сообщения обмена ключами между пользователями
 func (c *Client) handleKeyExchange(message WSMessage) {
 	if message.To == 0 {
-		c.sendError("Recipient ID is required for key exchange")
+		c.sendError(ErrorCodeBadPayload, "Recipient ID is required for key exchange")
 		return
 	}
 
 	c.hub.SendToUser(message.To, message)
 }
 
-// sendError - отправляет сообщение об ошибке клиенту
-func (c *Client) sendError(errMsg string) {
+// handleSubscribe - подписывает клиента на сообщения чата после проверки членства
+func (c *Client) handleSubscribe(message WSMessage) {
+	if message.ChatID == 0 {
+		c.sendError(ErrorCodeInvalidChat, "Chat ID is required")
+		return
+	}
+
+	isMember, err := c.hub.chatUseCase.IsChatMember(c.ctx, message.ChatID, c.userID)
+	if err != nil {
+		c.hub.logger.Errorf("Failed to check chat membership for user %d: %v", c.userID, err)
+		c.sendError(ErrorCodeInternal, "Failed to subscribe to chat")
+		return
+	}
+	if !isMember {
+		c.sendError(ErrorCodeNotMember, "You are not a member of this chat")
+		return
+	}
+
+	c.subMu.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[uint]bool)
+	}
+	c.subscriptions[message.ChatID] = true
+	c.subMu.Unlock()
+
+	c.sendAck(MessageTypeSubscribe, message.ChatID)
+}
+
+// handleUnsubscribe - отписывает клиента от сообщений чата
+func (c *Client) handleUnsubscribe(message WSMessage) {
+	if message.ChatID == 0 {
+		c.sendError(ErrorCodeInvalidChat, "Chat ID is required")
+		return
+	}
+
+	c.subMu.Lock()
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[uint]bool)
+	}
+	delete(c.subscriptions, message.ChatID)
+	c.subMu.Unlock()
+
+	c.sendAck(MessageTypeUnsubscribe, message.ChatID)
+}
+
+// handleResume - воспроизводит события, пропущенные клиентом после last_seq
+func (c *Client) handleResume(message WSMessage) {
+	var req ResumeRequest
+	dataBytes, err := json.Marshal(message.Data)
+	if err != nil {
+		c.sendError(ErrorCodeBadPayload, "Invalid resume data format")
+		return
+	}
+
+	if err := json.Unmarshal(dataBytes, &req); err != nil {
+		c.sendError(ErrorCodeBadPayload, "Invalid resume data format")
+		return
+	}
+
+	c.hub.Resume(c, req.LastSeq)
+}
+
+// isSubscribed - проверяет, нужно ли доставлять клиенту сообщения чата; клиент в режиме
+// только уведомлений сообщения чатов не получает
+func (c *Client) isSubscribed(chatID uint) bool {
+	if c.notificationsOnly {
+		return false
+	}
+
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+
+	if c.subscriptions == nil {
+		return true
+	}
+	return c.subscriptions[chatID]
+}
+
+// sendAck - подтверждает клиенту выполнение управляющей команды
+func (c *Client) sendAck(messageType MessageType, chatID uint) {
+	ack := WSMessage{
+		Type:      messageType,
+		ChatID:    chatID,
+		Data:      map[string]string{"status": "ok"},
+		Timestamp: time.Now().Unix(),
+	}
+
+	data, err := json.Marshal(ack)
+	if err != nil {
+		c.hub.logger.Errorf("Failed to marshal ack message: %v", err)
+		return
+	}
+
+	c.trySend(data)
+}
+
+// sendChatAck - подтверждает отправителю сохранение сообщения с client_msg_id;
+// duplicate означает, что кадр был повторным и новое сообщение не создавалось
+func (c *Client) sendChatAck(chatID uint, clientMsgID string, messageID uint, duplicate bool) {
+	ack := WSMessage{
+		Type:   MessageTypeChatAck,
+		ChatID: chatID,
+		Data: map[string]interface{}{
+			"client_msg_id": clientMsgID,
+			"message_id":    messageID,
+			"duplicate":     duplicate,
+		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	data, err := json.Marshal(ack)
+	if err != nil {
+		c.hub.logger.Errorf("Failed to marshal chat ack message: %v", err)
+		return
+	}
+
+	c.trySend(data)
+}
+
+// sendSendFailed - сообщает отправителю, что сообщение чата не сохранено. retryable отделяет временные
+// сбои сервера (например, потерю соединения с БД), после которых тот же кадр можно отправить повторно,
+// от ошибок, при которых повтор без изменений завершится так же
+func (c *Client) sendSendFailed(chatID uint, clientMsgID string, code ErrorCode, errMsg string, retryable bool) {
+	failure := WSMessage{
+		Type:   MessageTypeSendFailed,
+		ChatID: chatID,
+		Data: map[string]interface{}{
+			"client_msg_id": clientMsgID,
+			"code":          string(code),
+			"error":         errMsg,
+			"retryable":     retryable,
+		},
+		Timestamp: time.Now().Unix(),
+	}
+
+	data, err := json.Marshal(failure)
+	if err != nil {
+		c.hub.logger.Errorf("Failed to marshal send failure message: %v", err)
+		return
+	}
+
+	if !c.trySend(data) {
+		c.hub.dropClients([]*Client{c})
+	}
+}
+
+// sendFailureFor - подбирает код, текст и признак повтора для ошибки отправки сообщения. Текст ошибок,
+// которые клиент может исправить, передается как есть; внутренние ошибки могут содержать детали БД,
+// поэтому клиент получает общий текст, а причина остается в журнале. Повтор предлагается только
+// при временных причинах
+func sendFailureFor(err error) (ErrorCode, string, bool) {
+	code := errorCodeFor(err)
+	if code != ErrorCodeInternal {
+		return code, "Failed to send message: " + err.Error(), false
+	}
+	return code, "Failed to send message due to a server error", database.IsTransientError(err)
+}
+
+// errorCodeFor - подбирает машиночитаемый код для ошибки сервиса чатов
+func errorCodeFor(err error) ErrorCode {
+	switch {
+	case errors.Is(err, usecase.ErrNotChatMember):
+		return ErrorCodeNotMember
+	case errors.Is(err, usecase.ErrRateLimited), errors.Is(err, usecase.ErrSlowMode):
+		return ErrorCodeRateLimited
+	case errors.Is(err, usecase.ErrServerKeysDisabled), errors.Is(err, usecase.ErrRatchetChat), errors.Is(err, usecase.ErrInvalidContent), errors.Is(err, usecase.ErrContentRejected),
+		errors.Is(err, usecase.ErrInvalidMessageType):
+		return ErrorCodeBadPayload
+	case errors.Is(err, usecase.ErrNoRecipients):
+		return ErrorCodeInvalidChat
+	case errors.Is(err, usecase.ErrAttachmentNotFound):
+		return ErrorCodeBadPayload
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// sendError - отправляет клиенту сообщение об ошибке с машиночитаемым кодом и текстом
+func (c *Client) sendError(code ErrorCode, errMsg string) {
 	errorMessage := WSMessage{
 		Type: MessageTypeError,
 		Data: map[string]string{
+			"code":  string(code),
 			"error": errMsg,
 		},
 		Timestamp: time.Now().Unix(),
@@ -244,9 +530,7 @@ func (c *Client) sendError(errMsg string) {
 		return
 	}
 
-	select {
-	case c.send <- data:
-	default:
-		close(c.send)
+	if !c.trySend(data) {
+		c.hub.dropClients([]*Client{c})
 	}
 }
@@ -0,0 +1,338 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestSendFailureFor(t *testing.T) {
+	deadlock := &pgconn.PgError{Code: "40P01", Message: "deadlock detected"}
+	missingTable := &pgconn.PgError{Code: "42P01", Message: `relation "messages" does not exist`}
+
+	tests := []struct {
+		name          string
+		err           error
+		wantCode      ErrorCode
+		wantRetryable bool
+		wantDetail    string
+	}{
+		{"not a member", usecase.ErrNotChatMember, ErrorCodeNotMember, false, usecase.ErrNotChatMember.Error()},
+		{"rate limited", usecase.ErrRateLimited, ErrorCodeRateLimited, false, usecase.ErrRateLimited.Error()},
+		{"content rejected", fmt.Errorf("%w: too long", usecase.ErrInvalidContent), ErrorCodeBadPayload, false, "too long"},
+		{"transient DB failure", fmt.Errorf("failed to save message: %w", deadlock), ErrorCodeInternal, true, ""},
+		{"request timeout", fmt.Errorf("failed to get chat: %w", context.DeadlineExceeded), ErrorCodeInternal, true, ""},
+		{"permanent DB failure", fmt.Errorf("failed to save message: %w", missingTable), ErrorCodeInternal, false, ""},
+		{"unknown error", errors.New("unexpected"), ErrorCodeInternal, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message, retryable := sendFailureFor(tt.err)
+			if code != tt.wantCode || retryable != tt.wantRetryable {
+				t.Fatalf("sendFailureFor = %s, retryable %v; want %s, %v", code, retryable, tt.wantCode, tt.wantRetryable)
+			}
+			if tt.wantDetail != "" && !strings.Contains(message, tt.wantDetail) {
+				t.Fatalf("message %q does not explain %q", message, tt.wantDetail)
+			}
+			// Внутренние ошибки не раскрывают клиенту подробности БД
+			if code == ErrorCodeInternal && strings.Contains(message, tt.err.Error()) {
+				t.Fatalf("internal error text leaked to the client: %q", message)
+			}
+		})
+	}
+}
+
+// handleFrame - передает клиенту входящий кадр, как если бы его прочитал readPump
+func handleFrame(t *testing.T, client *Client, message WSMessage) {
+	t.Helper()
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.handleMessage(data)
+}
+
+func TestSubscriptionControlsChatDelivery(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}, 11: {1, 2}})
+	alice := addTestClient(h, 1)
+	chatFrame := func(chatID uint) WSMessage {
+		return WSMessage{Type: MessageTypeChat, ChatID: chatID, Data: map[string]string{"content": "hi"}}
+	}
+
+	// Подписка на один чат отключает доставку остальных
+	handleFrame(t, alice, WSMessage{Type: MessageTypeSubscribe, ChatID: 11})
+	if ack := readFrame(t, alice); ack.Type != MessageTypeSubscribe || ack.ChatID != 11 {
+		t.Fatalf("subscribe ack = %+v", ack)
+	}
+	if err := h.SendToChat(10, chatFrame(10), 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(alice.send) != 0 {
+		t.Fatal("message of an unsubscribed chat was pushed")
+	}
+	if err := h.SendToChat(11, chatFrame(11), 2); err != nil {
+		t.Fatal(err)
+	}
+	if message := readFrame(t, alice); message.Type != MessageTypeChat || message.ChatID != 11 {
+		t.Fatalf("frame = %+v, want chat 11 message", message)
+	}
+
+	handleFrame(t, alice, WSMessage{Type: MessageTypeSubscribe, ChatID: 10})
+	readFrame(t, alice)
+	if err := h.SendToChat(10, chatFrame(10), 2); err != nil {
+		t.Fatal(err)
+	}
+	if message := readFrame(t, alice); message.Type != MessageTypeChat || message.ChatID != 10 {
+		t.Fatalf("frame after subscribe = %+v, want chat 10 message", message)
+	}
+
+	// Подписаться на чужой чат нельзя
+	handleFrame(t, alice, WSMessage{Type: MessageTypeSubscribe, ChatID: 12})
+	if message := readFrame(t, alice); message.Type != MessageTypeError {
+		t.Fatalf("subscribe to foreign chat = %+v, want error", message)
+	}
+}
+
+func TestChatFrameToForeignChatReportsNotMember(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}, 12: {2, 3}})
+	alice := addTestClient(h, 1)
+
+	handleFrame(t, alice, WSMessage{Type: MessageTypeChat, ChatID: 12, Data: map[string]string{"content": "hi", "client_msg_id": "m1"}})
+
+	message := readFrame(t, alice)
+	if message.Type != MessageTypeSendFailed {
+		t.Fatalf("frame type = %q, want %q", message.Type, MessageTypeSendFailed)
+	}
+	data := message.Data.(map[string]interface{})
+	if data["code"] != string(ErrorCodeNotMember) || data["retryable"] != false || data["client_msg_id"] != "m1" {
+		t.Fatalf("failure = %v, want non-retryable %s for m1", data, ErrorCodeNotMember)
+	}
+
+	handleFrame(t, alice, WSMessage{Type: "bogus"})
+	message = readFrame(t, alice)
+	if data := message.Data.(map[string]interface{}); message.Type != MessageTypeError || data["code"] != string(ErrorCodeUnknownType) {
+		t.Fatalf("unknown frame reply = %+v, want %s error", message, ErrorCodeUnknownType)
+	}
+}
+
+// readConnFrame - читает кадры соединения, пока не встретится кадр нужного типа; кадры,
+// объединенные writePump через перевод строки, разбираются по отдельности
+func readConnFrame(t *testing.T, conn *websocket.Conn, messageType MessageType) WSMessage {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		for _, frame := range bytes.Split(data, []byte{'\n'}) {
+			var message WSMessage
+			if err := json.Unmarshal(frame, &message); err != nil {
+				t.Fatalf("invalid frame: %v", err)
+			}
+			if message.Type == messageType {
+				return message
+			}
+		}
+	}
+}
+
+func TestLargeMessageRoundTripWithCompression(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("compression=%v", enabled), func(t *testing.T) {
+			h := NewHub(logger.New(), nil, &config.WebSocketConfig{
+				SendBufferSize:    16,
+				SendTimeout:       time.Second,
+				MaxSendFailures:   3,
+				DedupSize:         16,
+				WriteWait:         time.Second,
+				PongWait:          10 * time.Second,
+				PingPeriod:        9 * time.Second,
+				MaxMessageSize:    1 << 20,
+				EnableCompression: enabled,
+				CompressionLevel:  1,
+			})
+			go h.Run()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h.ServeWS(w, r, &entities.User{ID: 1, Username: "alice"})
+			}))
+			defer server.Close()
+
+			dialer := websocket.Dialer{EnableCompression: true}
+			conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+
+			negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+			if negotiated != enabled {
+				t.Fatalf("permessage-deflate negotiated = %v, want %v", negotiated, enabled)
+			}
+			readConnFrame(t, conn, MessageTypeUserStatus)
+
+			// Несжимаемый шифротекст в base64, как в зашифрованных сообщениях
+			raw := make([]byte, 96*1024)
+			if _, err := rand.Read(raw); err != nil {
+				t.Fatal(err)
+			}
+			ciphertext := base64.StdEncoding.EncodeToString(raw)
+
+			if err := h.SendToUser(1, WSMessage{Type: MessageTypeChat, ChatID: 10, Data: ciphertext}); err != nil {
+				t.Fatalf("SendToUser: %v", err)
+			}
+			if got := readConnFrame(t, conn, MessageTypeChat); got.Data != ciphertext {
+				t.Fatalf("received %d bytes of data, want the original %d", len(fmt.Sprint(got.Data)), len(ciphertext))
+			}
+
+			// Большой сжатый кадр от клиента разбирается readPump: на неизвестный тип приходит ошибка
+			conn.EnableWriteCompression(true)
+			if err := conn.WriteJSON(WSMessage{Type: "large_unknown", Data: ciphertext}); err != nil {
+				t.Fatalf("WriteJSON: %v", err)
+			}
+			reply := readConnFrame(t, conn, MessageTypeError)
+			if data, _ := reply.Data.(map[string]interface{}); data["code"] != string(ErrorCodeUnknownType) {
+				t.Fatalf("reply = %+v, want %s error", reply.Data, ErrorCodeUnknownType)
+			}
+		})
+	}
+}
+
+func TestDuplicateClientMsgIDStoredOnce(t *testing.T) {
+	chatKey, err := crypto.GenerateNonce(crypto.AESKeySize + crypto.HMACKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := newServerKeyUser(t, 1)
+	chats := &keyedChats{memberChats: &memberChats{members: map[uint][]uint{10: {1, 2}}}, key: hex.EncodeToString(chatKey)}
+	users := &keyedUsers{users: map[uint]*entities.User{1: alice, 2: newServerKeyUser(t, 2)}}
+	messages := &editableMessages{messages: make(map[uint]*entities.Message)}
+
+	h := newTestHub()
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, messages, users, nil, h, h, &config.ChatConfig{
+		MaxMessagesPerMinute: 100,
+		AllowedMessageTypes:  []string{"text"},
+	}, logger.New(), nil, nil))
+	client := addTestClient(h, 1)
+	client.user = alice
+
+	frame := WSMessage{Type: MessageTypeChat, ChatID: 10, Data: map[string]string{"content": "hello", "client_msg_id": "m1"}}
+	var acks []map[string]interface{}
+	for i := 0; i < 2; i++ {
+		handleFrame(t, client, frame)
+		ack := readFrame(t, client)
+		if ack.Type != MessageTypeChatAck {
+			t.Fatalf("attempt %d: frame = %q, want %q", i+1, ack.Type, MessageTypeChatAck)
+		}
+		acks = append(acks, ack.Data.(map[string]interface{}))
+
+		// Новое сообщение рассылается в чат, в том числе другим подключениям отправителя;
+		// повтор только подтверждается
+		if i == 0 {
+			if echo := readFrame(t, client); echo.Type != MessageTypeChat {
+				t.Fatalf("frame after ack = %q, want %q", echo.Type, MessageTypeChat)
+			}
+		} else if len(client.send) != 0 {
+			t.Fatal("duplicate frame was broadcast again")
+		}
+	}
+
+	if len(messages.messages) != 1 {
+		t.Fatalf("%d messages stored, want 1", len(messages.messages))
+	}
+	// Повтор подтверждается тем же ID сообщения и помечается как дубликат
+	if acks[0]["message_id"] != acks[1]["message_id"] {
+		t.Fatalf("acks reference messages %v and %v", acks[0]["message_id"], acks[1]["message_id"])
+	}
+	if acks[0]["duplicate"] == true || acks[1]["duplicate"] != true {
+		t.Fatalf("duplicate flags = %v, %v; want false, true", acks[0]["duplicate"], acks[1]["duplicate"])
+	}
+}
+
+func TestServeWSAppliesConfiguredTiming(t *testing.T) {
+	cfg := &config.WebSocketConfig{
+		SendBufferSize:  16,
+		SendTimeout:     time.Second,
+		MaxSendFailures: 3,
+		DedupSize:       16,
+		WriteWait:       time.Second,
+		PongWait:        2 * time.Second,
+		PingPeriod:      50 * time.Millisecond,
+		MaxMessageSize:  128,
+	}
+	h := NewHub(logger.New(), nil, cfg)
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeWS(w, r, &entities.User{ID: 1, Username: "alice"})
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	readConnFrame(t, conn, MessageTypeUserStatus)
+
+	h.mu.RLock()
+	var client *Client
+	for c := range h.userClients[1] {
+		client = c
+	}
+	h.mu.RUnlock()
+	want := connTiming{writeWait: cfg.WriteWait, pongWait: cfg.PongWait, pingPeriod: cfg.PingPeriod, maxMessageSize: cfg.MaxMessageSize}
+	if client == nil || client.timing != want {
+		t.Fatalf("client timing = %+v, want %+v", client, want)
+	}
+
+	// Ping приходит с заданным интервалом
+	pinged := make(chan struct{}, 1)
+	conn.SetPingHandler(func(string) error {
+		select {
+		case pinged <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	go conn.ReadMessage()
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("no ping within the configured period")
+	}
+
+	// Кадр больше MaxMessageSize закрывает подключение
+	if err := conn.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("x"), 256)); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for h.IsUserOnline(1) {
+		if time.Now().After(deadline) {
+			t.Fatal("oversized frame did not close the connection")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
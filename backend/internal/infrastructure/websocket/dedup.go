@@ -0,0 +1,52 @@
+package websocket
+
+// recentClientMessages - ограниченный по размеру набор недавних client_msg_id подключения
+// и ID созданных по ним сообщений. Используется только из readPump клиента, поэтому без блокировок;
+// при переполнении вытесняется самый старый ID
+type recentClientMessages struct {
+	ids   map[string]uint
+	order []string
+	size  int
+}
+
+// newRecentClientMessages - создает набор на size последних ID; при size <= 0 возвращает nil
+// и повторная отправка не отслеживается
+func newRecentClientMessages(size int) *recentClientMessages {
+	if size <= 0 {
+		return nil
+	}
+
+	return &recentClientMessages{
+		ids:   make(map[string]uint, size),
+		order: make([]string, 0, size),
+		size:  size,
+	}
+}
+
+// lookup - возвращает ID сообщения, уже созданного для clientMsgID
+func (r *recentClientMessages) lookup(clientMsgID string) (uint, bool) {
+	if r == nil || clientMsgID == "" {
+		return 0, false
+	}
+
+	messageID, ok := r.ids[clientMsgID]
+	return messageID, ok
+}
+
+// remember - запоминает, что для clientMsgID создано сообщение messageID
+func (r *recentClientMessages) remember(clientMsgID string, messageID uint) {
+	if r == nil || clientMsgID == "" {
+		return
+	}
+	if _, ok := r.ids[clientMsgID]; ok {
+		return
+	}
+
+	if len(r.order) == r.size {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+
+	r.ids[clientMsgID] = messageID
+	r.order = append(r.order, clientMsgID)
+}
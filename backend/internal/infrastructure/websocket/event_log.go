@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// seqsPerMillisecond - шаг начального номера журнала: номера нового журнала начинаются с времени
+// его создания в миллисекундах, умноженного на этот шаг, и остаются точными числами в JavaScript
+const seqsPerMillisecond = 1000
+
+type loggedEvent struct {
+	seq    uint64
+	chatID uint
+	data   []byte
+	// notification - событие является уведомлением и доставляется клиентам в режиме только уведомлений
+	notification bool
+}
+
+// eventLog - журнал исходящих событий пользователя с монотонно растущими номерами;
+// touchedAt - время последнего события или отключения последнего клиента пользователя
+type eventLog struct {
+	lastSeq   uint64
+	events    []loggedEvent
+	touchedAt time.Time
+}
+
+// eventLogs - журналы событий всех пользователей, включая отключенных. maxEvents - сколько последних
+// событий хранится на пользователя (WS_REPLAY_EVENTS, меньше буфера send, чтобы воспроизведение
+// целиком помещалось в очередь клиента)
+type eventLogs struct {
+	mu        sync.Mutex
+	logs      map[uint]*eventLog
+	maxEvents int
+}
+
+// seqBase - начальный номер нового журнала. Номера отсчитываются от времени создания журнала,
+// поэтому после вытеснения журнала или перезапуска сервера номера не выдаются повторно:
+// resume с номером из прежнего журнала заканчивается RESUME_GAP, а не молчаливым пропуском событий
+func seqBase(now time.Time) uint64 {
+	return uint64(now.UnixMilli()) * seqsPerMillisecond
+}
+
+// logFor - возвращает журнал пользователя, создавая его при необходимости; вызывается под l.mu
+func (l *eventLogs) logFor(userID uint, now time.Time) *eventLog {
+	if l.logs == nil {
+		l.logs = make(map[uint]*eventLog)
+	}
+
+	log, ok := l.logs[userID]
+	if !ok {
+		log = &eventLog{lastSeq: seqBase(now), touchedAt: now}
+		l.logs[userID] = log
+	}
+	return log
+}
+
+// ResumeRequest - данные команды resume: номер последнего полученного клиентом события
+type ResumeRequest struct {
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// record - присваивает событию следующий номер пользователя, сериализует его через build
+// и сохраняет в журнал; chatID = 0 означает событие, не привязанное к подписке на чат
+func (l *eventLogs) record(userID, chatID uint, build func(seq uint64) ([]byte, error)) ([]byte, error) {
+	return l.add(userID, chatID, false, build)
+}
+
+// recordNotification - журналирует уведомление пользователя; уведомления не привязаны к подписке на чат
+func (l *eventLogs) recordNotification(userID uint, build func(seq uint64) ([]byte, error)) ([]byte, error) {
+	return l.add(userID, 0, true, build)
+}
+
+// add - присваивает событию следующий номер пользователя и сохраняет его в журнал
+func (l *eventLogs) add(userID, chatID uint, notification bool, build func(seq uint64) ([]byte, error)) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	log := l.logFor(userID, now)
+
+	seq := log.lastSeq + 1
+	data, err := build(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	log.lastSeq = seq
+	log.touchedAt = now
+	log.events = append(log.events, loggedEvent{seq: seq, chatID: chatID, data: data, notification: notification})
+	if len(log.events) > l.maxEvents {
+		log.events = append([]loggedEvent(nil), log.events[len(log.events)-l.maxEvents:]...)
+	}
+
+	return data, nil
+}
+
+// since - возвращает события с номером больше lastSeq в порядке их появления и текущий номер;
+// complete = false, если часть пропущенных событий уже вытеснена из журнала
+func (l *eventLogs) since(userID uint, lastSeq uint64) (events []loggedEvent, currentSeq uint64, complete bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log, ok := l.logs[userID]
+	if !ok {
+		return nil, 0, lastSeq == 0
+	}
+
+	// Номер больше текущего означает, что журнал был создан заново, а часы сервера переведены назад;
+	// номер из вытесненного или сброшенного перезапуском журнала отсекается проверкой полноты ниже
+	if lastSeq > log.lastSeq {
+		return nil, log.lastSeq, false
+	}
+	if lastSeq == log.lastSeq {
+		return nil, log.lastSeq, true
+	}
+
+	complete = len(log.events) > 0 && log.events[0].seq <= lastSeq+1
+	for _, event := range log.events {
+		if event.seq > lastSeq {
+			events = append(events, event)
+		}
+	}
+
+	return events, log.lastSeq, complete
+}
+
+// current - возвращает номер последнего события пользователя; журнал создается, если его нет,
+// чтобы номер из снимка при подключении относился к тому же журналу, что и последующие события
+func (l *eventLogs) current(userID uint) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.logFor(userID, time.Now()).lastSeq
+}
+
+// touch - отмечает отключение последнего клиента пользователя: окно воспроизведения отсчитывается
+// от этого момента, а не от последнего события
+func (l *eventLogs) touch(userID uint, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if log, ok := l.logs[userID]; ok {
+		log.touchedAt = now
+	}
+}
+
+// evictIdle - удаляет журналы пользователей без подключений, не получавших событий и не
+// отключавшихся после idleBefore, и возвращает число удаленных журналов
+func (l *eventLogs) evictIdle(idleBefore time.Time, connected map[uint]bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for userID, log := range l.logs {
+		if connected[userID] || log.touchedAt.After(idleBefore) {
+			continue
+		}
+		delete(l.logs, userID)
+		evicted++
+	}
+	return evicted
+}
+
+// marshalWithSeq - сериализует сообщение, проставив номер события
+func marshalWithSeq(message WSMessage) func(seq uint64) ([]byte, error) {
+	return func(seq uint64) ([]byte, error) {
+		message.Seq = seq
+		return json.Marshal(message)
+	}
+}
@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func recordN(t *testing.T, l *eventLogs, userID uint, n int) uint64 {
+	t.Helper()
+
+	var last uint64
+	for i := 0; i < n; i++ {
+		if _, err := l.record(userID, 0, func(seq uint64) ([]byte, error) {
+			last = seq
+			return []byte(fmt.Sprintf(`{"seq":%d}`, seq)), nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return last
+}
+
+func TestEventLogKeepsLastMaxEvents(t *testing.T) {
+	l := &eventLogs{maxEvents: 3}
+	start := l.current(1)
+	last := recordN(t, l, 1, 5)
+
+	if last != start+5 {
+		t.Fatalf("last seq = %d, want %d", last, start+5)
+	}
+
+	events, current, complete := l.since(1, start+2)
+	if !complete || current != last || len(events) != 3 {
+		t.Fatalf("since(start+2) = %d events, current %d, complete %v", len(events), current, complete)
+	}
+
+	if _, _, complete := l.since(1, start+1); complete {
+		t.Fatal("resume past the evicted event reported complete")
+	}
+}
+
+func TestEventLogEvictionDoesNotReuseSeq(t *testing.T) {
+	l := &eventLogs{maxEvents: 10}
+	seen := recordN(t, l, 1, 3)
+
+	if evicted := l.evictIdle(time.Now().Add(time.Second), nil); evicted != 1 {
+		t.Fatalf("evicted = %d, want 1", evicted)
+	}
+
+	// Журнал, созданный после вытеснения, не должен выдавать номера, которые клиент уже видел
+	time.Sleep(2 * time.Millisecond)
+	recordN(t, l, 1, 5)
+
+	events, _, complete := l.since(1, seen)
+	if complete {
+		t.Fatalf("resume from evicted log reported complete with %d events", len(events))
+	}
+}
+
+func TestEventLogEvictIdleSkipsConnectedAndRecent(t *testing.T) {
+	l := &eventLogs{maxEvents: 10}
+	recordN(t, l, 1, 1)
+	recordN(t, l, 2, 1)
+	recordN(t, l, 3, 1)
+
+	cutoff := time.Now().Add(time.Second)
+	l.touch(3, cutoff.Add(time.Second))
+
+	if evicted := l.evictIdle(cutoff, map[uint]bool{1: true}); evicted != 1 {
+		t.Fatalf("evicted = %d, want 1", evicted)
+	}
+	if _, ok := l.logs[2]; ok {
+		t.Fatal("idle disconnected user log was kept")
+	}
+	if _, ok := l.logs[1]; !ok {
+		t.Fatal("connected user log was evicted")
+	}
+	if _, ok := l.logs[3]; !ok {
+		t.Fatal("recently disconnected user log was evicted")
+	}
+}
+
+func hasEventLog(h *Hub, userID uint) bool {
+	h.events.mu.Lock()
+	defer h.events.mu.Unlock()
+
+	_, ok := h.events.logs[userID]
+	return ok
+}
+
+func TestHubEvictsLogsAfterLastClientDisconnects(t *testing.T) {
+	h := newTestHub()
+	h.cfg.ReplayWindow = time.Minute
+	go h.Run()
+
+	client := newTestClient(h, 1)
+	registerClient(t, h, client)
+	if err := h.SendToUser(1, WSMessage{Type: MessageTypeNotification}); err != nil {
+		t.Fatal(err)
+	}
+	readFrame(t, client)
+
+	// Подключенный пользователь не теряет журнал, даже если событий давно не было
+	h.evictEventLogs(time.Now().Add(time.Hour))
+	if !hasEventLog(h, 1) {
+		t.Fatal("connected user log was evicted")
+	}
+
+	h.unregister <- client
+	for range client.send {
+	}
+
+	// Окно отсчитывается от отключения: сразу после него журнал сохраняется
+	h.evictEventLogs(time.Now())
+	if !hasEventLog(h, 1) {
+		t.Fatal("log evicted before the replay window passed")
+	}
+
+	h.evictEventLogs(time.Now().Add(2 * time.Minute))
+	if hasEventLog(h, 1) {
+		t.Fatal("log kept after the replay window passed")
+	}
+}
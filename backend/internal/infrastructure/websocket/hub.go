@@ -1,12 +1,16 @@
 package websocket
 
 import (
+	"context"
+	"sleek-chat-backend/internal/crypto"
 	"sleek-chat-backend/internal/domain/entities"
 	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/config"
 	"sleek-chat-backend/pkg/logger"
 	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,16 +20,39 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	// Клиент, передавший токен в Sec-WebSocket-Protocol, получает в ответе AuthSubprotocol -
+	// без выбранного подпротокола браузер разрывает соединение
+	Subprotocols: []string{AuthSubprotocol},
+}
+
+// newUpgrader - создает upgrader для подключений хаба; при enableCompression сервер
+// согласует permessage-deflate с клиентами, которые его поддерживают
+func newUpgrader(enableCompression bool) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin:       upgrader.CheckOrigin,
+		Subprotocols:      upgrader.Subprotocols,
+		EnableCompression: enableCompression,
+	}
 }
 
 type Hub struct {
 	clients     map[*Client]bool
-	broadcast   chan []byte
-	register    chan *Client
-	unregister  chan *Client
-	logger      *logger.Logger
-	chatUseCase *usecase.ChatUseCase
-	mu          sync.RWMutex
+	userClients map[uint]map[*Client]bool
+	// guestClients - гостевые подключения только для чтения по ID чата; в clients и userClients не входят
+	guestClients map[uint]map[*Client]bool
+	broadcast    chan []byte
+	register     chan *Client
+	unregister   chan *Client
+	logger       *logger.Logger
+	chatUseCase  *usecase.ChatUseCase
+	// notifications - очередь уведомлений, которые не удалось доставить; nil - недоставленные теряются
+	notifications *usecase.NotificationQueue
+	mu            sync.RWMutex
+	events        eventLogs
+	cfg           *config.WebSocketConfig
+	upgrader      *websocket.Upgrader
+	// relayed - число кадров, поставленных в очередь отправки клиентов с запуска хаба
+	relayed atomic.Uint64
 }
 
 type Client struct {
@@ -34,6 +61,31 @@ type Client struct {
 	send   chan []byte
 	userID uint
 	user   *entities.User
+	ctx    context.Context
+	cancel context.CancelFunc
+	timing connTiming
+
+	// subscriptions - чаты, на которые подписан клиент; nil означает, что клиент
+	// ни разу не подписывался и получает сообщения всех своих чатов
+	subscriptions map[uint]bool
+	subMu         sync.RWMutex
+
+	// sendMu защищает send от отправки после закрытия и от повторного закрытия
+	sendMu sync.RWMutex
+	closed bool
+	// sendFailures - число кадров подряд, не поместившихся в буфер за отведенное время
+	sendFailures atomic.Int32
+
+	// recentMessages - недавние client_msg_id, чтобы повторно отправленный кадр не создавал дубликат
+	recentMessages *recentClientMessages
+
+	// notificationsOnly - облегченное подключение (например, мобильный клиент в фоне), которое
+	// получает только уведомления без сообщений чатов, статусов и прочих событий
+	notificationsOnly bool
+
+	// guestChatID - для гостевого подключения только для чтения: единственный чат, события
+	// которого получает клиент; 0 для обычных пользователей
+	guestChatID uint
 }
 
 type MessageType string
@@ -44,10 +96,43 @@ const (
 	MessageTypeUserStatus   MessageType = "user_status"
 	MessageTypeKeyExchange  MessageType = "key_exchange"
 	MessageTypeError        MessageType = "error"
+	MessageTypeSubscribe    MessageType = "subscribe_chat"
+	MessageTypeUnsubscribe  MessageType = "unsubscribe_chat"
+	MessageTypeStatus       MessageType = "message_status"
+	MessageTypeKeyRotated   MessageType = "key_rotated"
+	MessageTypeEdited       MessageType = "message_edited"
+	MessageTypeDeleted      MessageType = "message_deleted"
+	MessageTypeResume       MessageType = "resume"
+	MessageTypeRoleChanged  MessageType = "role_changed"
+	// MessageTypeChatAck - подтверждение сообщения с client_msg_id. Данные: {client_msg_id, message_id, duplicate}
+	MessageTypeChatAck MessageType = "chat_ack"
+	// MessageTypeSnapshot - начальное состояние, отправляемое первым кадром при подключении с ?snapshot=true
+	MessageTypeSnapshot MessageType = "snapshot"
+	// MessageTypeSendFailed - сообщение чата не сохранено. Данные: {client_msg_id, code, error, retryable};
+	// retryable = true означает временный сбой сервера, после которого кадр можно отправить повторно
+	MessageTypeSendFailed MessageType = "message_send_failed"
+)
+
+// ErrorCode - машиночитаемый код ошибки в сообщении типа error
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidChat ErrorCode = "INVALID_CHAT"
+	ErrorCodeNotMember   ErrorCode = "NOT_MEMBER"
+	ErrorCodeRateLimited ErrorCode = "RATE_LIMITED"
+	ErrorCodeBadPayload  ErrorCode = "BAD_PAYLOAD"
+	ErrorCodeUnknownType ErrorCode = "UNKNOWN_TYPE"
+	ErrorCodeInternal    ErrorCode = "INTERNAL_ERROR"
+	ErrorCodeReadOnly    ErrorCode = "READ_ONLY"
+	// ErrorCodeResumeGap - часть пропущенных событий недоступна, клиенту нужно перезагрузить состояние
+	ErrorCodeResumeGap ErrorCode = "RESUME_GAP"
 )
 
+// WSMessage - кадр WebSocket. Seq - номер события в потоке пользователя, растет монотонно
+// и используется командой resume для повторной доставки пропущенных событий
 type WSMessage struct {
 	Type      MessageType `json:"type"`
+	Seq       uint64      `json:"seq,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp int64       `json:"timestamp"`
 	From      uint        `json:"from,omitempty"`
@@ -55,18 +140,41 @@ type WSMessage struct {
 	ChatID    uint        `json:"chat_id,omitempty"`
 }
 
+// Snapshot - начальное состояние пользователя на момент подключения. LastSeq - номер последнего
+// события до сборки снимка: командой resume с ним клиент получит события, случившиеся после.
+// KeyVersions - текущая версия ключа каждого чата, чтобы клиент, бывший офлайн во время
+// ротации, узнал новый ключ без пропущенного события key_rotated
+type Snapshot struct {
+	Chats          []entities.Chat `json:"chats"`
+	OnlineContacts []uint          `json:"online_contacts"`
+	KeyVersions    map[uint]int    `json:"key_versions"`
+	LastSeq        uint64          `json:"last_seq"`
+}
+
 type ChatMessage struct {
 	ID             uint   `json:"id"`
 	ChatID         uint   `json:"chat_id"`
+	Seq            int64  `json:"seq"`
 	SenderID       uint   `json:"sender_id"`
 	Content        string `json:"content"`
 	MessageType    string `json:"message_type"`
+	Status         string `json:"status"`
 	Nonce          string `json:"nonce"`
 	IV             string `json:"iv"`
 	HMAC           string `json:"hmac"`
 	ECDSASignature string `json:"ecdsa_signature"`
 	RSASignature   string `json:"rsa_signature"`
 	Timestamp      int64  `json:"timestamp"`
+	// ClientEncrypted - Content содержит шифротекст, зашифрованный на клиенте
+	ClientEncrypted bool `json:"client_encrypted,omitempty"`
+	// KeyVersion - версия ключа чата, которым клиент зашифровал сообщение
+	KeyVersion int `json:"key_version,omitempty"`
+	// RatchetHeader - заголовок сообщения в чате с Double Ratchet
+	RatchetHeader *crypto.RatchetHeader `json:"ratchet_header,omitempty"`
+	// ForwardedFromID - ID исходного сообщения для пересланных сообщений
+	ForwardedFromID *uint `json:"forwarded_from_id,omitempty"`
+	// AttachmentID - вложение, привязанное к сообщению
+	AttachmentID *uint `json:"attachment_id,omitempty"`
 }
 
 type UserStatusMessage struct {
@@ -76,14 +184,19 @@ type UserStatusMessage struct {
 }
 
 // NewHub - создает новый экземпляр WebSocket хаба
-func NewHub(logger *logger.Logger, chatUseCase *usecase.ChatUseCase) *Hub {
+func NewHub(logger *logger.Logger, chatUseCase *usecase.ChatUseCase, cfg *config.WebSocketConfig) *Hub {
 	return &Hub{
-		clients:     make(map[*Client]bool),
-		broadcast:   make(chan []byte),
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		logger:      logger,
-		chatUseCase: chatUseCase,
+		clients:      make(map[*Client]bool),
+		userClients:  make(map[uint]map[*Client]bool),
+		guestClients: make(map[uint]map[*Client]bool),
+		broadcast:    make(chan []byte),
+		register:     make(chan *Client),
+		unregister:   make(chan *Client),
+		logger:       logger,
+		chatUseCase:  chatUseCase,
+		events:       eventLogs{maxEvents: cfg.ReplayEvents},
+		cfg:          cfg,
+		upgrader:     newUpgrader(cfg.EnableCompression),
 	}
 }
 
@@ -92,47 +205,231 @@ func (h *Hub) SetChatUseCase(chatUseCase *usecase.ChatUseCase) {
 	h.chatUseCase = chatUseCase
 }
 
+// SetNotificationQueue - устанавливает очередь недоставленных уведомлений
+func (h *Hub) SetNotificationQueue(queue *usecase.NotificationQueue) {
+	h.notifications = queue
+}
+
 // Run - запускает основной цикл обработки WebSocket событий
 func (h *Hub) Run() {
+	var evict <-chan time.Time
+	if h.cfg.ReplayWindow > 0 {
+		ticker := time.NewTicker(h.cfg.ReplayWindow)
+		defer ticker.Stop()
+		evict = ticker.C
+	}
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client] = true
+			h.addClient(client)
 			h.mu.Unlock()
 
+			if client.guestChatID != 0 {
+				h.logger.Infof("Guest client connected: chat_id=%d", client.guestChatID)
+				continue
+			}
+
 			h.logger.Infof("Client connected: user_id=%d", client.userID)
 
 			h.broadcastUserStatus(client.userID, client.user.Username, true)
 
+			go h.flushStoredNotifications(client.userID)
+
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.removeClient(client)
 			h.mu.Unlock()
+			client.closeSend()
+
+			if client.guestChatID != 0 {
+				h.logger.Infof("Guest client disconnected: chat_id=%d", client.guestChatID)
+				continue
+			}
 
 			h.logger.Infof("Client disconnected: user_id=%d", client.userID)
 
 			h.broadcastUserStatus(client.userID, client.user.Username, false)
 
 		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+			h.deliverToAll(message)
+
+		case now := <-evict:
+			h.evictEventLogs(now)
+		}
+	}
+}
+
+// evictEventLogs - удаляет журналы событий пользователей, которые отключены дольше окна
+// воспроизведения и с тех пор не получали событий: resume после такого перерыва все равно
+// потребует перезагрузки состояния, а журналы иначе копились бы для всех когда-либо подключавшихся
+func (h *Hub) evictEventLogs(now time.Time) {
+	h.mu.RLock()
+	connected := make(map[uint]bool, len(h.userClients))
+	for userID := range h.userClients {
+		connected[userID] = true
+	}
+	h.mu.RUnlock()
+
+	if evicted := h.events.evictIdle(now.Add(-h.cfg.ReplayWindow), connected); evicted > 0 {
+		h.logger.Debugf("Evicted %d idle event logs", evicted)
+	}
+}
+
+// deliverToAll - отправляет кадр всем подключенным пользователям, кроме клиентов в режиме только уведомлений.
+// Вызывается из цикла Run, поэтому кадр только предлагается клиенту без ожидания: ожидание медленного
+// клиента задержало бы регистрацию и отключение остальных, а пропуски все равно считает sendFailures
+func (h *Hub) deliverToAll(data []byte) {
+	h.mu.RLock()
+	targets := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		if !client.notificationsOnly {
+			targets = append(targets, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	var dead []*Client
+	for _, client := range targets {
+		if !client.offer(data) {
+			dead = append(dead, client)
+		}
+	}
+	h.dropClients(dead)
+}
+
+// addClient - добавляет клиента в список подключений и индекс по пользователям;
+// гостевой клиент попадает только в индекс гостей своего чата
+func (h *Hub) addClient(client *Client) {
+	if client.guestChatID != 0 {
+		guests, ok := h.guestClients[client.guestChatID]
+		if !ok {
+			guests = make(map[*Client]bool)
+			h.guestClients[client.guestChatID] = guests
+		}
+		guests[client] = true
+		return
+	}
+
+	h.clients[client] = true
+
+	clients, ok := h.userClients[client.userID]
+	if !ok {
+		clients = make(map[*Client]bool)
+		h.userClients[client.userID] = clients
+	}
+	clients[client] = true
+}
+
+// removeClient - удаляет клиента из списка подключений и индекса по пользователям
+func (h *Hub) removeClient(client *Client) {
+	if client.guestChatID != 0 {
+		if guests, ok := h.guestClients[client.guestChatID]; ok {
+			delete(guests, client)
+			if len(guests) == 0 {
+				delete(h.guestClients, client.guestChatID)
 			}
-			h.mu.RUnlock()
+		}
+		return
+	}
+
+	delete(h.clients, client)
+
+	if clients, ok := h.userClients[client.userID]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(h.userClients, client.userID)
+			h.events.touch(client.userID, time.Now())
 		}
 	}
 }
 
-// broadcastUserStatus - отправляет всем клиентам информацию о статусе пользователя
+// dropClients - отключает клиентов, не успевающих принимать сообщения. Вызывается без удержания
+// h.mu: изменять списки подключений можно только под блокировкой на запись
+func (h *Hub) dropClients(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	for _, client := range clients {
+		h.removeClient(client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.closeSend()
+	}
+}
+
+// trySend - отправляет кадр клиенту, ожидая освобождения заполненного буфера не дольше SendTimeout.
+// Не поместившийся кадр пропускается (клиент может получить его через resume); false означает,
+// что канал закрыт или кадры пропущены MaxSendFailures раз подряд и клиента нужно отключить.
+// Вызывается без удержания h.mu, чтобы ожидание одного клиента не задерживало остальных
+func (c *Client) trySend(data []byte) bool {
+	return c.sendWithin(data, c.hub.cfg.SendTimeout)
+}
+
+// offer - как trySend, но без ожидания: не поместившийся в буфер кадр сразу считается пропущенным
+func (c *Client) offer(data []byte) bool {
+	return c.sendWithin(data, 0)
+}
+
+// sendWithin - общая часть trySend и offer: ждет освобождения буфера не дольше timeout
+func (c *Client) sendWithin(data []byte, timeout time.Duration) bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+
+	if c.closed {
+		return false
+	}
+
+	select {
+	case c.send <- data:
+		c.sendFailures.Store(0)
+		c.hub.relayed.Add(1)
+		return true
+	default:
+	}
+
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case c.send <- data:
+			c.sendFailures.Store(0)
+			c.hub.relayed.Add(1)
+			return true
+		case <-timer.C:
+		}
+	}
+
+	failures := int(c.sendFailures.Add(1))
+	if failures < c.hub.cfg.MaxSendFailures {
+		c.hub.logger.Errorf("WebSocket send buffer full for user %d, frame skipped (%d/%d)", c.userID, failures, c.hub.cfg.MaxSendFailures)
+		return true
+	}
+
+	c.hub.logger.Errorf("Disconnecting slow WebSocket client for user %d after %d skipped frames", c.userID, failures)
+	return false
+}
+
+// closeSend - закрывает канал отправки клиента; повторные вызовы ничего не делают
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// broadcastUserStatus - отправляет всем клиентам информацию о статусе пользователя. Вызывается
+// из цикла Run, поэтому доставляет кадр напрямую и без ожидания: отправка в h.broadcast, который
+// читает тот же цикл, заблокировала бы хаб навсегда
 func (h *Hub) broadcastUserStatus(userID uint, username string, isOnline bool) {
 	message := WSMessage{
 		Type: MessageTypeUserStatus,
@@ -150,53 +447,187 @@ func (h *Hub) broadcastUserStatus(userID uint, username string, isOnline bool) {
 		return
 	}
 
-	h.broadcast <- data
+	h.deliverToAll(data)
 }
 
 // SendToUser - отправляет сообщение конкретному пользователю
 func (h *Hub) SendToUser(userID uint, message WSMessage) error {
+	data, err := h.events.record(userID, message.ChatID, marshalWithSeq(message))
+	if err != nil {
+		return err
+	}
+
+	dead, _ := h.deliverToUser(userID, data, false)
+	h.dropClients(dead)
+	return nil
+}
+
+// deliverToUser - отправляет кадр всем подключениям пользователя и возвращает клиентов, которым доставить не удалось;
+// клиенты в режиме только уведомлений получают кадр, лишь если notification = true
+func (h *Hub) deliverToUser(userID uint, data []byte, notification bool) (dead []*Client, delivered bool) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	targets := make([]*Client, 0, len(h.userClients[userID]))
+	for client := range h.userClients[userID] {
+		if !client.notificationsOnly || notification {
+			targets = append(targets, client)
+		}
+	}
+	h.mu.RUnlock()
 
-	data, err := json.Marshal(message)
+	for _, client := range targets {
+		if client.trySend(data) {
+			delivered = true
+		} else {
+			dead = append(dead, client)
+		}
+	}
+	return dead, delivered
+}
+
+// SendToChat - отправляет сообщение участникам чата, подписанным на этот чат;
+// для сообщений чата сообщает сервису о доставке, если сообщение получил кто-то кроме отправителя
+func (h *Hub) SendToChat(chatID uint, message WSMessage, excludeUserID uint) error {
+	members, err := h.chatUseCase.GetChatMembers(context.Background(), chatID, 0)
 	if err != nil {
 		return err
 	}
 
-	for client := range h.clients {
-		if client.userID == userID {
-			select {
-			case client.send <- data:
-			default:
-				close(client.send)
-				delete(h.clients, client)
+	memberIDs := make([]uint, len(members))
+	for i, member := range members {
+		memberIDs[i] = member.ID
+	}
+
+	delivered, err := h.deliverToChatMembers(chatID, memberIDs, message, excludeUserID)
+	if err != nil {
+		return err
+	}
+	h.deliverToGuests(chatID, message)
+
+	if chatMsg, ok := message.Data.(ChatMessage); ok && message.Type == MessageTypeChat && delivered {
+		h.chatUseCase.MarkMessageDelivered(context.Background(), chatID, chatMsg.ID)
+	}
+
+	return nil
+}
+
+// SendToMembers - отправляет сообщение только указанным участникам чата, подписанным на этот чат;
+// ID, не состоящие в чате, пропускаются
+func (h *Hub) SendToMembers(chatID uint, memberIDs []uint, message WSMessage) error {
+	if len(memberIDs) == 0 {
+		return nil
+	}
+
+	members, err := h.chatUseCase.GetChatMembers(context.Background(), chatID, 0)
+	if err != nil {
+		return err
+	}
+
+	isMember := make(map[uint]bool, len(members))
+	for _, member := range members {
+		isMember[member.ID] = true
+	}
+
+	targets := make([]uint, 0, len(memberIDs))
+	seen := make(map[uint]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		if isMember[id] && !seen[id] {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+
+	_, err = h.deliverToChatMembers(chatID, targets, message, 0)
+	return err
+}
+
+// deliverToChatMembers - журналирует событие для каждого из memberIDs и доставляет его их клиентам,
+// подписанным на чат; сообщает, получил ли сообщение кто-то кроме excludeUserID
+func (h *Hub) deliverToChatMembers(chatID uint, memberIDs []uint, message WSMessage, excludeUserID uint) (bool, error) {
+	// Событие журналируется для каждого участника, в том числе отключенного, чтобы его можно было воспроизвести при resume
+	frames := make(map[uint][]byte, len(memberIDs))
+	for _, memberID := range memberIDs {
+		data, err := h.events.record(memberID, chatID, marshalWithSeq(message))
+		if err != nil {
+			return false, err
+		}
+		frames[memberID] = data
+	}
+
+	type target struct {
+		client   *Client
+		memberID uint
+	}
+	var targets []target
+	h.mu.RLock()
+	for _, memberID := range memberIDs {
+		for client := range h.userClients[memberID] {
+			if client.isSubscribed(chatID) {
+				targets = append(targets, target{client, memberID})
 			}
 		}
 	}
+	h.mu.RUnlock()
+
+	delivered := false
+	var dead []*Client
+	for _, t := range targets {
+		if !t.client.trySend(frames[t.memberID]) {
+			dead = append(dead, t.client)
+			continue
+		}
+		if t.memberID != excludeUserID {
+			delivered = true
+		}
+	}
+	h.dropClients(dead)
 
-	return nil
+	return delivered, nil
 }
 
-// SendToChat - отправляет сообщение всем участникам чата кроме исключенного пользователя
-func (h *Hub) SendToChat(chatID uint, message WSMessage, excludeUserID uint) error {
+// deliverToGuests - доставляет событие чата гостевым подключениям; гостям события не журналируются
+// и недоступны для resume
+func (h *Hub) deliverToGuests(chatID uint, message WSMessage) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	if len(h.guestClients[chatID]) == 0 {
+		h.mu.RUnlock()
+		return
+	}
+	h.mu.RUnlock()
 
 	data, err := json.Marshal(message)
 	if err != nil {
-		return err
+		h.logger.Errorf("Failed to marshal guest message: %v", err)
+		return
 	}
 
-	for client := range h.clients {
-		select {
-		case client.send <- data:
-		default:
-			close(client.send)
-			delete(h.clients, client)
+	h.mu.RLock()
+	guests := make([]*Client, 0, len(h.guestClients[chatID]))
+	for client := range h.guestClients[chatID] {
+		guests = append(guests, client)
+	}
+	h.mu.RUnlock()
+
+	var dead []*Client
+	for _, client := range guests {
+		if !client.trySend(data) {
+			dead = append(dead, client)
 		}
 	}
+	h.dropClients(dead)
+}
 
-	return nil
+// SendEventToChat - отправляет подписанным участникам чата служебное событие (например, смену статуса сообщения)
+func (h *Hub) SendEventToChat(chatID uint, eventType string, data interface{}) {
+	message := WSMessage{
+		Type:      MessageType(eventType),
+		ChatID:    chatID,
+		Data:      data,
+		Timestamp: getTimestamp(),
+	}
+
+	if err := h.SendToChat(chatID, message, 0); err != nil {
+		h.logger.Errorf("Failed to send %s event to chat %d: %v", eventType, chatID, err)
+	}
 }
 
 // BroadcastMessage - отправляет сообщение всем подключенным клиентам
@@ -216,49 +647,210 @@ func (h *Hub) GetOnlineUsers() []uint {
 	defer h.mu.RUnlock()
 
 	var userIDs []uint
-	for client := range h.clients {
-		userIDs = append(userIDs, client.userID)
+	for userID := range h.userClients {
+		userIDs = append(userIDs, userID)
 	}
 
 	return userIDs
 }
 
+// IsUserOnline - проверяет, есть ли у пользователя хотя бы одно активное подключение
+func (h *Hub) IsUserOnline(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.userClients[userID]) > 0
+}
+
 // SendNotificationToChat - отправляет уведомление всем участникам чата
 func (h *Hub) SendNotificationToChat(chatID uint, notification *entities.Notification) {
-	members, err := h.chatUseCase.GetChatMembers(chatID, 0)
+	if err := notification.Validate(); err != nil {
+		h.logger.Errorf("Dropping invalid notification for chat %d: %v", chatID, err)
+		return
+	}
+
+	members, err := h.chatUseCase.GetChatMembers(context.Background(), chatID, 0)
 	if err != nil {
 		h.logger.Errorf("Failed to get chat members for notification: %v", err)
 		return
 	}
 
-	wsMsg := entities.WebSocketMessage{
-		Type:         "notification",
-		ChatID:       chatID,
-		Notification: notification,
+	var dead []*Client
+	stored := 0
+	for _, member := range members {
+		memberDead, memberStored := h.notifyUser(member.ID, chatID, notification)
+		dead = append(dead, memberDead...)
+		if memberStored {
+			stored++
+		}
 	}
+	h.dropClients(dead)
 
-	data, err := json.Marshal(wsMsg)
+	if stored > 0 {
+		h.logger.Infof("Stored %s notification for %d of %d members of chat %d until they reconnect", notification.Type, stored, len(members), chatID)
+	}
+}
+
+// SendNotificationToUser - отправляет уведомление всем подключениям конкретного пользователя
+func (h *Hub) SendNotificationToUser(userID uint, notification *entities.Notification) {
+	if err := notification.Validate(); err != nil {
+		h.logger.Errorf("Dropping invalid notification for user %d: %v", userID, err)
+		return
+	}
+
+	dead, stored := h.notifyUser(userID, notification.ChatID, notification)
+	h.dropClients(dead)
+
+	if stored {
+		h.logger.Infof("Stored %s notification for user %d until they reconnect", notification.Type, userID)
+	}
+}
+
+// notifyUser - доставляет уведомление всем подключениям пользователя. Если пользователь не в сети
+// или ни одно подключение не приняло кадр, уведомление сохраняется в очередь до следующего подключения;
+// такие уведомления не журналируются, чтобы resume не повторил их вместе с очередью
+func (h *Hub) notifyUser(userID, chatID uint, notification *entities.Notification) (dead []*Client, stored bool) {
+	if !h.IsUserOnline(userID) {
+		return nil, h.notifications.Store(context.Background(), userID, notification, usecase.NotificationFailureOffline)
+	}
+
+	data, err := h.recordNotification(userID, chatID, notification)
+	if err != nil {
+		h.logger.Errorf("Failed to marshal notification for user %d: %v", userID, err)
+		return nil, false
+	}
+
+	dead, delivered := h.deliverToUser(userID, data, true)
+	if !delivered {
+		stored = h.notifications.Store(context.Background(), userID, notification, usecase.NotificationFailureSendFailed)
+	}
+	return dead, stored
+}
+
+// flushStoredNotifications - доставляет пользователю уведомления, сохраненные, пока он был не в сети
+func (h *Hub) flushStoredNotifications(userID uint) {
+	notifications, err := h.notifications.Take(context.Background(), userID)
 	if err != nil {
-		h.logger.Errorf("Failed to marshal notification: %v", err)
+		h.logger.Errorf("Failed to load stored notifications for user %d: %v", userID, err)
+		return
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	var dead []*Client
+	restored := 0
+	for _, notification := range notifications {
+		notificationDead, stored := h.notifyUser(userID, notification.ChatID, notification)
+		dead = append(dead, notificationDead...)
+		if stored {
+			restored++
+		}
+	}
+	h.dropClients(dead)
+
+	h.logger.Infof("Delivered %d of %d stored notifications to user %d", len(notifications)-restored, len(notifications), userID)
+}
+
+// recordNotification - журналирует уведомление пользователя и возвращает кадр с его номером;
+// уведомления доставляются независимо от подписок, поэтому сохраняются без привязки к чату
+func (h *Hub) recordNotification(userID, chatID uint, notification *entities.Notification) ([]byte, error) {
+	return h.events.recordNotification(userID, func(seq uint64) ([]byte, error) {
+		return json.Marshal(entities.WebSocketMessage{
+			Type:         "notification",
+			Seq:          seq,
+			ChatID:       chatID,
+			Notification: notification,
+		})
+	})
+}
+
+// Resume - повторно отправляет клиенту события, полученные его пользователем после lastSeq,
+// и сообщает текущий номер; если часть событий уже вытеснена из журнала, отправляет RESUME_GAP
+func (h *Hub) Resume(client *Client, lastSeq uint64) {
+	events, currentSeq, complete := h.events.since(client.userID, lastSeq)
+	if !complete {
+		client.sendError(ErrorCodeResumeGap, "Some missed events are no longer available, reload state")
 		return
 	}
 
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	_, connected := h.clients[client]
+	h.mu.RUnlock()
+	if !connected {
+		return
+	}
 
-	for client := range h.clients {
-		for _, member := range members {
-			if client.userID == member.ID {
-				select {
-				case client.send <- data:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
-				break
+	for _, event := range events {
+		if event.chatID != 0 && !client.isSubscribed(event.chatID) {
+			continue
+		}
+		if client.notificationsOnly && !event.notification {
+			continue
+		}
+
+		if !client.trySend(event.data) {
+			h.dropClients([]*Client{client})
+			return
+		}
+	}
+
+	ack, err := json.Marshal(WSMessage{
+		Type:      MessageTypeResume,
+		Data:      map[string]uint64{"last_seq": currentSeq},
+		Timestamp: getTimestamp(),
+	})
+	if err != nil {
+		return
+	}
+
+	client.trySend(ack)
+}
+
+// sendSnapshot - собирает начальное состояние пользователя (чаты с числом непрочитанных упоминаний
+// и версиями ключей, контакты в сети) и ставит его в очередь клиента; вызывается до регистрации клиента,
+// поэтому снимок оказывается первым кадром подключения
+func (h *Hub) sendSnapshot(client *Client) {
+	snapshot := Snapshot{
+		OnlineContacts: []uint{},
+		KeyVersions:    make(map[uint]int),
+		LastSeq:        h.events.current(client.userID),
+	}
+
+	chats, err := h.chatUseCase.GetUserChats(client.ctx, client.userID, false)
+	if err != nil {
+		h.logger.Errorf("Failed to build snapshot for user %d: %v", client.userID, err)
+		client.sendError(ErrorCodeInternal, "Failed to load initial state")
+		return
+	}
+	snapshot.Chats = chats
+
+	seen := make(map[uint]bool)
+	for _, chat := range chats {
+		snapshot.KeyVersions[chat.ID] = chat.KeyVersion
+		for _, member := range chat.Members {
+			if member.ID == client.userID || seen[member.ID] {
+				continue
+			}
+			seen[member.ID] = true
+			if h.IsUserOnline(member.ID) {
+				snapshot.OnlineContacts = append(snapshot.OnlineContacts, member.ID)
 			}
 		}
 	}
+
+	data, err := json.Marshal(WSMessage{
+		Type:      MessageTypeSnapshot,
+		Data:      snapshot,
+		Timestamp: getTimestamp(),
+	})
+	if err != nil {
+		h.logger.Errorf("Failed to marshal snapshot for user %d: %v", client.userID, err)
+		client.sendError(ErrorCodeInternal, "Failed to load initial state")
+		return
+	}
+
+	client.trySend(data)
 }
 
 // getTimestamp - получает текущую временную метку
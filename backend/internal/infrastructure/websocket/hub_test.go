@@ -0,0 +1,1081 @@
+package websocket
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sleek-chat-backend/internal/crypto"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/internal/domain/repository"
+	"sleek-chat-backend/internal/domain/usecase"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestHub - создает хаб без сервиса чатов с небольшими буферами для тестов
+func newTestHub() *Hub {
+	return NewHub(logger.New(), nil, &config.WebSocketConfig{
+		SendBufferSize:  16,
+		SendTimeout:     10 * time.Millisecond,
+		MaxSendFailures: 3,
+		DedupSize:       16,
+		ReplayEvents:    8,
+	})
+}
+
+// memberChats - репозиторий чатов, знающий только состав участников
+type memberChats struct {
+	repository.ChatRepository
+	members map[uint][]uint
+}
+
+func (r *memberChats) IsMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	for _, memberID := range r.members[chatID] {
+		if memberID == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memberChats) AddMember(ctx context.Context, chatID, userID uint, role string) error {
+	r.members[chatID] = append(r.members[chatID], userID)
+	return nil
+}
+
+func (r *memberChats) GetMembers(ctx context.Context, chatID uint) ([]entities.User, error) {
+	users := make([]entities.User, 0, len(r.members[chatID]))
+	for _, memberID := range r.members[chatID] {
+		users = append(users, entities.User{ID: memberID, Username: fmt.Sprintf("user%d", memberID)})
+	}
+	return users, nil
+}
+
+func (r *memberChats) GetMembersWithRoles(ctx context.Context, chatID uint, limit, offset int) ([]*entities.User, error) {
+	users, _ := r.GetMembers(ctx, chatID)
+	result := make([]*entities.User, len(users))
+	for i := range users {
+		users[i].Role = "member"
+		result[i] = &users[i]
+	}
+	return result, nil
+}
+
+func (r *memberChats) UnarchiveForAll(ctx context.Context, chatID uint) error {
+	return nil
+}
+
+// newTestHubWithChats - создает тестовый хаб с сервисом чатов поверх заданного состава участников
+func newTestHubWithChats(members map[uint][]uint) *Hub {
+	return newTestHubWithMessages(members, nil)
+}
+
+// newTestHubWithMessages - как newTestHubWithChats, но с хранилищем сообщений
+func newTestHubWithMessages(members map[uint][]uint, messages repository.MessageRepository) *Hub {
+	h := newTestHub()
+	h.SetChatUseCase(usecase.NewChatUseCase(&memberChats{members: members}, messages, nil, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	return h
+}
+
+// addTestClient - подключает клиента напрямую, минуя цикл Run и рассылку статусов
+func addTestClient(h *Hub, userID uint) *Client {
+	client := newTestClient(h, userID)
+	h.mu.Lock()
+	h.addClient(client)
+	h.mu.Unlock()
+	return client
+}
+
+// newTestClient - создает клиента без сетевого соединения; кадры читаются из send
+func newTestClient(h *Hub, userID uint) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		hub:            h,
+		send:           make(chan []byte, h.cfg.SendBufferSize),
+		userID:         userID,
+		user:           &entities.User{ID: userID, Username: fmt.Sprintf("user%d", userID)},
+		ctx:            ctx,
+		cancel:         cancel,
+		recentMessages: newRecentClientMessages(h.cfg.DedupSize),
+	}
+}
+
+// readFrame - читает следующий кадр клиента или завершает тест по таймауту
+func readFrame(t *testing.T, client *Client) WSMessage {
+	t.Helper()
+
+	select {
+	case data, ok := <-client.send:
+		if !ok {
+			t.Fatal("send channel closed")
+		}
+		var message WSMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("invalid frame %q: %v", data, err)
+		}
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for frame")
+	}
+	return WSMessage{}
+}
+
+// registerClient - регистрирует клиента через цикл Run и дожидается его статуса в сети
+func registerClient(t *testing.T, h *Hub, client *Client) {
+	t.Helper()
+
+	h.register <- client
+	message := readFrame(t, client)
+	if message.Type != MessageTypeUserStatus {
+		t.Fatalf("first frame type = %q, want %q", message.Type, MessageTypeUserStatus)
+	}
+}
+
+func TestRunBroadcastsUserStatusWithoutBlocking(t *testing.T) {
+	h := newTestHub()
+	go h.Run()
+
+	alice := newTestClient(h, 1)
+	bob := newTestClient(h, 2)
+
+	registerClient(t, h, alice)
+	registerClient(t, h, bob)
+
+	message := readFrame(t, alice)
+	if message.Type != MessageTypeUserStatus {
+		t.Fatalf("frame type = %q, want %q", message.Type, MessageTypeUserStatus)
+	}
+	status := message.Data.(map[string]interface{})
+	if status["user_id"] != float64(2) || status["is_online"] != true {
+		t.Fatalf("status = %v, want user 2 online", status)
+	}
+
+	h.unregister <- bob
+	message = readFrame(t, alice)
+	status = message.Data.(map[string]interface{})
+	if status["user_id"] != float64(2) || status["is_online"] != false {
+		t.Fatalf("status = %v, want user 2 offline", status)
+	}
+
+	if h.IsUserOnline(2) {
+		t.Fatal("user 2 still online after unregister")
+	}
+}
+
+func TestUnregisterClosesSendChannelOnce(t *testing.T) {
+	h := newTestHub()
+	go h.Run()
+
+	client := newTestClient(h, 1)
+	registerClient(t, h, client)
+
+	h.unregister <- client
+	for range client.send {
+	}
+
+	if client.trySend([]byte("late")) {
+		t.Fatal("trySend succeeded on closed client")
+	}
+	client.closeSend()
+}
+
+func TestHubConcurrentDeliveryAndDisconnects(t *testing.T) {
+	h := newTestHub()
+	go h.Run()
+
+	const users = 8
+	clients := make([]*Client, users)
+	for i := range clients {
+		clients[i] = newTestClient(h, uint(i+1))
+		h.register <- clients[i]
+	}
+
+	// Читатели освобождают буферы, пока идут доставка и отключения
+	var readers sync.WaitGroup
+	for _, client := range clients {
+		readers.Add(1)
+		go func(client *Client) {
+			defer readers.Done()
+			for range client.send {
+			}
+		}(client)
+	}
+
+	var senders sync.WaitGroup
+	for i := 0; i < users; i++ {
+		senders.Add(1)
+		go func(userID uint) {
+			defer senders.Done()
+			for j := 0; j < 50; j++ {
+				if err := h.SendToUser(userID, WSMessage{Type: MessageTypeNotification, Data: j}); err != nil {
+					t.Errorf("SendToUser: %v", err)
+					return
+				}
+			}
+		}(uint(i + 1))
+	}
+
+	for _, client := range clients {
+		h.unregister <- client
+	}
+	senders.Wait()
+	readers.Wait()
+
+	if online := h.GetOnlineUsers(); len(online) != 0 {
+		t.Fatalf("online users = %v, want none", online)
+	}
+}
+
+func TestSendNotificationToChatReachesOnlyMembers(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}})
+	alice, bob, outsider := addTestClient(h, 1), addTestClient(h, 2), addTestClient(h, 3)
+
+	h.SendNotificationToChat(10, entities.NewUserJoinedNotification(10, "carol joined", 4, "carol"))
+
+	for _, member := range []*Client{alice, bob} {
+		message := readFrame(t, member)
+		if message.Type != MessageTypeNotification {
+			t.Fatalf("user %d frame type = %q, want %q", member.userID, message.Type, MessageTypeNotification)
+		}
+	}
+	if len(outsider.send) != 0 {
+		t.Fatal("notification reached a user outside the chat")
+	}
+}
+
+func TestNotificationsOnlyClientSkipsChatTraffic(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}})
+	go h.Run()
+
+	alice := newTestClient(h, 1)
+	registerClient(t, h, alice)
+	background := newTestClient(h, 2)
+	background.notificationsOnly = true
+	h.register <- background
+
+	// Статус в сети рассылается всем, кроме клиентов в режиме только уведомлений
+	if message := readFrame(t, alice); message.Type != MessageTypeUserStatus {
+		t.Fatalf("full client frame type = %q, want %q", message.Type, MessageTypeUserStatus)
+	}
+	// Дожидаемся, пока рассылка статуса отпустит список клиентов
+	h.mu.Lock()
+	h.mu.Unlock()
+
+	if err := h.SendToChat(10, WSMessage{Type: MessageTypeChat, ChatID: 10, Data: map[string]string{"content": "hi"}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if message := readFrame(t, alice); message.Type != MessageTypeChat {
+		t.Fatalf("full client frame type = %q, want %q", message.Type, MessageTypeChat)
+	}
+	if len(background.send) != 0 {
+		t.Fatalf("notifications-only client got %d chat frames", len(background.send))
+	}
+
+	// Уведомления, в том числе об упоминании, доходят до обоих
+	h.SendNotificationToChat(10, entities.NewUserJoinedNotification(10, "carol joined", 3, "carol"))
+	h.SendNotificationToUser(2, entities.NewMentionNotification(10, "alice mentioned you", 5, 1, "alice"))
+	if notification := readNotification(t, alice); notification.Type != entities.NotificationUserJoined {
+		t.Fatalf("full client got %s, want %s", notification.Type, entities.NotificationUserJoined)
+	}
+	for _, want := range []entities.NotificationType{entities.NotificationUserJoined, entities.NotificationMention} {
+		if notification := readNotification(t, background); notification.Type != want {
+			t.Fatalf("notifications-only client got %s, want %s", notification.Type, want)
+		}
+	}
+}
+
+// BenchmarkSendNotificationToChat - доставка уведомления небольшому чату при большом числе
+// подключений: стоимость зависит от числа участников, а не от числа клиентов хаба
+func BenchmarkSendNotificationToChat(b *testing.B) {
+	for _, connected := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("clients=%d", connected), func(b *testing.B) {
+			members := []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+			h := newTestHubWithChats(map[uint][]uint{10: members})
+
+			for userID := 1; userID <= connected; userID++ {
+				client := addTestClient(h, uint(userID))
+				if userID <= len(members) {
+					b.Cleanup(client.closeSend)
+					go func() {
+						for range client.send {
+						}
+					}()
+				}
+			}
+			notification := entities.NewUserJoinedNotification(10, "carol joined", 11, "carol")
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.SendNotificationToChat(10, notification)
+			}
+		})
+	}
+}
+
+// statusMessages - хранилище сообщений, продвигающее статус только вперед, как репозиторий
+type statusMessages struct {
+	repository.MessageRepository
+	mu       sync.Mutex
+	messages map[uint]*entities.Message
+}
+
+func (r *statusMessages) GetByID(ctx context.Context, id uint) (*entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, fmt.Errorf("record not found")
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (r *statusMessages) AdvanceStatus(ctx context.Context, messageID uint, status string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order := map[string]int{entities.MessageStatusSent: 0, entities.MessageStatusDelivered: 1, entities.MessageStatusRead: 2}
+	message := r.messages[messageID]
+	if order[status] <= order[message.Status] {
+		return false, nil
+	}
+	message.Status = status
+	return true, nil
+}
+
+func (r *statusMessages) CreateReceipt(ctx context.Context, receipt *entities.MessageReceipt) error {
+	return nil
+}
+
+func (r *statusMessages) status(id uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.messages[id].Status
+}
+
+func TestMessageStatusLifecycle(t *testing.T) {
+	messages := &statusMessages{messages: map[uint]*entities.Message{
+		1: {ID: 1, ChatID: 10, SenderID: 1, Status: entities.MessageStatusSent},
+		2: {ID: 2, ChatID: 10, SenderID: 1, Status: entities.MessageStatusSent},
+	}}
+	h := newTestHubWithMessages(map[uint][]uint{10: {1, 2}}, messages)
+	alice := addTestClient(h, 1)
+	chatFrame := func(id uint) WSMessage {
+		return WSMessage{Type: MessageTypeChat, ChatID: 10, Data: ChatMessage{ID: id, ChatID: 10, SenderID: 1}}
+	}
+
+	// Получатель не в сети: сообщение остается отправленным
+	if err := h.SendToChat(10, chatFrame(1), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := messages.status(1); got != entities.MessageStatusSent {
+		t.Fatalf("status with offline recipient = %q, want %q", got, entities.MessageStatusSent)
+	}
+	readFrame(t, alice)
+
+	bob := addTestClient(h, 2)
+	if err := h.SendToChat(10, chatFrame(2), 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := messages.status(2); got != entities.MessageStatusDelivered {
+		t.Fatalf("status with online recipient = %q, want %q", got, entities.MessageStatusDelivered)
+	}
+	readFrame(t, bob)
+	readFrame(t, alice)
+	if update := readFrame(t, alice); update.Type != MessageTypeStatus {
+		t.Fatalf("sender got %q, want %q", update.Type, MessageTypeStatus)
+	}
+
+	if err := h.chatUseCase.MarkMessageRead(context.Background(), 10, 2, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := messages.status(2); got != entities.MessageStatusRead {
+		t.Fatalf("status after read = %q, want %q", got, entities.MessageStatusRead)
+	}
+
+	// Статус не откатывается назад
+	h.chatUseCase.MarkMessageDelivered(context.Background(), 10, 2)
+	if got := messages.status(2); got != entities.MessageStatusRead {
+		t.Fatalf("status after late delivery = %q, want %q", got, entities.MessageStatusRead)
+	}
+}
+
+func TestChatMembersReportHubPresence(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}})
+	addTestClient(h, 1)
+
+	members, err := h.chatUseCase.GetChatMembers(context.Background(), 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	online := make(map[uint]bool)
+	for _, member := range members {
+		online[member.ID] = member.IsOnline
+	}
+	if len(online) != 2 || !online[1] || online[2] {
+		t.Fatalf("online flags = %v, want user 1 online and user 2 offline", online)
+	}
+}
+
+// keyedChats - участники чатов вместе с активным ключом шифрования каждого чата
+type keyedChats struct {
+	*memberChats
+	key string
+}
+
+func (r *keyedChats) GetByID(ctx context.Context, id uint) (*entities.Chat, error) {
+	return &entities.Chat{ID: id, IsGroup: true, KeyVersion: 1}, nil
+}
+
+func (r *keyedChats) GetKey(ctx context.Context, chatID uint, version int) (*entities.ChatKey, error) {
+	return &entities.ChatKey{ChatID: chatID, Version: version, Key: r.key}, nil
+}
+
+// keyedUsers - пользователи, приватные ключи которых хранит сервер
+type keyedUsers struct {
+	repository.UserRepository
+	users map[uint]*entities.User
+}
+
+func (r *keyedUsers) GetByID(ctx context.Context, id uint) (*entities.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user %d not found", id)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// editableMessages - сообщения, которые можно изменять и удалять
+type editableMessages struct {
+	repository.MessageRepository
+	mu       sync.Mutex
+	messages map[uint]*entities.Message
+}
+
+func (r *editableMessages) GetByID(ctx context.Context, id uint) (*entities.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, fmt.Errorf("message %d not found", id)
+	}
+	copied := *message
+	return &copied, nil
+}
+
+func (r *editableMessages) Create(ctx context.Context, message *entities.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	message.ID = uint(len(r.messages) + 1)
+	copied := *message
+	r.messages[message.ID] = &copied
+	return nil
+}
+
+func (r *editableMessages) Update(ctx context.Context, message *entities.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *message
+	r.messages[message.ID] = &copied
+	return nil
+}
+
+func (r *editableMessages) Delete(ctx context.Context, id, deletedBy uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.messages, id)
+	return nil
+}
+
+// newServerKeyUser - создает пользователя с ключами, хранящимися на сервере
+func newServerKeyUser(t *testing.T, id uint) *entities.User {
+	t.Helper()
+
+	ecdsaPrivateKey, ecdsaPublicKey, err := crypto.GenerateECDSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivateKey, rsaPublicKey, err := crypto.GenerateRSAKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPEM, err := crypto.SerializeECDSAPrivateKey(ecdsaPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM, err := crypto.SerializeRSAPrivateKey(rsaPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &entities.User{
+		ID:              id,
+		Username:        fmt.Sprintf("user%d", id),
+		ECDSAPublicKey:  hex.EncodeToString(ecdsaPublicKey),
+		RSAPublicKey:    hex.EncodeToString(rsaPublicKey),
+		ECDSAPrivateKey: string(ecdsaPEM),
+		RSAPrivateKey:   string(rsaPEM),
+	}
+}
+
+func TestEditAndDeletePushFramesToMembers(t *testing.T) {
+	chatKey, err := crypto.GenerateNonce(crypto.AESKeySize + crypto.HMACKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chats := &keyedChats{memberChats: &memberChats{members: map[uint][]uint{10: {1, 2}}}, key: hex.EncodeToString(chatKey)}
+	users := &keyedUsers{users: map[uint]*entities.User{1: newServerKeyUser(t, 1), 2: newServerKeyUser(t, 2)}}
+	messages := &editableMessages{messages: map[uint]*entities.Message{
+		5: {ID: 5, ChatID: 10, SenderID: 1, MessageType: "text", Chat: entities.Chat{ID: 10, IsGroup: true}},
+	}}
+
+	h := newTestHub()
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, messages, users, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	bob := addTestClient(h, 2)
+	ctx := context.Background()
+
+	// HTTP-обработчик редактирования передает запрос этому методу сервиса без изменений
+	if _, err := h.chatUseCase.EditMessage(ctx, 10, 5, 1, &usecase.EditMessageRequest{Content: "fixed typo"}); err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	edited := readFrame(t, bob)
+	if edited.Type != MessageTypeEdited || edited.ChatID != 10 {
+		t.Fatalf("frame = %q for chat %d, want %q for chat 10", edited.Type, edited.ChatID, MessageTypeEdited)
+	}
+	data, ok := edited.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("frame data = %T, want object", edited.Data)
+	}
+	if data["content"] != "fixed typo" || data["message_id"] != float64(5) {
+		t.Fatalf("frame data = %v", data)
+	}
+	for _, field := range []string{"key_version", "edited_at", "nonce", "iv", "hmac", "ecdsa_signature", "rsa_signature"} {
+		if _, ok := data[field]; !ok {
+			t.Errorf("frame data has no %q", field)
+		}
+	}
+
+	if err := h.chatUseCase.DeleteMessage(ctx, 10, 5, 1); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	deleted := readFrame(t, bob)
+	if deleted.Type != MessageTypeDeleted {
+		t.Fatalf("frame = %q, want %q", deleted.Type, MessageTypeDeleted)
+	}
+	if data := deleted.Data.(map[string]interface{}); data["message_id"] != float64(5) || data["deleted_by"] != float64(1) {
+		t.Fatalf("frame data = %v", data)
+	}
+}
+
+// readNotification - читает следующий кадр клиента и разбирает его как уведомление
+func readNotification(t *testing.T, client *Client) *entities.Notification {
+	t.Helper()
+
+	select {
+	case data := <-client.send:
+		var frame entities.WebSocketMessage
+		if err := json.Unmarshal(data, &frame); err != nil {
+			t.Fatalf("invalid frame %q: %v", data, err)
+		}
+		if frame.Type != string(MessageTypeNotification) || frame.Notification == nil {
+			t.Fatalf("frame %s is not a notification", data)
+		}
+		return frame.Notification
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification")
+	}
+	return nil
+}
+
+func TestAddMemberSendsPersonalInvite(t *testing.T) {
+	chats := &keyedChats{memberChats: &memberChats{members: map[uint][]uint{10: {1, 2}}}}
+	users := &keyedUsers{users: map[uint]*entities.User{
+		1: {ID: 1, Username: "alice"},
+		3: {ID: 3, Username: "carol"},
+	}}
+	messages := &editableMessages{messages: make(map[uint]*entities.Message)}
+
+	h := newTestHub()
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, messages, users, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	// Клиент отписан от всех чатов: личное уведомление не зависит от подписок
+	carol := addTestClient(h, 3)
+	carol.subscriptions = map[uint]bool{}
+	outsider := addTestClient(h, 4)
+
+	if err := h.chatUseCase.AddMember(context.Background(), 10, 1, 3); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	var invite *entities.Notification
+	for i := 0; i < 2 && invite == nil; i++ {
+		if notification := readNotification(t, carol); notification.Type == entities.NotificationChatInvited {
+			invite = notification
+		}
+	}
+	if invite == nil {
+		t.Fatal("added user got no chat_invited notification")
+	}
+	if invite.ChatID != 10 || invite.Data["inviter_username"] != "alice" {
+		t.Fatalf("invite = chat %d from %v, want chat 10 from alice", invite.ChatID, invite.Data["inviter_username"])
+	}
+	if len(outsider.send) != 0 {
+		t.Fatal("invite reached a user who was not added")
+	}
+}
+
+func TestSlowClientSurvivesTransientStall(t *testing.T) {
+	h := newTestHub()
+	h.cfg.SendBufferSize = 1
+	h.cfg.SendTimeout = 50 * time.Millisecond
+	client := addTestClient(h, 1)
+	send := func(text string) {
+		t.Helper()
+		if err := h.SendToUser(1, WSMessage{Type: MessageTypeChat, Data: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Медленный клиент освобождает буфер, пока хаб ждет: кадр доставляется без пропуска
+	send("first")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-client.send
+	}()
+	send("second")
+	if frame := readFrame(t, client); frame.Data != "second" {
+		t.Fatalf("frame = %v, want second", frame.Data)
+	}
+
+	// Кратковременная остановка: кадр пропускается, но клиент остается подключенным
+	send("third")
+	send("skipped")
+	if !h.IsUserOnline(1) {
+		t.Fatal("client dropped after a single stall")
+	}
+	readFrame(t, client)
+	send("fourth")
+	if failures := client.sendFailures.Load(); failures != 0 {
+		t.Fatalf("send failures after recovery = %d, want 0", failures)
+	}
+
+	// Клиент, который перестал читать, отключается после MaxSendFailures пропусков подряд
+	for i := 0; i < h.cfg.MaxSendFailures; i++ {
+		send(fmt.Sprintf("stalled %d", i))
+	}
+	if h.IsUserOnline(1) {
+		t.Fatalf("client still connected after %d skipped frames", h.cfg.MaxSendFailures)
+	}
+}
+
+func TestStalledClientDoesNotBlockHub(t *testing.T) {
+	h := newTestHub()
+	h.cfg.SendBufferSize = 1
+	h.cfg.SendTimeout = 5 * time.Second
+	go h.Run()
+
+	// Клиент, который перестал читать: буфер заполнен, каждая отправка ему ждет SendTimeout
+	stalled := newTestClient(h, 1)
+	registerClient(t, h, stalled)
+	stalled.send <- []byte(`{}`)
+
+	waiting := make(chan struct{})
+	go func() {
+		defer close(waiting)
+		_ = h.SendToUser(1, WSMessage{Type: MessageTypeChat, Data: "stuck"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// Пока отправка ждет медленного клиента, цикл Run регистрирует новых клиентов
+	// и рассылает их статус, не дожидаясь ни h.mu, ни буфера медленного клиента
+	start := time.Now()
+	for userID := uint(2); userID <= 3; userID++ {
+		registerClient(t, h, newTestClient(h, userID))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("registration took %v while a send was waiting on a stalled client", elapsed)
+	}
+	if !h.IsUserOnline(2) || !h.IsUserOnline(3) {
+		t.Fatal("new clients are not online")
+	}
+
+	// Статусы, не поместившиеся в буфер, засчитаны как пропуски, но клиент еще подключен
+	if failures := stalled.sendFailures.Load(); failures != 2 {
+		t.Fatalf("stalled client send failures = %d, want 2", failures)
+	}
+	if !h.IsUserOnline(1) {
+		t.Fatal("stalled client dropped before MaxSendFailures")
+	}
+
+	<-stalled.send
+	<-waiting
+}
+
+func TestSendToMembersDeliversOnlyToSubset(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2, 3}})
+	clients := map[uint]*Client{}
+	for _, userID := range []uint{1, 2, 3, 4} {
+		clients[userID] = addTestClient(h, userID)
+	}
+
+	// Пользователь 4 не состоит в чате и не получает сообщение, даже если указан
+	notice := WSMessage{Type: MessageTypeChat, ChatID: 10, Data: "admins only"}
+	if err := h.SendToMembers(10, []uint{1, 3, 4, 3}, notice); err != nil {
+		t.Fatalf("SendToMembers: %v", err)
+	}
+
+	for _, userID := range []uint{1, 3} {
+		if frame := readFrame(t, clients[userID]); frame.Type != MessageTypeChat || frame.Data != "admins only" {
+			t.Fatalf("user %d: frame = %+v", userID, frame)
+		}
+		if len(clients[userID].send) != 0 {
+			t.Fatalf("user %d got the message more than once", userID)
+		}
+	}
+	for _, userID := range []uint{2, 4} {
+		if len(clients[userID].send) != 0 {
+			t.Fatalf("excluded user %d received the message", userID)
+		}
+	}
+}
+
+// roleChats - участники групповых чатов с ролями; создатель каждого чата - пользователь 1
+type roleChats struct {
+	*memberChats
+	roles map[uint]string
+}
+
+func (r *roleChats) GetByID(ctx context.Context, id uint) (*entities.Chat, error) {
+	return &entities.Chat{ID: id, IsGroup: true, CreatedBy: 1}, nil
+}
+
+func (r *roleChats) ModifyMemberRole(ctx context.Context, chatID, userID uint, modify func(current string) (string, error)) error {
+	role, err := modify(r.roles[userID])
+	if err != nil {
+		return err
+	}
+	r.roles[userID] = role
+	return nil
+}
+
+func TestSetAdminPushesRoleChanged(t *testing.T) {
+	chats := &roleChats{
+		memberChats: &memberChats{members: map[uint][]uint{10: {1, 2, 3}}},
+		roles:       map[uint]string{1: "admin", 2: "member", 3: "member"},
+	}
+	h := newTestHub()
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, nil, nil, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	carol := addTestClient(h, 3)
+	outsider := addTestClient(h, 4)
+
+	// HTTP-обработчик назначения администратора вызывает этот метод сервиса
+	if err := h.chatUseCase.SetAdmin(context.Background(), 10, 1, 2); err != nil {
+		t.Fatalf("SetAdmin: %v", err)
+	}
+
+	frame := readFrame(t, carol)
+	if frame.Type != MessageTypeRoleChanged || frame.ChatID != 10 {
+		t.Fatalf("frame = %q for chat %d, want %q for chat 10", frame.Type, frame.ChatID, MessageTypeRoleChanged)
+	}
+	data, ok := frame.Data.(map[string]interface{})
+	if !ok {
+		t.Fatalf("frame data = %T, want object", frame.Data)
+	}
+	if data["user_id"] != float64(2) || data["new_role"] != "admin" || data["changed_by"] != float64(1) {
+		t.Fatalf("frame data = %v", data)
+	}
+	if len(outsider.send) != 0 {
+		t.Fatal("role change reached a user outside the chat")
+	}
+
+	// Повторное назначение не меняет роль и не рассылает событие
+	if err := h.chatUseCase.SetAdmin(context.Background(), 10, 1, 2); err != nil {
+		t.Fatalf("SetAdmin again: %v", err)
+	}
+	if len(carol.send) != 0 {
+		t.Fatal("role_changed sent although the role did not change")
+	}
+}
+
+func TestGuestClientIsReadOnlyAndScopedToItsChat(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1}, 11: {1}})
+	guest := newTestClient(h, 0)
+	guest.guestChatID = 10
+	h.mu.Lock()
+	h.addClient(guest)
+	h.mu.Unlock()
+
+	if err := h.SendToChat(10, WSMessage{Type: MessageTypeChat, ChatID: 10, Data: "public"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if frame := readFrame(t, guest); frame.Type != MessageTypeChat || frame.ChatID != 10 {
+		t.Fatalf("guest frame = %+v, want chat 10 message", frame)
+	}
+
+	// События других чатов гостю не доставляются
+	if err := h.SendToChat(11, WSMessage{Type: MessageTypeChat, ChatID: 11, Data: "private"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(guest.send) != 0 {
+		t.Fatal("guest received a message of another chat")
+	}
+
+	for _, frame := range []WSMessage{
+		{Type: MessageTypeChat, ChatID: 10, Data: map[string]string{"content": "hi"}},
+		{Type: MessageTypeSubscribe, ChatID: 11},
+	} {
+		handleFrame(t, guest, frame)
+		reply := readFrame(t, guest)
+		if data, _ := reply.Data.(map[string]interface{}); reply.Type != MessageTypeError || data["code"] != string(ErrorCodeReadOnly) {
+			t.Fatalf("guest %s frame: reply = %+v, want %s error", frame.Type, reply, ErrorCodeReadOnly)
+		}
+	}
+}
+
+// memFailedNotifications - хранилище недоставленных уведомлений в памяти
+type memFailedNotifications struct {
+	mu      sync.Mutex
+	entries []entities.FailedNotification
+}
+
+func (r *memFailedNotifications) Create(ctx context.Context, notification *entities.FailedNotification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	notification.ID = uint(len(r.entries) + 1)
+	r.entries = append(r.entries, *notification)
+	return nil
+}
+
+func (r *memFailedNotifications) TakeByUser(ctx context.Context, userID uint) ([]entities.FailedNotification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var taken, kept []entities.FailedNotification
+	for _, entry := range r.entries {
+		if entry.UserID == userID {
+			taken = append(taken, entry)
+		} else {
+			kept = append(kept, entry)
+		}
+	}
+	r.entries = kept
+	return taken, nil
+}
+
+func (r *memFailedNotifications) count(userID uint) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, entry := range r.entries {
+		if entry.UserID == userID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestOfflineMemberNotificationDeliveredOnConnect(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}})
+	failed := &memFailedNotifications{}
+	h.SetNotificationQueue(usecase.NewNotificationQueue(failed, logger.New()))
+	go h.Run()
+
+	alice := newTestClient(h, 1)
+	registerClient(t, h, alice)
+
+	h.SendNotificationToChat(10, entities.NewUserJoinedNotification(10, "carol joined", 3, "carol"))
+
+	if notification := readNotification(t, alice); notification.Type != entities.NotificationUserJoined {
+		t.Fatalf("online member got %s, want %s", notification.Type, entities.NotificationUserJoined)
+	}
+	if n := failed.count(2); n != 1 {
+		t.Fatalf("%d notifications stored for the offline member, want 1", n)
+	}
+	if n := failed.count(1); n != 0 {
+		t.Fatalf("%d notifications stored for the online member, want 0", n)
+	}
+
+	// При подключении сохраненное уведомление доставляется и удаляется из хранилища
+	bob := newTestClient(h, 2)
+	registerClient(t, h, bob)
+	notification := readNotification(t, bob)
+	if notification.Type != entities.NotificationUserJoined || notification.ChatID != 10 || notification.Message != "carol joined" {
+		t.Fatalf("stored notification = %+v", notification)
+	}
+	if n := failed.count(2); n != 0 {
+		t.Fatalf("%d notifications still stored after delivery, want 0", n)
+	}
+}
+
+// listedChats - репозиторий чатов, возвращающий список чатов пользователя с участниками и версиями ключей
+type listedChats struct {
+	memberChats
+	keyVersions map[uint]int
+}
+
+func (r *listedChats) GetUserChats(ctx context.Context, userID uint, includeArchived bool) ([]entities.Chat, error) {
+	var chats []entities.Chat
+	for chatID, memberIDs := range r.members {
+		isMember, _ := r.IsMember(ctx, chatID, userID)
+		if !isMember {
+			continue
+		}
+		chat := entities.Chat{ID: chatID, IsGroup: len(memberIDs) > 2, KeyVersion: r.keyVersions[chatID]}
+		for _, memberID := range memberIDs {
+			chat.Members = append(chat.Members, entities.User{ID: memberID, Username: fmt.Sprintf("user%d", memberID)})
+		}
+		chats = append(chats, chat)
+	}
+	return chats, nil
+}
+
+// countedMessages - хранилище сообщений, знающее только счетчики по чатам
+type countedMessages struct {
+	repository.MessageRepository
+	mentions map[uint]int64
+}
+
+func (r *countedMessages) CountByChats(ctx context.Context, chatIDs []uint) (map[uint]entities.ChatMessageCount, error) {
+	return map[uint]entities.ChatMessageCount{}, nil
+}
+
+func (r *countedMessages) CountUnreadMentionsByChats(ctx context.Context, chatIDs []uint, userID uint) (map[uint]int64, error) {
+	return r.mentions, nil
+}
+
+func TestSnapshotIsFirstFrameOnConnect(t *testing.T) {
+	h := newTestHub()
+	chats := &listedChats{
+		memberChats: memberChats{members: map[uint][]uint{10: {1, 2}, 20: {1, 2, 3}, 30: {2, 3}}},
+		keyVersions: map[uint]int{10: 1, 20: 4, 30: 2},
+	}
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, &countedMessages{mentions: map[uint]int64{20: 2}}, nil, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	go h.Run()
+
+	bob := newTestClient(h, 2)
+	registerClient(t, h, bob)
+
+	// Как в ServeWS: снимок ставится в очередь до регистрации клиента
+	alice := newTestClient(h, 1)
+	h.sendSnapshot(alice)
+	h.register <- alice
+
+	message := readFrame(t, alice)
+	if message.Type != MessageTypeSnapshot {
+		t.Fatalf("first frame type = %q, want %q", message.Type, MessageTypeSnapshot)
+	}
+	raw, _ := json.Marshal(message.Data)
+	var snapshot Snapshot
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snapshot.Chats) != 2 {
+		t.Fatalf("snapshot has %d chats, want 2", len(snapshot.Chats))
+	}
+	for _, chat := range snapshot.Chats {
+		if chat.ID == 20 && chat.UnreadMentions != 2 {
+			t.Fatalf("chat 20 unread mentions = %d, want 2", chat.UnreadMentions)
+		}
+	}
+	if len(snapshot.KeyVersions) != 2 || snapshot.KeyVersions[10] != 1 || snapshot.KeyVersions[20] != 4 {
+		t.Fatalf("key versions = %v, want map[10:1 20:4]", snapshot.KeyVersions)
+	}
+	// Пользователь 3 состоит в общем чате, но не в сети
+	if len(snapshot.OnlineContacts) != 1 || snapshot.OnlineContacts[0] != 2 {
+		t.Fatalf("online contacts = %v, want [2]", snapshot.OnlineContacts)
+	}
+
+	if message := readFrame(t, alice); message.Type != MessageTypeUserStatus {
+		t.Fatalf("second frame type = %q, want %q", message.Type, MessageTypeUserStatus)
+	}
+}
+
+func TestReconnectSnapshotCarriesRotatedKeyVersion(t *testing.T) {
+	h := newTestHub()
+	chats := &listedChats{
+		memberChats: memberChats{members: map[uint][]uint{20: {1, 2, 3}}},
+		keyVersions: map[uint]int{20: 1},
+	}
+	h.SetChatUseCase(usecase.NewChatUseCase(chats, &countedMessages{}, nil, nil, h, h, &config.ChatConfig{}, logger.New(), nil, nil))
+	go h.Run()
+
+	snapshotOf := func(client *Client) Snapshot {
+		t.Helper()
+
+		h.sendSnapshot(client)
+		message := readFrame(t, client)
+		raw, _ := json.Marshal(message.Data)
+		var snapshot Snapshot
+		if err := json.Unmarshal(raw, &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		return snapshot
+	}
+
+	first := newTestClient(h, 1)
+	if snapshot := snapshotOf(first); snapshot.KeyVersions[20] != 1 {
+		t.Fatalf("initial key version = %d, want 1", snapshot.KeyVersions[20])
+	}
+
+	// Ключ сменился, пока клиент был офлайн: событие key_rotated до него не дошло
+	chats.keyVersions[20] = 2
+
+	reconnected := newTestClient(h, 1)
+	if snapshot := snapshotOf(reconnected); snapshot.KeyVersions[20] != 2 {
+		t.Fatalf("key version after reconnect = %d, want 2", snapshot.KeyVersions[20])
+	}
+}
+
+func TestStatsReflectConnectedClients(t *testing.T) {
+	h := newTestHubWithChats(map[uint][]uint{10: {1, 2}, 20: {1, 2}})
+
+	// Два подключения пользователя 1 и одно пользователя 2; первое подписано на оба чата
+	subscribed := addTestClient(h, 1)
+	addTestClient(h, 1)
+	addTestClient(h, 2)
+	subscribed.handleSubscribe(WSMessage{ChatID: 10})
+	subscribed.handleSubscribe(WSMessage{ChatID: 20})
+
+	guest := newTestClient(h, 0)
+	guest.guestChatID = 10
+	h.mu.Lock()
+	h.addClient(guest)
+	h.mu.Unlock()
+
+	relayed := h.Stats().MessagesRelayed
+	for i := 0; i < 3; i++ {
+		if !guest.trySend([]byte(`{}`)) {
+			t.Fatal("trySend to an idle client failed")
+		}
+	}
+
+	stats := h.Stats()
+	if stats.ConnectedClients != 3 || stats.OnlineUsers != 2 || stats.GuestClients != 1 || stats.AllChatsClients != 2 {
+		t.Fatalf("stats = %+v, want 3 clients, 2 users, 1 guest, 2 unsubscribed", stats)
+	}
+	if stats.ChatSubscribers[10] != 2 || stats.ChatSubscribers[20] != 1 {
+		t.Fatalf("chat subscribers = %v, want map[10:2 20:1]", stats.ChatSubscribers)
+	}
+	if stats.MessagesRelayed != relayed+3 {
+		t.Fatalf("messages relayed = %d, want %d", stats.MessagesRelayed, relayed+3)
+	}
+
+	h.mu.Lock()
+	h.removeClient(subscribed)
+	h.mu.Unlock()
+	if stats := h.Stats(); stats.ConnectedClients != 2 || stats.ChatSubscribers[20] != 0 {
+		t.Fatalf("stats after disconnect = %+v, want 2 clients and no chat 20 subscribers", stats)
+	}
+}
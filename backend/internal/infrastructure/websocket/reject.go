@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// CloseCodeUnauthorized - код закрытия при отсутствующем или недействительном токене
+	CloseCodeUnauthorized = 4401
+	// CloseCodeRateLimited - код закрытия при слишком частых попытках подключения
+	CloseCodeRateLimited = 4429
+
+	// rejectWriteWait - сколько ждать отправки кадра закрытия отклоненному клиенту
+	rejectWriteWait = 10 * time.Second
+)
+
+// RejectUpgrade - отклоняет запрос на подключение так, чтобы WebSocket клиент мог прочитать причину:
+// соединение устанавливается и сразу закрывается кадром с кодом code. При retryAfter > 0 задержка
+// переподключения передается в заголовке Retry-After и в причине закрытия (retry_after=<секунды>).
+// Возвращает false, если запрос не является WebSocket рукопожатием и ответить нужно обычным HTTP
+func RejectUpgrade(w http.ResponseWriter, r *http.Request, code int, reason string, retryAfter time.Duration) bool {
+	if !websocket.IsWebSocketUpgrade(r) {
+		return false
+	}
+
+	header := http.Header{}
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		header.Set("Retry-After", strconv.Itoa(seconds))
+		reason = fmt.Sprintf("%s; retry_after=%d", reason, seconds)
+	}
+
+	// При ошибке рукопожатия upgrader сам отвечает клиенту HTTP ошибкой
+	conn, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return true
+	}
+	defer conn.Close()
+
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(rejectWriteWait))
+	return true
+}
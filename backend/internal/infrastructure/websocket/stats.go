@@ -0,0 +1,45 @@
+package websocket
+
+// HubStats - состояние хаба для диагностики доставки. ChatSubscribers - число подключений,
+// явно подписанных на каждый чат, включая гостевые; клиенты, ни разу не подписывавшиеся,
+// получают сообщения всех своих чатов и учитываются в AllChatsClients
+type HubStats struct {
+	ConnectedClients int          `json:"connected_clients"`
+	OnlineUsers      int          `json:"online_users"`
+	GuestClients     int          `json:"guest_clients"`
+	AllChatsClients  int          `json:"all_chats_clients"`
+	ChatSubscribers  map[uint]int `json:"chat_subscribers"`
+	MessagesRelayed  uint64       `json:"messages_relayed"`
+}
+
+// Stats - возвращает текущее число подключений и подписок и число кадров, переданных клиентам с запуска
+func (h *Hub) Stats() HubStats {
+	stats := HubStats{
+		ChatSubscribers: make(map[uint]int),
+		MessagesRelayed: h.relayed.Load(),
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats.ConnectedClients = len(h.clients)
+	stats.OnlineUsers = len(h.userClients)
+
+	for client := range h.clients {
+		client.subMu.RLock()
+		if client.subscriptions == nil {
+			stats.AllChatsClients++
+		}
+		for chatID := range client.subscriptions {
+			stats.ChatSubscribers[chatID]++
+		}
+		client.subMu.RUnlock()
+	}
+
+	for chatID, guests := range h.guestClients {
+		stats.GuestClients += len(guests)
+		stats.ChatSubscribers[chatID] += len(guests)
+	}
+
+	return stats
+}
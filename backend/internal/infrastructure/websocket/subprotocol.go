@@ -0,0 +1,25 @@
+package websocket
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// AuthSubprotocol - подпротокол, за которым в Sec-WebSocket-Protocol следует JWT токен:
+// "Sec-WebSocket-Protocol: bearer, <token>". В отличие от параметра token в URL заголовок
+// не попадает в журналы сервера и прокси. В ответе сервер выбирает только AuthSubprotocol,
+// сам токен обратно не отправляется
+const AuthSubprotocol = "bearer"
+
+// TokenFromSubprotocol - возвращает токен, переданный после AuthSubprotocol в заголовке
+// Sec-WebSocket-Protocol, или пустую строку
+func TokenFromSubprotocol(r *http.Request) string {
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == AuthSubprotocol {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sleek-chat-backend/internal/domain/entities"
+	"sleek-chat-backend/pkg/config"
+	"sleek-chat-backend/pkg/logger"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenFromSubprotocol(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"bearer, abc.def.ghi", "abc.def.ghi"},
+		{"chat, bearer, abc.def.ghi", "abc.def.ghi"},
+		{"bearer", ""},
+		{"abc.def.ghi", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if tt.header != "" {
+			r.Header.Set("Sec-WebSocket-Protocol", tt.header)
+		}
+		if got := TokenFromSubprotocol(r); got != tt.want {
+			t.Fatalf("TokenFromSubprotocol(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestServeWSEchoesAuthSubprotocol(t *testing.T) {
+	h := NewHub(logger.New(), nil, &config.WebSocketConfig{
+		SendBufferSize: 16,
+		SendTimeout:    time.Second,
+		DedupSize:      16,
+		WriteWait:      time.Second,
+		PongWait:       time.Minute,
+		PingPeriod:     time.Minute,
+		MaxMessageSize: 512,
+	})
+	go h.Run()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeWS(w, r, &entities.User{ID: 1, Username: "alice"})
+	}))
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{AuthSubprotocol, "abc.def.ghi"}}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Сервер выбирает только AuthSubprotocol, токен обратно не отправляется
+	if got := conn.Subprotocol(); got != AuthSubprotocol {
+		t.Fatalf("negotiated subprotocol = %q, want %q", got, AuthSubprotocol)
+	}
+	if header := resp.Header.Get("Sec-WebSocket-Protocol"); strings.Contains(header, "abc.def.ghi") {
+		t.Fatalf("response echoes the token: %q", header)
+	}
+}
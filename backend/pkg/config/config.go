@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	CORS     CORSConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	CORS      CORSConfig
+	Chat      ChatConfig
+	Jobs      JobsConfig
+	Keys      KeysConfig
+	WebSocket WebSocketConfig
+	Admin     AdminConfig
 }
 
 type ServerConfig struct {
@@ -19,6 +25,10 @@ type ServerConfig struct {
 	Port         int
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// RequestTimeout - предельное время обработки одного HTTP запроса; 0 - без ограничения
+	RequestTimeout time.Duration
+	// PlaintextPaths - префиксы путей, запросы и ответы которых не проходят через шифрование сессии
+	PlaintextPaths []string
 }
 
 type DatabaseConfig struct {
@@ -28,11 +38,35 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	MaxOpenConns      int
+	MaxIdleConns      int
+	ConnMaxLifetime   time.Duration
+	ConnectRetries    int
+	ConnectRetryDelay time.Duration
+
+	// LogLevel - уровень журнала SQL-запросов GORM: silent, error, warn или info; info выводит
+	// каждый запрос вместе с параметрами и не предназначен для продакшена
+	LogLevel string
 }
 
 type JWTConfig struct {
 	Secret    string
 	ExpiresIn time.Duration
+	// GuestTokenTTL - срок действия гостевой ссылки на чат только для чтения
+	GuestTokenTTL time.Duration
+	// MaxSessionsPerUser - сколько сессий может быть у пользователя одновременно; при входе сверх
+	// лимита удаляются самые старые. 0 - без ограничения
+	MaxSessionsPerUser int
+	// SessionIdleTimeout - сессия без запросов дольше этого времени завершается при следующей
+	// проверке токена; 0 - не ограничивать
+	SessionIdleTimeout time.Duration
+}
+
+type AdminConfig struct {
+	// UserIDs - ID пользователей с доступом к административным маршрутам /admin; указываются ID,
+	// а не имена, поскольку имя пользователя можно сменить
+	UserIDs []uint
 }
 
 type CORSConfig struct {
@@ -41,14 +75,90 @@ type CORSConfig struct {
 	AllowedHeaders []string
 }
 
+type ChatConfig struct {
+	MaxMessagesPerMinute int
+	MaxAttachmentSize    int
+	MaxThumbnailSize     int
+	// ControlCharsPolicy - "strip" удаляет управляющие символы из текста, "reject" отклоняет сообщение
+	ControlCharsPolicy string
+	// HistoryLimit - сколько последних сообщений чата доступно при постраничной загрузке; 0 - без ограничения
+	HistoryLimit int
+	// EditWindow - в течение какого времени после отправки сообщение можно изменить; 0 - без ограничения
+	EditWindow time.Duration
+	// EditWindowAdminExempt - администраторы группы могут изменять свои сообщения вне окна
+	EditWindowAdminExempt bool
+	// RestoreWindow - в течение какого времени после удаления сообщение можно восстановить;
+	// по истечении окна сообщение стирается окончательно. 0 - восстановление и очистка отключены
+	RestoreWindow time.Duration
+	// ContentFilterWordlist - файл со списком слов для фильтра содержимого; пусто - фильтр отключен
+	ContentFilterWordlist string
+	// ContentFilterAction - что делать с сообщением, содержащим слово из списка: "flag" или "reject"
+	ContentFilterAction string
+	// AllowedMessageTypes - типы сообщений, которые могут отправлять клиенты; "system" всегда только серверный
+	AllowedMessageTypes []string
+	// EncryptedReactions - принимать реакции, зашифрованные на клиенте; сервер хранит шифротекст
+	// и считает только их общее количество
+	EncryptedReactions bool
+	// MessageAlgorithm - алгоритм шифрования новых сообщений ("aes-256-cbc" или "aes-256-gcm");
+	// сообщения, сохраненные другим поддерживаемым алгоритмом, по-прежнему расшифровываются
+	MessageAlgorithm string
+}
+
+type JobsConfig struct {
+	KeyExchangeCleanupInterval  time.Duration
+	PendingKeyExchangeMaxAge    time.Duration
+	DeletedMessagePurgeInterval time.Duration
+}
+
+type KeysConfig struct {
+	// ServerHoldsKeys - генерировать и хранить приватные ключи новых пользователей на сервере;
+	// при false регистрация принимает только публичные ключи клиента
+	ServerHoldsKeys bool
+	// KeyExchangeTTL - срок действия сессии обмена ключами
+	KeyExchangeTTL time.Duration
+	// KeyExchangeIdleTimeout - сессия без активности дольше этого времени становится недействительной
+	// до истечения KeyExchangeTTL; 0 - не ограничивать
+	KeyExchangeIdleTimeout time.Duration
+}
+
+type WebSocketConfig struct {
+	// SendBufferSize - размер буфера исходящих кадров одного подключения
+	SendBufferSize int
+	// SendTimeout - сколько ждать освобождения заполненного буфера, прежде чем пропустить кадр
+	SendTimeout time.Duration
+	// MaxSendFailures - после скольких пропущенных подряд кадров медленный клиент отключается
+	MaxSendFailures int
+	// EnableCompression - согласовывать с клиентами сжатие permessage-deflate
+	EnableCompression bool
+	// CompressionLevel - уровень сжатия flate от -2 до 9; 1 - быстрое сжатие
+	CompressionLevel int
+	// DedupSize - сколько последних client_msg_id подключения помнить для отсева повторов; 0 - не отслеживать
+	DedupSize int
+	// WriteWait - предельное время записи одного кадра клиенту
+	WriteWait time.Duration
+	// PongWait - сколько ждать pong (или любого кадра) от клиента, прежде чем считать подключение потерянным
+	PongWait time.Duration
+	// PingPeriod - интервал отправки ping; должен быть меньше PongWait, чтобы клиент успел ответить
+	PingPeriod time.Duration
+	// MaxMessageSize - максимальный размер входящего кадра в байтах
+	MaxMessageSize int64
+	// ReplayEvents - сколько последних событий пользователя хранится для resume; меньше SendBufferSize,
+	// чтобы воспроизведение вместе с подтверждением помещалось в буфер клиента
+	ReplayEvents int
+	// ReplayWindow - сколько хранить журнал событий пользователя после отключения его последнего клиента
+	ReplayWindow time.Duration
+}
+
 // Load - загружает конфигурацию приложения из переменных окружения
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:         getEnv("SERVER_HOST", "localhost"),
-			Port:         getEnvAsInt("SERVER_PORT", 8080),
-			ReadTimeout:  getEnvAsDuration("READ_TIMEOUT", "30s"),
-			WriteTimeout: getEnvAsDuration("WRITE_TIMEOUT", "30s"),
+			Host:           getEnv("SERVER_HOST", "localhost"),
+			Port:           getEnvAsInt("SERVER_PORT", 8080),
+			ReadTimeout:    getEnvAsDuration("READ_TIMEOUT", "30s"),
+			WriteTimeout:   getEnvAsDuration("WRITE_TIMEOUT", "30s"),
+			RequestTimeout: getEnvAsDuration("REQUEST_TIMEOUT", "25s"),
+			PlaintextPaths: getEnvAsList("ENCRYPTION_BYPASS_PATHS", "/health,/metrics,/swagger"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -57,19 +167,73 @@ func Load() *Config {
 			Password: getEnv("DB_PASSWORD", "53849462s"),
 			DBName:   getEnv("DB_NAME", "sleek_chat"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			MaxOpenConns:      getEnvAsInt("DB_MAX_OPEN_CONNS", 25),
+			MaxIdleConns:      getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
+			ConnMaxLifetime:   getEnvAsDuration("DB_CONN_MAX_LIFETIME", "5m"),
+			ConnectRetries:    getEnvAsInt("DB_CONNECT_RETRIES", 5),
+			ConnectRetryDelay: getEnvAsDuration("DB_CONNECT_RETRY_DELAY", "1s"),
+
+			LogLevel: strings.ToLower(strings.TrimSpace(getEnv("DB_LOG_LEVEL", "warn"))),
 		},
 		JWT: JWTConfig{
-			Secret:    getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
-			ExpiresIn: getEnvAsDuration("JWT_EXPIRES_IN", "24h"),
+			Secret:        getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-in-production"),
+			ExpiresIn:     getEnvAsDuration("JWT_EXPIRES_IN", "24h"),
+			GuestTokenTTL: getEnvAsDuration("GUEST_TOKEN_TTL", "24h"),
+
+			MaxSessionsPerUser: getEnvAsInt("MAX_SESSIONS_PER_USER", 20),
+			SessionIdleTimeout: getEnvAsDuration("SESSION_IDLE_TIMEOUT", "0"),
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: []string{
 				getEnv("FRONTEND_URL", "http://localhost:3000"),
 				"http://localhost:5173",
 			},
-			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 			AllowedHeaders: []string{"Content-Type", "Authorization", "X-Requested-With"},
 		},
+		Chat: ChatConfig{
+			MaxMessagesPerMinute:  getEnvAsInt("MAX_MESSAGES_PER_MINUTE", 30),
+			MaxAttachmentSize:     getEnvAsInt("MAX_ATTACHMENT_SIZE", 10<<20),
+			MaxThumbnailSize:      getEnvAsInt("MAX_THUMBNAIL_SIZE", 64<<10),
+			ControlCharsPolicy:    getEnv("MESSAGE_CONTROL_CHARS_POLICY", "strip"),
+			HistoryLimit:          getEnvAsInt("MESSAGE_HISTORY_LIMIT", 10000),
+			EditWindow:            getEnvAsDuration("MESSAGE_EDIT_WINDOW", "24h"),
+			EditWindowAdminExempt: getEnvAsBool("MESSAGE_EDIT_WINDOW_ADMIN_EXEMPT", false),
+			RestoreWindow:         getEnvAsDuration("MESSAGE_RESTORE_WINDOW", "10s"),
+			ContentFilterWordlist: getEnv("CONTENT_FILTER_WORDLIST", ""),
+			ContentFilterAction:   getEnv("CONTENT_FILTER_ACTION", "flag"),
+			AllowedMessageTypes:   getEnvAsList("MESSAGE_ALLOWED_TYPES", "text,image,file"),
+			EncryptedReactions:    getEnvAsBool("ENCRYPTED_REACTIONS", false),
+			MessageAlgorithm:      getEnv("MESSAGE_ENCRYPTION_ALGORITHM", "aes-256-cbc"),
+		},
+		Jobs: JobsConfig{
+			KeyExchangeCleanupInterval:  getEnvAsDuration("KEY_EXCHANGE_CLEANUP_INTERVAL", "1h"),
+			PendingKeyExchangeMaxAge:    getEnvAsDuration("PENDING_KEY_EXCHANGE_MAX_AGE", "24h"),
+			DeletedMessagePurgeInterval: getEnvAsDuration("DELETED_MESSAGE_PURGE_INTERVAL", "1m"),
+		},
+		Keys: KeysConfig{
+			ServerHoldsKeys:        getEnvAsBool("SERVER_HOLDS_KEYS", true),
+			KeyExchangeTTL:         getEnvAsDuration("KEY_EXCHANGE_TTL", "24h"),
+			KeyExchangeIdleTimeout: getEnvAsDuration("KEY_EXCHANGE_IDLE_TIMEOUT", "30m"),
+		},
+		WebSocket: WebSocketConfig{
+			SendBufferSize:    getEnvAsInt("WS_SEND_BUFFER_SIZE", 256),
+			SendTimeout:       getEnvAsDuration("WS_SEND_TIMEOUT", "100ms"),
+			MaxSendFailures:   getEnvAsInt("WS_MAX_SEND_FAILURES", 3),
+			EnableCompression: getEnvAsBool("WS_ENABLE_COMPRESSION", true),
+			CompressionLevel:  getEnvAsInt("WS_COMPRESSION_LEVEL", 1),
+			DedupSize:         getEnvAsInt("WS_DEDUP_SIZE", 256),
+			WriteWait:         getEnvAsDuration("WS_WRITE_WAIT", "10s"),
+			PongWait:          getEnvAsDuration("WS_PONG_WAIT", "60s"),
+			PingPeriod:        getEnvAsDuration("WS_PING_PERIOD", "54s"),
+			MaxMessageSize:    int64(getEnvAsInt("WS_MAX_MESSAGE_SIZE", 512)),
+			ReplayEvents:      getEnvAsInt("WS_REPLAY_EVENTS", 200),
+			ReplayWindow:      getEnvAsDuration("WS_REPLAY_WINDOW", "10m"),
+		},
+		Admin: AdminConfig{
+			UserIDs: getEnvAsUintList("ADMIN_USER_IDS"),
+		},
 	}
 }
 
@@ -79,6 +243,54 @@ func (c *DatabaseConfig) DSN() string {
 		c.Host, c.Port, c.Username, c.Password, c.DBName, c.SSLMode)
 }
 
+// Validate - проверяет корректность настроек пула соединений и уровня журнала базы данных
+func (c *DatabaseConfig) Validate() error {
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("DB_MAX_OPEN_CONNS must not be negative, got %d", c.MaxOpenConns)
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("DB_MAX_IDLE_CONNS must not be negative, got %d", c.MaxIdleConns)
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	if c.ConnMaxLifetime < 0 {
+		return fmt.Errorf("DB_CONN_MAX_LIFETIME must not be negative, got %s", c.ConnMaxLifetime)
+	}
+	if c.ConnectRetries < 0 {
+		return fmt.Errorf("DB_CONNECT_RETRIES must not be negative, got %d", c.ConnectRetries)
+	}
+	switch c.LogLevel {
+	case "silent", "error", "warn", "info":
+	default:
+		return fmt.Errorf("DB_LOG_LEVEL must be one of silent, error, warn, info, got %q", c.LogLevel)
+	}
+	return nil
+}
+
+// Validate - проверяет таймауты WebSocket подключений и размеры журнала событий
+func (c *WebSocketConfig) Validate() error {
+	if c.WriteWait <= 0 {
+		return fmt.Errorf("WS_WRITE_WAIT must be positive, got %s", c.WriteWait)
+	}
+	if c.PongWait <= 0 {
+		return fmt.Errorf("WS_PONG_WAIT must be positive, got %s", c.PongWait)
+	}
+	if c.PingPeriod <= 0 || c.PingPeriod >= c.PongWait {
+		return fmt.Errorf("WS_PING_PERIOD (%s) must be positive and less than WS_PONG_WAIT (%s)", c.PingPeriod, c.PongWait)
+	}
+	if c.MaxMessageSize <= 0 {
+		return fmt.Errorf("WS_MAX_MESSAGE_SIZE must be positive, got %d", c.MaxMessageSize)
+	}
+	if c.ReplayEvents <= 0 || c.ReplayEvents >= c.SendBufferSize {
+		return fmt.Errorf("WS_REPLAY_EVENTS (%d) must be positive and less than WS_SEND_BUFFER_SIZE (%d)", c.ReplayEvents, c.SendBufferSize)
+	}
+	if c.ReplayWindow <= 0 {
+		return fmt.Errorf("WS_REPLAY_WINDOW must be positive, got %s", c.ReplayWindow)
+	}
+	return nil
+}
+
 // getEnv - получает значение переменной окружения или возвращает значение по умолчанию
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -97,6 +309,39 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsBool - получает переменную окружения как логическое значение или возвращает значение по умолчанию
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList - получает переменную окружения как список значений через запятую или возвращает значение по умолчанию
+func getEnvAsList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsUintList - получает переменную окружения как список неотрицательных чисел через запятую;
+// некорректные значения пропускаются
+func getEnvAsUintList(key string) []uint {
+	var values []uint
+	for _, value := range getEnvAsList(key, "") {
+		if parsed, err := strconv.ParseUint(value, 10, 32); err == nil {
+			values = append(values, uint(parsed))
+		}
+	}
+	return values
+}
+
 // getEnvAsDuration - получает переменную окружения как продолжительность времени или возвращает значение по умолчанию
 func getEnvAsDuration(key string, defaultValue string) time.Duration {
 	if value := os.Getenv(key); value != "" {
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		SendBufferSize: 256,
+		WriteWait:      10 * time.Second,
+		PongWait:       60 * time.Second,
+		PingPeriod:     54 * time.Second,
+		MaxMessageSize: 512,
+		ReplayEvents:   200,
+		ReplayWindow:   10 * time.Minute,
+	}
+}
+
+func TestWebSocketConfigValidateReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *WebSocketConfig)
+		wantErr string
+	}{
+		{"defaults", func(c *WebSocketConfig) {}, ""},
+		{"replay fills send buffer", func(c *WebSocketConfig) { c.ReplayEvents = c.SendBufferSize }, "WS_REPLAY_EVENTS"},
+		{"send buffer shrunk below replay", func(c *WebSocketConfig) { c.SendBufferSize = 64 }, "WS_REPLAY_EVENTS"},
+		{"no replay events", func(c *WebSocketConfig) { c.ReplayEvents = 0 }, "WS_REPLAY_EVENTS"},
+		{"no replay window", func(c *WebSocketConfig) { c.ReplayWindow = 0 }, "WS_REPLAY_WINDOW"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validWebSocketConfig()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebSocketConfigValidateTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *WebSocketConfig)
+		wantErr string
+	}{
+		{"custom values", func(c *WebSocketConfig) { c.PongWait, c.PingPeriod = 2*time.Minute, time.Minute }, ""},
+		{"no write wait", func(c *WebSocketConfig) { c.WriteWait = 0 }, "WS_WRITE_WAIT"},
+		{"no pong wait", func(c *WebSocketConfig) { c.PongWait = 0 }, "WS_PONG_WAIT"},
+		{"ping period equals pong wait", func(c *WebSocketConfig) { c.PingPeriod = c.PongWait }, "WS_PING_PERIOD"},
+		{"ping period above pong wait", func(c *WebSocketConfig) { c.PingPeriod = 2 * c.PongWait }, "WS_PING_PERIOD"},
+		{"no ping period", func(c *WebSocketConfig) { c.PingPeriod = 0 }, "WS_PING_PERIOD"},
+		{"no frame size", func(c *WebSocketConfig) { c.MaxMessageSize = 0 }, "WS_MAX_MESSAGE_SIZE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validWebSocketConfig()
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDatabaseConfigValidatePool(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *DatabaseConfig)
+		wantErr string
+	}{
+		{"defaults", func(c *DatabaseConfig) {}, ""},
+		{"unlimited open connections", func(c *DatabaseConfig) { c.MaxOpenConns = 0; c.MaxIdleConns = 50 }, ""},
+		{"negative open connections", func(c *DatabaseConfig) { c.MaxOpenConns = -1 }, "DB_MAX_OPEN_CONNS"},
+		{"negative idle connections", func(c *DatabaseConfig) { c.MaxIdleConns = -1 }, "DB_MAX_IDLE_CONNS"},
+		{"more idle than open", func(c *DatabaseConfig) { c.MaxIdleConns = c.MaxOpenConns + 1 }, "DB_MAX_IDLE_CONNS"},
+		{"negative lifetime", func(c *DatabaseConfig) { c.ConnMaxLifetime = -time.Second }, "DB_CONN_MAX_LIFETIME"},
+		{"negative retries", func(c *DatabaseConfig) { c.ConnectRetries = -1 }, "DB_CONNECT_RETRIES"},
+		{"quiet log level", func(c *DatabaseConfig) { c.LogLevel = "silent" }, ""},
+		{"unknown log level", func(c *DatabaseConfig) { c.LogLevel = "debug" }, "DB_LOG_LEVEL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Load().Database
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDatabasePoolFromEnv(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "40")
+	t.Setenv("DB_MAX_IDLE_CONNS", "15")
+	t.Setenv("DB_CONN_MAX_LIFETIME", "90s")
+
+	cfg := Load().Database
+	if cfg.MaxOpenConns != 40 || cfg.MaxIdleConns != 15 || cfg.ConnMaxLifetime != 90*time.Second {
+		t.Fatalf("pool = %d/%d/%s, want 40/15/1m30s", cfg.MaxOpenConns, cfg.MaxIdleConns, cfg.ConnMaxLifetime)
+	}
+}
+
+func TestLoadDatabaseLogLevelFromEnv(t *testing.T) {
+	// По умолчанию SQL-запросы не выводятся, только предупреждения
+	t.Setenv("DB_LOG_LEVEL", "")
+	if level := Load().Database.LogLevel; level != "warn" {
+		t.Fatalf("default log level = %q, want warn", level)
+	}
+
+	t.Setenv("DB_LOG_LEVEL", " Info ")
+	cfg := Load().Database
+	if cfg.LogLevel != "info" {
+		t.Fatalf("log level = %q, want info", cfg.LogLevel)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+}
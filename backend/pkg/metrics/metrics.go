@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Registry - потокобезопасный набор именованных счетчиков
+type Registry struct {
+	mu       sync.RWMutex
+	counters map[string]*atomic.Int64
+}
+
+// New - создает новый пустой набор счетчиков
+func New() *Registry {
+	return &Registry{
+		counters: make(map[string]*atomic.Int64),
+	}
+}
+
+// Inc - увеличивает счетчик с указанным именем на единицу
+func (r *Registry) Inc(name string) {
+	r.Add(name, 1)
+}
+
+// Add - увеличивает счетчик с указанным именем на delta
+func (r *Registry) Add(name string, delta int64) {
+	if r == nil {
+		return
+	}
+	r.counter(name).Add(delta)
+}
+
+// Get - возвращает текущее значение счетчика
+func (r *Registry) Get(name string) int64 {
+	if r == nil {
+		return 0
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if counter, ok := r.counters[name]; ok {
+		return counter.Load()
+	}
+	return 0
+}
+
+// Snapshot - возвращает копию значений всех счетчиков
+func (r *Registry) Snapshot() map[string]int64 {
+	if r == nil {
+		return map[string]int64{}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]int64, len(r.counters))
+	for name, counter := range r.counters {
+		snapshot[name] = counter.Load()
+	}
+	return snapshot
+}
+
+// counter - возвращает счетчик по имени, создавая его при первом обращении
+func (r *Registry) counter(name string) *atomic.Int64 {
+	r.mu.RLock()
+	counter, ok := r.counters[name]
+	r.mu.RUnlock()
+	if ok {
+		return counter
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if counter, ok = r.counters[name]; !ok {
+		counter = new(atomic.Int64)
+		r.counters[name] = counter
+	}
+	return counter
+}
@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket - token bucket одного ключа; evicted выставляется уборщиком при удалении из хранилища
+type bucket struct {
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	evicted    bool
+}
+
+// RateLimiter - потокобезопасное ограничение частоты по алгоритму token bucket с произвольными
+// ключами (ID пользователя, IP и т.п.). Фоновый уборщик удаляет корзины, к которым не обращались
+// дольше idleTTL, чтобы разовые ключи не накапливались в памяти
+type RateLimiter struct {
+	buckets    sync.Map
+	capacity   float64
+	refillRate float64
+	idleTTL    time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// New - создает ограничитель на limit событий за period и запускает уборщика.
+// idleTTL не меньше period: к этому моменту корзина все равно заполнилась бы полностью.
+// При limit <= 0 возвращает nil: nil-ограничитель разрешает все события
+func New(limit int, period, idleTTL time.Duration) *RateLimiter {
+	if limit <= 0 || period <= 0 {
+		return nil
+	}
+	idleTTL = max(idleTTL, period)
+
+	l := &RateLimiter{
+		capacity:   float64(limit),
+		refillRate: float64(limit) / period.Seconds(),
+		idleTTL:    idleTTL,
+		stop:       make(chan struct{}),
+	}
+
+	go l.janitor()
+	return l
+}
+
+// Allow - списывает токен ключа и сообщает, разрешено ли событие
+func (l *RateLimiter) Allow(key any) bool {
+	if l == nil {
+		return true
+	}
+
+	for {
+		now := time.Now()
+		value, _ := l.buckets.LoadOrStore(key, &bucket{tokens: l.capacity, lastRefill: now})
+		b := value.(*bucket)
+
+		b.mu.Lock()
+		// Корзину удалили между загрузкой и блокировкой - берем новую, чтобы не потерять списание
+		if b.evicted {
+			b.mu.Unlock()
+			continue
+		}
+
+		elapsed := now.Sub(b.lastRefill).Seconds()
+		if elapsed > 0 {
+			b.tokens = min(l.capacity, b.tokens+elapsed*l.refillRate)
+			b.lastRefill = now
+		}
+
+		allowed := b.tokens >= 1
+		if allowed {
+			b.tokens--
+		}
+		b.mu.Unlock()
+		return allowed
+	}
+}
+
+// RetryAfter - возвращает, через сколько у ключа появится токен, не списывая его; 0, если событие
+// разрешено уже сейчас
+func (l *RateLimiter) RetryAfter(key any) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	value, ok := l.buckets.Load(key)
+	if !ok {
+		return 0
+	}
+	b := value.(*bucket)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.evicted {
+		return 0
+	}
+
+	tokens := min(l.capacity, b.tokens+time.Since(b.lastRefill).Seconds()*l.refillRate)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.refillRate * float64(time.Second))
+}
+
+// Reset - забывает корзину ключа, возвращая ему полный запас событий
+func (l *RateLimiter) Reset(key any) {
+	if l == nil {
+		return
+	}
+
+	value, ok := l.buckets.Load(key)
+	if !ok {
+		return
+	}
+	b := value.(*bucket)
+
+	b.mu.Lock()
+	b.evicted = true
+	l.buckets.CompareAndDelete(key, b)
+	b.mu.Unlock()
+}
+
+// Len - возвращает число отслеживаемых ключей
+func (l *RateLimiter) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	n := 0
+	l.buckets.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// Stop - останавливает уборщика; повторные вызовы безопасны
+func (l *RateLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	l.stopOnce.Do(func() { close(l.stop) })
+}
+
+// janitor - периодически удаляет простаивающие корзины
+func (l *RateLimiter) janitor() {
+	ticker := time.NewTicker(l.idleTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			l.evictIdle(now)
+		}
+	}
+}
+
+// evictIdle - удаляет корзины, к которым не обращались дольше idleTTL
+func (l *RateLimiter) evictIdle(now time.Time) {
+	l.buckets.Range(func(key, value any) bool {
+		b := value.(*bucket)
+
+		b.mu.Lock()
+		if now.Sub(b.lastRefill) >= l.idleTTL {
+			b.evicted = true
+			l.buckets.Delete(key)
+		}
+		b.mu.Unlock()
+		return true
+	})
+}
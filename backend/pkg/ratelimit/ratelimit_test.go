@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNilLimiterAllowsEverything(t *testing.T) {
+	l := New(0, time.Minute, time.Minute)
+	if l != nil {
+		t.Fatal("New with limit 0 returned a limiter")
+	}
+	if !l.Allow("key") || l.RetryAfter("key") != 0 || l.Len() != 0 {
+		t.Fatal("nil limiter restricted an event")
+	}
+	l.Reset("key")
+	l.Stop()
+}
+
+func TestAllowEnforcesLimitPerKey(t *testing.T) {
+	l := New(3, time.Hour, time.Hour)
+	defer l.Stop()
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow(1) {
+			t.Fatalf("event %d rejected within the limit", i)
+		}
+	}
+	if l.Allow(1) {
+		t.Fatal("event over the limit allowed")
+	}
+	if !l.Allow(2) {
+		t.Fatal("another key shares the bucket")
+	}
+}
+
+func TestRetryAfterAndReset(t *testing.T) {
+	l := New(2, time.Minute, time.Minute)
+	defer l.Stop()
+
+	if wait := l.RetryAfter("ip"); wait != 0 {
+		t.Fatalf("RetryAfter of unknown key = %s, want 0", wait)
+	}
+
+	l.Allow("ip")
+	if wait := l.RetryAfter("ip"); wait != 0 {
+		t.Fatalf("RetryAfter with a token left = %s, want 0", wait)
+	}
+	l.Allow("ip")
+
+	// Один токен восполняется за period/limit = 30 секунд
+	wait := l.RetryAfter("ip")
+	if wait <= 29*time.Second || wait > 30*time.Second {
+		t.Fatalf("RetryAfter of exhausted key = %s, want about 30s", wait)
+	}
+	// Проверка не списывает токены
+	if again := l.RetryAfter("ip"); again > wait {
+		t.Fatalf("RetryAfter grew from %s to %s", wait, again)
+	}
+
+	l.Reset("ip")
+	if wait := l.RetryAfter("ip"); wait != 0 || l.Len() != 0 {
+		t.Fatalf("after Reset: RetryAfter = %s, Len = %d", wait, l.Len())
+	}
+	if !l.Allow("ip") {
+		t.Fatal("reset key rejected")
+	}
+}
+
+func TestEvictIdleRemovesOnlyIdleBuckets(t *testing.T) {
+	l := New(5, time.Second, time.Minute)
+	defer l.Stop()
+
+	l.Allow("idle")
+	l.Allow("active")
+
+	value, _ := l.buckets.Load("idle")
+	idle := value.(*bucket)
+	idle.mu.Lock()
+	idle.lastRefill = time.Now().Add(-2 * time.Minute)
+	idle.mu.Unlock()
+
+	l.evictIdle(time.Now())
+
+	if _, ok := l.buckets.Load("idle"); ok {
+		t.Fatal("idle bucket was not evicted")
+	}
+	if _, ok := l.buckets.Load("active"); !ok {
+		t.Fatal("active bucket was evicted")
+	}
+}
+
+func TestJanitorCollectsIdleBuckets(t *testing.T) {
+	l := New(5, 10*time.Millisecond, 10*time.Millisecond)
+	defer l.Stop()
+
+	for i := 0; i < 100; i++ {
+		l.Allow(fmt.Sprintf("one-time-%d", i))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for l.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor left %d idle buckets", l.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConcurrentAllowNeverExceedsLimit(t *testing.T) {
+	const limit = 50
+	// Восполнение за час пренебрежимо мало за время теста
+	l := New(limit, time.Hour, time.Hour)
+	defer l.Stop()
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if l.Allow("shared") {
+					allowed.Add(1)
+				}
+				l.RetryAfter("shared")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != limit {
+		t.Fatalf("allowed %d events, want %d", got, limit)
+	}
+}
+
+func TestConcurrentAllowDuringEviction(t *testing.T) {
+	l := New(1000, time.Millisecond, time.Millisecond)
+	defer l.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				key := j % 10
+				l.Allow(key)
+				if j%50 == 0 {
+					l.Reset(key)
+				}
+			}
+		}(i)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.evictIdle(time.Now().Add(time.Hour))
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	<-done
+}
@@ -0,0 +1,99 @@
+package response
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Коды ошибок по умолчанию для HTTP статусов; обработчики могут передавать и более точные коды
+const (
+	CodeBadRequest      = "BAD_REQUEST"
+	CodeUnauthorized    = "UNAUTHORIZED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeGone            = "GONE"
+	CodePayloadTooLarge = "PAYLOAD_TOO_LARGE"
+	CodeTooManyRequests = "TOO_MANY_REQUESTS"
+	CodeInternal        = "INTERNAL_ERROR"
+	CodeUnavailable     = "SERVICE_UNAVAILABLE"
+)
+
+// Envelope - единый формат ответа API: success, данные при успехе либо ошибка; Meta - сведения
+// о пагинации для постраничных ответов
+type Envelope struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Error   *ErrorBody  `json:"error,omitempty"`
+}
+
+// ErrorBody - описание ошибки: машиночитаемый код, сообщение и необязательные подробности
+type ErrorBody struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Success - отправляет успешный ответ с указанным статусом
+func Success(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, Envelope{Success: true, Data: data})
+}
+
+// SuccessWithMeta - отправляет успешный ответ с данными и сведениями о пагинации
+func SuccessWithMeta(c *gin.Context, status int, data, meta interface{}) {
+	c.JSON(status, Envelope{Success: true, Data: data, Meta: meta})
+}
+
+// Error - отправляет ответ с ошибкой; пустой code заменяется кодом по умолчанию для статуса
+func Error(c *gin.Context, status int, code, message string) {
+	ErrorWithDetails(c, status, code, message, nil)
+}
+
+// ErrorWithDetails - отправляет ответ с ошибкой и дополнительными подробностями
+func ErrorWithDetails(c *gin.Context, status int, code, message string, details map[string]interface{}) {
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+	c.JSON(status, Envelope{
+		Success: false,
+		Error: &ErrorBody{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// Abort - отправляет ответ с ошибкой и прерывает цепочку обработчиков
+func Abort(c *gin.Context, status int, code, message string) {
+	Error(c, status, code, message)
+	c.Abort()
+}
+
+// CodeForStatus - возвращает код ошибки по умолчанию для HTTP статуса
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,149 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// decodeBody - разбирает тело ответа в карту, чтобы проверять набор полей конверта
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON %q: %v", recorder.Body.String(), err)
+	}
+	return body
+}
+
+func keys(m map[string]interface{}) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestSuccessEnvelope(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	Success(c, http.StatusCreated, gin.H{"id": 1})
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusCreated)
+	}
+	body := decodeBody(t, recorder)
+	if got, want := keys(body), []string{"data", "success"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+	if body["success"] != true {
+		t.Fatalf("success = %v, want true", body["success"])
+	}
+	if data := body["data"].(map[string]interface{}); data["id"] != float64(1) {
+		t.Fatalf("data = %v", data)
+	}
+}
+
+func TestSuccessWithMetaEnvelope(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	SuccessWithMeta(c, http.StatusOK, []int{1, 2}, gin.H{"total": 2})
+
+	body := decodeBody(t, recorder)
+	if got, want := keys(body), []string{"data", "meta", "success"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+	if meta := body["meta"].(map[string]interface{}); meta["total"] != float64(2) {
+		t.Fatalf("meta = %v", meta)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		code     string
+		wantCode string
+	}{
+		{"explicit code", http.StatusConflict, "LAST_ADMIN", "LAST_ADMIN"},
+		{"default for 404", http.StatusNotFound, "", CodeNotFound},
+		{"default for 429", http.StatusTooManyRequests, "", CodeTooManyRequests},
+		{"default for unknown", http.StatusTeapot, "", CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+
+			Error(c, tt.status, tt.code, "something failed")
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			body := decodeBody(t, recorder)
+			if got, want := keys(body), []string{"error", "success"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("keys = %v, want %v", got, want)
+			}
+			if body["success"] != false {
+				t.Fatalf("success = %v, want false", body["success"])
+			}
+			errBody := body["error"].(map[string]interface{})
+			if got, want := keys(errBody), []string{"code", "message"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("error keys = %v, want %v", got, want)
+			}
+			if errBody["code"] != tt.wantCode || errBody["message"] != "something failed" {
+				t.Fatalf("error = %v", errBody)
+			}
+		})
+	}
+}
+
+func TestErrorWithDetails(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	ErrorWithDetails(c, http.StatusTooManyRequests, "", "slow down", map[string]interface{}{"retry_after": 5})
+
+	errBody := decodeBody(t, recorder)["error"].(map[string]interface{})
+	details, ok := errBody["details"].(map[string]interface{})
+	if !ok || details["retry_after"] != float64(5) {
+		t.Fatalf("details = %v", errBody["details"])
+	}
+}
+
+func TestAbortStopsChain(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(recorder)
+
+	reached := false
+	router.GET("/", func(c *gin.Context) {
+		Abort(c, http.StatusUnauthorized, "", "no token")
+	}, func(c *gin.Context) {
+		reached = true
+	})
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if reached {
+		t.Fatal("handler after Abort was called")
+	}
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+	if code := decodeBody(t, recorder)["error"].(map[string]interface{})["code"]; code != CodeUnauthorized {
+		t.Fatalf("code = %v, want %s", code, CodeUnauthorized)
+	}
+}
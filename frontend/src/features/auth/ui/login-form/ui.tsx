@@ -12,6 +12,7 @@ import { chatAPI } from '@/shared/api/chatApi';
 import { ECDHService } from '@/shared/lib/crypto/ecdh';
 import { ECDSAService } from '@/shared/lib/crypto/ecdsa';
 import { RSAService } from '@/shared/lib/crypto/rsa';
+import { loadIdentityKeys } from '@/shared/lib/crypto/identityKeys';
 import { websocketService } from '@/shared/lib/websocket/websocketService';
 import { getErrorMessage } from '@/shared/lib/errors/errorMessages';
 import { Loader2 } from 'lucide-react';
@@ -50,18 +51,24 @@ export const LoginForm = () => {
       // Generate ECDH key pair for secure communication
       const ecdhKeyPair = ECDHService.generateKeyPair();
 
+      // Ключи идентичности, сохраненные при регистрации, сервер сверяет с зарегистрированными;
+      // без них на этом устройстве создаются временные ключи, которые на сервер не отправляются
+      const identityKeys = loadIdentityKeys(formData.username);
+
       // Generate ECDSA key pair for authentication
-      const ecdsaKeyPair = ECDSAService.generateStaticKeyPair();
+      const ecdsaKeyPair = identityKeys?.ecdsa ?? ECDSAService.generateStaticKeyPair();
 
       // Generate RSA key pair for encryption
-      const rsaKeyPair = await RSAService.generateKeyPair();
+      const rsaKeyPair = identityKeys?.rsa ?? await RSAService.generateKeyPair();
 
       const response = await chatAPI.login({
         username: formData.username,
         password: formData.password,
         ecdhPublicKey: ecdhKeyPair.publicKey,
-        ecdsaPublicKey: ecdsaKeyPair.publicKey,
-        rsaPublicKey: rsaKeyPair.publicKey,
+        ...(identityKeys ? {
+          ecdsaPublicKey: identityKeys.ecdsa.publicKey,
+          rsaPublicKey: identityKeys.rsa.publicKey,
+        } : {}),
       });
 
       console.log('Login response:', response);
@@ -8,6 +8,7 @@ import { Label } from '@/shared/ui/label';
 import { chatAPI } from '@/shared/api/chatApi';
 import { ECDSAService } from '@/shared/lib/crypto/ecdsa';
 import { RSAService } from '@/shared/lib/crypto/rsa';
+import { saveIdentityKeys } from '@/shared/lib/crypto/identityKeys';
 import { validatePassword, getPasswordStrength } from '@/shared/lib/validation/password';
 import { getErrorMessage } from '@/shared/lib/errors/errorMessages';
 import { CheckCircle, Loader2 } from 'lucide-react';
@@ -87,6 +88,9 @@ export const RegisterForm = () => {
         rsaPublicKey: rsaKeyPair.publicKey,
       });
 
+      // Приватные ключи остаются на устройстве: при входе сервер сверяет с ними публичные
+      saveIdentityKeys(formData.username, { ecdsa: ecdsaKeyPair, rsa: rsaKeyPair });
+
       // Успешная регистрация - показываем сообщение и запускаем таймер
       setSuccessMessage('Registration successful! Redirecting to login page...');
       setCountdown(5);
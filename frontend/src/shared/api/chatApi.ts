@@ -6,8 +6,8 @@ export interface LoginRequest {
   username: string;
   password: string;
   ecdhPublicKey: string;
-  ecdsaPublicKey: string;
-  rsaPublicKey: string;
+  ecdsaPublicKey?: string;
+  rsaPublicKey?: string;
 }
 
 export interface RegisterRequest {
@@ -64,7 +64,7 @@ class ChatAPI {
         // Клонируем ответ, чтобы можно было прочитать тело дважды
         const responseClone = response.clone();
         const errorData = await responseClone.json();
-        errorMessage = errorData.error || errorData.message || errorMessage;
+        errorMessage = errorData.error?.message || errorData.error || errorData.message || errorMessage;
       } catch {
         // Если не удалось распарсить JSON, используем текст ответа
         try {
@@ -0,0 +1,37 @@
+/**
+ * Единый формат ответа API: { success, data, meta } при успехе
+ * и { success: false, error: { code, message, details } } при ошибке
+ */
+export interface ApiError {
+  code: string;
+  message: string;
+  details?: Record<string, unknown>;
+}
+
+export interface ApiEnvelope<T> {
+  success: boolean;
+  data?: T;
+  meta?: Record<string, unknown>;
+  error?: ApiError;
+}
+
+/**
+ * Проверяет, что тело ответа имеет формат ApiEnvelope
+ */
+export function isApiEnvelope(body: unknown): body is ApiEnvelope<unknown> {
+  return typeof body === 'object' && body !== null && typeof (body as ApiEnvelope<unknown>).success === 'boolean';
+}
+
+/**
+ * Возвращает data из ответа в едином формате; ответ с success: false превращается в исключение.
+ * Тело в другом формате (например, от старого сервера) возвращается как есть
+ */
+export function unwrapEnvelope<T>(body: unknown): T {
+  if (!isApiEnvelope(body)) {
+    return body as T;
+  }
+  if (!body.success) {
+    throw new Error(body.error?.message || 'Request failed');
+  }
+  return body.data as T;
+}
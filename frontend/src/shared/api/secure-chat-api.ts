@@ -1,3 +1,4 @@
+import { ApiEnvelope, unwrapEnvelope } from './envelope';
 import { SecureApiClient } from './secure-client';
 
 export interface Chat {
@@ -131,15 +132,18 @@ export class SecureChatAPI {
       limit: limit.toString(),
     });
     
-    return this.client.authenticatedGet<User[]>(`/users/search?${params}`);
+    const response = await this.client.authenticatedGet<ApiEnvelope<{ users: User[] }>>(`/users/search?${params}`);
+    return unwrapEnvelope<{ users: User[] }>(response)?.users ?? [];
   }
 
   async getOnlineUsers(): Promise<User[]> {
-    return this.client.authenticatedGet<User[]>('/users/online');
+    const response = await this.client.authenticatedGet<ApiEnvelope<User[]>>('/users/online');
+    return unwrapEnvelope<User[]>(response) ?? [];
   }
 
   async getUser(userId: number): Promise<User> {
-    return this.client.authenticatedGet<User>(`/users/${userId}`);
+    const response = await this.client.authenticatedGet<ApiEnvelope<User>>(`/users/${userId}`);
+    return unwrapEnvelope<User>(response);
   }
 
   // === Authentication (использует обычные запросы, не зашифрованные) ===
@@ -148,8 +152,8 @@ export class SecureChatAPI {
     username: string;
     password: string;
     ecdhPublicKey: string;
-    ecdsaPublicKey: string;
-    rsaPublicKey: string;
+    ecdsaPublicKey?: string;
+    rsaPublicKey?: string;
   }): Promise<{
     token: string;
     expires_at: string;
@@ -1,3 +1,5 @@
+import { unwrapEnvelope } from './envelope';
+
 const API_BASE_URL = '/api/v1';
 
 export interface User {
@@ -48,7 +50,7 @@ class UserAPI {  private async request<T>(endpoint: string, options: RequestInit
       
       try {
         const errorData = await response.json();
-        errorMessage = errorData.error || errorMessage;
+        errorMessage = errorData.error?.message || errorData.error || errorMessage;
         console.log('UserAPI error data:', errorData);
       } catch {
         // Ignore JSON parsing errors
@@ -68,7 +70,7 @@ class UserAPI {  private async request<T>(endpoint: string, options: RequestInit
 
     const responseData = await response.json();
     console.log('UserAPI response data:', responseData);
-    return responseData;
+    return unwrapEnvelope<T>(responseData);
   }
 
   async searchUsers(query: string, limit: number = 10): Promise<SearchUsersResponse> {
@@ -85,7 +87,8 @@ class UserAPI {  private async request<T>(endpoint: string, options: RequestInit
   }
 
   async getOnlineUsers(): Promise<OnlineUsersResponse> {
-    return this.request<OnlineUsersResponse>('/users/online');
+    const users = await this.request<User[]>('/users/online');
+    return { users, total: users.length };
   }
 }
 
@@ -1,5 +1,6 @@
 import CryptoJS from 'crypto-js';
 import { ECDHService } from './ecdh';
+import { unwrapEnvelope } from '@/shared/api/envelope';
 
 export interface EncryptedRequest {
   data: string;      // Зашифрованные данные в base64
@@ -17,14 +18,19 @@ export interface EncryptedResponse {
 export interface KeyExchangeRequest {
   clientPublicKey: string;
   userId: number;
+  saltAware: boolean; // Клиент деривирует ключи с солью сессии из ответа
 }
 
 export interface KeyExchangeResponse {
   serverPublicKey: string;
   sessionId: string;
   expiresAt: number;
+  salt?: string; // hex-соль HKDF сессии; отсутствует, если сервер использует общую соль
 }
 
+// Общая соль HKDF, которую сервер использует, если не вернул соль сессии
+const LEGACY_SESSION_SALT = 'sleek-chat-salt';
+
 export interface SessionKeys {
   aesKey: string;
   hmacKey: string;
@@ -49,7 +55,8 @@ export class EncryptionService {
       
       const request: KeyExchangeRequest = {
         clientPublicKey: keyPair.publicKey,
-        userId: userId
+        userId: userId,
+        saltAware: true
       };
 
       // Отправляем запрос на обмен ключами
@@ -65,13 +72,13 @@ export class EncryptionService {
         throw new Error(`Key exchange failed: ${response.statusText}`);
       }
 
-      const keyExchangeResponse: KeyExchangeResponse = await response.json();
+      const keyExchangeResponse = unwrapEnvelope<KeyExchangeResponse>(await response.json());
 
       // Вычисляем общий секрет
       const sharedSecret = this.ecdhService.computeSharedSecret(keyExchangeResponse.serverPublicKey);
 
       // Деривируем ключи сессии
-      this.sessionKeys = this.deriveSessionKeys(sharedSecret);
+      this.sessionKeys = this.deriveSessionKeys(sharedSecret, keyExchangeResponse.salt);
       this.sessionId = keyExchangeResponse.sessionId;
 
       console.log('Key exchange completed successfully', {
@@ -100,7 +107,8 @@ export class EncryptionService {
       
       const request: KeyExchangeRequest = {
         clientPublicKey: keyPair.publicKey,
-        userId: userId
+        userId: userId,
+        saltAware: true
       };
 
       const response = await fetch(`${baseURL}/api/key-exchange/refresh/${this.sessionId}`, {
@@ -115,13 +123,13 @@ export class EncryptionService {
         throw new Error(`Session refresh failed: ${response.statusText}`);
       }
 
-      const keyExchangeResponse: KeyExchangeResponse = await response.json();
+      const keyExchangeResponse = unwrapEnvelope<KeyExchangeResponse>(await response.json());
 
       // Вычисляем новый общий секрет
       const sharedSecret = this.ecdhService.computeSharedSecret(keyExchangeResponse.serverPublicKey);
 
       // Деривируем новые ключи сессии
-      this.sessionKeys = this.deriveSessionKeys(sharedSecret);
+      this.sessionKeys = this.deriveSessionKeys(sharedSecret, keyExchangeResponse.salt);
       this.sessionId = keyExchangeResponse.sessionId;
 
       console.log('Session refreshed successfully', {
@@ -215,10 +223,13 @@ export class EncryptionService {
     }
 
     let body: string | undefined;
+    const encryptionHeaders: Record<string, string> = {};
     
     if (data) {
       const encryptedRequest = this.encryptRequest(data);
       body = JSON.stringify(encryptedRequest);
+      // Сервер расшифровывает только тела, помеченные этим заголовком
+      encryptionHeaders['X-Encrypted'] = 'true';
     }
 
     const response = await fetch(url, {
@@ -226,6 +237,7 @@ export class EncryptionService {
       method: options.method || 'POST',
       headers: {
         'Content-Type': 'application/json',
+        ...encryptionHeaders,
         ...options.headers,
       },
       body: body,
@@ -266,8 +278,8 @@ export class EncryptionService {
         return false;
       }
 
-      const result = await response.json();
-      return result.valid === true;
+      const result = unwrapEnvelope<{ valid: boolean }>(await response.json());
+      return result?.valid === true;
     } catch (error) {
       console.error('Session validation failed:', error);
       return false;
@@ -325,20 +337,23 @@ export class EncryptionService {
   }
 
   /**
-   * Деривирует ключи сессии из общего секрета
+   * Деривирует ключи сессии из общего секрета по HKDF-SHA256 (RFC 5869) с солью сессии,
+   * полученной от сервера; без соли используется общая соль старых сессий
    */
-  private deriveSessionKeys(sharedSecret: string): SessionKeys {
-    // Используем HKDF-подобный процесс с SHA-256
-    const salt = CryptoJS.enc.Utf8.parse('sleek-chat-salt');
+  private deriveSessionKeys(sharedSecret: string, saltHex?: string): SessionKeys {
+    const salt = saltHex
+      ? CryptoJS.enc.Hex.parse(saltHex)
+      : CryptoJS.enc.Utf8.parse(LEGACY_SESSION_SALT);
     const info = CryptoJS.enc.Utf8.parse('sleek-chat-session-keys');
     
-    // Симулируем HKDF с помощью HMAC
+    // HKDF-Extract: PRK = HMAC(salt, IKM)
     const secretWordArray = CryptoJS.enc.Hex.parse(sharedSecret);
     const prk = CryptoJS.HmacSHA256(secretWordArray, salt);
     
-    // Расширяем ключ до 64 байт (32 для AES + 32 для HMAC)
-    const okm1 = CryptoJS.HmacSHA256(info, prk);
-    const okm2 = CryptoJS.HmacSHA256(CryptoJS.lib.WordArray.create([0x01]).concat(info), prk);
+    // HKDF-Expand до 64 байт (32 для AES + 32 для HMAC): T(i) = HMAC(PRK, T(i-1) | info | i)
+    const counter = (i: number) => CryptoJS.lib.WordArray.create([i << 24], 1);
+    const okm1 = CryptoJS.HmacSHA256(info.clone().concat(counter(1)), prk);
+    const okm2 = CryptoJS.HmacSHA256(okm1.clone().concat(info).concat(counter(2)), prk);
     
     const expandedKey = okm1.concat(okm2);
     
@@ -0,0 +1,36 @@
+import type { ECDSAKeyPair } from './ecdsa';
+import type { RSAKeyPair } from './rsa';
+
+/**
+ * Ключи идентичности пользователя, созданные при регистрации. Сервер сверяет их публичные
+ * части при входе, поэтому между входами они не должны меняться
+ */
+export interface IdentityKeys {
+  ecdsa: ECDSAKeyPair;
+  rsa: RSAKeyPair;
+}
+
+const storageKey = (username: string) => `identityKeys:${username.trim()}`;
+
+/**
+ * Сохраняет ключи идентичности пользователя на этом устройстве
+ */
+export function saveIdentityKeys(username: string, keys: IdentityKeys): void {
+  localStorage.setItem(storageKey(username), JSON.stringify(keys));
+}
+
+/**
+ * Возвращает сохраненные ключи идентичности или null, если на этом устройстве их нет
+ */
+export function loadIdentityKeys(username: string): IdentityKeys | null {
+  const raw = localStorage.getItem(storageKey(username));
+  if (!raw) {
+    return null;
+  }
+  try {
+    const keys = JSON.parse(raw) as IdentityKeys;
+    return keys.ecdsa?.publicKey && keys.rsa?.publicKey ? keys : null;
+  } catch {
+    return null;
+  }
+}
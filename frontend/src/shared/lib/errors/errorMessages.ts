@@ -4,6 +4,8 @@ export const ERROR_MESSAGES: Record<string, string> = {
   'USERNAME_ALREADY_EXISTS': 'This username is already taken. Please choose a different one.',
   'EMAIL_ALREADY_EXISTS': 'An account with this email already exists. Please use a different email or try logging in.',
   'INVALID_CREDENTIALS': 'Invalid username or password. Please check your credentials and try again.',
+  'PUBLIC_KEY_MISMATCH': 'The provided keys do not match the keys registered for this account.',
+  'PUBLIC_KEYS_REQUIRED': 'This account keeps its keys on your device. Sign in from the device where you registered.',
   'INVALID_REQUEST_DATA': 'Please fill in all required fields correctly.',
   
   // Generic errors
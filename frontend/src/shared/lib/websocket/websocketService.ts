@@ -32,12 +32,12 @@ class WebSocketService {
       const host = window.location.host;
       
       // Используем правильный WebSocket URL (nginx проксирует /ws на backend)
-      const baseWsUrl = `${protocol}//${host}/ws`;
-      const wsUrl = useToken ? `${baseWsUrl}?token=${encodeURIComponent(useToken)}` : baseWsUrl;
+      const wsUrl = `${protocol}//${host}/ws`;
       
-      console.log('Connecting to WebSocket:', wsUrl.substring(0, wsUrl.indexOf('token=') + 10) + '...');
+      console.log('Connecting to WebSocket:', wsUrl);
       
-      this.ws = new WebSocket(wsUrl);
+      // Токен передается в Sec-WebSocket-Protocol, чтобы он не попадал в журналы сервера и прокси
+      this.ws = useToken ? new WebSocket(wsUrl, ['bearer', useToken]) : new WebSocket(wsUrl);
       
       this.ws.onopen = this.handleOpen.bind(this);
       this.ws.onclose = this.handleClose.bind(this);